@@ -0,0 +1,121 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+)
+
+// driverMaxAllowedPacket is the default maxAllowedPacket of the MySQL driver, it refuses larger packets itself
+const driverMaxAllowedPacket = 64 << 20
+
+// packetHeadroom is the share of max_allowed_packet a batch is sized for, so a batch of wider rows than the
+// average still fits
+const packetHeadroom = 0.8
+
+// errPacketTooLarge is the server error of a statement exceeding max_allowed_packet
+const errPacketTooLarge = 1153
+
+// adaptiveBatch sizes the batches of a worker from the latency of the batches executed before: the size grows while
+// full batches take less than half the target latency and shrinks in proportion when they take longer than the
+// target. The size is capped by max_allowed_packet and the average bytes of a row. It belongs to a single worker.
+// A nil *adaptiveBatch keeps the full batch size.
+type adaptiveBatch struct {
+	size int
+	// max is the size of a full batch, the statements are built for up to max rows
+	max    int
+	target time.Duration
+	// maxBytes is the payload a batch may have, 0 is unknown
+	maxBytes int64
+	// rowBytes is the rolling average of the bytes of a row
+	rowBytes float64
+}
+
+// newAdaptiveBatch starts with batches of start rows of up to max rows, taking target to execute. maxPacket
+// is max_allowed_packet, 0 if unknown.
+func newAdaptiveBatch(start int, max int, target time.Duration, maxPacket int64) *adaptiveBatch {
+	return &adaptiveBatch{size: min(start, max), max: max, target: target, maxBytes: int64(float64(maxPacket) * packetHeadroom)}
+}
+
+// Rows returns the rows of the next batch, full without adapting
+func (a *adaptiveBatch) Rows(full int) int {
+	if a == nil {
+		return full
+	}
+	return a.size
+}
+
+// Observe adapts the size to a batch of rows and bytes which took duration and failed with err (nil on success),
+// it returns whether the size changed
+func (a *adaptiveBatch) Observe(rows int, bytes int64, duration time.Duration, err error) bool {
+	if a == nil || rows == 0 {
+		return false
+	}
+	size := a.size
+	sample := float64(bytes) / float64(rows)
+	if a.rowBytes == 0 {
+		a.rowBytes = sample
+	} else {
+		a.rowBytes = rateSmoothing*sample + (1-rateSmoothing)*a.rowBytes
+	}
+	switch {
+	case isPacketTooLarge(err):
+		size = rows / 2
+	case err != nil:
+		// the latency of a failed batch says nothing about its size
+	case duration > a.target:
+		// at most halved, a single slow batch may be a hiccup of the server
+		size = max(size/2, int(float64(size)*float64(a.target)/float64(duration)))
+	case duration < a.target/2 && rows >= size:
+		// only a full batch shows that more rows would fit into the target
+		size += max(1, size/2)
+	}
+	if a.maxBytes > 0 && a.rowBytes > 0 {
+		size = min(size, int(float64(a.maxBytes)/a.rowBytes))
+	}
+	size = max(1, min(size, a.max))
+	changed := size != a.size
+	a.size = size
+	return changed
+}
+
+// isPacketTooLarge reports whether err is the driver or the server refusing a statement exceeding max_allowed_packet
+func isPacketTooLarge(err error) bool {
+	if errors.Is(err, mysql.ErrPktTooLarge) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errPacketTooLarge
+}
+
+// batchBytes estimates the bytes a batch of values sends with query: the values quoted and separated
+func batchBytes(query string, values []string) int64 {
+	n := int64(len(query))
+	for _, v := range values {
+		n += int64(len(v)) + 3
+	}
+	return n
+}
+
+// maxBatchRows returns the rows the statements are built for: the rows of a full batch or, with -adaptive-batch,
+// -max-batch-size rows as far as their placeholders fit into a statement
+func (c *Config) maxBatchRows(columns int) int {
+	if !c.AdaptiveBatch {
+		return c.batchRows(columns)
+	}
+	return max(1, min(c.MaxBatchSize, maxPlaceholders/max(1, columns)))
+}
+
+// queryMaxAllowedPacket returns the max_allowed_packet of the server, at most the limit of the driver
+func queryMaxAllowedPacket(ctx context.Context, db *sql.DB) (int64, error) {
+	var packet int64
+	if err := db.QueryRowContext(ctx, "SELECT @@max_allowed_packet").Scan(&packet); err != nil {
+		return 0, err
+	}
+	log.Debugf("max_allowed_packet is %d bytes", packet)
+	return min(packet, driverMaxAllowedPacket), nil
+}
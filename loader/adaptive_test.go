@@ -0,0 +1,101 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"gotest.tools/v3/assert"
+)
+
+func TestAdaptiveBatchLatency(t *testing.T) {
+	a := newAdaptiveBatch(100, 1000, 200*time.Millisecond, 0)
+	assert.Equal(t, a.Rows(1000), 100)
+
+	// fast full batches grow by half
+	assert.Assert(t, a.Observe(100, 10_000, 50*time.Millisecond, nil))
+	assert.Equal(t, a.Rows(1000), 150)
+	// a batch which isn't full (flushed after the interval) doesn't grow the size
+	assert.Assert(t, !a.Observe(20, 2_000, time.Millisecond, nil))
+	// within the target nothing changes
+	assert.Assert(t, !a.Observe(150, 15_000, 150*time.Millisecond, nil))
+	// too slow shrinks in proportion
+	assert.Assert(t, a.Observe(150, 15_000, 300*time.Millisecond, nil))
+	assert.Equal(t, a.Rows(1000), 100)
+	// but at most halves
+	a.Observe(100, 10_000, 10*time.Second, nil)
+	assert.Equal(t, a.Rows(1000), 50)
+	// failures keep the size
+	assert.Assert(t, !a.Observe(50, 5_000, 10*time.Second, fmt.Errorf("deadlock")))
+
+	for i := 0; i < 20; i++ {
+		a.Observe(a.Rows(1000), 100, time.Millisecond, nil)
+	}
+	assert.Equal(t, a.Rows(1000), 1000, "capped by the full batch")
+	for i := 0; i < 20; i++ {
+		a.Observe(a.Rows(1000), 100, time.Minute, nil)
+	}
+	assert.Equal(t, a.Rows(1000), 1)
+
+	var nilBatch *adaptiveBatch
+	assert.Equal(t, nilBatch.Rows(8), 8)
+	assert.Assert(t, !nilBatch.Observe(8, 100, time.Second, nil))
+}
+
+func TestAdaptiveBatchMaxAllowedPacket(t *testing.T) {
+	// 80% of 100000 bytes fit 200 rows of 400 bytes
+	a := newAdaptiveBatch(100, 1000, time.Second, 100_000)
+	a.Observe(100, 40_000, time.Millisecond, nil)
+	assert.Equal(t, a.Rows(1000), 150)
+	a.Observe(150, 60_000, time.Millisecond, nil)
+	assert.Equal(t, a.Rows(1000), 200)
+	a.Observe(200, 80_000, time.Millisecond, nil)
+	assert.Equal(t, a.Rows(1000), 200)
+
+	// a batch refused for its size halves it
+	a.Observe(200, 80_000, time.Millisecond, &mysql.MySQLError{Number: 1153, Message: "Got a packet bigger than 'max_allowed_packet' bytes"})
+	assert.Equal(t, a.Rows(1000), 100)
+	a.Observe(100, 40_000, time.Millisecond, fmt.Errorf("batch failed: %w", mysql.ErrPktTooLarge))
+	assert.Equal(t, a.Rows(1000), 50)
+}
+
+func TestMaxBatchRows(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-batch-size", "50"})
+	assert.NilError(t, err)
+	assert.Equal(t, l.config.maxBatchRows(10), 50)
+
+	l.config, err = ParseFlags([]string{"-batch-size", "50", "-adaptive-batch"})
+	assert.NilError(t, err)
+	assert.Equal(t, l.config.maxBatchRows(10), 1000)
+	// the placeholders of a statement limit a batch of wide rows
+	assert.Equal(t, l.config.maxBatchRows(100), 655)
+
+	_, err = ParseFlags([]string{"-batch-size", "50", "-adaptive-batch", "-max-batch-size", "10"})
+	assert.ErrorContains(t, err, "invalid max-batch-size 10, must be at least the batch-size 50")
+	_, err = ParseFlags([]string{"-adaptive-batch", "-target-batch-latency", "0s"})
+	assert.ErrorContains(t, err, "invalid target-batch-latency 0s, must be positive")
+	_, err = ParseFlags([]string{"-adaptive-batch", "-idempotency-table", "import_batches"})
+	assert.ErrorContains(t, err, "-adaptive-batch can't be combined with -idempotency-table")
+}
+
+func TestQueryMaxAllowedPacket(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT @@max_allowed_packet").WillReturnRows(sqlmock.NewRows([]string{"@@max_allowed_packet"}).AddRow(4 << 20))
+	mock.ExpectQuery("SELECT @@max_allowed_packet").WillReturnRows(sqlmock.NewRows([]string{"@@max_allowed_packet"}).AddRow(1 << 30))
+
+	packet, err := queryMaxAllowedPacket(context.Background(), db)
+	assert.NilError(t, err)
+	assert.Equal(t, packet, int64(4<<20))
+	// the driver refuses packets above its own limit
+	packet, err = queryMaxAllowedPacket(context.Background(), db)
+	assert.NilError(t, err)
+	assert.Equal(t, packet, int64(driverMaxAllowedPacket))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,109 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// aggregateVarPattern matches the variables of a post import statement, e.g. {{rows}} or {{sum:GlobalRank}}
+var aggregateVarPattern = regexp.MustCompile(`\{\{(\w+)(?::(\w+))?\}\}`)
+
+// aggregateVar is a variable of the post import statement, column is set for the per column aggregates
+type aggregateVar struct {
+	name   string
+	column string
+	index  int
+}
+
+// parsePostImport replaces the variables of statement by placeholders and returns them in order
+func parsePostImport(statement string) (string, []aggregateVar, error) {
+	var vars []aggregateVar
+	var err error
+	query := aggregateVarPattern.ReplaceAllStringFunc(statement, func(m string) string {
+		groups := aggregateVarPattern.FindStringSubmatch(m)
+		v := aggregateVar{name: groups[1], column: groups[2]}
+		switch {
+		case (v.name == "rows" || v.name == "rows_read" || v.name == "duration_ms") && v.column == "":
+		case v.name == "sum" && v.column != "":
+		default:
+			err = fmt.Errorf("invalid variable %s in post import statement, available are {{rows}}, {{rows_read}}, {{duration_ms}} and {{sum:column}}", m)
+		}
+		vars = append(vars, v)
+		return "?"
+	})
+	return query, vars, err
+}
+
+// Aggregates sums up columns of the inserted rows, it is safe for concurrent use by all workers.
+// A nil *Aggregates sums up nothing.
+type Aggregates struct {
+	mu sync.Mutex
+	// sums are the sums by column index
+	sums map[int]float64
+}
+
+// NewAggregates sums up the columns with the given indexes
+func NewAggregates(indexes []int) *Aggregates {
+	a := &Aggregates{sums: make(map[int]float64, len(indexes))}
+	for _, i := range indexes {
+		a.sums[i] = 0
+	}
+	return a
+}
+
+// Add adds the rows of an inserted batch, values are the values of all rows with columns values each.
+// Values which are no number are left out.
+func (a *Aggregates) Add(values []string, columns int) {
+	if a == nil || columns <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for row := 0; row+columns <= len(values); row += columns {
+		for i, sum := range a.sums {
+			if n, err := strconv.ParseFloat(strings.TrimSpace(values[row+i]), 64); err == nil {
+				a.sums[i] = sum + n
+			}
+		}
+	}
+}
+
+// Sum returns the sum of the column with index i
+func (a *Aggregates) Sum(i int) float64 {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sums[i]
+}
+
+// RunPostImport executes the post import statement with the stats and the aggregates of the run bound to its
+// variables
+func RunPostImport(ctx context.Context, db *sql.DB, query string, vars []aggregateVar, stats Stats, aggregates *Aggregates) error {
+	args := make([]any, len(vars))
+	for i, v := range vars {
+		switch v.name {
+		case "rows":
+			args[i] = stats.RowsInserted
+		case "rows_read":
+			args[i] = stats.RowsRead
+		case "duration_ms":
+			args[i] = stats.Duration.Milliseconds()
+		case "sum":
+			args[i] = aggregates.Sum(v.index)
+		}
+	}
+	log.Printf("Running post import statement with %v", args)
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("post import statement failed: %w", err)
+	}
+	return nil
+}
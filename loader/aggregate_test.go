@@ -0,0 +1,62 @@
+package loader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+)
+
+const testPostImport = "INSERT INTO import_summary (rows_inserted, rank_total) VALUES ({{rows}}, {{sum:GlobalRank}})"
+
+func TestParsePostImport(t *testing.T) {
+	query, vars, err := parsePostImport(testPostImport)
+	assert.NilError(t, err)
+	assert.Equal(t, query, "INSERT INTO import_summary (rows_inserted, rank_total) VALUES (?, ?)")
+	assert.DeepEqual(t, vars, []aggregateVar{{name: "rows"}, {name: "sum", column: "GlobalRank"}}, cmp.AllowUnexported(aggregateVar{}))
+
+	_, _, err = parsePostImport("SELECT {{avg:GlobalRank}}")
+	assert.ErrorContains(t, err, "invalid variable {{avg:GlobalRank}}")
+	_, _, err = parsePostImport("SELECT {{sum}}")
+	assert.ErrorContains(t, err, "invalid variable {{sum}}")
+}
+
+func TestAggregatesAdd(t *testing.T) {
+	a := NewAggregates([]int{0})
+	a.Add([]string{"1", "google.com", "2", "facebook.com"}, 2)
+	a.Add([]string{" 3", "youtube.com", "n/a", "example.com"}, 2)
+	assert.Equal(t, a.Sum(0), 6.0)
+
+	var none *Aggregates
+	none.Add([]string{"1"}, 1)
+	assert.Equal(t, none.Sum(0), 0.0)
+}
+
+func TestRunPostImport(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-post-import-sql", testPostImport})
+	assert.NilError(t, err)
+	assert.NilError(t, l.config.ResolveColumns([]string{"Domain", "GlobalRank"}))
+	l.aggregates = NewAggregates(l.config.sumIndexes())
+	l.aggregates.Add([]string{"google.com", "1", "facebook.com", "2"}, 2)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec("INSERT INTO import_summary (rows_inserted, rank_total) VALUES (?, ?)").
+		WithArgs(int64(2), 3.0).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	stats := Stats{RowsRead: 2, RowsInserted: 2, Duration: time.Second}
+	assert.NilError(t, RunPostImport(context.Background(), db, l.config.postImportQuery, l.config.postImportVars, stats, l.aggregates))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostImportUnknownColumn(t *testing.T) {
+	c, err := ParseFlags([]string{"-post-import-sql", "SELECT {{sum:Rank}}"})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.ResolveColumns([]string{"Domain"}), "unknown column 'Rank'")
+}
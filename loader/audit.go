@@ -0,0 +1,98 @@
+package loader
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes a single executed batch, it is written as one JSON line to the audit file
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Worker     int       `json:"worker"`
+	Rows       int       `json:"rows"`
+	Bytes      int       `json:"bytes"`
+	DurationMs float64   `json:"duration_ms"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	// RowRanges are the data row numbers covered by the batch as [first, last] ranges, since all workers
+	// share the jobs channel a batch does not necessarily cover a single contiguous range
+	RowRanges [][2]int `json:"row_ranges"`
+}
+
+// AuditLog writes an AuditRecord for every batch, it is safe for concurrent use by all workers.
+// A nil *AuditLog is valid and records nothing.
+type AuditLog struct {
+	mu      sync.Mutex
+	w       io.WriteCloser
+	encoder *json.Encoder
+}
+
+// OpenAuditLog creates (or truncates) the audit file filename
+func OpenAuditLog(filename string) (*AuditLog, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditLog(f), nil
+}
+
+// NewAuditLog returns an AuditLog writing to w
+func NewAuditLog(w io.WriteCloser) *AuditLog {
+	return &AuditLog{w: w, encoder: json.NewEncoder(w)}
+}
+
+// Record writes the audit record of a batch with the given data row numbers and values
+func (a *AuditLog) Record(workerIndex int, rows []int, values []string, duration time.Duration, err error) {
+	if a == nil {
+		return
+	}
+	record := AuditRecord{
+		Time:       time.Now(),
+		Worker:     workerIndex,
+		Rows:       len(rows),
+		DurationMs: float64(duration.Microseconds()) / 1000,
+		Status:     "ok",
+		RowRanges:  rowRanges(rows),
+	}
+	for _, v := range values {
+		record.Bytes += len(v)
+	}
+	if err != nil {
+		record.Status = "failed"
+		record.Error = err.Error()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// a failing audit write must not stop the import
+	_ = a.encoder.Encode(record)
+}
+
+// Close closes the audit file
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.w.Close()
+}
+
+// rowRanges compresses row numbers into sorted [first, last] ranges of consecutive numbers
+func rowRanges(rows []int) [][2]int {
+	sorted := append([]int(nil), rows...)
+	sort.Ints(sorted)
+	ranges := make([][2]int, 0)
+	for _, r := range sorted {
+		if n := len(ranges); n > 0 && ranges[n-1][1]+1 == r {
+			ranges[n-1][1] = r
+			continue
+		}
+		ranges = append(ranges, [2]int{r, r})
+	}
+	return ranges
+}
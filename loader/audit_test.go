@@ -0,0 +1,45 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRowRanges(t *testing.T) {
+	assert.DeepEqual(t, rowRanges([]int{}), [][2]int{})
+	assert.DeepEqual(t, rowRanges([]int{3, 1, 2, 7, 9, 8, 12}), [][2]int{{1, 3}, {7, 9}, {12, 12}})
+}
+
+func TestAuditLogRecord(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewAuditLog(nopWriteCloser{&buf})
+	a.Record(3, []int{5, 6}, []string{"ab", "c", "de", "f"}, 1500*time.Microsecond, nil)
+	a.Record(4, []int{7}, []string{"x", "y"}, time.Millisecond, errors.New("Error 1062: Duplicate entry"))
+	assert.NilError(t, a.Close())
+
+	decoder := json.NewDecoder(&buf)
+	var ok, failed AuditRecord
+	assert.NilError(t, decoder.Decode(&ok))
+	assert.NilError(t, decoder.Decode(&failed))
+
+	assert.Equal(t, ok.Worker, 3)
+	assert.Equal(t, ok.Rows, 2)
+	assert.Equal(t, ok.Bytes, 6)
+	assert.Equal(t, ok.DurationMs, 1.5)
+	assert.Equal(t, ok.Status, "ok")
+	assert.DeepEqual(t, ok.RowRanges, [][2]int{{5, 6}})
+
+	assert.Equal(t, failed.Status, "failed")
+	assert.Equal(t, failed.Error, "Error 1062: Duplicate entry")
+}
+
+func TestNilAuditLog(t *testing.T) {
+	var a *AuditLog
+	a.Record(1, []int{1}, []string{"a"}, time.Millisecond, nil)
+	assert.NilError(t, a.Close())
+}
@@ -0,0 +1,246 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// autoTuneGain is the gain in throughput more workers need to bring to be kept
+const autoTuneGain = 0.05
+
+// Tuner finds the number of workers inserting the most rows per second with -auto-tune: it starts with few
+// workers, measures the throughput of every interval and adds workers as long as they raise it by autoTuneGain,
+// otherwise it goes back to the best count and stays there. The workers beyond the active ones are parked and give
+// their connections back, the pool is sized for the active ones. A nil *Tuner keeps all workers running.
+type Tuner struct {
+	mu       sync.Mutex
+	active   int
+	max      int
+	db       *sql.DB
+	settled  bool
+	finished bool
+	// changed is closed and replaced whenever active or finished change, waking up the parked workers
+	changed chan struct{}
+	// best is the highest throughput yet in rows per second, reached with bestActive workers at bestLatency
+	best        float64
+	bestActive  int
+	bestLatency time.Duration
+	// inserted and workers count the rows inserted and the batches of the measured run
+	inserted *atomic.Int64
+	workers  *workerCounter
+	// the counters at the start of the interval
+	rows, batches int64
+	batchTime     time.Duration
+	stop          chan struct{}
+	done          chan struct{}
+}
+
+// validateAutoTune checks the -auto-tune options
+func (c *Config) validateAutoTune() error {
+	if !c.AutoTune {
+		return nil
+	}
+	if c.MinWorkers < 1 {
+		return fmt.Errorf("invalid min-workers %d, must be positive", c.MinWorkers)
+	}
+	if c.AutoTuneInterval <= 0 {
+		return fmt.Errorf("invalid auto-tune-interval %s, must be positive", c.AutoTuneInterval)
+	}
+	// the parked workers would hold up the rows dealt to them, a chunk its transaction and the pool is sized by the tuner
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"shard-jobs", c.ShardJobs}, {"partition-by-worker", c.PartitionBy != ""}, {"route", len(c.Routes) > 0},
+		{"idempotency-table", c.IdempotencyTable != ""}, {"shard", len(c.Shards) > 0}, {"commit-every", c.CommitEvery > 0},
+		{"max-open-conns", c.MaxOpenConns > 0}, {"mode load-data", c.Mode == ModeLoadData}} {
+		if f.set {
+			return fmt.Errorf("-auto-tune can't be combined with -%s", f.name)
+		}
+	}
+	return nil
+}
+
+// NewTuner starts with start of max workers, sizing the pool of db (nil in a dry run) for them
+func NewTuner(start int, max int, db *sql.DB) *Tuner {
+	t := &Tuner{active: min(start, max), max: max, db: db, changed: make(chan struct{})}
+	t.resizePool()
+	return t
+}
+
+// Start measures the throughput of the rows counted by inserted and the batches of workers every interval and
+// adapts the workers until Finish
+func (t *Tuner) Start(interval time.Duration, inserted *atomic.Int64, workers *workerCounter) {
+	if t == nil {
+		return
+	}
+	t.inserted, t.workers = inserted, workers
+	log.Printf("Auto-tune starts with %d of at most %d workers", t.active, t.max)
+	t.stop, t.done = make(chan struct{}), make(chan struct{})
+	t.rows, t.batches, t.batchTime = t.counters()
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.measure(interval)
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// counters returns the rows inserted and the batches executed so far and the time they took
+func (t *Tuner) counters() (rows int64, batches int64, batchTime time.Duration) {
+	for _, w := range t.workers.Stats() {
+		batches += w.Batches
+		batchTime += w.BatchTime
+	}
+	return t.inserted.Load(), batches, batchTime
+}
+
+// measure takes the throughput and latency of the interval since the last one and adapts the workers
+func (t *Tuner) measure(interval time.Duration) {
+	rows, batches, batchTime := t.counters()
+	var latency time.Duration
+	if batches > t.batches {
+		latency = (batchTime - t.batchTime) / time.Duration(batches-t.batches)
+	}
+	t.Observe(float64(rows-t.rows)/interval.Seconds(), latency)
+	t.rows, t.batches, t.batchTime = rows, batches, batchTime
+}
+
+// Observe adapts the workers to the throughput (rows per second) and the average batch latency the active workers
+// reached in the last interval. An interval without rows (e.g. while the reader warms up) changes nothing.
+func (t *Tuner) Observe(throughput float64, latency time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.settled || t.finished || throughput == 0 {
+		return
+	}
+	if t.bestActive > 0 && throughput <= t.best*(1+autoTuneGain) {
+		log.Printf("Auto-tune: %d workers inserted %.0f rows/s at %s average batch latency, no gain over %d workers",
+			t.active, throughput, latency.Round(time.Millisecond), t.bestActive)
+		t.settle()
+		return
+	}
+	t.best, t.bestActive, t.bestLatency = throughput, t.active, latency
+	if t.active >= t.max {
+		t.settle()
+		return
+	}
+	next := min(t.max, t.active+max(1, t.active/2))
+	log.Printf("Auto-tune: %d workers inserted %.0f rows/s at %s average batch latency, trying %d workers",
+		t.active, throughput, latency.Round(time.Millisecond), next)
+	t.setActive(next)
+}
+
+// settle stays with the best number of workers, logging it for the next runs
+func (t *Tuner) settle() {
+	t.settled = true
+	t.setActive(t.bestActive)
+	log.Printf("Auto-tune settled on %d workers (%.0f rows/s at %s average batch latency), use -workers %d to start with them next time",
+		t.bestActive, t.best, t.bestLatency.Round(time.Millisecond), t.bestActive)
+}
+
+func (t *Tuner) setActive(n int) {
+	if n == t.active {
+		return
+	}
+	t.active = n
+	t.resizePool()
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// resizePool sizes the pool for the active workers, the connections of the parked workers are closed by them
+func (t *Tuner) resizePool() {
+	if t.db == nil {
+		return
+	}
+	t.db.SetMaxOpenConns(t.active + dbExtraConns)
+	t.db.SetMaxIdleConns(t.active + dbExtraConns)
+}
+
+// Active returns the number of workers inserting rows
+func (t *Tuner) Active() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.active
+}
+
+// Parked reports whether worker workerIndex is to wait instead of taking rows
+func (t *Tuner) Parked(workerIndex int) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return workerIndex >= t.active && !t.finished
+}
+
+// Park gives the connection of a parked worker back and waits until the worker is active again, it returns false
+// when the worker isn't needed anymore because the input was read (the active workers insert the rows left) or ctx
+// is done
+func (t *Tuner) Park(ctx context.Context, workerIndex int, sess *session) (bool, error) {
+	if sess != nil {
+		_ = sess.closeStmts()
+		_ = sess.conn.Close()
+	}
+	log.Debugf("Worker %d is parked", workerIndex)
+	for {
+		t.mu.Lock()
+		active, finished, changed := workerIndex < t.active, t.finished, t.changed
+		t.mu.Unlock()
+		if finished {
+			return false, nil
+		}
+		if active {
+			break
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false, nil
+		}
+	}
+	log.Debugf("Worker %d is active again", workerIndex)
+	if sess == nil {
+		return true, nil
+	}
+	return true, sess.connect(ctx)
+}
+
+// Finish stops adapting the workers once the input is read, the parked workers exit
+func (t *Tuner) Finish() {
+	if t == nil {
+		return
+	}
+	if t.stop != nil {
+		close(t.stop)
+		<-t.done
+		t.stop = nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.settled && !t.finished && t.bestActive > 0 {
+		log.Printf("Auto-tune ended with %d workers before it settled, the best were %d workers (%.0f rows/s)", t.active, t.bestActive, t.best)
+	}
+	t.finished = true
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
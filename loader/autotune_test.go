@@ -0,0 +1,117 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestTunerObserve(t *testing.T) {
+	db, _, err := sqlmock.New()
+	assert.NilError(t, err)
+	defer db.Close()
+	tn := NewTuner(2, 8, db)
+	assert.Equal(t, db.Stats().MaxOpenConnections, 2+dbExtraConns)
+
+	// an interval without rows changes nothing
+	tn.Observe(0, 0)
+	assert.Equal(t, tn.Active(), 2)
+	tn.Observe(1000, 10*time.Millisecond)
+	assert.Equal(t, tn.Active(), 3)
+	tn.Observe(1500, 10*time.Millisecond)
+	assert.Equal(t, tn.Active(), 4)
+	assert.Equal(t, db.Stats().MaxOpenConnections, 4+dbExtraConns)
+	// 6 workers don't do better than 4, so the tuner goes back to 4 and stays there
+	tn.Observe(2000, 12*time.Millisecond)
+	assert.Equal(t, tn.Active(), 6)
+	tn.Observe(2050, 30*time.Millisecond)
+	assert.Equal(t, tn.Active(), 4)
+	assert.Equal(t, db.Stats().MaxOpenConnections, 4+dbExtraConns)
+	tn.Observe(5000, 10*time.Millisecond)
+	assert.Equal(t, tn.Active(), 4)
+
+	// the tuner stops at the maximum
+	tn = NewTuner(4, 5, nil)
+	tn.Observe(1000, 0)
+	assert.Equal(t, tn.Active(), 5)
+	tn.Observe(2000, 0)
+	assert.Equal(t, tn.Active(), 5)
+	assert.Assert(t, tn.settled)
+
+	var nilTuner *Tuner
+	nilTuner.Observe(1000, 0)
+	nilTuner.Finish()
+	assert.Assert(t, !nilTuner.Parked(7))
+}
+
+func TestTunerPark(t *testing.T) {
+	tn := NewTuner(1, 3, nil)
+	assert.Assert(t, !tn.Parked(0))
+	assert.Assert(t, tn.Parked(1))
+	woken := make(chan bool)
+	for i := 1; i <= 2; i++ {
+		go func(i int) {
+			run, err := tn.Park(context.Background(), i, nil)
+			assert.Check(t, err)
+			woken <- run
+		}(i)
+	}
+	// worker 1 is needed once there are two workers, worker 2 exits when the input is read
+	tn.Observe(100, 0)
+	assert.Equal(t, <-woken, true)
+	tn.Finish()
+	assert.Equal(t, <-woken, false)
+	assert.Assert(t, !tn.Parked(2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	run, err := NewTuner(1, 2, nil).Park(ctx, 1, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, !run)
+}
+
+func TestParseFlagsAutoTune(t *testing.T) {
+	c, err := ParseFlags([]string{"-auto-tune", "-workers", "64", "-min-workers", "8", "-auto-tune-interval", "5s"})
+	assert.NilError(t, err)
+	assert.Assert(t, c.AutoTune)
+	assert.Equal(t, c.MinWorkers, 8)
+	assert.Equal(t, c.AutoTuneInterval, 5*time.Second)
+
+	for want, args := range map[string][]string{
+		"invalid min-workers 0, must be positive":           {"-auto-tune", "-min-workers", "0"},
+		"invalid auto-tune-interval 0s, must be positive":   {"-auto-tune", "-auto-tune-interval", "0"},
+		"-auto-tune can't be combined with -shard-jobs":     {"-auto-tune", "-shard-jobs"},
+		"-auto-tune can't be combined with -max-open-conns": {"-auto-tune", "-max-open-conns", "200"},
+		"-auto-tune can't be combined with -commit-every":   {"-auto-tune", "-commit-every", "10"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestImportAutoTune(t *testing.T) {
+	l := withConnConfig(t, 5)
+	var csv strings.Builder
+	csv.WriteString("id\n")
+	for i := 1; i <= 500; i++ {
+		fmt.Fprintf(&csv, "%d\n", i)
+	}
+	filename := filepath.Join(t.TempDir(), "ids.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte(csv.String()), 0o644))
+	var err error
+	l.config, err = ParseFlags([]string{"-csv", filename, "-table", "ids", "-dry-run", "-workers", "6", "-batch-size", "10",
+		"-auto-tune", "-min-workers", "2", "-auto-tune-interval", "1ms"})
+	assert.NilError(t, err)
+	stats, err := New(nil, l.config).Run(context.Background())
+	assert.NilError(t, err)
+	// the parked workers exit once the input is read
+	assert.Equal(t, stats.RowsInserted, int64(500))
+	assert.Equal(t, stats.Unaccounted(), int64(0))
+}
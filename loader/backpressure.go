@@ -0,0 +1,104 @@
+package loader
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// queueSampleInterval is how often the length of the jobs channel is sampled
+var queueSampleInterval = 100 * time.Millisecond
+
+// QueueMonitor samples the length of the jobs channel between the reader and the workers. A channel staying full
+// means the workers (or the database) are slower than the reader, which then only waits for the workers. A nil
+// *QueueMonitor samples nothing.
+type QueueMonitor struct {
+	queue     jobQueue
+	threshold time.Duration
+	stop      chan struct{}
+	done      chan struct{}
+
+	mu      sync.Mutex
+	peak    int
+	samples int64
+	total   int64
+	full    time.Duration
+	stalls  int64
+}
+
+// StartQueueMonitor samples jobs until Stop is called, whenever the channel stays full for longer than threshold
+// a warning is logged (0 disables the warning). An unbuffered channel isn't sampled.
+func StartQueueMonitor(jobs chan Job, threshold time.Duration) *QueueMonitor {
+	return startQueueMonitor(jobQueue{jobs: jobs}, threshold)
+}
+
+// startQueueMonitor samples the channels of queue like StartQueueMonitor, with shards the queue is full when the
+// channel of a worker is
+func startQueueMonitor(queue jobQueue, threshold time.Duration) *QueueMonitor {
+	if queue.capacity() == 0 {
+		return nil
+	}
+	m := &QueueMonitor{queue: queue, threshold: threshold, stop: make(chan struct{}), done: make(chan struct{})}
+	go m.run()
+	return m
+}
+
+func (m *QueueMonitor) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(queueSampleInterval)
+	defer ticker.Stop()
+	var fullSince time.Time
+	warned := false
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			n := m.queue.length()
+			m.mu.Lock()
+			m.peak = max(m.peak, n)
+			m.samples++
+			m.total += int64(n)
+			if !m.queue.full() {
+				fullSince, warned = time.Time{}, false
+			} else if fullSince.IsZero() {
+				fullSince = now
+			} else {
+				m.full += queueSampleInterval
+				if m.threshold > 0 && !warned && now.Sub(fullSince) >= m.threshold {
+					// once per stall, the warning is logged again after the channel had room in between
+					warned = true
+					m.stalls++
+					log.Warnf("Workers falling behind: the jobs buffer of %d rows has been full for %s", m.queue.capacity(), now.Sub(fullSince).Round(time.Millisecond))
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// Stop stops sampling
+func (m *QueueMonitor) Stop() {
+	if m == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+}
+
+// collect fills in the queue stats
+func (m *QueueMonitor) collect(s *Stats) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.QueueCapacity = m.queue.capacity()
+	s.QueuePeak = m.peak
+	if m.samples > 0 {
+		s.QueueAverage = float64(m.total) / float64(m.samples)
+	}
+	s.QueueFull = m.full
+	s.QueueStalls = m.stalls
+}
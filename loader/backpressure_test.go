@@ -0,0 +1,74 @@
+package loader
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func withQueueSampleInterval(t *testing.T, interval time.Duration) {
+	saved := queueSampleInterval
+	t.Cleanup(func() { queueSampleInterval = saved })
+	queueSampleInterval = interval
+}
+
+func TestQueueMonitorSlowDatabase(t *testing.T) {
+	l := withConnConfig(t, 5)
+	withQueueSampleInterval(t, 5*time.Millisecond)
+	l.config.Workers = 1
+	l.config.BatchSize = 1
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	const n = 6
+	query := "INSERT INTO `domain` (`GlobalRank`,`Domain`) VALUES (?,?)"
+	for i := 1; i <= n; i++ {
+		// every batch takes long enough for the reader to fill the buffer
+		mock.ExpectExec(query).WillDelayFor(60 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	jobs := make(chan Job, 2)
+	queue := StartQueueMonitor(jobs, 30*time.Millisecond)
+	workers := newDomainLoader(l, db).StartWorkers(context.Background(), jobs)
+	for i := 1; i <= n; i++ {
+		jobs <- Job{Row: i, Values: []string{strconv.Itoa(i), "google.com"}}
+	}
+	close(jobs)
+	assert.NilError(t, workers.Wait())
+	queue.Stop()
+
+	var stats Stats
+	queue.collect(&stats)
+	assert.Equal(t, stats.QueueCapacity, 2)
+	assert.Equal(t, stats.QueuePeak, 2)
+	assert.Assert(t, stats.QueueAverage > 0)
+	assert.Assert(t, stats.QueueFull > 0)
+	assert.Assert(t, stats.QueueStalls >= 1, "the workers falling behind is reported")
+	assert.Equal(t, l.rowsInserted.Load(), int64(n))
+}
+
+func TestQueueMonitorKeepingUp(t *testing.T) {
+	withQueueSampleInterval(t, time.Millisecond)
+	jobs := make(chan Job, 10)
+	queue := StartQueueMonitor(jobs, time.Millisecond)
+	jobs <- Job{Row: 1}
+	time.Sleep(20 * time.Millisecond)
+	queue.Stop()
+
+	var stats Stats
+	queue.collect(&stats)
+	assert.Equal(t, stats.QueuePeak, 1)
+	assert.Equal(t, stats.QueueFull, time.Duration(0))
+	assert.Equal(t, stats.QueueStalls, int64(0))
+
+	// an unbuffered channel can't be sampled
+	unbuffered := StartQueueMonitor(make(chan Job), time.Second)
+	assert.Assert(t, unbuffered == nil)
+	unbuffered.Stop()
+}
@@ -0,0 +1,340 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the combinations the bench command runs without -bench-workers and -bench-batch-sizes
+var (
+	defaultBenchWorkers    = []int{1, 2, 4, 8, 16}
+	defaultBenchBatchSizes = []int{100, 500, 1000, 5000}
+)
+
+// benchSeed seeds the values of the synthetic rows, every run inserts the same rows
+const benchSeed = 1
+
+// BenchResult is the import of the synthetic rows by a combination of the bench command
+type BenchResult struct {
+	Workers   int
+	BatchSize int
+	Stats     Stats
+}
+
+// Bench imports -bench-rows synthetic rows into the -table for every combination of -bench-workers and
+// -bench-batch-sizes, to find the settings with the most throughput without a real dataset. The rows have the
+// columns of the table (read from the information schema of MySQL) or -bench-columns text columns.
+type Bench struct {
+	db     *sql.DB
+	config Config
+}
+
+// NewBench benchmarks the imports of c into db
+func NewBench(db *sql.DB, c Config) *Bench {
+	return &Bench{db: db, config: c}
+}
+
+// Run imports the rows with every combination, the table is truncated before every run (-truncate is required to
+// confirm that). It stops at the first failing run.
+func (b *Bench) Run(ctx context.Context) ([]BenchResult, error) {
+	if !b.config.DryRun && !b.config.Truncate {
+		return nil, fmt.Errorf("bench inserts the rows of every run into table %s, give -truncate to empty it before every run (or -dry-run)", b.config.Table)
+	}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"watch-dir", b.config.WatchDir != ""}, {"checkpoint-file", b.config.CheckpointFile != ""}, {"resume", b.config.Resume},
+		{"swap", b.config.Swap}, {"route", len(b.config.Routes) > 0}} {
+		if f.set {
+			return nil, fmt.Errorf("-%s can't be combined with bench", f.name)
+		}
+	}
+	columns, err := b.columns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	workers, batchSizes := b.config.BenchWorkers, b.config.BenchBatchSizes
+	if len(workers) == 0 {
+		workers = defaultBenchWorkers
+	}
+	if len(batchSizes) == 0 {
+		batchSizes = defaultBenchBatchSizes
+	}
+	var results []BenchResult
+	for _, w := range workers {
+		for _, size := range batchSizes {
+			c := b.config
+			c.Workers, c.BatchSize = w, size
+			// the generated headers are the columns, -skip-columns left them out already
+			c.SkipColumns = nil
+			log.Printf("Bench run %d of %d: %d rows with -workers %d -batch-size %d", len(results)+1, len(workers)*len(batchSizes),
+				c.BenchRows, w, size)
+			stats, err := New(b.db, c).RunReader(ctx, newBenchReader(columns, c.BenchRows, c.BenchCardinality))
+			if err != nil {
+				return results, fmt.Errorf("bench run with -workers %d -batch-size %d failed: %w", w, size, err)
+			}
+			log.Printf("Bench run with -workers %d -batch-size %d: %.0f rows/s", w, size, stats.Throughput())
+			results = append(results, BenchResult{Workers: w, BatchSize: size, Stats: stats})
+		}
+	}
+	return results, nil
+}
+
+// columns returns the generators of the columns of the rows: the columns of the table but the -skip-columns with
+// MySQL, -bench-columns text columns otherwise or for a table which doesn't exist yet
+func (b *Bench) columns(ctx context.Context) ([]benchColumn, error) {
+	var types []ColumnType
+	if !b.config.DryRun && b.config.isMySQL() {
+		var err error
+		if types, err = TableColumnTypes(ctx, b.db, b.config.InsertTable()); err != nil {
+			return nil, fmt.Errorf("could not read the columns of table %s: %w", b.config.InsertTable(), err)
+		}
+	}
+	var columns []benchColumn
+	for _, t := range types {
+		if slices.Contains(b.config.SkipColumns, t.Name) {
+			continue
+		}
+		value, err := benchValue(t, b.config.BenchWidth)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, benchColumn{name: t.Name, value: value})
+	}
+	if len(types) > 0 {
+		if len(columns) == 0 {
+			return nil, fmt.Errorf("-skip-columns skips all columns of table %s", b.config.InsertTable())
+		}
+		return columns, nil
+	}
+	for i := range b.config.BenchColumns {
+		columns = append(columns, benchColumn{name: fmt.Sprintf("c%d", i+1), value: benchText(b.config.BenchWidth)})
+	}
+	return columns, nil
+}
+
+// benchColumn is a column of the synthetic rows, value returns its value number n
+type benchColumn struct {
+	name  string
+	value func(n int64) string
+}
+
+// benchEpoch is the first date and time of the generated values
+var benchEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// benchValue returns the generator of the values of a table column of type t, the text ones width characters long
+// at most
+func benchValue(t ColumnType, width int) (func(n int64) string, error) {
+	integer := func(most int64) func(n int64) string {
+		return func(n int64) string { return strconv.FormatInt(n%(most+1), 10) }
+	}
+	switch t.DataType {
+	case "tinyint":
+		if strings.HasPrefix(t.ColumnType, "tinyint(1)") {
+			return integer(1), nil
+		}
+		return integer(127), nil
+	case "smallint":
+		return integer(math.MaxInt16), nil
+	case "mediumint":
+		return integer(1<<23 - 1), nil
+	case "int", "integer":
+		return integer(math.MaxInt32), nil
+	case "bigint":
+		return integer(math.MaxInt64 - 1), nil
+	case "decimal", "numeric":
+		digits := int64(math.Pow10(min(t.Precision-t.Scale, 18)))
+		fraction := int64(math.Pow10(min(t.Scale, 18)))
+		return func(n int64) string {
+			if t.Scale == 0 {
+				return strconv.FormatInt(n%digits, 10)
+			}
+			return fmt.Sprintf("%d.%0*d", n%digits, t.Scale, n%fraction)
+		}, nil
+	case "float", "double", "real":
+		return func(n int64) string { return strconv.FormatInt(n, 10) + ".5" }, nil
+	case "date":
+		return func(n int64) string { return benchEpoch.AddDate(0, 0, int(n%36500)).Format(time.DateOnly) }, nil
+	case "datetime", "timestamp":
+		// TIMESTAMP ends in 2038
+		return func(n int64) string {
+			return benchEpoch.Add(time.Duration(n%(30*365*86400)) * time.Second).Format(time.DateTime)
+		}, nil
+	case "time":
+		return func(n int64) string {
+			return benchEpoch.Add(time.Duration(n%86400) * time.Second).Format(time.TimeOnly)
+		}, nil
+	case "year":
+		return func(n int64) string { return strconv.FormatInt(1901+n%255, 10) }, nil
+	case "char", "varchar", "binary", "varbinary":
+		return benchText(int(min(int64(width), t.MaxLength))), nil
+	case "tinytext", "text", "mediumtext", "longtext", "tinyblob", "blob", "mediumblob", "longblob":
+		return benchText(width), nil
+	case "json":
+		return func(n int64) string { return `{"n":` + strconv.FormatInt(n, 10) + `}` }, nil
+	case "enum":
+		// the first of the values, e.g. enum('a','b')
+		first, _, _ := strings.Cut(strings.TrimPrefix(t.ColumnType, "enum("), ",")
+		value := strings.Trim(strings.TrimSuffix(first, ")"), "'")
+		return func(int64) string { return value }, nil
+	}
+	return nil, fmt.Errorf("values of column %s of type %s can't be generated, leave it out with -skip-columns", t.Name, t.ColumnType)
+}
+
+// benchText returns the generator of text values of width characters: the number n in base 36, padded with x
+func benchText(width int) func(n int64) string {
+	return func(n int64) string {
+		s := strconv.FormatInt(n, 36)
+		if len(s) >= width {
+			return s[len(s)-width:]
+		}
+		return strings.Repeat("x", width-len(s)) + s
+	}
+}
+
+// benchReader is the CSV of rows synthetic rows, generated as it's read. The first column is numbered by the row, so
+// it can be a unique key, the others take cardinality values (every row another value if 0).
+type benchReader struct {
+	columns     []benchColumn
+	rows        int
+	row         int
+	cardinality int
+	rnd         *rand.Rand
+	buf         bytes.Buffer
+	w           *csv.Writer
+	record      []string
+}
+
+func newBenchReader(columns []benchColumn, rows int, cardinality int) *benchReader {
+	r := &benchReader{columns: columns, rows: rows, cardinality: cardinality, rnd: rand.New(rand.NewSource(benchSeed)),
+		record: make([]string, len(columns))}
+	r.w = csv.NewWriter(&r.buf)
+	for i, c := range columns {
+		r.record[i] = c.name
+	}
+	_ = r.w.Write(r.record)
+	return r
+}
+
+func (r *benchReader) Read(p []byte) (int, error) {
+	for r.buf.Len() < len(p) && r.row < r.rows {
+		for i, c := range r.columns {
+			n := int64(r.row)
+			if i > 0 && r.cardinality > 0 {
+				n = r.rnd.Int63n(int64(r.cardinality))
+			}
+			r.record[i] = c.value(n)
+		}
+		_ = r.w.Write(r.record)
+		r.row++
+		r.w.Flush()
+	}
+	r.w.Flush()
+	if r.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return r.buf.Read(p)
+}
+
+// WriteBenchMatrix writes the throughput of the results as a matrix of the workers by the batch sizes, followed by
+// the fastest combination
+func WriteBenchMatrix(w io.Writer, results []BenchResult) error {
+	var workers, sizes []int
+	rates := map[[2]int]float64{}
+	best := -1
+	for i, r := range results {
+		if !slices.Contains(workers, r.Workers) {
+			workers = append(workers, r.Workers)
+		}
+		if !slices.Contains(sizes, r.BatchSize) {
+			sizes = append(sizes, r.BatchSize)
+		}
+		rates[[2]int{r.Workers, r.BatchSize}] = r.Stats.Throughput()
+		if best < 0 || r.Stats.Throughput() > results[best].Stats.Throughput() {
+			best = i
+		}
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "rows/s by workers \\ batch size\t")
+	for _, size := range sizes {
+		fmt.Fprintf(tw, "%d\t", size)
+	}
+	fmt.Fprintln(tw)
+	for _, workers := range workers {
+		fmt.Fprintf(tw, "%d\t", workers)
+		for _, size := range sizes {
+			if rate, ok := rates[[2]int{workers, size}]; ok {
+				fmt.Fprintf(tw, "%.0f\t", rate)
+			} else {
+				fmt.Fprint(tw, "-\t")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if best >= 0 {
+		r := results[best]
+		_, err := fmt.Fprintf(w, "fastest: -workers %d -batch-size %d with %.0f rows/s\n", r.Workers, r.BatchSize, r.Stats.Throughput())
+		return err
+	}
+	return nil
+}
+
+// intListFlag is a flag of comma separated positive integers, it can be repeated
+type intListFlag struct {
+	values *[]int
+	name   string
+}
+
+func (f intListFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	values := make([]string, len(*f.values))
+	for i, v := range *f.values {
+		values[i] = strconv.Itoa(v)
+	}
+	return strings.Join(values, ",")
+}
+
+func (f intListFlag) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || v <= 0 {
+			return fmt.Errorf("invalid %s '%s', must be a positive integer", f.name, s)
+		}
+		*f.values = append(*f.values, v)
+	}
+	return nil
+}
+
+// validateBench checks the options of the synthetic rows of the bench command
+func (c *Config) validateBench() error {
+	for _, n := range []struct {
+		name  string
+		value int
+	}{{"bench-rows", c.BenchRows}, {"bench-columns", c.BenchColumns}, {"bench-width", c.BenchWidth}} {
+		if n.value <= 0 {
+			return fmt.Errorf("invalid %s %d, must be positive", n.name, n.value)
+		}
+	}
+	if c.BenchCardinality < 0 {
+		return fmt.Errorf("invalid bench-cardinality %d, must not be negative", c.BenchCardinality)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestBenchReader(t *testing.T) {
+	columns := []benchColumn{{name: "id", value: benchText(4)}, {name: "city", value: benchText(6)}}
+	b, err := io.ReadAll(newBenchReader(columns, 40, 3))
+	assert.NilError(t, err)
+	records, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 41)
+	assert.DeepEqual(t, records[0], []string{"id", "city"})
+	assert.DeepEqual(t, records[1][0], "xxx0")
+	assert.DeepEqual(t, records[40][0], "xx13")
+	cities := map[string]bool{}
+	for _, r := range records[1:] {
+		cities[r[1]] = true
+	}
+	assert.Equal(t, len(cities), 3)
+
+	// every run reads the same rows
+	again, err := io.ReadAll(newBenchReader(columns, 40, 3))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, again, b)
+}
+
+func TestBenchValue(t *testing.T) {
+	for want, c := range map[string]struct {
+		t ColumnType
+		n int64
+	}{
+		"1":                   {ColumnType{DataType: "tinyint", ColumnType: "tinyint(1)"}, 3},
+		"44":                  {ColumnType{DataType: "smallint", ColumnType: "smallint"}, 32812},
+		"7.07":                {ColumnType{DataType: "decimal", ColumnType: "decimal(4,2)", Precision: 4, Scale: 2}, 4207},
+		"2000-01-03":          {ColumnType{DataType: "date", ColumnType: "date"}, 2},
+		"2000-01-01 01:00:01": {ColumnType{DataType: "datetime", ColumnType: "datetime"}, 3601},
+		"xx1a":                {ColumnType{DataType: "varchar", ColumnType: "varchar(4)", MaxLength: 4}, 46},
+		"small":               {ColumnType{DataType: "enum", ColumnType: "enum('small','large')"}, 9},
+	} {
+		value, err := benchValue(c.t, 8)
+		assert.NilError(t, err)
+		assert.Equal(t, value(c.n), want, c.t.ColumnType)
+	}
+	_, err := benchValue(ColumnType{Name: "area", DataType: "polygon", ColumnType: "polygon"}, 8)
+	assert.Error(t, err, "values of column area of type polygon can't be generated, leave it out with -skip-columns")
+}
+
+func TestBenchRun(t *testing.T) {
+	c, err := ParseFlags([]string{"-table", "bench", "-dry-run", "-bench-rows", "50", "-bench-columns", "3",
+		"-bench-workers", "1,2", "-bench-batch-sizes", "10", "-bench-batch-sizes", "25"})
+	assert.NilError(t, err)
+	results, err := NewBench(nil, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, len(results), 4)
+	for i, want := range [][2]int{{1, 10}, {1, 25}, {2, 10}, {2, 25}} {
+		assert.Equal(t, results[i].Workers, want[0])
+		assert.Equal(t, results[i].BatchSize, want[1])
+		assert.Equal(t, results[i].Stats.RowsInserted, int64(50))
+	}
+
+	var out strings.Builder
+	assert.NilError(t, WriteBenchMatrix(&out, results))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, len(lines), 4, out.String())
+	assert.DeepEqual(t, strings.Fields(lines[0])[6:], []string{"10", "25"})
+	assert.Equal(t, strings.Fields(lines[2])[0], "2")
+	assert.Assert(t, strings.HasPrefix(lines[3], "fastest: -workers "), out.String())
+
+	c.DryRun = false
+	_, err = NewBench(nil, c).Run(context.Background())
+	assert.ErrorContains(t, err, "give -truncate to empty it before every run")
+	for want, args := range map[string][]string{
+		"invalid bench-rows 0, must be positive":                  {"-bench-rows", "0"},
+		"invalid bench-cardinality -1, must not be negative":      {"-bench-cardinality", "-1"},
+		"invalid bench-workers 'x', must be a positive integer":   {"-bench-workers", "1,x"},
+		"invalid bench-batch-sizes '0', must be a positive integ": {"-bench-batch-sizes", "0"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want)
+	}
+}
@@ -0,0 +1,93 @@
+package loader
+
+import (
+	"fmt"
+	"math"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorBudget counts the malformed CSV rows which are skipped instead of aborting the import. A nil *ErrorBudget
+// tolerates no malformed row.
+type ErrorBudget struct {
+	// max is the number of malformed rows tolerated in all inputs together
+	max int
+	// maxPct is the share of the rows read in percent which may be malformed, 0 means no limit
+	maxPct float64
+	// perFile is the number of malformed rows tolerated per input before it is abandoned, 0 means no limit
+	perFile int
+	total   int
+	// file are the malformed rows of the current input
+	file      int
+	abandoned []string
+}
+
+// errorRateMinRows are the rows read before the share of malformed rows can stop reading, so a bad row at the
+// start doesn't exceed it right away. At the end of every input the share is checked whatever was read.
+var errorRateMinRows = 1000
+
+// NewErrorBudget tolerates max malformed rows overall, maxPct percent (0 no limit) of the rows read and perFile
+// (0 no limit) per input. With a maxPct only, max 0 doesn't limit the number of malformed rows.
+func NewErrorBudget(max, perFile int, maxPct float64) *ErrorBudget {
+	if maxPct > 0 && max == 0 {
+		max = math.MaxInt
+	}
+	return &ErrorBudget{max: max, maxPct: maxPct, perFile: perFile}
+}
+
+// Skip records a malformed row, read being the rows read so far including it, and reports whether reading the
+// current input may go on
+func (b *ErrorBudget) Skip(read int) bool {
+	if b == nil {
+		return false
+	}
+	b.total++
+	b.file++
+	if read >= errorRateMinRows && b.rateExceeded(read) {
+		return false
+	}
+	return b.total <= b.max && (b.perFile == 0 || b.file <= b.perFile)
+}
+
+// rateExceeded reports whether more than maxPct of read rows are malformed
+func (b *ErrorBudget) rateExceeded(read int) bool {
+	return b.maxPct > 0 && read > 0 && float64(b.total)*100 > b.maxPct*float64(read)
+}
+
+// EndInput is called after an input is read, read being the rows read from all inputs so far. It returns an
+// error when the malformed rows of all inputs exceed the budget, an input exceeding only the per input limit is
+// logged and recorded as abandoned.
+func (b *ErrorBudget) EndInput(name string, read int) error {
+	if b == nil {
+		return nil
+	}
+	defer func() { b.file = 0 }()
+	if b.total > b.max {
+		return fmt.Errorf("too many malformed rows, giving up after %d (max-errors is %d)", b.total, b.max)
+	}
+	if b.rateExceeded(read) {
+		return fmt.Errorf("too many malformed rows, %d of %d rows (%.2f%%) are malformed (max-error-pct is %g)",
+			b.total, read, float64(b.total)*100/float64(read), b.maxPct)
+	}
+	if b.perFile > 0 && b.file > b.perFile {
+		log.Warnf("Abandoned %s after %d malformed rows", name, b.file)
+		b.abandoned = append(b.abandoned, name)
+	}
+	return nil
+}
+
+// Total returns the number of malformed rows seen
+func (b *ErrorBudget) Total() int {
+	if b == nil {
+		return 0
+	}
+	return b.total
+}
+
+// Abandoned returns the names of the inputs which were abandoned
+func (b *ErrorBudget) Abandoned() []string {
+	if b == nil {
+		return nil
+	}
+	return b.abandoned
+}
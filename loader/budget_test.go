@@ -0,0 +1,58 @@
+package loader
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestErrorBudgetNil(t *testing.T) {
+	var b *ErrorBudget
+	assert.Assert(t, !b.Skip(1))
+	assert.NilError(t, b.EndInput("a.csv", 1))
+	assert.Equal(t, b.Total(), 0)
+}
+
+func TestErrorBudgetMax(t *testing.T) {
+	b := NewErrorBudget(2, 0, 0)
+	assert.Assert(t, b.Skip(1))
+	assert.NilError(t, b.EndInput("a.csv", 10))
+	assert.Assert(t, b.Skip(11))
+	assert.Assert(t, !b.Skip(12))
+	assert.ErrorContains(t, b.EndInput("b.csv", 12), "giving up after 3 (max-errors is 2)")
+}
+
+func TestErrorBudgetPerFile(t *testing.T) {
+	b := NewErrorBudget(10, 1, 0)
+	assert.Assert(t, b.Skip(1))
+	assert.Assert(t, !b.Skip(2))
+	assert.NilError(t, b.EndInput("a.csv", 2))
+	// the per file count starts again with the next input
+	assert.Assert(t, b.Skip(3))
+	assert.NilError(t, b.EndInput("b.csv", 3))
+	assert.DeepEqual(t, b.Abandoned(), []string{"a.csv"})
+	assert.Equal(t, b.Total(), 3)
+}
+
+func TestErrorBudgetMaxPct(t *testing.T) {
+	defer func(n int) { errorRateMinRows = n }(errorRateMinRows)
+	errorRateMinRows = 100
+	b := NewErrorBudget(0, 0, 1)
+	// the share isn't checked before errorRateMinRows rows are read
+	assert.Assert(t, b.Skip(2))
+	assert.Assert(t, b.Skip(300))
+	assert.NilError(t, b.EndInput("a.csv", 300))
+	assert.Assert(t, b.Skip(301))
+	assert.Assert(t, !b.Skip(302))
+	assert.ErrorContains(t, b.EndInput("b.csv", 302), "4 of 302 rows (1.32%) are malformed (max-error-pct is 1)")
+
+	// the share is checked at the end of a short input as well
+	b = NewErrorBudget(0, 0, 1)
+	assert.Assert(t, b.Skip(5))
+	assert.ErrorContains(t, b.EndInput("short.csv", 10), "1 of 10 rows")
+
+	// both limits apply
+	b = NewErrorBudget(1, 0, 50)
+	assert.Assert(t, b.Skip(1000))
+	assert.Assert(t, !b.Skip(1001))
+}
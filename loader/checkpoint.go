@@ -0,0 +1,144 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkpointInterval is how often the checkpoint file is written at most while the import runs
+var checkpointInterval = 1 * time.Second
+
+// Checkpoint tracks the rows which are done (committed, dead-lettered or skipped as malformed) and writes the
+// highest row up to which all rows are done to a file, so an aborted import can be resumed after it. The workers
+// commit their batches in any order, rows done after a gap are kept until the gap is closed. It is safe for
+// concurrent use. A nil *Checkpoint records nothing.
+type Checkpoint struct {
+	mu       sync.Mutex
+	filename string
+	// row is the highest row up to which all rows are done
+	row int
+	// done are the rows done after row
+	done      map[int]bool
+	written   int
+	lastWrite time.Time
+	// removed is set after a successful import, the file isn't written anymore
+	removed bool
+	// advanced is called with the row whenever it moved, e.g. to commit the messages of a StreamSource
+	advanced func(row int)
+}
+
+// NewCheckpoint tracks the rows after row (the rows skipped on resume) and writes them to filename, an empty
+// filename only tracks them
+func NewCheckpoint(filename string, row int) *Checkpoint {
+	return &Checkpoint{filename: filename, row: row, written: row, done: map[int]bool{}, lastWrite: time.Now()}
+}
+
+// ReadCheckpoint returns the row of the checkpoint file filename, 0 if there is none
+func ReadCheckpoint(filename string) (int, error) {
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	row, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || row < 0 {
+		return 0, fmt.Errorf("invalid checkpoint file %s: '%s' is no row number", filename, strings.TrimSpace(string(content)))
+	}
+	return row, nil
+}
+
+// Done records rows as done, the file is written when the checkpoint moved and the last write is
+// checkpointInterval ago
+func (c *Checkpoint) Done(rows []int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range rows {
+		if r > c.row {
+			c.done[r] = true
+		}
+	}
+	row := c.row
+	for c.done[c.row+1] {
+		delete(c.done, c.row+1)
+		c.row++
+	}
+	if c.row != row && c.advanced != nil {
+		c.advanced(c.row)
+	}
+	if c.row != c.written && !c.removed && time.Since(c.lastWrite) >= checkpointInterval {
+		if err := c.write(); err != nil {
+			log.Errorf("Could not write checkpoint: %s", err.Error())
+		}
+	}
+}
+
+// Row returns the highest row up to which all rows are done
+func (c *Checkpoint) Row() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.row
+}
+
+// write replaces the checkpoint file, a crash while writing keeps the previous checkpoint
+func (c *Checkpoint) write() error {
+	if c.filename == "" {
+		c.written = c.row
+		return nil
+	}
+	tmp := c.filename + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(c.row)+"\n"), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.filename); err != nil {
+		return err
+	}
+	c.written = c.row
+	c.lastWrite = time.Now()
+	return nil
+}
+
+// Close writes the final checkpoint unless it was removed
+func (c *Checkpoint) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.removed {
+		return nil
+	}
+	return c.write()
+}
+
+// Remove deletes the checkpoint file after a successful import, so the next run starts from the beginning
+func (c *Checkpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removed = true
+	if c.filename == "" {
+		return nil
+	}
+	if err := os.Remove(c.filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gotest.tools/v3/assert"
+)
+
+func TestCheckpointDone(t *testing.T) {
+	defer func(i time.Duration) { checkpointInterval = i }(checkpointInterval)
+	checkpointInterval = 0
+	filename := filepath.Join(t.TempDir(), "import.checkpoint")
+	c := NewCheckpoint(filename, 2)
+
+	// rows after a gap wait for the gap to be closed
+	c.Done([]int{5, 6})
+	assert.Equal(t, c.Row(), 2)
+	c.Done([]int{3})
+	assert.Equal(t, c.Row(), 3)
+	c.Done([]int{1, 4})
+	assert.Equal(t, c.Row(), 6)
+	row, err := ReadCheckpoint(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, row, 6)
+
+	assert.NilError(t, c.Remove())
+	assert.NilError(t, c.Close())
+	row, err = ReadCheckpoint(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, row, 0, "a removed checkpoint isn't written again")
+}
+
+func TestReadCheckpointInvalid(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "import.checkpoint")
+	assert.NilError(t, os.WriteFile(filename, []byte("abc\n"), 0o644))
+	_, err := ReadCheckpoint(filename)
+	assert.ErrorContains(t, err, "'abc' is no row number")
+}
+
+// recordingConn records the values of every executed batch, a batch containing failValue fails
+type recordingConn struct {
+	idleConn
+	c *recordingConnector
+}
+
+func (c recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.c.mu.Lock()
+	defer c.c.mu.Unlock()
+	for _, a := range args {
+		if a.Value == c.c.failValue {
+			return nil, &mysql.MySQLError{Number: 1406, Message: "Data too long"}
+		}
+	}
+	for _, a := range args {
+		c.c.values = append(c.c.values, a.Value.(string))
+	}
+	return driver.RowsAffected(len(args)), nil
+}
+
+type recordingConnector struct {
+	mu        sync.Mutex
+	failValue string
+	values    []string
+}
+
+func (c *recordingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return recordingConn{c: c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver {
+	return nil
+}
+
+func TestImportResumesFromCheckpoint(t *testing.T) {
+	l := withConnConfig(t, 5)
+	dir := t.TempDir()
+	var input strings.Builder
+	input.WriteString("Domain\n")
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&input, "r%d\n", i)
+	}
+	filename := filepath.Join(dir, "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte(input.String()), 0o644))
+	checkpointFile := filepath.Join(dir, "import.checkpoint")
+	var err error
+	l.config, err = ParseFlags([]string{"-csv", filename, "-checkpoint-file", checkpointFile, "-workers", "1", "-batch-size", "2"})
+	assert.NilError(t, err)
+
+	// the batch of r7 and r8 fails and aborts the first run
+	connector := &recordingConnector{failValue: "r7"}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	_, err = New(db, l.config).Run(context.Background())
+	assert.ErrorContains(t, err, "Data too long")
+	row, err := ReadCheckpoint(checkpointFile)
+	assert.NilError(t, err)
+	assert.Equal(t, row, 6)
+
+	connector.failValue = ""
+	stats, err := New(db, l.config).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsInserted, int64(4))
+	assert.DeepEqual(t, connector.values, []string{"r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9", "r10"})
+	_, err = os.Stat(checkpointFile)
+	assert.Assert(t, os.IsNotExist(err), "the checkpoint is removed after a successful import")
+}
+
+func TestResumeFlag(t *testing.T) {
+	l := newTestLoader()
+	c, err := ParseFlags([]string{"-csv", "exports/domains.csv", "-resume"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.CheckpointFile, "exports/domains.csv.checkpoint")
+	c, err = ParseFlags([]string{"-resume", "-checkpoint-file", "import.checkpoint", "a.csv", "b.csv"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.CheckpointFile, "import.checkpoint")
+
+	_, err = ParseFlags([]string{"-csv", "-", "-resume"})
+	assert.ErrorContains(t, err, "-resume of stdin requires -checkpoint-file")
+	_, err = ParseFlags([]string{"-csv", "https://example.com/domains.csv", "-resume"})
+	assert.ErrorContains(t, err, "-resume of a URL requires -checkpoint-file")
+	_, err = ParseFlags([]string{"-resume", "-resume-from-line", "5"})
+	assert.ErrorContains(t, err, "-resume and -resume-from-line can't be combined")
+	_, err = ParseFlags([]string{"-resume", "-dry-run"})
+	assert.ErrorContains(t, err, "-dry-run can't be combined with -resume")
+
+	l.config = Config{Resume: true}
+	_, err = l.config.resumeSkip(filepath.Join(t.TempDir(), "missing.checkpoint"), 0)
+	assert.ErrorContains(t, err, "nothing to resume")
+}
@@ -0,0 +1,56 @@
+package loader
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// artifact is a temporary file created by a run, which is removed by -cleanup-on-success
+type artifact struct {
+	path string
+	// onlyIfEmpty keeps the file if anything was written to it (e.g. rows of a dead-letter file)
+	onlyIfEmpty bool
+}
+
+var (
+	artifactsMu sync.Mutex
+	artifacts   []artifact
+)
+
+// RegisterArtifact registers a temporary file of the run for removal after a successful import
+func RegisterArtifact(path string, onlyIfEmpty bool) {
+	artifactsMu.Lock()
+	defer artifactsMu.Unlock()
+	artifacts = append(artifacts, artifact{path: path, onlyIfEmpty: onlyIfEmpty})
+}
+
+// CleanupArtifacts removes all registered temporary files, it must only be called after a successful run.
+// Returns the paths of the files removed.
+func CleanupArtifacts() []string {
+	artifactsMu.Lock()
+	defer artifactsMu.Unlock()
+	removed := make([]string, 0, len(artifacts))
+	for _, a := range artifacts {
+		if a.onlyIfEmpty {
+			info, err := os.Stat(a.path)
+			if err != nil || info.Size() > 0 {
+				continue
+			}
+		}
+		err := os.Remove(a.path)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				log.Warnf("Could not remove %s: %s", a.path, err.Error())
+			}
+			continue
+		}
+		log.Printf("Removed %s", a.path)
+		removed = append(removed, a.path)
+	}
+	artifacts = nil
+	return removed
+}
@@ -0,0 +1,29 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCleanupArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	checkpoint := filepath.Join(dir, "import.checkpoint")
+	emptyDeadLetter := filepath.Join(dir, "empty.dlq.csv")
+	deadLetter := filepath.Join(dir, "failed.dlq.csv")
+	assert.NilError(t, os.WriteFile(checkpoint, []byte("42"), 0o644))
+	assert.NilError(t, os.WriteFile(emptyDeadLetter, nil, 0o644))
+	assert.NilError(t, os.WriteFile(deadLetter, []byte("a,1\n"), 0o644))
+
+	RegisterArtifact(checkpoint, false)
+	RegisterArtifact(emptyDeadLetter, true)
+	RegisterArtifact(deadLetter, true)
+	RegisterArtifact(filepath.Join(dir, "missing"), false)
+
+	assert.DeepEqual(t, CleanupArtifacts(), []string{checkpoint, emptyDeadLetter})
+	_, err := os.Stat(deadLetter)
+	assert.NilError(t, err, "a dead-letter file with rows has to be kept")
+	assert.Equal(t, len(CleanupArtifacts()), 0, "artifacts are only removed once")
+}
@@ -0,0 +1,301 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// what -coerce does with a string longer than its column
+const (
+	// CoerceOverflowError fails the row, like a failing -transform
+	CoerceOverflowError = "error"
+	// CoerceOverflowTruncate cuts the string to the length of the column
+	CoerceOverflowTruncate = "truncate"
+)
+
+var coerceOverflowModes = []string{CoerceOverflowError, CoerceOverflowTruncate}
+
+// ColumnType is the type of a table column from the information schema
+type ColumnType struct {
+	Name string
+	// DataType is the type without its arguments, e.g. varchar
+	DataType string
+	// ColumnType is the full type, e.g. int unsigned or varchar(255)
+	ColumnType string
+	// MaxLength is the length of a string column in characters, OctetLength in bytes
+	MaxLength   int64
+	OctetLength int64
+	// Precision and Scale are the digits of a DECIMAL column
+	Precision int
+	Scale     int
+}
+
+// TableColumnTypes returns the types of the columns of table in their order
+func TableColumnTypes(ctx context.Context, db *sql.DB, table string) ([]ColumnType, error) {
+	rows, err := db.QueryContext(ctx, "SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, CHARACTER_MAXIMUM_LENGTH, CHARACTER_OCTET_LENGTH, "+
+		"NUMERIC_PRECISION, NUMERIC_SCALE FROM information_schema.COLUMNS "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var types []ColumnType
+	for rows.Next() {
+		var t ColumnType
+		var maxLength, octetLength, precision, scale sql.NullInt64
+		if err = rows.Scan(&t.Name, &t.DataType, &t.ColumnType, &maxLength, &octetLength, &precision, &scale); err != nil {
+			return nil, err
+		}
+		t.DataType, t.ColumnType = strings.ToLower(t.DataType), strings.ToLower(t.ColumnType)
+		t.MaxLength, t.OctetLength = maxLength.Int64, octetLength.Int64
+		t.Precision, t.Scale = int(precision.Int64), int(scale.Int64)
+		types = append(types, t)
+	}
+	return types, rows.Err()
+}
+
+// columnCoercion converts the CSV values of the column index to the type of the table column they are inserted into
+type columnCoercion struct {
+	index  int
+	column string
+	fn     func(value string) (string, error)
+}
+
+// resolveCoercions picks the coercion of every inserted CSV column by the type of its table column, the columns
+// of a type without one (or missing from types) are inserted as they are. Without -coerce only the size of the
+// values of the binary decoders is checked.
+func (c *Config) resolveCoercions(headers []string, types []ColumnType) {
+	c.coercions = nil
+	for i, column := range c.InsertColumns(headers) {
+		index := i
+		if len(c.mapIndexes) > 0 {
+			if i >= len(c.mapIndexes) {
+				// the -constant columns
+				break
+			}
+			index = c.mapIndexes[i]
+		} else if i >= len(headers) {
+			break
+		}
+		decoder := c.binaryDecoder(index)
+		j := slices.IndexFunc(types, func(t ColumnType) bool { return strings.EqualFold(t.Name, column) })
+		if j < 0 || !c.Coerce && decoder == nil {
+			continue
+		}
+		fn := c.coercion(types[j])
+		if decoder != nil {
+			// the value is bound as the bytes it decodes to, so their size counts
+			fn = decodedLengthCoercion(types[j].OctetLength, decoder)
+		}
+		if fn != nil {
+			c.coercions = append(c.coercions, columnCoercion{index: index, column: column, fn: fn})
+		}
+	}
+}
+
+// intRanges are the smallest and largest values of the signed integer types, the unsigned ones go from 0 to twice
+// the largest plus one
+var intRanges = map[string][2]int64{
+	"tinyint":   {-1 << 7, 1<<7 - 1},
+	"smallint":  {-1 << 15, 1<<15 - 1},
+	"mediumint": {-1 << 23, 1<<23 - 1},
+	"int":       {-1 << 31, 1<<31 - 1},
+	"bigint":    {-1 << 63, 1<<63 - 1},
+}
+
+// coercion returns the conversion of the values of a column of type t, nil for a type which takes the text
+func (c *Config) coercion(t ColumnType) func(string) (string, error) {
+	switch t.DataType {
+	case "tinyint", "smallint", "mediumint", "int", "bigint":
+		return intCoercion(t)
+	case "decimal":
+		return decimalCoercion(t)
+	case "float", "double":
+		return func(v string) (string, error) {
+			v = strings.TrimSpace(v)
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return "", fmt.Errorf("'%s' is no number", v)
+			}
+			return v, nil
+		}
+	case "date":
+		return timeCoercion(time.DateOnly)
+	case "datetime", "timestamp":
+		return timeCoercion("2006-01-02 15:04:05.999999")
+	case "char", "varchar":
+		return c.lengthCoercion(t.Name, t.MaxLength, false)
+	case "tinytext", "text", "mediumtext", "longtext", "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return c.lengthCoercion(t.Name, t.OctetLength, true)
+	}
+	return nil
+}
+
+// intCoercion accepts the integers in the range of the type of t, a tinyint takes yes/no, true/false and on/off
+// as 1 and 0 as well
+func intCoercion(t ColumnType) func(string) (string, error) {
+	unsigned := strings.Contains(t.ColumnType, "unsigned")
+	bounds := intRanges[t.DataType]
+	return func(v string) (string, error) {
+		v = strings.TrimSpace(v)
+		if t.DataType == "tinyint" {
+			switch strings.ToLower(v) {
+			case "true", "yes", "y", "on":
+				return "1", nil
+			case "false", "no", "n", "off":
+				return "0", nil
+			}
+		}
+		if unsigned {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil || t.DataType != "bigint" && n > uint64(bounds[1])*2+1 {
+				return "", fmt.Errorf("'%s' is no %s", v, t.ColumnType)
+			}
+			return strconv.FormatUint(n, 10), nil
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < bounds[0] || n > bounds[1] {
+			return "", fmt.Errorf("'%s' is no %s", v, t.ColumnType)
+		}
+		return strconv.FormatInt(n, 10), nil
+	}
+}
+
+// decimalCoercion rounds the numbers to the scale of t (halves away from zero, like MySQL) and rejects the ones with
+// more digits before the point than the precision leaves
+func decimalCoercion(t ColumnType) func(string) (string, error) {
+	return func(v string) (string, error) {
+		v = strings.TrimSpace(v)
+		r, ok := new(big.Rat).SetString(v)
+		if !ok || strings.ContainsAny(v, "/") {
+			return "", fmt.Errorf("'%s' is no number", v)
+		}
+		s := r.FloatString(t.Scale)
+		digits, _, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+		if len(strings.TrimLeft(digits, "0")) > t.Precision-t.Scale {
+			return "", fmt.Errorf("'%s' doesn't fit into %s", v, t.ColumnType)
+		}
+		return s, nil
+	}
+}
+
+// coerceTimeLayouts are the layouts of the dates and times -coerce reads, the ones without a time are at midnight
+var coerceTimeLayouts = []string{time.DateTime, "2006-01-02T15:04:05", time.RFC3339Nano, "2006-01-02 15:04:05Z07:00", time.DateOnly,
+	"2006/01/02 15:04:05", "2006/01/02", "20060102"}
+
+// timeCoercion normalizes the dates and times to layout
+func timeCoercion(layout string) func(string) (string, error) {
+	return func(v string) (string, error) {
+		v = strings.TrimSpace(v)
+		for _, l := range coerceTimeLayouts {
+			if t, err := time.Parse(l, v); err == nil {
+				return t.Format(layout), nil
+			}
+		}
+		return "", fmt.Errorf("'%s' is no date", v)
+	}
+}
+
+// lengthCoercion applies the -coerce-overflow policy to the strings longer than length (in bytes when octets is
+// set, in characters otherwise)
+func (c *Config) lengthCoercion(column string, length int64, octets bool) func(string) (string, error) {
+	if length <= 0 {
+		return nil
+	}
+	truncate := c.CoerceOverflow == CoerceOverflowTruncate
+	warned := false
+	return func(v string) (string, error) {
+		n, unit := int64(utf8.RuneCountInString(v)), "characters"
+		if octets {
+			n, unit = int64(len(v)), "bytes"
+		}
+		if n <= length {
+			return v, nil
+		}
+		if !truncate {
+			return "", fmt.Errorf("%d %s don't fit into %d", n, unit, length)
+		}
+		if !warned {
+			warned = true
+			log.Warnf("Truncating the values of column %s longer than %d", column, length)
+		}
+		if octets {
+			return truncateBytes(v, int(length)), nil
+		}
+		return string([]rune(v)[:length]), nil
+	}
+}
+
+// decodedLengthCoercion fails the values decoding to more than length bytes, they aren't truncated
+func decodedLengthCoercion(length int64, decode Transformer) func(string) (string, error) {
+	if length <= 0 {
+		return nil
+	}
+	return func(v string) (string, error) {
+		decoded, err := decode(v)
+		if err != nil {
+			return "", err
+		}
+		if b, ok := decoded.([]byte); ok && int64(len(b)) > length {
+			return "", fmt.Errorf("%d decoded bytes don't fit into %d", len(b), length)
+		}
+		return v, nil
+	}
+}
+
+// checksDecodedSizes reports whether the size of the values of the binary decoders is checked without -coerce,
+// against the columns of the information schema
+func (c *Config) checksDecodedSizes() bool {
+	return !c.DryRun && c.isMySQL() && slices.ContainsFunc(c.transforms, func(t columnTransform) bool { return t.binary })
+}
+
+// truncateBytes cuts v to at most n bytes without splitting a character
+func truncateBytes(v string, n int) string {
+	for n > 0 && !utf8.RuneStart(v[n]) {
+		n--
+	}
+	return v[:n]
+}
+
+// applyCoercions converts the values of row by the types of their table columns, NULLs are left alone
+func (c *Config) applyCoercions(row []string) error {
+	for _, co := range c.coercions {
+		if co.index >= len(row) || c.headerNull(co.index, row[co.index]) {
+			continue
+		}
+		v, err := co.fn(row[co.index])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", co.column, err)
+		}
+		row[co.index] = v
+	}
+	return nil
+}
+
+// validateCoerce checks the -coerce options
+func (c *Config) validateCoerce() error {
+	if !slices.Contains(coerceOverflowModes, c.CoerceOverflow) {
+		return fmt.Errorf("invalid coerce-overflow '%s', allowed are: %s", c.CoerceOverflow, strings.Join(coerceOverflowModes, ", "))
+	}
+	if !c.Coerce {
+		return nil
+	}
+	if !c.isMySQL() {
+		return fmt.Errorf("-coerce requires the mysql dialect, it reads the information schema")
+	}
+	if c.DryRun {
+		return fmt.Errorf("-coerce can't be combined with -dry-run, it reads the table")
+	}
+	if len(c.Routes) > 0 {
+		return fmt.Errorf("-coerce can't be combined with -route")
+	}
+	return nil
+}
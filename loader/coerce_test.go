@@ -0,0 +1,134 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestCoercion(t *testing.T) {
+	l := withConnConfig(t, 5)
+	for _, tc := range []struct {
+		t     ColumnType
+		value string
+		want  string
+		err   string
+	}{
+		{ColumnType{DataType: "int", ColumnType: "int"}, " 42 ", "42", ""},
+		{ColumnType{DataType: "int", ColumnType: "int"}, "1.5", "", "'1.5' is no int"},
+		{ColumnType{DataType: "tinyint", ColumnType: "tinyint"}, "300", "", "'300' is no tinyint"},
+		{ColumnType{DataType: "tinyint", ColumnType: "tinyint(1)"}, "Yes", "1", ""},
+		{ColumnType{DataType: "tinyint", ColumnType: "tinyint(1)"}, "false", "0", ""},
+		{ColumnType{DataType: "smallint", ColumnType: "smallint unsigned"}, "65535", "65535", ""},
+		{ColumnType{DataType: "smallint", ColumnType: "smallint unsigned"}, "-1", "", "'-1' is no smallint unsigned"},
+		{ColumnType{DataType: "decimal", ColumnType: "decimal(5,2)", Precision: 5, Scale: 2}, "12.345", "12.35", ""},
+		{ColumnType{DataType: "decimal", ColumnType: "decimal(5,2)", Precision: 5, Scale: 2}, "-1e2", "-100.00", ""},
+		{ColumnType{DataType: "decimal", ColumnType: "decimal(5,2)", Precision: 5, Scale: 2}, "1234.5", "", "'1234.5' doesn't fit into decimal(5,2)"},
+		{ColumnType{DataType: "decimal", ColumnType: "decimal(5,2)", Precision: 5, Scale: 2}, "1/2", "", "'1/2' is no number"},
+		{ColumnType{DataType: "double", ColumnType: "double"}, "x", "", "'x' is no number"},
+		{ColumnType{DataType: "date", ColumnType: "date"}, "2024/03/01", "2024-03-01", ""},
+		{ColumnType{DataType: "datetime", ColumnType: "datetime"}, "2024-03-01T10:20:30Z", "2024-03-01 10:20:30", ""},
+		{ColumnType{DataType: "datetime", ColumnType: "datetime"}, "20240301", "2024-03-01 00:00:00", ""},
+		{ColumnType{DataType: "datetime", ColumnType: "datetime"}, "yesterday", "", "'yesterday' is no date"},
+		{ColumnType{DataType: "varchar", ColumnType: "varchar(3)", MaxLength: 3}, "äöü", "äöü", ""},
+		{ColumnType{DataType: "varchar", ColumnType: "varchar(3)", MaxLength: 3}, "abcd", "", "4 characters don't fit into 3"},
+	} {
+		v, err := l.config.coercion(tc.t)(tc.value)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err)
+			continue
+		}
+		assert.NilError(t, err)
+		assert.Equal(t, v, tc.want, tc.value)
+	}
+	assert.Assert(t, l.config.coercion(ColumnType{DataType: "json"}) == nil)
+
+	l.config.CoerceOverflow = CoerceOverflowTruncate
+	v, err := l.config.coercion(ColumnType{Name: "name", DataType: "varchar", MaxLength: 3})("abcd")
+	assert.NilError(t, err)
+	assert.Equal(t, v, "abc")
+	// 'ä' takes two bytes, which aren't split
+	v, err = l.config.coercion(ColumnType{Name: "name", DataType: "text", OctetLength: 3})("aää")
+	assert.NilError(t, err)
+	assert.Equal(t, v, "aä")
+}
+
+func TestImportCoerce(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain,Active,Seen\n1,google.com,yes,2024/03/01\nx,bad.com,no,\n"+
+		"2,youtube.com,no,\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-workers", "1", "-coerce", "-empty-as-null", "-max-errors", "1"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION").
+		WithArgs("domain").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("GlobalRank").AddRow("Domain").AddRow("Active").AddRow("Seen"))
+	mock.ExpectQuery(strings.Join([]string{"SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, CHARACTER_MAXIMUM_LENGTH, CHARACTER_OCTET_LENGTH,",
+		"NUMERIC_PRECISION, NUMERIC_SCALE FROM information_schema.COLUMNS",
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION"}, " ")).
+		WithArgs("domain").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE", "CHARACTER_MAXIMUM_LENGTH",
+		"CHARACTER_OCTET_LENGTH", "NUMERIC_PRECISION", "NUMERIC_SCALE"}).
+		AddRow("GlobalRank", "INT", "int", nil, nil, 10, 0).
+		AddRow("Domain", "VARCHAR", "varchar(255)", 255, 1020, nil, nil).
+		AddRow("Active", "TINYINT", "tinyint(1)", nil, nil, 3, 0).
+		AddRow("Seen", "DATE", "date", nil, nil, nil, nil))
+	mock.ExpectExec("INSERT INTO `domain` (`GlobalRank`,`Domain`,`Active`,`Seen`) VALUES (?,?,?,?), (?,?,?,?)").
+		WithArgs("1", "google.com", "1", "2024-03-01", "2", "youtube.com", "0", nil).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	assert.Equal(t, stats.RowsFailed, int64(1))
+}
+
+func TestImportBinaryDecoded(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "files.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("name,payload\na.bin,AAEC/w==\nb.bin,AAECAwQF\nc.bin,*\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-table", "files", "-workers", "1", "-transform", "payload=base64", "-max-errors", "2"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION").
+		WithArgs("files").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("name").AddRow("payload"))
+	// without -coerce only the decoded column is checked
+	mock.ExpectQuery(strings.Join([]string{"SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, CHARACTER_MAXIMUM_LENGTH, CHARACTER_OCTET_LENGTH,",
+		"NUMERIC_PRECISION, NUMERIC_SCALE FROM information_schema.COLUMNS",
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION"}, " ")).
+		WithArgs("files").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE", "CHARACTER_MAXIMUM_LENGTH",
+		"CHARACTER_OCTET_LENGTH", "NUMERIC_PRECISION", "NUMERIC_SCALE"}).
+		AddRow("name", "VARCHAR", "varchar(2)", 2, 8, nil, nil).
+		AddRow("payload", "VARBINARY", "varbinary(4)", 4, 4, nil, nil))
+	// the bytes are bound, not the base64 text
+	mock.ExpectExec("INSERT INTO `files` (`name`,`payload`) VALUES (?,?)").
+		WithArgs("a.bin", []byte{0, 1, 2, 255}).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.RowsInserted, int64(1))
+	// 6 bytes don't fit into the varbinary(4), * is no base64
+	assert.Equal(t, stats.RowsFailed, int64(2))
+
+	v, err := decodedLengthCoercion(4, base64Value)("AAECAwQF")
+	assert.ErrorContains(t, err, "6 decoded bytes don't fit into 4")
+	assert.Equal(t, v, "")
+}
+
+func TestCoerceFlags(t *testing.T) {
+	for want, args := range map[string][]string{
+		"invalid coerce-overflow 'cut', allowed are: error, truncate": {"-coerce-overflow", "cut"},
+		"-coerce requires the mysql dialect":                          {"-coerce", "-dialect", "postgres"},
+		"-coerce can't be combined with -dry-run":                     {"-coerce", "-dry-run"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want, args)
+	}
+}
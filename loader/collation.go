@@ -0,0 +1,60 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// keyColumnCollationsQuery returns the collations of all text columns of a table which are part of
+// a primary or unique key, these decide whether an insert is a duplicate
+const keyColumnCollationsQuery = `SELECT DISTINCT c.COLUMN_NAME, c.COLLATION_NAME
+FROM information_schema.COLUMNS c
+JOIN information_schema.STATISTICS s
+  ON s.TABLE_SCHEMA = c.TABLE_SCHEMA AND s.TABLE_NAME = c.TABLE_NAME AND s.COLUMN_NAME = c.COLUMN_NAME
+WHERE c.TABLE_SCHEMA = DATABASE() AND c.TABLE_NAME = ? AND s.NON_UNIQUE = 0 AND c.COLLATION_NAME IS NOT NULL
+ORDER BY c.COLUMN_NAME`
+
+// CheckCollation logs the charset and collation of the connection and returns a warning for every key column
+// of table whose collation differs, as values then get compared in a different way than the import expects
+// (e.g. 'a' and 'A' being duplicates or not)
+func CheckCollation(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	var charset, collation string
+	err := db.QueryRowContext(ctx, "SELECT @@character_set_connection, @@collation_connection").Scan(&charset, &collation)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Connection uses charset %s with collation %s", charset, collation)
+
+	rows, err := db.QueryContext(ctx, keyColumnCollationsQuery, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	warnings := make([]string, 0)
+	for rows.Next() {
+		var column, columnCollation string
+		if err = rows.Scan(&column, &columnCollation); err != nil {
+			return nil, err
+		}
+		if columnCollation != collation {
+			warnings = append(warnings, fmt.Sprintf("key column %s of table %s uses collation %s, but the connection uses %s",
+				column, table, columnCollation, collation))
+		}
+	}
+	return warnings, rows.Err()
+}
+
+// logCollationWarnings runs CheckCollation, problems running the check itself are only logged as well
+func logCollationWarnings(ctx context.Context, db *sql.DB, table string) {
+	warnings, err := CheckCollation(ctx, db, table)
+	if err != nil {
+		log.Warnf("Could not check the collation of table %s: %s", table, err.Error())
+		return
+	}
+	for _, w := range warnings {
+		log.Warn(w)
+	}
+}
@@ -0,0 +1,29 @@
+package loader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestCheckCollation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NilError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT @@character_set_connection, @@collation_connection").
+		WillReturnRows(sqlmock.NewRows([]string{"charset", "collation"}).AddRow("utf8mb4", "utf8mb4_general_ci"))
+	mock.ExpectQuery("SELECT DISTINCT c.COLUMN_NAME, c.COLLATION_NAME").WithArgs("domain").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLLATION_NAME"}).
+			AddRow("Domain", "utf8mb4_bin").
+			AddRow("TLD", "utf8mb4_general_ci"))
+
+	warnings, err := CheckCollation(context.Background(), db, "domain")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, warnings, []string{
+		"key column Domain of table domain uses collation utf8mb4_bin, but the connection uses utf8mb4_general_ci",
+	})
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,172 @@
+package loader
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ColumnMapping inserts the CSV column Header into the table column Column. EmptyAsNull and NullValues override
+// -empty-as-null and -null-values for the column, Validate are the rules its values have to meet, they are only
+// set by a -map-file.
+type ColumnMapping struct {
+	Header      string       `json:"header"`
+	Column      string       `json:"column"`
+	EmptyAsNull *bool        `json:"empty_as_null,omitempty"`
+	NullValues  []string     `json:"null_values,omitempty"`
+	Validate    *ColumnRules `json:"validate,omitempty"`
+}
+
+// ColumnMapFile is the content of a -map-file: the mapped columns like -map, the CSV columns which are not
+// inserted like -skip-columns, the constant columns like -constant and the generated ones like -generate
+type ColumnMapFile struct {
+	Columns   []ColumnMapping   `json:"columns"`
+	Skip      []string          `json:"skip"`
+	Constants map[string]string `json:"constants"`
+	Generated map[string]string `json:"generated"`
+}
+
+// loadColumnMapFile adds the mapping of the JSON file filename to c
+func (c *Config) loadColumnMapFile(filename string) error {
+	data, err := os.ReadFile(expandHome(filename))
+	if err != nil {
+		return err
+	}
+	var f ColumnMapFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("invalid column map file %s: %w", filename, err)
+	}
+	for _, m := range f.Columns {
+		if m.Header == "" {
+			return fmt.Errorf("invalid column map file %s: a column without header", filename)
+		}
+		m.Column = cmp.Or(m.Column, m.Header)
+		c.ColumnMap = append(c.ColumnMap, m)
+	}
+	c.SkipColumns = append(c.SkipColumns, f.Skip...)
+	for column, value := range f.Constants {
+		if c.Constants == nil {
+			c.Constants = map[string]string{}
+		}
+		c.Constants[column] = value
+	}
+	for column, template := range f.Generated {
+		if c.Generated == nil {
+			c.Generated = map[string]string{}
+		}
+		c.Generated[column] = template
+	}
+	return nil
+}
+
+// parseColumnMap parses a -map value: comma separated csvHeader=tableColumn pairs, a header without = is inserted
+// into the column of the same name
+func parseColumnMap(value string) ([]ColumnMapping, error) {
+	var mappings []ColumnMapping
+	for _, pair := range strings.Split(value, ",") {
+		header, column, found := strings.Cut(pair, "=")
+		header, column = strings.TrimSpace(header), strings.TrimSpace(column)
+		if !found {
+			column = header
+		}
+		if header == "" || column == "" {
+			return nil, fmt.Errorf("invalid column mapping '%s', expected csvHeader=tableColumn", pair)
+		}
+		mappings = append(mappings, ColumnMapping{Header: header, Column: column})
+	}
+	return mappings, nil
+}
+
+// InsertColumns returns the table columns the rows are inserted into: the mapped columns (all headers without -map)
+// followed by the -constant columns
+func (c *Config) InsertColumns(headers []string) []string {
+	columns := headers
+	if len(c.ColumnMap) > 0 {
+		columns = make([]string, len(c.ColumnMap))
+		for i, m := range c.ColumnMap {
+			columns[i] = m.Column
+		}
+	}
+	if len(c.Constants) == 0 && len(c.Generated) == 0 && !c.Lineage {
+		return columns
+	}
+	return append(append(slices.Clip(columns), c.generatedColumns()...), c.constantColumns()...)
+}
+
+// constantColumns returns the -constant columns in name order
+func (c *Config) constantColumns() []string {
+	columns := make([]string, 0, len(c.Constants))
+	for column := range c.Constants {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// resolveSkipColumns removes the -skip-columns from the mapping, without -map the mapping becomes all other headers
+func (c *Config) resolveSkipColumns(headers []string) error {
+	for _, column := range c.SkipColumns {
+		if _, err := columnIndex(headers, column); err != nil {
+			return err
+		}
+	}
+	mapping := c.ColumnMap
+	if len(mapping) == 0 {
+		for _, h := range headers {
+			mapping = append(mapping, ColumnMapping{Header: h, Column: h})
+		}
+	}
+	c.ColumnMap = nil
+	for _, m := range mapping {
+		if !slices.Contains(c.SkipColumns, m.Header) {
+			c.ColumnMap = append(c.ColumnMap, m)
+		}
+	}
+	if len(c.ColumnMap) == 0 && len(c.Constants) == 0 && len(c.Generated) == 0 && !c.Lineage {
+		return fmt.Errorf("-skip-columns skips all columns")
+	}
+	return nil
+}
+
+// sourceColumn returns the CSV column inserted into the table column column
+func (c *Config) sourceColumn(column string) string {
+	for _, m := range c.ColumnMap {
+		if m.Column == column {
+			return m.Header
+		}
+	}
+	return column
+}
+
+// selectColumns picks the mapped fields in table column order out of the values of a batch of rows rows, followed
+// by the -generate values appended to the rows, and adds the -constant values to every row. Without -map and
+// -constant the values are returned as they are.
+func (c *Config) selectColumns(values []string, rows int) []string {
+	if len(c.mapIndexes) == 0 && len(c.constantValues) == 0 || rows == 0 {
+		return values
+	}
+	fields := len(values) / rows
+	width := len(c.mapIndexes) + len(c.generated)
+	if len(c.mapIndexes) == 0 {
+		width = fields
+	}
+	selected := make([]string, 0, rows*(width+len(c.constantValues)))
+	for r := 0; r < rows; r++ {
+		row := values[r*fields : (r+1)*fields]
+		if len(c.mapIndexes) == 0 {
+			selected = append(selected, row...)
+		}
+		for _, i := range c.mapIndexes {
+			selected = append(selected, row[i])
+		}
+		if len(c.mapIndexes) > 0 {
+			selected = append(selected, row[fields-len(c.generated):]...)
+		}
+		selected = append(selected, c.constantValues...)
+	}
+	return selected
+}
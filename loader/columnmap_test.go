@@ -0,0 +1,109 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseColumnMap(t *testing.T) {
+	mappings, err := parseColumnMap("Domain=name, GlobalRank=rank,TLD")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, mappings, []ColumnMapping{{Header: "Domain", Column: "name"}, {Header: "GlobalRank", Column: "rank"}, {Header: "TLD", Column: "TLD"}})
+
+	for _, invalid := range []string{"", "Domain=", "=name", "Domain,,TLD"} {
+		_, err = parseColumnMap(invalid)
+		assert.ErrorContains(t, err, "invalid column mapping")
+	}
+	_, err = ParseFlags([]string{"-map", "Domain=name,TLD=name"})
+	assert.ErrorContains(t, err, "-map inserts two CSV columns into column name")
+}
+
+func TestWorkerColumnMap(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-map", "Domain=name,GlobalRank=rank", "-value-expr", "name=LOWER(?)"})
+	assert.NilError(t, err)
+	headers := []string{"GlobalRank", "TldRank", "Domain", "TLD"}
+	assert.NilError(t, l.config.ResolveColumns(headers))
+	assert.DeepEqual(t, l.config.InsertColumns(headers), []string{"name", "rank"})
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	// the subset of the columns is bound in the order of the mapping
+	mock.ExpectExec("INSERT INTO `domain` (`name`,`rank`) VALUES (LOWER(?),?), (LOWER(?),?)").
+		WithArgs("Google.com", "1", "youtube.com", "2").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	jobs := make(chan Job, 10)
+	jobs <- Job{Row: 1, Values: []string{"1", "1", "Google.com", "com"}}
+	jobs <- Job{Row: 2, Values: []string{"2", "2", "youtube.com", "com"}}
+	close(jobs)
+	assert.NilError(t, l.worker(context.Background(), 0, db, jobs, l.newBatchQueries("domain", l.config.InsertColumns(headers)), nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestResolveColumnMap(t *testing.T) {
+	c, err := ParseFlags([]string{"-map", "Domain=name,Missing=other"})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.ResolveColumns([]string{"GlobalRank", "Domain"}), "unknown column 'Missing'")
+
+	// the expressions name table columns
+	c, err = ParseFlags([]string{"-map", "Domain=name", "-value-expr", "Domain=LOWER(?)"})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.ResolveColumns([]string{"GlobalRank", "Domain"}), "unknown column 'Domain', available columns are: name")
+}
+
+func TestWorkerConstantsAndSkipColumns(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-skip-columns", "TldRank,TLD", "-constant", "source=majestic", "-constant", "batch=7"})
+	assert.NilError(t, err)
+	headers := []string{"GlobalRank", "TldRank", "Domain", "TLD"}
+	assert.NilError(t, l.config.ResolveColumns(headers))
+	// the constants follow the CSV columns in name order
+	assert.DeepEqual(t, l.config.InsertColumns(headers), []string{"GlobalRank", "Domain", "batch", "source"})
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec("INSERT INTO `domain` (`GlobalRank`,`Domain`,`batch`,`source`) VALUES (?,?,?,?), (?,?,?,?)").
+		WithArgs("1", "google.com", "7", "majestic", "2", "youtube.com", "7", "majestic").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	jobs := make(chan Job, 10)
+	jobs <- Job{Row: 1, Values: []string{"1", "1", "google.com", "com"}}
+	jobs <- Job{Row: 2, Values: []string{"2", "2", "youtube.com", "com"}}
+	close(jobs)
+	assert.NilError(t, l.worker(context.Background(), 0, db, jobs, l.newBatchQueries("domain", l.config.InsertColumns(headers)), nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestColumnMapFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mapping.json")
+	assert.NilError(t, os.WriteFile(filename, []byte(`{
+		"columns": [{"header": "Domain", "column": "name"}, {"header": "GlobalRank", "column": "rank"}, {"header": "TLD"}],
+		"skip": ["TLD"],
+		"constants": {"source": "majestic"}
+	}`), 0o644))
+	c, err := ParseFlags([]string{"-map-file", filename})
+	assert.NilError(t, err)
+	headers := []string{"GlobalRank", "Domain", "TLD"}
+	assert.NilError(t, c.ResolveColumns(headers))
+	assert.DeepEqual(t, c.InsertColumns(headers), []string{"name", "rank", "source"})
+	assert.DeepEqual(t, c.mapIndexes, []int{1, 0})
+
+	assert.NilError(t, os.WriteFile(filename, []byte(`{"columns": [{"column": "name"}]}`), 0o644))
+	_, err = ParseFlags([]string{"-map-file", filename})
+	assert.ErrorContains(t, err, "a column without header")
+
+	c, err = ParseFlags([]string{"-constant", "Domain=x"})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.ResolveColumns(headers), "column Domain gets a -constant and a CSV column")
+	c, err = ParseFlags([]string{"-skip-columns", "GlobalRank,Domain,TLD"})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.ResolveColumns(headers), "-skip-columns skips all columns")
+}
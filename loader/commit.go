@@ -0,0 +1,153 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// chunk is the open transaction of a worker with -commit-every: the batches of the worker are executed in it until
+// they have CommitEvery rows, then it is committed. The batches are only counted (inserted, checkpoint) once they
+// are committed. When a statement fails the transaction is rolled back and the batches executed in it so far are
+// executed again in the next one, so retrying the failed batch retries the whole chunk.
+type chunk struct {
+	l     *Loader
+	limit int
+	tx    *sql.Tx
+	// batches are the batches of the chunk which succeeded, rolled back ones are executed again on the next exec
+	batches []chunkBatch
+	rows    int
+}
+
+// chunkBatch is a batch executed in a chunk
+type chunkBatch struct {
+	query  string
+	args   []any
+	values []string
+	rows   []int
+}
+
+// exec executes a batch in the transaction of the chunk, starting one (with the batches of a rolled back one) if
+// needed, and commits the transaction when the chunk is full
+func (c *chunk) exec(ctx context.Context, conn *sql.Conn, query string, args []any, values []string, rows []int) error {
+	if c.tx == nil {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		c.tx = tx
+		for _, b := range c.batches {
+			if err = c.execStatement(ctx, b.query, b.args); err != nil {
+				c.rollback()
+				return err
+			}
+		}
+	}
+	if err := c.execStatement(ctx, query, args); err != nil {
+		c.rollback()
+		return err
+	}
+	c.batches = append(c.batches, chunkBatch{query: query, args: args, values: values, rows: rows})
+	c.rows += len(rows)
+	if c.rows < c.limit {
+		return nil
+	}
+	if err := c.commit(); err != nil {
+		// the batch is executed again by the retry
+		c.batches = c.batches[:len(c.batches)-1]
+		c.rows -= len(rows)
+		return err
+	}
+	return nil
+}
+
+// execStatement executes a statement in the transaction of the chunk, bounded by -batch-timeout
+func (c *chunk) execStatement(ctx context.Context, query string, args []any) error {
+	stmtCtx, cancel := c.l.config.batchContext(ctx)
+	defer cancel()
+	_, err := c.tx.ExecContext(stmtCtx, query, args...)
+	return c.l.config.batchTimedOut(stmtCtx, ctx, err)
+}
+
+// commit commits the transaction and counts its batches
+func (c *chunk) commit() error {
+	if c == nil || c.tx == nil {
+		return nil
+	}
+	err := c.tx.Commit()
+	c.tx = nil
+	if err != nil {
+		return err
+	}
+	for _, b := range c.batches {
+		c.l.batchCommitted(b.values, b.rows)
+	}
+	c.batches, c.rows = nil, 0
+	return nil
+}
+
+// rollback rolls the transaction back, its batches are kept to be executed again
+func (c *chunk) rollback() {
+	if err := c.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		log.Warnf("Rollback failed: %s", err.Error())
+	}
+	c.tx = nil
+}
+
+// discard rolls back the open transaction and returns the batches of the chunk, which are not imported
+func (c *chunk) discard() []chunkBatch {
+	if c == nil {
+		return nil
+	}
+	if c.tx != nil {
+		c.rollback()
+	}
+	batches := c.batches
+	c.batches, c.rows = nil, 0
+	return batches
+}
+
+// withChunk returns the values and rows of the batches of the chunk followed by values and rows, for a batch which
+// failed for good and took the chunk down with it. The chunk is discarded.
+func withChunk(c *chunk, values []string, rows []int) ([]string, []int) {
+	batches := c.discard()
+	if len(batches) == 0 {
+		return values, rows
+	}
+	var allValues []string
+	var allRows []int
+	for _, b := range batches {
+		allValues = append(allValues, b.values...)
+		allRows = append(allRows, b.rows...)
+	}
+	return append(allValues, values...), append(allRows, rows...)
+}
+
+// commitChunk commits the rest of the chunk of a worker at its end, the rows are counted as failed when that fails
+func (l *Loader) commitChunk(sess *session) error {
+	if sess == nil || sess.chunk == nil {
+		return nil
+	}
+	rows := sess.chunk.pendingRows()
+	if err := sess.chunk.commit(); err != nil {
+		sess.chunk.discard()
+		l.rowsFailed.Add(int64(len(rows)))
+		l.config.batchFailed(rows, err)
+		return &BatchError{Worker: sess.workerIndex, Rows: rows, Err: err, retryErrors: l.config.RetryErrors}
+	}
+	return nil
+}
+
+// pendingRows returns the rows of the batches of the chunk
+func (c *chunk) pendingRows() []int {
+	if c == nil {
+		return nil
+	}
+	var rows []int
+	for _, b := range c.batches {
+		rows = append(rows, b.rows...)
+	}
+	return rows
+}
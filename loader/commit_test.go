@@ -0,0 +1,84 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"gotest.tools/v3/assert"
+)
+
+func TestWorkerCommitEvery(t *testing.T) {
+	l := withConnConfig(t, 5)
+	defer l.batchesExecuted.Store(0)
+	var err error
+	l.config, err = ParseFlags([]string{"-commit-every", "4", "-batch-size", "2", "-max-retries", "1", "-backoff-base", "1ms", "-backoff-max", "1ms"})
+	assert.NilError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	const batch = "INSERT INTO `domain` (`Domain`) VALUES (?), (?)"
+	const single = "INSERT INTO `domain` (`Domain`) VALUES (?)"
+	mock.ExpectBegin()
+	mock.ExpectExec(batch).WithArgs("a", "b").WillReturnResult(sqlmock.NewResult(0, 2))
+	// the deadlock rolls back the first batch as well, the retry executes both again
+	mock.ExpectExec(batch).WithArgs("c", "d").WillReturnError(&mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(batch).WithArgs("a", "b").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(batch).WithArgs("c", "d").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	// the rest is committed when the worker exits
+	mock.ExpectBegin()
+	mock.ExpectExec(single).WithArgs("e").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	jobs := make(chan Job, 5)
+	for i, domain := range []string{"a", "b", "c", "d", "e"} {
+		jobs <- Job{Row: i + 1, Values: []string{domain}}
+	}
+	close(jobs)
+	assert.NilError(t, l.worker(context.Background(), 0, db, jobs, l.newBatchQueries("domain", []string{"Domain"}), nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, l.rowsInserted.Load(), int64(5))
+	assert.Equal(t, l.batchesExecuted.Load(), int64(3))
+	assert.Equal(t, l.rowsFailed.Load(), int64(0))
+}
+
+func TestWorkerCommitEveryFails(t *testing.T) {
+	l := withConnConfig(t, 5)
+	var err error
+	l.config, err = ParseFlags([]string{"-commit-every", "10", "-batch-size", "2"})
+	assert.NilError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	const batch = "INSERT INTO `domain` (`Domain`) VALUES (?), (?)"
+	mock.ExpectBegin()
+	mock.ExpectExec(batch).WithArgs("a", "b").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(batch).WithArgs("c", "d").WillReturnError(&mysql.MySQLError{Number: 1406, Message: "Data too long"})
+	mock.ExpectRollback()
+
+	jobs := make(chan Job, 4)
+	for i, domain := range []string{"a", "b", "c", "d"} {
+		jobs <- Job{Row: i + 1, Values: []string{domain}}
+	}
+	close(jobs)
+	err = l.worker(context.Background(), 0, db, jobs, l.newBatchQueries("domain", []string{"Domain"}), nil)
+	// the rows of the chunk committed nothing, all of them failed
+	var batchErr *BatchError
+	assert.Assert(t, errors.As(err, &batchErr))
+	assert.DeepEqual(t, batchErr.Rows, []int{1, 2, 3, 4})
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, l.rowsInserted.Load(), int64(0))
+	assert.Equal(t, l.rowsFailed.Load(), int64(4))
+
+	_, err = ParseFlags([]string{"-commit-every", "100", "-batch-transactions"})
+	assert.ErrorContains(t, err, "-commit-every can't be combined with -batch-transactions or -idempotency-table")
+	_, err = ParseFlags([]string{"-commit-every", "-1"})
+	assert.ErrorContains(t, err, "invalid commit-every -1")
+}
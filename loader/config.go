@@ -0,0 +1,1657 @@
+package loader
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// isolationLevels are the transaction isolation levels accepted by -isolation
+var isolationLevels = []string{"READ UNCOMMITTED", "READ COMMITTED", "REPEATABLE READ", "SERIALIZABLE"}
+
+// Config holds the settings which can be given on the command line
+type Config struct {
+	// CsvFile is the CSV file (or zip archive of CSV files) to import, - is stdin, a URL is streamed
+	CsvFile string
+	// CsvFiles are the inputs given after the flags, they are imported one after another instead of CsvFile
+	CsvFiles []string
+	// WatchDir is the directory a Watcher loads the files dropped into, one after another, instead of the inputs
+	WatchDir string
+	// ProcessedDir and FailedDir are where the Watcher moves the loaded and the failed files, by default the
+	// processed and failed subdirectories of WatchDir
+	ProcessedDir string
+	FailedDir    string
+	// WatchInterval is how often the Watcher looks for new files, a file is loaded once it didn't change for as long
+	WatchInterval time.Duration
+	// ServeAddr is the host:port the serve command listens on for the rows POSTed to /ingest/{table}
+	ServeAddr string
+	// ServeTables are the tables the serve command accepts rows for, only Table if empty
+	ServeTables []string
+	// ExportFile is the CSV file the export command writes the table to, <table>.csv if empty; a .gz file is gzip
+	// compressed
+	ExportFile string
+	// ExportKey is the integer column the export splits the table by, the primary key of a MySQL table if empty
+	ExportKey string
+	// ExportChunk is the number of keys selected by a single query of the export
+	ExportChunk int
+	// ExportPartRows starts a new file of the export once a file has as many rows, 0 writes a single file
+	ExportPartRows int64
+	// SyncKey are the columns identifying a row for the sync command, SyncDelete deletes the rows of the table whose
+	// key isn't in the input
+	SyncKey    []string
+	SyncDelete bool
+	// BenchRows are the synthetic rows the bench command imports with every combination of BenchWorkers and
+	// BenchBatchSizes. Without the columns of the table they have BenchColumns columns, the text values are
+	// BenchWidth characters long and all columns but the first take BenchCardinality values (0 is every row another).
+	BenchRows        int
+	BenchColumns     int
+	BenchWidth       int
+	BenchCardinality int
+	BenchWorkers     []int
+	BenchBatchSizes  []int
+	// Table is the target table
+	Table string
+	// Workers is the number of workers inserting concurrently, each with its own connection
+	Workers int
+	// BatchSize is the number of rows of a full batch (unless BatchPlaceholders is given)
+	BatchSize int
+	// AdaptiveBatch grows and shrinks the batches of every worker from BatchSize rows up to MaxBatchSize rows, so
+	// they take about TargetBatchLatency and fit into max_allowed_packet
+	AdaptiveBatch      bool
+	MaxBatchSize       int
+	TargetBatchLatency time.Duration
+	// maxAllowedPacket is the max_allowed_packet of the server for AdaptiveBatch, 0 if unknown
+	maxAllowedPacket int64
+	// AutoTune starts with MinWorkers of the Workers and adds workers every AutoTuneInterval as long as they raise the
+	// throughput, the pool is sized for the active ones
+	AutoTune         bool
+	MinWorkers       int
+	AutoTuneInterval time.Duration
+	// BufferSize is the capacity of the jobs channel between the reader and the workers
+	BufferSize int
+	// StagingTable is loaded instead of the target table, TransformSQL then moves the rows into the target table
+	StagingTable string
+	// TransformSQL is executed after loading the staging table
+	TransformSQL string
+	// DropStaging drops the staging table after a successful transform
+	DropStaging bool
+	// Swap loads a copy of the target table which replaces it after a successful import
+	Swap bool
+	// Preset is the name of the preset whose flags are applied before the command line
+	Preset string
+	// PresetsFile is a JSON file with more presets
+	PresetsFile string
+	// ListPresets lists the presets instead of importing
+	ListPresets bool
+	// presetDDL is the DDL of Preset, executed before the import
+	presetDDL string
+	// ConfigFile is a YAML file with flags applied before the environment and the command line, Profile the name of
+	// its profile whose flags override the ones of the file
+	ConfigFile string
+	Profile    string
+	// Tables are the loads of the tables listed by the -config file, in the order of the file, see Plan
+	Tables []Config
+	// DependsOn are the tables of the config file a table is loaded after
+	DependsOn []string
+	// IDMappings replace the keys of parent rows by the ids generated for them, through lookups
+	IDMappings []IDMapping
+	// DeferFKChecks turns off the foreign key checks of the workers, the rows are checked after the import instead
+	DeferFKChecks bool
+	// args are the flags parsed: the ones of the preset, the config file, the environment and the command line
+	args []string
+	// DefaultsFile is a MySQL option file (like ~/.my.cnf) to read connection settings from
+	DefaultsFile string
+	// DBHost, DBPort, DBSocket, DBUser and DBName override the connection settings of the environment and the
+	// option file when given
+	DBHost   string
+	DBPort   string
+	DBSocket string
+	DBUser   string
+	DBName   string
+	// PasswordFrom is the reference of the secret holding the password (or all credentials), like
+	// aws-sm://prod/db, vault://secret/data/db#password or gcp-sm://projects/p/secrets/db
+	PasswordFrom string
+	// IAMAuth authenticates with an IAM token of RDS, generated from the AWS credentials for every connection
+	IAMAuth bool
+	// MaxLines is the maximum of rows read over all inputs, 0 reads all rows
+	MaxLines int
+	// SkipFirst is the number of data rows skipped before the import starts, like ResumeFromLine SkipFirst+1
+	SkipFirst int
+	// Sample is the share of the rows read which is imported (0 < Sample <= 1), 0 imports all of them. The rows
+	// are picked by SampleSeed, 0 picks a random seed.
+	Sample     float64
+	SampleSeed int64
+	// EmptyAsNull inserts empty fields as NULL instead of an empty string
+	EmptyAsNull bool
+	// NullValues are the field values inserted as NULL, e.g. \N or NULL
+	NullValues []string
+	// null rules of the CSV columns and of the insert columns when a column of the -map-file has its own,
+	// set by ResolveColumns
+	headerNulls []nullRule
+	insertNulls []nullRule
+	// validations are the validation rules of the -map-file columns, set by ResolveColumns
+	validations []columnValidation
+	// HeaderAsData imports the first line as data when it doesn't look like a header
+	HeaderAsData bool
+	// Comment is the character starting comment lines in the CSV input, 0 if there are none
+	Comment rune
+	// Delimiter separates the fields of the CSV input
+	Delimiter rune
+	// LazyQuotes accepts quotes in unquoted fields and unescaped quotes in quoted fields
+	LazyQuotes bool
+	// Quote is the quote character of the CSV input, " or QuoteNone if quotes are just characters
+	Quote string
+	// TrimLeadingSpace removes the leading white space of the fields, also before a quoted field
+	TrimLeadingSpace bool
+	// ParseWorkers is the number of goroutines parsing the CSV input, 0 or 1 parse it in the reader
+	ParseWorkers int
+	// ReadRanges is the number of goroutines reading byte ranges of a single CSV file, 0 or 1 read it sequentially
+	ReadRanges int
+	// RaggedRows pads rows with too few fields with empty ones and drops empty fields after the last column
+	RaggedRows bool
+	// Isolation is the session transaction isolation level every worker sets on its connection.
+	// Empty means the server default is used.
+	Isolation string
+	// PreparedStatements executes the full batches of a worker as a statement prepared once per connection
+	PreparedStatements bool
+	// BatchTransactions executes every batch in an explicit transaction instead of autocommit mode
+	BatchTransactions bool
+	// CommitEvery executes the batches of a worker in a transaction which is committed once it has this many rows,
+	// 0 commits every batch on its own
+	CommitEvery int
+	// InitSQL are statements every worker executes on its connection right after acquiring it, before any insert
+	InitSQL []string
+	// PreSQL are statements executed once before the rows are loaded, PostSQL once after a successful import and
+	// OnFailureSQL once after a failed one, e.g. to disable and enable the keys of the table
+	PreSQL       []string
+	PostSQL      []string
+	OnFailureSQL []string
+	// Charset and Collation are the character set and collation of the connections, empty keeps the default of
+	// the driver (utf8mb4 with utf8mb4_general_ci)
+	Charset   string
+	Collation string
+	// TimeZone and SQLMode are the session time_zone and sql_mode every worker sets on its connection, empty keeps
+	// the server default
+	TimeZone string
+	SQLMode  string
+	// ResumeFromLine is the 1-based data row (the header is not counted) the import starts with.
+	// Zero or one means the whole file is imported.
+	ResumeFromLine int
+	// CheckpointFile receives the row up to which all rows are done while the import runs, the next run resumes
+	// after it unless ResumeFromLine is given
+	CheckpointFile string
+	// Resume requires a checkpoint to resume from, CheckpointFile defaults to the first input plus .checkpoint
+	Resume bool
+	// StripCR removes a trailing carriage return from the last field of every row
+	StripCR bool
+	// SlowBatchThreshold logs a warning for every batch whose execution takes longer, zero disables it
+	SlowBatchThreshold time.Duration
+	// MaxOpenConns and MaxIdleConns size the connection pool, 0 derives them from Workers
+	MaxOpenConns int
+	MaxIdleConns int
+	// ConnMaxLifetime is how long a connection of the pool is used at most, 0 is unlimited
+	ConnMaxLifetime time.Duration
+	// ShardJobs gives every worker its own jobs channel fed round-robin instead of a single shared one
+	ShardJobs bool
+	// Ordered executes the batches in the order of their rows in the input, one statement at a time
+	Ordered bool
+	// Shards are the databases (host[:port] or DSN) the rows are spread over by the value of ShardBy, with
+	// ShardMode hash or range (shard i gets the values below ShardRanges[i])
+	Shards      []string
+	ShardBy     string
+	ShardMode   string
+	ShardRanges []int64
+	// index of ShardBy in the row, set by ResolveColumns
+	shardIndex int
+	// PartitionBy is the column whose hashed value decides which worker gets a row, it implies ShardJobs
+	PartitionBy string
+	// index of PartitionBy in the row, set by ResolveColumns
+	partitionIndex int
+	// DedupeOn are the key columns by which duplicate rows of the run are skipped, empty keeps all rows
+	DedupeOn []string
+	// DedupeMaxKeys is the number of keys remembered for DedupeOn at most, 0 is unlimited. The Bloom filter is
+	// sized for it.
+	DedupeMaxKeys int
+	// DedupeMode is how the keys are remembered, one of dedupeModes
+	DedupeMode string
+	// DedupeFalsePositiveRate is the share of the rows with new keys DedupeBloom skips
+	DedupeFalsePositiveRate float64
+	// Routes send the rows to other tables than Table by the value of a column, the first route matching wins
+	Routes []Route
+	// RouteUnmatched is what happens to the rows matching no route, one of routeUnmatchedModes
+	RouteUnmatched string
+	// indexes of DedupeOn in the row, set by ResolveColumns
+	dedupeIndexes []int
+	// BatchPlaceholders is the number of placeholders a full batch should have, the rows per batch follow from
+	// the number of columns, 0 uses BatchSize rows
+	BatchPlaceholders int
+	// BehindThreshold is how long the jobs buffer may stay full before the workers falling behind is logged, 0
+	// disables the warning
+	BehindThreshold time.Duration
+	// FlushInterval is how long a worker waits for more rows before it executes a batch which isn't full
+	FlushInterval time.Duration
+	// MinFlushRows is the number of rows a batch needs to be executed on the flush timeout, smaller batches
+	// wait for more rows up to MaxFlushLatency
+	MinFlushRows int
+	// MaxFlushLatency bounds how long the first row of a batch waits for MinFlushRows
+	MaxFlushLatency time.Duration
+	// ShutdownGrace is how long the workers may still execute their batches after the import was interrupted
+	ShutdownGrace time.Duration
+	// Timeout is the deadline of the whole import, after it the import stops like on SIGINT, 0 is none
+	Timeout time.Duration
+	// BatchTimeout bounds every execution of a batch statement, a batch timing out is retried on a new connection
+	BatchTimeout time.Duration
+	// MinSuccessRatio is the minimum share of the rows read which has to be inserted for a successful run
+	MinSuccessRatio float64
+	// MaxConnectionErrors is the number of failed connection acquisitions (of all workers together)
+	// after which the import is aborted
+	MaxConnectionErrors int
+	// IdempotencyTable records the key of every imported batch, batches whose key is recorded are skipped,
+	// it implies ShardJobs
+	IdempotencyTable string
+	// TableTemplate is the name of the target table of every input with {{date}} and {{filebasename}}
+	// placeholders, the tables are created like Table, empty uses Table
+	TableTemplate string
+	// MaxErrors is the number of malformed CSV rows which are skipped (of all inputs together) before the
+	// import is aborted
+	MaxErrors int
+	// MaxErrorPct aborts the import when more than this percentage of the rows read are malformed, 0 means no
+	// limit. Without MaxErrors the number of malformed rows isn't limited then.
+	MaxErrorPct float64
+	// RejectsFile is the CSV file the malformed rows are recorded in with their line and error
+	RejectsFile string
+	// StopAfterErrorsPerFile abandons an input with more than this many malformed rows and goes on with the next one,
+	// 0 means no limit
+	StopAfterErrorsPerFile int
+	// MaxRetries is how often a batch failing with one of RetryErrors is retried
+	MaxRetries int
+	// RetryErrors are the MySQL error numbers a batch is retried for
+	RetryErrors []uint16
+	// MaxReconnects is how often a batch is retried on a new connection when the server closed the connection
+	MaxReconnects int
+	// HealthCheckIdle is how long a connection may be idle before it's pinged ahead of the next batch, 0 never pings
+	HealthCheckIdle time.Duration
+	// ThrottleOnError limits the concurrently executed batches after failures (AIMD), see Throttle
+	ThrottleOnError bool
+	// ThrottleIncrease is the additive increase of the limit per round of successful batches
+	ThrottleIncrease float64
+	// ThrottleDecrease is the factor the limit is multiplied with on a failed batch
+	ThrottleDecrease float64
+	// Rate is the maximum of rows per second sent to the workers, 0 is unlimited
+	Rate float64
+	// MaxBatchesPerSec is the maximum of batches per second executed by all workers, 0 is unlimited
+	MaxBatchesPerSec float64
+	// RateBurst is how many rows (or batches) the limits let through at once after a pause, at least 1
+	RateBurst int
+	// Backoff calculates the delay between retries
+	Backoff Backoff
+	// AuditFile is the path of the JSON lines file receiving a record of every batch, empty disables it
+	AuditFile string
+	// SummaryFile is the path of the JSON summary written by the command at the end of the import, - is stdout
+	SummaryFile string
+	// StatsDAddr is the host:port of a StatsD server receiving the batch metrics, empty disables them
+	StatsDAddr string
+	// MetricsAddr is the host:port serving the Prometheus metrics on /metrics during the import, empty disables it
+	MetricsAddr string
+	// QueryTag is put as comment in front of every INSERT, to identify the import in the slow query log
+	QueryTag string
+	// CleanupOnSuccess removes the temporary files of a run (see RegisterArtifact) after a successful import
+	CleanupOnSuccess bool
+	// LogFormat is the format of the log, one of logFormats
+	LogFormat string
+	// LogLevel is the minimum level logged, a logrus level
+	LogLevel string
+	// LogFile is the file the log is written to instead of stderr, empty logs to stderr
+	LogFile string
+	// LogMaxSize is the size in MB beyond which LogFile is rotated, 0 never rotates
+	LogMaxSize int
+	// LogMaxFiles is the number of rotated log files kept
+	LogMaxFiles int
+	// RunID is logged as run_id with every entry and written to the summary, generated by the command if empty
+	RunID string
+	// Progress is how the progress is shown, one of progressModes
+	Progress string
+	// ProgressInterval is how often the progress bar or log line is rendered, 0 is the default of the mode
+	ProgressInterval time.Duration
+	// CPUProfile is the file the CPU profile of the run is written to, empty disables profiling
+	CPUProfile string
+	// MemProfile is the file a heap profile is written to at the end of the run, empty disables it
+	MemProfile string
+	// BlockProfile and MutexProfile are the files the block and mutex profiles are written to at the end of
+	// the run, empty disables them
+	BlockProfile string
+	MutexProfile string
+	// PprofAddr is the host:port serving the live profiles of net/http/pprof, empty disables it
+	PprofAddr string
+	// CreateTable creates the table the rows are inserted into from the header unless it exists
+	CreateTable bool
+	// ColumnTypes are the types of the columns created by CreateTable, per column, the others are TEXT
+	ColumnTypes map[string]string
+	// InferTypes is the number of rows sampled to infer the types of the columns created by CreateTable, 0 creates
+	// TEXT columns
+	InferTypes int
+	// Truncate deletes all rows of the table before the import
+	Truncate bool
+	// Transforms are the transformers converting the values of CSV columns, per column, a pipeline of transformers
+	// is separated by |, e.g. trim|lower
+	Transforms map[string]string
+	// RowTransform converts the rows read after the Transforms and before they are inserted, an error skips the row
+	// like a malformed one. The returned row must have the fields of the header. Only set by library callers.
+	RowTransform func(row []string) ([]string, error)
+	// RowProcessor runs custom logic on the rows before they are inserted and on the batches executed, loaded from
+	// Plugin unless set by a library caller
+	RowProcessor RowProcessor
+	// Plugin is a Go plugin exporting the RowProcessor
+	Plugin string
+	// transforms are the Transforms resolved against the headers, insertTransforms their transformers per insert
+	// column (nil for the columns without one), set by ResolveColumns
+	transforms       []columnTransform
+	insertTransforms []Transformer
+	// Coerce converts the values to the types of their table columns read from the information schema
+	Coerce bool
+	// CoerceOverflow is what Coerce does with a string longer than its column, one of coerceOverflowModes
+	CoerceOverflow string
+	// coercions are the conversions of Coerce by CSV column, set by resolveCoercions
+	coercions []columnCoercion
+	// ValueExprs are SQL expressions per column used instead of a plain placeholder, e.g. ST_GeomFromText(?)
+	ValueExprs map[string]string
+	// GeometrySRID is the spatial reference system of the geometries of the -transform wkt columns, 0 is the default
+	// of the database
+	GeometrySRID int
+	// Lookups are per column queries with a single ? returning the id which replaces the CSV value
+	Lookups map[string]string
+	// LookupInserts are per column statements with a single ? inserting a missing code into the reference table
+	LookupInserts map[string]string
+	// LookupMiss is the policy for codes not found by a lookup, one of lookupMissPolicies
+	LookupMiss string
+	// DeadLetterFile receives the rows which are not imported as CSV
+	DeadLetterFile string
+	// DeadLetterFailedBatches writes the rows of a batch failing for good (after the retries) to DeadLetterFile
+	// instead of aborting the import
+	DeadLetterFailedBatches bool
+	// SplitFailedBatches executes the rows of a batch failing because of its data one by one, the failing rows go to
+	// DeadLetterFile
+	SplitFailedBatches bool
+	// Mode is how the rows are inserted, one of importModes
+	Mode string
+	// LoadDataChunk is the number of rows per LOAD DATA statement of ModeLoadData, 0 loads all rows with one
+	LoadDataChunk int
+	// InputEncoding is the encoding of the inputs (one of inputEncodings) or EncodingAuto, they are decoded to UTF-8
+	InputEncoding string
+	// InputFormat is the format of the inputs, one of inputFormats
+	InputFormat string
+	// Sheet is the name or the number (from 1) of the sheet read from a workbook of InputFormatXLSX, the first one if
+	// empty. SheetHeaderRow is the number of its header row, 0 detects it.
+	Sheet          string
+	SheetHeaderRow int
+	// DryRun logs the batch statements instead of executing them, the database isn't connected at all
+	DryRun bool
+	// Explain is the number of statements printed to stdout with their values bound, 0 prints none
+	Explain int
+	// PostImportSQL is executed after a successful import with the aggregates of the run bound to its variables
+	PostImportSQL string
+	// Verify counts the rows of the target table before and after the import, the import fails unless the table
+	// grew by the rows inserted
+	Verify bool
+	// VerifyWhere is the condition of the rows counted by Verify, empty counts all rows
+	VerifyWhere string
+	// VerifySum is a numeric column whose sum in the table Verify compares with the sum of the inserted values
+	VerifySum string
+	// verifySumIndex is the index of VerifySum in the headers
+	verifySumIndex int
+	// postImportQuery is PostImportSQL with placeholders for postImportVars
+	postImportQuery string
+	postImportVars  []aggregateVar
+	// OnDuplicate is the handling of rows whose key exists, one of onDuplicateModes
+	OnDuplicate string
+	// UpdateColumns are the columns set by OnDuplicateUpdate, empty means all columns
+	UpdateColumns []string
+	// ConflictColumns are the key columns of the ON CONFLICT clause of OnDuplicateUpdate with the dialects other
+	// than MySQL
+	ConflictColumns []string
+	// Dialect is the database the statements are built for, one of the registered dialects (mysql by default)
+	Dialect string
+	// DBDriver is the database/sql driver the connection is opened with, empty is the one of the dialect
+	DBDriver string
+	// ColumnMap selects the CSV columns which are inserted and the table column each one goes to, empty inserts
+	// all columns into the columns of the same name
+	ColumnMap []ColumnMapping
+	// SkipColumns are CSV columns which are not inserted
+	SkipColumns []string
+	// Constants are table columns inserted with the same value for every row
+	Constants map[string]string
+	// values of Constants in the order of constantColumns, set by ResolveColumns
+	constantValues []string
+	// Generated are table columns whose values are computed from a template of CSV columns and functions
+	Generated map[string]string
+	// the Generated columns in the order of generatedColumns, set by ResolveColumns
+	generated []generatedColumn
+	// Lineage generates the columns load_file, load_line, load_id (the RunID) and load_time (the start of the run)
+	// for every row
+	Lineage bool
+	// started is the start of the run, set when it starts
+	started time.Time
+	// indexes of the ColumnMap headers in the row, set by ResolveColumns
+	mapIndexes []int
+	// DumpFailedSQL is the file receiving statement and arguments of every failed batch, empty disables it
+	DumpFailedSQL string
+	// MaskColumns are the columns whose values are masked in the failed SQL dump
+	MaskColumns []string
+	// TrimQuotes are the columns whose values get a single pair of surrounding quotes removed
+	TrimQuotes []string
+	// indexes of TrimQuotes in the row, set by ResolveColumns
+	trimQuotesIndexes []int
+	// Pads are the padding specs for fixed width CHAR columns
+	Pads []PadSpec
+}
+
+// ParseFlags parses the command line arguments into a validated Config. The flags are layered, a later layer wins:
+// the -preset, the -config file, its -profile, the environment (GO_MYSQL_WORKER_BATCH_SIZE for -batch-size) and
+// the command line.
+func ParseFlags(args []string) (Config, error) {
+	return parseFlags(args, true)
+}
+
+// parseFlags parses args, with expand the flags of the environment, the -config file and the -preset are put in
+// front of args
+func parseFlags(args []string, expand bool) (Config, error) {
+	var c Config
+	fs := flag.NewFlagSet("go-mysql-worker", flag.ContinueOnError)
+	fs.StringVar(&c.WatchDir, "watch-dir", "", "load the files dropped into this directory one after another instead of the inputs, until interrupted")
+	fs.StringVar(&c.ProcessedDir, "processed-dir", "", "directory the loaded files of -watch-dir are moved to (default <watch-dir>/processed)")
+	fs.StringVar(&c.FailedDir, "failed-dir", "", "directory the failed files of -watch-dir are moved to, with their error (default <watch-dir>/failed)")
+	fs.DurationVar(&c.WatchInterval, "watch-interval", 2*time.Second, "how often -watch-dir is looked at, a file is loaded once it didn't change for as long")
+	fs.StringVar(&c.ServeAddr, "serve-addr", ":8080", "host:port the serve command listens on for the rows POSTed to /ingest/{table}")
+	fs.Func("serve-tables", "comma separated tables the serve command accepts rows for (default the -table)", func(s string) error {
+		c.ServeTables = append(c.ServeTables, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.StringVar(&c.ExportFile, "export-file", "", "CSV file the export command writes the table to, .gz compressed, - for stdout (default <table>.csv)")
+	fs.StringVar(&c.ExportKey, "export-key", "", "integer column the export command splits the table by (default the primary key with MySQL)")
+	fs.IntVar(&c.ExportChunk, "export-chunk", 10000, "number of keys of -export-key a single SELECT of the export command reads")
+	fs.Int64Var(&c.ExportPartRows, "export-part-rows", 0,
+		"start a new numbered file (domains-2.csv) once a file of the export command has this many rows, 0 writes a single file")
+	fs.Func("sync-key", "comma separated columns identifying a row for the sync command, the primary key or a unique index", func(s string) error {
+		c.SyncKey = append(c.SyncKey, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.BoolVar(&c.SyncDelete, "sync-delete", false, "delete the rows of the table whose -sync-key isn't in the input with the sync command")
+	fs.IntVar(&c.BenchRows, "bench-rows", 100000, "synthetic rows the bench command imports with every combination of workers and batch size")
+	fs.IntVar(&c.BenchColumns, "bench-columns", 8, "text columns of the synthetic rows of the bench command if the table has no columns to generate them for")
+	fs.IntVar(&c.BenchWidth, "bench-width", 32, "characters of the text values of the synthetic rows of the bench command at most")
+	fs.IntVar(&c.BenchCardinality, "bench-cardinality", 0,
+		"distinct values of the columns of the synthetic rows but the first (the key) of the bench command, 0 is another value for every row")
+	fs.Var(intListFlag{&c.BenchWorkers, "bench-workers"}, "bench-workers", "comma separated numbers of workers the bench command runs with (default 1,2,4,8,16)")
+	fs.Var(intListFlag{&c.BenchBatchSizes, "bench-batch-sizes"}, "bench-batch-sizes",
+		"comma separated batch sizes the bench command runs every number of workers with (default 100,500,1000,5000)")
+	fs.StringVar(&c.CsvFile, "csv", CsvFile,
+		"CSV file, directory or archive (.zip, .tar.gz) of CSV files to import, - reads stdin (more inputs can follow the flags)")
+	fs.StringVar(&c.CsvFile, "file", CsvFile, "alias of -csv")
+	fs.IntVar(&c.MaxLines, "max-lines", 0, "stop after reading this many rows over all inputs, 0 reads all rows")
+	fs.IntVar(&c.MaxLines, "limit", 0, "alias of -max-lines")
+	fs.IntVar(&c.SkipFirst, "skip-rows", 0, "skip this many data rows (header not counted) before the import starts")
+	fs.Func("sample", "import this share of the rows read, as percentage (1%) or fraction (0.01)", func(s string) error {
+		rate, err := parseSampleRate(s)
+		c.Sample = rate
+		return err
+	})
+	fs.Int64Var(&c.SampleSeed, "sample-seed", 0, "seed picking the rows of -sample, the same seed picks the same rows; 0 picks a random seed, which is logged")
+	fs.StringVar(&c.Table, "table", TableName, "target table, optionally qualified by its schema (schema.table)")
+	fs.IntVar(&c.Workers, "workers", totalWorkers, "number of workers inserting concurrently, each uses its own connection")
+	fs.IntVar(&c.MaxOpenConns, "max-open-conns", 0,
+		fmt.Sprintf("maximum of open database connections, 0 is one per worker plus %d for the statements outside of the workers", dbExtraConns))
+	fs.IntVar(&c.MaxIdleConns, "max-idle-conns", 0, "maximum of idle database connections kept open, 0 keeps all of -max-open-conns")
+	fs.DurationVar(&c.ConnMaxLifetime, "conn-max-lifetime", 0,
+		"replace database connections after they have been used this long (e.g. below the wait_timeout of a proxy), 0 is unlimited")
+	fs.IntVar(&c.BatchSize, "batch-size", sqlBatchSize, "rows inserted by a single INSERT statement")
+	fs.BoolVar(&c.AdaptiveBatch, "adaptive-batch", false,
+		"grow and shrink the batches of every worker from -batch-size rows up to -max-batch-size, so they take about -target-batch-latency and fit into max_allowed_packet")
+	fs.IntVar(&c.MaxBatchSize, "max-batch-size", 1000, "maximum rows of a batch with -adaptive-batch")
+	fs.DurationVar(&c.TargetBatchLatency, "target-batch-latency", 200*time.Millisecond, "execution time of a batch -adaptive-batch aims for")
+	fs.BoolVar(&c.AutoTune, "auto-tune", false,
+		"start with -min-workers and add workers (up to -workers) as long as they raise the throughput, sizing the connection pool for them; the best count is logged")
+	fs.IntVar(&c.MinWorkers, "min-workers", 4, "workers -auto-tune starts with")
+	fs.DurationVar(&c.AutoTuneInterval, "auto-tune-interval", 10*time.Second, "interval -auto-tune measures the throughput of a worker count in")
+	fs.IntVar(&c.BufferSize, "buffer", channelBufferSize, "rows buffered between the CSV reader and the workers")
+	fs.StringVar(&c.StagingTable, "staging-table", "", "load this staging table instead of the target table, requires -transform-sql")
+	fs.StringVar(&c.TransformSQL, "transform-sql", "",
+		"statement moving the rows from the staging table into the target table, e.g. 'INSERT INTO domain SELECT ... FROM domain_staging'")
+	fs.BoolVar(&c.DropStaging, "drop-staging", false, "drop the staging table after a successful transform")
+	fs.BoolVar(&c.Swap, "swap", false,
+		"load an empty copy TABLE_staging of the table and swap it with the table (RENAME TABLE) after a successful import, dropping the old rows")
+	fs.StringVar(&c.DefaultsFile, "defaults-file", "",
+		"read host, port, socket, user, password and database from the [client] and [mysql] sections of this MySQL option file (e.g. ~/.my.cnf)")
+	fs.StringVar(&c.DBHost, "db-host", "", "database host, overrides DB_HOST and the option file")
+	fs.StringVar(&c.DBPort, "db-port", "", "database port, overrides DB_PORT and the option file")
+	fs.StringVar(&c.DBSocket, "db-socket", "", "unix socket of the database (instead of host and port), overrides DB_SOCKET and the option file")
+	fs.StringVar(&c.DBUser, "db-user", "", "database user, overrides DB_USERNAME and the option file (the password is only read from DB_PASSWORD or the option file)")
+	fs.StringVar(&c.DBName, "db-name", "", "database, overrides DB_NAME and the option file")
+	fs.StringVar(&c.PasswordFrom, "password-from", "",
+		"read the password (or username, password, host, port and dbname of a JSON secret) from aws-sm://, vault:// or gcp-sm:// NAME[#FIELD]")
+	fs.BoolVar(&c.IAMAuth, "iam-auth", false, "authenticate with an RDS IAM token generated from the AWS credentials instead of the password (requires TLS)")
+	fs.Func("comment", "lines starting with this character are comments and get ignored (also before the header)", func(s string) error {
+		r, err := singleRune(s)
+		c.Comment = r
+		return err
+	})
+	c.Delimiter = ','
+	fs.Func("delimiter", "character separating the fields, e.g. ';' or '\\t' for tab (default ',')", func(s string) error {
+		r, err := delimiterRune(s)
+		c.Delimiter = r
+		return err
+	})
+	fs.BoolVar(&c.LazyQuotes, "lazy-quotes", false,
+		"accept quotes in unquoted fields and unescaped quotes in quoted fields, for exporters not following RFC 4180")
+	fs.StringVar(&c.Quote, "quote", `"`, "quote character of the fields, \" or none to split every line at the delimiter")
+	fs.BoolVar(&c.TrimLeadingSpace, "trim-leading-space", false, "remove the leading white space of the fields, e.g. after '; '")
+	fs.IntVar(&c.ParseWorkers, "parse-workers", 0,
+		"number of goroutines parsing the CSV input in chunks (the rows keep their order), for inputs the reader can't parse as fast as the workers insert")
+	fs.IntVar(&c.ReadRanges, "read-ranges", 0,
+		"number of goroutines reading and parsing byte ranges of a single uncompressed CSV file in parallel (the rows keep their order), for large files on fast disks")
+	fs.BoolVar(&c.RaggedRows, "ragged-rows", false,
+		"pad rows with too few fields with empty fields and drop empty fields after the last column instead of rejecting the row")
+	fs.BoolVar(&c.EmptyAsNull, "empty-as-null", false, "insert empty fields as NULL instead of an empty string")
+	fs.Func("null-values", "comma separated field values inserted as NULL, e.g. '\\N,NULL' (a -map-file column may set its own)", func(s string) error {
+		c.NullValues = append(c.NullValues, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.BoolVar(&c.HeaderAsData, "header-as-data", false,
+		"import the first line as data with the columns of the target table when it doesn't look like a header")
+	fs.StringVar(&c.Isolation, "isolation", "",
+		"transaction isolation level of the worker sessions ("+strings.Join(isolationLevels, ", ")+"), empty keeps the server default")
+	fs.BoolVar(&c.PreparedStatements, "prepared-statements", false,
+		"execute the full batches as a statement every worker prepares once, so the server doesn't parse it for every batch")
+	fs.IntVar(&c.CommitEvery, "commit-every", 0,
+		"execute the batches of a worker in a transaction committed after this many rows, a failing batch rolls back and retries the whole chunk")
+	fs.BoolVar(&c.BatchTransactions, "batch-transactions", false,
+		"execute every batch in an explicit transaction (BEGIN, INSERT, COMMIT), rolled back when it fails")
+	fs.StringVar(&c.Charset, "charset", "", "character set of the connections, e.g. utf8mb4 (the driver default)")
+	fs.StringVar(&c.Collation, "collation", "",
+		"collation of the connections, e.g. utf8mb4_0900_ai_ci to compare like the key columns (default utf8mb4_general_ci)")
+	fs.StringVar(&c.TimeZone, "time-zone", "",
+		"session time_zone of the workers, e.g. +00:00 or Europe/Berlin, for the conversion of TIMESTAMP values (empty keeps the server default)")
+	fs.StringVar(&c.SQLMode, "sql-mode", "",
+		"session sql_mode of the workers, e.g. STRICT_ALL_TABLES,NO_ZERO_DATE (empty keeps the server default)")
+	fs.Func("init-sql", "statement every worker executes on its connection right after acquiring it (e.g. SET time_zone='+00:00'), can be repeated", func(s string) error {
+		c.InitSQL = append(c.InitSQL, s)
+		return nil
+	})
+	fs.Func("pre-sql", "statement executed once before the rows are loaded (e.g. ALTER TABLE t DISABLE KEYS), can be repeated", func(s string) error {
+		c.PreSQL = append(c.PreSQL, s)
+		return nil
+	})
+	fs.Func("post-sql", "statement executed once after a successful import (e.g. ANALYZE TABLE t), can be repeated", func(s string) error {
+		c.PostSQL = append(c.PostSQL, s)
+		return nil
+	})
+	fs.Func("on-failure-sql", "statement executed once after a failed import to clean up (e.g. DROP TABLE t_new), can be repeated", func(s string) error {
+		c.OnFailureSQL = append(c.OnFailureSQL, s)
+		return nil
+	})
+	fs.IntVar(&c.ResumeFromLine, "resume-from-line", 0,
+		"data row (1-based, header not counted) to resume the import from, rows before are skipped")
+	fs.StringVar(&c.CheckpointFile, "checkpoint-file", "",
+		"record the row up to which all rows are committed in this file and resume after it on the next run, removed after a successful import")
+	fs.BoolVar(&c.Resume, "resume", false,
+		"resume after the rows committed by the previous run, from the -checkpoint-file (default the input plus .checkpoint), fails when there is none")
+	fs.BoolVar(&c.StripCR, "strip-cr", false,
+		"strip a trailing carriage return (\\r) from the last field of every row")
+	fs.DurationVar(&c.SlowBatchThreshold, "slow-batch-threshold", 0,
+		"log a warning for batches taking longer than this to execute (e.g. 500ms), 0 disables it")
+	fs.BoolVar(&c.ShardJobs, "shard-jobs", false,
+		"give every worker its own jobs channel (fed round-robin) to reduce contention on a single shared channel")
+	fs.BoolVar(&c.Ordered, "ordered", false,
+		"insert the rows in the order of the input (e.g. for AUTO_INCREMENT ids following it), the batches are executed one at a time")
+	fs.IntVar(&c.BatchPlaceholders, "batch-placeholders", 0,
+		fmt.Sprintf("size batches by placeholders instead of rows (rows = placeholders / columns, up to %d), 0 uses -batch-size rows", maxPlaceholders))
+	fs.DurationVar(&c.BehindThreshold, "behind-threshold", 10*time.Second,
+		"warn when the -buffer between the reader and the workers stays full for longer than this, 0 disables the warning")
+	fs.DurationVar(&c.FlushInterval, "flush-interval", 1*time.Second,
+		"how long a worker waits for more rows before it executes a batch which isn't full")
+	fs.IntVar(&c.MinFlushRows, "min-flush-rows", 0,
+		"only execute a batch which isn't full on the flush timeout when it has at least this many rows")
+	fs.DurationVar(&c.MaxFlushLatency, "max-flush-latency", 10*time.Second,
+		"maximum time a row waits for -min-flush-rows before its batch is executed anyway")
+	fs.DurationVar(&c.ShutdownGrace, "shutdown-grace", 10*time.Second,
+		"on SIGINT or SIGTERM stop reading and give the workers this long to flush their batches")
+	fs.DurationVar(&c.Timeout, "timeout", 0,
+		"stop the import after this long like on SIGINT, e.g. 2h (0 is no deadline)")
+	fs.DurationVar(&c.BatchTimeout, "batch-timeout", 0,
+		"abort a batch statement running longer than this and retry it on a new connection (0 is no timeout)")
+	fs.Float64Var(&c.MinSuccessRatio, "min-success-ratio", 0,
+		"exit with an error if less than this share (0..1) of the rows read got inserted, e.g. 0.99")
+	fs.IntVar(&c.MaxConnectionErrors, "max-connection-errors", 10,
+		"abort with 'database unavailable' after this many failed connection attempts of all workers together")
+	fs.StringVar(&c.IdempotencyTable, "idempotency-table", "",
+		"record a key of every imported batch in this table and skip batches already recorded when a file is replayed")
+	fs.StringVar(&c.TableTemplate, "table-template", "",
+		"import every input into its own table named by this template, e.g. domain_{{date}} or {{filebasename}}")
+	fs.IntVar(&c.MaxErrors, "max-errors", 0,
+		"skip up to this many malformed CSV rows (of all inputs together) before aborting the import")
+	fs.Float64Var(&c.MaxErrorPct, "max-error-pct", 0,
+		"abort the import when more than this percentage of the rows read are malformed (checked after 1000 rows and at the end of every input), without -max-errors the number isn't limited")
+	fs.StringVar(&c.RejectsFile, "rejects-file", "",
+		"record every malformed row with its input, row number, line and error in this CSV file")
+	fs.IntVar(&c.StopAfterErrorsPerFile, "stop-after-errors-per-file", 0,
+		"abandon an input with more than this many malformed rows and continue with the next one, 0 means no limit")
+	fs.IntVar(&c.MaxRetries, "max-retries", 0,
+		"retry a batch failing with one of the -retry-errors up to this many times")
+	c.RetryErrors = retryableErrors
+	fs.Func("retry-errors", "comma separated MySQL error numbers a batch is retried for (default 1205,1213,1040: lock wait timeout, deadlock, too many connections)", func(s string) error {
+		numbers, err := parseErrorNumbers(s)
+		c.RetryErrors = numbers
+		return err
+	})
+	fs.IntVar(&c.MaxReconnects, "max-reconnects", 3,
+		"retry a batch up to this many times on a new connection when the server closed the connection (2006, 2013)")
+	fs.DurationVar(&c.HealthCheckIdle, "health-check-idle", time.Minute,
+		"ping the connection of a worker idle for longer than this before its next batch and reconnect if it's dead (0 never pings)")
+	fs.BoolVar(&c.ThrottleOnError, "throttle-on-error", false,
+		"execute fewer batches at the same time after failed batches and recover as they succeed again (AIMD)")
+	fs.Float64Var(&c.ThrottleIncrease, "throttle-increase", 1,
+		"additive increase of the concurrent batches per round of successful batches for -throttle-on-error")
+	fs.Float64Var(&c.ThrottleDecrease, "throttle-decrease", 0.5,
+		"factor (between 0 and 1) the concurrent batches are multiplied with on a failed batch for -throttle-on-error")
+	fs.Float64Var(&c.Rate, "rate", 0, "insert at most this many rows per second across all workers, 0 is unlimited")
+	fs.Float64Var(&c.MaxBatchesPerSec, "max-batches-per-sec", 0, "execute at most this many batches per second across all workers, 0 is unlimited")
+	fs.IntVar(&c.RateBurst, "rate-burst", 1, "rows (or batches) -rate and -max-batches-per-sec let through at once after an idle time")
+	fs.StringVar(&c.Backoff.Strategy, "backoff-strategy", BackoffExponentialJitter,
+		"delay strategy between retries: "+strings.Join(backoffStrategies, ", "))
+	fs.DurationVar(&c.Backoff.Base, "backoff-base", 100*time.Millisecond, "delay of the first retry")
+	fs.DurationVar(&c.Backoff.Max, "backoff-max", 10*time.Second, "maximum delay between retries")
+	fs.StringVar(&c.AuditFile, "audit-file", "",
+		"write a JSON line for every executed batch (worker, rows, bytes, duration, status, row ranges) to this file")
+	fs.StringVar(&c.SummaryFile, "summary-file", "",
+		"write a JSON summary of the import (rows, bytes, wall time, rows/s, batches per worker, outcome) to this file at the end, - is stdout")
+	fs.StringVar(&c.StatsDAddr, "statsd-addr", "",
+		"send batch metrics (rows, errors, batch duration) to this StatsD server (host:port) over UDP")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", "",
+		"serve Prometheus metrics (rows, batches, retries, errors, batch durations per worker, queue depth, pool stats) on http://host:port/metrics, e.g. :9100")
+	fs.StringVar(&c.QueryTag, "query-tag", "",
+		"tag every INSERT with this SQL comment, e.g. 'import:majestic run:abc123'")
+	fs.StringVar(&c.PartitionBy, "partition-by-worker", "",
+		"route rows to workers by hashing this key column, so every worker owns a disjoint set of keys (implies -shard-jobs)")
+	fs.Func("shard", "database of a shard (host[:port] sharing the other connection settings, or a DSN user:password@tcp(host:port)/db), "+
+		"can be repeated; the rows are spread over the shards by -shard-by", func(s string) error {
+		c.Shards = append(c.Shards, s)
+		return nil
+	})
+	fs.StringVar(&c.ShardBy, "shard-by", "", "column whose value picks the -shard of a row")
+	fs.StringVar(&c.ShardMode, "shard-mode", ShardModeHash,
+		"how -shard-by picks the shard: hash hashes the value, range compares it with -shard-ranges")
+	fs.Var(shardRangesFlag{&c.ShardRanges}, "shard-ranges",
+		"comma separated ascending integer bounds of -shard-mode range, one fewer than the shards: shard i gets the values below bound i, the last shard the rest")
+	fs.Var(routeFlag{&c.Routes}, "route",
+		"column=value[|value...]:table[:column,...] inserts the rows whose column has one of the values into table (with the given mapped columns only), can be repeated")
+	fs.StringVar(&c.RouteUnmatched, "route-unmatched", RouteUnmatchedTable,
+		"what happens to the rows matching no -route: table inserts them into -table, skip leaves them out, fail stops the import")
+	fs.Func("dedupe-on", "comma separated key columns, the rows whose values of them were read before in the run are skipped", func(s string) error {
+		c.DedupeOn = append(c.DedupeOn, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.IntVar(&c.DedupeMaxKeys, "dedupe-max-keys", 10000000,
+		"keys remembered by -dedupe-on at most (they are kept in memory), the duplicates of later keys are inserted, 0 is unlimited; the size of the bloom filter")
+	fs.StringVar(&c.DedupeMode, "dedupe-mode", DedupeMemory,
+		"how -dedupe-on remembers the keys: memory keeps them all, bloom keeps a Bloom filter of a fixed size which skips some rows with new keys")
+	fs.Float64Var(&c.DedupeFalsePositiveRate, "dedupe-false-positive-rate", 0.001,
+		"share of the rows with new keys skipped by -dedupe-mode bloom while it has no more than -dedupe-max-keys keys")
+	fs.BoolVar(&c.CleanupOnSuccess, "cleanup-on-success", false,
+		"remove temporary files of the run (e.g. an empty dead-letter file) when the import succeeds")
+	fs.StringVar(&c.LogFormat, "log-format", LogFormatText, "format of the log: "+strings.Join(logFormats, ", "))
+	fs.StringVar(&c.Progress, "progress", ProgressRows,
+		"how the progress is shown: rows logs every 1000 rows, bar redraws a progress bar on stderr, log logs it periodically, auto is bar on a terminal and log otherwise, off")
+	fs.DurationVar(&c.ProgressInterval, "progress-interval", 0,
+		fmt.Sprintf("how often -progress bar or log renders the progress, 0 is %s for the bar and %s for the log", progressBarInterval, progressLogInterval))
+	fs.StringVar(&c.LogLevel, "log-level", "info",
+		"minimum level logged: trace, debug, info, warn, error, e.g. warn hides the worker lifecycle messages")
+	fs.StringVar(&c.LogFile, "log-file", "", "write the log to this file instead of stderr")
+	fs.IntVar(&c.LogMaxSize, "log-max-size", 100, "rotate -log-file when it would grow beyond this many MB (0 never rotates)")
+	fs.IntVar(&c.LogMaxFiles, "log-max-files", 5, "number of rotated log files kept as FILE.1 (the newest) to FILE.N")
+	fs.StringVar(&c.RunID, "run-id", "", "ID of the run logged as run_id with every entry and written to the summary, random if not given")
+	fs.StringVar(&c.CPUProfile, "cpuprofile", "", "write a CPU profile of the run to this file")
+	fs.StringVar(&c.MemProfile, "memprofile", "", "write a heap profile to this file at the end of the run")
+	fs.StringVar(&c.BlockProfile, "blockprofile", "", "write a profile of the goroutines blocking (e.g. on the jobs channel) to this file at the end of the run")
+	fs.StringVar(&c.MutexProfile, "mutexprofile", "", "write a profile of the mutex contention to this file at the end of the run")
+	fs.StringVar(&c.PprofAddr, "pprof-addr", "", "serve the live profiles of net/http/pprof on http://host:port/debug/pprof/, e.g. :6060")
+	fs.BoolVar(&c.CreateTable, "create-table", false,
+		"create the table from the header (all columns TEXT unless given by -column-types) unless it exists")
+	fs.IntVar(&c.InferTypes, "infer-types", 0,
+		"sample this many rows to infer the types of the columns created by -create-table (INT, BIGINT, DOUBLE, DATETIME, VARCHAR), 0 creates TEXT columns")
+	fs.BoolVar(&c.Truncate, "truncate", false, "delete all rows of the table before the import (TRUNCATE TABLE)")
+	fs.Var(keyValueFlag{&c.ColumnTypes}, "column-types",
+		"type of a column created by -create-table, given as col=type (e.g. GlobalRank=INT), can be repeated")
+	fs.Var(keyValueFlag{&c.Transforms}, "transform",
+		"convert a column before it is inserted, given as col=transformer with the transformers "+strings.Join(transformerNames(), ", ")+
+			" or a pipeline of them separated by | (e.g. GlobalRank=int or Domain='trim|lower'), a row failing to convert goes to the -dead-letter-file, can be repeated")
+	fs.BoolVar(&c.Coerce, "coerce", false,
+		"convert the values to the types of their table columns (integers, decimals, dates, booleans, string lengths), a value which doesn't convert fails its row")
+	fs.StringVar(&c.CoerceOverflow, "coerce-overflow", CoerceOverflowError,
+		"what -coerce does with a string longer than its column: error fails the row, truncate cuts it")
+	fs.StringVar(&c.Plugin, "plugin", "",
+		"Go plugin (built with -buildmode=plugin) exporting a RowProcessor variable implementing loader.RowProcessor, which processes the rows and batches")
+	fs.Var(keyValueFlag{&c.ValueExprs}, "value-expr",
+		"insert a column through a SQL expression binding the CSV value as its single ?, given as col=expr (e.g. geom='ST_GeomFromText(?)'), can be repeated")
+	fs.IntVar(&c.GeometrySRID, "geometry-srid", 0, "SRID the WKT of the -transform wkt columns is converted with (e.g. 4326), 0 is the default of the database")
+	fs.Var(keyValueFlag{&c.Lookups}, "lookup",
+		"replace a column by the id a query binding the CSV value as its single ? returns, given as col=query (e.g. tld='SELECT id FROM tld WHERE code=?'), can be repeated")
+	fs.Var(keyValueFlag{&c.LookupInserts}, "lookup-insert",
+		"statement inserting a code missing in the reference table of a -lookup column, given as col=stmt, for -lookup-miss=insert-ref")
+	fs.Var(idMappingFlag{&c.IDMappings}, "map-id",
+		"column=table:key[:id] replaces the column by the id (default column id) of the row of table, a parent loaded before, whose key column has the value, can be repeated")
+	fs.Func("depends-on", "comma separated tables of the -config file loaded before this one, besides the ones referenced by its foreign keys and -map-id", func(s string) error {
+		c.DependsOn = append(c.DependsOn, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.BoolVar(&c.DeferFKChecks, "defer-fk-checks", false,
+		"turn off the foreign key checks while inserting (foreign_key_checks = 0) and check the rows against the foreign keys after the import")
+	fs.StringVar(&c.LookupMiss, "lookup-miss", LookupMissDeadLetter,
+		"what happens with a row whose code is not found by a lookup: "+strings.Join(lookupMissPolicies, ", "))
+	fs.StringVar(&c.DeadLetterFile, "dead-letter-file", "",
+		"write rows which are not imported (e.g. lookup misses) to this CSV file")
+	fs.BoolVar(&c.DeadLetterFailedBatches, "dead-letter-failed-batches", false,
+		"write the rows of a batch failing for good (after -max-retries) to the -dead-letter-file and go on instead of aborting the import")
+	fs.BoolVar(&c.SplitFailedBatches, "split-failed-batches", false,
+		"insert the rows of a batch failing because of its data one by one and write the failing rows to the -dead-letter-file")
+	fs.StringVar(&c.InputEncoding, "input-encoding", EncodingAuto,
+		"encoding of the inputs, decoded to UTF-8 without BOM: auto detects it by the BOM and the content, or one of "+strings.Join(encodingNames()[1:], ", "))
+	fs.StringVar(&c.InputFormat, "input-format", InputFormatCSV,
+		"format of the inputs: csv, jsonl (JSON Lines, one object per line whose keys are the columns) or xlsx (an Excel workbook)")
+	fs.StringVar(&c.Sheet, "sheet", "", "name or number (from 1) of the sheet of an -input-format xlsx workbook which is read (default the first one)")
+	fs.IntVar(&c.SheetHeaderRow, "sheet-header-row", 0,
+		"number of the header row of the -sheet, 0 takes the first row with as many cells as the widest of the first 10 rows")
+	fs.StringVar(&c.Mode, "mode", ModeInsert,
+		"how the rows are inserted: insert (the workers) or load-data (LOAD DATA LOCAL INFILE, for clean CSV files)")
+	fs.IntVar(&c.LoadDataChunk, "load-data-chunk", 0,
+		"rows per LOAD DATA statement of -mode load-data, a failing statement only loses its chunk (0 loads all rows with one statement)")
+	fs.IntVar(&c.Explain, "explain", 0,
+		"print the first N INSERT statements with their values bound to stdout, e.g. with -dry-run to check the column order")
+	fs.BoolVar(&c.DryRun, "dry-run", false,
+		"read the input and log the batch statements without connecting to the database or writing anything")
+	fs.StringVar(&c.PostImportSQL, "post-import-sql", "",
+		"statement executed after a successful import, with the variables {{rows}}, {{rows_read}}, {{duration_ms}} and {{sum:column}}")
+	fs.BoolVar(&c.Verify, "verify", false,
+		"count the rows of the table before and after the import and fail unless it grew by the rows inserted")
+	fs.StringVar(&c.VerifyWhere, "verify-where", "", "condition of the rows counted by -verify, e.g. batch_id = 42")
+	fs.StringVar(&c.VerifySum, "verify-sum", "", "numeric column whose sum -verify compares with the sum of the inserted values")
+	fs.StringVar(&c.OnDuplicate, "on-duplicate", OnDuplicateError,
+		"what happens with a row whose key exists: error, ignore (INSERT IGNORE), update (ON DUPLICATE KEY UPDATE) or replace (REPLACE INTO)")
+	fs.Func("conflict-columns", "comma separated key columns of the ON CONFLICT clause of -on-duplicate=update with the postgres and sqlite dialects", func(s string) error {
+		c.ConflictColumns = append(c.ConflictColumns, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.StringVar(&c.Dialect, "dialect", DialectMySQL,
+		"database the statements are built for: "+strings.Join(dialectNames(), ", ")+" (all but mysql need a build with their driver)")
+	fs.StringVar(&c.DBDriver, "db-driver", "", "database/sql driver of the connection, e.g. pgx (default the one of the -dialect)")
+	fs.Func("update-columns", "comma separated columns updated by -on-duplicate=update, all columns if not given", func(s string) error {
+		c.UpdateColumns = append(c.UpdateColumns, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.Func("map", "comma separated csvHeader=tableColumn pairs selecting the inserted CSV columns and their table columns, a header without = keeps its name", func(s string) error {
+		mappings, err := parseColumnMap(s)
+		c.ColumnMap = append(c.ColumnMap, mappings...)
+		return err
+	})
+	fs.Func("skip-columns", "comma separated CSV columns which are not inserted", func(s string) error {
+		c.SkipColumns = append(c.SkipColumns, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.Var(keyValueFlag{&c.Constants}, "constant",
+		"column=value inserts value into the table column for every row, e.g. for a column missing in the CSV, can be repeated")
+	fs.Var(keyValueFlag{&c.Generated}, "generate",
+		"column=template inserts a computed value into the table column, the template replaces every {{name}} by the CSV column name or the function "+
+			strings.Join(generateFunctions, ", ")+" (e.g. 'full_name={{first}} {{last}}' or id={{uuid}}), can be repeated")
+	fs.BoolVar(&c.Lineage, "lineage", false,
+		"insert the input file, its line, the run id and the start of the run into the columns load_file, load_line, load_id and load_time of every row")
+	fs.Func("map-file", "JSON file with the mapped \"columns\" ([{\"header\": ..., \"column\": ...}]), the \"skip\" columns and the \"constants\" ({\"column\": \"value\"})", c.loadColumnMapFile)
+	fs.StringVar(&c.DumpFailedSQL, "dump-failed-sql", "",
+		"write the statement and arguments of every failed batch to this file, ready to be pasted into a MySQL client")
+	fs.Func("mask-columns", "comma separated columns whose values are masked in the -dump-failed-sql output", func(s string) error {
+		c.MaskColumns = append(c.MaskColumns, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.Func("trim-quotes", "comma separated columns whose values get a single pair of matching surrounding quotes (\" or ') removed", func(s string) error {
+		c.TrimQuotes = append(c.TrimQuotes, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.Var(padFlag{&c.Pads}, "pad",
+		"pad the values of a column to a fixed width, given as col=len:char:side (char defaults to space, side to right), can be repeated")
+	fs.StringVar(&c.Preset, "preset", "", "apply the flags (and DDL) of this named preset, flags on the command line win")
+	fs.StringVar(&c.PresetsFile, "presets-file", "", "JSON file with more presets, an object of {description, args, ddl} by name")
+	fs.BoolVar(&c.ListPresets, "list-presets", false, "list the available presets and exit")
+	fs.StringVar(&c.ConfigFile, "config", "", "YAML (or JSON) file with flags by name and named profiles of flags, the environment and the command line win")
+	fs.StringVar(&c.Profile, "profile", "", "apply the flags of this profile of the -config file over the ones of the file")
+	if expand {
+		args = slices.Concat(envArgs(fs), args)
+	}
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	c.CsvFiles, c.args = fs.Args(), args
+	if expand && (c.ConfigFile != "" || c.Preset != "") {
+		return c.expand(args)
+	}
+	if err := c.Validate(); err != nil {
+		return c, err
+	}
+	if expand {
+		return c, c.validatePlan()
+	}
+	return c, nil
+}
+
+// Validate checks the config for invalid values and normalizes them where possible
+func (c *Config) Validate() error {
+	if c.Comment != 0 && c.Comment == c.Delimiter {
+		return fmt.Errorf("-comment and -delimiter must differ")
+	}
+	inputs, err := expandGlobs(c.Inputs())
+	if err != nil {
+		return err
+	}
+	if len(c.CsvFiles) > 0 || len(inputs) > 1 {
+		c.CsvFiles = inputs
+	}
+	if n := slices.Index(c.Inputs(), "-"); n >= 0 && slices.Index(c.Inputs()[n+1:], "-") >= 0 {
+		return fmt.Errorf("stdin (-) can only be read once")
+	}
+	if c.Workers < 1 {
+		return fmt.Errorf("invalid workers %d, must be at least 1", c.Workers)
+	}
+	if c.Profile != "" && c.ConfigFile == "" {
+		return fmt.Errorf("-profile requires -config")
+	}
+	if c.MaxOpenConns < 0 {
+		return fmt.Errorf("invalid max-open-conns %d, must not be negative", c.MaxOpenConns)
+	}
+	if c.MaxOpenConns > 0 && c.MaxOpenConns < c.Workers {
+		return fmt.Errorf("invalid max-open-conns %d, every one of the %d workers needs a connection", c.MaxOpenConns, c.Workers)
+	}
+	if c.MaxIdleConns < 0 {
+		return fmt.Errorf("invalid max-idle-conns %d, must not be negative", c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime < 0 {
+		return fmt.Errorf("invalid conn-max-lifetime %s, must not be negative", c.ConnMaxLifetime)
+	}
+	if c.CommitEvery < 0 {
+		return fmt.Errorf("invalid commit-every %d, must not be negative", c.CommitEvery)
+	}
+	if c.CommitEvery > 0 && (c.BatchTransactions || c.IdempotencyTable != "") {
+		return fmt.Errorf("-commit-every can't be combined with -batch-transactions or -idempotency-table, which commit every batch")
+	}
+	if c.MaxLines < 0 {
+		return fmt.Errorf("invalid max-lines %d, must not be negative", c.MaxLines)
+	}
+	if c.SkipFirst < 0 {
+		return fmt.Errorf("invalid skip-rows %d, must not be negative", c.SkipFirst)
+	}
+	if c.SkipFirst > 0 && (c.ResumeFromLine > 0 || c.Resume) {
+		return fmt.Errorf("-skip-rows can't be combined with -resume-from-line or -resume")
+	}
+	if c.SampleSeed != 0 && c.Sample == 0 {
+		return fmt.Errorf("-sample-seed requires -sample")
+	}
+	if c.DBSocket != "" && (c.DBHost != "" || c.DBPort != "") {
+		return fmt.Errorf("-db-socket can't be combined with -db-host or -db-port")
+	}
+	if c.DBPort != "" {
+		if port, err := strconv.Atoi(c.DBPort); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid db-port '%s', must be a port number", c.DBPort)
+		}
+	}
+	if c.ExportChunk < 1 {
+		return fmt.Errorf("invalid export-chunk %d, must be at least 1", c.ExportChunk)
+	}
+	if c.ExportPartRows < 0 {
+		return fmt.Errorf("invalid export-part-rows %d, must not be negative", c.ExportPartRows)
+	}
+	if c.ExportPartRows > 0 && c.ExportFile == "-" {
+		return fmt.Errorf("-export-part-rows can't be combined with -export-file -, stdout is a single file")
+	}
+	if c.BatchSize < 1 {
+		return fmt.Errorf("invalid batch-size %d, must be at least 1", c.BatchSize)
+	}
+	if c.AdaptiveBatch && c.MaxBatchSize < c.BatchSize {
+		return fmt.Errorf("invalid max-batch-size %d, must be at least the batch-size %d", c.MaxBatchSize, c.BatchSize)
+	}
+	if c.AdaptiveBatch && c.TargetBatchLatency <= 0 {
+		return fmt.Errorf("invalid target-batch-latency %s, must be positive", c.TargetBatchLatency)
+	}
+	if err := c.validateAutoTune(); err != nil {
+		return err
+	}
+	if c.AdaptiveBatch && c.IdempotencyTable != "" {
+		return fmt.Errorf("-adaptive-batch can't be combined with -idempotency-table, whose batch keys need a fixed batch size")
+	}
+	if c.BufferSize < 0 {
+		return fmt.Errorf("invalid buffer %d, must not be negative", c.BufferSize)
+	}
+	for _, part := range strings.Split(c.Table, ".") {
+		if !identifierPattern.MatchString(part) {
+			return fmt.Errorf("invalid table '%s', must be a table name optionally qualified by its schema", c.Table)
+		}
+	}
+	if c.Isolation != "" {
+		level, err := normalizeIsolationLevel(c.Isolation)
+		if err != nil {
+			return err
+		}
+		c.Isolation = level
+	}
+	for _, stmt := range c.InitSQL {
+		if strings.TrimSpace(stmt) == "" {
+			return fmt.Errorf("empty -init-sql statement")
+		}
+	}
+	if err := c.validateHooks(); err != nil {
+		return err
+	}
+	if c.Charset != "" && !charsetPattern.MatchString(c.Charset) {
+		return fmt.Errorf("invalid charset '%s'", c.Charset)
+	}
+	if c.Collation != "" {
+		if !charsetPattern.MatchString(c.Collation) {
+			return fmt.Errorf("invalid collation '%s'", c.Collation)
+		}
+		if c.Charset != "" && !strings.HasPrefix(strings.ToLower(c.Collation), strings.ToLower(c.Charset)+"_") {
+			return fmt.Errorf("collation %s doesn't belong to charset %s", c.Collation, c.Charset)
+		}
+	}
+	if len(c.ColumnTypes) > 0 && !c.CreateTable {
+		return fmt.Errorf("-column-types requires -create-table")
+	}
+	if c.InferTypes < 0 {
+		return fmt.Errorf("invalid infer-types %d, must not be negative", c.InferTypes)
+	}
+	if c.InferTypes > 0 && !c.CreateTable {
+		return fmt.Errorf("-infer-types requires -create-table")
+	}
+	if c.Truncate && (c.Resume || c.CheckpointFile != "" || c.ResumeFromLine > 0) {
+		// the rows skipped on resume were imported into the table which gets truncated
+		return fmt.Errorf("-truncate can't be combined with resuming (-resume, -resume-from-line, -checkpoint-file)")
+	}
+	for column, t := range c.ColumnTypes {
+		if !columnTypePattern.MatchString(strings.TrimSpace(t)) {
+			return fmt.Errorf("invalid column type '%s' for column %s", t, column)
+		}
+	}
+	if err := c.checkRules(); err != nil {
+		return err
+	}
+	for column, spec := range c.Transforms {
+		if _, err := pipeline(spec); err != nil {
+			return fmt.Errorf("invalid -transform of column %s: %w", column, err)
+		}
+	}
+	if err := c.validateGeometry(); err != nil {
+		return err
+	}
+	if err := c.validateBench(); err != nil {
+		return err
+	}
+	if err := c.validateOrdered(); err != nil {
+		return err
+	}
+	for column, expr := range c.ValueExprs {
+		if n := strings.Count(expr, "?"); n != 1 {
+			return fmt.Errorf("invalid value expression '%s' for column %s, needs exactly one ? but has %d", expr, column, n)
+		}
+	}
+	if c.PostImportSQL != "" {
+		var err error
+		if c.postImportQuery, c.postImportVars, err = parsePostImport(c.PostImportSQL); err != nil {
+			return err
+		}
+	}
+	if err := c.resolveIDMappings(); err != nil {
+		return err
+	}
+	if err := c.validateLookups(); err != nil {
+		return err
+	}
+	if (c.StagingTable == "") != (c.TransformSQL == "") {
+		return fmt.Errorf("-staging-table and -transform-sql have to be given together")
+	}
+	if c.DropStaging && c.StagingTable == "" {
+		return fmt.Errorf("-drop-staging requires -staging-table")
+	}
+	if c.ResumeFromLine < 0 {
+		return fmt.Errorf("invalid resume-from-line %d, must not be negative", c.ResumeFromLine)
+	}
+	if c.Resume && c.ResumeFromLine > 0 {
+		return fmt.Errorf("-resume and -resume-from-line can't be combined")
+	}
+	if c.Resume && c.CheckpointFile == "" {
+		if c.Inputs()[0] == "-" {
+			return fmt.Errorf("-resume of stdin requires -checkpoint-file")
+		}
+		if _, ok := urlScheme(c.Inputs()[0]); ok {
+			return fmt.Errorf("-resume of a URL requires -checkpoint-file")
+		}
+		c.CheckpointFile = strings.TrimSuffix(c.Inputs()[0], "/") + ".checkpoint"
+	}
+	if c.BatchPlaceholders < 0 || c.BatchPlaceholders > maxPlaceholders {
+		return fmt.Errorf("invalid batch-placeholders %d, must be between 0 and %d", c.BatchPlaceholders, maxPlaceholders)
+	}
+	if c.SyncDelete && len(c.SyncKey) == 0 {
+		return fmt.Errorf("-sync-delete requires -sync-key")
+	}
+	// the token is made for the MySQL driver, which calls back for every connection
+	if c.IAMAuth && c.DBDriver != "" {
+		return fmt.Errorf("-iam-auth can't be combined with -db-driver")
+	}
+	if c.DedupeMaxKeys < 0 {
+		return fmt.Errorf("invalid dedupe-max-keys %d, must not be negative", c.DedupeMaxKeys)
+	}
+	if !slices.Contains(dedupeModes, c.DedupeMode) {
+		return fmt.Errorf("invalid dedupe-mode '%s', allowed are: %s", c.DedupeMode, strings.Join(dedupeModes, ", "))
+	}
+	if c.DedupeMode == DedupeBloom && c.DedupeMaxKeys == 0 {
+		return fmt.Errorf("-dedupe-mode bloom requires -dedupe-max-keys, the filter is sized for it")
+	}
+	if c.DedupeFalsePositiveRate <= 0 || c.DedupeFalsePositiveRate >= 1 {
+		return fmt.Errorf("invalid dedupe-false-positive-rate %g, must be between 0 and 1", c.DedupeFalsePositiveRate)
+	}
+	if c.Explain < 0 {
+		return fmt.Errorf("invalid explain %d, must not be negative", c.Explain)
+	}
+	if c.BehindThreshold < 0 {
+		return fmt.Errorf("invalid behind-threshold %s, must not be negative", c.BehindThreshold)
+	}
+	if c.FlushInterval <= 0 {
+		return fmt.Errorf("invalid flush-interval %s, must be positive", c.FlushInterval)
+	}
+	if c.MinFlushRows < 0 || (c.BatchPlaceholders == 0 && c.MinFlushRows > c.BatchSize) {
+		return fmt.Errorf("invalid min-flush-rows %d, must be between 0 and %d", c.MinFlushRows, c.BatchSize)
+	}
+	if c.MaxFlushLatency < 0 {
+		return fmt.Errorf("invalid max-flush-latency %s, must not be negative", c.MaxFlushLatency)
+	}
+	if c.ShutdownGrace < 0 {
+		return fmt.Errorf("invalid shutdown-grace %s, must not be negative", c.ShutdownGrace)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s, must not be negative", c.Timeout)
+	}
+	if c.BatchTimeout < 0 {
+		return fmt.Errorf("invalid batch-timeout %s, must not be negative", c.BatchTimeout)
+	}
+	if c.MinSuccessRatio < 0 || c.MinSuccessRatio > 1 {
+		return fmt.Errorf("invalid min-success-ratio %g, must be between 0 and 1", c.MinSuccessRatio)
+	}
+	if c.MaxConnectionErrors < 1 {
+		return fmt.Errorf("invalid max-connection-errors %d, must be at least 1", c.MaxConnectionErrors)
+	}
+	if c.TableTemplate != "" && c.StagingTable != "" {
+		return fmt.Errorf("-table-template can't be combined with -staging-table")
+	}
+	if err := c.validateRoutes(); err != nil {
+		return err
+	}
+	if err := c.validateCoerce(); err != nil {
+		return err
+	}
+	if err := c.validateSwap(); err != nil {
+		return err
+	}
+	if err := c.validateShards(); err != nil {
+		return err
+	}
+	if err := c.validateWatch(); err != nil {
+		return err
+	}
+	if (c.VerifyWhere != "" || c.VerifySum != "") && !c.Verify {
+		return fmt.Errorf("-verify-where and -verify-sum require -verify")
+	}
+	if c.Verify && c.TableTemplate != "" {
+		return fmt.Errorf("-verify can't be combined with -table-template, the rows are inserted into several tables")
+	}
+	if c.MaxErrorPct < 0 || c.MaxErrorPct > 100 {
+		return fmt.Errorf("invalid max-error-pct %g, must be between 0 and 100", c.MaxErrorPct)
+	}
+	if c.MaxErrors < 0 {
+		return fmt.Errorf("invalid max-errors %d, must not be negative", c.MaxErrors)
+	}
+	if c.StopAfterErrorsPerFile < 0 {
+		return fmt.Errorf("invalid stop-after-errors-per-file %d, must not be negative", c.StopAfterErrorsPerFile)
+	}
+	if c.ThrottleIncrease <= 0 {
+		return fmt.Errorf("invalid throttle-increase %g, must be positive", c.ThrottleIncrease)
+	}
+	if c.ThrottleDecrease <= 0 || c.ThrottleDecrease >= 1 {
+		return fmt.Errorf("invalid throttle-decrease %g, must be between 0 and 1", c.ThrottleDecrease)
+	}
+	if err := c.validateInputEncoding(); err != nil {
+		return err
+	}
+	if !slices.Contains(inputFormats, c.InputFormat) {
+		return fmt.Errorf("invalid input-format '%s', allowed are: %s", c.InputFormat, strings.Join(inputFormats, ", "))
+	}
+	if err := c.validateXLSX(); err != nil {
+		return err
+	}
+	if c.InputFormat != InputFormatCSV && (c.Comment != 0 || c.Delimiter != ',' && c.Delimiter != 0 || c.LazyQuotes ||
+		c.Quote == QuoteNone || c.TrimLeadingSpace) {
+		return fmt.Errorf("-comment, -delimiter, -lazy-quotes, -quote and -trim-leading-space only apply to -input-format csv")
+	}
+	if c.Quote != `"` && c.Quote != QuoteNone && c.Quote != "" {
+		return fmt.Errorf("invalid quote '%s', allowed are \" and %s", c.Quote, QuoteNone)
+	}
+	if c.Quote == QuoteNone && c.LazyQuotes {
+		return fmt.Errorf("-lazy-quotes has no effect with -quote %s", QuoteNone)
+	}
+	if c.ParseWorkers < 0 {
+		return fmt.Errorf("invalid parse-workers %d, must not be negative", c.ParseWorkers)
+	}
+	if c.ParseWorkers > 1 && (c.InputFormat != InputFormatCSV || c.Quote == QuoteNone || c.LazyQuotes) {
+		return fmt.Errorf("-parse-workers requires -input-format csv with strict quotes, it can't be combined with -quote %s or -lazy-quotes", QuoteNone)
+	}
+	if err := c.validateReadRanges(); err != nil {
+		return err
+	}
+	if !slices.Contains(importModes, c.Mode) {
+		return fmt.Errorf("invalid mode '%s', allowed are: %s", c.Mode, strings.Join(importModes, ", "))
+	}
+	if c.LoadDataChunk < 0 {
+		return fmt.Errorf("invalid load-data-chunk %d, must not be negative", c.LoadDataChunk)
+	}
+	if c.LoadDataChunk > 0 && c.Mode != ModeLoadData {
+		return fmt.Errorf("-load-data-chunk requires -mode load-data")
+	}
+	if !slices.Contains(logFormats, c.LogFormat) {
+		return fmt.Errorf("invalid log-format '%s', allowed are: %s", c.LogFormat, strings.Join(logFormats, ", "))
+	}
+	if !slices.Contains(progressModes, c.Progress) {
+		return fmt.Errorf("invalid progress '%s', allowed are: %s", c.Progress, strings.Join(progressModes, ", "))
+	}
+	if c.ProgressInterval < 0 {
+		return fmt.Errorf("invalid progress-interval %s, must not be negative", c.ProgressInterval)
+	}
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid log-level '%s': %w", c.LogLevel, err)
+	}
+	if c.LogMaxSize < 0 {
+		return fmt.Errorf("invalid log-max-size %d, must not be negative", c.LogMaxSize)
+	}
+	if c.LogMaxFiles < 0 {
+		return fmt.Errorf("invalid log-max-files %d, must not be negative", c.LogMaxFiles)
+	}
+	if c.Rate < 0 {
+		return fmt.Errorf("invalid rate %g, must not be negative", c.Rate)
+	}
+	if c.MaxBatchesPerSec < 0 {
+		return fmt.Errorf("invalid max-batches-per-sec %g, must not be negative", c.MaxBatchesPerSec)
+	}
+	if c.RateBurst < 1 {
+		return fmt.Errorf("invalid rate-burst %d, must be at least 1", c.RateBurst)
+	}
+	if c.MaxReconnects < 0 {
+		return fmt.Errorf("invalid max-reconnects %d, must not be negative", c.MaxReconnects)
+	}
+	if c.HealthCheckIdle < 0 {
+		return fmt.Errorf("invalid health-check-idle %s, must not be negative", c.HealthCheckIdle)
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("invalid max-retries %d, must not be negative", c.MaxRetries)
+	}
+	if err := c.Backoff.Validate(); err != nil {
+		return err
+	}
+	if c.SlowBatchThreshold < 0 {
+		return fmt.Errorf("invalid slow-batch-threshold %s, must not be negative", c.SlowBatchThreshold)
+	}
+	return nil
+}
+
+// expand parses the flags of the -preset and the -config file followed by args, the ones of the environment and the
+// command line
+func (c *Config) expand(args []string) (Config, error) {
+	var file []string
+	var tables [][]string
+	if c.ConfigFile != "" {
+		var err error
+		if file, tables, err = loadConfigFile(c.ConfigFile, c.Profile); err != nil {
+			return *c, err
+		}
+	}
+	parsed, err := c.expandPreset(file, args)
+	if err != nil {
+		return parsed, err
+	}
+	// a table overrides the flags of the file, the environment and the command line still win
+	for i, table := range tables {
+		t, err := c.expandPreset(slices.Concat(file, table), args)
+		if err != nil {
+			return parsed, fmt.Errorf("table %d of config file %s: %w", i+1, c.ConfigFile, err)
+		}
+		parsed.Tables = append(parsed.Tables, t)
+	}
+	return parsed, parsed.validatePlan()
+}
+
+// expandPreset parses the flags of the -preset followed by the ones of the config file file and args
+func (c *Config) expandPreset(file []string, args []string) (Config, error) {
+	args = slices.Concat(file, args)
+	name := cmp.Or(c.Preset, lastFlag(file, "preset"))
+	if name == "" {
+		return parseFlags(args, false)
+	}
+	presets, err := LoadPresets(cmp.Or(c.PresetsFile, lastFlag(file, "presets-file")))
+	if err != nil {
+		return *c, err
+	}
+	preset, ok := presets[name]
+	if !ok {
+		return *c, fmt.Errorf("unknown preset '%s', available presets are: %s", name, strings.Join(presetNames(presets), ", "))
+	}
+	for _, arg := range preset.Args {
+		if flagName := strings.TrimLeft(strings.SplitN(arg, "=", 2)[0], "-"); slices.Contains([]string{"preset", "presets-file", "config", "profile"}, flagName) {
+			return *c, fmt.Errorf("invalid preset '%s', presets can't use -%s", name, flagName)
+		}
+	}
+	parsed, err := parseFlags(slices.Concat(preset.Args, args), false)
+	parsed.presetDDL = preset.DDL
+	return parsed, err
+}
+
+// lastFlag returns the value of the last -name=value of args
+func lastFlag(args []string, name string) string {
+	value := ""
+	for _, arg := range args {
+		if v, ok := strings.CutPrefix(arg, "-"+name+"="); ok {
+			value = v
+		}
+	}
+	return value
+}
+
+// Args returns the flags the config was parsed from, the ones of the -preset, the -config file and the environment
+// followed by the command line
+func (c *Config) Args() []string {
+	return c.args
+}
+
+// sumIndexes returns the indexes of the columns summed up for the post import statement
+func (c *Config) sumIndexes() []int {
+	var indexes []int
+	for _, v := range c.postImportVars {
+		if v.name == "sum" {
+			indexes = append(indexes, v.index)
+		}
+	}
+	if c.VerifySum != "" {
+		indexes = append(indexes, c.verifySumIndex)
+	}
+	return indexes
+}
+
+// validateLookups checks the lookup statements and that the miss policy has what it needs
+func (c *Config) validateLookups() error {
+	if !slices.Contains(lookupMissPolicies, c.LookupMiss) {
+		return fmt.Errorf("invalid lookup-miss '%s', allowed are: %s", c.LookupMiss, strings.Join(lookupMissPolicies, ", "))
+	}
+	for column, query := range c.Lookups {
+		if n := strings.Count(query, "?"); n != 1 {
+			return fmt.Errorf("invalid lookup '%s' for column %s, needs exactly one ? but has %d", query, column, n)
+		}
+		if _, ok := c.LookupInserts[column]; !ok && c.LookupMiss == LookupMissInsertRef {
+			return fmt.Errorf("-lookup-miss=insert-ref requires a -lookup-insert for column %s", column)
+		}
+	}
+	for column, insert := range c.LookupInserts {
+		if _, ok := c.Lookups[column]; !ok {
+			return fmt.Errorf("-lookup-insert for column %s without a -lookup", column)
+		}
+		if n := strings.Count(insert, "?"); n != 1 {
+			return fmt.Errorf("invalid lookup insert '%s' for column %s, needs exactly one ? but has %d", insert, column, n)
+		}
+	}
+	if !slices.Contains(onDuplicateModes, c.OnDuplicate) {
+		return fmt.Errorf("invalid on-duplicate '%s', allowed are: %s", c.OnDuplicate, strings.Join(onDuplicateModes, ", "))
+	}
+	columns := map[string]bool{}
+	for _, m := range c.ColumnMap {
+		if columns[m.Column] {
+			return fmt.Errorf("-map inserts two CSV columns into column %s", m.Column)
+		}
+		columns[m.Column] = true
+	}
+	if len(c.UpdateColumns) > 0 && c.OnDuplicate != OnDuplicateUpdate {
+		return fmt.Errorf("-update-columns requires -on-duplicate=update")
+	}
+	if err := c.checkDialect(); err != nil {
+		return err
+	}
+	if c.SplitFailedBatches && c.DeadLetterFile == "" {
+		return fmt.Errorf("-split-failed-batches requires -dead-letter-file")
+	}
+	if c.DeadLetterFailedBatches && c.DeadLetterFile == "" {
+		return fmt.Errorf("-dead-letter-failed-batches requires -dead-letter-file")
+	}
+	if len(c.Lookups) > 0 && c.LookupMiss == LookupMissDeadLetter && c.DeadLetterFile == "" {
+		return fmt.Errorf("-lookup-miss=deadletter requires -dead-letter-file")
+	}
+	if c.DryRun {
+		// lookups and table rotation need the database, a checkpoint would skip rows which were never written
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{{"lookup", len(c.Lookups) > 0}, {"table-template", c.TableTemplate != ""}, {"resume", c.Resume}, {"checkpoint-file", c.CheckpointFile != ""}, {"verify", c.Verify}} {
+			if f.set {
+				return fmt.Errorf("-dry-run can't be combined with -%s", f.name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateWatch checks the options of -watch-dir and fills in the default directories
+func (c *Config) validateWatch() error {
+	if c.WatchDir == "" {
+		if c.ProcessedDir != "" || c.FailedDir != "" {
+			return fmt.Errorf("-processed-dir and -failed-dir require -watch-dir")
+		}
+		return nil
+	}
+	if c.WatchInterval <= 0 {
+		return fmt.Errorf("invalid watch-interval %s, must be positive", c.WatchInterval)
+	}
+	// every file is a run of its own, a checkpoint of one file would skip the rows of the next
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"dry-run", c.DryRun}, {"resume", c.Resume}, {"resume-from-line", c.ResumeFromLine > 0}, {"skip-rows", c.SkipFirst > 0}, {"checkpoint-file", c.CheckpointFile != ""}} {
+		if f.set {
+			return fmt.Errorf("-watch-dir can't be combined with -%s", f.name)
+		}
+	}
+	if len(c.CsvFiles) > 0 {
+		return fmt.Errorf("-watch-dir can't be combined with inputs, the files are taken from the directory")
+	}
+	c.ProcessedDir = cmp.Or(c.ProcessedDir, filepath.Join(c.WatchDir, "processed"))
+	c.FailedDir = cmp.Or(c.FailedDir, filepath.Join(c.WatchDir, "failed"))
+	return nil
+}
+
+// expandGlobs replaces the inputs which are glob patterns (part-*.csv) by the files matching them in name order,
+// so a pattern works without a shell expanding it. An existing file, stdin and a URL are kept as they are.
+func expandGlobs(inputs []string) ([]string, error) {
+	var expanded []string
+	for _, input := range inputs {
+		if _, isURL := urlScheme(input); isURL || !strings.ContainsAny(input, "*?[") {
+			expanded = append(expanded, input)
+			continue
+		}
+		if _, err := os.Stat(input); err == nil {
+			expanded = append(expanded, input)
+			continue
+		}
+		matches, err := filepath.Glob(input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input pattern %s: %w", input, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no input matches %s", input)
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// Inputs returns the inputs to import in order: the files after the flags, -csv if there are none
+func (c *Config) Inputs() []string {
+	if len(c.CsvFiles) > 0 {
+		return c.CsvFiles
+	}
+	return []string{c.CsvFile}
+}
+
+// InsertTable returns the table the workers insert into
+func (c *Config) InsertTable() string {
+	if c.StagingTable != "" {
+		return c.StagingTable
+	}
+	if c.Swap {
+		return c.Table + swapStagingSuffix
+	}
+	return c.Table
+}
+
+// ResolveColumns looks up all columns referenced by per-column options in the CSV headers
+func (c *Config) ResolveColumns(headers []string) error {
+	c.trimQuotesIndexes = nil
+	for _, column := range c.TrimQuotes {
+		index, err := columnIndex(headers, column)
+		if err != nil {
+			return err
+		}
+		c.trimQuotesIndexes = append(c.trimQuotesIndexes, index)
+	}
+	if len(c.SkipColumns) > 0 {
+		if err := c.resolveSkipColumns(headers); err != nil {
+			return err
+		}
+	}
+	c.mapIndexes = nil
+	for _, m := range c.ColumnMap {
+		index, err := columnIndex(headers, m.Header)
+		if err != nil {
+			return err
+		}
+		c.mapIndexes = append(c.mapIndexes, index)
+	}
+	c.transforms = nil
+	for column, spec := range c.Transforms {
+		index, err := columnIndex(headers, column)
+		if err != nil {
+			return err
+		}
+		fn, err := pipeline(spec)
+		if err != nil {
+			return err
+		}
+		binary := slices.Contains(binaryDecoders, lastTransformer(spec))
+		c.transforms = append(c.transforms, columnTransform{index: index, column: column, fn: fn, binary: binary})
+	}
+	// the first column failing to convert is reported, in the order of the row
+	sort.Slice(c.transforms, func(i, j int) bool { return c.transforms[i].index < c.transforms[j].index })
+	c.constantValues = nil
+	for _, column := range c.constantColumns() {
+		if len(c.ColumnMap) > 0 && slices.ContainsFunc(c.ColumnMap, func(m ColumnMapping) bool { return m.Column == column }) ||
+			len(c.ColumnMap) == 0 && slices.Contains(headers, column) {
+			return fmt.Errorf("column %s gets a -constant and a CSV column", column)
+		}
+		c.constantValues = append(c.constantValues, c.Constants[column])
+	}
+	if err := c.resolveGenerated(headers); err != nil {
+		return err
+	}
+	// the expressions and the updated columns are part of the statement, so they name table columns
+	columns := c.InsertColumns(headers)
+	if err := c.checkIdentifiers(c.InsertTable(), columns); err != nil {
+		return err
+	}
+	c.insertTransforms = nil
+	if len(c.transforms) > 0 {
+		c.insertTransforms = make([]Transformer, len(columns))
+		for _, t := range c.transforms {
+			for i := range columns {
+				if i < len(c.mapIndexes) && c.mapIndexes[i] == t.index || len(c.mapIndexes) == 0 && i == t.index {
+					c.insertTransforms[i] = t.fn
+				}
+			}
+		}
+	}
+	c.resolveNulls(headers, columns)
+	if err := c.resolveValidations(headers); err != nil {
+		return err
+	}
+	for column := range c.ColumnTypes {
+		if _, err := columnIndex(columns, column); err != nil {
+			return err
+		}
+	}
+	for column := range c.ValueExprs {
+		if _, err := columnIndex(columns, column); err != nil {
+			return err
+		}
+	}
+	for _, column := range slices.Concat(c.UpdateColumns, c.ConflictColumns) {
+		if _, err := columnIndex(columns, column); err != nil {
+			return err
+		}
+	}
+	if c.PartitionBy != "" {
+		index, err := columnIndex(headers, c.PartitionBy)
+		if err != nil {
+			return err
+		}
+		c.partitionIndex = index
+	}
+	if c.ShardBy != "" {
+		index, err := columnIndex(headers, c.ShardBy)
+		if err != nil {
+			return err
+		}
+		c.shardIndex = index
+	}
+	if err := c.resolveRoutes(headers, columns); err != nil {
+		return err
+	}
+	c.dedupeIndexes = nil
+	for _, column := range c.DedupeOn {
+		index, err := columnIndex(headers, column)
+		if err != nil {
+			return err
+		}
+		c.dedupeIndexes = append(c.dedupeIndexes, index)
+	}
+	if c.VerifySum != "" {
+		index, err := columnIndex(headers, c.VerifySum)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(c.InsertColumns(headers), c.verifySumColumn()) {
+			return fmt.Errorf("-verify-sum column %s isn't inserted", c.VerifySum)
+		}
+		c.verifySumIndex = index
+	}
+	for i, v := range c.postImportVars {
+		if v.column == "" {
+			continue
+		}
+		index, err := columnIndex(headers, v.column)
+		if err != nil {
+			return err
+		}
+		c.postImportVars[i].index = index
+	}
+	for i := range c.Pads {
+		index, err := columnIndex(headers, c.Pads[i].Column)
+		if err != nil {
+			return err
+		}
+		c.Pads[i].index = index
+	}
+	return nil
+}
+
+// columnIndex returns the index of column in headers
+func columnIndex(headers []string, column string) (int, error) {
+	for i, h := range headers {
+		if h == column {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("unknown column '%s', available columns are: %s", column, strings.Join(headers, ", "))
+}
+
+// SkipRows returns the number of data rows to skip before the import starts
+func (c *Config) SkipRows() int {
+	if c.SkipFirst > 0 {
+		return c.SkipFirst
+	}
+	if c.ResumeFromLine > 1 {
+		return c.ResumeFromLine - 1
+	}
+	return 0
+}
+
+// singleRune returns the only character of s, which must not be a line break or the CSV quote
+func singleRune(s string) (rune, error) {
+	runes := []rune(s)
+	if len(runes) != 1 {
+		return 0, fmt.Errorf("'%s' must be a single character", s)
+	}
+	if r := runes[0]; r == '\r' || r == '\n' || r == '"' || r == ',' || r == utf8.RuneError {
+		return 0, fmt.Errorf("'%s' is not allowed", s)
+	}
+	return runes[0], nil
+}
+
+// delimiterRune parses the field delimiter, \t (or a literal tab) is tab
+func delimiterRune(s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+	runes := []rune(s)
+	if len(runes) != 1 {
+		return 0, fmt.Errorf("'%s' must be a single character", s)
+	}
+	if r := runes[0]; r == '\r' || r == '\n' || r == '"' || r == utf8.RuneError {
+		return 0, fmt.Errorf("'%s' is not allowed as delimiter", s)
+	}
+	return runes[0], nil
+}
+
+// normalizeIsolationLevel maps e.g. "read-committed" or "READ_COMMITTED" to "READ COMMITTED"
+// and rejects anything which is not a known isolation level
+func normalizeIsolationLevel(level string) (string, error) {
+	l := strings.ToUpper(strings.TrimSpace(level))
+	l = strings.NewReplacer("-", " ", "_", " ").Replace(l)
+	l = strings.Join(strings.Fields(l), " ")
+	for _, allowed := range isolationLevels {
+		if l == allowed {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("invalid isolation level '%s', allowed are: %s", level, strings.Join(isolationLevels, ", "))
+}
+
+// keyValueFlag collects repeated key=value flags into a map
+type keyValueFlag struct {
+	values *map[string]string
+}
+
+func (f keyValueFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*f.values))
+	for k, v := range *f.values {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(value string) error {
+	k, v, found := strings.Cut(value, "=")
+	if !found || k == "" {
+		return fmt.Errorf("invalid value '%s', expected key=value", value)
+	}
+	if *f.values == nil {
+		*f.values = make(map[string]string)
+	}
+	(*f.values)[k] = v
+	return nil
+}
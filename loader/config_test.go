@@ -0,0 +1,124 @@
+package loader
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseFlagsIsolation(t *testing.T) {
+	c, err := ParseFlags([]string{"-isolation", "read-uncommitted"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.Isolation, "READ UNCOMMITTED")
+
+	c, err = ParseFlags([]string{"-isolation=REPEATABLE_READ"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.Isolation, "REPEATABLE READ")
+
+	c, err = ParseFlags([]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, c.Isolation, "", "no isolation level should keep the server default")
+}
+
+func TestParseFlagsInvalidIsolation(t *testing.T) {
+	_, err := ParseFlags([]string{"-isolation", "READ COMMITTED; DROP TABLE domain"})
+	assert.ErrorContains(t, err, "invalid isolation level")
+}
+
+func TestResumeFromLine(t *testing.T) {
+	c, err := ParseFlags([]string{"-resume-from-line=1800001"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.SkipRows(), 1800000)
+
+	c, err = ParseFlags([]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, c.SkipRows(), 0)
+
+	_, err = ParseFlags([]string{"-resume-from-line=-3"})
+	assert.ErrorContains(t, err, "must not be negative")
+}
+
+func TestResolvePartitionBy(t *testing.T) {
+	c, err := ParseFlags([]string{"-partition-by-worker", "Domain"})
+	assert.NilError(t, err)
+	assert.NilError(t, c.ResolveColumns([]string{"GlobalRank", "Domain"}))
+	assert.Equal(t, c.partitionIndex, 1)
+
+	c, err = ParseFlags([]string{"-partition-by-worker", "Missing"})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.ResolveColumns([]string{"GlobalRank", "Domain"}), "unknown column 'Missing'")
+}
+
+func TestStagingFlags(t *testing.T) {
+	c, err := ParseFlags([]string{"-staging-table", "domain_staging", "-transform-sql", "INSERT INTO domain SELECT * FROM domain_staging"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.InsertTable(), "domain_staging")
+
+	c, err = ParseFlags([]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, c.InsertTable(), TableName)
+
+	_, err = ParseFlags([]string{"-staging-table", "domain_staging"})
+	assert.ErrorContains(t, err, "have to be given together")
+	_, err = ParseFlags([]string{"-drop-staging"})
+	assert.ErrorContains(t, err, "requires -staging-table")
+}
+
+func TestMinSuccessRatio(t *testing.T) {
+	c, err := ParseFlags([]string{"-min-success-ratio=0.99"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.MinSuccessRatio, 0.99)
+
+	_, err = ParseFlags([]string{"-min-success-ratio=1.5"})
+	assert.ErrorContains(t, err, "must be between 0 and 1")
+}
+
+func TestCommentFlag(t *testing.T) {
+	c, err := ParseFlags([]string{"-comment=#"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.Comment, '#')
+
+	for _, invalid := range []string{"##", "", "\n", ","} {
+		_, err = ParseFlags([]string{"-comment=" + invalid})
+		assert.Assert(t, err != nil, "comment '%s' should be invalid", invalid)
+	}
+}
+
+func TestParseFlagsInitSQL(t *testing.T) {
+	c, err := ParseFlags([]string{"-init-sql", "SET time_zone='+00:00'", "-init-sql", "SET names utf8mb4"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c.InitSQL, []string{"SET time_zone='+00:00'", "SET names utf8mb4"})
+
+	_, err = ParseFlags([]string{"-init-sql", " "})
+	assert.ErrorContains(t, err, "empty -init-sql statement")
+}
+
+func TestParseFlagsSizing(t *testing.T) {
+	c, err := ParseFlags([]string{"-table", "stats.domain", "-workers", "4", "-batch-size", "50", "-buffer", "0"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.InsertTable(), "stats.domain")
+	assert.Equal(t, c.Workers, 4)
+	assert.Equal(t, c.BatchSize, 50)
+	assert.Equal(t, c.BufferSize, 0)
+
+	c, err = ParseFlags([]string{"--file", "data.csv", "--workers", "50", "--batch-size", "64", "--max-lines", "1000"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.CsvFile, "data.csv")
+	assert.Equal(t, c.MaxLines, 1000)
+
+	_, err = ParseFlags([]string{"-workers", "0"})
+	assert.ErrorContains(t, err, "invalid workers 0, must be at least 1")
+	_, err = ParseFlags([]string{"-max-lines", "-1"})
+	assert.ErrorContains(t, err, "invalid max-lines -1")
+	_, err = ParseFlags([]string{"-db-port", "mysql"})
+	assert.ErrorContains(t, err, "invalid db-port 'mysql'")
+	_, err = ParseFlags([]string{"-batch-size", "0"})
+	assert.ErrorContains(t, err, "invalid batch-size 0, must be at least 1")
+	_, err = ParseFlags([]string{"-buffer", "-1"})
+	assert.ErrorContains(t, err, "invalid buffer -1")
+	_, err = ParseFlags([]string{"-table", "domain; DROP TABLE domain"})
+	assert.ErrorContains(t, err, "invalid table")
+	// -min-flush-rows is bounded by the batch size
+	_, err = ParseFlags([]string{"-batch-size", "4", "-min-flush-rows", "6"})
+	assert.ErrorContains(t, err, "invalid min-flush-rows 6, must be between 0 and 4")
+}
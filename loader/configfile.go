@@ -0,0 +1,153 @@
+package loader
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is put in front of the flag names to get the environment variables setting them, -batch-size is
+// GO_MYSQL_WORKER_BATCH_SIZE
+const envPrefix = "GO_MYSQL_WORKER_"
+
+// configFileFlags can't be set by a config file or a profile, they select it
+var configFileFlags = []string{"config", "profile"}
+
+// configFile is a YAML (or JSON) file with flags by name and named profiles of flags overriding them
+type configFile struct {
+	Flags    map[string]any            `yaml:",inline"`
+	Profiles map[string]map[string]any `yaml:"profiles"`
+	// Tables are the flags of several tables loaded one after another, each overriding the flags of the file
+	Tables []map[string]any `yaml:"tables"`
+}
+
+// LoadConfigFile returns the flags set by the YAML file filename followed by the ones of its profile (if not
+// empty). A key is a flag name, a list value sets a repeatable flag once per item and a map value sets a
+// key=value flag like -constant once per key.
+func LoadConfigFile(filename string, profile string) ([]string, error) {
+	args, _, err := loadConfigFile(filename, profile)
+	return args, err
+}
+
+// loadConfigFile returns the flags of the file like LoadConfigFile and the flags of every entry of its tables
+func loadConfigFile(filename string, profile string) (args []string, tables [][]string, err error) {
+	if strings.EqualFold(filepath.Ext(filename), ".toml") {
+		return nil, nil, fmt.Errorf("config file %s: TOML isn't supported, -config reads YAML or JSON", filename)
+	}
+	data, err := os.ReadFile(expandHome(filename))
+	if err != nil {
+		return nil, nil, err
+	}
+	var f configFile
+	if err = yaml.Unmarshal(data, &f); err != nil {
+		return nil, nil, fmt.Errorf("error reading config file %s: %w", filename, err)
+	}
+	if args, err = configArgs(f.Flags); err != nil {
+		return nil, nil, fmt.Errorf("invalid config file %s: %w", filename, err)
+	}
+	for i, flags := range f.Tables {
+		table, err := configArgs(flags)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid table %d of config file %s: %w", i+1, filename, err)
+		}
+		if lastFlag(table, "table") == "" {
+			return nil, nil, fmt.Errorf("invalid table %d of config file %s: it sets no table", i+1, filename)
+		}
+		tables = append(tables, table)
+	}
+	if profile == "" {
+		return args, tables, nil
+	}
+	flags, ok := f.Profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(f.Profiles))
+		for name := range f.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, nil, fmt.Errorf("unknown profile '%s' of config file %s, available profiles are: %s", profile, filename, strings.Join(names, ", "))
+	}
+	profileArgs, err := configArgs(flags)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid profile '%s' of config file %s: %w", profile, filename, err)
+	}
+	return append(args, profileArgs...), tables, nil
+}
+
+// configArgs returns the flags of the values by flag name in name order
+func configArgs(flags map[string]any) ([]string, error) {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var args []string
+	for _, name := range names {
+		for _, reserved := range configFileFlags {
+			if name == reserved {
+				return nil, fmt.Errorf("-%s can't be set in a config file", name)
+			}
+		}
+		values, err := configValues(flags[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+		for _, v := range values {
+			args = append(args, "-"+name+"="+v)
+		}
+	}
+	return args, nil
+}
+
+// configValues returns the flag values of a YAML value
+func configValues(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, fmt.Errorf("empty value, use \"\" for an empty string")
+	case []any:
+		var values []string
+		for _, item := range v {
+			itemValues, err := configValues(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, itemValues...)
+		}
+		return values, nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if _, nested := v[key].(map[string]any); nested {
+				return nil, fmt.Errorf("nested map at %s", key)
+			}
+			if _, list := v[key].([]any); list {
+				return nil, fmt.Errorf("list at %s", key)
+			}
+			values = append(values, fmt.Sprintf("%s=%v", key, v[key]))
+		}
+		return values, nil
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
+
+// envArgs returns the flags of fs set by environment variables, in the order of the flag names
+func envArgs(fs *flag.FlagSet) []string {
+	var args []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if value, ok := os.LookupEnv(envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))); ok {
+			args = append(args, "-"+f.Name+"="+value)
+		}
+	})
+	return args
+}
@@ -0,0 +1,87 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const testConfigFile = `
+table: domain
+workers: 20
+batch-size: 500
+dry-run: true
+map: [GlobalRank=rank, Domain]
+constant: {source: majestic, imported: 2024}
+profiles:
+  staging:
+    workers: 4
+    db-host: staging-db
+`
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "go-mysql-worker.yaml")
+	assert.NilError(t, os.WriteFile(filename, []byte(content), 0o644))
+	return filename
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	filename := writeConfigFile(t, testConfigFile)
+	args, err := LoadConfigFile(filename, "staging")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, args, []string{"-batch-size=500", "-constant=imported=2024", "-constant=source=majestic", "-dry-run=true",
+		"-map=GlobalRank=rank", "-map=Domain", "-table=domain", "-workers=20", "-db-host=staging-db", "-workers=4"})
+
+	_, err = LoadConfigFile(filename, "production")
+	assert.ErrorContains(t, err, "unknown profile 'production' of config file "+filename+", available profiles are: staging")
+	_, err = LoadConfigFile(writeConfigFile(t, "profile: staging\n"), "")
+	assert.ErrorContains(t, err, "-profile can't be set in a config file")
+	_, err = LoadConfigFile(writeConfigFile(t, "table:\n"), "")
+	assert.ErrorContains(t, err, "invalid value of table: empty value")
+	_, err = LoadConfigFile("go-mysql-worker.toml", "")
+	assert.ErrorContains(t, err, "TOML isn't supported, -config reads YAML or JSON")
+}
+
+func TestParseFlagsLayers(t *testing.T) {
+	filename := writeConfigFile(t, testConfigFile)
+	c, err := ParseFlags([]string{"-config", filename})
+	assert.NilError(t, err)
+	assert.Equal(t, c.Table, "domain")
+	assert.Equal(t, c.Workers, 20)
+	assert.Equal(t, c.BatchSize, 500)
+	assert.DeepEqual(t, c.Constants, map[string]string{"source": "majestic", "imported": "2024"})
+
+	// the profile overrides the file, the environment the profile and the command line the environment
+	t.Setenv("GO_MYSQL_WORKER_WORKERS", "8")
+	t.Setenv("GO_MYSQL_WORKER_BATCH_SIZE", "100")
+	c, err = ParseFlags([]string{"-config", filename, "-profile", "staging", "-batch-size", "50"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.DBHost, "staging-db")
+	assert.Equal(t, c.Workers, 8)
+	assert.Equal(t, c.BatchSize, 50)
+
+	t.Setenv("GO_MYSQL_WORKER_PROFILE", "staging")
+	c, err = ParseFlags([]string{"-config", filename})
+	assert.NilError(t, err)
+	assert.Equal(t, c.DBHost, "staging-db")
+
+	_, err = ParseFlags([]string{"-config", filename, "-profile", "production"})
+	assert.ErrorContains(t, err, "unknown profile 'production'")
+	t.Setenv("GO_MYSQL_WORKER_PROFILE", "")
+	_, err = ParseFlags([]string{"-profile", "staging"})
+	assert.ErrorContains(t, err, "-profile requires -config")
+}
+
+func TestParseFlagsConfigFilePreset(t *testing.T) {
+	filename := writeConfigFile(t, "preset: majestic-million\ntable: ranking\n")
+	c, err := ParseFlags([]string{"-config", filename})
+	assert.NilError(t, err)
+	assert.Equal(t, c.Preset, "majestic-million")
+	assert.Equal(t, c.CsvFile, "majestic_million.csv")
+	assert.Equal(t, c.Table, "ranking")
+	assert.Assert(t, c.presetDDL != "")
+	assert.DeepEqual(t, c.Args(), []string{"-csv", "majestic_million.csv", "-preset=majestic-million", "-table=ranking", "-config", filename})
+}
@@ -0,0 +1,379 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"gotest.tools/v3/assert"
+)
+
+// idleConn is a driver connection which is never used for statements
+type idleConn struct{}
+
+func (idleConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (idleConn) Close() error                        { return nil }
+func (idleConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+// flakyConnector fails the first failures connection attempts and then hands out idle connections
+type flakyConnector struct {
+	failures int64
+	attempts atomic.Int64
+}
+
+func (c *flakyConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.attempts.Add(1) <= c.failures {
+		return nil, errors.New("dial tcp 127.0.0.1:3306: connect: connection refused")
+	}
+	return idleConn{}, nil
+}
+
+func (c *flakyConnector) Driver() driver.Driver {
+	return nil
+}
+
+func newFlakyDB(t *testing.T, failures int64) *sql.DB {
+	db := sql.OpenDB(&flakyConnector{failures: failures})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// withConnConfig returns a Loader giving up after maxErrors connection errors, retrying without a delay
+func withConnConfig(t *testing.T, maxErrors int) *Loader {
+	l := newTestLoader()
+	l.config.MaxConnectionErrors = maxErrors
+	l.config.Backoff = Backoff{Strategy: BackoffFixed, Base: time.Millisecond, Max: time.Millisecond}
+	return l
+}
+
+func TestAcquireConnRetriesTransientErrors(t *testing.T) {
+	l := withConnConfig(t, 5)
+	db := newFlakyDB(t, 2)
+
+	conn, err := l.acquireConn(context.Background(), db, 0, rand.New(rand.NewSource(1)))
+	assert.NilError(t, err)
+	conn.Close()
+	assert.Equal(t, l.connErrors.Load(), int64(2))
+}
+
+func TestAcquireConnGivesUp(t *testing.T) {
+	l := withConnConfig(t, 3)
+	db := newFlakyDB(t, 100)
+
+	_, err := l.acquireConn(context.Background(), db, 0, rand.New(rand.NewSource(1)))
+	assert.ErrorContains(t, err, "database unavailable, giving up after 3 connection errors")
+}
+
+// execConn is a driver connection executing statements without a server, when dead every statement fails like
+// on a connection the server closed and when hung it blocks until ctx is done. Like the real driver it fails when
+// ctx is done and a statement aborted by ctx invalidates the connection.
+type execConn struct {
+	idleConn
+	dead    bool
+	hung    bool
+	aborted *atomic.Bool
+	execs   *atomic.Int64
+	values  *atomic.Int64
+}
+
+func (c execConn) IsValid() bool {
+	return !c.aborted.Load()
+}
+
+func (c execConn) Ping(ctx context.Context) error {
+	if c.dead {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c execConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c.dead {
+		return nil, driver.ErrBadConn
+	}
+	if c.hung {
+		<-ctx.Done()
+	}
+	if err := ctx.Err(); err != nil {
+		c.aborted.Store(true)
+		return nil, err
+	}
+	c.execs.Add(1)
+	c.values.Add(int64(len(args)))
+	return driver.RowsAffected(len(args)), nil
+}
+
+// goneAwayConnector hands out dead (and hung) connections first and then working ones
+type goneAwayConnector struct {
+	dead     int64
+	hung     int64
+	attempts atomic.Int64
+	execs    atomic.Int64
+	values   atomic.Int64
+}
+
+func (c *goneAwayConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	n := c.attempts.Add(1)
+	return execConn{dead: n <= c.dead, hung: n <= c.hung, aborted: &atomic.Bool{}, execs: &c.execs, values: &c.values}, nil
+}
+
+func (c *goneAwayConnector) Driver() driver.Driver {
+	return nil
+}
+
+func newGoneAwaySession(t *testing.T, l *Loader, connector *goneAwayConnector) *session {
+	db := sql.OpenDB(connector)
+	t.Cleanup(func() { db.Close() })
+	sess, err := l.openSession(context.Background(), db, 0, rand.New(rand.NewSource(1)))
+	assert.NilError(t, err)
+	t.Cleanup(func() { sess.Close() })
+	return sess
+}
+
+func TestExecBatchReconnects(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.MaxReconnects = 3
+	l.rowsInserted.Store(0)
+	connector := &goneAwayConnector{dead: 2}
+	sess := newGoneAwaySession(t, l, connector)
+
+	err := l.execBatch(context.Background(), sess, "INSERT INTO domain (Domain) VALUES (?), (?)", "", []string{"a", "b"}, []int{1, 2}, nil)
+	assert.NilError(t, err)
+	// the batch succeeded on the third connection
+	assert.Equal(t, connector.attempts.Load(), int64(3))
+	assert.Equal(t, connector.execs.Load(), int64(1))
+	assert.Equal(t, l.rowsInserted.Load(), int64(2))
+}
+
+func TestExecBatchGivesUpReconnecting(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.MaxReconnects = 1
+	sess := newGoneAwaySession(t, l, &goneAwayConnector{dead: 100})
+
+	err := l.execBatch(context.Background(), sess, "INSERT INTO domain (Domain) VALUES (?)", "", []string{"a"}, []int{1}, nil)
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+}
+
+func TestExecBatchTimeout(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.BatchTimeout = 10 * time.Millisecond
+	l.config.MaxReconnects = 3
+	l.rowsInserted.Store(0)
+	connector := &goneAwayConnector{hung: 2}
+	sess := newGoneAwaySession(t, l, connector)
+
+	err := l.execBatch(context.Background(), sess, "INSERT INTO domain (Domain) VALUES (?), (?)", "", []string{"a", "b"}, []int{1, 2}, nil)
+	assert.NilError(t, err)
+	// the batch timed out on two connections and succeeded on the third
+	assert.Equal(t, connector.attempts.Load(), int64(3))
+	assert.Equal(t, l.rowsInserted.Load(), int64(2))
+
+	l.config.MaxReconnects = 0
+	sess = newGoneAwaySession(t, l, &goneAwayConnector{hung: 100})
+	err = l.execBatch(context.Background(), sess, "INSERT INTO domain (Domain) VALUES (?)", "", []string{"a"}, []int{1}, nil)
+	assert.ErrorIs(t, err, errBatchTimeout)
+	assert.ErrorContains(t, err, "batch timed out after 10ms")
+}
+
+func TestExecBatchHealthCheck(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.MaxReconnects = 0
+	l.config.HealthCheckIdle = time.Minute
+	l.rowsInserted.Store(0)
+	connector := &goneAwayConnector{dead: 1}
+	sess := newGoneAwaySession(t, l, connector)
+
+	// the connection idle for longer than -health-check-idle is pinged and replaced without using a reconnect
+	sess.used = time.Now().Add(-2 * time.Minute)
+	err := l.execBatch(context.Background(), sess, "INSERT INTO domain (Domain) VALUES (?)", "", []string{"a"}, []int{1}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, connector.attempts.Load(), int64(2))
+	assert.Equal(t, l.reconnectCount.Load(), int64(1))
+	assert.Equal(t, l.rowsInserted.Load(), int64(1))
+
+	// a recently used connection isn't pinged
+	sess = newGoneAwaySession(t, l, &goneAwayConnector{dead: 1})
+	err = l.execBatch(context.Background(), sess, "INSERT INTO domain (Domain) VALUES (?)", "", []string{"a"}, []int{1}, nil)
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+
+	_, err = ParseFlags([]string{"-health-check-idle", "-1s"})
+	assert.ErrorContains(t, err, "invalid health-check-idle -1s, must not be negative")
+}
+
+func TestBatchTimedOut(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.BatchTimeout = time.Nanosecond
+	ctx, cancel := context.WithCancel(context.Background())
+	stmtCtx, stop := l.config.batchContext(ctx)
+	defer stop()
+	<-stmtCtx.Done()
+	assert.ErrorIs(t, l.config.batchTimedOut(stmtCtx, ctx, context.DeadlineExceeded), errBatchTimeout)
+	assert.NilError(t, l.config.batchTimedOut(stmtCtx, ctx, nil))
+	// a statement aborted because the import is interrupted didn't time out
+	cancel()
+	assert.Assert(t, !errors.Is(l.config.batchTimedOut(stmtCtx, ctx, context.Canceled), errBatchTimeout))
+}
+
+func newMockSession(t *testing.T, l *Loader) (*session, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	t.Cleanup(func() { db.Close() })
+	sess, err := l.openSession(context.Background(), db, 0, rand.New(rand.NewSource(1)))
+	assert.NilError(t, err)
+	return sess, mock
+}
+
+func TestExecBatchTransaction(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.BatchTransactions = true
+	sess, mock := newMockSession(t, l)
+	query := "INSERT INTO domain (Domain) VALUES (?), (?)"
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs("a", "b").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	assert.NilError(t, l.execBatch(context.Background(), sess, query, "", []string{"a", "b"}, []int{1, 2}, nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecBatchTransactionRollback(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.BatchTransactions = true
+	l.config.MaxRetries = 1
+	sess, mock := newMockSession(t, l)
+	query := "INSERT INTO domain (Domain) VALUES (?)"
+	// a deadlock is rolled back before the retry, a duplicate isn't retried
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WillReturnError(&mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+	mock.ExpectRollback()
+
+	err := l.execBatch(context.Background(), sess, query, "", []string{"a"}, []int{1}, nil)
+	assert.ErrorContains(t, err, "Error 1062")
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestIsGoneAway(t *testing.T) {
+	assert.Assert(t, isGoneAway(driver.ErrBadConn))
+	assert.Assert(t, isGoneAway(mysql.ErrInvalidConn))
+	assert.Assert(t, isGoneAway(&mysql.MySQLError{Number: 2006, Message: "MySQL server has gone away"}))
+	assert.Assert(t, isGoneAway(&mysql.MySQLError{Number: 2013, Message: "Lost connection to MySQL server during query"}))
+	assert.Assert(t, !isGoneAway(&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}))
+	assert.Assert(t, !isGoneAway(errors.New("other")))
+}
+
+func TestOpenSessionRunsInitSQL(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.InitSQL = []string{"SET time_zone='+00:00'", "SET SESSION sql_mode='STRICT_ALL_TABLES'"}
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec("SET time_zone='+00:00'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET SESSION sql_mode='STRICT_ALL_TABLES'").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	sess, err := l.openSession(context.Background(), db, 0, rand.New(rand.NewSource(1)))
+	assert.NilError(t, err)
+	sess.Close()
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestOpenSessionSetsTimeZoneAndSQLMode(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.TimeZone = "Europe/Berlin"
+	l.config.SQLMode = "STRICT_ALL_TABLES,NO_ZERO_DATE"
+	l.config.InitSQL = []string{"SET foreign_key_checks = 0"}
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	// the settings come before the -init-sql statements, so those can still override them
+	mock.ExpectExec("SET SESSION time_zone = 'Europe/Berlin'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET SESSION sql_mode = 'STRICT_ALL_TABLES,NO_ZERO_DATE'").
+		WillReturnError(&mysql.MySQLError{Number: 1231, Message: "Variable 'sql_mode' can't be set to the value"})
+
+	_, err = l.openSession(context.Background(), db, 0, rand.New(rand.NewSource(1)))
+	assert.ErrorContains(t, err, "'SET SESSION sql_mode = 'STRICT_ALL_TABLES,NO_ZERO_DATE'' failed")
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestOpenSessionFailsOnInitSQL(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.InitSQL = []string{"SET time_zone='Mars/Olympus'"}
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec("SET time_zone='Mars/Olympus'").
+		WillReturnError(&mysql.MySQLError{Number: 1298, Message: "Unknown or incorrect time zone: 'Mars/Olympus'"})
+
+	_, err = l.openSession(context.Background(), db, 0, rand.New(rand.NewSource(1)))
+	assert.ErrorContains(t, err, "init statement 'SET time_zone='Mars/Olympus'' failed")
+}
+
+func TestWorkerPreparedStatements(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.PreparedStatements = true
+	l.config.BatchSize = 2
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	queries := l.newBatchQueries("domain", []string{"Domain"})
+	// the full batches reuse the statement prepared once, the short last batch is executed as it is
+	prepared := mock.ExpectPrepare(queries.For("")[1])
+	prepared.ExpectExec().WithArgs("a", "b").WillReturnResult(sqlmock.NewResult(0, 2))
+	prepared.ExpectExec().WithArgs("c", "d").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(queries.For("")[0]).WithArgs("e").WillReturnResult(sqlmock.NewResult(0, 1))
+	prepared.WillBeClosed()
+
+	jobs := make(chan Job, 5)
+	for i, domain := range []string{"a", "b", "c", "d", "e"} {
+		jobs <- Job{Row: i + 1, Values: []string{domain}}
+	}
+	close(jobs)
+	assert.NilError(t, l.worker(context.Background(), 0, db, jobs, queries, nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, l.rowsInserted.Load(), int64(5))
+}
+
+func TestPreparedRaggedBatches(t *testing.T) {
+	l := withConnConfig(t, 5)
+	sess, mock := newMockSession(t, l)
+	sess.preparedRows = 3
+	one := "INSERT INTO domain (Domain) VALUES (?)"
+	two := "INSERT INTO domain (Domain) VALUES (?), (?)"
+	// a smaller size is prepared when it comes again, the one of another size replaces it
+	mock.ExpectExec(two).WithArgs("a", "b").WillReturnResult(sqlmock.NewResult(0, 2))
+	prepared := mock.ExpectPrepare(two)
+	prepared.ExpectExec().WithArgs("c", "d").WillReturnResult(sqlmock.NewResult(0, 2))
+	prepared.ExpectExec().WithArgs("e", "f").WillReturnResult(sqlmock.NewResult(0, 2))
+	prepared.WillBeClosed()
+	mock.ExpectExec(one).WithArgs("g").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	for _, batch := range [][]string{{"a", "b"}, {"c", "d"}, {"e", "f"}} {
+		assert.NilError(t, l.execBatch(context.Background(), sess, two, "", batch, []int{1, 2}, nil))
+	}
+	assert.NilError(t, l.execBatch(context.Background(), sess, one, "", []string{"g"}, []int{1}, nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, len(sess.stmts), 0)
+}
+
+func TestPreparedStatementReconnect(t *testing.T) {
+	l := withConnConfig(t, 5)
+	sess, mock := newMockSession(t, l)
+	sess.preparedRows = 2
+	query := "INSERT INTO domain (Domain) VALUES (?), (?)"
+	// the statement of the lost connection is prepared again on the new one
+	mock.ExpectPrepare(query).ExpectExec().WillReturnError(mysql.ErrInvalidConn)
+	mock.ExpectPrepare(query).ExpectExec().WithArgs("a", "b").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	assert.NilError(t, l.execBatch(context.Background(), sess, query, "", []string{"a", "b"}, []int{1, 2}, nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, len(sess.stmts), 1)
+}
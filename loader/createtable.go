@@ -0,0 +1,196 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultColumnType is the type of the columns created by -create-table without a -column-types entry
+const defaultColumnType = "TEXT"
+
+// columnTypePattern matches the column types accepted by -column-types, e.g. INT, VARCHAR(255) or DECIMAL(10,2) NOT NULL
+var columnTypePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_ ]*(\([0-9, ]+\))?[A-Za-z0-9_ ]*$`)
+
+// buildCreateTable builds the CREATE TABLE IF NOT EXISTS statement of table with the given columns, all of them
+// have defaultColumnType unless types has another one for them
+func buildCreateTable(d Dialect, table string, columns []string, types map[string]string) string {
+	definitions := make([]string, len(columns))
+	for i, column := range columns {
+		definitions[i] = quoteIdentifier(d, column) + " " + defaultColumnType
+		if t, ok := types[column]; ok {
+			definitions[i] = quoteIdentifier(d, column) + " " + strings.TrimSpace(t)
+		}
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quoteTable(d, table), strings.Join(definitions, ", "))
+}
+
+// CreateTable creates table with the given columns unless it exists
+func CreateTable(ctx context.Context, db *sql.DB, d Dialect, table string, columns []string, types map[string]string) error {
+	ddl := buildCreateTable(d, table, columns, types)
+	log.Printf("Creating table %s unless it exists: %s", table, ddl)
+	if _, err := db.ExecContext(ctx, ddl); err != nil {
+		return fmt.Errorf("creating table %s failed: %w", table, err)
+	}
+	return nil
+}
+
+// TruncateTable deletes all rows of table
+func TruncateTable(ctx context.Context, db *sql.DB, d Dialect, table string) error {
+	log.Printf("Truncating table %s", table)
+	if _, err := db.ExecContext(ctx, "TRUNCATE TABLE "+quoteTable(d, table)); err != nil {
+		return fmt.Errorf("truncating table %s failed: %w", table, err)
+	}
+	return nil
+}
+
+// sampledRow is a row read ahead by sampleRows with the error of reading it
+type sampledRow struct {
+	row []string
+	err error
+}
+
+// sampleReader returns the rows sampled before the rest of the input
+type sampleReader struct {
+	RowReader
+	sampled []sampledRow
+}
+
+func (r *sampleReader) Read() ([]string, error) {
+	if len(r.sampled) > 0 {
+		s := r.sampled[0]
+		r.sampled = r.sampled[1:]
+		return s.row, s.err
+	}
+	return r.RowReader.Read()
+}
+
+// sampleRows reads up to n rows of reader ahead, it returns the rows read without error and a reader returning all
+// rows read (and their errors) again before the rest of the input
+func sampleRows(reader RowReader, n int) ([][]string, RowReader) {
+	var rows [][]string
+	sampled := &sampleReader{RowReader: reader}
+	for len(rows) < n {
+		row, err := reader.Read()
+		sampled.sampled = append(sampled.sampled, sampledRow{row: row, err: err})
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			rows = append(rows, row)
+		}
+	}
+	return rows, sampled
+}
+
+// datetimeLayouts are the layouts of the values inferred as DATETIME
+var datetimeLayouts = []string{time.DateTime, "2006-01-02T15:04:05", time.RFC3339, time.DateOnly}
+
+// maxInferredVarchar is the longest VARCHAR inferred, longer values make a TEXT column
+const maxInferredVarchar = 4096
+
+// inferColumnType returns the narrowest of INT, BIGINT, DOUBLE, DATETIME and VARCHAR all values fit into. An empty
+// value only fits a number or a DATETIME with emptyAsNull. The VARCHAR leaves room for twice the longest value
+// sampled (at least 32), as the rows after the sample may be longer.
+func inferColumnType(values []string, emptyAsNull bool) string {
+	isInt, isBigint, isDouble, isDatetime := true, true, true, true
+	longest, present := 0, 0
+	for _, v := range values {
+		longest = max(longest, utf8.RuneCountInString(v))
+		if v == "" {
+			if !emptyAsNull {
+				isInt, isBigint, isDouble, isDatetime = false, false, false, false
+			}
+			continue
+		}
+		present++
+		n, err := strconv.ParseInt(v, 10, 64)
+		isBigint = isBigint && err == nil
+		isInt = isInt && err == nil && n >= math.MinInt32 && n <= math.MaxInt32
+		_, err = strconv.ParseFloat(v, 64)
+		// ParseFloat accepts inf, nan and hex floats as well, MySQL doesn't
+		isDouble = isDouble && err == nil && strings.Trim(v, "0123456789+-.eE") == ""
+		isDatetime = isDatetime && isDatetimeValue(v)
+	}
+	switch {
+	case present == 0:
+		return defaultColumnType
+	case isInt:
+		return "INT"
+	case isBigint:
+		return "BIGINT"
+	case isDouble:
+		return "DOUBLE"
+	case isDatetime:
+		return "DATETIME"
+	}
+	size := 32
+	for size < 2*longest {
+		size *= 2
+	}
+	if size > maxInferredVarchar {
+		return defaultColumnType
+	}
+	return fmt.Sprintf("VARCHAR(%d)", size)
+}
+
+func isDatetimeValue(v string) bool {
+	for _, layout := range datetimeLayouts {
+		if _, err := time.Parse(layout, v); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// inferColumnTypes returns the types of the insert columns inferred from the sampled rows, the -column-types
+// override them. The constant columns are inferred from their value, the generated ones from their values for the
+// sampled rows.
+func (c *Config) inferColumnTypes(headers []string, rows [][]string) map[string]string {
+	types := map[string]string{}
+	columns := c.InsertColumns(headers)
+	generated := len(columns) - len(c.constantValues) - len(c.generated)
+	for i, column := range columns {
+		var values []string
+		switch {
+		case i >= len(columns)-len(c.constantValues):
+			values = []string{c.constantValues[i-(len(columns)-len(c.constantValues))]}
+		case i >= generated:
+			for r, row := range rows {
+				values = append(values, c.generated[i-generated].value(row, generateInput{row: r + 1, now: time.Now(), runID: c.RunID, started: c.started}))
+			}
+		case len(c.mapIndexes) > 0:
+			values = sampleColumn(rows, c.mapIndexes[i])
+		default:
+			values = sampleColumn(rows, i)
+		}
+		// the NULL values fit every type
+		values = slices.DeleteFunc(values, func(v string) bool { return c.insertNull(i, v) })
+		types[column] = inferColumnType(values, false)
+	}
+	for column, t := range c.ColumnTypes {
+		types[column] = t
+	}
+	return types
+}
+
+// sampleColumn returns the values of column index of rows
+func sampleColumn(rows [][]string, index int) []string {
+	values := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if index < len(row) {
+			values = append(values, row[index])
+		}
+	}
+	return values
+}
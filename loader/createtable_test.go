@@ -0,0 +1,102 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestBuildCreateTable(t *testing.T) {
+	ddl := buildCreateTable(mysqlDialect{}, "stats.domain", []string{"GlobalRank", "Domain", "order"},
+		map[string]string{"GlobalRank": "INT NOT NULL", "Domain": "VARCHAR(255)"})
+	assert.Equal(t, ddl, "CREATE TABLE IF NOT EXISTS `stats`.`domain` (`GlobalRank` INT NOT NULL, `Domain` VARCHAR(255), `order` TEXT)")
+
+	c, err := ParseFlags([]string{"-create-table", "-column-types", "Price=DECIMAL(10,2)"})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.ResolveColumns([]string{"Domain"}), "unknown column 'Price'")
+
+	_, err = ParseFlags([]string{"-create-table", "-column-types", "GlobalRank=INT); DROP TABLE domain; --"})
+	assert.ErrorContains(t, err, "invalid column type 'INT); DROP TABLE domain; --' for column GlobalRank")
+	_, err = ParseFlags([]string{"-column-types", "GlobalRank=INT"})
+	assert.ErrorContains(t, err, "-column-types requires -create-table")
+}
+
+func TestLoaderRunCreateTable(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain\n1,google.com\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-workers", "1", "-table", "ranks", "-create-table", "-column-types", "GlobalRank=INT"})
+	assert.NilError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	// the table doesn't exist yet, so it has no columns
+	mock.ExpectQuery("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION").
+		WithArgs("ranks").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `ranks` (`GlobalRank` INT, `Domain` TEXT)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO `ranks` (`GlobalRank`,`Domain`) VALUES (?,?)").
+		WithArgs("1", "google.com").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsInserted, int64(1))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestInferColumnType(t *testing.T) {
+	for _, tc := range []struct {
+		values      []string
+		emptyAsNull bool
+		want        string
+	}{
+		{[]string{"1", "-20", "300"}, false, "INT"},
+		{[]string{"1", "3000000000"}, false, "BIGINT"},
+		{[]string{"1", "2.5", "1e3"}, false, "DOUBLE"},
+		{[]string{"1", "inf"}, false, "VARCHAR(32)"},
+		{[]string{"2024-01-02 03:04:05", "2024-01-02"}, false, "DATETIME"},
+		{[]string{"1", ""}, false, "VARCHAR(32)"},
+		{[]string{"1", ""}, true, "INT"},
+		{[]string{"google.com", strings.Repeat("x", 40)}, false, "VARCHAR(128)"},
+		{[]string{strings.Repeat("x", 3000)}, false, "TEXT"},
+		{[]string{"", ""}, true, "TEXT"},
+	} {
+		assert.Equal(t, inferColumnType(tc.values, tc.emptyAsNull), tc.want, "%v", tc.values)
+	}
+}
+
+func TestLoaderRunInferTypes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain,Seen\n1,google.com,2024-05-01\n2,youtube.com,2024-05-02\n3,x.com,\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-workers", "1", "-batch-size", "3", "-table", "ranks", "-create-table", "-infer-types", "2",
+		"-column-types", "Domain=VARCHAR(255)", "-constant", "source=majestic", "-truncate"})
+	assert.NilError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION").
+		WithArgs("ranks").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}))
+	// only the first two rows are sampled, the empty Seen of the third one isn't
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `ranks` (`GlobalRank` INT, `Domain` VARCHAR(255), `Seen` DATETIME, `source` VARCHAR(32))").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("TRUNCATE TABLE `ranks`").WillReturnResult(sqlmock.NewResult(0, 0))
+	// the sampled rows are imported as well
+	mock.ExpectExec("INSERT INTO `ranks` (`GlobalRank`,`Domain`,`Seen`,`source`) VALUES (?,?,?,?), (?,?,?,?), (?,?,?,?)").
+		WithArgs("1", "google.com", "2024-05-01", "majestic", "2", "youtube.com", "2024-05-02", "majestic", "3", "x.com", "", "majestic").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsInserted, int64(3))
+	assert.NilError(t, mock.ExpectationsWereMet())
+
+	_, err = ParseFlags([]string{"-infer-types", "100"})
+	assert.ErrorContains(t, err, "-infer-types requires -create-table")
+	_, err = ParseFlags([]string{"-truncate", "-resume"})
+	assert.ErrorContains(t, err, "-truncate can't be combined with resuming")
+}
@@ -0,0 +1,312 @@
+package loader
+
+import (
+	"bufio"
+	"cmp"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+)
+
+// dbExtraConns are the connections of the pool on top of one per worker, for the statements outside of the
+// workers (e.g. the lookups of the reader) while every worker holds its connection
+const dbExtraConns = 4
+
+// charsetPattern are the names of the charsets and collations of -charset and -collation
+var charsetPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,64}$`)
+
+// DBSettings are the settings needed to connect to the database
+type DBSettings struct {
+	User     string
+	Password string
+	Host     string
+	Port     string
+	// Socket is the unix socket of the server, it is used instead of Host and Port when given
+	Socket   string
+	Database string
+	// Params are the DSN parameters appended after ?, e.g. charset=utf8mb4&parseTime=true
+	Params string
+	// TLS is the tls DSN parameter, one of tlsModes or the name of a registered TLS config, empty is unencrypted
+	TLS string
+	// TLSCA is the PEM file with the CA the server certificate is verified against
+	TLSCA string
+	// TLSCert and TLSKey are the PEM files with the client certificate and its key
+	TLSCert string
+	TLSKey  string
+	// Charset and Collation are the charset and collation DSN parameters, empty keeps the default of the driver
+	Charset   string
+	Collation string
+}
+
+// LoadDBSettings collects the connection settings, the environment (DB_USERNAME, DB_PASSWORD, DB_HOST, DB_PORT,
+// DB_SOCKET, DB_NAME, DB_PARAMS, DB_TLS, DB_TLS_CA, DB_TLS_CERT, DB_TLS_KEY) takes precedence over the [client] and
+// [mysql] sections of the MySQL option file (if given). A complete DSN in DB_DSN replaces the user, the password,
+// the server, the database, the parameters and the TLS mode of both.
+func LoadDBSettings(optionFile string) (DBSettings, error) {
+	s := DBSettings{Host: "localhost", Port: "3306"}
+	if optionFile != "" {
+		options, err := ReadOptionFile(optionFile, "client", "mysql")
+		if err != nil {
+			return s, err
+		}
+		setFromOption(&s.User, options, "user")
+		setFromOption(&s.Password, options, "password")
+		setFromOption(&s.Host, options, "host")
+		setFromOption(&s.Port, options, "port")
+		setFromOption(&s.Socket, options, "socket")
+		setFromOption(&s.Database, options, "database")
+		setFromOption(&s.TLSCA, options, "ssl_ca")
+		setFromOption(&s.TLSCert, options, "ssl_cert")
+		setFromOption(&s.TLSKey, options, "ssl_key")
+	}
+	setFromEnv(&s.User, "DB_USERNAME")
+	setFromEnv(&s.Password, "DB_PASSWORD")
+	setFromEnv(&s.Host, "DB_HOST")
+	setFromEnv(&s.Port, "DB_PORT")
+	setFromEnv(&s.Socket, "DB_SOCKET")
+	setFromEnv(&s.Database, "DB_NAME")
+	setFromEnv(&s.Params, "DB_PARAMS")
+	setFromEnv(&s.TLS, "DB_TLS")
+	setFromEnv(&s.TLSCA, "DB_TLS_CA")
+	setFromEnv(&s.TLSCert, "DB_TLS_CERT")
+	setFromEnv(&s.TLSKey, "DB_TLS_KEY")
+	if dsn := os.Getenv("DB_DSN"); dsn != "" {
+		if err := s.setDSN(dsn); err != nil {
+			return s, fmt.Errorf("invalid DB_DSN: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// setDSN replaces the settings with the ones of the go-sql-driver DSN dsn, e.g.
+// user:password@tcp(db.example.com:3306)/ranks?tls=true
+func (s *DBSettings) setDSN(dsn string) error {
+	parsed, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return err
+	}
+	s.User, s.Password, s.Database = parsed.User, parsed.Passwd, parsed.DBName
+	s.Host, s.Port, s.Socket = "", "", ""
+	switch parsed.Net {
+	case "tcp":
+		if s.Host, s.Port, err = net.SplitHostPort(parsed.Addr); err != nil {
+			return err
+		}
+	case "unix":
+		s.Socket = parsed.Addr
+	default:
+		return fmt.Errorf("unsupported network %s, must be tcp or unix", parsed.Net)
+	}
+	// the parameters are kept as written, but the TLS mode which is checked and combined with the certificates
+	s.Params, s.TLS = "", ""
+	if i := strings.LastIndexByte(dsn, '/'); i >= 0 {
+		if _, params, found := strings.Cut(dsn[i:], "?"); found {
+			var kept []string
+			for _, param := range strings.Split(params, "&") {
+				if value, ok := strings.CutPrefix(param, "tls="); ok {
+					s.TLS = value
+				} else if param != "" {
+					kept = append(kept, param)
+				}
+			}
+			s.Params = strings.Join(kept, "&")
+		}
+	}
+	return nil
+}
+
+// override replaces the settings given by -db-host, -db-port, -db-socket, -db-user and -db-name, a host or port
+// connects over TCP even if the other settings name a socket
+func (s *DBSettings) override(c Config) {
+	if c.DBHost != "" || c.DBPort != "" {
+		s.Socket = ""
+	}
+	s.Socket = cmp.Or(c.DBSocket, s.Socket)
+	s.Host = cmp.Or(c.DBHost, s.Host)
+	s.Port = cmp.Or(c.DBPort, s.Port)
+	s.User = cmp.Or(c.DBUser, s.User)
+	s.Database = cmp.Or(c.DBName, s.Database)
+	s.Charset = cmp.Or(c.Charset, s.Charset)
+	s.Collation = cmp.Or(c.Collation, s.Collation)
+}
+
+func setFromOption(target *string, options map[string]string, key string) {
+	if v, ok := options[key]; ok {
+		*target = v
+	}
+}
+
+func setFromEnv(target *string, key string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*target = v
+	}
+}
+
+// DSN returns the connection string and a printable variant of it with the password masked
+func (s DBSettings) DSN() (string, string) {
+	address := fmt.Sprintf("tcp(%s)/%s", net.JoinHostPort(s.Host, s.Port), s.Database)
+	if s.Socket != "" {
+		address = fmt.Sprintf("unix(%s)/%s", s.Socket, s.Database)
+	}
+	var params []string
+	if s.TLS != "" {
+		params = append(params, "tls="+s.TLS)
+	}
+	if s.Params != "" {
+		params = append(params, s.Params)
+	}
+	// after DB_PARAMS, so the flags win
+	if s.Charset != "" {
+		params = append(params, "charset="+s.Charset)
+	}
+	if s.Collation != "" {
+		params = append(params, "collation="+s.Collation)
+	}
+	if len(params) > 0 {
+		address += "?" + strings.Join(params, "&")
+	}
+	return fmt.Sprintf("%s:%s@%s", s.User, s.Password, address), fmt.Sprintf("%s:***@%s", s.User, address)
+}
+
+// ReadOptionFile reads the given sections of a MySQL option file (my.cnf style), options of later
+// sections override earlier ones. Option names are normalized to use '_' instead of '-'.
+func ReadOptionFile(filename string, sections ...string) (map[string]string, error) {
+	f, err := os.Open(expandHome(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	wanted := make(map[string]int)
+	for i, section := range sections {
+		wanted[section] = i
+	}
+	// values per section, applied in the order of sections at the end
+	values := make([]map[string]string, len(sections))
+	current := -1
+
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' || line[0] == '!' {
+			continue
+		}
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%s:%d: invalid section '%s'", filename, lineNumber, line)
+			}
+			section := strings.TrimSpace(line[1 : len(line)-1])
+			current = -1
+			if i, ok := wanted[section]; ok {
+				current = i
+			}
+			continue
+		}
+		if current < 0 {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		key = strings.ReplaceAll(strings.TrimSpace(key), "-", "_")
+		if values[current] == nil {
+			values[current] = make(map[string]string)
+		}
+		values[current][key] = optionValue(strings.TrimSpace(value))
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	options := make(map[string]string)
+	for _, v := range values {
+		for key, value := range v {
+			options[key] = value
+		}
+	}
+	return options, nil
+}
+
+// optionValue removes surrounding quotes or a trailing comment from an option value
+func optionValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return value[1 : end+1]
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// expandHome replaces a leading ~/ with the home directory of the user
+func expandHome(filename string) string {
+	if strings.HasPrefix(filename, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + filename[1:]
+		}
+	}
+	return filename
+}
+
+// OpenDBConnection opens the connection pool with the settings of the environment, the option file and the flags
+// of c, sized for its workers
+func OpenDBConnection(c Config) (*sql.DB, error) {
+	settings, err := connectionSettings(c)
+	if err != nil {
+		return nil, err
+	}
+	dialect := c.dialect()
+	if c.isMySQL() {
+		if err = settings.registerTLS(); err != nil {
+			return nil, err
+		}
+	}
+	dbConnString, dbConnStringPrintable := dialect.DSN(settings)
+
+	log.Printf("Open DB connection using %s", dbConnStringPrintable)
+
+	var db *sql.DB
+	if c.IAMAuth {
+		db, err = openIAMAuthDB(dbConnString, settings)
+	} else {
+		db, err = sql.Open(cmp.Or(c.DBDriver, dialect.Driver()), dbConnString)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	applyPoolSettings(db, c)
+	return db, nil
+}
+
+// poolSizes returns the maximum of open and of idle connections of the pool: -max-open-conns and -max-idle-conns,
+// without them a connection per worker plus dbExtraConns, all of which may stay idle
+func (c *Config) poolSizes() (int, int) {
+	open := cmp.Or(c.MaxOpenConns, c.Workers+dbExtraConns)
+	idle := cmp.Or(c.MaxIdleConns, open)
+	return open, idle
+}
+
+// applyPoolSettings sizes the connection pool of db according to c
+func applyPoolSettings(db *sql.DB, c Config) {
+	open, idle := c.poolSizes()
+	db.SetMaxOpenConns(open)
+	db.SetMaxIdleConns(idle)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	log.Debugf("Connection pool of %d connections, %d idle, max lifetime %s", open, idle, c.ConnMaxLifetime)
+}
+
+// LogPoolStats logs the usage of the connection pool at the end of the run, a lot of waiting means the pool is
+// too small for the workers and the statements of the reader
+func LogPoolStats(s sql.DBStats) {
+	log.Printf("Connection pool: %d of at most %d connections open (%d in use, %d idle), waited %d times for %s in total, "+
+		"closed %d idle and %d expired connections", s.OpenConnections, s.MaxOpenConnections, s.InUse, s.Idle,
+		s.WaitCount, s.WaitDuration.Round(time.Millisecond), s.MaxIdleClosed+s.MaxIdleTimeClosed, s.MaxLifetimeClosed)
+}
@@ -0,0 +1,184 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+const testOptionFile = `# my client settings
+[client]
+user = import
+password = "se#cret"
+host=db.example.com
+port = 3307
+
+[mysqldump]
+user = dumper
+
+[mysql]
+database = test  # the default schema
+!includedir /etc/mysql/conf.d/
+`
+
+func writeOptionFile(t *testing.T) string {
+	filename := filepath.Join(t.TempDir(), "my.cnf")
+	assert.NilError(t, os.WriteFile(filename, []byte(testOptionFile), 0o600))
+	return filename
+}
+
+func TestReadOptionFile(t *testing.T) {
+	options, err := ReadOptionFile(writeOptionFile(t), "client", "mysql")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, options, map[string]string{
+		"user":     "import",
+		"password": "se#cret",
+		"host":     "db.example.com",
+		"port":     "3307",
+		"database": "test",
+	})
+}
+
+func TestLoadDBSettingsPrecedence(t *testing.T) {
+	filename := writeOptionFile(t)
+	for _, key := range []string{"DB_USERNAME", "DB_PASSWORD", "DB_HOST", "DB_PORT", "DB_SOCKET", "DB_DSN", "DB_NAME", "DB_PARAMS", "DB_TLS", "DB_TLS_CA", "DB_TLS_CERT", "DB_TLS_KEY"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	t.Setenv("DB_NAME", "other")
+
+	s, err := LoadDBSettings(filename)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s, DBSettings{User: "import", Password: "se#cret", Host: "db.example.com", Port: "3307", Database: "other"})
+}
+
+func TestDBSettingsOverride(t *testing.T) {
+	s := DBSettings{User: "import", Password: "se#cret", Host: "db.example.com", Port: "3307", Database: "other"}
+	s.override(Config{DBHost: "mysql.internal", DBName: "ranks"})
+	assert.DeepEqual(t, s, DBSettings{User: "import", Password: "se#cret", Host: "mysql.internal", Port: "3307", Database: "ranks"})
+}
+
+func TestDSNMasksPassword(t *testing.T) {
+	s := DBSettings{User: "root", Password: "example", Host: "localhost", Port: "3306", Database: "test"}
+	dsn, printable := s.DSN()
+	assert.Equal(t, dsn, "root:example@tcp(localhost:3306)/test")
+	assert.Equal(t, printable, "root:***@tcp(localhost:3306)/test")
+	assert.Assert(t, !strings.Contains(printable, "example"))
+}
+
+func TestDSNFromEnv(t *testing.T) {
+	t.Setenv("DB_USERNAME", "import")
+	t.Setenv("DB_PASSWORD", "s3cret")
+	t.Setenv("DB_HOST", "mysql.internal")
+	t.Setenv("DB_PORT", "3307")
+	t.Setenv("DB_NAME", "ranks")
+	t.Setenv("DB_PARAMS", "charset=utf8mb4&parseTime=true")
+
+	s, err := LoadDBSettings("")
+	assert.NilError(t, err)
+	dsn, printable := s.DSN()
+	assert.Equal(t, dsn, "import:s3cret@tcp(mysql.internal:3307)/ranks?charset=utf8mb4&parseTime=true")
+	assert.Equal(t, printable, "import:***@tcp(mysql.internal:3307)/ranks?charset=utf8mb4&parseTime=true")
+}
+
+func TestDSNSocket(t *testing.T) {
+	s := DBSettings{User: "import", Host: "localhost", Port: "3306", Socket: "/var/run/mysqld/mysqld.sock", Database: "ranks"}
+	_, printable := s.DSN()
+	assert.Equal(t, printable, "import:***@unix(/var/run/mysqld/mysqld.sock)/ranks")
+
+	// a host given by a flag connects over TCP
+	s.override(Config{DBHost: "::1"})
+	_, printable = s.DSN()
+	assert.Equal(t, printable, "import:***@tcp([::1]:3306)/ranks")
+	s.override(Config{DBSocket: "/tmp/mysql.sock"})
+	assert.Equal(t, s.Socket, "/tmp/mysql.sock")
+
+	_, err := ParseFlags([]string{"-db-socket", "/tmp/mysql.sock", "-db-port", "3307"})
+	assert.ErrorContains(t, err, "-db-socket can't be combined with -db-host or -db-port")
+}
+
+func TestDSNCharsetCollation(t *testing.T) {
+	s := DBSettings{User: "import", Host: "localhost", Port: "3306", Database: "ranks", Params: "charset=latin1&parseTime=true"}
+	s.override(Config{Charset: "utf8mb4", Collation: "utf8mb4_0900_ai_ci"})
+	_, printable := s.DSN()
+	assert.Equal(t, printable, "import:***@tcp(localhost:3306)/ranks?charset=latin1&parseTime=true&charset=utf8mb4&collation=utf8mb4_0900_ai_ci")
+
+	_, err := ParseFlags([]string{"-charset", "utf8mb4", "-collation", "latin1_swedish_ci"})
+	assert.ErrorContains(t, err, "collation latin1_swedish_ci doesn't belong to charset utf8mb4")
+	_, err = ParseFlags([]string{"-charset", "utf8mb4;DROP"})
+	assert.ErrorContains(t, err, "invalid charset 'utf8mb4;DROP'")
+}
+
+func TestDSNFromDBDSN(t *testing.T) {
+	t.Setenv("DB_HOST", "ignored.internal")
+	t.Setenv("DB_PARAMS", "parseTime=true")
+	t.Setenv("DB_DSN", "admin:p@ss?word@tcp(mydb.abc123.eu-west-1.rds.amazonaws.com:3306)/ranks?tls=true&charset=utf8mb4")
+	s, err := LoadDBSettings("")
+	assert.NilError(t, err)
+	assert.Equal(t, s.Password, "p@ss?word")
+	assert.Equal(t, s.TLS, "true")
+	dsn, printable := s.DSN()
+	assert.Equal(t, dsn, "admin:p@ss?word@tcp(mydb.abc123.eu-west-1.rds.amazonaws.com:3306)/ranks?tls=true&charset=utf8mb4")
+	assert.Equal(t, printable, "admin:***@tcp(mydb.abc123.eu-west-1.rds.amazonaws.com:3306)/ranks?tls=true&charset=utf8mb4")
+
+	t.Setenv("DB_DSN", "root@unix(/tmp/mysql.sock)/test")
+	s, err = LoadDBSettings("")
+	assert.NilError(t, err)
+	_, printable = s.DSN()
+	assert.Equal(t, printable, "root:***@unix(/tmp/mysql.sock)/test")
+
+	t.Setenv("DB_DSN", "root@tcp(localhost:3306)")
+	_, err = LoadDBSettings("")
+	assert.ErrorContains(t, err, "invalid DB_DSN")
+}
+
+func TestDSNDefaults(t *testing.T) {
+	for _, key := range []string{"DB_HOST", "DB_PORT", "DB_SOCKET", "DB_DSN", "DB_PARAMS", "DB_TLS", "DB_TLS_CA", "DB_TLS_CERT", "DB_TLS_KEY"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	s, err := LoadDBSettings("")
+	assert.NilError(t, err)
+	_, printable := s.DSN()
+	assert.Assert(t, strings.HasPrefix(printable, s.User+":***@tcp(localhost:3306)/"), printable)
+	assert.Assert(t, !strings.Contains(printable, "?"))
+}
+
+func TestPoolSettings(t *testing.T) {
+	c, err := ParseFlags([]string{"-workers", "10"})
+	assert.NilError(t, err)
+	open, idle := c.poolSizes()
+	assert.Equal(t, open, 10+dbExtraConns)
+	assert.Equal(t, idle, 10+dbExtraConns, "no connection of a worker is closed as idle")
+
+	c, err = ParseFlags([]string{"-workers", "2", "-max-open-conns", "3", "-max-idle-conns", "1", "-conn-max-lifetime", "1m"})
+	assert.NilError(t, err)
+	db, _, err := sqlmock.New()
+	assert.NilError(t, err)
+	defer db.Close()
+	applyPoolSettings(db, c)
+	assert.Equal(t, db.Stats().MaxOpenConnections, 3)
+
+	// of the connections given back only one is kept idle
+	ctx := context.Background()
+	var conns []*sql.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := db.Conn(ctx)
+		assert.NilError(t, err)
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		assert.NilError(t, conn.Close())
+	}
+	assert.Equal(t, db.Stats().Idle, 1)
+	assert.Equal(t, db.Stats().MaxIdleClosed, int64(2))
+
+	_, err = ParseFlags([]string{"-workers", "10", "-max-open-conns", "5"})
+	assert.ErrorContains(t, err, "invalid max-open-conns 5, every one of the 10 workers needs a connection")
+}
@@ -0,0 +1,94 @@
+package loader
+
+import (
+	"encoding/csv"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// DeadLetter writes rows which are not imported to a CSV file with the header of the input, a row column with the
+// number of the data row in the input and an error column telling why, so they can be fixed and imported again. It
+// is safe for concurrent use. A nil *DeadLetter drops the rows.
+type DeadLetter struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *csv.Writer
+	// headers are written with the first row, so the file stays empty when all rows were imported
+	headers []string
+	// fields is the number of CSV columns, the -generate values appended to a row aren't written
+	fields int
+	rows   int64
+}
+
+// columns appended to the rows of the dead-letter file: the number of the data row and the reason it is not imported
+const (
+	deadLetterRowColumn   = "row"
+	deadLetterErrorColumn = "error"
+)
+
+// OpenDeadLetter creates (or truncates) the dead-letter file filename, its fields are separated by delimiter (0 is
+// a comma)
+func OpenDeadLetter(filename string, headers []string, delimiter rune) (*DeadLetter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	w := csv.NewWriter(f)
+	if delimiter != 0 {
+		// the rows can be imported again with the same options
+		w.Comma = delimiter
+	}
+	return &DeadLetter{f: f, w: w, headers: append(slices.Clip(headers), deadLetterRowColumn, deadLetterErrorColumn), fields: len(headers)}, nil
+}
+
+// Write adds row number and the reason it is not imported to the dead-letter file
+func (d *DeadLetter) Write(row []string, number int, reason string) error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.headers != nil {
+		if err := d.w.Write(d.headers); err != nil {
+			return err
+		}
+		d.headers = nil
+	}
+	if d.fields > 0 && len(row) > d.fields {
+		row = row[:d.fields]
+	}
+	if err := d.w.Write(append(slices.Clip(row), strconv.Itoa(number), reason)); err != nil {
+		return err
+	}
+	d.rows++
+	// flushed right away, so the cleanup sees the file isn't empty
+	d.w.Flush()
+	return d.w.Error()
+}
+
+// Rows returns the number of rows written
+func (d *DeadLetter) Rows() int64 {
+	if d == nil {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rows
+}
+
+// Close flushes and closes the dead-letter file
+func (d *DeadLetter) Close() error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.w.Flush()
+	err := d.w.Error()
+	if cerr := d.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
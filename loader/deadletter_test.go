@@ -0,0 +1,105 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"gotest.tools/v3/assert"
+)
+
+func TestDeadLetter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "dead.csv")
+	d, err := OpenDeadLetter(filename, []string{"Domain", "TLD"}, 0)
+	assert.NilError(t, err)
+
+	content, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "", "the header is written with the first row")
+
+	assert.NilError(t, d.Write([]string{"example.zz", "zz"}, 3, "lookup miss"))
+	assert.NilError(t, d.Write([]string{"a,b.zz", "zz"}, 7, "Error 1406: Data too long"))
+	assert.NilError(t, d.Close())
+	content, err = os.ReadFile(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "Domain,TLD,row,error\nexample.zz,zz,3,lookup miss\n\"a,b.zz\",zz,7,Error 1406: Data too long\n")
+}
+
+func TestWorkerSplitsFailedBatch(t *testing.T) {
+	l := withConnConfig(t, 5)
+	var err error
+	filename := filepath.Join(t.TempDir(), "dead.csv")
+	l.config, err = ParseFlags([]string{"-split-failed-batches", "-dead-letter-file", filename})
+	assert.NilError(t, err)
+	l.deadLetter, err = OpenDeadLetter(filename, []string{"Domain"}, l.config.Delimiter)
+	assert.NilError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	const single = "INSERT INTO `domain` (`Domain`) VALUES (?)"
+	tooLong := &mysql.MySQLError{Number: 1406, Message: "Data too long for column 'Domain' at row 2"}
+	mock.ExpectExec(single + ", (?), (?)").WillReturnError(tooLong)
+	mock.ExpectExec(single).WithArgs("a.com").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(single).WithArgs("b.com").WillReturnError(tooLong)
+	mock.ExpectExec(single).WithArgs("c.com").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	jobs := make(chan Job, 3)
+	for i, domain := range []string{"a.com", "b.com", "c.com"} {
+		jobs <- Job{Row: i + 1, Values: []string{domain}}
+	}
+	close(jobs)
+	assert.NilError(t, l.worker(context.Background(), 0, db, jobs, l.newBatchQueries("domain", []string{"Domain"}), nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.NilError(t, l.deadLetter.Close())
+	assert.Equal(t, l.rowsInserted.Load(), int64(2))
+	assert.Equal(t, l.deadLetter.Rows(), int64(1))
+	content, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "Domain,row,error\nb.com,2,Error 1406: Data too long for column 'Domain' at row 2\n")
+}
+
+func TestWorkerDeadLettersFailedBatch(t *testing.T) {
+	l := withConnConfig(t, 5)
+	var err error
+	filename := filepath.Join(t.TempDir(), "dead.csv")
+	l.config, err = ParseFlags([]string{"-dead-letter-failed-batches", "-dead-letter-file", filename, "-batch-size", "2", "-max-retries", "1", "-backoff-base", "1ms", "-backoff-max", "1ms"})
+	assert.NilError(t, err)
+	l.deadLetter, err = OpenDeadLetter(filename, []string{"Domain"}, l.config.Delimiter)
+	assert.NilError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	const batch = "INSERT INTO `domain` (`Domain`) VALUES (?), (?)"
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	// the first batch still fails after its retry, the import goes on with the second one
+	mock.ExpectExec(batch).WithArgs("a.com", "b.com").WillReturnError(deadlock)
+	mock.ExpectExec(batch).WithArgs("a.com", "b.com").WillReturnError(deadlock)
+	mock.ExpectExec(batch).WithArgs("c.com", "d.com").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	jobs := make(chan Job, 4)
+	for i, domain := range []string{"a.com", "b.com", "c.com", "d.com"} {
+		jobs <- Job{Row: i + 1, Values: []string{domain}}
+	}
+	close(jobs)
+	assert.NilError(t, l.worker(context.Background(), 0, db, jobs, l.newBatchQueries("domain", []string{"Domain"}), nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.NilError(t, l.deadLetter.Close())
+	assert.Equal(t, l.rowsInserted.Load(), int64(2))
+	assert.Equal(t, l.rowsFailed.Load(), int64(0))
+	content, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "Domain,row,error\na.com,1,Error 1213: Deadlock found when trying to get lock\nb.com,2,Error 1213: Deadlock found when trying to get lock\n")
+
+	_, err = ParseFlags([]string{"-dead-letter-failed-batches"})
+	assert.ErrorContains(t, err, "-dead-letter-failed-batches requires -dead-letter-file")
+}
+
+func TestSplitFailedBatchesRequiresDeadLetterFile(t *testing.T) {
+	_, err := ParseFlags([]string{"-split-failed-batches"})
+	assert.ErrorContains(t, err, "-split-failed-batches requires -dead-letter-file")
+}
@@ -0,0 +1,156 @@
+package loader
+
+import (
+	"hash/maphash"
+	"math"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the ways -dedupe-on remembers the keys read
+const (
+	// DedupeMemory keeps every key in a set, exact but it needs the memory of all keys
+	DedupeMemory = "memory"
+	// DedupeBloom keeps the keys in a Bloom filter of a fixed size, a new key is taken for a duplicate with the
+	// false positive rate
+	DedupeBloom = "bloom"
+)
+
+var dedupeModes = []string{DedupeMemory, DedupeBloom}
+
+// dedupeKeySeparator joins the values of the key columns, it doesn't appear in text fields
+const dedupeKeySeparator = "\x00"
+
+// Dedupe skips the rows whose key was already read in the run, so every key is inserted at most once without a
+// unique index. It keeps every key in memory, up to maxKeys keys: after that new keys aren't remembered anymore,
+// so their duplicates are inserted again. With a Bloom filter the keys take a fixed amount of memory instead, sized
+// for maxKeys keys, and some rows with new keys are skipped as well. It is only used by the reader, a nil *Dedupe
+// skips nothing.
+type Dedupe struct {
+	indexes []int
+	maxKeys int
+	seen    map[string]struct{}
+	bloom   *bloomFilter
+	skipped int64
+	full    bool
+}
+
+// NewDedupe dedupes by the columns indexes of the rows, maxKeys 0 remembers any number of keys
+func NewDedupe(indexes []int, maxKeys int) *Dedupe {
+	return &Dedupe{indexes: indexes, maxKeys: maxKeys, seen: map[string]struct{}{}}
+}
+
+// NewBloomDedupe dedupes by the columns indexes of the rows with a Bloom filter taking a new key for a duplicate
+// with the falsePositiveRate as long as it got no more than maxKeys keys
+func NewBloomDedupe(indexes []int, maxKeys int, falsePositiveRate float64) *Dedupe {
+	return &Dedupe{indexes: indexes, maxKeys: maxKeys, bloom: newBloomFilter(maxKeys, falsePositiveRate)}
+}
+
+// Duplicate reports whether the key of row was read before, row number is only used for logging
+func (d *Dedupe) Duplicate(row []string, number int) bool {
+	if d == nil {
+		return false
+	}
+	key, ok := d.key(row)
+	if !ok {
+		return false
+	}
+	if d.bloom != nil {
+		return d.duplicateBloom(key, number)
+	}
+	if _, ok := d.seen[key]; ok {
+		d.skipped++
+		log.Debugf("Row %d skipped, key '%s' was read before", number, d.printable(key))
+		return true
+	}
+	if d.maxKeys > 0 && len(d.seen) >= d.maxKeys {
+		if !d.full {
+			d.full = true
+			log.Warnf("Deduplication remembers at most %d keys, duplicates of the keys read from row %d on are inserted again", d.maxKeys, number)
+		}
+		return false
+	}
+	d.seen[key] = struct{}{}
+	return false
+}
+
+// duplicateBloom is Duplicate with the Bloom filter, which keeps taking keys when it is full but then has
+// more false positives
+func (d *Dedupe) duplicateBloom(key string, number int) bool {
+	if !d.bloom.Add(key) {
+		d.skipped++
+		log.Debugf("Row %d skipped, key '%s' was probably read before", number, d.printable(key))
+		return true
+	}
+	if d.bloom.keys > int64(d.maxKeys) && !d.full {
+		d.full = true
+		log.Warnf("The deduplication Bloom filter got more than %d keys from row %d on, more rows with new keys are skipped from now on", d.maxKeys, number)
+	}
+	return false
+}
+
+// key returns the values of the key columns of row, false if row is too short
+func (d *Dedupe) key(row []string) (string, bool) {
+	if len(d.indexes) == 1 && d.indexes[0] < len(row) {
+		return row[d.indexes[0]], true
+	}
+	values := make([]string, len(d.indexes))
+	for i, index := range d.indexes {
+		if index >= len(row) {
+			return "", false
+		}
+		values[i] = row[index]
+	}
+	return strings.Join(values, dedupeKeySeparator), true
+}
+
+// printable returns key with the values of the key columns separated by commas
+func (d *Dedupe) printable(key string) string {
+	return strings.ReplaceAll(key, dedupeKeySeparator, ",")
+}
+
+// Skipped returns the number of duplicate rows skipped
+func (d *Dedupe) Skipped() int64 {
+	if d == nil {
+		return 0
+	}
+	return d.skipped
+}
+
+// bloomFilter is a set of keys which may answer that it contains a key it doesn't, with a fixed size
+type bloomFilter struct {
+	bits   []uint64
+	m      uint64
+	hashes int
+	seeds  [2]maphash.Seed
+	keys   int64
+}
+
+// newBloomFilter returns a filter for n keys with the false positive rate p, it takes -n*ln(p)/ln(2)^2 bits
+func newBloomFilter(n int, p float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = max(64, (m+63)/64*64)
+	hashes := max(1, int(math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &bloomFilter{bits: make([]uint64, m/64), m: m, hashes: hashes, seeds: [2]maphash.Seed{maphash.MakeSeed(), maphash.MakeSeed()}}
+}
+
+// Add adds key and reports whether it was new, false for a key which was added before or a false positive
+func (f *bloomFilter) Add(key string) bool {
+	// the hashes are combined from two, see Kirsch and Mitzenmacher, "Less Hashing, Same Performance"
+	h1 := maphash.String(f.seeds[0], key)
+	h2 := maphash.String(f.seeds[1], key) | 1
+	added := false
+	for i := 0; i < f.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if f.bits[word]&mask == 0 {
+			f.bits[word] |= mask
+			added = true
+		}
+	}
+	if added {
+		f.keys++
+	}
+	return added
+}
@@ -0,0 +1,94 @@
+package loader
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestProcessCSVFileDedupe(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-dedupe-on", "Domain"})
+	assert.NilError(t, err)
+	headers := []string{"GlobalRank", "Domain"}
+	assert.NilError(t, l.config.ResolveColumns(headers))
+	l.dedupe = NewDedupe(l.config.dedupeIndexes, l.config.DedupeMaxKeys)
+
+	reader := l.config.newCSVReader(strings.NewReader("1,google.com\n2,youtube.com\n3,google.com\n4,facebook.com\n5,youtube.com\n"))
+	jobs := make(chan Job, 10)
+	l.headers = headers
+	rows, _, _ := l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	// only the first row of every key is sent, the duplicates are read nevertheless
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"1", "google.com"}, {"2", "youtube.com"}, {"4", "facebook.com"}})
+	assert.Equal(t, rows, 5)
+	assert.Equal(t, l.dedupe.Skipped(), int64(2))
+
+	stats := Stats{RowsRead: 5, RowsInserted: 3, RowsDeduped: 2}
+	assert.Equal(t, stats.Unaccounted(), int64(0))
+	assert.Equal(t, stats.SuccessRatio(), 1.0)
+}
+
+func TestDedupeMaxKeys(t *testing.T) {
+	d := NewDedupe([]int{0}, 2)
+	for i, key := range []string{"a", "b", "a", "c", "c", "b"} {
+		d.Duplicate([]string{key}, i+1)
+	}
+	// c isn't remembered anymore, so only the duplicates of a and b are skipped
+	assert.Equal(t, d.Skipped(), int64(2))
+
+	var none *Dedupe
+	assert.Assert(t, !none.Duplicate([]string{"a"}, 1))
+	assert.Equal(t, none.Skipped(), int64(0))
+
+	c, err := ParseFlags([]string{"-dedupe-on", "Missing"})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.ResolveColumns([]string{"Domain"}), "unknown column 'Missing'")
+}
+
+func TestDedupeKeyColumns(t *testing.T) {
+	d := NewDedupe([]int{0, 2}, 0)
+	for i, row := range [][]string{{"a", "1", "x"}, {"a", "2", "y"}, {"a", "3", "x"}, {"b", "4", "x"}, {"a"}} {
+		d.Duplicate(row, i+1)
+	}
+	// only the third row has a key (a,x) read before, the short row has no key
+	assert.Equal(t, d.Skipped(), int64(1))
+
+	c, err := ParseFlags([]string{"-dedupe-on", "Domain,GlobalRank"})
+	assert.NilError(t, err)
+	assert.NilError(t, c.ResolveColumns([]string{"GlobalRank", "Domain"}))
+	assert.DeepEqual(t, c.dedupeIndexes, []int{1, 0})
+}
+
+func TestBloomDedupe(t *testing.T) {
+	const keys = 100000
+	d := NewBloomDedupe([]int{0}, keys, 0.01)
+	for i := 0; i < keys; i++ {
+		d.Duplicate([]string{strconv.Itoa(i)}, i+1)
+	}
+	falsePositives := d.Skipped()
+	// every duplicate is found, a Bloom filter has no false negatives
+	for i := 0; i < keys; i++ {
+		assert.Assert(t, d.Duplicate([]string{strconv.Itoa(i)}, keys+i+1))
+	}
+	assert.Assert(t, falsePositives < 2*keys/100, falsePositives)
+	// 100000 keys at 1% take 9.6 bits per key
+	assert.Equal(t, len(d.bloom.bits), 14977)
+	assert.Equal(t, d.bloom.hashes, 7)
+}
+
+func TestDedupeFlags(t *testing.T) {
+	for want, args := range map[string][]string{
+		"invalid dedupe-mode 'disk', allowed are: memory, bloom":           {"-dedupe-mode", "disk"},
+		"-dedupe-mode bloom requires -dedupe-max-keys":                     {"-dedupe-mode", "bloom", "-dedupe-max-keys", "0"},
+		"invalid dedupe-false-positive-rate 1, must be between 0 and 1":    {"-dedupe-false-positive-rate", "1"},
+		"invalid dedupe-false-positive-rate -0.1, must be between 0 and 1": {"-dedupe-false-positive-rate", "-0.1"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want, args)
+	}
+}
@@ -0,0 +1,360 @@
+package loader
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Dialect builds the statements of the insert path and opens the connection for a database. The worker pool and
+// the CSV pipeline are the same for all databases, the features relying on MySQL statements (LOAD DATA, the
+// information schema, the session settings, ...) are only available with the mysql dialect.
+type Dialect interface {
+	// Driver is the name of the database/sql driver the connection is opened with, the driver has to be
+	// registered by importing it (only the MySQL driver is built into the command)
+	Driver() string
+	// DSN returns the data source name of the settings and a printable variant of it with the password masked
+	DSN(s DBSettings) (string, string)
+	// QuoteIdentifier quotes a table or column name
+	QuoteIdentifier(name string) string
+	// Placeholder returns the placeholder of the n-th (1-based) argument of a statement
+	Placeholder(n int) string
+	// InsertVerb returns the start of the INSERT statement for the -on-duplicate mode
+	InsertVerb(onDuplicate string) string
+	// UpsertClause returns the clause appended after the values for the -on-duplicate mode, setting columns to the
+	// inserted values, conflict are the key columns a conflict is detected on (the -conflict-columns)
+	UpsertClause(onDuplicate string, conflict []string, columns []string) string
+	// OnDuplicateModes are the -on-duplicate modes the database supports
+	OnDuplicateModes() []string
+}
+
+// names of the dialects accepted by -dialect
+const (
+	DialectMySQL      = "mysql"
+	DialectMariaDB    = "mariadb"
+	DialectPostgres   = "postgres"
+	DialectSQLite     = "sqlite"
+	DialectClickHouse = "clickhouse"
+)
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]Dialect{
+		DialectMySQL:      mysqlDialect{},
+		DialectMariaDB:    mysqlDialect{},
+		DialectPostgres:   postgresDialect{},
+		DialectSQLite:     sqliteDialect{},
+		DialectClickHouse: clickHouseDialect{},
+	}
+)
+
+// RegisterDialect makes -dialect name select d, replacing the dialect of the name if there is one
+func RegisterDialect(name string, d Dialect) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[name] = d
+}
+
+// lookupDialect returns the dialect of name, empty is mysql
+func lookupDialect(name string) (Dialect, bool) {
+	if name == "" {
+		name = DialectMySQL
+	}
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	d, ok := dialects[name]
+	return d, ok
+}
+
+// dialectNames returns the names of the dialects in name order
+func dialectNames() []string {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dialect returns the Dialect of the config, unknown names (rejected by Validate) are mysql
+func (c *Config) dialect() Dialect {
+	if d, ok := lookupDialect(c.Dialect); ok {
+		return d
+	}
+	return mysqlDialect{}
+}
+
+// isMySQL reports whether the config uses the mysql dialect (or mariadb), which the MySQL only features need
+func (c *Config) isMySQL() bool {
+	_, ok := c.dialect().(mysqlDialect)
+	return ok
+}
+
+// mysqlOnlyFlags returns the flags given which rely on MySQL statements, they are rejected with another dialect
+func (c *Config) mysqlOnlyFlags() []string {
+	var flags []string
+	add := func(given bool, flag string) {
+		if given {
+			flags = append(flags, "-"+flag)
+		}
+	}
+	add(c.Mode == ModeLoadData, "mode load-data")
+	add(c.CreateTable, "create-table")
+	add(c.Truncate && c.Dialect == DialectSQLite, "truncate")
+	add(c.IdempotencyTable != "", "idempotency-table")
+	add(c.TableTemplate != "", "table-template")
+	add(len(c.LookupInserts) > 0, "lookup-insert")
+	add(c.Preset != "", "preset")
+	add(c.Isolation != "", "isolation")
+	add(c.Charset != "", "charset")
+	add(c.Collation != "", "collation")
+	add(c.TimeZone != "", "time-zone")
+	add(c.SQLMode != "", "sql-mode")
+	add(c.DumpFailedSQL != "", "dump-failed-sql")
+	add(c.DeferFKChecks, "defer-fk-checks")
+	add(c.IAMAuth, "iam-auth")
+	return flags
+}
+
+// bindPlaceholders replaces the ? placeholders of query with the ones of the dialect, numbered from offset+1. The
+// ? in quoted strings, quoted identifiers and comments are kept. It returns the query and the placeholders
+// replaced.
+func bindPlaceholders(d Dialect, query string, offset int) (string, int) {
+	if d.Placeholder(1) == "?" {
+		return query, strings.Count(query, "?")
+	}
+	var b strings.Builder
+	b.Grow(len(query) + len(query)/2)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(query) && query[end] != c {
+				end++
+			}
+			b.WriteString(query[i:min(end+1, len(query))])
+			i = end
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String(), n
+			}
+			b.WriteString(query[i : i+end+4])
+			i += end + 3
+		case c == '?':
+			n++
+			b.WriteString(d.Placeholder(offset + n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), n
+}
+
+// mysqlDialect is MySQL and MariaDB
+type mysqlDialect struct{}
+
+func (mysqlDialect) Driver() string { return "mysql" }
+
+func (mysqlDialect) DSN(s DBSettings) (string, string) { return s.DSN() }
+
+func (mysqlDialect) QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (mysqlDialect) Placeholder(int) string { return "?" }
+
+func (mysqlDialect) InsertVerb(onDuplicate string) string {
+	switch onDuplicate {
+	case OnDuplicateIgnore:
+		return "INSERT IGNORE INTO"
+	case OnDuplicateReplace:
+		return "REPLACE INTO"
+	}
+	return "INSERT INTO"
+}
+
+func (d mysqlDialect) UpsertClause(onDuplicate string, _ []string, columns []string) string {
+	if onDuplicate != OnDuplicateUpdate {
+		return ""
+	}
+	updates := make([]string, len(columns))
+	for i, c := range columns {
+		q := d.QuoteIdentifier(c)
+		updates[i] = q + "=VALUES(" + q + ")"
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ",")
+}
+
+func (mysqlDialect) OnDuplicateModes() []string { return onDuplicateModes }
+
+// postgresDialect is PostgreSQL, e.g. with github.com/lib/pq (or the pgx stdlib driver with -db-driver pgx)
+type postgresDialect struct{}
+
+func (postgresDialect) Driver() string { return "postgres" }
+
+// DSN returns a postgres:// URL, DB_PARAMS are its parameters (e.g. sslmode=verify-full)
+func (postgresDialect) DSN(s DBSettings) (string, string) {
+	return urlDSN("postgres", s, "5432")
+}
+
+func (postgresDialect) QuoteIdentifier(name string) string { return doubleQuote(name) }
+
+func (postgresDialect) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (postgresDialect) InsertVerb(string) string { return "INSERT INTO" }
+
+func (postgresDialect) UpsertClause(onDuplicate string, conflict []string, columns []string) string {
+	return onConflictClause(onDuplicate, conflict, columns, "EXCLUDED", doubleQuote)
+}
+
+func (postgresDialect) OnDuplicateModes() []string {
+	return []string{OnDuplicateError, OnDuplicateIgnore, OnDuplicateUpdate}
+}
+
+// sqliteDialect is SQLite (3.24 or newer for -on-duplicate update), DB_NAME is the database file
+type sqliteDialect struct{}
+
+func (sqliteDialect) Driver() string { return "sqlite3" }
+
+func (sqliteDialect) DSN(s DBSettings) (string, string) {
+	dsn := s.Database
+	if s.Params != "" {
+		dsn += "?" + s.Params
+	}
+	return dsn, dsn
+}
+
+func (sqliteDialect) QuoteIdentifier(name string) string { return doubleQuote(name) }
+
+func (sqliteDialect) Placeholder(int) string { return "?" }
+
+func (sqliteDialect) InsertVerb(onDuplicate string) string {
+	switch onDuplicate {
+	case OnDuplicateIgnore:
+		return "INSERT OR IGNORE INTO"
+	case OnDuplicateReplace:
+		return "INSERT OR REPLACE INTO"
+	}
+	return "INSERT INTO"
+}
+
+func (sqliteDialect) UpsertClause(onDuplicate string, conflict []string, columns []string) string {
+	if onDuplicate != OnDuplicateUpdate {
+		return ""
+	}
+	return onConflictClause(onDuplicate, conflict, columns, "excluded", doubleQuote)
+}
+
+func (sqliteDialect) OnDuplicateModes() []string { return onDuplicateModes }
+
+// clickHouseDialect is ClickHouse, e.g. with github.com/ClickHouse/clickhouse-go/v2. It has no unique keys, rows
+// are deduplicated by the table engine (e.g. ReplacingMergeTree), so only -on-duplicate error is supported.
+type clickHouseDialect struct{}
+
+func (clickHouseDialect) Driver() string { return "clickhouse" }
+
+func (clickHouseDialect) DSN(s DBSettings) (string, string) {
+	return urlDSN("clickhouse", s, "9000")
+}
+
+func (clickHouseDialect) QuoteIdentifier(name string) string {
+	return mysqlDialect{}.QuoteIdentifier(name)
+}
+
+func (clickHouseDialect) Placeholder(int) string { return "?" }
+
+func (clickHouseDialect) InsertVerb(string) string { return "INSERT INTO" }
+
+func (clickHouseDialect) UpsertClause(string, []string, []string) string { return "" }
+
+func (clickHouseDialect) OnDuplicateModes() []string { return []string{OnDuplicateError} }
+
+// onConflictClause returns the ON CONFLICT clause of PostgreSQL and SQLite, excluded is the name of the row
+// which was not inserted
+func onConflictClause(onDuplicate string, conflict []string, columns []string, excluded string, quote func(string) string) string {
+	switch onDuplicate {
+	case OnDuplicateIgnore:
+		return " ON CONFLICT DO NOTHING"
+	case OnDuplicateUpdate:
+		updates := make([]string, len(columns))
+		for i, c := range columns {
+			updates[i] = quote(c) + "=" + excluded + "." + quote(c)
+		}
+		targets := make([]string, len(conflict))
+		for i, c := range conflict {
+			targets[i] = quote(c)
+		}
+		return " ON CONFLICT (" + strings.Join(targets, ",") + ") DO UPDATE SET " + strings.Join(updates, ",")
+	}
+	return ""
+}
+
+// doubleQuote quotes an identifier the SQL standard way
+func doubleQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// urlDSN returns the settings as URL of scheme, a socket is given as host parameter
+func urlDSN(scheme string, s DBSettings, defaultPort string) (string, string) {
+	u := url.URL{Scheme: scheme, Path: "/" + s.Database, RawQuery: s.Params}
+	port := s.Port
+	if port == "" || port == "3306" {
+		// 3306 is the default of LoadDBSettings, which is for MySQL
+		port = defaultPort
+	}
+	u.Host = net.JoinHostPort(s.Host, port)
+	if s.Socket != "" {
+		u.Host = ""
+		q := u.Query()
+		q.Set("host", s.Socket)
+		u.RawQuery = q.Encode()
+	}
+	u.User = url.UserPassword(s.User, s.Password)
+	dsn := u.String()
+	u.User = url.UserPassword(s.User, "***")
+	printable, _ := url.PathUnescape(u.String())
+	return dsn, printable
+}
+
+// checkDialect checks the -dialect and the flags it doesn't support
+func (c *Config) checkDialect() error {
+	d, ok := lookupDialect(c.Dialect)
+	if !ok {
+		return fmt.Errorf("invalid dialect '%s', allowed are: %s", c.Dialect, strings.Join(dialectNames(), ", "))
+	}
+	if len(c.ConflictColumns) > 0 && c.OnDuplicate != OnDuplicateUpdate {
+		return fmt.Errorf("-conflict-columns requires -on-duplicate update")
+	}
+	// the loader package only brings the MySQL driver, the command and a program using the library import the others.
+	// A dry run doesn't connect.
+	if driver := cmp.Or(c.DBDriver, d.Driver()); !c.DryRun && !slices.Contains(sql.Drivers(), driver) {
+		return fmt.Errorf("the %s dialect needs the database/sql driver '%s', which isn't imported: import it in the "+
+			"program using the loader package", c.Dialect, driver)
+	}
+	if !c.isMySQL() {
+		if flags := c.mysqlOnlyFlags(); len(flags) > 0 {
+			return fmt.Errorf("the %s dialect doesn't support %s, they need MySQL", c.Dialect, strings.Join(flags, ", "))
+		}
+	}
+	if modes := d.OnDuplicateModes(); !slices.Contains(modes, c.OnDuplicate) {
+		return fmt.Errorf("-on-duplicate %s isn't supported by the %s dialect, allowed are: %s", c.OnDuplicate, c.Dialect,
+			strings.Join(modes, ", "))
+	}
+	// ON CONFLICT needs the key columns, MySQL finds the key itself
+	if c.OnDuplicate == OnDuplicateUpdate && len(c.ConflictColumns) == 0 && !c.isMySQL() {
+		return fmt.Errorf("-on-duplicate update with the %s dialect requires -conflict-columns", c.Dialect)
+	}
+	return nil
+}
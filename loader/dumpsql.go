@@ -0,0 +1,120 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const maskedValue = "***"
+
+// FailedSQLDump writes the statement and arguments of every failed batch in a form which can be pasted into
+// a MySQL client, it is safe for concurrent use by all workers. A nil *FailedSQLDump is valid and writes nothing.
+type FailedSQLDump struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+	// masked are the indexes of the columns whose values are replaced by ***
+	masked []int
+}
+
+// OpenFailedSQLDump creates (or truncates) the dump file filename
+func OpenFailedSQLDump(filename string, headers []string, maskColumns []string) (*FailedSQLDump, error) {
+	masked := make([]int, 0, len(maskColumns))
+	for _, column := range maskColumns {
+		index, err := columnIndex(headers, column)
+		if err != nil {
+			return nil, err
+		}
+		masked = append(masked, index)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &FailedSQLDump{w: f, masked: masked}, nil
+}
+
+// Dump writes a failed batch: the error, the statement with the (masked) values filled in and the argument list
+func (d *FailedSQLDump) Dump(workerIndex int, rows []int, query string, values []string, columns int, err error) {
+	if d == nil {
+		return
+	}
+	args := make([]string, len(values))
+	for i, v := range values {
+		if columns > 0 && slices.Contains(d.masked, i%columns) {
+			args[i] = quoteSQLString(maskedValue)
+		} else {
+			args[i] = quoteSQLString(v)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// a failing dump must not hide the error of the batch itself
+	_, _ = fmt.Fprintf(d.w, "-- worker %d, rows %v: %s\n%s;\n-- args: %s\n\n",
+		workerIndex, rowRanges(rows), strings.ReplaceAll(err.Error(), "\n", " "),
+		interpolateQuery(query, args), strings.Join(args, ", "))
+}
+
+// Close closes the dump file
+func (d *FailedSQLDump) Close() error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.w.Close()
+}
+
+// quoteSQLString returns s as a MySQL string literal
+func quoteSQLString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`).Replace(s) + "'"
+}
+
+// interpolateQuery replaces the ? placeholders of query with args, placeholders in string literals,
+// quoted identifiers and comments are left alone
+func interpolateQuery(query string, args []string) string {
+	var b strings.Builder
+	next := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := closingQuote(query, i)
+			b.WriteString(query[i : end+1])
+			i = end
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+4])
+			i += end + 3
+		case c == '?' && next < len(args):
+			b.WriteString(args[next])
+			next++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// closingQuote returns the index of the quote closing the one at start (or the last index if it is not closed),
+// backslash escapes are skipped in string literals
+func closingQuote(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch {
+		case query[i] == '\\' && quote != '`':
+			i++
+		case query[i] == quote:
+			return i
+		}
+	}
+	return len(query) - 1
+}
@@ -0,0 +1,39 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestQuoteSQLString(t *testing.T) {
+	assert.Equal(t, quoteSQLString("abc"), "'abc'")
+	assert.Equal(t, quoteSQLString(`it's a \ test`+"\n"), `'it\'s a \\ test\n'`)
+}
+
+func TestInterpolateQuery(t *testing.T) {
+	args := []string{"'1'", "'POINT(1 2)'", "'x'"}
+	query := "/* run? */ INSERT INTO `t?` (a,b) VALUES (?,ST_GeomFromText(?, 'it\\'s?')),(?,?)"
+	assert.Equal(t, interpolateQuery(query, args),
+		"/* run? */ INSERT INTO `t?` (a,b) VALUES ('1',ST_GeomFromText('POINT(1 2)', 'it\\'s?')),('x',?)")
+}
+
+func TestFailedSQLDump(t *testing.T) {
+	var buf bytes.Buffer
+	d := &FailedSQLDump{w: nopWriteCloser{&buf}, masked: []int{1}}
+	d.Dump(2, []int{4, 5}, "INSERT INTO users (name,password) VALUES (?,?), (?,?)",
+		[]string{"alice", "secret", "o'brien", "hunter2"}, 2, errors.New("Error 1062: Duplicate entry"))
+
+	assert.Equal(t, buf.String(), `-- worker 2, rows [[4 5]]: Error 1062: Duplicate entry
+INSERT INTO users (name,password) VALUES ('alice','***'), ('o\'brien','***');
+-- args: 'alice', '***', 'o\'brien', '***'
+
+`)
+}
+
+func TestOpenFailedSQLDumpUnknownMaskColumn(t *testing.T) {
+	_, err := OpenFailedSQLDump(t.TempDir()+"/failed.sql", []string{"name"}, []string{"password"})
+	assert.ErrorContains(t, err, "unknown column 'password'")
+}
@@ -0,0 +1,126 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// EncodingAuto is the -input-encoding which detects the encoding of every input: by its BOM, else UTF-16 by the
+// zero bytes of ASCII text, else UTF-8 if the start of the input is valid UTF-8 and Windows-1252 otherwise
+const EncodingAuto = "auto"
+
+// inputEncodings are the encodings of -input-encoding besides EncodingAuto, by name
+var inputEncodings = map[string]encoding.Encoding{
+	"utf-8":        unicode.UTF8,
+	"utf-16":       unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM),
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	"latin1":       charmap.ISO8859_1,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"iso-8859-15":  charmap.ISO8859_15,
+	"windows-1250": charmap.Windows1250,
+	"windows-1252": charmap.Windows1252,
+}
+
+// encodingSniffSize are the bytes at the start of an input the encoding is detected from
+const encodingSniffSize = 64 << 10
+
+// encodingNames returns the names of -input-encoding
+func encodingNames() []string {
+	names := []string{EncodingAuto}
+	for name := range inputEncodings {
+		names = append(names, name)
+	}
+	slices.Sort(names[1:])
+	return names
+}
+
+// validateInputEncoding checks -input-encoding
+func (c *Config) validateInputEncoding() error {
+	if _, ok := inputEncodings[strings.ToLower(c.InputEncoding)]; !ok && !strings.EqualFold(c.InputEncoding, EncodingAuto) {
+		return fmt.Errorf("invalid input-encoding '%s', allowed are: %s", c.InputEncoding, strings.Join(encodingNames(), ", "))
+	}
+	return nil
+}
+
+// decodeInput returns the content of input name as UTF-8 without its BOM, decoded from encoding name
+func decodeInput(name string, r io.Reader, encodingName string) io.Reader {
+	b := bufio.NewReaderSize(r, encodingSniffSize)
+	// the encoding is detected from the bytes of the first read, waiting for more would hold up a stream. An error
+	// is returned by the next read again.
+	_, _ = b.Peek(1)
+	sniff, _ := b.Peek(b.Buffered())
+	// a Config filled in by an embedding program may leave the encoding empty
+	encodingName = strings.ToLower(cmp.Or(encodingName, EncodingAuto))
+	if encodingName == EncodingAuto {
+		encodingName = detectEncoding(sniff)
+		if encodingName != "utf-8" {
+			log.Printf("Reading %s as %s", name, encodingName)
+		}
+	}
+	if encodingName == "utf-8" {
+		if bytes.HasPrefix(sniff, utf8BOM) {
+			_, _ = b.Discard(len(utf8BOM))
+		}
+		return b
+	}
+	// the UTF-16 decoders strip a BOM themselves
+	return transform.NewReader(b, inputEncodings[encodingName].NewDecoder())
+}
+
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+// detectEncoding returns the encoding of the input starting with sniff
+func detectEncoding(sniff []byte) string {
+	switch {
+	case bytes.HasPrefix(sniff, utf8BOM):
+		return "utf-8"
+	case bytes.HasPrefix(sniff, utf16LEBOM):
+		return "utf-16"
+	case bytes.HasPrefix(sniff, utf16BEBOM):
+		return "utf-16"
+	}
+	// ASCII text in UTF-16 has a zero byte in every other position
+	var even, odd int
+	for i, c := range sniff {
+		if c == 0 && i%2 == 0 {
+			even++
+		} else if c == 0 {
+			odd++
+		}
+	}
+	if half := len(sniff) / 2; half > 0 && odd > half/2 && even == 0 {
+		return "utf-16le"
+	} else if half > 0 && even > half/2 && odd == 0 {
+		return "utf-16be"
+	}
+	// the sniffed bytes may end in the middle of a character
+	for i := len(sniff) - 1; i >= 0 && i >= len(sniff)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(sniff[i]) {
+			if !utf8.FullRune(sniff[i:]) {
+				sniff = sniff[:i]
+			}
+			break
+		}
+	}
+	if utf8.Valid(sniff) {
+		return "utf-8"
+	}
+	return "windows-1252"
+}
@@ -0,0 +1,70 @@
+package loader
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/unicode"
+	"gotest.tools/v3/assert"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	utf16le, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().Bytes([]byte("name,city\n"))
+	assert.NilError(t, err)
+	utf16be, err := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewEncoder().Bytes([]byte("name,city\n"))
+	assert.NilError(t, err)
+	for want, input := range map[string][]byte{
+		"utf-8":        []byte("name,city\nJosé,Zürich\n"),
+		"windows-1252": []byte("name,city\nJos\xe9,Z\xfcrich\n"),
+		"utf-16":       []byte("\xff\xfen\x00"),
+		"utf-16le":     utf16le,
+		"utf-16be":     utf16be,
+	} {
+		assert.Equal(t, detectEncoding(input), want, string(input))
+	}
+	// a character cut off by the end of the sniffed bytes is no sign of another encoding
+	assert.Equal(t, detectEncoding([]byte("name\nZ\xc3")), "utf-8")
+	assert.Equal(t, detectEncoding(append(bytes.Repeat([]byte("é"), 10), 0xe2, 0x82)), "utf-8")
+}
+
+func TestDecodeInput(t *testing.T) {
+	utf16, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().Bytes([]byte("name,city\nJosé,Zürich\n"))
+	assert.NilError(t, err)
+	for _, c := range []struct {
+		encoding string
+		input    string
+	}{
+		{EncodingAuto, "name,city\nJosé,Zürich\n"},
+		{EncodingAuto, "\xef\xbb\xbfname,city\nJosé,Zürich\n"},
+		{EncodingAuto, "name,city\nJos\xe9,Z\xfcrich\n"},
+		{EncodingAuto, string(utf16)},
+		{"", "\xef\xbb\xbfname,city\nJosé,Zürich\n"},
+		{"utf-8", "\xef\xbb\xbfname,city\nJosé,Zürich\n"},
+		{"Latin1", "name,city\nJos\xe9,Z\xfcrich\n"},
+		{"utf-16le", string(utf16)},
+		{"utf-16", string(utf16)},
+	} {
+		content, err := io.ReadAll(decodeInput("people.csv", strings.NewReader(c.input), c.encoding))
+		assert.NilError(t, err)
+		assert.Equal(t, string(content), "name,city\nJosé,Zürich\n", c.encoding)
+	}
+
+	c, err := ParseFlags([]string{"-input-encoding", "ebcdic"})
+	assert.ErrorContains(t, err, "invalid input-encoding 'ebcdic', allowed are: auto, iso-8859-1, iso-8859-15, latin1, utf-16")
+	c, err = ParseFlags([]string{"-input-encoding", "Windows-1252"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.InputEncoding, "Windows-1252")
+}
+
+func TestNextCSVReaderBOM(t *testing.T) {
+	c := Config{InputEncoding: EncodingAuto}
+	_, reader, header, err := NextCSVReader(NewReaderSource("people.csv", strings.NewReader("\xef\xbb\xbfname,city\nJos\xc3\xa9,Z\xc3\xbcrich\n")), c)
+	assert.NilError(t, err)
+	// the BOM doesn't end up in the first column name
+	assert.DeepEqual(t, header, []string{"name", "city"})
+	row, err := reader.Read()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, row, []string{"José", "Zürich"})
+}
@@ -0,0 +1,74 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Explain prints the first statements of the import with their values bound, to check the column order and the
+// converted values before importing into production. It is safe for concurrent use by all workers. A nil *Explain
+// prints nothing.
+type Explain struct {
+	mu sync.Mutex
+	w  io.Writer
+	// left is the number of statements still printed
+	left int
+	// dialect is the dialect of the statements, bind binds the values of a batch of a table
+	dialect Dialect
+	bind    func(table string, values []string, rows int) []any
+}
+
+// NewExplain prints the first n statements of dialect d to w, with the values bound by bind
+func NewExplain(w io.Writer, n int, d Dialect, bind func(table string, values []string, rows int) []any) *Explain {
+	return &Explain{w: w, left: n, dialect: d, bind: bind}
+}
+
+// Statement prints the statement of a batch of rows with values bound, as long as statements are left
+func (e *Explain) Statement(workerIndex int, rows []int, query string, table string, values []string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.left <= 0 {
+		return
+	}
+	e.left--
+	args := e.bind(table, values, len(rows))
+	literals := make([]string, len(args))
+	for i, arg := range args {
+		literals[i] = sqlLiteral(arg)
+	}
+	// numbered placeholders ($1) aren't filled in, their arguments are listed instead
+	numbered := e.dialect.Placeholder(1) != "?"
+	if !numbered {
+		query = interpolateQuery(query, literals)
+	}
+	// explaining is best-effort, like the dump of the failed batches
+	_, _ = fmt.Fprintf(e.w, "-- worker %d, rows %v\n%s;\n", workerIndex, rowRanges(rows), query)
+	if numbered {
+		_, _ = fmt.Fprintf(e.w, "-- args: %s\n", strings.Join(literals, ", "))
+	}
+	_, _ = fmt.Fprintln(e.w)
+}
+
+// sqlLiteral returns a bound argument as SQL literal
+func sqlLiteral(arg any) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return quoteSQLString(v)
+	case []byte:
+		return quoteSQLString(string(v))
+	case bool, int, int64, float64:
+		return fmt.Sprint(v)
+	case time.Time:
+		return quoteSQLString(v.Format("2006-01-02 15:04:05.999999"))
+	default:
+		return quoteSQLString(fmt.Sprint(v))
+	}
+}
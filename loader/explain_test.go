@@ -0,0 +1,57 @@
+package loader
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestExplainStatement(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-empty-as-null", "-explain", "1"})
+	assert.NilError(t, err)
+
+	var out strings.Builder
+	e := NewExplain(&out, 1, l.config.dialect(), l.bindTableArgs)
+	e.Statement(2, []int{1, 2}, "/* tag? */ INSERT INTO t (rank, domain) VALUES (?, ?), (?, ?)", "", []string{"1", "o'hara.com", "2", ""})
+	e.Statement(2, []int{3}, "INSERT INTO t (rank, domain) VALUES (?, ?)", "", []string{"3", "x.com"})
+	assert.Equal(t, out.String(),
+		"-- worker 2, rows [[1 2]]\n/* tag? */ INSERT INTO t (rank, domain) VALUES ('1', 'o\\'hara.com'), ('2', NULL);\n\n")
+
+	var nilExplain *Explain
+	nilExplain.Statement(0, []int{1}, "INSERT INTO t VALUES (?)", "", []string{"1"})
+
+	_, err = ParseFlags([]string{"-explain", "-1"})
+	assert.ErrorContains(t, err, "invalid explain -1, must not be negative")
+}
+
+func TestExplainNumberedPlaceholders(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-dialect", "postgres", "-explain", "1"})
+	assert.NilError(t, err)
+
+	var out strings.Builder
+	NewExplain(&out, 1, l.config.dialect(), l.bindTableArgs).Statement(0, []int{7}, `INSERT INTO "t" ("rank") VALUES ($1)`, "", []string{"7"})
+	assert.Equal(t, out.String(), "-- worker 0, rows [[7 7]]\nINSERT INTO \"t\" (\"rank\") VALUES ($1);\n-- args: '7'\n\n")
+}
+
+func TestSQLLiteral(t *testing.T) {
+	for _, tc := range []struct {
+		arg  any
+		want string
+	}{
+		{nil, "NULL"},
+		{"a'b", `'a\'b'`},
+		{[]byte("x"), "'x'"},
+		{int64(42), "42"},
+		{2.5, "2.5"},
+		{true, "true"},
+		{time.Date(2024, 1, 15, 12, 30, 0, 0, time.UTC), "'2024-01-15 12:30:00'"},
+	} {
+		assert.Equal(t, sqlLiteral(tc.arg), tc.want)
+	}
+}
@@ -1,7 +1,8 @@
-package main
+package loader
 
 // this is just for exporting private functions to make them available for testing
 
 // for a generic function we need to provide an instance of the function (here string)
 var StringToAnyList = toAnyList[string]
+var IntToAnyList = toAnyList[int]
 var GenerateQuestionsMark = generateQuestionsMark
@@ -0,0 +1,373 @@
+package loader
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ExportStats are the counters of an export
+type ExportStats struct {
+	Rows int64
+	// Chunks are the key ranges selected
+	Chunks int64
+	// Files are the files written, one per part
+	Files    []string
+	Duration time.Duration
+}
+
+// Exporter writes the rows of a table to CSV files, the reverse of an import: the table is split into ranges of
+// -export-chunk keys of its integer -export-key which the workers select concurrently, the chunks are written in
+// key order.
+type Exporter struct {
+	db     *sql.DB
+	config Config
+}
+
+// exportChunk is the key range [from, to) and, once selected, its rows encoded as CSV
+type exportChunk struct {
+	index    int
+	from, to int64
+	data     []byte
+	rows     int64
+	err      error
+}
+
+// NewExporter exports the -table of c from db
+func NewExporter(db *sql.DB, c Config) *Exporter {
+	return &Exporter{db: db, config: c}
+}
+
+// Run exports the table to -export-file until all key ranges are written or ctx is done
+func (e *Exporter) Run(ctx context.Context) (stats ExportStats, err error) {
+	start := time.Now()
+	defer func() { stats.Duration = time.Since(start) }()
+
+	key := e.config.ExportKey
+	if key == "" {
+		if key, err = e.config.primaryKeyColumn(ctx, e.db, e.config.Table); err != nil {
+			return stats, err
+		}
+	}
+	header, err := e.columns(ctx)
+	if err != nil {
+		return stats, err
+	}
+	var first, last sql.NullInt64
+	query := fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s", quoteIdentifier(e.config.dialect(), key), quoteIdentifier(e.config.dialect(), key), quoteTable(e.config.dialect(), e.config.Table))
+	if err = e.db.QueryRowContext(ctx, query).Scan(&first, &last); err != nil {
+		return stats, fmt.Errorf("could not read the key range of table %s, -export-key %s must be an integer column: %w", e.config.Table, key, err)
+	}
+
+	out := newExportWriter(cmp.Or(e.config.ExportFile, e.config.Table+".csv"), header, e.config.Delimiter, e.config.ExportPartRows)
+	defer func() {
+		stats.Files = out.files
+		// the part of a failed export is left as far as it got
+		if err := out.closePart(); err != nil {
+			log.Error(err.Error())
+		}
+	}()
+	progress := NewProgress(0, start)
+	reporter := NewProgressReporter(resolveProgressMode(e.config.Progress), os.Stderr, e.config.ProgressInterval, progress, e.config.Workers, start)
+	reporter.Start()
+	defer reporter.Stop()
+	var metrics *Metrics
+	if e.config.MetricsAddr != "" {
+		metrics = NewMetrics(nil, e.db, nil, e.config.Workers)
+		if err = metrics.Serve(e.config.MetricsAddr); err != nil {
+			return stats, err
+		}
+		defer func() {
+			if err := metrics.Close(); err != nil {
+				log.Error(err.Error())
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// the chunks selected are held until the ones before them are written, at most two per worker
+	window := make(chan struct{}, 2*e.config.Workers)
+	chunks := make(chan *exportChunk)
+	results := make(chan *exportChunk)
+	go func() {
+		defer close(chunks)
+		if !first.Valid {
+			return
+		}
+		chunk := int64(e.config.ExportChunk)
+		for i, from := 0, first.Int64; from <= last.Int64; i, from = i+1, from+chunk {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case chunks <- &exportChunk{index: i, from: from, to: from + chunk}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	query = fmt.Sprintf("SELECT * FROM %s WHERE %s >= ? AND %s < ? ORDER BY %s", quoteTable(e.config.dialect(), e.config.Table),
+		quoteIdentifier(e.config.dialect(), key), quoteIdentifier(e.config.dialect(), key), quoteIdentifier(e.config.dialect(), key))
+	query, _ = bindPlaceholders(e.config.dialect(), query, 0)
+	for i := range e.config.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				begin := time.Now()
+				c.data, c.rows, c.err = e.selectChunk(ctx, query, c.from, c.to)
+				metrics.Batch(i, time.Since(begin), c.err)
+				reporter.Batch(i)
+				select {
+				case results <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]*exportChunk)
+	next := 0
+	for c := range results {
+		if c.err != nil {
+			return stats, c.err
+		}
+		pending[c.index] = c
+		for c, ok := pending[next]; ok; c, ok = pending[next] {
+			delete(pending, next)
+			if err = out.Write(c.data, c.rows); err != nil {
+				return stats, err
+			}
+			stats.Rows += c.rows
+			stats.Chunks++
+			next++
+			<-window
+			progress.Read(out.written, stats.Rows)
+			progress.Update(out.written, time.Now())
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return stats, err
+	}
+	return stats, out.Close()
+}
+
+// columns returns the columns of the table in the order of SELECT *
+func (e *Exporter) columns(ctx context.Context) ([]string, error) {
+	rows, err := e.db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1=0", quoteTable(e.config.dialect(), e.config.Table)))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the columns of table %s: %w", e.config.Table, err)
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+// selectChunk selects the rows of the keys [from, to) and returns them encoded as CSV, NULL as the first
+// -null-values value or an empty field
+func (e *Exporter) selectChunk(ctx context.Context, query string, from int64, to int64) ([]byte, int64, error) {
+	rows, err := e.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not select the keys %d to %d of table %s: %w", from, to-1, e.config.Table, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, 0, err
+	}
+	null := ""
+	if len(e.config.NullValues) > 0 {
+		null = e.config.NullValues[0]
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+	var b bytes.Buffer
+	w := newExportCSVWriter(&b, e.config.Delimiter)
+	var n int64
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+		for i, v := range values {
+			record[i] = string(v)
+			if v == nil {
+				record[i] = null
+			}
+		}
+		if err = w.Write(record); err != nil {
+			return nil, 0, err
+		}
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("could not select the keys %d to %d of table %s: %w", from, to-1, e.config.Table, err)
+	}
+	w.Flush()
+	return b.Bytes(), n, w.Error()
+}
+
+func newExportCSVWriter(w io.Writer, delimiter rune) *csv.Writer {
+	cw := csv.NewWriter(w)
+	cw.Comma = cmp.Or(delimiter, ',')
+	return cw
+}
+
+// primaryKeyColumn returns the primary key column of a MySQL table, which has to be a single one
+func (c *Config) primaryKeyColumn(ctx context.Context, db *sql.DB, table string) (string, error) {
+	if !c.isMySQL() {
+		return "", fmt.Errorf("the %s dialect requires -export-key", c.Dialect)
+	}
+	rows, err := db.QueryContext(ctx, "SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY' ORDER BY ORDINAL_POSITION", table)
+	if err != nil {
+		return "", fmt.Errorf("could not read the primary key of table %s: %w", table, err)
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return "", err
+		}
+		columns = append(columns, column)
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+	if len(columns) != 1 {
+		return "", fmt.Errorf("table %s has a primary key of %d columns, -export-key has to name an integer column to split it by", table, len(columns))
+	}
+	return columns[0], nil
+}
+
+// exportWriter writes the chunks to filename, a .gz file gzip compressed. With partRows a new part starts after the
+// chunk which reached partRows rows, the parts are numbered in front of the extension: domains-1.csv.gz. Every part
+// starts with the header.
+type exportWriter struct {
+	filename  string
+	header    []string
+	delimiter rune
+	partRows  int64
+
+	file    io.WriteCloser
+	gz      *gzip.Writer
+	w       io.Writer
+	rows    int64
+	files   []string
+	written int64
+}
+
+func newExportWriter(filename string, header []string, delimiter rune, partRows int64) *exportWriter {
+	return &exportWriter{filename: filename, header: header, delimiter: delimiter, partRows: partRows}
+}
+
+// Write writes a chunk of rows, the header first when a part starts
+func (w *exportWriter) Write(data []byte, rows int64) error {
+	if w.w == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	n, err := w.w.Write(data)
+	w.written += int64(n)
+	if err != nil {
+		return err
+	}
+	w.rows += rows
+	if w.partRows > 0 && w.rows >= w.partRows {
+		return w.closePart()
+	}
+	return nil
+}
+
+func (w *exportWriter) open() error {
+	name := w.filename
+	if w.partRows > 0 {
+		dir, base := filepath.Split(name)
+		stem, ext, _ := strings.Cut(base, ".")
+		name = fmt.Sprintf("%s%s-%d", dir, stem, len(w.files)+1)
+		if ext != "" {
+			name += "." + ext
+		}
+	}
+	if name == "-" {
+		w.file = nopWriteCloser{os.Stdout}
+	} else {
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		w.file = f
+	}
+	w.files = append(w.files, name)
+	w.w, w.gz = w.file, nil
+	if strings.HasSuffix(name, ".gz") {
+		w.gz = gzip.NewWriter(w.file)
+		w.w = w.gz
+	}
+	w.rows = 0
+	var b bytes.Buffer
+	cw := newExportCSVWriter(&b, w.delimiter)
+	if err := cw.Write(w.header); err != nil {
+		return err
+	}
+	cw.Flush()
+	n, err := w.w.Write(b.Bytes())
+	w.written += int64(n)
+	return err
+}
+
+func (w *exportWriter) closePart() error {
+	if w.w == nil {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		err = w.gz.Close()
+	}
+	err = errors.Join(err, w.file.Close())
+	w.file, w.gz, w.w = nil, nil, nil
+	return err
+}
+
+// Close closes the current part, a table without rows gets a file with the header only
+func (w *exportWriter) Close() error {
+	if w.w == nil && len(w.files) == 0 {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	return w.closePart()
+}
+
+// nopWriteCloser is a writer which isn't closed, like stdout
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,110 @@
+package loader
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+// expectExport expects the queries of an export of the keys 1 to 5 of table domain in chunks of 2 keys
+func expectExport(mock sqlmock.Sqlmock) {
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectQuery(`SELECT * FROM "domain" WHERE 1=0`).WillReturnRows(sqlmock.NewRows([]string{"id", "Domain"}))
+	mock.ExpectQuery(`SELECT MIN("id"), MAX("id") FROM "domain"`).WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(1, 5))
+	const query = `SELECT * FROM "domain" WHERE "id" >= ? AND "id" < ? ORDER BY "id"`
+	mock.ExpectQuery(query).WithArgs(int64(1), int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "Domain"}).AddRow(1, "google.com").AddRow(2, "youtube.com"))
+	mock.ExpectQuery(query).WithArgs(int64(3), int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "Domain"}).AddRow(3, nil).AddRow(4, "example.com, inc."))
+	mock.ExpectQuery(query).WithArgs(int64(5), int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "Domain"}).AddRow(5, "baidu.com"))
+}
+
+func TestExporterRun(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "domains.csv.gz")
+	c, err := ParseFlags([]string{"-dialect", "sqlite", "-table", "domain", "-export-key", "id", "-export-chunk", "2",
+		"-export-file", filename, "-workers", "3", "-null-values", `\N`})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	expectExport(mock)
+
+	stats, err := NewExporter(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.Rows, int64(5))
+	assert.Equal(t, stats.Chunks, int64(3))
+	assert.DeepEqual(t, stats.Files, []string{filename})
+
+	f, err := os.Open(filename)
+	assert.NilError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NilError(t, err)
+	content, err := io.ReadAll(gz)
+	assert.NilError(t, err)
+	// the chunks are written in key order whichever worker selected them first
+	assert.Equal(t, string(content), "id,Domain\n1,google.com\n2,youtube.com\n3,\\N\n4,\"example.com, inc.\"\n5,baidu.com\n")
+}
+
+func TestExporterParts(t *testing.T) {
+	dir := t.TempDir()
+	c, err := ParseFlags([]string{"-dialect", "sqlite", "-table", "domain", "-export-key", "id", "-export-chunk", "2",
+		"-export-file", filepath.Join(dir, "domains.csv"), "-export-part-rows", "3", "-workers", "1"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	expectExport(mock)
+
+	stats, err := NewExporter(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	// a part ends with the chunk reaching the rows of a part
+	assert.DeepEqual(t, stats.Files, []string{filepath.Join(dir, "domains-1.csv"), filepath.Join(dir, "domains-2.csv")})
+	content, err := os.ReadFile(stats.Files[0])
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "id,Domain\n1,google.com\n2,youtube.com\n3,\n4,\"example.com, inc.\"\n")
+	content, err = os.ReadFile(stats.Files[1])
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "id,Domain\n5,baidu.com\n")
+}
+
+func TestExporterEmptyTable(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	c, err := ParseFlags([]string{"-dialect", "sqlite", "-table", "domain", "-export-key", "id", "-export-file", filename})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(`SELECT * FROM "domain" WHERE 1=0`).WillReturnRows(sqlmock.NewRows([]string{"id", "Domain"}))
+	mock.ExpectQuery(`SELECT MIN("id"), MAX("id") FROM "domain"`).WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(nil, nil))
+
+	stats, err := NewExporter(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, stats.Rows, int64(0))
+	content, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "id,Domain\n")
+}
+
+func TestExportFlags(t *testing.T) {
+	for want, args := range map[string][]string{
+		"invalid export-chunk 0, must be at least 1":              {"-export-chunk", "0"},
+		"-export-part-rows can't be combined with -export-file -": {"-export-file", "-", "-export-part-rows", "10"},
+		"invalid export-part-rows -1, must not be negative":       {"-export-part-rows", "-1"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want)
+	}
+	c, err := ParseFlags([]string{"-dialect", "sqlite", "-dry-run"})
+	assert.NilError(t, err)
+	_, err = NewExporter(nil, c).Run(context.Background())
+	assert.ErrorContains(t, err, "the sqlite dialect requires -export-key")
+}
@@ -0,0 +1,224 @@
+package loader
+
+import (
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the functions of a -generate expression, written as {{name}}
+const (
+	// GenerateFile is the name of the input of the row
+	GenerateFile = "file"
+	// GenerateLine is the line the row starts in its input
+	GenerateLine = "line"
+	// GenerateRow is the number of the data row over all inputs of the run
+	GenerateRow = "row"
+	// GenerateNow is the time the row was read
+	GenerateNow = "now"
+	// GenerateUUID is a random (version 4) UUID
+	GenerateUUID = "uuid"
+	// GenerateRunID is the run_id of the run, the same for all rows
+	GenerateRunID = "run_id"
+	// GenerateStarted is the time the run started, the same for all rows
+	GenerateStarted = "started"
+)
+
+var generateFunctions = []string{GenerateFile, GenerateLine, GenerateRow, GenerateNow, GenerateUUID, GenerateRunID, GenerateStarted}
+
+// the columns of -lineage, generated for every row to tell which run inserted it from where
+const (
+	LineageFile = "load_file"
+	LineageLine = "load_line"
+	LineageID   = "load_id"
+	LineageTime = "load_time"
+)
+
+// lineageColumns are the -lineage columns with their template and the type -create-table creates them with
+var lineageColumns = []struct {
+	column, template, columnType string
+}{
+	{LineageFile, "{{" + GenerateFile + "}}", defaultColumnType},
+	{LineageLine, "{{" + GenerateLine + "}}", "BIGINT"},
+	{LineageID, "{{" + GenerateRunID + "}}", "VARCHAR(64)"},
+	{LineageTime, "{{" + GenerateStarted + "}}", "DATETIME"},
+}
+
+// generatedColumn is a -generate column: its value is the text of the expression with every {{name}} replaced by
+// the field of the CSV column name or the value of the function name
+type generatedColumn struct {
+	column string
+	parts  []generatePart
+}
+
+// generatePart is a piece of an expression: a literal text, a CSV field (index) or a function
+type generatePart struct {
+	text     string
+	index    int
+	function string
+}
+
+// generateInput is what the functions of a row's expressions know about it
+type generateInput struct {
+	file string
+	line int
+	row  int
+	now  time.Time
+	// runID and started are the RunID and the start of the run
+	runID   string
+	started time.Time
+}
+
+// parseGenerated splits expr of column into its parts, a {{name}} is the CSV column name if the headers have it
+// and a function otherwise
+func parseGenerated(column string, expr string, headers []string) (generatedColumn, error) {
+	g := generatedColumn{column: column}
+	for rest := expr; rest != ""; {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			g.parts = append(g.parts, generatePart{text: rest, index: -1})
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return g, fmt.Errorf("invalid -generate %s='%s', {{ is missing its }}", column, expr)
+		}
+		if start > 0 {
+			g.parts = append(g.parts, generatePart{text: rest[:start], index: -1})
+		}
+		name := strings.TrimSpace(rest[start+2 : start+end])
+		if index := slices.Index(headers, name); index >= 0 {
+			g.parts = append(g.parts, generatePart{index: index})
+		} else if slices.Contains(generateFunctions, name) {
+			g.parts = append(g.parts, generatePart{index: -1, function: name})
+		} else {
+			return g, fmt.Errorf("invalid -generate %s='%s', {{%s}} is neither a CSV column nor one of: %s", column, expr, name, strings.Join(generateFunctions, ", "))
+		}
+		rest = rest[start+end+2:]
+	}
+	return g, nil
+}
+
+// value returns the value of the column for row
+func (g generatedColumn) value(row []string, in generateInput) string {
+	if len(g.parts) == 1 && g.parts[0].index >= 0 {
+		return row[g.parts[0].index]
+	}
+	var b strings.Builder
+	for _, p := range g.parts {
+		switch {
+		case p.index >= 0:
+			b.WriteString(row[p.index])
+		case p.function == GenerateFile:
+			b.WriteString(in.file)
+		case p.function == GenerateLine:
+			b.WriteString(strconv.Itoa(in.line))
+		case p.function == GenerateRow:
+			b.WriteString(strconv.Itoa(in.row))
+		case p.function == GenerateNow:
+			b.WriteString(in.now.Format(time.DateTime))
+		case p.function == GenerateUUID:
+			b.WriteString(newUUID())
+		case p.function == GenerateRunID:
+			b.WriteString(in.runID)
+		case p.function == GenerateStarted:
+			b.WriteString(in.started.Format(time.DateTime))
+		default:
+			b.WriteString(p.text)
+		}
+	}
+	return b.String()
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	var u [16]byte
+	_, _ = rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// generatedTemplates returns the templates of the -generate columns and of the -lineage columns, a -generate column
+// named like a -lineage one wins
+func (c *Config) generatedTemplates() map[string]string {
+	if !c.Lineage {
+		return c.Generated
+	}
+	templates := make(map[string]string, len(c.Generated)+len(lineageColumns))
+	for _, l := range lineageColumns {
+		templates[l.column] = l.template
+	}
+	maps.Copy(templates, c.Generated)
+	return templates
+}
+
+// lineageTypes returns types with the types of the -lineage columns -create-table creates, unless -column-types
+// has them
+func (c *Config) lineageTypes(types map[string]string) map[string]string {
+	if !c.Lineage {
+		return types
+	}
+	withLineage := maps.Clone(types)
+	if withLineage == nil {
+		withLineage = map[string]string{}
+	}
+	for _, l := range lineageColumns {
+		if _, ok := c.ColumnTypes[l.column]; !ok && c.Generated[l.column] == "" {
+			withLineage[l.column] = l.columnType
+		}
+	}
+	return withLineage
+}
+
+// generatedColumns returns the -generate and -lineage columns in name order
+func (c *Config) generatedColumns() []string {
+	templates := c.generatedTemplates()
+	columns := make([]string, 0, len(templates))
+	for column := range templates {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// resolveGenerated parses the -generate expressions against the CSV headers, a generated column can't be a CSV
+// or a -constant column too
+func (c *Config) resolveGenerated(headers []string) error {
+	c.generated = nil
+	templates := c.generatedTemplates()
+	for _, column := range c.generatedColumns() {
+		if len(c.ColumnMap) > 0 && slices.ContainsFunc(c.ColumnMap, func(m ColumnMapping) bool { return m.Column == column }) ||
+			len(c.ColumnMap) == 0 && slices.Contains(headers, column) {
+			return fmt.Errorf("column %s gets a -generate and a CSV column", column)
+		}
+		if _, ok := c.Constants[column]; ok {
+			return fmt.Errorf("column %s gets a -generate and a -constant", column)
+		}
+		g, err := parseGenerated(column, templates[column], headers)
+		if err != nil {
+			return err
+		}
+		c.generated = append(c.generated, g)
+	}
+	return nil
+}
+
+// appendGenerated appends the values of the -generate columns to row
+func (c *Config) appendGenerated(row []string, in generateInput) []string {
+	if len(c.generated) == 0 {
+		return row
+	}
+	in.runID, in.started = c.RunID, c.started
+	values := make([]string, 0, len(row)+len(c.generated))
+	values = append(values, row...)
+	for _, g := range c.generated {
+		values = append(values, g.value(row, in))
+	}
+	return values
+}
@@ -0,0 +1,115 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseGenerated(t *testing.T) {
+	headers := []string{"first", "last", "row"}
+	in := generateInput{file: "people.csv", line: 3, row: 2, now: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)}
+	row := []string{"Ada", "Lovelace", "x"}
+	for expr, want := range map[string]string{
+		"{{first}} {{ last }}":         "Ada Lovelace",
+		"{{file}}:{{line}}":            "people.csv:3",
+		"imported {{now}}":             "imported 2024-03-01 12:30:00",
+		"{{first}}":                    "Ada",
+		"plain":                        "plain",
+		"{{row}}":                      "x",
+		"{{last}}, {{first}} ({{row}}": "Lovelace, Ada (x",
+	} {
+		g, err := parseGenerated("c", expr, headers)
+		assert.NilError(t, err)
+		assert.Equal(t, g.value(row, in), want, expr)
+	}
+	g, err := parseGenerated("id", "{{uuid}}", nil)
+	assert.NilError(t, err)
+	id := g.value(nil, in)
+	assert.Assert(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id), id)
+	assert.Assert(t, g.value(nil, in) != id)
+
+	_, err = parseGenerated("c", "{{middle}}", headers)
+	assert.ErrorContains(t, err, "invalid -generate c='{{middle}}', {{middle}} is neither a CSV column nor one of: file, line, row, now, uuid")
+	_, err = parseGenerated("c", "{{first", headers)
+	assert.ErrorContains(t, err, "{{ is missing its }}")
+}
+
+func TestResolveGenerated(t *testing.T) {
+	headers := []string{"first", "last"}
+	c, err := ParseFlags([]string{"-generate", "name={{first}} {{last}}", "-generate", "id={{uuid}}", "-constant", "source=crm"})
+	assert.NilError(t, err)
+	assert.NilError(t, c.ResolveColumns(headers))
+	// the generated columns follow the CSV columns and precede the constants
+	assert.DeepEqual(t, c.InsertColumns(headers), []string{"first", "last", "id", "name", "source"})
+
+	for want, args := range map[string][]string{
+		"column last gets a -generate and a CSV column": {"-generate", "last={{first}}"},
+		"column id gets a -generate and a -constant":    {"-generate", "id={{uuid}}", "-constant", "id=1"},
+	} {
+		c, err := ParseFlags(args)
+		assert.NilError(t, err)
+		assert.ErrorContains(t, c.ResolveColumns(headers), want)
+	}
+	c, err = ParseFlags([]string{"-mode", "load-data", "-generate", "id={{uuid}}"})
+	assert.NilError(t, err)
+	assert.Assert(t, !c.useLoadData(), "LOAD DATA can't generate values")
+}
+
+func TestImportGenerated(t *testing.T) {
+	l := withConnConfig(t, 5)
+	filename := filepath.Join(t.TempDir(), "people.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("first,last,age\nAda,Lovelace,36\nAlan,Turing,41\n"), 0o644))
+	var err error
+	l.config, err = ParseFlags([]string{"-csv", filename, "-dialect", "sqlite", "-table", "people", "-workers", "1",
+		"-map", "age", "-generate", "name={{first}} {{last}}", "-generate", "source={{file}}:{{line}}:{{row}}", "-constant", "batch=7"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec(`INSERT INTO "people" ("age","name","source","batch") VALUES (?,?,?,?), (?,?,?,?)`).
+		WithArgs("36", "Ada Lovelace", filename+":2:1", "7", "41", "Alan Turing", filename+":3:2", "7").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	stats, err := New(db, l.config).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.RowsInserted, int64(2))
+}
+
+func TestImportLineage(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "people.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("first,last\nAda,Lovelace\nAlan,Turing\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-table", "people", "-workers", "1",
+		"-lineage", "-run-id", "3f2a", "-create-table", "-column-types", "load_file=VARCHAR(255)"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `people` (`first` TEXT, `last` TEXT, `load_file` VARCHAR(255), `load_id` VARCHAR(64), `load_line` BIGINT, `load_time` DATETIME)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO `people` (`first`,`last`,`load_file`,`load_id`,`load_line`,`load_time`) VALUES (?,?,?,?,?,?), (?,?,?,?,?,?)").
+		WithArgs("Ada", "Lovelace", filename, "3f2a", "2", sqlmock.AnyArg(), "Alan", "Turing", filename, "3f2a", "3", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.RowsInserted, int64(2))
+
+	// a -generate column named like a -lineage one wins
+	c, err = ParseFlags([]string{"-lineage", "-generate", "load_file=crm"})
+	assert.NilError(t, err)
+	assert.NilError(t, c.ResolveColumns([]string{"first"}))
+	assert.DeepEqual(t, c.InsertColumns([]string{"first"}), []string{"first", "load_file", "load_id", "load_line", "load_time"})
+	assert.Equal(t, c.generated[0].value([]string{"Ada"}, generateInput{file: "people.csv"}), "crm")
+	c, err = ParseFlags([]string{"-mode", "load-data", "-lineage"})
+	assert.NilError(t, err)
+	assert.Assert(t, !c.useLoadData(), "LOAD DATA can't generate the lineage")
+}
@@ -0,0 +1,92 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RowReader reads the data rows of an input, it is implemented by *csv.Reader and the JSON Lines reader
+type RowReader interface {
+	Read() ([]string, error)
+	// InputOffset returns the bytes of the input read so far
+	InputOffset() int64
+}
+
+// firstRowReader returns a line read as header as the first data row
+type firstRowReader struct {
+	RowReader
+	first []string
+}
+
+func (r *firstRowReader) Read() ([]string, error) {
+	if r.first != nil {
+		row := r.first
+		r.first = nil
+		return row, nil
+	}
+	return r.RowReader.Read()
+}
+
+// TableColumns returns the columns of table in their order
+func TableColumns(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT COLUMN_NAME FROM information_schema.COLUMNS "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make([]string, 0)
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// looksLikeHeader reports whether row is a header: when the expected columns are known at least one value has to
+// be one of them, otherwise no value may be empty or a number
+func looksLikeHeader(row []string, columns []string) bool {
+	if len(columns) > 0 {
+		for _, v := range row {
+			for _, c := range columns {
+				if strings.EqualFold(strings.TrimSpace(v), c) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, v := range row {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil || strings.TrimSpace(v) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveHeader checks that the line read as header of input name looks like one. If it doesn't a warning is
+// logged and with -header-as-data the columns are returned as header together with a reader returning the line
+// as first data row, so it doesn't get lost.
+func (c *Config) resolveHeader(name string, reader RowReader, header []string, columns []string) ([]string, RowReader, error) {
+	if looksLikeHeader(header, columns) {
+		return header, reader, nil
+	}
+	log.Warnf("The first line %v of %s doesn't look like a header", header, name)
+	if !c.HeaderAsData {
+		return header, reader, nil
+	}
+	if len(columns) != len(header) {
+		return nil, nil, fmt.Errorf("can't import the first line of %s as data, it has %d fields but there are %d columns %v",
+			name, len(header), len(columns), columns)
+	}
+	log.Printf("Importing the first line of %s as data with the columns %v", name, columns)
+	return columns, &firstRowReader{RowReader: reader, first: header}, nil
+}
@@ -0,0 +1,78 @@
+package loader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+var testColumns = []string{"GlobalRank", "Domain"}
+
+func TestLooksLikeHeader(t *testing.T) {
+	assert.Assert(t, looksLikeHeader([]string{"GlobalRank", "Domain"}, testColumns))
+	assert.Assert(t, looksLikeHeader([]string{"globalrank ", "domain_name"}, testColumns))
+	assert.Assert(t, !looksLikeHeader([]string{"1", "google.com"}, testColumns))
+	// without the columns of the table the values decide
+	assert.Assert(t, looksLikeHeader([]string{"rank", "domain"}, nil))
+	assert.Assert(t, !looksLikeHeader([]string{"1", "google.com"}, nil))
+	assert.Assert(t, !looksLikeHeader([]string{"google.com", ""}, nil))
+}
+
+func TestTableColumns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT COLUMN_NAME FROM information_schema.COLUMNS").WithArgs("domain").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("GlobalRank").AddRow("Domain"))
+
+	columns, err := TableColumns(context.Background(), db, "domain")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, columns, testColumns)
+}
+
+func TestResolveHeaderWarnsOnly(t *testing.T) {
+	l := newTestLoader()
+	source, err := OpenCSVSource(writeZip(t, map[string]string{"a.csv": "1,google.com\n2,facebook.com\n"}))
+	assert.NilError(t, err)
+	defer source.Close()
+	name, reader, header, err := NextCSVReader(source, l.config)
+	assert.NilError(t, err)
+
+	headers, r, err := l.config.resolveHeader(name, reader, header, testColumns)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, headers, []string{"1", "google.com"})
+	assert.Equal(t, r, RowReader(reader))
+}
+
+func TestHeaderAsData(t *testing.T) {
+	l := newTestLoader()
+	l.config.HeaderAsData = true
+	source, err := OpenCSVSource(writeZip(t, map[string]string{
+		"a.csv": "1,google.com\n2,facebook.com\n",
+		"b.csv": "3,youtube.com\n",
+	}))
+	assert.NilError(t, err)
+	defer source.Close()
+	name, reader, header, err := NextCSVReader(source, l.config)
+	assert.NilError(t, err)
+
+	var r RowReader
+	l.headers, r, err = l.config.resolveHeader(name, reader, header, testColumns)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, l.headers, testColumns)
+	jobs := make(chan Job, 100)
+	rows, err := l.ProcessCSVSource(context.Background(), source, name, r, jobs, 0, 100)
+	assert.NilError(t, err)
+	assert.Equal(t, rows, 3)
+	// the first line of every input is imported as well
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"1", "google.com"}, {"2", "facebook.com"}, {"3", "youtube.com"}})
+}
+
+func TestHeaderAsDataColumnMismatch(t *testing.T) {
+	l := newTestLoader()
+	l.config.HeaderAsData = true
+	_, _, err := l.config.resolveHeader("a.csv", nil, []string{"1", "google.com", "com"}, testColumns)
+	assert.ErrorContains(t, err, "it has 3 fields but there are 2 columns")
+}
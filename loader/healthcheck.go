@@ -0,0 +1,32 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HealthCheck verifies that the database is reachable and that the -table of c exists and accepts inserts.
+// The insert permission is checked with an EXPLAIN of an insert which would not write any row.
+func HealthCheck(ctx context.Context, db *sql.DB, c Config) error {
+	table := c.Table
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database not reachable: %w", err)
+	}
+	log.Println("Ping ok")
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("EXPLAIN INSERT INTO %s SELECT * FROM %s WHERE 1=0", quoteTable(c.dialect(), table), quoteTable(c.dialect(), table)))
+	if err != nil {
+		return fmt.Errorf("no insert permission on table %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("no insert permission on table %s: %w", table, err)
+	}
+	log.Printf("Insert permission on table %s ok", table)
+	return nil
+}
@@ -0,0 +1,44 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestHealthCheck(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NilError(t, err)
+	defer db.Close()
+
+	mock.ExpectPing()
+	mock.ExpectQuery("EXPLAIN INSERT INTO `domain` SELECT \\* FROM `domain` WHERE 1=0").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "select_type", "table"}).AddRow(1, "INSERT", "domain"))
+
+	assert.NilError(t, HealthCheck(context.Background(), db, Config{Table: "domain"}))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestHealthCheckPingFails(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NilError(t, err)
+	defer db.Close()
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	assert.ErrorContains(t, HealthCheck(context.Background(), db, Config{Table: "domain"}), "database not reachable")
+}
+
+func TestHealthCheckNoInsertPermission(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NilError(t, err)
+	defer db.Close()
+
+	mock.ExpectPing()
+	mock.ExpectQuery("EXPLAIN INSERT").WillReturnError(errors.New("Error 1142: INSERT command denied"))
+
+	assert.ErrorContains(t, HealthCheck(context.Background(), db, Config{Table: "domain"}), "no insert permission on table domain")
+}
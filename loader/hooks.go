@@ -0,0 +1,57 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// kinds of the SQL hooks, the -pre-sql, -post-sql and -on-failure-sql statements
+const (
+	hookPre       = "pre"
+	hookPost      = "post"
+	hookOnFailure = "on-failure"
+)
+
+// runHooks executes the statements of a hook kind one after another on db, the first failing one stops them.
+// A dry run only logs them.
+func (c *Config) runHooks(ctx context.Context, db *sql.DB, kind string, statements []string) error {
+	for _, stmt := range statements {
+		if c.DryRun {
+			log.Printf("Dry run, the %s hook isn't executed: %s", kind, stmt)
+			continue
+		}
+		log.Printf("Running the %s hook: %s", kind, stmt)
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s hook '%s' failed: %w", kind, stmt, err)
+		}
+	}
+	return nil
+}
+
+// runFailureHooks executes the -on-failure-sql statements after the import failed with err. They run even when
+// the import was interrupted or reached its -timeout, so they get a context of their own.
+func (c *Config) runFailureHooks(ctx context.Context, db *sql.DB, err error) {
+	if len(c.OnFailureSQL) == 0 {
+		return
+	}
+	log.Warnf("The import failed (%s), running the on-failure hooks", err.Error())
+	if hookErr := c.runHooks(context.WithoutCancel(ctx), db, hookOnFailure, c.OnFailureSQL); hookErr != nil {
+		log.Error(hookErr.Error())
+	}
+}
+
+// validateHooks checks the hook statements
+func (c *Config) validateHooks() error {
+	for flag, statements := range map[string][]string{"pre-sql": c.PreSQL, "post-sql": c.PostSQL, "on-failure-sql": c.OnFailureSQL} {
+		for _, stmt := range statements {
+			if strings.TrimSpace(stmt) == "" {
+				return fmt.Errorf("empty -%s statement", flag)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+// hookTestConfig returns the config of an import of two domains into the SQLite table domain_new with args
+func hookTestConfig(t *testing.T, args ...string) Config {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain\n1,google.com\n2,youtube.com\n"), 0o644))
+	c, err := ParseFlags(append([]string{"-csv", filename, "-dialect", "sqlite", "-table", "domain_new", "-workers", "1"}, args...))
+	assert.NilError(t, err)
+	return c
+}
+
+func TestImportHooks(t *testing.T) {
+	c := hookTestConfig(t, "-pre-sql", "DELETE FROM domain_new", "-pre-sql", "DROP INDEX IF EXISTS domain_rank",
+		"-post-sql", "CREATE INDEX domain_rank ON domain_new (GlobalRank)", "-post-sql", "ALTER TABLE domain_new RENAME TO domain",
+		"-on-failure-sql", "DROP TABLE domain_new")
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec("DELETE FROM domain_new").WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec("DROP INDEX IF EXISTS domain_rank").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "domain_new" ("GlobalRank","Domain") VALUES (?,?), (?,?)`).
+		WithArgs("1", "google.com", "2", "youtube.com").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("CREATE INDEX domain_rank ON domain_new (GlobalRank)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE domain_new RENAME TO domain").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err = New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportFailureHooks(t *testing.T) {
+	c := hookTestConfig(t, "-pre-sql", "DELETE FROM domain_new", "-post-sql", "ALTER TABLE domain_new RENAME TO domain",
+		"-on-failure-sql", "DROP TABLE domain_new")
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	// the post hook isn't executed after the failed insert, the on-failure hook is
+	mock.ExpectExec("DELETE FROM domain_new").WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec(`INSERT INTO "domain_new" ("GlobalRank","Domain") VALUES (?,?), (?,?)`).
+		WithArgs("1", "google.com", "2", "youtube.com").WillReturnError(errors.New("disk full"))
+	mock.ExpectExec("DROP TABLE domain_new").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err = New(db, c).Run(context.Background())
+	assert.ErrorContains(t, err, "disk full")
+	assert.NilError(t, mock.ExpectationsWereMet())
+
+	// a failing pre hook stops the import before the rows are loaded
+	c = hookTestConfig(t, "-pre-sql", "ALTER TABLE domain_new DISABLE KEYS", "-on-failure-sql", "DROP TABLE domain_new")
+	mock.ExpectExec("ALTER TABLE domain_new DISABLE KEYS").WillReturnError(errors.New("syntax error"))
+	mock.ExpectExec("DROP TABLE domain_new").WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = New(db, c).Run(context.Background())
+	assert.ErrorContains(t, err, "pre hook 'ALTER TABLE domain_new DISABLE KEYS' failed: syntax error")
+	assert.NilError(t, mock.ExpectationsWereMet())
+
+	_, err = ParseFlags([]string{"-post-sql", " "})
+	assert.ErrorContains(t, err, "empty -post-sql statement")
+}
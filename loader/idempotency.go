@@ -0,0 +1,57 @@
+package loader
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+)
+
+// EnsureIdempotencyTable creates the table recording the keys of all imported batches if it doesn't exist
+func EnsureIdempotencyTable(ctx context.Context, db *sql.DB, d Dialect, table string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"batch_key BINARY(32) NOT NULL PRIMARY KEY, "+
+		"created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)", quoteTable(d, table)))
+	if err != nil {
+		return fmt.Errorf("creating idempotency table %s failed: %w", table, err)
+	}
+	return nil
+}
+
+// batchKey is the SHA-256 of the target table and all values of a batch, every value is length prefixed
+// so shifting characters between neighbouring values changes the key
+func batchKey(table string, values []string) []byte {
+	h := sha256.New()
+	var n [8]byte
+	for _, s := range append([]string{table}, values...) {
+		binary.BigEndian.PutUint64(n[:], uint64(len(s)))
+		h.Write(n[:])
+		h.Write([]byte(s))
+	}
+	return h.Sum(nil)
+}
+
+// execIdempotent records key in the idempotency table and executes the batch in the same transaction, so the key
+// is only recorded together with the rows. A batch whose key is already recorded is skipped, it returns whether
+// the batch was executed.
+func execIdempotent(ctx context.Context, conn *sql.Conn, d Dialect, table string, key []byte, query string, args []any) (bool, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	// a rollback after the commit is a no-op
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT IGNORE INTO "+quoteTable(d, table)+" (batch_key) VALUES (?)", key)
+	if err != nil {
+		return false, err
+	}
+	if recorded, err := result.RowsAffected(); err != nil || recorded == 0 {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,66 @@
+package loader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"gotest.tools/v3/assert"
+)
+
+func TestBatchKey(t *testing.T) {
+	key := batchKey("domain", []string{"1", "google.com"})
+	assert.Equal(t, len(key), 32)
+	assert.DeepEqual(t, key, batchKey("domain", []string{"1", "google.com"}))
+	// moving characters between values or into the table name changes the key
+	assert.Assert(t, string(key) != string(batchKey("domain", []string{"1g", "oogle.com"})))
+	assert.Assert(t, string(key) != string(batchKey("domain1", []string{"google.com"})))
+}
+
+const testBatchQuery = "INSERT INTO domain (Domain) VALUES (?)"
+
+func TestExecIdempotent(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	assert.NilError(t, err)
+	defer conn.Close()
+	key := batchKey("domain", []string{"google.com"})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT IGNORE INTO `import_batches` (batch_key) VALUES (?)").WithArgs(key).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(testBatchQuery).WithArgs("google.com").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	executed, err := execIdempotent(context.Background(), conn, mysqlDialect{}, "import_batches", key, testBatchQuery, []any{"google.com"})
+	assert.NilError(t, err)
+	assert.Assert(t, executed)
+
+	// replayed: the key is already recorded, the batch is not executed
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT IGNORE INTO `import_batches` (batch_key) VALUES (?)").WithArgs(key).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	executed, err = execIdempotent(context.Background(), conn, mysqlDialect{}, "import_batches", key, testBatchQuery, []any{"google.com"})
+	assert.NilError(t, err)
+	assert.Assert(t, !executed)
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecIdempotentFailedBatchKeepsNoKey(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	assert.NilError(t, err)
+	defer conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT IGNORE INTO `import_batches` (batch_key) VALUES (?)").WillReturnResult(sqlmock.NewResult(0, 1))
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	mock.ExpectExec(testBatchQuery).WillReturnError(deadlock)
+	mock.ExpectRollback()
+	_, err = execIdempotent(context.Background(), conn, mysqlDialect{}, "import_batches", []byte("key"), testBatchQuery, []any{"google.com"})
+	assert.ErrorIs(t, err, deadlock)
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,65 @@
+package loader
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxMySQLIdentifier is the length of a MySQL table or column name at most, in characters
+const maxMySQLIdentifier = 64
+
+// checkIdentifier checks that name can be quoted as identifier of a kind (column or table): it must not be empty or
+// contain control characters, which no quoting keeps apart from the statement, and for MySQL it must fit into
+// 64 characters and not end with a space
+func (c *Config) checkIdentifier(kind string, name string) error {
+	if name == "" {
+		return fmt.Errorf("empty %s name", kind)
+	}
+	if i := strings.IndexFunc(name, unicode.IsControl); i >= 0 {
+		return fmt.Errorf("invalid %s name %q: contains the control character %U", kind, name, []rune(name[i:])[0])
+	}
+	if c.isMySQL() && utf8.RuneCountInString(name) > maxMySQLIdentifier {
+		return fmt.Errorf("invalid %s name '%s': longer than %d characters", kind, name, maxMySQLIdentifier)
+	}
+	if c.isMySQL() && strings.HasSuffix(name, " ") {
+		return fmt.Errorf("invalid %s name '%s': ends with a space", kind, name)
+	}
+	return nil
+}
+
+// checkIdentifiers checks the names of the target table (a schema qualified one by its parts) and of the inserted
+// columns, before they are quoted into a statement
+func (c *Config) checkIdentifiers(table string, columns []string) error {
+	for _, part := range strings.Split(table, ".") {
+		if err := c.checkIdentifier("table", part); err != nil {
+			return err
+		}
+	}
+	for _, column := range columns {
+		if err := c.checkIdentifier("column", column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckTableColumns returns an error for the columns which aren't columns of table (from the information schema),
+// compared like MySQL does without regard to case. No known columns check nothing, the table may not exist yet.
+func CheckTableColumns(table string, columns []string, known []string) error {
+	if len(known) == 0 {
+		return nil
+	}
+	var unknown []string
+	for _, column := range columns {
+		if !slices.ContainsFunc(known, func(k string) bool { return strings.EqualFold(k, column) }) {
+			unknown = append(unknown, column)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown column '%s' of table %s, its columns are: %s", strings.Join(unknown, "', '"), table, strings.Join(known, ", "))
+	}
+	return nil
+}
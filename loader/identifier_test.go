@@ -0,0 +1,53 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestCheckIdentifier(t *testing.T) {
+	l := withConnConfig(t, 5)
+	assert.NilError(t, l.config.checkIdentifiers("shop.orders", []string{"id", "order date", "name`) VALUES (1); DROP TABLE x; --"}))
+	for want, name := range map[string]string{
+		"empty column name": "",
+		`invalid column name "a\nb": contains the control character U+000A`: "a\nb",
+		"invalid column name 'a ': ends with a space":                       "a ",
+		"longer than 64 characters":                                         strings.Repeat("x", 65),
+	} {
+		assert.ErrorContains(t, l.config.checkIdentifiers("orders", []string{name}), want)
+	}
+	assert.ErrorContains(t, l.config.checkIdentifiers("shop..orders", nil), "empty table name")
+
+	c, err := ParseFlags([]string{"-map", "Domain=domain\x00"})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.ResolveColumns([]string{"Domain"}), "contains the control character U+0000")
+}
+
+func TestCheckTableColumns(t *testing.T) {
+	assert.NilError(t, CheckTableColumns("domain", []string{"globalrank", "Domain"}, []string{"GlobalRank", "Domain"}))
+	assert.NilError(t, CheckTableColumns("domain", []string{"Rank"}, nil))
+	err := CheckTableColumns("domain", []string{"Rank", "Domain", "TLD"}, []string{"GlobalRank", "Domain"})
+	assert.Error(t, err, "unknown column 'Rank', 'TLD' of table domain, its columns are: GlobalRank, Domain")
+}
+
+func TestImportUnknownColumn(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,\"Domain`) VALUES (1);DROP TABLE domain;--\"\n1,google.com\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-workers", "1", "-table", "domain"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION").
+		WithArgs("domain").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("GlobalRank").AddRow("Domain"))
+
+	_, err = New(db, c).Run(context.Background())
+	assert.ErrorContains(t, err, "unknown column 'Domain`) VALUES (1);DROP TABLE domain;--' of table domain")
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,773 @@
+package loader
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reasons of the error counts in Stats.Errors
+const (
+	ErrorMalformedRow = "malformed_row"
+	ErrorLookupMiss   = "lookup_miss"
+	ErrorConnection   = "connection"
+	ErrorBatchRetry   = "batch_retry"
+	ErrorReconnect    = "reconnect"
+)
+
+// Stats are the results of an import
+type Stats struct {
+	// RowsRead are the data rows read from all inputs, including the skipped ones
+	RowsRead int64
+	// RowsInserted are the rows of all successfully executed batches
+	RowsInserted int64
+	// BatchesExecuted are the successfully executed batches
+	BatchesExecuted int64
+	// RowsReplayed are the rows of batches skipped because they were already imported (-idempotency-table)
+	RowsReplayed int64
+	// RowsDeadLettered are the rows written to the dead-letter file
+	RowsDeadLettered int64
+	// RowsFailed are the rows read which are not imported because they failed: the malformed rows skipped, the rows
+	// of failed batches and the rows discarded after that
+	RowsFailed int64
+	// Errors counts the errors which didn't stop the import by reason (see the Error... constants)
+	Errors map[string]int64
+	// AbandonedFiles are the inputs given up because of -stop-after-errors-per-file
+	AbandonedFiles []string
+	// Inputs are the rows of every input in the order they were read
+	Inputs []InputStats
+	// DeadLetterFile is the path of the dead-letter file, empty if there is none
+	DeadLetterFile string
+	// Duration is the time the import took
+	Duration time.Duration
+	// RowsDeduped are the rows skipped because their -dedupe-on key was read before
+	RowsDeduped int64
+	// RowsUnrouted are the rows matching no -route which were skipped (-route-unmatched skip)
+	RowsUnrouted int64
+	// RowsUnsampled are the rows read which weren't picked by -sample
+	RowsUnsampled int64
+	// RowsUpdated are the rows of RowsInserted which changed a row of the table synced, RowsUnchanged the rows read
+	// skipped because they are in the table as they are and RowsDeleted the rows of the table missing from the input
+	// deleted by -sync-delete
+	RowsUpdated   int64
+	RowsUnchanged int64
+	RowsDeleted   int64
+	// RowsByShard are the rows read for every -shard
+	RowsByShard []int64
+	// QueueCapacity is the size of the jobs buffer between the reader and the workers, QueuePeak and QueueAverage
+	// the highest and the average number of rows sampled in it
+	QueueCapacity int
+	QueuePeak     int
+	QueueAverage  float64
+	// QueueFull is about how long the jobs buffer was full, the reader waited for the workers then
+	QueueFull time.Duration
+	// QueueStalls counts the times the buffer stayed full for longer than -behind-threshold
+	QueueStalls int64
+	// RowsSkipped are the data rows skipped at the start, with -resume-from-line or a checkpoint
+	RowsSkipped int64
+	// RowsRejected are the rows recorded in the rejects file
+	RowsRejected int64
+	// BytesRead are the bytes read from the inputs, compressed ones as stored
+	BytesRead int64
+	// Workers are the batches executed by every worker
+	Workers []WorkerStats
+	// BatchLatency is the histogram of the execution times of the batches, SlowBatches the batches slower than
+	// -slow-batch-threshold
+	BatchLatency BatchLatency
+	SlowBatches  int64
+}
+
+// SuccessRatio returns the share of the rows read which are in the table (inserted or replayed), the skipped
+// duplicates, unrouted, unsampled and unchanged rows don't count, 1 if nothing was read
+func (s Stats) SuccessRatio() float64 {
+	return successRatio(s.Committed(), s.RowsRead-s.RowsDeduped-s.RowsUnrouted-s.RowsUnsampled-s.RowsUnchanged)
+}
+
+// Committed returns the rows which are in the table: inserted or replayed
+func (s Stats) Committed() int64 {
+	return s.RowsInserted + s.RowsReplayed
+}
+
+// Unaccounted returns the rows read which are neither committed, failed, dead-lettered nor skipped as duplicates,
+// unrouted, unsampled or unchanged, 0 once every worker flushed its batches
+func (s Stats) Unaccounted() int64 {
+	return s.RowsRead - s.Committed() - s.RowsFailed - s.RowsDeadLettered - s.RowsDeduped - s.RowsUnrouted - s.RowsUnsampled - s.RowsUnchanged
+}
+
+// Throughput returns the inserted rows per second
+func (s Stats) Throughput() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.RowsInserted) / s.Duration.Seconds()
+}
+
+// Loader is the import pipeline: the reader sending the rows of the inputs to the jobs channel and the workers
+// inserting them in batches
+type Loader struct {
+	// Config are the settings of the import
+	Config Config
+	// DB is the database the rows are imported into, nil is fine for a dry run
+	DB *sql.DB
+	// Shards are the databases of Config.Shards (see OpenShardConnections), DB is the first of them
+	Shards []*sql.DB
+	// headers are the columns of the inputs, read from the header of the first one
+	headers []string
+	// loading is set once the -pre-sql hooks run, a failure from then on runs the -on-failure-sql hooks
+	loading bool
+	// swapping is set once the staging table of -swap is created, a failure from then on drops it
+	swapping bool
+	// skipFKValidation leaves the check of -defer-fk-checks to the Plan loading the referenced tables as well
+	skipFKValidation bool
+	// sync skips the rows which are in the table unchanged, set by Sync
+	sync bool
+
+	// config is the copy of Config the running import uses, filled in by it (the columns, the coercions, the
+	// run id, ...), so Config stays as the caller set it
+	config Config
+	// the parts of the enabled features, set up by the run and nil when the feature is off. Their methods do
+	// nothing on a nil receiver.
+	aggregates    *Aggregates
+	auditLog      *AuditLog
+	batchLatency  *latencyHistogram
+	checkpoint    *Checkpoint
+	deadLetter    *DeadLetter
+	dedupe        *Dedupe
+	errorBudget   *ErrorBudget
+	explain       *Explain
+	failedSQLDump *FailedSQLDump
+	inputCounter  *InputCounter
+	lookups       *Lookups
+	metrics       *Metrics
+	ordered       *orderedCommits
+	progress      *Progress
+	reporter      *ProgressReporter
+	rejects       *Rejects
+	router        *Router
+	sampler       *Sampler
+	shards        *jobShards
+	shardRouter   *ShardRouter
+	statsd        *StatsD
+	syncer        *syncState
+	tableRotation *TableRotation
+	throttle      *Throttle
+	tuner         *Tuner
+	workerStats   *workerCounter
+	// rateLimiter limits the rows read per second, batchLimiter the batches executed per second by all workers
+	rateLimiter  *RateLimiter
+	batchLimiter *RateLimiter
+	counters
+	// status is what the Status of the running import is taken from, nil when there is none
+	status atomic.Pointer[statusSource]
+}
+
+// counters are the counters of a run, updated by the reader and the workers while the stats, the status and the
+// metrics read them
+type counters struct {
+	// rowsInserted counts the rows of all successfully executed batches
+	rowsInserted atomic.Int64
+	// batchesExecuted counts the successfully executed batches of all workers
+	batchesExecuted atomic.Int64
+	// batchRetries counts the retried batches of all workers
+	batchRetries atomic.Int64
+	// reconnectCount counts the connections of all workers replaced because the server closed them
+	reconnectCount atomic.Int64
+	// connErrors counts the failed connection acquisitions of all workers
+	connErrors atomic.Int64
+	// rowsFailed counts the rows of batches which failed for good and the rows discarded after a worker failed
+	rowsFailed atomic.Int64
+	// rowsSkipped counts the data rows skipped at the start of the inputs
+	rowsSkipped atomic.Int64
+	// rowsReplayed counts the rows of batches skipped because their idempotency key was already recorded
+	rowsReplayed atomic.Int64
+	// slowBatches counts the batches which took longer than the -slow-batch-threshold
+	slowBatches atomic.Int64
+}
+
+// New creates a Loader importing into db as configured by c, a Config from ParseFlags or one filled in by the
+// embedding program
+func New(db *sql.DB, c Config) *Loader {
+	return &Loader{Config: c, DB: db}
+}
+
+// Run imports Config.Inputs() and returns its stats. The stats are returned with an error as well, as far as the
+// import got. Every Loader has its own settings, counters and parts of the pipeline, so Loaders may run
+// concurrently. Canceling ctx stops reading the input, the rows read so far are still flushed within the shutdown
+// grace period.
+func (l *Loader) Run(ctx context.Context) (Stats, error) {
+	return l.run(ctx, func() (CSVSource, error) { return OpenCSVSources(l.Config.Inputs()) })
+}
+
+// RunReader imports the CSV content of r instead of Config.Inputs(), like Run. r isn't closed.
+func (l *Loader) RunReader(ctx context.Context, r io.Reader) (Stats, error) {
+	return l.run(ctx, func() (CSVSource, error) { return NewReaderSource("reader", r), nil })
+}
+
+// RunSource imports the inputs of source instead of Config.Inputs(), like Run, e.g. a StreamSource. source is
+// closed at the end.
+func (l *Loader) RunSource(ctx context.Context, source CSVSource) (Stats, error) {
+	return l.run(ctx, func() (CSVSource, error) { return source, nil })
+}
+
+// ProcessCSV imports the CSV stream r into db as configured by c, it is New(db, c).RunReader(ctx, r) for callers
+// which only have a stream, e.g. the body of an HTTP response or the output of a command
+func ProcessCSV(ctx context.Context, r io.Reader, db *sql.DB, c Config) (Stats, error) {
+	return New(db, c).RunReader(ctx, r)
+}
+
+// run imports the inputs of the source returned by open, running the -on-failure-sql hooks when it fails
+func (l *Loader) run(ctx context.Context, open func() (CSVSource, error)) (Stats, error) {
+	l.loading, l.swapping = false, false
+	stats, err := l.runImport(ctx, open)
+	if err != nil && l.loading {
+		l.config.runFailureHooks(ctx, l.DB, err)
+	}
+	if err != nil && l.swapping {
+		dropSwapStaging(ctx, l.DB, l.config.dialect(), l.Config.Table)
+	}
+	return stats, err
+}
+
+func (l *Loader) runImport(ctx context.Context, open func() (CSVSource, error)) (stats Stats, err error) {
+	l.config = l.Config
+	start := time.Now()
+	l.config.started = start
+	if l.config.Lineage && l.config.RunID == "" {
+		// the rows of the run are told apart by their load_id
+		l.config.RunID = NewRunID()
+	}
+	if l.config.Lineage {
+		log.Printf("The rows get the load_id %s", l.config.RunID)
+	}
+	for _, counter := range []*atomic.Int64{&l.rowsInserted, &l.batchesExecuted, &l.rowsReplayed, &l.connErrors, &l.batchRetries, &l.reconnectCount, &l.rowsFailed, &l.rowsSkipped, &l.slowBatches} {
+		counter.Store(0)
+	}
+	// the parts of an earlier run are closed, a run without the option must not reuse them
+	l.deadLetter, l.auditLog, l.statsd, l.failedSQLDump, l.lookups, l.tableRotation, l.throttle = nil, nil, nil, nil, nil, nil, nil
+	stats = Stats{DeadLetterFile: l.config.DeadLetterFile}
+	defer func() { stats.Duration = time.Since(start) }()
+
+	if l.config.DryRun {
+		log.Println("Dry run, the database isn't touched")
+	}
+	if l.config.Timeout > 0 {
+		// the import stops like on SIGINT, the workers flush their batches within -shutdown-grace
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, l.config.Timeout, fmt.Errorf("-timeout %s reached: %w", l.config.Timeout, context.DeadlineExceeded))
+		defer cancel()
+	}
+	if l.config.Plugin != "" && l.config.RowProcessor == nil {
+		var err error
+		if l.config.RowProcessor, err = LoadPlugin(l.config.Plugin); err != nil {
+			return stats, err
+		}
+	}
+	if l.config.presetDDL != "" && !l.config.DryRun {
+		log.Printf("Running the DDL of preset %s", l.config.Preset)
+		if _, err := l.DB.ExecContext(ctx, l.config.presetDDL); err != nil {
+			return stats, fmt.Errorf("DDL of preset %s failed: %w", l.config.Preset, err)
+		}
+	}
+
+	if l.config.Swap && l.config.DryRun {
+		log.Printf("Dry run, the staging table %s isn't created", l.config.InsertTable())
+	} else if l.config.Swap {
+		if err := PrepareSwap(ctx, l.DB, l.config.dialect(), l.config.Table); err != nil {
+			return stats, err
+		}
+		l.swapping = true
+	}
+
+	source, err := open()
+	if err != nil {
+		return stats, err
+	}
+	defer source.Close()
+	stream, _ := source.(*StreamSource)
+	if stream != nil {
+		if l.config.InputFormat == InputFormatCSV && stream.header == nil {
+			return stats, fmt.Errorf("the CSV stream %s needs a header", stream.name)
+		}
+		stream.start(ctx, l.config.Delimiter)
+	}
+
+	name, first, row, err := NextCSVReader(source, l.config)
+	if err != nil {
+		return stats, err
+	}
+	// an import failing before the rows are read stops the parsing
+	defer closeRowReader(first)
+	var columns []string
+	// the columns are read from the information schema of MySQL
+	if !l.config.DryRun && l.config.isMySQL() {
+		if columns, err = TableColumns(ctx, l.DB, l.config.InsertTable()); err != nil {
+			log.Warnf("Could not read the columns of table %s: %s", l.config.InsertTable(), err.Error())
+		}
+	}
+	var reader RowReader
+	l.headers, reader, err = l.config.resolveHeader(name, first, row, columns)
+	if err != nil {
+		return stats, err
+	}
+	log.Println("Fields found:", l.headers)
+	if err = l.config.ResolveColumns(l.headers); err != nil {
+		return stats, err
+	}
+	if err = CheckTableColumns(l.config.InsertTable(), l.config.InsertColumns(l.headers), columns); err != nil {
+		return stats, err
+	}
+	if err = l.checkRouteColumns(ctx); err != nil {
+		return stats, err
+	}
+	l.config.coercions = nil
+	if l.config.Coerce || l.config.checksDecodedSizes() {
+		types, err := TableColumnTypes(ctx, l.DB, l.config.InsertTable())
+		if err != nil && l.config.Coerce {
+			return stats, fmt.Errorf("could not read the column types of table %s for -coerce: %w", l.config.InsertTable(), err)
+		}
+		if err != nil {
+			log.Warnf("Could not read the column types of table %s, the size of the decoded values isn't checked: %s", l.config.InsertTable(), err.Error())
+		}
+		l.config.resolveCoercions(l.headers, types)
+	}
+
+	if l.config.AuditFile != "" {
+		l.auditLog, err = OpenAuditLog(l.config.AuditFile)
+		if err != nil {
+			return stats, err
+		}
+		defer func() {
+			if err := l.auditLog.Close(); err != nil {
+				log.Error(err.Error())
+			}
+			l.auditLog = nil
+		}()
+	}
+
+	if l.config.DeadLetterFile != "" {
+		l.deadLetter, err = OpenDeadLetter(l.config.DeadLetterFile, l.headers, l.config.Delimiter)
+		if err != nil {
+			return stats, err
+		}
+		RegisterArtifact(l.config.DeadLetterFile, true)
+		defer func() {
+			if err := l.deadLetter.Close(); err != nil {
+				log.Error(err.Error())
+			}
+			l.deadLetter = nil
+		}()
+	}
+	l.rejects = nil
+	if l.config.RejectsFile != "" {
+		if l.rejects, err = OpenRejects(l.config.RejectsFile); err != nil {
+			return stats, err
+		}
+		RegisterArtifact(l.config.RejectsFile, true)
+		defer func() {
+			if err := l.rejects.Close(); err != nil {
+				log.Error(err.Error())
+			}
+			l.rejects = nil
+		}()
+	}
+	if len(l.config.Lookups) > 0 {
+		if l.lookups, err = NewLookups(l.DB, l.config, l.headers); err != nil {
+			return stats, err
+		}
+	}
+
+	if l.config.StatsDAddr != "" {
+		l.statsd, err = NewStatsD(l.config.StatsDAddr)
+		if err != nil {
+			return stats, err
+		}
+		defer func() {
+			if err := l.statsd.Close(); err != nil {
+				log.Error(err.Error())
+			}
+			l.statsd = nil
+		}()
+	}
+
+	if l.config.DumpFailedSQL != "" {
+		l.failedSQLDump, err = OpenFailedSQLDump(l.config.DumpFailedSQL, l.config.InsertColumns(l.headers), l.config.MaskColumns)
+		if err != nil {
+			return stats, err
+		}
+		RegisterArtifact(l.config.DumpFailedSQL, true)
+		defer func() {
+			if err := l.failedSQLDump.Close(); err != nil {
+				log.Error(err.Error())
+			}
+			l.failedSQLDump = nil
+		}()
+	}
+
+	types := l.config.ColumnTypes
+	if l.config.InferTypes > 0 {
+		var sample [][]string
+		sample, reader = sampleRows(reader, l.config.InferTypes)
+		types = l.config.inferColumnTypes(l.headers, sample)
+		log.Printf("Inferred the column types from %d rows", len(sample))
+	}
+	types = l.config.lineageTypes(types)
+	if l.config.CreateTable && l.config.DryRun {
+		log.Printf("Dry run, the table isn't created: %s", buildCreateTable(l.config.dialect(), l.config.InsertTable(), l.config.InsertColumns(l.headers), types))
+	} else if l.config.CreateTable {
+		if err = CreateTable(ctx, l.DB, l.config.dialect(), l.config.InsertTable(), l.config.InsertColumns(l.headers), types); err != nil {
+			return stats, err
+		}
+	}
+	if l.config.Truncate && l.config.DryRun {
+		log.Printf("Dry run, table %s isn't truncated", l.config.InsertTable())
+	} else if l.config.Truncate {
+		if err = TruncateTable(ctx, l.DB, l.config.dialect(), l.config.InsertTable()); err != nil {
+			return stats, err
+		}
+	}
+	if !l.config.DryRun && l.config.isMySQL() {
+		logCollationWarnings(ctx, l.DB, l.config.InsertTable())
+	}
+	l.config.maxAllowedPacket = 0
+	if l.config.AdaptiveBatch && !l.config.DryRun && l.config.isMySQL() {
+		if l.config.maxAllowedPacket, err = queryMaxAllowedPacket(ctx, l.DB); err != nil {
+			// the batches are sized by their latency alone then
+			log.Warnf("Could not query max_allowed_packet: %s", err.Error())
+		}
+	}
+
+	if l.config.IdempotencyTable != "" && !l.config.DryRun {
+		if err = EnsureIdempotencyTable(ctx, l.DB, l.config.dialect(), l.config.IdempotencyTable); err != nil {
+			return stats, err
+		}
+	}
+	if l.config.TableTemplate != "" {
+		l.tableRotation = NewTableRotation(l.DB, l.config.TableTemplate, l.config.InsertTable(), start)
+	}
+	l.aggregates = nil
+	if indexes := l.config.sumIndexes(); len(indexes) > 0 {
+		l.aggregates = NewAggregates(indexes)
+	}
+	if l.config.ThrottleOnError {
+		l.throttle = NewThrottle(l.config.Workers, l.config.ThrottleIncrease, l.config.ThrottleDecrease)
+	}
+	l.rateLimiter, l.batchLimiter = nil, nil
+	if l.config.Rate > 0 {
+		l.rateLimiter = NewRateLimiter(l.config.Rate, l.config.RateBurst)
+	}
+	if l.config.MaxBatchesPerSec > 0 {
+		l.batchLimiter = NewRateLimiter(l.config.MaxBatchesPerSec, l.config.RateBurst)
+	}
+	l.dedupe = nil
+	if len(l.config.DedupeOn) > 0 && l.config.DedupeMode == DedupeBloom {
+		l.dedupe = NewBloomDedupe(l.config.dedupeIndexes, l.config.DedupeMaxKeys, l.config.DedupeFalsePositiveRate)
+	} else if len(l.config.DedupeOn) > 0 {
+		l.dedupe = NewDedupe(l.config.dedupeIndexes, l.config.DedupeMaxKeys)
+	}
+	l.ordered = nil
+	if l.config.Ordered {
+		l.ordered = newOrderedCommits()
+	}
+	l.syncer = nil
+	if l.sync {
+		if l.syncer, err = l.config.loadSyncState(ctx, l.DB, l.config.InsertTable(), l.config.InsertColumns(l.headers)); err != nil {
+			return stats, err
+		}
+	}
+	l.sampler = nil
+	if l.config.Sample > 0 && l.config.Sample < 1 {
+		l.sampler = NewSampler(l.config.Sample, l.config.SampleSeed)
+	}
+	l.shardRouter = nil
+	if len(l.config.Shards) > 0 {
+		l.shardRouter = NewShardRouter(len(l.config.Shards), l.config.shardIndex, l.config.ShardMode, l.config.ShardRanges)
+	}
+	l.router = nil
+	if len(l.config.Routes) > 0 {
+		l.router = NewRouter(l.config.Routes, l.config.RouteUnmatched)
+		if n := len(l.router.Tables()); l.config.Workers < n {
+			log.Warnf("%d workers insert into %d tables, the tables sharing a worker get smaller batches", l.config.Workers, n)
+		}
+	}
+	l.errorBudget = NewErrorBudget(l.config.MaxErrors, l.config.StopAfterErrorsPerFile, l.config.MaxErrorPct)
+	l.inputCounter = NewInputCounter()
+	skip := l.config.SkipRows()
+	l.checkpoint = nil
+	if stream != nil && (skip > 0 || l.config.CheckpointFile != "") {
+		return stats, fmt.Errorf("the stream %s resumes after its committed messages, it can't skip rows", stream.name)
+	}
+	if stream != nil {
+		// the messages are committed as their rows are done
+		l.checkpoint = NewCheckpoint("", 0)
+		l.checkpoint.advanced = stream.Done
+	}
+	if l.config.CheckpointFile != "" {
+		if skip, err = l.config.resumeSkip(l.config.CheckpointFile, skip); err != nil {
+			return stats, err
+		}
+		l.checkpoint = NewCheckpoint(l.config.CheckpointFile, skip)
+		defer func() {
+			if err := l.checkpoint.Close(); err != nil {
+				log.Error(err.Error())
+			}
+		}()
+	}
+	l.progress = NewProgress(source.Size(), start)
+	l.reporter = NewProgressReporter(resolveProgressMode(l.config.Progress), os.Stderr, l.config.ProgressInterval, l.progress, l.config.Workers, start)
+	l.reporter.Start()
+	defer l.reporter.Stop()
+
+	l.explain = nil
+	if l.config.Explain > 0 {
+		l.explain = NewExplain(os.Stdout, l.config.Explain, l.config.dialect(), l.bindTableArgs)
+	}
+	l.loading = true
+	if err = l.config.runHooks(ctx, l.DB, hookPre, l.config.PreSQL); err != nil {
+		return stats, err
+	}
+	var verifyBefore TableCount
+	if l.config.Verify {
+		if verifyBefore, err = CountTableRows(ctx, l.DB, l.config.dialect(), l.config.InsertTable(), l.config.VerifyWhere, l.config.verifySumColumn()); err != nil {
+			return stats, err
+		}
+	}
+	jobs := make(chan Job, l.config.BufferSize)
+	l.shards = nil
+	if !l.config.useLoadData() {
+		l.shards = l.newJobShards()
+	}
+	l.workerStats = newWorkerCounter(l.config.Workers)
+	l.batchLatency = newLatencyHistogram()
+	l.tuner = nil
+	if l.config.AutoTune {
+		l.tuner = NewTuner(l.config.MinWorkers, l.config.Workers, l.DB)
+	}
+	dbs := l.Shards
+	if len(dbs) == 0 {
+		dbs = []*sql.DB{l.DB}
+	}
+	defer l.trackStatus(dbs, jobs)()
+	l.metrics = nil
+	if l.config.MetricsAddr != "" {
+		l.metrics = NewMetrics(l, l.DB, jobs, l.config.Workers)
+		if err = l.metrics.Serve(l.config.MetricsAddr); err != nil {
+			return stats, err
+		}
+		defer func() {
+			if err := l.metrics.Close(); err != nil {
+				log.Error(err.Error())
+			}
+			l.metrics = nil
+		}()
+	}
+	queue := startQueueMonitor(jobQueue{jobs: jobs, shards: l.shards}, l.config.BehindThreshold)
+	var workers *Workers
+	if l.config.useLoadData() {
+		workers = l.StartLoadData(ctx, jobs)
+	} else {
+		workers = l.StartWorkers(ctx, jobs)
+	}
+	if stream != nil {
+		// the rows fetched after a worker failed are discarded, they'd be delivered again anyway
+		workers.afterFail(stream.stopFetching)
+	}
+	// ProcessCSVSource closes jobs when it returns, so the rows read so far are still inserted when reading failed
+	rowsRead, err := l.ProcessCSVSource(ctx, source, name, reader, jobs, skip, cmp.Or(l.config.MaxLines, math.MaxInt))
+	l.tuner.Finish()
+	log.Println("Waiting for the workers to flush their batches")
+	workerErr := workers.Wait()
+	queue.Stop()
+	l.reporter.Stop()
+	l.collectStats(&stats, int64(rowsRead))
+	queue.collect(&stats)
+	l.logCommitted(stats)
+	if err != nil {
+		return stats, err
+	}
+	if workerErr != nil {
+		return stats, workerErr
+	}
+	if n := stats.Unaccounted(); n != 0 {
+		return stats, fmt.Errorf("%d of %d rows read are neither committed, failed, dead-lettered, duplicates nor unrouted", n, stats.RowsRead)
+	}
+	if l.config.Verify {
+		after, err := CountTableRows(ctx, l.DB, l.config.dialect(), l.config.InsertTable(), l.config.VerifyWhere, l.config.verifySumColumn())
+		if err != nil {
+			return stats, err
+		}
+		if err = l.config.verifyCounts(l.config.InsertTable(), verifyBefore, after, stats.RowsInserted, l.aggregates.Sum(l.config.verifySumIndex)); err != nil {
+			return stats, err
+		}
+	}
+
+	if l.config.StagingTable != "" && !l.config.DryRun {
+		if _, err = RunTransform(ctx, l.DB, l.config.dialect(), l.config.TransformSQL, l.config.StagingTable, l.config.DropStaging); err != nil {
+			return stats, err
+		}
+	}
+
+	l.logStats(stats)
+	if ratio := stats.SuccessRatio(); ratio < l.config.MinSuccessRatio {
+		return stats, fmt.Errorf("success ratio %.4f is below the required minimum of %.4f", ratio, l.config.MinSuccessRatio)
+	}
+	if l.config.Swap && !l.config.DryRun {
+		if err = SwapTables(ctx, l.DB, l.config.dialect(), l.config.Table); err != nil {
+			return stats, err
+		}
+		l.swapping = false
+	}
+	if l.config.DeferFKChecks && !l.config.DryRun && !l.skipFKValidation {
+		if err = ValidateForeignKeys(ctx, l.DB, l.config.dialect(), []string{l.config.Table}); err != nil {
+			return stats, err
+		}
+	}
+	if l.syncer != nil && l.config.SyncDelete {
+		// a row which failed may be one of the missing ones
+		if failed := stats.RowsFailed + stats.RowsDeadLettered; failed > 0 {
+			log.Warnf("The rows of table %s missing from the input aren't deleted, %d rows failed", l.config.InsertTable(), failed)
+		} else if stats.RowsDeleted, err = l.syncer.DeleteMissing(ctx, l.DB); err != nil {
+			return stats, err
+		}
+	}
+	if err = l.checkpoint.Remove(); err != nil {
+		return stats, err
+	}
+	if l.config.PostImportSQL != "" && !l.config.DryRun {
+		stats.Duration = time.Since(start)
+		if err = RunPostImport(ctx, l.DB, l.config.postImportQuery, l.config.postImportVars, stats, l.aggregates); err != nil {
+			return stats, err
+		}
+	}
+	if err = l.config.runHooks(ctx, l.DB, hookPost, l.config.PostSQL); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// resumeSkip returns the rows to skip: with -resume-from-line or -skip-rows skip, otherwise the rows done according to the
+// checkpoint file of a previous run
+func (c *Config) resumeSkip(filename string, skip int) (int, error) {
+	if c.ResumeFromLine > 0 || c.SkipFirst > 0 {
+		return skip, nil
+	}
+	if c.Resume {
+		if _, err := os.Stat(filename); err != nil {
+			return 0, fmt.Errorf("nothing to resume: %w", err)
+		}
+	}
+	row, err := ReadCheckpoint(filename)
+	if err != nil {
+		return 0, err
+	}
+	if row > 0 {
+		log.Printf("Resuming from the checkpoint in %s after row %d", filename, row)
+	}
+	return row, nil
+}
+
+// collectStats fills in the counters of the reader and the workers
+func (l *Loader) collectStats(s *Stats, rowsRead int64) {
+	s.RowsRead = rowsRead
+	s.RowsInserted = l.rowsInserted.Load()
+	s.BatchesExecuted = l.batchesExecuted.Load()
+	s.RowsReplayed = l.rowsReplayed.Load()
+	s.RowsDeadLettered = l.deadLetter.Rows()
+	s.RowsDeduped = l.dedupe.Skipped()
+	s.RowsUnrouted = l.router.Skipped()
+	s.RowsUnsampled = l.sampler.Skipped()
+	s.RowsUnchanged = l.syncer.Skipped()
+	s.RowsUpdated = l.syncer.Updated()
+	s.RowsByShard = l.shardRouter.Rows()
+	s.RowsFailed = int64(l.errorBudget.Total()) + l.rowsFailed.Load()
+	s.AbandonedFiles = l.errorBudget.Abandoned()
+	s.RowsSkipped = l.rowsSkipped.Load()
+	s.RowsRejected = l.rejects.Rows()
+	s.BytesRead = l.progress.Bytes()
+	s.Workers = l.workerStats.Stats()
+	s.BatchLatency = l.batchLatency.Latency()
+	s.SlowBatches = l.slowBatches.Load()
+	s.Inputs = l.inputCounter.Stats()
+	s.Errors = map[string]int64{
+		ErrorMalformedRow: int64(l.errorBudget.Total()),
+		ErrorLookupMiss:   l.lookups.Misses(),
+		ErrorConnection:   l.connErrors.Load(),
+		ErrorBatchRetry:   l.batchRetries.Load(),
+		ErrorReconnect:    l.reconnectCount.Load(),
+	}
+}
+
+// logCommitted confirms the rows committed by the workers, which together with the failed and dead-lettered
+// rows add up to the rows read
+func (l *Loader) logCommitted(s Stats) {
+	if l.config.DryRun {
+		log.Printf("Dry run, %d rows would be committed (%d failed, %d dead-lettered) of %d rows read", s.Committed(), s.RowsFailed, s.RowsDeadLettered, s.RowsRead)
+		return
+	}
+	log.Printf("Committed %d rows (%d failed, %d dead-lettered) of %d rows read", s.Committed(), s.RowsFailed, s.RowsDeadLettered, s.RowsRead)
+}
+
+// logStats logs the summary of the import
+func (l *Loader) logStats(s Stats) {
+	if len(s.Inputs) > 1 {
+		for _, input := range s.Inputs {
+			// LOAD DATA loads all rows at once, the inserted rows can't be attributed to the inputs
+			if l.config.useLoadData() {
+				log.Printf("%s: %d rows read", input.Name, input.RowsRead)
+			} else {
+				log.Printf("%s: %d rows read, %d inserted", input.Name, input.RowsRead, input.RowsInserted)
+			}
+		}
+	}
+	log.Printf("Inserted %d of %d rows in %d batches", s.RowsInserted, s.RowsRead, s.BatchesExecuted)
+	if lat := s.BatchLatency; lat.Batches > 0 {
+		var histogram strings.Builder
+		lat.Write(&histogram)
+		log.Printf("Batch latency: mean %s, p50 %s, p95 %s, p99 %s, max %s\n%s", lat.Mean.Round(time.Microsecond),
+			lat.Quantile(0.5), lat.Quantile(0.95), lat.Quantile(0.99), lat.Max.Round(time.Microsecond), strings.TrimSuffix(histogram.String(), "\n"))
+	}
+	if s.SlowBatches > 0 {
+		log.Warnf("%d batches took longer than the slow batch threshold %s", s.SlowBatches, l.config.SlowBatchThreshold)
+	}
+	if s.QueueFull > 0 {
+		log.Printf("The jobs buffer (peak %d of %d rows) was full for %s, the workers were the bottleneck", s.QueuePeak, s.QueueCapacity, s.QueueFull)
+	}
+	if s.RowsReplayed > 0 {
+		log.Printf("Skipped %d rows of batches which were already imported", s.RowsReplayed)
+	}
+	if s.RowsDeduped > 0 {
+		log.Printf("Skipped %d rows with a key read before", s.RowsDeduped)
+	}
+	if s.RowsUnrouted > 0 {
+		log.Printf("Skipped %d rows matching no route", s.RowsUnrouted)
+	}
+	if s.RowsUnsampled > 0 {
+		log.Printf("Skipped %d rows not in the sample", s.RowsUnsampled)
+	}
+	if l.syncer != nil {
+		log.Printf("Updated %d changed rows, skipped %d unchanged rows", s.RowsUpdated, s.RowsUnchanged)
+	}
+	if l.ordered != nil {
+		log.Printf("The batches waited %s for their turn in the order of the rows", l.ordered.Waited().Round(time.Millisecond))
+	}
+	for i, rows := range s.RowsByShard {
+		log.Printf("Read %d rows for shard %d", rows, i)
+	}
+	if n := s.Errors[ErrorMalformedRow]; n > 0 {
+		log.Warnf("Skipped %d malformed rows", n)
+	}
+	if s.RowsDeadLettered > 0 {
+		log.Warnf("Wrote %d rows to the dead-letter file %s", s.RowsDeadLettered, s.DeadLetterFile)
+	}
+	if len(s.AbandonedFiles) > 0 {
+		log.Warnf("Abandoned %d files: %s", len(s.AbandonedFiles), strings.Join(s.AbandonedFiles, ", "))
+	}
+}
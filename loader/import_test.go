@@ -0,0 +1,280 @@
+package loader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestStatsSuccessRatio(t *testing.T) {
+	assert.Equal(t, Stats{}.SuccessRatio(), 1.0)
+	assert.Equal(t, Stats{RowsRead: 100, RowsInserted: 90, RowsReplayed: 5}.SuccessRatio(), 0.95)
+}
+
+func TestStatsThroughput(t *testing.T) {
+	assert.Equal(t, Stats{RowsInserted: 1000}.Throughput(), 0.0)
+	assert.Equal(t, Stats{RowsInserted: 1000, Duration: 4 * time.Second}.Throughput(), 250.0)
+}
+
+func TestStatsCollect(t *testing.T) {
+	l := &Loader{errorBudget: NewErrorBudget(10, 1, 0)}
+	l.errorBudget.Skip(1)
+	l.errorBudget.Skip(1)
+	assert.NilError(t, l.errorBudget.EndInput("a.csv", 2))
+	l.rowsInserted.Store(40)
+	l.batchesExecuted.Store(5)
+	l.batchRetries.Store(3)
+
+	var stats Stats
+	l.collectStats(&stats, 42)
+	assert.DeepEqual(t, stats, Stats{
+		RowsRead:        42,
+		RowsInserted:    40,
+		BatchesExecuted: 5,
+		RowsFailed:      2,
+		AbandonedFiles:  []string{"a.csv"},
+		Errors: map[string]int64{
+			ErrorMalformedRow: 2, ErrorLookupMiss: 0, ErrorConnection: 0, ErrorBatchRetry: 3, ErrorReconnect: 0,
+		},
+	})
+}
+
+func TestImportAccountingBalances(t *testing.T) {
+	l := withConnConfig(t, 5)
+	var input strings.Builder
+	input.WriteString("GlobalRank,Domain\n")
+	for i := 1; i <= 1000; i++ {
+		fmt.Fprintf(&input, "%d,domain%d.com\n", i, i)
+		if i%250 == 0 {
+			input.WriteString("broken\n")
+		}
+	}
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte(input.String()), 0o644))
+	var err error
+	l.config, err = ParseFlags([]string{"-csv", filename, "-max-errors", "10", "-max-connection-errors", "5"})
+	assert.NilError(t, err)
+
+	// the sink executes every batch without a server, so the rows are only counted
+	connector := &goneAwayConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	stats, err := New(db, l.config).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsRead, int64(1004))
+	assert.Equal(t, stats.Committed(), int64(1000))
+	assert.Equal(t, stats.RowsFailed, int64(4))
+	assert.Equal(t, stats.Unaccounted(), int64(0))
+	// the sink received the values of every committed row
+	assert.Equal(t, connector.values.Load(), int64(2*1000))
+	assert.Equal(t, stats.BatchesExecuted, connector.execs.Load())
+	// a batch has -batch-size rows at most
+	assert.Assert(t, stats.BatchesExecuted >= 1000/int64(l.config.BatchSize), stats.BatchesExecuted)
+}
+
+func TestImportDryRun(t *testing.T) {
+	l := withConnConfig(t, 5)
+	var input strings.Builder
+	input.WriteString("GlobalRank,Domain\n")
+	for i := 1; i <= 100; i++ {
+		fmt.Fprintf(&input, "%d,domain%d.com\n", i, i)
+	}
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte(input.String()), 0o644))
+	var err error
+	l.config, err = ParseFlags([]string{"-csv", filename, "-dry-run", "-workers", "4", "-idempotency-table", "import_batches"})
+	assert.NilError(t, err)
+
+	connector := &goneAwayConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	stats, err := New(db, l.config).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsRead, int64(100))
+	assert.Equal(t, stats.Committed(), int64(100))
+	assert.Equal(t, stats.Unaccounted(), int64(0))
+	// not even a connection was opened
+	assert.Equal(t, connector.attempts.Load(), int64(0))
+}
+
+func TestDryRunNeedsNoDatabase(t *testing.T) {
+	for _, flags := range [][]string{
+		{"-lookup=Tld=SELECT id FROM tld WHERE code = ?", "-lookup-miss=null"},
+		{"-table-template=domain_{{date}}"},
+		{"-checkpoint-file=import.checkpoint"},
+	} {
+		_, err := ParseFlags(append([]string{"-dry-run"}, flags...))
+		assert.ErrorContains(t, err, "-dry-run can't be combined with")
+	}
+}
+
+func TestLoaderRunReader(t *testing.T) {
+	c, err := ParseFlags([]string{"-dry-run", "-workers", "2"})
+	assert.NilError(t, err)
+
+	stats, err := New(nil, c).RunReader(context.Background(), strings.NewReader("GlobalRank,Domain\n1,google.com\n2,youtube.com\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsRead, int64(2))
+	assert.Equal(t, stats.Committed(), int64(2))
+}
+
+// slowReader returns a line per Read, after a delay
+type slowReader struct {
+	lines []string
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.lines) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	n := copy(p, r.lines[0])
+	r.lines = r.lines[1:]
+	return n, nil
+}
+
+func TestLoadersRunConcurrently(t *testing.T) {
+	var input strings.Builder
+	input.WriteString("GlobalRank,Domain\n")
+	for i := 1; i <= 100; i++ {
+		fmt.Fprintf(&input, "%d,domain%d.com\n", i, i)
+	}
+	// the loaders differ in all settings their workers use, a shared setting makes a statement fail
+	for _, size := range []int{2, 5} {
+		t.Run(fmt.Sprint("batch size ", size), func(t *testing.T) {
+			t.Parallel()
+			table := fmt.Sprint("ranks", size)
+			c, err := ParseFlags([]string{"-table", table, "-dialect", "sqlite", "-workers", "2", "-batch-size", fmt.Sprint(size)})
+			assert.NilError(t, err)
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			assert.NilError(t, err)
+			defer db.Close()
+			query := fmt.Sprintf(`INSERT INTO "%s" ("GlobalRank","Domain") VALUES (?,?)`, table) + strings.Repeat(", (?,?)", size-1)
+			for i := 0; i < 100/size; i++ {
+				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, int64(size)))
+			}
+
+			stats, err := New(db, c).RunReader(context.Background(), strings.NewReader(input.String()))
+			assert.NilError(t, err)
+			assert.NilError(t, mock.ExpectationsWereMet())
+			assert.Equal(t, stats.RowsInserted, int64(100))
+			assert.Equal(t, stats.BatchesExecuted, int64(100/size))
+		})
+	}
+}
+
+func TestLoaderRunTimeout(t *testing.T) {
+	c, err := ParseFlags([]string{"-dry-run", "-timeout", "100ms"})
+	assert.NilError(t, err)
+	r := &slowReader{lines: []string{"GlobalRank,Domain\n"}, delay: 20 * time.Millisecond}
+	for i := 1; i <= 100; i++ {
+		r.lines = append(r.lines, fmt.Sprintf("%d,domain%d.com\n", i, i))
+	}
+
+	stats, err := New(nil, c).RunReader(context.Background(), r)
+	assert.ErrorContains(t, err, "-timeout 100ms reached")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// the rows read before the deadline are inserted
+	assert.Assert(t, stats.RowsRead > 0 && stats.RowsRead < 100)
+	assert.Equal(t, stats.Committed(), stats.RowsRead)
+
+	_, err = ParseFlags([]string{"-timeout", "-1s"})
+	assert.ErrorContains(t, err, "invalid timeout -1s, must not be negative")
+	_, err = ParseFlags([]string{"-batch-timeout", "-1s"})
+	assert.ErrorContains(t, err, "invalid batch-timeout -1s, must not be negative")
+}
+
+func TestLoaderRunResetsDeadLetter(t *testing.T) {
+	l := withConnConfig(t, 5)
+	filename := filepath.Join(t.TempDir(), "dead.csv")
+	c, err := ParseFlags([]string{"-dry-run", "-transform", "GlobalRank=int", "-dead-letter-file", filename})
+	assert.NilError(t, err)
+	stats, err := New(nil, c).RunReader(context.Background(), strings.NewReader("GlobalRank,Domain\n1,google.com\nx,youtube.com\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsDeadLettered, int64(1))
+	assert.Assert(t, l.deadLetter == nil)
+
+	// the dead letter of the first run is closed, the second run doesn't write to it
+	c, err = ParseFlags([]string{"-dry-run"})
+	assert.NilError(t, err)
+	stats, err = New(nil, c).RunReader(context.Background(), strings.NewReader("GlobalRank,Domain\n1,google.com\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsDeadLettered, int64(0))
+}
+
+func TestProcessCSVCompressed(t *testing.T) {
+	c, err := ParseFlags([]string{"-dry-run"})
+	assert.NilError(t, err)
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err = io.WriteString(gz, "GlobalRank,Domain\n1,google.com\n2,youtube.com\n3,facebook.com\n")
+	assert.NilError(t, err)
+	assert.NilError(t, gz.Close())
+
+	stats, err := ProcessCSV(context.Background(), &compressed, nil, c)
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsRead, int64(3))
+}
+
+func TestLoaderRunGlob(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"part-0002.csv": "GlobalRank,Domain\n3,facebook.com\n",
+		"part-0001.csv": "GlobalRank,Domain\n1,google.com\n2,youtube.com\n",
+		"other.csv":     "GlobalRank,Domain\n4,example.com\n",
+	} {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	c, err := ParseFlags([]string{"-dry-run", "-workers", "2", filepath.Join(dir, "part-*.csv")})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c.Inputs(), []string{filepath.Join(dir, "part-0001.csv"), filepath.Join(dir, "part-0002.csv")})
+
+	stats, err := New(nil, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, stats.Inputs, []InputStats{
+		{Name: filepath.Join(dir, "part-0001.csv"), RowsRead: 2, RowsInserted: 2},
+		{Name: filepath.Join(dir, "part-0002.csv"), RowsRead: 1, RowsInserted: 1},
+	})
+
+	_, err = ParseFlags([]string{"-csv", filepath.Join(dir, "missing-*.csv")})
+	assert.ErrorContains(t, err, "no input matches")
+}
+
+func TestLoaderRun(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain\n1,google.com\n2,youtube.com\n3,facebook.com\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-workers", "1", "-batch-size", "2", "-table", "ranks"})
+	assert.NilError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION").
+		WithArgs("ranks").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("GlobalRank").AddRow("Domain"))
+	// the collation check isn't expected, it only logs a warning when it fails
+	mock.ExpectExec("INSERT INTO `ranks` (`GlobalRank`,`Domain`) VALUES (?,?), (?,?)").
+		WithArgs("1", "google.com", "2", "youtube.com").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO `ranks` (`GlobalRank`,`Domain`) VALUES (?,?)").
+		WithArgs("3", "facebook.com").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	loader := New(db, c)
+	stats, err := loader.Run(context.Background())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, loader.headers, []string{"GlobalRank", "Domain"})
+	assert.Equal(t, stats.RowsRead, int64(3))
+	assert.Equal(t, stats.RowsInserted, int64(3))
+	assert.Equal(t, stats.BatchesExecuted, int64(2))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
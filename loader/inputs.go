@@ -0,0 +1,92 @@
+package loader
+
+import (
+	"sort"
+	"sync"
+)
+
+// InputStats are the rows of a single input of an import
+type InputStats struct {
+	// Name is the file (or archive entry) the rows are read from
+	Name string
+	// RowsRead are the data rows read from the input, including the skipped malformed ones
+	RowsRead int64
+	// RowsInserted are the rows of the input in successfully executed batches
+	RowsInserted int64
+}
+
+// InputCounter attributes the inserted rows to the inputs they were read from by their row numbers, the inputs
+// are read one after another, so every input is a range of row numbers. It is safe for concurrent use. A nil
+// *InputCounter counts nothing.
+type InputCounter struct {
+	mu sync.Mutex
+	// first are the numbers of the first rows of inputs in order
+	first  []int
+	inputs []InputStats
+}
+
+// NewInputCounter creates a counter without inputs
+func NewInputCounter() *InputCounter {
+	return &InputCounter{}
+}
+
+// Start starts counting the input name whose first row has the number first
+func (c *InputCounter) Start(name string, first int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.first = append(c.first, first)
+	c.inputs = append(c.inputs, InputStats{Name: name})
+}
+
+// End records the rows read from the current input
+func (c *InputCounter) End(read int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.inputs) > 0 {
+		c.inputs[len(c.inputs)-1].RowsRead = int64(read)
+	}
+}
+
+// Inserted counts the inserted rows for their inputs
+func (c *InputCounter) Inserted(rows []int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, row := range rows {
+		// the last input starting at or before row
+		if i := sort.SearchInts(c.first, row+1) - 1; i >= 0 {
+			c.inputs[i].RowsInserted++
+		}
+	}
+}
+
+// Name returns the name of the input of row, empty for a row before the first input
+func (c *InputCounter) Name(row int) string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := sort.SearchInts(c.first, row+1) - 1; i >= 0 {
+		return c.inputs[i].Name
+	}
+	return ""
+}
+
+// Stats returns the rows of the inputs in the order they were read
+func (c *InputCounter) Stats() []InputStats {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]InputStats(nil), c.inputs...)
+}
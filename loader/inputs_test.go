@@ -0,0 +1,27 @@
+package loader
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestInputCounter(t *testing.T) {
+	c := NewInputCounter()
+	c.Start("a.csv", 1)
+	c.Inserted([]int{1, 2})
+	c.End(3)
+	c.Start("b.csv", 4)
+	// the batches of a worker may span inputs and are committed in any order
+	c.Inserted([]int{5, 3, 4})
+	c.End(2)
+	assert.DeepEqual(t, c.Stats(), []InputStats{
+		{Name: "a.csv", RowsRead: 3, RowsInserted: 3},
+		{Name: "b.csv", RowsRead: 2, RowsInserted: 2},
+	})
+
+	var none *InputCounter
+	none.Start("a.csv", 1)
+	none.Inserted([]int{1})
+	assert.Assert(t, none.Stats() == nil)
+}
@@ -0,0 +1,165 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// formats of the inputs accepted by -input-format
+const (
+	// InputFormatCSV is a CSV file with a header
+	InputFormatCSV = "csv"
+	// InputFormatJSONLines is a JSON Lines (NDJSON) file with an object per line, the keys are the columns
+	InputFormatJSONLines = "jsonl"
+	// InputFormatXLSX is an Excel workbook, the rows of its -sheet are read from the header row on
+	InputFormatXLSX = "xlsx"
+)
+
+var inputFormats = []string{InputFormatCSV, InputFormatJSONLines, InputFormatXLSX}
+
+// jsonLinesReader reads a JSON Lines input like a CSV one: the first Read returns the keys of the first object as
+// header, the following ones the values of the objects in the order of the header. A key missing in an object is
+// an empty field (NULL with -empty-as-null), a key which isn't in the header makes the object a malformed row.
+type jsonLinesReader struct {
+	reader *bufio.Reader
+	offset int64
+	line   int
+	header []string
+	// columns are the indexes of the keys in the header
+	columns map[string]int
+	// first are the values of the first object, read together with the header
+	first []string
+}
+
+func newJSONLinesReader(r io.Reader) *jsonLinesReader {
+	return &jsonLinesReader{reader: bufio.NewReader(r)}
+}
+
+func (r *jsonLinesReader) Read() ([]string, error) {
+	if r.header == nil {
+		keys, values, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		r.header, r.first = keys, values
+		r.columns = make(map[string]int, len(keys))
+		for i, key := range keys {
+			r.columns[key] = i
+		}
+		return append([]string(nil), keys...), nil
+	}
+	if r.first != nil {
+		row := r.first
+		r.first = nil
+		return row, nil
+	}
+
+	keys, values, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	row := make([]string, len(r.header))
+	for i, key := range keys {
+		column, ok := r.columns[key]
+		if !ok {
+			return nil, r.parseError(fmt.Errorf("key %q is not in the header %v", key, r.header))
+		}
+		row[column] = values[i]
+	}
+	return row, nil
+}
+
+func (r *jsonLinesReader) InputOffset() int64 {
+	return r.offset
+}
+
+// next parses the next line which isn't blank
+func (r *jsonLinesReader) next() ([]string, []string, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		r.offset += int64(len(line))
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return nil, nil, err
+		}
+		r.line++
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		keys, values, err := parseJSONObject(line)
+		if err != nil {
+			return nil, nil, r.parseError(err)
+		}
+		return keys, values, nil
+	}
+}
+
+// parseError returns a malformed line as *csv.ParseError, which is skipped within -max-errors like a malformed
+// CSV row
+func (r *jsonLinesReader) parseError(err error) error {
+	return &csv.ParseError{StartLine: r.line, Line: r.line, Err: err}
+}
+
+// parseJSONObject returns the keys of the JSON object line in their order and the values as fields
+func parseJSONObject(line []byte) ([]string, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, nil, errors.New("not a JSON object")
+	}
+	var keys, values []string
+	seen := make(map[string]bool)
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := t.(string)
+		if seen[key] {
+			return nil, nil, fmt.Errorf("duplicate key %q", key)
+		}
+		seen[key] = true
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return nil, nil, err
+		}
+		value, err := jsonField(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, errors.New("data after the JSON object")
+	}
+	return keys, values, nil
+}
+
+// jsonField converts a JSON value to a field: a string is unquoted, null is empty, true and false are 1 and 0,
+// numbers are kept as written and nested objects and arrays as JSON (e.g. for a JSON column)
+func jsonField(raw json.RawMessage) (string, error) {
+	switch raw[0] {
+	case '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case 'n':
+		return "", nil
+	case 't':
+		return "1", nil
+	case 'f':
+		return "0", nil
+	case '{', '[':
+		var compact bytes.Buffer
+		err := json.Compact(&compact, raw)
+		return compact.String(), err
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,73 @@
+package loader
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestJSONLinesReader(t *testing.T) {
+	input := `{"GlobalRank": 1, "Domain": "google.com", "Tags": ["search"], "Active": true}
+
+{"Domain": "youtube.com", "GlobalRank": 2, "Active": false, "Tags": null}
+{"GlobalRank": 3}
+{"GlobalRank": 4, "Country": "de"}
+[4, "facebook.com"]
+{"GlobalRank": 5, "Domain": "a\"b"}
+`
+	reader := newJSONLinesReader(strings.NewReader(input))
+	header, err := reader.Read()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, header, []string{"GlobalRank", "Domain", "Tags", "Active"})
+
+	for _, want := range [][]string{
+		{"1", "google.com", `["search"]`, "1"},
+		// the values are in the order of the header, whatever the order of the keys
+		{"2", "youtube.com", "", "0"},
+		{"3", "", "", ""},
+	} {
+		row, err := reader.Read()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, row, want)
+	}
+	for _, want := range []string{`key "Country" is not in the header`, "not a JSON object"} {
+		_, err = reader.Read()
+		var parseErr *csv.ParseError
+		assert.Assert(t, errors.As(err, &parseErr), err)
+		assert.ErrorContains(t, err, want)
+	}
+	row, err := reader.Read()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, row, []string{"5", `a"b`, "", ""})
+	_, err = reader.Read()
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, reader.InputOffset(), int64(len(input)))
+}
+
+func TestLoaderRunJSONLines(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "domains.jsonl")
+	assert.NilError(t, os.WriteFile(filename, []byte(`{"GlobalRank": 1, "Domain": "google.com"}
+{"GlobalRank": 2, "Domain": "youtube.com"
+{"GlobalRank": 3, "Domain": "facebook.com"}
+`), 0o644))
+	c, err := ParseFlags([]string{"-dry-run", "-input-format", "jsonl", "-max-errors", "1", "-csv", filename})
+	assert.NilError(t, err)
+
+	stats, err := New(nil, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsRead, int64(3))
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	assert.Equal(t, stats.Errors[ErrorMalformedRow], int64(1))
+
+	_, err = ParseFlags([]string{"-input-format", "xml"})
+	assert.ErrorContains(t, err, "invalid input-format 'xml'")
+	_, err = ParseFlags([]string{"-input-format", "jsonl", "-delimiter", ";"})
+	assert.ErrorContains(t, err, "only apply to -input-format csv")
+}
@@ -0,0 +1,108 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// kafkaStream is the MessageStream of a Kafka consumer group, the offsets are only committed by Commit
+type kafkaStream struct {
+	client *kgo.Client
+	// polled are the records polled and not fetched yet, only used by Fetch
+	polled []*kgo.Record
+
+	mu sync.Mutex
+	// fetched are the records fetched and not committed yet, in the order of Fetch
+	fetched []*kgo.Record
+}
+
+// NewKafkaStream returns the stream of the records client consumes, the client is a member of a consumer group
+// (kgo.ConsumerGroup) with kgo.DisableAutoCommit, so only the records whose rows are done are committed. Every
+// record is a message, Offset is the *kgo.Record.
+func NewKafkaStream(client *kgo.Client) MessageStream {
+	return &kafkaStream{client: client}
+}
+
+// OpenKafkaSource consumes the topic of a kafka://broker1:9092,broker2:9092/topic?group=loader URL as a
+// StreamSource. The members of the consumer group share the partitions of the topic, a new group starts at the
+// first record. The columns parameter is the header of CSV records (columns=GlobalRank,Domain), without it the
+// records are JSON objects (-input-format jsonl).
+func OpenKafkaSource(rawURL string) (CSVSource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	topic, group := strings.TrimPrefix(u.Path, "/"), u.Query().Get("group")
+	if u.Host == "" || topic == "" || group == "" {
+		return nil, fmt.Errorf("invalid Kafka URL %s, must be kafka://broker:9092/topic?group=name", rawURL)
+	}
+	var header []string
+	if columns := u.Query().Get("columns"); columns != "" {
+		header = strings.Split(columns, ",")
+	}
+	log.Printf("Consume Kafka topic '%s' as group %s\n", topic, group)
+	client, err := kgo.NewClient(kgo.SeedBrokers(strings.Split(u.Host, ",")...), kgo.ConsumeTopics(topic),
+		kgo.ConsumerGroup(group), kgo.DisableAutoCommit())
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamSource(topic, header, NewKafkaStream(client)), nil
+}
+
+func (s *kafkaStream) Fetch(ctx context.Context) (Message, error) {
+	for len(s.polled) == 0 {
+		fetches := s.client.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			return Message{}, err
+		}
+		if fetches.IsClientClosed() {
+			return Message{}, io.EOF
+		}
+		var errs []error
+		fetches.EachError(func(topic string, partition int32, err error) {
+			errs = append(errs, fmt.Errorf("fetching partition %d of topic %s failed: %w", partition, topic, err))
+		})
+		if len(errs) > 0 {
+			return Message{}, errors.Join(errs...)
+		}
+		s.polled = fetches.Records()
+	}
+	r := s.polled[0]
+	s.polled = s.polled[1:]
+	s.mu.Lock()
+	s.fetched = append(s.fetched, r)
+	s.mu.Unlock()
+	return Message{Value: r.Value, Offset: r}, nil
+}
+
+// Commit commits the offsets of the partitions of the records fetched up to msg, records of other partitions
+// fetched before msg are done as well. A failed commit is left to the next one.
+func (s *kafkaStream) Commit(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	n := slices.Index(s.fetched, msg.Offset.(*kgo.Record)) + 1
+	records := s.fetched[:n]
+	s.fetched = s.fetched[n:]
+	s.mu.Unlock()
+	err := s.client.CommitRecords(ctx, records...)
+	if err != nil {
+		s.mu.Lock()
+		s.fetched = slices.Concat(records, s.fetched)
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// Close leaves the consumer group, its partitions are handed to the other members
+func (s *kafkaStream) Close() error {
+	s.client.Close()
+	return nil
+}
@@ -0,0 +1,76 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+)
+
+func TestKafkaSourceResumesAfterCommittedRows(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.SeedTopics(1, "domains"))
+	assert.NilError(t, err)
+	defer cluster.Close()
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.DefaultProduceTopic("domains"))
+	assert.NilError(t, err)
+	defer client.Close()
+	for _, v := range []string{"1,google.com", "2,youtube.com", "3,facebook.com", "4,baidu.com"} {
+		assert.NilError(t, client.ProduceSync(context.Background(), kgo.StringRecord(v)).FirstErr())
+	}
+	committed := func() int64 {
+		offsets, err := kadm.NewClient(client).FetchOffsets(context.Background(), "loader")
+		assert.NilError(t, err)
+		offset, _ := offsets.Lookup("domains", 0)
+		return offset.At
+	}
+
+	c, err := ParseFlags([]string{"-csv", "kafka://" + cluster.ListenAddrs()[0] + "/domains?group=loader&columns=GlobalRank,Domain",
+		"-dialect", "sqlite", "-table", "domain", "-workers", "1", "-batch-size", "2", "-max-retries", "0"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	const insert = `INSERT INTO "domain" ("GlobalRank","Domain") VALUES (?,?), (?,?)`
+	mock.ExpectExec(insert).WithArgs("1", "google.com", "2", "youtube.com").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(insert).WithArgs("3", "facebook.com", "4", "baidu.com").WillReturnError(errors.New("disk full"))
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.ErrorContains(t, err, "disk full")
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	assert.Equal(t, committed(), int64(2))
+
+	// the group resumes with the records of the failed batch, the import runs until it is interrupted
+	mock.ExpectExec(insert).WithArgs("3", "facebook.com", "4", "baidu.com").WillReturnResult(sqlmock.NewResult(0, 2))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		stats, err = New(db, c).Run(ctx)
+		done <- err
+	}()
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if committed() == 4 {
+			return poll.Success()
+		}
+		return poll.Continue("rows not committed yet")
+	}, poll.WithTimeout(10*time.Second))
+	cancel()
+	assert.ErrorContains(t, <-done, "import interrupted after 2 rows")
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestOpenKafkaSource(t *testing.T) {
+	for _, rawURL := range []string{"kafka://broker:9092/domains", "kafka://broker:9092?group=loader", "kafka:///domains?group=loader"} {
+		_, err := OpenKafkaSource(rawURL)
+		assert.ErrorContains(t, err, "must be kafka://broker:9092/topic?group=name", rawURL)
+	}
+	_, err := OpenCSVSources([]string{"kafka://broker:9092/domains?group=loader", "domains.csv"})
+	assert.ErrorContains(t, err, "the stream kafka://broker:9092/domains?group=loader can't be combined with other inputs")
+}
@@ -0,0 +1,124 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the buckets of the batch latency histogram of the summary, the batches
+// slower than the last one are counted in a bucket of their own
+var latencyBuckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second,
+	2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// latencyHistogram counts the execution times of the successful batches of all workers in latencyBuckets. A nil
+// *latencyHistogram counts nothing.
+type latencyHistogram struct {
+	mu      sync.Mutex
+	buckets []int64
+	count   int64
+	sum     time.Duration
+	max     time.Duration
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{buckets: make([]int64, len(latencyBuckets)+1)}
+}
+
+// Observe counts a batch executed in d
+func (h *latencyHistogram) Observe(d time.Duration) {
+	if h == nil {
+		return
+	}
+	i := len(latencyBuckets)
+	for b, le := range latencyBuckets {
+		if d <= le {
+			i = b
+			break
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buckets[i]++
+	h.count++
+	h.sum += d
+	h.max = max(h.max, d)
+}
+
+// LatencyBucket is a bucket of the BatchLatency, the batches which took longer than the bucket before it and at
+// most Le (0 for the batches slower than all buckets)
+type LatencyBucket struct {
+	Le      time.Duration
+	Batches int64
+}
+
+// BatchLatency is the histogram of the execution times of the successful batches, only the buckets with batches
+type BatchLatency struct {
+	Batches int64
+	Mean    time.Duration
+	Max     time.Duration
+	Buckets []LatencyBucket
+}
+
+// Latency returns the histogram of the batches counted so far
+func (h *latencyHistogram) Latency() BatchLatency {
+	if h == nil {
+		return BatchLatency{}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l := BatchLatency{Batches: h.count, Max: h.max}
+	if h.count > 0 {
+		l.Mean = h.sum / time.Duration(h.count)
+	}
+	for i, n := range h.buckets {
+		if n == 0 {
+			continue
+		}
+		var le time.Duration
+		if i < len(latencyBuckets) {
+			le = latencyBuckets[i]
+		}
+		l.Buckets = append(l.Buckets, LatencyBucket{Le: le, Batches: n})
+	}
+	return l
+}
+
+// Quantile returns the upper bound of the bucket of the batch at quantile q (e.g. 0.99), the maximum for the
+// batches slower than all buckets
+func (l BatchLatency) Quantile(q float64) time.Duration {
+	rank := int64(q * float64(l.Batches))
+	var n int64
+	for _, b := range l.Buckets {
+		n += b.Batches
+		if n > rank || n == l.Batches {
+			if b.Le == 0 {
+				return l.Max
+			}
+			return min(b.Le, l.Max)
+		}
+	}
+	return 0
+}
+
+// Write draws the histogram with a bar of # per bucket, scaled to the fullest bucket
+func (l BatchLatency) Write(w io.Writer) {
+	const width = 40
+	var most int64
+	for _, b := range l.Buckets {
+		most = max(most, b.Batches)
+	}
+	for _, b := range l.Buckets {
+		label := "<= " + b.Le.String()
+		if b.Le == 0 {
+			label = "> " + latencyBuckets[len(latencyBuckets)-1].String()
+		}
+		bar := strings.Repeat("#", max(1, int(b.Batches*width/most)))
+		fmt.Fprintf(w, "%10s %-*s %d (%.1f%%)\n", label, width, bar, b.Batches, float64(b.Batches)*100/float64(l.Batches))
+	}
+}
@@ -0,0 +1,63 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := newLatencyHistogram()
+	for _, d := range []time.Duration{300 * time.Microsecond, 3 * time.Millisecond, 4 * time.Millisecond,
+		4 * time.Millisecond, 40 * time.Millisecond, time.Minute} {
+		h.Observe(d)
+	}
+	l := h.Latency()
+	assert.Equal(t, l.Batches, int64(6))
+	assert.Equal(t, l.Max, time.Minute)
+	assert.DeepEqual(t, l.Buckets, []LatencyBucket{{time.Millisecond, 1}, {5 * time.Millisecond, 3},
+		{50 * time.Millisecond, 1}, {0, 1}})
+	assert.Equal(t, l.Quantile(0.5), 5*time.Millisecond)
+	assert.Equal(t, l.Quantile(0.8), 50*time.Millisecond)
+	assert.Equal(t, l.Quantile(0.99), time.Minute)
+
+	var out strings.Builder
+	l.Write(&out)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Equal(t, len(lines), 4)
+	assert.Assert(t, strings.HasPrefix(strings.TrimSpace(lines[1]), "<= 5ms "+strings.Repeat("#", 40)), lines[1])
+	assert.Assert(t, strings.HasSuffix(lines[3], " 1 (16.7%)"), lines[3])
+	assert.Assert(t, strings.Contains(lines[3], "> 10s"), lines[3])
+
+	var none *latencyHistogram
+	none.Observe(time.Second)
+	assert.Equal(t, none.Latency().Batches, int64(0))
+}
+
+func TestImportBatchLatency(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ranks.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("domain\na.com\nb.com\nc.com\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-table", "ranks", "-dialect", "sqlite", "-workers", "1", "-batch-size", "2",
+		"-slow-batch-threshold", "1ns"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New()
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec("INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.BatchLatency.Batches, int64(2))
+	assert.Equal(t, stats.SlowBatches, int64(2))
+	summary := NewSummary(stats, nil)
+	assert.Equal(t, summary.BatchLatency.SlowBatches, int64(2))
+	assert.Assert(t, len(summary.BatchLatency.Buckets) > 0)
+}
@@ -0,0 +1,194 @@
+package loader
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+)
+
+// modes of the import accepted by -mode
+const (
+	// ModeInsert inserts the rows with multi-row INSERTs of the workers
+	ModeInsert = "insert"
+	// ModeLoadData streams the rows into LOAD DATA LOCAL INFILE statements, a single one without -load-data-chunk
+	ModeLoadData = "load-data"
+)
+
+var importModes = []string{ModeInsert, ModeLoadData}
+
+// loadDataHandlers numbers the reader handlers registered for LOAD DATA, every load gets its own
+var loadDataHandlers atomic.Int64
+
+// loadDataBlockers returns the flags which need the rows to go through the workers, the import falls back to
+// ModeInsert when one of them is given
+func (c *Config) loadDataBlockers() []string {
+	var blockers []string
+	add := func(given bool, flag string) {
+		if given {
+			blockers = append(blockers, "-"+flag)
+		}
+	}
+	add(len(c.Transforms) > 0 || c.RowTransform != nil, "transform")
+	add(c.Plugin != "" || c.RowProcessor != nil, "plugin")
+	add(c.Coerce, "coerce")
+	add(len(c.ColumnMap) > 0, "map")
+	add(len(c.SkipColumns) > 0, "skip-columns")
+	add(len(c.Constants) > 0, "constant")
+	add(len(c.Generated) > 0, "generate")
+	add(c.Lineage, "lineage")
+	add(len(c.Shards) > 0, "shard")
+	add(c.OnDuplicate != OnDuplicateError, "on-duplicate")
+	add(len(c.Lookups) > 0, "lookup")
+	add(len(c.ValueExprs) > 0, "value-expr")
+	add(len(c.Pads) > 0, "pad")
+	add(len(c.TrimQuotes) > 0, "trim-quotes")
+	add(c.EmptyAsNull, "empty-as-null")
+	add(len(c.NullValues) > 0, "null-values")
+	add(c.IdempotencyTable != "", "idempotency-table")
+	add(c.TableTemplate != "", "table-template")
+	add(len(c.Routes) > 0, "route")
+	add(c.SplitFailedBatches, "split-failed-batches")
+	add(c.DryRun, "dry-run")
+	add(c.Explain > 0, "explain")
+	// the sum of the inserted values is taken by the workers
+	add(c.VerifySum != "", "verify-sum")
+	return blockers
+}
+
+// useLoadData reports whether the rows are loaded with LOAD DATA, a fallback to the workers is logged
+func (c *Config) useLoadData() bool {
+	if c.Mode != ModeLoadData {
+		return false
+	}
+	if blockers := c.loadDataBlockers(); len(blockers) > 0 {
+		log.Warnf("Inserting with the workers instead of LOAD DATA because of %s", strings.Join(blockers, ", "))
+		return false
+	}
+	return true
+}
+
+// buildLoadDataQuery builds the LOAD DATA statement reading the rows written by loadData from the reader handler
+// handler into columns of table
+func buildLoadDataQuery(d Dialect, handler string, table string, columns []string, delimiter rune) string {
+	return fmt.Sprintf("LOAD DATA LOCAL INFILE %s INTO TABLE %s CHARACTER SET utf8mb4 FIELDS TERMINATED BY %s "+
+		"OPTIONALLY ENCLOSED BY '\"' ESCAPED BY '' LINES TERMINATED BY '\\n' (%s)",
+		quoteSQLString("Reader::"+handler), quoteTable(d, table), quoteSQLString(string(cmp.Or(delimiter, ','))),
+		strings.Join(quoteIdentifiers(d, columns), ","))
+}
+
+// StartLoadData starts a single worker loading the rows of jobs into the table with LOAD DATA LOCAL INFILE
+// statements of LoadDataChunk rows each (a single one without), the rows are written to them as CSV while they are
+// read. The server needs local_infile enabled.
+func (l *Loader) StartLoadData(ctx context.Context, jobs <-chan Job) *Workers {
+	execCtx, cancel := graceContext(ctx, l.config.ShutdownGrace)
+	workers := &Workers{cancel: cancel}
+	workers.wg.Add(1)
+	go func() {
+		defer workers.wg.Done()
+		if err := l.loadData(execCtx, l.DB, l.config.InsertTable(), l.headers, jobs); err != nil {
+			log.Errorf("LOAD DATA failed: %s", err.Error())
+			workers.fail(err)
+		}
+	}()
+	return workers
+}
+
+// loadData executes the LOAD DATA statements for the rows of jobs, one per chunk of config.LoadDataChunk rows. A
+// statement is all or nothing: when it fails its rows and the rows left count as failed, the chunks loaded before
+// stay loaded (and are checkpointed, so -resume goes on after them). Rows the server skipped (e.g. duplicate keys)
+// count as failed as well.
+func (l *Loader) loadData(ctx context.Context, db *sql.DB, table string, columns []string, jobs <-chan Job) error {
+	sess, err := l.openSession(ctx, db, 0, rand.New(rand.NewSource(time.Now().UnixNano())))
+	if err != nil {
+		l.discard(jobs)
+		return err
+	}
+	defer sess.Close()
+
+	for {
+		// the statement waits for the first row of its chunk, so there is none without rows
+		first, ok := <-jobs
+		if !ok {
+			return nil
+		}
+		if err := l.loadDataChunk(ctx, sess, table, columns, first, jobs, l.config.LoadDataChunk); err != nil {
+			l.discard(jobs)
+			return err
+		}
+	}
+}
+
+// loadDataChunk executes a LOAD DATA statement for first and the following rows of jobs, up to chunk rows (all rows
+// of jobs for 0)
+func (l *Loader) loadDataChunk(ctx context.Context, sess *session, table string, columns []string, first Job, jobs <-chan Job, chunk int) error {
+	r, w := io.Pipe()
+	handler := fmt.Sprintf("go-mysql-worker-%d", loadDataHandlers.Add(1))
+	mysql.RegisterReaderHandler(handler, func() io.Reader { return r })
+	defer mysql.DeregisterReaderHandler(handler)
+
+	var rows []int
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		csvWriter := csv.NewWriter(w)
+		// a Config of an embedding program may leave the delimiter unset, the reader falls back to a comma as well
+		csvWriter.Comma = cmp.Or(l.config.Delimiter, ',')
+		for job, ok := first, true; ok; {
+			rows = append(rows, job.Row)
+			// a row failing to be written means the statement failed, the rows left of the chunk are drained
+			if err := csvWriter.Write(job.Values); err == nil {
+				l.aggregates.Add(job.Values, len(job.Values))
+			}
+			if chunk > 0 && len(rows) == chunk {
+				break
+			}
+			job, ok = <-jobs
+		}
+		csvWriter.Flush()
+		w.CloseWithError(csvWriter.Error())
+	}()
+
+	start := time.Now()
+	l.workerStats.Begin(sess.workerIndex)
+	res, err := sess.conn.ExecContext(ctx, buildLoadDataQuery(l.config.dialect(), handler, table, columns, l.config.Delimiter))
+	l.workerStats.End(sess.workerIndex, err)
+	// a statement failing before reading everything must not block the writer
+	r.CloseWithError(fmt.Errorf("LOAD DATA finished"))
+	<-written
+	duration := time.Since(start)
+	l.metrics.Batch(sess.workerIndex, duration, err)
+	sent := int64(len(rows))
+	if err != nil {
+		l.rowsFailed.Add(sent)
+		return fmt.Errorf("LOAD DATA into %s failed: %w", table, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		l.rowsFailed.Add(sent)
+		return err
+	}
+	l.rowsInserted.Add(affected)
+	l.batchesExecuted.Add(1)
+	l.reporter.Batch(sess.workerIndex)
+	l.workerStats.Batch(sess.workerIndex, affected, duration)
+	l.checkpoint.Done(rows)
+	if skipped := sent - affected; skipped > 0 {
+		log.Warnf("LOAD DATA skipped %d of %d rows, e.g. because of duplicate keys", skipped, sent)
+		l.rowsFailed.Add(skipped)
+	} else {
+		// which rows the server skipped isn't known, the rows are only attributed to their inputs when none was
+		l.inputCounter.Inserted(rows)
+	}
+	log.Printf("LOAD DATA loaded %d rows in %s", affected, time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,134 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestBuildLoadDataQuery(t *testing.T) {
+	query := buildLoadDataQuery(mysqlDialect{}, "go-mysql-worker-1", "stats.domain", []string{"GlobalRank", "Domain"}, ';')
+	assert.Equal(t, query, "LOAD DATA LOCAL INFILE 'Reader::go-mysql-worker-1' INTO TABLE `stats`.`domain` CHARACTER SET utf8mb4 "+
+		"FIELDS TERMINATED BY ';' OPTIONALLY ENCLOSED BY '\"' ESCAPED BY '' LINES TERMINATED BY '\\n' (`GlobalRank`,`Domain`)")
+	query = buildLoadDataQuery(mysqlDialect{}, "h", "domain", []string{"Domain"}, '\t')
+	assert.Equal(t, query, "LOAD DATA LOCAL INFILE 'Reader::h' INTO TABLE `domain` CHARACTER SET utf8mb4 "+
+		"FIELDS TERMINATED BY '\t' OPTIONALLY ENCLOSED BY '\"' ESCAPED BY '' LINES TERMINATED BY '\\n' (`Domain`)")
+	// an unset delimiter of a library Config is a comma like for the reader
+	query = buildLoadDataQuery(mysqlDialect{}, "h", "domain", []string{"Domain"}, 0)
+	assert.Assert(t, strings.Contains(query, "FIELDS TERMINATED BY ','"), query)
+}
+
+func TestLoadDataFallback(t *testing.T) {
+	c, err := ParseFlags([]string{"-mode", "load-data"})
+	assert.NilError(t, err)
+	assert.Assert(t, c.useLoadData())
+
+	c, err = ParseFlags([]string{"-mode", "load-data", "-map", "Domain=name", "-on-duplicate", "update", "-transform", "GlobalRank=int"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c.loadDataBlockers(), []string{"-transform", "-map", "-on-duplicate"})
+	assert.Assert(t, !c.useLoadData())
+
+	c, err = ParseFlags(nil)
+	assert.NilError(t, err)
+	assert.Assert(t, !c.useLoadData())
+	_, err = ParseFlags([]string{"-mode", "copy"})
+	assert.ErrorContains(t, err, "invalid mode 'copy', allowed are: insert, load-data")
+}
+
+func TestLoaderRunLoadData(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain\n1,google.com\n2,youtube.com\n3,facebook.com\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-table", "ranks", "-mode", "load-data"})
+	assert.NilError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION").
+		WithArgs("ranks").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("GlobalRank").AddRow("Domain"))
+	handler := fmt.Sprintf("go-mysql-worker-%d", loadDataHandlers.Load()+1)
+	// a single statement for all rows, the server skipped one of them
+	mock.ExpectExec(buildLoadDataQuery(mysqlDialect{}, handler, "ranks", []string{"GlobalRank", "Domain"}, ',')).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsRead, int64(3))
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	assert.Equal(t, stats.RowsFailed, int64(1))
+	assert.Equal(t, stats.BatchesExecuted, int64(1))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoaderRunLoadDataChunks(t *testing.T) {
+	l := withConnConfig(t, 5)
+	defer l.rowsFailed.Store(0)
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain\n1,google.com\n2,youtube.com\n3,facebook.com\n"+
+		"4,baidu.com\n5,wikipedia.org\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-table", "ranks", "-mode", "load-data", "-load-data-chunk", "2"})
+	assert.NilError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION").
+		WithArgs("ranks").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("GlobalRank").AddRow("Domain"))
+	// a statement per chunk of 2 rows, the second one fails, so its rows and the row left count as failed
+	first := loadDataHandlers.Load() + 1
+	for i, result := range []driver.Result{sqlmock.NewResult(0, 2), nil} {
+		exec := mock.ExpectExec(buildLoadDataQuery(mysqlDialect{}, fmt.Sprintf("go-mysql-worker-%d", first+int64(i)), "ranks", []string{"GlobalRank", "Domain"}, ','))
+		if result != nil {
+			exec.WillReturnResult(result)
+		} else {
+			exec.WillReturnError(errors.New("Data too long for column 'Domain'"))
+		}
+	}
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.ErrorContains(t, err, "LOAD DATA into ranks failed: Data too long for column 'Domain'")
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	assert.Equal(t, stats.RowsFailed, int64(3))
+	assert.Equal(t, stats.BatchesExecuted, int64(1))
+	assert.NilError(t, mock.ExpectationsWereMet())
+
+	_, err = ParseFlags([]string{"-load-data-chunk", "100"})
+	assert.ErrorContains(t, err, "-load-data-chunk requires -mode load-data")
+}
+
+// TestLoadDataMySQL loads a file into a live MySQL server (with local_infile enabled) given by the DSN in
+// MYSQL_TEST_DSN, e.g. root:example@tcp(localhost:3306)/test with the docker compose setup
+func TestLoadDataMySQL(t *testing.T) {
+	dsn := os.Getenv("MYSQL_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MYSQL_TEST_DSN isn't set")
+	}
+	db, err := sql.Open("mysql", dsn)
+	assert.NilError(t, err)
+	defer db.Close()
+	// the temporary table only exists on its connection
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+	_, err = db.ExecContext(ctx, "CREATE TEMPORARY TABLE load_data_test (GlobalRank INT, Domain VARCHAR(255))")
+	assert.NilError(t, err)
+
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain\n1,google.com\n2,\"a,b.com\"\n3,\"say \"\"hi\"\".com\"\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-table", "load_data_test", "-mode", "load-data"})
+	assert.NilError(t, err)
+	stats, err := New(db, c).Run(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsInserted, int64(3))
+
+	var domain string
+	assert.NilError(t, db.QueryRowContext(ctx, "SELECT Domain FROM load_data_test WHERE GlobalRank = 3").Scan(&domain))
+	assert.Equal(t, domain, `say "hi".com`)
+}
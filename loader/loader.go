@@ -0,0 +1,1033 @@
+package loader
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaults of -workers, -buffer, -batch-size, -csv and -table
+const (
+	totalWorkers      = 100
+	channelBufferSize = 100
+	sqlBatchSize      = 8
+	CsvFile           = "majestic_million.csv"
+	TableName         = "domain"
+)
+
+// maxPlaceholders is the maximum number of placeholders of a prepared statement in MySQL
+const maxPlaceholders = 65535
+
+// Job is a single CSV row to be inserted
+type Job struct {
+	// Row is the 1-based number of the data row (header not counted) over all inputs of the run
+	Row    int
+	Values []string
+	// Table is the table the row goes to, empty for the default table
+	Table string
+	// Shard is the index of the -shard database the row goes to
+	Shard int
+	// Seq is the sequence number of the row with -ordered, the rows sent to the workers are numbered from 1
+	Seq int
+	// Line is the line of the input the row starts at, 0 if the reader doesn't know it
+	Line int
+}
+
+// toAnyList converts a slice of T to a slice of any
+func toAnyList[T any](input []T) []any {
+	list := make([]any, len(input))
+	for i, v := range input {
+		list[i] = v
+	}
+	return list
+}
+
+// bindArgs converts the values of a batch of rows rows to the statement arguments: the fields of the mapped columns,
+// with -empty-as-null an empty field is bound as NULL
+func (c *Config) bindArgs(values []string, rows int) []any {
+	values = c.selectColumns(values, rows)
+	args := toAnyList(values)
+	if c.hasNulls() {
+		for i, v := range values {
+			if c.insertNull(i, v) {
+				args[i] = nil
+			}
+		}
+	}
+	if len(c.insertTransforms) > 0 {
+		for i, v := range values {
+			t := c.insertTransforms[i%len(c.insertTransforms)]
+			if t == nil || args[i] == nil {
+				continue
+			}
+			// the reader converted the value successfully already, a string result replaced the value then
+			if converted, err := t(v); err == nil {
+				if _, ok := converted.(string); !ok {
+					args[i] = converted
+				}
+			}
+		}
+	}
+	return args
+}
+
+// worker executes the jobs in batches until the jobs channel is closed and the last batch is flushed. It returns
+// the error of a batch failing for good (or of connecting), the rows left in jobs are not consumed then. Once
+// another of the workers failed, the batches are counted as failed instead of being executed. ctx is the context
+// of the statements.
+func (l *Loader) worker(ctx context.Context, workerIndex int, db *sql.DB, jobs <-chan Job, queries *batchQueries, workers *Workers) error {
+	// every worker has its own random source for the backoff jitter, so they don't need to synchronize
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(workerIndex)))
+	var sess *session
+	var err error
+	if l.tuner.Parked(workerIndex) {
+		// a parked worker only connects once it is needed
+		if run, err := l.tuner.Park(ctx, workerIndex, nil); err != nil || !run {
+			return err
+		}
+	}
+	if !l.config.DryRun {
+		if sess, err = l.openSession(ctx, db, workerIndex, rnd); err != nil {
+			return err
+		}
+		if l.config.PreparedStatements {
+			sess.preparedRows = queries.rows
+		}
+		defer sess.Close()
+		if l.config.CommitEvery > 0 {
+			sess.chunk = &chunk{l: l, limit: l.config.CommitEvery}
+			defer func() {
+				// the batches of a chunk which isn't committed when the worker fails are not imported
+				l.rowsFailed.Add(int64(len(sess.chunk.pendingRows())))
+				sess.chunk.discard()
+			}()
+		}
+	}
+	// checking the level once keeps the disabled trace calls from boxing their arguments for every row
+	trace := log.IsLevelEnabled(log.TraceLevel)
+
+	// carry is a job for another table than the batch it was received for, it starts the next batch
+	var carry *Job
+	// closed is set once the jobs channel is closed, the rows left are flushed without waiting for more
+	closed := false
+	var adaptive *adaptiveBatch
+	if l.config.AdaptiveBatch {
+		adaptive = newAdaptiveBatch(l.config.batchRows(len(queries.headers)), queries.rows, l.config.TargetBatchLatency, l.config.maxAllowedPacket)
+	}
+	// the timer is armed by the first row of a batch, so a batch which isn't full is executed at most FlushInterval
+	// after its first row was received. An idle worker has no timer firing.
+	flush := newFlushTimer()
+	defer flush.stop()
+	for {
+		if l.tuner.Parked(workerIndex) {
+			if run, err := l.tuner.Park(ctx, workerIndex, sess); err != nil || !run {
+				return err
+			}
+		}
+		batchSize := adaptive.Rows(queries.rows)
+		counter := 0
+		buf := getBatchBuffer(batchSize, len(queries.headers))
+		values, rows, lines := buf.values, buf.rows, buf.lines
+		table := ""
+		// first is when the first row of the batch was received, the latency bound of a delayed flush
+		first := time.Now()
+		// firstSeq and lastSeq are the sequence numbers of the consecutive rows of a batch of -ordered
+		firstSeq, lastSeq := 0, 0
+		if carry != nil {
+			values = append(values, carry.Values...)
+			rows = append(rows, carry.Row)
+			lines = append(lines, carry.Line)
+			table = carry.Table
+			firstSeq, lastSeq = carry.Seq, carry.Seq
+			counter++
+			carry = nil
+			flush.arm(l.config.FlushInterval)
+		}
+		timeout := false
+		for counter < batchSize && carry == nil && !closed {
+			select {
+			case <-flush.C():
+				flush.fired()
+				if waited := time.Since(first); counter < l.config.MinFlushRows && waited < l.config.MaxFlushLatency {
+					// wait for more rows, but not longer than the latency bound
+					flush.arm(min(l.config.FlushInterval, l.config.MaxFlushLatency-waited))
+					continue
+				}
+				timeout = true
+			case job, ok := <-jobs:
+				if !ok {
+					// a closed channel is always ready, so it must not be received from again
+					closed = true
+					continue
+				}
+				if len(job.Values) > 0 && counter == 0 {
+					first = time.Now()
+					flush.arm(l.config.FlushInterval)
+				}
+				if len(job.Values) > 0 && counter > 0 && (job.Table != table || job.Seq > 0 && job.Seq != lastSeq+1) {
+					// a batch only goes to a single table, with -ordered it only has consecutive rows
+					carry = &job
+				} else if len(job.Values) > 0 {
+					table = job.Table
+					if counter == 0 {
+						firstSeq = job.Seq
+					}
+					lastSeq = job.Seq
+					values = append(values, job.Values...)
+					rows = append(rows, job.Row)
+					lines = append(lines, job.Line)
+					if trace {
+						log.WithFields(log.Fields{"worker": workerIndex, "row": job.Row, "batch_rows": counter, "fields": len(job.Values)}).
+							Trace("Got values")
+					}
+					counter++
+				}
+			}
+			if timeout {
+				break
+			}
+		}
+		// a full batch (or the last one) doesn't wait for its timer anymore
+		flush.stop()
+		if timeout {
+			log.Debugf("Worker %d flushes %d rows after the flush interval", workerIndex, counter)
+		}
+		if len(values) > 0 && !l.config.DryRun && !workers.Failed() {
+			// with -ordered the batch waits for the batches before it, once a worker failed it's counted below
+			if err = l.ordered.Wait(ctx, firstSeq); err != nil && !workers.Failed() {
+				l.rowsFailed.Add(int64(len(rows)))
+				if carry != nil {
+					l.rowsFailed.Add(1)
+				}
+				return &BatchError{Worker: workerIndex, Rows: rows, Err: err, retryErrors: l.config.RetryErrors}
+			}
+		}
+		if len(values) > 0 && workers.Failed() {
+			// the import is aborted
+			l.rowsFailed.Add(int64(len(rows)))
+		} else if len(values) > 0 && l.config.DryRun {
+			l.explain.Statement(workerIndex, rows, queries.For(table)[counter-1], table, values)
+			l.dryRunBatch(workerIndex, queries.For(table)[counter-1], table, values, rows)
+		} else if len(values) > 0 {
+			q := queries.For(table)[counter-1]
+			l.explain.Statement(workerIndex, rows, q, table, values)
+			var key []byte
+			if l.config.IdempotencyTable != "" {
+				// a batch flushed by the interval before it was full has other boundaries in a replay, so it
+				// gets another key and its rows are inserted again (see the README)
+				key = batchKey(cmp.Or(table, l.config.InsertTable()), values)
+			}
+			// a paused import or a limiter canceled by the shutdown still executes the batch, its statement fails then
+			_ = pauseGate.Wait(ctx)
+			_ = l.batchLimiter.Wait(ctx)
+			execStart := time.Now()
+			sess.lines = [2]int{lines[0], lines[len(lines)-1]}
+			err = l.execBatch(ctx, sess, q, table, values, rows, key)
+			if adaptive.Observe(len(rows), batchBytes(q, values), time.Since(execStart), err) {
+				log.Debugf("Worker %d batch size is now %d rows", workerIndex, adaptive.Rows(queries.rows))
+			}
+			if trace {
+				log.WithFields(log.Fields{"worker_id": workerIndex, "batch_size": batchSize, "rows": counter, "query": q, "values": values}).
+					Trace("Worker data")
+			}
+			if err != nil && l.config.SplitFailedBatches && !l.config.isTransient(err) {
+				l.failedSQLDump.Dump(workerIndex, rows, q, project(l.router, table, l.config.selectColumns(values, len(rows)), len(rows)), len(queries.Columns(table)), err)
+				log.WithFields(l.batchFields(workerIndex, sess.batches, rows, 0)).
+					Warnf("Worker %d batch of rows %v failed: %s, inserting the rows one by one", workerIndex, rowRanges(rows), err.Error())
+				if err = l.splitBatch(ctx, sess, queries.For(table)[0], table, values, rows, lines); err != nil {
+					return err
+				}
+			} else if err != nil && l.config.DeadLetterFailedBatches && ctx.Err() == nil {
+				l.failedSQLDump.Dump(workerIndex, rows, q, project(l.router, table, l.config.selectColumns(values, len(rows)), len(rows)), len(queries.Columns(table)), err)
+				// the batches of the chunk were rolled back with the failed one
+				values, rows = withChunk(sess.chunk, values, rows)
+				log.WithFields(l.batchFields(workerIndex, sess.batches, rows, 0)).
+					Warnf("Worker %d batch of rows %v failed: %s, writing the rows to the dead-letter file", workerIndex, rowRanges(rows), err.Error())
+				if n, err := l.deadLetterBatch(values, rows, err); err != nil {
+					l.rowsFailed.Add(int64(len(rows) - n))
+					if carry != nil {
+						l.rowsFailed.Add(1)
+					}
+					return &BatchError{Worker: workerIndex, Rows: rows[n:], Err: err, retryErrors: l.config.RetryErrors}
+				}
+			} else if err != nil {
+				l.failedSQLDump.Dump(workerIndex, rows, q, project(l.router, table, l.config.selectColumns(values, len(rows)), len(rows)), len(queries.Columns(table)), err)
+				values, rows = withChunk(sess.chunk, values, rows)
+				l.rowsFailed.Add(int64(len(rows)))
+				if carry != nil {
+					l.rowsFailed.Add(1)
+				}
+				return &BatchError{Worker: workerIndex, Rows: rows, Err: err, retryErrors: l.config.RetryErrors}
+			}
+			l.ordered.Done(lastSeq)
+		}
+		if sess == nil || sess.chunk == nil {
+			// the batches of a chunk are kept until it is committed
+			putBatchBuffer(buf, values, rows, lines)
+		}
+		if closed && carry == nil {
+			if err = l.commitChunk(sess); err != nil {
+				return err
+			}
+			log.Printf("Worker %d exits\n", workerIndex)
+			return nil
+		}
+	}
+}
+
+// batchBuffer are the values, row numbers and input lines of a batch, reused for the next batches through
+// batchBuffers, so a long import doesn't allocate them for every batch
+type batchBuffer struct {
+	values []string
+	rows   []int
+	lines  []int
+}
+
+var batchBuffers = sync.Pool{New: func() any { return new(batchBuffer) }}
+
+// getBatchBuffer returns empty buffers with room for rows rows of columns values
+func getBatchBuffer(rows int, columns int) *batchBuffer {
+	b := batchBuffers.Get().(*batchBuffer)
+	if cap(b.values) < rows*columns {
+		b.values = make([]string, 0, rows*columns)
+	}
+	if cap(b.rows) < rows {
+		b.rows = make([]int, 0, rows)
+	}
+	if cap(b.lines) < rows {
+		b.lines = make([]int, 0, rows)
+	}
+	b.values, b.rows, b.lines = b.values[:0], b.rows[:0], b.lines[:0]
+	return b
+}
+
+// putBatchBuffer returns the buffers of a batch nothing refers to anymore, values, rows and lines may have been
+// grown from the ones of b. The values are cleared, so a pooled buffer doesn't keep the rows of the input alive.
+func putBatchBuffer(b *batchBuffer, values []string, rows []int, lines []int) {
+	clear(values)
+	b.values, b.rows, b.lines = values[:0], rows[:0], lines[:0]
+	batchBuffers.Put(b)
+}
+
+// deadLetterBatch writes the rows of a batch which failed for good with its error to the dead-letter file, so the
+// import goes on. It returns the number of rows written, all of them unless writing failed.
+func (l *Loader) deadLetterBatch(values []string, rows []int, batchErr error) (int, error) {
+	columns := len(values) / len(rows)
+	for i, row := range rows {
+		if err := l.deadLetter.Write(values[i*columns:(i+1)*columns], row, batchErr.Error()); err != nil {
+			return i, err
+		}
+		l.checkpoint.Done([]int{row})
+	}
+	return len(rows), nil
+}
+
+// successRatio returns the share of the rows read which got inserted, 1 if nothing was read
+func successRatio(inserted int64, read int64) float64 {
+	if read == 0 {
+		return 1
+	}
+	return float64(inserted) / float64(read)
+}
+
+// acquireConn gets a connection for a worker, retrying with backoff until the workers together
+// reached the configured maximum of connection errors, which means the database is considered unavailable
+func (l *Loader) acquireConn(ctx context.Context, db *sql.DB, workerIndex int, rnd *rand.Rand) (*sql.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		conn, err := db.Conn(ctx)
+		if err == nil {
+			return conn, nil
+		}
+		n := l.connErrors.Add(1)
+		if n >= int64(l.config.MaxConnectionErrors) {
+			return nil, fmt.Errorf("database unavailable, giving up after %d connection errors: %w", n, err)
+		}
+		delay := l.config.Backoff.Delay(attempt, rnd)
+		log.Warnf("Worker %d could not connect: %s, retry in %s", workerIndex, err.Error(), delay)
+		if err = sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// execBatch executes a batch, retrying it with backoff as long as it fails with a retryable error. When the server
+// closed the connection the batch is retried on a new one. With an idempotency key the batch is skipped when the
+// key was already recorded by a previous run (the key and the batch are committed in one transaction anyway).
+func (l *Loader) execBatch(ctx context.Context, sess *session, query string, table string, values []string, rows []int, key []byte) (err error) {
+	defer func() {
+		if err != nil {
+			l.config.batchFailed(rows, err)
+		}
+	}()
+	workerIndex := sess.workerIndex
+	if err = sess.checkHealth(ctx); err != nil {
+		return err
+	}
+	defer func() { sess.used = time.Now() }()
+	l.workerStats.Begin(workerIndex)
+	defer func() { l.workerStats.End(workerIndex, err) }()
+	sess.batches++
+	seq := sess.batches
+	retries, reconnects := 0, 0
+	for {
+		l.throttle.Acquire()
+		execStart := time.Now()
+		executed := true
+		// the chunk bounds its statements itself, its transaction outlives the attempt
+		stmtCtx, cancel := l.config.batchContext(ctx)
+		if key != nil {
+			executed, err = execIdempotent(stmtCtx, sess.conn, l.config.dialect(), l.config.IdempotencyTable, key, query, l.bindTableArgs(table, values, len(rows)))
+		} else if sess.chunk != nil {
+			err = sess.chunk.exec(ctx, sess.conn, query, l.bindTableArgs(table, values, len(rows)), values, rows)
+		} else if l.config.BatchTransactions {
+			err = execInTx(stmtCtx, sess.conn, query, l.bindTableArgs(table, values, len(rows)))
+		} else if sess.usePrepared(query, len(rows)) {
+			// the batches of the same size have the same statement, so the server parses it only once
+			var stmt *sql.Stmt
+			if stmt, err = sess.prepare(stmtCtx, query); err == nil {
+				_, err = stmt.ExecContext(stmtCtx, l.bindTableArgs(table, values, len(rows))...)
+			}
+		} else {
+			_, err = sess.conn.ExecContext(stmtCtx, query, l.bindTableArgs(table, values, len(rows))...)
+		}
+		err = l.config.batchTimedOut(stmtCtx, ctx, err)
+		cancel()
+		duration := time.Since(execStart)
+		l.throttle.Release(err)
+		fields := l.batchFields(workerIndex, seq, rows, duration)
+		if sess.lines[0] > 0 {
+			fields["first_line"], fields["last_line"] = sess.lines[0], sess.lines[1]
+		}
+		if l.config.logSlowBatch(fields, workerIndex, len(rows), duration) {
+			l.slowBatches.Add(1)
+		}
+		l.auditLog.Record(workerIndex, rows, values, duration, err)
+		l.statsd.Batch(len(rows), duration, err)
+		l.metrics.Batch(workerIndex, duration, err)
+		if err != nil {
+			l.workerStats.Failed(workerIndex, err)
+		}
+		if err == nil {
+			l.reporter.Batch(workerIndex)
+			l.workerStats.Batch(workerIndex, int64(len(rows)), duration)
+			l.batchLatency.Observe(duration)
+		}
+		if err == nil && !executed {
+			l.rowsReplayed.Add(int64(len(rows)))
+			l.checkpoint.Done(rows)
+			log.WithFields(fields).Debugf("Worker %d skipped rows %v, the batch was already imported", workerIndex, rowRanges(rows))
+			return nil
+		}
+		if err == nil {
+			log.WithFields(fields).Debugf("Worker %d executed a batch of %d rows in %s", workerIndex, len(rows), duration)
+		}
+		if err == nil && sess.chunk != nil {
+			// counted once the chunk is committed
+			return nil
+		}
+		if err == nil {
+			l.batchCommitted(values, rows)
+			return nil
+		}
+		// a timed out statement leaves the connection in an unknown state, so it's replaced like a lost one
+		if (isGoneAway(err) || errors.Is(err, errBatchTimeout)) && reconnects < l.config.MaxReconnects {
+			reconnects++
+			l.reconnectCount.Add(1)
+			log.WithFields(fields).Warnf("Worker %d lost its connection: %s, reconnect %d of %d", workerIndex, err.Error(), reconnects, l.config.MaxReconnects)
+			if err = sess.reconnect(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if retries >= l.config.MaxRetries || !l.config.isRetryable(err) {
+			return err
+		}
+		l.batchRetries.Add(1)
+		delay := l.config.Backoff.Delay(retries, sess.rnd)
+		retries++
+		log.WithFields(fields).Warnf("Worker %d batch failed: %s, retry %d of %d in %s", workerIndex, err.Error(), retries, l.config.MaxRetries, delay)
+		if err = sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// batchCommitted counts the rows of a committed batch
+func (l *Loader) batchCommitted(values []string, rows []int) {
+	l.rowsInserted.Add(int64(len(rows)))
+	l.batchesExecuted.Add(1)
+	l.inputCounter.Inserted(rows)
+	l.checkpoint.Done(rows)
+	l.aggregates.Add(values, len(values)/len(rows))
+	l.syncer.committed(rows)
+	l.config.batchSucceeded(rows)
+}
+
+// sleep waits for delay, it returns the error of ctx when ctx is done before
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flushTimer is the flush timeout of the batch a worker collects. A single timer is reused for all batches of the
+// worker, so a busy worker doesn't leave a pending timer behind for every batch it executes.
+type flushTimer struct {
+	t *time.Timer
+	// armed is set while the timer runs or fired without being received from
+	armed bool
+}
+
+func newFlushTimer() *flushTimer {
+	t := time.NewTimer(time.Hour)
+	t.Stop()
+	return &flushTimer{t: t}
+}
+
+// C returns the channel of the timer, nil (never ready) while it isn't armed
+func (f *flushTimer) C() <-chan time.Time {
+	if !f.armed {
+		return nil
+	}
+	return f.t.C
+}
+
+// arm (re)starts the timer to fire after d
+func (f *flushTimer) arm(d time.Duration) {
+	f.stop()
+	f.t.Reset(d)
+	f.armed = true
+}
+
+// fired records that the timer was received from
+func (f *flushTimer) fired() {
+	f.armed = false
+}
+
+// stop stops the timer, a tick which wasn't received is drained so the next arm starts clean
+func (f *flushTimer) stop() {
+	if f.armed && !f.t.Stop() {
+		<-f.t.C
+	}
+	f.armed = false
+}
+
+// splitBatch executes the rows of a batch which failed because of its data one by one, the rows failing again are
+// written to the dead-letter file with their error, so the good rows of the batch are still inserted. It fails when
+// a row fails because of the database state, the rows left are counted as failed then.
+func (l *Loader) splitBatch(ctx context.Context, sess *session, query string, table string, values []string, rows []int, lines []int) error {
+	columns := len(values) / len(rows)
+	for i, row := range rows {
+		rowValues := values[i*columns : (i+1)*columns]
+		sess.lines = [2]int{lines[i], lines[i]}
+		var key []byte
+		if l.config.IdempotencyTable != "" {
+			key = batchKey(cmp.Or(table, l.config.InsertTable()), rowValues)
+		}
+		err := l.execBatch(ctx, sess, query, table, rowValues, []int{row}, key)
+		if err == nil {
+			continue
+		}
+		if !l.config.isTransient(err) {
+			log.Warnf("Worker %d row %d failed: %s", sess.workerIndex, row, err.Error())
+			if err = l.deadLetter.Write(rowValues, row, err.Error()); err == nil {
+				l.checkpoint.Done([]int{row})
+			}
+		}
+		if err != nil {
+			l.rowsFailed.Add(int64(len(rows) - i))
+			return &BatchError{Worker: sess.workerIndex, Rows: rows[i:], Err: err, retryErrors: l.config.RetryErrors}
+		}
+	}
+	return nil
+}
+
+// execInTx executes query in an explicit transaction, the transaction is rolled back when the statement fails,
+// so a retried batch starts from a clean state
+func execInTx(ctx context.Context, conn *sql.Conn, query string, args []any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			log.Warnf("Rollback failed: %s", rollbackErr.Error())
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// dryRunBatch logs the statement of a batch instead of executing it, its rows count as inserted
+func (l *Loader) dryRunBatch(workerIndex int, query string, table string, values []string, rows []int) {
+	log.Infof("Worker %d dry run of rows %v with %d arguments: %s", workerIndex, rowRanges(rows), len(l.bindTableArgs(table, values, len(rows))), query)
+	l.rowsInserted.Add(int64(len(rows)))
+	l.batchesExecuted.Add(1)
+	l.inputCounter.Inserted(rows)
+	l.workerStats.Batch(workerIndex, int64(len(rows)), 0)
+}
+
+// logSlowBatch warns about a batch which took longer than the configured slow batch threshold
+func (c *Config) logSlowBatch(fields log.Fields, workerIndex int, rows int, duration time.Duration) bool {
+	if c.SlowBatchThreshold <= 0 || duration <= c.SlowBatchThreshold {
+		return false
+	}
+	log.WithFields(fields).Warnf("Worker %d slow batch: %d rows took %s (threshold %s)", workerIndex, rows, duration, c.SlowBatchThreshold)
+	return true
+}
+
+// newJobShards returns the channels of the workers of the options dealing the rows out to particular workers, nil
+// when all workers share the jobs channel
+func (l *Loader) newJobShards() *jobShards {
+	// every worker gets its own channel, the per-worker buffer gets a share of the overall buffer size
+	rows := l.config.maxBatchRows(len(l.config.InsertColumns(l.headers)))
+	n, size := l.config.Workers, max(l.config.BufferSize/l.config.Workers, rows)
+	switch {
+	case l.ordered != nil:
+		return newJobShards(n, size, byBlock(rows, n))
+	case l.router != nil:
+		return newJobShards(n, size, byTable(l.router.Tables(), n))
+	case len(l.config.Shards) > 0:
+		return newJobShards(n, size, byShard(len(l.config.Shards), n))
+	case l.config.PartitionBy != "":
+		return newJobShards(n, size, byKey(l.config.partitionIndex, n))
+	case l.config.IdempotencyTable != "":
+		// the shared channel hands a row to whichever worker is free, so a replayed input would be cut into other
+		// batches with other keys, dealt out round-robin every worker gets the same rows again
+		return newJobShards(n, size, roundRobin(n))
+	case l.config.ShardJobs:
+		return newJobShards(n, size, roundRobin(n))
+	}
+	return nil
+}
+
+// StartWorkers starts all workers providing them a job queue, database connection and a query to execute.
+// The workers exit once jobs is closed and they flushed their last batch, so Wait returns when every row is executed
+// (or failed). When ctx is canceled the statements are canceled after the shutdown grace period. With the options
+// dealing the rows out to particular workers every worker reads a channel of its own, which ProcessCSVFile sends the
+// rows to instead of jobs and ProcessCSVSource closes with jobs.
+func (l *Loader) StartWorkers(ctx context.Context, jobs <-chan Job) *Workers {
+	execCtx, cancel := graceContext(ctx, l.config.ShutdownGrace)
+	workers := &Workers{cancel: cancel}
+	queries := l.newBatchQueries(l.config.InsertTable(), l.config.InsertColumns(l.headers))
+	if l.shards == nil {
+		l.shards = l.newJobShards()
+	}
+	l.tuner.Start(l.config.AutoTuneInterval, &l.rowsInserted, l.workerStats)
+	for i := 0; i < l.config.Workers; i++ {
+		log.Printf("Starting Worker %d\n", i)
+		workers.wg.Add(1)
+		workerJobs := l.shards.worker(jobs, i)
+		go func(i int) {
+			defer workers.wg.Done()
+			if err := l.worker(execCtx, i, l.workerDB(i), workerJobs, queries, workers); err != nil {
+				log.Errorf("Worker %d failed: %s", i, err.Error())
+				workers.fail(err)
+				l.ordered.Abort()
+				// a sharded channel is only read by this worker, the reader would block on it
+				l.discard(workerJobs)
+			}
+		}(i)
+	}
+	return workers
+}
+
+// buildInsertQuery builds the INSERT statement for a single row and the placeholders
+// of a single value group (used for appending more rows to the statement)
+func (c *Config) buildInsertQuery(table string, headers []string) (string, string) {
+	marks := generateQuestionsMark(len(headers))
+	for i, h := range headers {
+		// every expression contains exactly one ?, so the placeholder count still matches the columns
+		if expr, ok := c.ValueExprs[h]; ok {
+			marks[i] = expr
+		} else if c.geometryColumn(c.sourceColumn(h)) {
+			marks[i] = c.geometryExpr()
+		}
+		if _, ok := c.Lookups[c.sourceColumn(h)]; ok && c.LookupMiss == LookupMissNull {
+			// a code not found is sent as lookupNull
+			marks[i] = strings.Replace(marks[i], "?", "NULLIF(?, '')", 1)
+		}
+	}
+	var placeholders = strings.Join(marks, ",")
+	var query = fmt.Sprintf("%s %s (%s) VALUES (%s)",
+		insertVerb(c.dialect(), c.OnDuplicate),
+		quoteTable(c.dialect(), table),
+		strings.Join(quoteIdentifiers(c.dialect(), headers), ","),
+		placeholders,
+	)
+	if c.QueryTag != "" {
+		query = queryComment(c.QueryTag) + query
+	}
+	return query, placeholders
+}
+
+// quoteIdentifier quotes a column or table name (with backticks for MySQL), so reserved words and names with
+// spaces can be used
+func quoteIdentifier(d Dialect, name string) string {
+	return d.QuoteIdentifier(name)
+}
+
+// quoteIdentifiers quotes all names
+func quoteIdentifiers(d Dialect, names []string) []string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = quoteIdentifier(d, n)
+	}
+	return quoted
+}
+
+// quoteTable quotes a table name which may be qualified by its schema (schema.table)
+func quoteTable(d Dialect, table string) string {
+	return strings.Join(quoteIdentifiers(d, strings.Split(table, ".")), ".")
+}
+
+// batchRows returns the rows of a full batch: -batch-size or, with -batch-placeholders, as many rows of the
+// given number of columns as fit into the placeholders (at least one)
+func (c *Config) batchRows(columns int) int {
+	if c.BatchPlaceholders <= 0 || columns <= 0 {
+		return c.BatchSize
+	}
+	return max(1, c.BatchPlaceholders/columns)
+}
+
+// buildBatchQueries returns the statements for batches of 1 to rows rows (index is rows-1), so the
+// workers don't build the statement of every batch by string concatenation. suffix is appended after the values.
+func buildBatchQueries(d Dialect, query string, placeholders string, suffix string, rows int) []string {
+	if d := d; d.Placeholder(1) != "?" {
+		return buildNumberedBatchQueries(d, query, placeholders, suffix, rows)
+	}
+	queries := make([]string, rows)
+	full := query
+	if rows > 1 {
+		full += ", " + buildValuesClause(placeholders, rows-1)
+	}
+	// the statements of smaller batches are prefixes of the one of a full batch, each row adds ", (" placeholders ")"
+	group := len(placeholders) + 4
+	for i := range queries {
+		queries[i] = full[:len(query)+i*group] + suffix
+	}
+	return queries
+}
+
+// buildNumberedBatchQueries is buildBatchQueries for a dialect with numbered placeholders (like $1), which
+// continue over the rows of a batch
+func buildNumberedBatchQueries(d Dialect, query string, placeholders string, suffix string, rows int) []string {
+	var b strings.Builder
+	head, n := bindPlaceholders(d, query, 0)
+	b.WriteString(head)
+	ends := []int{b.Len()}
+	for i := 1; i < rows; i++ {
+		group, _ := bindPlaceholders(d, placeholders, n)
+		n += strings.Count(placeholders, "?")
+		b.WriteString(", (")
+		b.WriteString(group)
+		b.WriteByte(')')
+		ends = append(ends, b.Len())
+	}
+	full := b.String()
+	queries := make([]string, rows)
+	for i, end := range ends {
+		queries[i] = full[:end] + suffix
+	}
+	return queries
+}
+
+// buildValuesClause returns rows value groups of placeholders separated by commas, e.g. (?,?), (?,?) for "?,?"
+// and 2 rows, built in a single allocation
+func buildValuesClause(placeholders string, rows int) string {
+	if rows <= 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.Grow(rows*(len(placeholders)+4) - 2)
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		b.WriteString(placeholders)
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// queryComment turns tag into a SQL comment, anything which could end (or nest) the comment gets removed.
+// The space after the opening /* keeps MySQL from treating it as /*! executable comment or /*+ optimizer hint.
+func queryComment(tag string) string {
+	for strings.Contains(tag, "*/") || strings.Contains(tag, "/*") {
+		tag = strings.ReplaceAll(strings.ReplaceAll(tag, "*/", ""), "/*", "")
+	}
+	return "/* " + tag + " */ "
+}
+
+// ProcessCSVFile processes a CSV file and sends the rows to the jobs channel
+// the first skip data rows are read but not sent (to resume a previous run),
+// processing ends either when eof or maxLines is reached.
+// offset is the number of data rows of previous inputs, it is used for numbering the rows.
+// Processing stops early when ctx is canceled.
+// Returns the number of rows sent and the number of rows skipped, and the error when reading the input failed
+// for another reason than a malformed row (e.g. a broken download or a corrupt compressed file).
+func (l *Loader) ProcessCSVFile(ctx context.Context, reader RowReader, jobs chan<- Job, offset int, skip int, maxLines int) (int, int, error) {
+	if skip > 0 {
+		log.Printf("Skipping %d rows", skip)
+	}
+	for skipped := 0; skipped < skip; skipped++ {
+		_, err := reader.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// a malformed row is still a row, it is skipped anyway
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				log.Printf("Reached end of file after skipping %d rows", skipped)
+				return 0, skipped, nil
+			}
+			return 0, skipped, err
+		}
+	}
+
+	trace := log.IsLevelEnabled(log.TraceLevel)
+	table := l.tableRotation.Current()
+	rowcount := 0
+	for ; rowcount < maxLines; rowcount++ {
+		if ctx.Err() != nil {
+			break
+		}
+		row, err := reader.Read()
+		if err == nil && l.config.RaggedRows {
+			row = l.fitRaggedRow(row)
+		}
+		if err == nil {
+			err = l.checkFieldCount(row)
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) || errors.Is(err, errFieldCount) {
+			log.Warnf("Malformed row %d: %s", offset+skip+rowcount+1, err)
+			if err := l.rejects.Write(offset+skip+rowcount+1, readerLine(reader, err), err); err != nil {
+				return rowcount, skip, err
+			}
+			if l.errorBudget.Skip(offset + skip + rowcount + 1) {
+				l.checkpoint.Done([]int{offset + skip + rowcount + 1})
+				continue
+			}
+			// the row giving up the input is read as well
+			rowcount++
+			break
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rowcount, skip, err
+		}
+		if !l.sampler.Keep(offset + skip + rowcount + 1) {
+			l.checkpoint.Done([]int{offset + skip + rowcount + 1})
+			continue
+		}
+
+		if l.config.StripCR {
+			stripTrailingCR(row)
+		}
+		for _, i := range l.config.trimQuotesIndexes {
+			if i < len(row) {
+				row[i] = trimSurroundingQuotes(row[i])
+			}
+		}
+		job := Job{Row: offset + skip + rowcount + 1, Values: row, Table: table}
+		if err := l.config.applyTransforms(row); err != nil {
+			log.Warnf("Row %d not converted: %s", job.Row, err)
+			if l.deadLetter != nil {
+				if err = l.deadLetter.Write(row, job.Row, err.Error()); err != nil {
+					return rowcount, skip, err
+				}
+				l.checkpoint.Done([]int{job.Row})
+				continue
+			}
+			if l.errorBudget.Skip(job.Row) {
+				l.checkpoint.Done([]int{job.Row})
+				continue
+			}
+			rowcount++
+			break
+		}
+		if err := l.config.validateRow(row); err != nil {
+			log.Warnf("Row %d invalid: %s", job.Row, err)
+			if err := l.rejects.Write(job.Row, readerLine(reader, nil), err); err != nil {
+				return rowcount, skip, err
+			}
+			if l.deadLetter != nil {
+				if err = l.deadLetter.Write(row, job.Row, err.Error()); err != nil {
+					return rowcount, skip, err
+				}
+				l.checkpoint.Done([]int{job.Row})
+				continue
+			}
+			if l.errorBudget.Skip(job.Row) {
+				l.checkpoint.Done([]int{job.Row})
+				continue
+			}
+			rowcount++
+			break
+		}
+		if l.dedupe.Duplicate(row, job.Row) {
+			l.checkpoint.Done([]int{job.Row})
+			continue
+		}
+		if imported, err := l.lookups.Apply(ctx, row); err != nil && ctx.Err() != nil {
+			break
+		} else if err != nil {
+			return rowcount, skip, err
+		} else if !imported {
+			if err = l.deadLetter.Write(row, job.Row, "lookup miss"); err != nil {
+				return rowcount, skip, err
+			}
+			l.checkpoint.Done([]int{job.Row})
+			continue
+		}
+		if table, unrouted, err := l.router.Route(row, job.Row); err != nil {
+			return rowcount, skip, err
+		} else if unrouted {
+			l.checkpoint.Done([]int{job.Row})
+			continue
+		} else if table != "" {
+			job.Table = table
+		}
+		if job.Shard, err = l.shardRouter.Shard(row); err != nil {
+			log.Warnf("Row %d not sharded: %s", job.Row, err)
+			if l.deadLetter != nil {
+				if err = l.deadLetter.Write(row, job.Row, err.Error()); err != nil {
+					return rowcount, skip, err
+				}
+				l.checkpoint.Done([]int{job.Row})
+				continue
+			}
+			if l.errorBudget.Skip(job.Row) {
+				l.checkpoint.Done([]int{job.Row})
+				continue
+			}
+			rowcount++
+			break
+		}
+		// the values are padded as they are inserted, after they were converted and looked up
+		if err := l.config.padRow(row); err != nil {
+			log.Warnf("Row %d not padded: %s", job.Row, err)
+			if l.deadLetter != nil {
+				if err = l.deadLetter.Write(row, job.Row, err.Error()); err != nil {
+					return rowcount, skip, err
+				}
+				l.checkpoint.Done([]int{job.Row})
+				continue
+			}
+			if l.errorBudget.Skip(job.Row) {
+				l.checkpoint.Done([]int{job.Row})
+				continue
+			}
+			rowcount++
+			break
+		}
+		job.Line = readerLine(reader, nil)
+		job.Values = l.config.appendGenerated(row, generateInput{file: l.inputCounter.Name(job.Row), line: job.Line, row: job.Row, now: time.Now()})
+		if l.syncer.Unchanged(job.Values, job.Row) {
+			l.checkpoint.Done([]int{job.Row})
+			continue
+		}
+		if trace {
+			log.Traceln("read line with values:", job.Values)
+		}
+		if err := pauseGate.Wait(ctx); err != nil {
+			// the row isn't sent, so it doesn't count as read
+			return rowcount, skip, nil
+		}
+		if err := l.rateLimiter.Wait(ctx); err != nil {
+			// the row isn't sent, so it doesn't count as read
+			return rowcount, skip, nil
+		}
+		job.Seq = l.ordered.Number()
+		select {
+		case l.shards.channel(jobs, job) <- job:
+		case <-ctx.Done():
+			// the row isn't sent, so it doesn't count as read
+			return rowcount, skip, nil
+		}
+		l.metrics.Read()
+		if l.reporter != nil {
+			l.progress.Read(reader.InputOffset(), int64(job.Row))
+		} else if rowcount%1000 == 0 && l.config.Progress == ProgressRows {
+			l.progress.Update(reader.InputOffset(), time.Now())
+			if p := l.progress.String(); p != "" {
+				log.Printf("Processed %d rows (%s)", rowcount, p)
+			} else {
+				log.Printf("Processed %d rows", rowcount)
+			}
+		}
+		// for testing only time.Sleep(2 * time.Second)
+	}
+	return rowcount, skip, nil
+}
+
+// errFieldCount is the error of a row whose number of fields differs from the header
+var errFieldCount = errors.New("wrong number of fields")
+
+// checkFieldCount fails for a row which doesn't have a field for every column of the header
+func (l *Loader) checkFieldCount(row []string) error {
+	if len(l.headers) == 0 || len(row) == len(l.headers) {
+		return nil
+	}
+	return fmt.Errorf("%w, %d instead of %d", errFieldCount, len(row), len(l.headers))
+}
+
+// fitRaggedRow pads a row with too few fields with empty ones and drops the empty fields after the last column,
+// a row with values after the last column is still rejected by checkFieldCount
+func (l *Loader) fitRaggedRow(row []string) []string {
+	if len(l.headers) == 0 {
+		return row
+	}
+	for len(row) > len(l.headers) && row[len(row)-1] == "" {
+		row = row[:len(row)-1]
+	}
+	for len(row) < len(l.headers) {
+		row = append(row, "")
+	}
+	return row
+}
+
+// stripTrailingCR removes a trailing \r (left over from CRLF line endings) from the last field of a row
+func stripTrailingCR(row []string) {
+	if len(row) > 0 {
+		last := len(row) - 1
+		row[last] = strings.TrimSuffix(row[last], "\r")
+	}
+}
+
+// trimSurroundingQuotes removes a single pair of matching quotes (" or ') around a value
+func trimSurroundingQuotes(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// generateQuestionsMark generates a slice of question marks of length n (used for building SQL statements)
+func generateQuestionsMark(n int) []string {
+	var r = make([]string, n)
+	for i := range r {
+		r[i] = "?"
+	}
+	return r
+}
@@ -0,0 +1,588 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+)
+
+// defaultConfig returns the config of the default flags, the one the tests start from
+func defaultConfig() Config {
+	c, err := ParseFlags(nil)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// newTestLoader returns a Loader with the config of the default flags
+func newTestLoader() *Loader {
+	return &Loader{config: defaultConfig()}
+}
+
+func TestStringToAnyList(t *testing.T) {
+	a1 := []string{"Abc", "Xyz", "Mno"}
+	list := StringToAnyList(a1)
+	assert.Equal(t, reflect.TypeOf(list).String(), "[]interface {}", "Should be []interface{} / []any")
+	assert.Equal(t, len(list), 3, "len(list) should be 3")
+	assert.Equal(t, list[0], "Abc", "list[0] should be Abc")
+}
+
+func TestIntToAnyList(t *testing.T) {
+	list := IntToAnyList([]int{3, 1, 2})
+	assert.DeepEqual(t, list, []any{3, 1, 2})
+	assert.Equal(t, len(IntToAnyList(nil)), 0)
+}
+
+func TestGenerateQuestionsMark(t *testing.T) {
+	assert.DeepEqual(t, generateQuestionsMark(3), []string{"?", "?", "?"})
+}
+
+func TestProcessCSVFileWithWorker(t *testing.T) {
+	// TODO
+}
+
+// readJobs collects the values of everything sent to the jobs channel until it is closed
+func readJobs(jobs <-chan Job) [][]string {
+	rows := make([][]string, 0)
+	for job := range jobs {
+		rows = append(rows, job.Values)
+	}
+	return rows
+}
+
+func TestProcessCSVFileSkip(t *testing.T) {
+	l := newTestLoader()
+	reader := csv.NewReader(strings.NewReader("a,1\nb,2\nc,3\nd,4\n"))
+	jobs := make(chan Job, 10)
+	rows, skipped, err := l.ProcessCSVFile(context.Background(), reader, jobs, 0, 2, 100)
+	assert.NilError(t, err)
+	close(jobs)
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"c", "3"}, {"d", "4"}})
+	assert.Equal(t, rows, 2)
+	assert.Equal(t, skipped, 2)
+}
+
+func TestProcessCSVFileSkipBeyondEOF(t *testing.T) {
+	l := newTestLoader()
+	reader := csv.NewReader(strings.NewReader("a,1\nb,2\n"))
+	jobs := make(chan Job, 10)
+	rows, skipped, err := l.ProcessCSVFile(context.Background(), reader, jobs, 0, 5, 100)
+	assert.NilError(t, err)
+	close(jobs)
+	assert.Equal(t, len(readJobs(jobs)), 0)
+	assert.Equal(t, rows, 0)
+	assert.Equal(t, skipped, 2)
+}
+
+func TestProcessCSVFileRaggedRow(t *testing.T) {
+	l := newTestLoader()
+	l.headers = []string{"Domain", "TldRank"}
+	l.errorBudget = NewErrorBudget(1, 0, 0)
+
+	reader := l.config.newCSVReader(strings.NewReader("a,1\nb,2,extra\nc,3\n"))
+	jobs := make(chan Job, 10)
+	rows, _, _ := l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	// the ragged row is read and counted as malformed, but not sent
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"a", "1"}, {"c", "3"}})
+	assert.Equal(t, rows, 3)
+	assert.Equal(t, l.errorBudget.Total(), 1)
+	assert.ErrorContains(t, l.checkFieldCount([]string{"b", "2", "extra"}), "wrong number of fields, 3 instead of 2")
+
+	// without a budget left the row ends the input
+	reader = l.config.newCSVReader(strings.NewReader("d\ne,5\n"))
+	jobs = make(chan Job, 10)
+	rows, _, _ = l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	assert.Equal(t, len(readJobs(jobs)), 0)
+	assert.Equal(t, rows, 1)
+	assert.ErrorContains(t, l.errorBudget.EndInput("ragged.csv", 4), "too many malformed rows")
+}
+
+func TestProcessCSVFileRaggedRowsFlag(t *testing.T) {
+	l := newTestLoader()
+	l.config.RaggedRows = true
+	l.headers = []string{"Domain", "TldRank", "Country"}
+	l.errorBudget = NewErrorBudget(1, 0, 0)
+
+	reader := l.config.newCSVReader(strings.NewReader("a,1\nb,2,de,,\nc,3,fr,extra\n"))
+	jobs := make(chan Job, 10)
+	rows, _, _ := l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	// a value after the last column is still malformed
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"a", "1", ""}, {"b", "2", "de"}})
+	assert.Equal(t, rows, 3)
+	assert.Equal(t, l.errorBudget.Total(), 1)
+}
+
+func TestProcessCSVSourceReadError(t *testing.T) {
+	l := newTestLoader()
+	l.config = Config{}
+	source := NewReaderSource("broken.csv.gz", io.MultiReader(strings.NewReader("Domain,TldRank\na,1\nb,2\n"),
+		iotest.ErrReader(errors.New("unexpected EOF"))))
+	name, reader, header, err := NextCSVReader(source, l.config)
+	assert.NilError(t, err)
+	l.headers = header
+	jobs := make(chan Job, 10)
+	// a broken input fails the import instead of ending it like a complete one
+	rows, err := l.ProcessCSVSource(context.Background(), source, name, reader, jobs, 0, 100)
+	assert.ErrorContains(t, err, "error reading broken.csv.gz after 2 rows: unexpected EOF")
+	assert.Equal(t, rows, 2)
+	assert.Equal(t, len(readJobs(jobs)), 2)
+}
+
+func TestStripTrailingCR(t *testing.T) {
+	row := []string{"1", "google.com", "42\r"}
+	stripTrailingCR(row)
+	assert.DeepEqual(t, row, []string{"1", "google.com", "42"})
+
+	// only the last field and only a single trailing \r is touched
+	row = []string{"a\r", "b\r\n", "c\r\r"}
+	stripTrailingCR(row)
+	assert.DeepEqual(t, row, []string{"a\r", "b\r\n", "c\r"})
+
+	stripTrailingCR([]string{})
+}
+
+func TestProcessCSVFileStripCR(t *testing.T) {
+	l := newTestLoader()
+	l.config.StripCR = true
+
+	// a quoted last field keeps its \r when read by csv.Reader
+	reader := csv.NewReader(strings.NewReader("a,\"1\r\"\r\nb,2\r\n"))
+	jobs := make(chan Job, 10)
+	l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"a", "1"}, {"b", "2"}})
+}
+
+func TestLogSlowBatch(t *testing.T) {
+	l := newTestLoader()
+
+	l.config.SlowBatchThreshold = 0
+	assert.Assert(t, !l.config.logSlowBatch(nil, 1, 8, time.Hour), "a zero threshold disables slow batch logging")
+
+	l.config.SlowBatchThreshold = 500 * time.Millisecond
+	assert.Assert(t, !l.config.logSlowBatch(nil, 1, 8, 100*time.Millisecond))
+	assert.Assert(t, l.config.logSlowBatch(nil, 1, 8, 600*time.Millisecond))
+}
+
+// runFlushWorker runs a worker until it executed a single batch with the given rows and returns how long it took
+// (the jobs channel stays open, so the batch isn't flushed because of shutdown)
+func runFlushWorker(t *testing.T, l *Loader, n int) time.Duration {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	queries := l.newBatchQueries("domain", []string{"Domain"})
+	mock.ExpectExec(queries.For("")[n-1]).WillReturnResult(sqlmock.NewResult(0, int64(n)))
+
+	jobs := make(chan Job, n)
+	for i := 0; i < n; i++ {
+		jobs <- Job{Row: i + 1, Values: []string{"google.com"}}
+	}
+	done := make(chan error)
+	start := time.Now()
+	go func() { done <- l.worker(context.Background(), 0, db, jobs, queries, nil) }()
+	for mock.ExpectationsWereMet() != nil && time.Since(start) < 5*time.Second {
+		time.Sleep(time.Millisecond)
+	}
+	elapsed := time.Since(start)
+	close(jobs)
+	assert.NilError(t, <-done)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	return elapsed
+}
+
+func TestWorkersDrainJobsOnClose(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.rowsInserted.Store(0)
+	connector := &goneAwayConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	// the rows don't fill whole batches of every worker, so the partial batches must be flushed on close
+	const n = 1003
+	jobs := make(chan Job, channelBufferSize)
+	workers := newDomainLoader(l, db).StartWorkers(context.Background(), jobs)
+	for i := 1; i <= n; i++ {
+		jobs <- Job{Row: i, Values: []string{strconv.Itoa(i), "google.com"}}
+	}
+	start := time.Now()
+	close(jobs)
+	assert.NilError(t, workers.Wait())
+	assert.Equal(t, connector.values.Load(), int64(2*n))
+	assert.Equal(t, l.rowsInserted.Load(), int64(n))
+	assert.Assert(t, time.Since(start) < l.config.FlushInterval, "closing jobs flushes without waiting for the flush interval")
+}
+
+// withFlushConfig returns a Loader flushing batches of at least minRows rows, or after maxLatency
+func withFlushConfig(t *testing.T, minRows int, maxLatency time.Duration) *Loader {
+	l := newTestLoader()
+	l.config.FlushInterval = 10 * time.Millisecond
+	l.config.MinFlushRows = minRows
+	l.config.MaxFlushLatency = maxLatency
+	return l
+}
+
+func TestMinFlushRowsLatencyBound(t *testing.T) {
+	l := withFlushConfig(t, 4, 100*time.Millisecond)
+	// a single row waits for more rows, but only up to the latency bound
+	elapsed := runFlushWorker(t, l, 1)
+	assert.Assert(t, elapsed >= 100*time.Millisecond, elapsed)
+	assert.Assert(t, elapsed < 500*time.Millisecond, elapsed)
+}
+
+func TestMinFlushRowsReached(t *testing.T) {
+	l := withFlushConfig(t, 4, time.Minute)
+	elapsed := runFlushWorker(t, l, 4)
+	assert.Assert(t, elapsed < 500*time.Millisecond, elapsed)
+}
+
+func TestFlushIntervalSlowProducer(t *testing.T) {
+	l := withFlushConfig(t, 0, time.Minute)
+	l.config.FlushInterval = 20 * time.Millisecond
+	l.rowsInserted.Store(0)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	queries := l.newBatchQueries("domain", []string{"Domain"})
+	const n = 4
+	for i := 1; i <= n; i++ {
+		mock.ExpectExec(queries.For("")[0]).WithArgs(strconv.Itoa(i) + ".com").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	jobs := make(chan Job)
+	done := make(chan error)
+	go func() { done <- l.worker(context.Background(), 0, db, jobs, queries, nil) }()
+	// every row arrives long after the flush interval, so it is executed on its own before the next one is sent
+	for i := 1; i <= n; i++ {
+		sent := time.Now()
+		jobs <- Job{Row: i, Values: []string{strconv.Itoa(i) + ".com"}}
+		for l.rowsInserted.Load() < int64(i) && time.Since(sent) < 5*time.Second {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, l.rowsInserted.Load(), int64(i))
+		assert.Assert(t, time.Since(sent) < 500*time.Millisecond, "row %d waited %s", i, time.Since(sent))
+		time.Sleep(3 * l.config.FlushInterval)
+	}
+	close(jobs)
+	assert.NilError(t, <-done)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	_, err = ParseFlags([]string{"-flush-interval", "0s"})
+	assert.ErrorContains(t, err, "invalid flush-interval 0s, must be positive")
+}
+
+func TestFlushIntervalStartsWithFirstRow(t *testing.T) {
+	l := withFlushConfig(t, 0, time.Minute)
+	l.config.FlushInterval = 200 * time.Millisecond
+	l.config.BatchSize = 2
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	queries := l.newBatchQueries("domain", []string{"Domain"})
+	mock.ExpectExec(queries.For("")[1]).WithArgs("1.com", "2.com").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	jobs := make(chan Job)
+	done := make(chan error)
+	go func() { done <- l.worker(context.Background(), 0, db, jobs, queries, nil) }()
+	// the idle time before doesn't count, the second row arrives within the interval of the first one
+	time.Sleep(300 * time.Millisecond)
+	jobs <- Job{Row: 1, Values: []string{"1.com"}}
+	time.Sleep(140 * time.Millisecond)
+	jobs <- Job{Row: 2, Values: []string{"2.com"}}
+	close(jobs)
+	assert.NilError(t, <-done)
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestFlushTimer(t *testing.T) {
+	f := newFlushTimer()
+	assert.Assert(t, f.C() == nil, "not armed")
+	f.arm(time.Millisecond)
+	<-f.C()
+	f.fired()
+	assert.Assert(t, f.C() == nil)
+
+	// a tick nobody received is drained, the timer fires again only after the next interval
+	f.arm(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	f.arm(time.Hour)
+	select {
+	case <-f.C():
+		t.Fatal("stale tick of the previous interval")
+	default:
+	}
+	f.stop()
+	assert.Assert(t, f.C() == nil)
+}
+
+func TestBuildInsertQuery(t *testing.T) {
+	l := newTestLoader()
+	query, placeholders := l.config.buildInsertQuery("domain", []string{"GlobalRank", "Domain"})
+	assert.Equal(t, query, "INSERT INTO `domain` (`GlobalRank`,`Domain`) VALUES (?,?)")
+	assert.Equal(t, placeholders, "?,?")
+}
+
+func TestBuildInsertQueryQuotesIdentifiers(t *testing.T) {
+	l := newTestLoader()
+	query, _ := l.config.buildInsertQuery("shop.order", []string{"group", "first name", "odd`name"})
+	assert.Equal(t, query, "INSERT INTO `shop`.`order` (`group`,`first name`,`odd``name`) VALUES (?,?,?)")
+	assert.Equal(t, l.config.onDuplicateClause(OnDuplicateUpdate, []string{"group", "first name"}, nil),
+		" ON DUPLICATE KEY UPDATE `group`=VALUES(`group`),`first name`=VALUES(`first name`)")
+}
+
+func TestBuildBatchQueries(t *testing.T) {
+	l := newTestLoader()
+	query, placeholders := l.config.buildInsertQuery("domain", []string{"GlobalRank", "Domain"})
+	queries := buildBatchQueries(mysqlDialect{}, query, placeholders, "", sqlBatchSize)
+	assert.Equal(t, len(queries), sqlBatchSize)
+	assert.Equal(t, queries[0], "INSERT INTO `domain` (`GlobalRank`,`Domain`) VALUES (?,?)")
+	assert.Equal(t, queries[2], "INSERT INTO `domain` (`GlobalRank`,`Domain`) VALUES (?,?), (?,?), (?,?)")
+	for i, q := range queries {
+		assert.Equal(t, strings.Count(q, "?"), 2*(i+1))
+	}
+}
+
+func TestBuildValuesClause(t *testing.T) {
+	assert.Equal(t, buildValuesClause("?,?", 3), "(?,?), (?,?), (?,?)")
+	assert.Equal(t, buildValuesClause("?", 1), "(?)")
+	assert.Equal(t, buildValuesClause("?", 0), "")
+
+	// the suffix follows the values of every statement
+	queries := buildBatchQueries(mysqlDialect{}, "INSERT INTO `t` (`a`) VALUES (?)", "?", " ON DUPLICATE KEY UPDATE `a`=VALUES(`a`)", 3)
+	assert.DeepEqual(t, queries, []string{
+		"INSERT INTO `t` (`a`) VALUES (?) ON DUPLICATE KEY UPDATE `a`=VALUES(`a`)",
+		"INSERT INTO `t` (`a`) VALUES (?), (?) ON DUPLICATE KEY UPDATE `a`=VALUES(`a`)",
+		"INSERT INTO `t` (`a`) VALUES (?), (?), (?) ON DUPLICATE KEY UPDATE `a`=VALUES(`a`)",
+	})
+}
+
+func TestBatchRows(t *testing.T) {
+	l := newTestLoader()
+	assert.Equal(t, l.config.batchRows(4), sqlBatchSize)
+
+	l.config.BatchPlaceholders = 1000
+	assert.Equal(t, l.config.batchRows(4), 250)
+	assert.Equal(t, l.config.batchRows(3), 333)
+	// a row wider than the placeholders still makes a batch
+	assert.Equal(t, l.config.batchRows(2000), 1)
+
+	l.config.BatchPlaceholders = 100
+	queries := l.newBatchQueries("domain", []string{"GlobalRank", "TldRank", "Domain", "TLD"})
+	assert.Equal(t, queries.rows, 25)
+	assert.Equal(t, strings.Count(queries.For("")[24], "?"), 100)
+}
+
+func TestBuildInsertQueryTag(t *testing.T) {
+	l := newTestLoader()
+	l.config.QueryTag = "import:majestic run:abc123"
+	query, _ := l.config.buildInsertQuery("domain", []string{"Domain"})
+	assert.Equal(t, query, "/* import:majestic run:abc123 */ INSERT INTO `domain` (`Domain`) VALUES (?)")
+}
+
+func TestQueryCommentSanitize(t *testing.T) {
+	assert.Equal(t, queryComment("x */ DROP TABLE domain; /*"), "/* x  DROP TABLE domain;  */ ")
+	// removing one */ must not create a new one
+	assert.Equal(t, queryComment("a**//b"), "/* ab */ ")
+	assert.Equal(t, queryComment("!50000 SET x=1"), "/* !50000 SET x=1 */ ")
+}
+
+func TestBuildInsertQueryValueExprs(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-value-expr", "location=ST_GeomFromText(?, 4326)", "-value-expr", "meta=CAST(? AS JSON)"})
+	assert.NilError(t, err)
+
+	query, placeholders := l.config.buildInsertQuery("places", []string{"name", "location", "meta"})
+	assert.Equal(t, query, "INSERT INTO `places` (`name`,`location`,`meta`) VALUES (?,ST_GeomFromText(?, 4326),CAST(? AS JSON))")
+	assert.Equal(t, strings.Count(placeholders, "?"), 3, "one placeholder per column")
+}
+
+func TestValueExprNeedsSinglePlaceholder(t *testing.T) {
+	_, err := ParseFlags([]string{"-value-expr", "location=POINT(?, ?)"})
+	assert.ErrorContains(t, err, "needs exactly one ?")
+
+	_, err = ParseFlags([]string{"-value-expr", "created=NOW()"})
+	assert.ErrorContains(t, err, "needs exactly one ?")
+
+	_, err = ParseFlags([]string{"-value-expr", "noequals"})
+	assert.ErrorContains(t, err, "expected key=value")
+}
+
+func TestTrimSurroundingQuotes(t *testing.T) {
+	assert.Equal(t, trimSurroundingQuotes(`"google.com"`), "google.com")
+	assert.Equal(t, trimSurroundingQuotes(`'google.com'`), "google.com")
+	assert.Equal(t, trimSurroundingQuotes(`"say "hi""`), `say "hi"`, "internal quotes are preserved")
+	assert.Equal(t, trimSurroundingQuotes(`""x""`), `"x"`, "only the outer pair is removed")
+	assert.Equal(t, trimSurroundingQuotes(`"mixed'`), `"mixed'`)
+	assert.Equal(t, trimSurroundingQuotes(`"`), `"`)
+	assert.Equal(t, trimSurroundingQuotes(`""`), "")
+	assert.Equal(t, trimSurroundingQuotes("plain"), "plain")
+}
+
+func TestProcessCSVFileTrimQuotes(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-trim-quotes", "Domain"})
+	assert.NilError(t, err)
+	assert.NilError(t, l.config.ResolveColumns([]string{"GlobalRank", "Domain"}))
+
+	// single quotes are no CSV quotes, so csv.Reader keeps them in the values
+	reader := csv.NewReader(strings.NewReader(`'1','google.com'` + "\n"))
+	jobs := make(chan Job, 10)
+	l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"'1'", "google.com"}})
+}
+
+func TestSuccessRatio(t *testing.T) {
+	assert.Equal(t, successRatio(0, 0), 1.0, "nothing read is nothing failed")
+	assert.Equal(t, successRatio(99, 100), 0.99)
+	assert.Equal(t, successRatio(100, 100), 1.0)
+}
+
+// BenchmarkTraceUnguarded and BenchmarkTraceGuarded show the cost of a disabled trace call per row
+func BenchmarkTraceUnguarded(b *testing.B) {
+	row := []string{"1", "1", "google.com", "com"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Traceln("read line with values:", row)
+	}
+}
+
+func BenchmarkTraceGuarded(b *testing.B) {
+	row := []string{"1", "1", "google.com", "com"}
+	trace := log.IsLevelEnabled(log.TraceLevel)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if trace {
+			log.Traceln("read line with values:", row)
+		}
+	}
+}
+
+// BenchmarkBatchQueryConcat builds the statement of a full batch like the workers did before buildBatchQueries
+func BenchmarkBatchQueryConcat(b *testing.B) {
+	l := newTestLoader()
+	query, placeholders := l.config.buildInsertQuery("domain", []string{"GlobalRank", "TldRank", "Domain", "TLD"})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		q := strings.Clone(query)
+		for counter := 1; counter < sqlBatchSize; counter++ {
+			q = q + ", (" + placeholders + ")"
+		}
+		benchmarkQuery = q
+	}
+}
+
+func BenchmarkBatchQueryPrecomputed(b *testing.B) {
+	l := newTestLoader()
+	query, placeholders := l.config.buildInsertQuery("domain", []string{"GlobalRank", "TldRank", "Domain", "TLD"})
+	queries := buildBatchQueries(mysqlDialect{}, query, placeholders, "", sqlBatchSize)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkQuery = queries[sqlBatchSize-1]
+	}
+}
+
+// BenchmarkValuesClauseConcat builds the value groups of a batch of 100 rows by concatenation
+func BenchmarkValuesClauseConcat(b *testing.B) {
+	l := newTestLoader()
+	_, placeholders := l.config.buildInsertQuery("domain", []string{"GlobalRank", "TldRank", "Domain", "TLD"})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		q := "(" + placeholders + ")"
+		for counter := 1; counter < 100; counter++ {
+			q = q + ", (" + placeholders + ")"
+		}
+		benchmarkQuery = q
+	}
+}
+
+func BenchmarkValuesClauseBuilder(b *testing.B) {
+	l := newTestLoader()
+	_, placeholders := l.config.buildInsertQuery("domain", []string{"GlobalRank", "TldRank", "Domain", "TLD"})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkQuery = buildValuesClause(placeholders, 100)
+	}
+}
+
+// benchmarkQuery keeps the compiler from optimizing the benchmarked statements away
+var benchmarkQuery string
+
+func BenchmarkProcessCSVFile(b *testing.B) {
+	l := newTestLoader()
+	var input strings.Builder
+	for i := 0; i < b.N; i++ {
+		input.WriteString("1,1,google.com,com,193,0,1,1,google.com,com,42,23\n")
+	}
+	reader := csv.NewReader(strings.NewReader(input.String()))
+	jobs := make(chan Job, channelBufferSize)
+	go func() {
+		for range jobs {
+		}
+	}()
+	level := log.GetLevel()
+	log.SetLevel(log.WarnLevel)
+	defer log.SetLevel(level)
+	b.ReportAllocs()
+	b.ResetTimer()
+	l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, b.N)
+	close(jobs)
+}
+
+func TestWorkerEmptyAsNull(t *testing.T) {
+	l := newTestLoader()
+	l.config.EmptyAsNull = true
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec("INSERT INTO `domain` (`Domain`,`TldRank`) VALUES (?,?), (?,?), (?,?)").
+		WithArgs("google.com", nil, nil, "2", " ", "3").WillReturnResult(sqlmock.NewResult(0, 3))
+
+	jobs := make(chan Job, 10)
+	jobs <- Job{Row: 1, Values: []string{"google.com", ""}}
+	jobs <- Job{Row: 2, Values: []string{"", "2"}}
+	// only a zero-length field is NULL
+	jobs <- Job{Row: 3, Values: []string{" ", "3"}}
+	close(jobs)
+	assert.NilError(t, l.worker(context.Background(), 0, db, jobs, l.newBatchQueries("domain", []string{"Domain", "TldRank"}), nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func BenchmarkWorkerBatches(b *testing.B) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-dry-run", "-batch-size", "1000"})
+	assert.NilError(b, err)
+	headers := []string{"GlobalRank", "TldRank", "Domain", "TLD"}
+	queries := l.newBatchQueries("domain", headers)
+	jobs := make(chan Job, channelBufferSize)
+	go func() {
+		row := []string{"1", "1", "google.com", "com"}
+		for i := 0; i < b.N; i++ {
+			jobs <- Job{Row: i + 1, Values: row}
+		}
+		close(jobs)
+	}()
+	level := log.GetLevel()
+	log.SetLevel(log.WarnLevel)
+	defer log.SetLevel(level)
+	b.ReportAllocs()
+	b.ResetTimer()
+	assert.NilError(b, l.worker(context.Background(), 0, nil, jobs, queries, nil))
+}
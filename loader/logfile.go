@@ -0,0 +1,115 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RotatingFile is a log file rotated when it reaches its maximum size: filename is renamed to filename.1, an earlier
+// filename.1 to filename.2 and so on, keeping maxFiles of the rotated files
+type RotatingFile struct {
+	mu       sync.Mutex
+	filename string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+// OpenRotatingFile opens filename for appending, rotating it beyond maxSize bytes (0 never rotates)
+func OpenRotatingFile(filename string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	r := &RotatingFile{filename: filename, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write writes p, which a logger calls with whole entries, rotating the file first when p doesn't fit anymore
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file and the rotated ones, dropping the oldest, and opens a new file
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+	if r.maxFiles == 0 {
+		if err := os.Remove(r.filename); err != nil {
+			return err
+		}
+		return r.open()
+	}
+	for i := r.maxFiles - 1; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", r.filename, i), fmt.Sprintf("%s.%d", r.filename, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.filename, r.filename+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// SetupLogFile makes logger write to filename instead of stderr, rotated beyond maxSizeMB megabytes. The returned
+// closer restores stderr and closes the file.
+func SetupLogFile(logger *log.Logger, filename string, maxSizeMB int, maxFiles int) (io.Closer, error) {
+	f, err := OpenRotatingFile(filename, int64(maxSizeMB)<<20, maxFiles)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the log file: %w", err)
+	}
+	logger.SetOutput(f)
+	return closerFunc(func() error {
+		logger.SetOutput(os.Stderr)
+		return f.Close()
+	}), nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
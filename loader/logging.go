@@ -0,0 +1,78 @@
+package loader
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// log formats accepted by -log-format
+const (
+	// LogFormatText is the human readable format with full timestamps
+	LogFormatText = "text"
+	// LogFormatJSON writes every entry as a JSON object, for log shippers
+	LogFormatJSON = "json"
+)
+
+var logFormats = []string{LogFormatText, LogFormatJSON}
+
+// SetupLogging applies the log format and the log level (a logrus level like info or warn) checked by
+// Config.Validate to logger
+func SetupLogging(logger *log.Logger, format string, level string) {
+	if format == LogFormatJSON {
+		logger.SetFormatter(&log.JSONFormatter{})
+	} else {
+		logger.SetFormatter(&log.TextFormatter{
+			DisableColors: false,
+			FullTimestamp: true,
+		})
+	}
+	if l, err := log.ParseLevel(level); err == nil {
+		logger.SetLevel(l)
+	}
+}
+
+// NewRunID returns a random ID for a run, logged as run_id with every entry to tell the runs apart in a log store
+func NewRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// fieldsHook adds its fields to every entry which doesn't have them already
+type fieldsHook log.Fields
+
+func (h fieldsHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h fieldsHook) Fire(entry *log.Entry) error {
+	for k, v := range h {
+		if _, ok := entry.Data[k]; !ok {
+			entry.Data[k] = v
+		}
+	}
+	return nil
+}
+
+// SetRunID logs id as run_id with every entry of logger
+func SetRunID(logger *log.Logger, id string) {
+	logger.AddHook(fieldsHook{"run_id": id})
+}
+
+// batchFields are the fields of the entries about a batch: the worker, the sequence number of the batch of the
+// worker, its rows and the input of its first row
+func (l *Loader) batchFields(workerIndex int, seq int, rows []int, duration time.Duration) log.Fields {
+	fields := log.Fields{"worker_id": workerIndex, "batch_seq": seq, "rows": len(rows), "line_range": rowRanges(rows)}
+	if duration > 0 {
+		fields["duration_ms"] = duration.Milliseconds()
+	}
+	if len(rows) > 0 {
+		if name := l.inputCounter.Name(rows[0]); name != "" {
+			fields["file"] = name
+		}
+	}
+	return fields
+}
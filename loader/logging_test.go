@@ -0,0 +1,99 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+)
+
+func TestSetupLoggingJSON(t *testing.T) {
+	c, err := ParseFlags([]string{"-log-format", "json", "-log-level", "warn"})
+	assert.NilError(t, err)
+	logger := log.New()
+	var out bytes.Buffer
+	logger.SetOutput(&out)
+	SetupLogging(logger, c.LogFormat, c.LogLevel)
+	assert.Equal(t, logger.GetLevel(), log.WarnLevel)
+
+	logger.Infof("Starting Worker %d", 1)
+	logger.WithField("worker", 1).Warn("Batch failed")
+	var entry map[string]any
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &entry), "only the warning is logged: %s", out.String())
+	assert.Equal(t, entry["level"], "warning")
+	assert.Equal(t, entry["msg"], "Batch failed")
+	assert.Equal(t, entry["worker"], 1.0)
+}
+
+func TestSetupLoggingDefaults(t *testing.T) {
+	c, err := ParseFlags(nil)
+	assert.NilError(t, err)
+	logger := log.New()
+	SetupLogging(logger, c.LogFormat, c.LogLevel)
+	assert.Equal(t, logger.GetLevel(), log.InfoLevel)
+	_, text := logger.Formatter.(*log.TextFormatter)
+	assert.Assert(t, text)
+
+	_, err = ParseFlags([]string{"-log-format", "xml"})
+	assert.ErrorContains(t, err, "invalid log-format 'xml', allowed are: text, json")
+	_, err = ParseFlags([]string{"-log-level", "loud"})
+	assert.ErrorContains(t, err, "invalid log-level 'loud'")
+}
+
+func TestRunIDAndBatchFields(t *testing.T) {
+	l := newTestLoader()
+	l.inputCounter = NewInputCounter()
+	l.inputCounter.Start("a.csv", 1)
+	l.inputCounter.Start("b.csv", 11)
+	logger := log.New()
+	var out bytes.Buffer
+	logger.SetOutput(&out)
+	SetupLogging(logger, LogFormatJSON, "info")
+	SetRunID(logger, "3f2a")
+
+	logger.WithFields(l.batchFields(2, 7, []int{12, 13, 14}, 1500*time.Millisecond)).Warn("Slow batch")
+	var entry map[string]any
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, entry["run_id"], "3f2a")
+	assert.Equal(t, entry["worker_id"], 2.0)
+	assert.Equal(t, entry["batch_seq"], 7.0)
+	assert.Equal(t, entry["rows"], 3.0)
+	assert.Equal(t, entry["duration_ms"], 1500.0)
+	assert.Equal(t, entry["file"], "b.csv")
+	assert.DeepEqual(t, entry["line_range"], []any{[]any{12.0, 14.0}})
+	assert.Equal(t, len(NewRunID()), 16)
+}
+
+func TestRotatingFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "import.log")
+	f, err := OpenRotatingFile(filename, 10, 2)
+	assert.NilError(t, err)
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = f.Write([]byte(line))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, f.Close())
+	// every line is rotated out by the next one, the oldest is dropped
+	for name, want := range map[string]string{filename: "fourth\n", filename + ".1": "third\n", filename + ".2": "second\n"} {
+		content, err := os.ReadFile(name)
+		assert.NilError(t, err)
+		assert.Equal(t, string(content), want)
+	}
+	_, err = os.Stat(filename + ".3")
+	assert.Assert(t, os.IsNotExist(err))
+
+	// an existing file is appended to
+	f, err = OpenRotatingFile(filename, 0, 2)
+	assert.NilError(t, err)
+	_, err = f.Write([]byte("fifth\n"))
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+	content, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "fourth\nfifth\n")
+}
@@ -0,0 +1,150 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// policies for codes which are not found by a lookup, accepted by -lookup-miss
+const (
+	LookupMissDeadLetter = "deadletter"
+	LookupMissNull       = "null"
+	LookupMissInsertRef  = "insert-ref"
+)
+
+var lookupMissPolicies = []string{LookupMissDeadLetter, LookupMissNull, LookupMissInsertRef}
+
+// lookupNull is the value of a column whose code was not found with the null policy, NULLIF turns it into NULL
+const lookupNull = ""
+
+// lookupResult is a cached lookup, found is false for a code missing in the reference table
+type lookupResult struct {
+	id    string
+	found bool
+}
+
+// lookup replaces the values of a column by the id found for them in a reference table
+type lookup struct {
+	column string
+	index  int
+	query  string
+	insert string
+	cache  map[string]lookupResult
+}
+
+// Lookups replaces code columns by ids looked up in reference tables before the rows are sent to the workers.
+// Every code is looked up once and then served from a cache. It is used by the reader only, so it needs no
+// locking. A nil *Lookups changes nothing.
+type Lookups struct {
+	db      *sql.DB
+	miss    string
+	lookups []*lookup
+	// misses counts the rows with a code which was not found
+	misses int64
+}
+
+// NewLookups prepares the lookups of the columns of c in headers
+func NewLookups(db *sql.DB, c Config, headers []string) (*Lookups, error) {
+	l := &Lookups{db: db, miss: c.LookupMiss}
+	columns := make([]string, 0, len(c.Lookups))
+	for column := range c.Lookups {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		query := c.Lookups[column]
+		index, err := columnIndex(headers, column)
+		if err != nil {
+			return nil, err
+		}
+		// the lookup is written with ? like the other statements
+		query, _ = bindPlaceholders(c.dialect(), query, 0)
+		l.lookups = append(l.lookups, &lookup{
+			column: column, index: index, query: query, insert: c.LookupInserts[column], cache: map[string]lookupResult{},
+		})
+	}
+	return l, nil
+}
+
+// Apply replaces the codes of row by their ids, it returns false (leaving row unchanged) when the row has to go
+// to the dead-letter file
+func (l *Lookups) Apply(ctx context.Context, row []string) (bool, error) {
+	if l == nil {
+		return true, nil
+	}
+	ids := make([]string, len(l.lookups))
+	missed := false
+	for i, lu := range l.lookups {
+		if lu.index >= len(row) {
+			continue
+		}
+		code := row[lu.index]
+		result, cached := lu.cache[code]
+		if !cached {
+			var err error
+			if result, err = l.resolve(ctx, lu, code); err != nil {
+				return false, err
+			}
+			lu.cache[code] = result
+		}
+		switch {
+		case result.found:
+			ids[i] = result.id
+		case l.miss == LookupMissNull:
+			missed = true
+			ids[i] = lookupNull
+		default:
+			l.misses++
+			return false, nil
+		}
+	}
+	if missed {
+		l.misses++
+	}
+	for i, lu := range l.lookups {
+		if lu.index < len(row) {
+			row[lu.index] = ids[i]
+		}
+	}
+	return true, nil
+}
+
+// Misses returns the number of rows with a code which was not found
+func (l *Lookups) Misses() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.misses
+}
+
+// resolve looks up code in the reference table, with the insert-ref policy a missing code gets inserted
+func (l *Lookups) resolve(ctx context.Context, lu *lookup, code string) (lookupResult, error) {
+	var id string
+	err := l.db.QueryRowContext(ctx, lu.query, code).Scan(&id)
+	if err == nil {
+		return lookupResult{id: id, found: true}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return lookupResult{}, fmt.Errorf("lookup of %s '%s' failed: %w", lu.column, code, err)
+	}
+	if l.miss != LookupMissInsertRef {
+		log.Debugf("Lookup of %s '%s' found nothing", lu.column, code)
+		return lookupResult{}, nil
+	}
+	result, err := l.db.ExecContext(ctx, lu.insert, code)
+	if err != nil {
+		return lookupResult{}, fmt.Errorf("inserting reference of %s '%s' failed: %w", lu.column, code, err)
+	}
+	inserted, err := result.LastInsertId()
+	if err != nil {
+		return lookupResult{}, err
+	}
+	log.Printf("Inserted reference of %s '%s' with id %d", lu.column, code, inserted)
+	return lookupResult{id: strconv.FormatInt(inserted, 10), found: true}, nil
+}
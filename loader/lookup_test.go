@@ -0,0 +1,111 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+const testLookupQuery = "SELECT id FROM tld WHERE code=?"
+
+// newTestLookups returns lookups of the TLD column with the given miss policy and their config
+func newTestLookups(t *testing.T, args ...string) (*Lookups, sqlmock.Sqlmock, Config) {
+	c, err := ParseFlags(append([]string{"-lookup", "TLD=" + testLookupQuery}, args...))
+	assert.NilError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	t.Cleanup(func() { db.Close() })
+	l, err := NewLookups(db, c, []string{"Domain", "TLD"})
+	assert.NilError(t, err)
+	return l, mock, c
+}
+
+func TestLookupsCached(t *testing.T) {
+	l, mock, _ := newTestLookups(t, "-dead-letter-file", "dead.csv")
+	mock.ExpectQuery(testLookupQuery).WithArgs("com").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+	for _, domain := range []string{"google.com", "facebook.com"} {
+		row := []string{domain, "com"}
+		imported, err := l.Apply(context.Background(), row)
+		assert.NilError(t, err)
+		assert.Assert(t, imported)
+		assert.DeepEqual(t, row, []string{domain, "7"})
+	}
+	// the second row was served from the cache
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestLookupMissDeadLetter(t *testing.T) {
+	l, mock, _ := newTestLookups(t, "-dead-letter-file", "dead.csv")
+	mock.ExpectQuery(testLookupQuery).WithArgs("zz").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	row := []string{"example.zz", "zz"}
+	imported, err := l.Apply(context.Background(), row)
+	assert.NilError(t, err)
+	assert.Assert(t, !imported)
+	assert.DeepEqual(t, row, []string{"example.zz", "zz"})
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessCSVFileLookupError(t *testing.T) {
+	lookups, mock, c := newTestLookups(t, "-lookup-miss", "null")
+	mock.ExpectQuery(testLookupQuery).WithArgs("com").WillReturnError(errors.New("connection refused"))
+
+	reader := c.newCSVReader(strings.NewReader("google.com,com\n"))
+	jobs := make(chan Job, 1)
+	l := &Loader{headers: []string{"Domain", "TLD"}, config: c, lookups: lookups}
+	rows, _, err := l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	// a failing lookup fails the import instead of exiting the process
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, rows, 0)
+	assert.Equal(t, len(readJobs(jobs)), 0)
+}
+
+func TestLookupMissNull(t *testing.T) {
+	l, mock, c := newTestLookups(t, "-lookup-miss", "null")
+	mock.ExpectQuery(testLookupQuery).WithArgs("zz").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	row := []string{"example.zz", "zz"}
+	imported, err := l.Apply(context.Background(), row)
+	assert.NilError(t, err)
+	assert.Assert(t, imported)
+	assert.DeepEqual(t, row, []string{"example.zz", ""})
+
+	query, _ := c.buildInsertQuery("domain", []string{"Domain", "TLD"})
+	assert.Equal(t, query, "INSERT INTO `domain` (`Domain`,`TLD`) VALUES (?,NULLIF(?, ''))")
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestLookupMissInsertRef(t *testing.T) {
+	const insert = "INSERT INTO tld (code) VALUES (?)"
+	l, mock, _ := newTestLookups(t, "-lookup-miss", "insert-ref", "-lookup-insert", "TLD="+insert)
+	mock.ExpectQuery(testLookupQuery).WithArgs("zz").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(insert).WithArgs("zz").WillReturnResult(sqlmock.NewResult(42, 1))
+
+	row := []string{"example.zz", "zz"}
+	imported, err := l.Apply(context.Background(), row)
+	assert.NilError(t, err)
+	assert.Assert(t, imported)
+	assert.DeepEqual(t, row, []string{"example.zz", "42"})
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestLookupFlagsValidate(t *testing.T) {
+	_, err := ParseFlags([]string{"-lookup", "TLD=" + testLookupQuery})
+	assert.ErrorContains(t, err, "-lookup-miss=deadletter requires -dead-letter-file")
+
+	_, err = ParseFlags([]string{"-lookup", "TLD=" + testLookupQuery, "-lookup-miss", "insert-ref"})
+	assert.ErrorContains(t, err, "requires a -lookup-insert for column TLD")
+
+	_, err = ParseFlags([]string{"-lookup", "TLD=SELECT id FROM tld", "-lookup-miss", "null"})
+	assert.ErrorContains(t, err, "needs exactly one ?")
+
+	_, err = ParseFlags([]string{"-lookup-miss", "skip"})
+	assert.ErrorContains(t, err, "invalid lookup-miss 'skip'")
+}
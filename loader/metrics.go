@@ -0,0 +1,176 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// metricsPrefix is put in front of every Prometheus metric name
+const metricsPrefix = "go_mysql_worker_"
+
+// metricsBuckets are the upper bounds in seconds of the batch duration histogram buckets
+var metricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics serves the counters of the import in the Prometheus text format on /metrics: the rows read, inserted
+// and failed, the batches executed, retried and failed, the batch durations per worker, the length of the jobs
+// channel and the stats of the connection pool. A nil *Metrics records nothing.
+type Metrics struct {
+	// loader is the Loader whose counters and Status are served, nil serves none
+	loader   *Loader
+	db       *sql.DB
+	queue    jobQueue
+	rowsRead atomic.Int64
+	errors   atomic.Int64
+	// durations are the batch duration histograms of the workers
+	durations []histogram
+	server    *http.Server
+	done      chan struct{}
+	// addr is the address listened on
+	addr string
+}
+
+// histogram counts observations in metricsBuckets
+type histogram struct {
+	mu      sync.Mutex
+	buckets []int64
+	count   int64
+	sum     float64
+}
+
+// NewMetrics records the metrics of the import of l (nil without counters) with workers workers inserting the rows
+// of jobs into db (nil without pool stats)
+func NewMetrics(l *Loader, db *sql.DB, jobs chan Job, workers int) *Metrics {
+	m := &Metrics{loader: l, db: db, queue: jobQueue{jobs: jobs}, durations: make([]histogram, max(1, workers))}
+	if l != nil {
+		// the reader sends the rows to the channels of the workers then
+		m.queue.shards = l.shards
+	}
+	for i := range m.durations {
+		m.durations[i].buckets = make([]int64, len(metricsBuckets))
+	}
+	return m
+}
+
+// Serve listens on addr (host:port, :9100 for all interfaces) and serves the metrics until Close
+func (m *Metrics) Serve(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error listening for metrics on %s: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.Write(w)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) { serveStatus(m.loader, w) })
+	m.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	m.done = make(chan struct{})
+	m.addr = ln.Addr().String()
+	go func() {
+		defer close(m.done)
+		if err := m.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Serving metrics failed: %s", err)
+		}
+	}()
+	log.Printf("Serving metrics on http://%s/metrics and the status on http://%s/status", m.addr, m.addr)
+	return nil
+}
+
+// Close stops serving the metrics
+func (m *Metrics) Close() error {
+	if m == nil || m.server == nil {
+		return nil
+	}
+	err := m.server.Shutdown(context.Background())
+	<-m.done
+	return err
+}
+
+// Read counts a row read from the inputs
+func (m *Metrics) Read() {
+	if m == nil {
+		return
+	}
+	m.rowsRead.Add(1)
+}
+
+// Batch records the duration of a batch executed by worker workerIndex, err is its error
+func (m *Metrics) Batch(workerIndex int, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.errors.Add(1)
+	}
+	if workerIndex < 0 || workerIndex >= len(m.durations) {
+		return
+	}
+	m.durations[workerIndex].observe(duration.Seconds())
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, le := range metricsBuckets {
+		if v <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Write writes the metrics to w in the Prometheus text format
+func (m *Metrics) Write(w io.Writer) {
+	metric := func(name, kind, help string, value any) {
+		fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n%s%s %v\n", metricsPrefix, name, help, metricsPrefix, name, kind, metricsPrefix, name, value)
+	}
+	c := &counters{}
+	if m.loader != nil {
+		c = &m.loader.counters
+	}
+	metric("rows_read_total", "counter", "Rows read from the inputs.", m.rowsRead.Load())
+	metric("rows_inserted_total", "counter", "Rows inserted.", c.rowsInserted.Load())
+	metric("rows_failed_total", "counter", "Rows which failed to be inserted.", c.rowsFailed.Load())
+	metric("batches_total", "counter", "Batches executed successfully.", c.batchesExecuted.Load())
+	metric("batch_retries_total", "counter", "Batches retried.", c.batchRetries.Load())
+	metric("batch_errors_total", "counter", "Batch executions which failed, including the retried ones.", m.errors.Load())
+	metric("reconnects_total", "counter", "Connections replaced because the server closed them.", c.reconnectCount.Load())
+	metric("queue_depth", "gauge", "Rows waiting in the jobs channel for the workers.", m.queue.length())
+	metric("queue_capacity", "gauge", "Capacity of the jobs channel.", m.queue.capacity())
+
+	name := metricsPrefix + "batch_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Duration of the executed batches per worker.\n# TYPE %s histogram\n", name, name)
+	for i := range m.durations {
+		h := &m.durations[i]
+		h.mu.Lock()
+		for b, le := range metricsBuckets {
+			fmt.Fprintf(w, "%s_bucket{worker=\"%d\",le=\"%s\"} %d\n", name, i, strconv.FormatFloat(le, 'g', -1, 64), h.buckets[b])
+		}
+		fmt.Fprintf(w, "%s_bucket{worker=\"%d\",le=\"+Inf\"} %d\n", name, i, h.count)
+		fmt.Fprintf(w, "%s_sum{worker=\"%d\"} %s\n%s_count{worker=\"%d\"} %d\n", name, i, strconv.FormatFloat(h.sum, 'g', -1, 64), name, i, h.count)
+		h.mu.Unlock()
+	}
+
+	if m.db == nil {
+		return
+	}
+	s := m.db.Stats()
+	metric("db_open_connections", "gauge", "Connections of the pool, in use and idle.", s.OpenConnections)
+	metric("db_in_use_connections", "gauge", "Connections of the pool in use.", s.InUse)
+	metric("db_idle_connections", "gauge", "Idle connections of the pool.", s.Idle)
+	metric("db_wait_count_total", "counter", "Connections waited for.", s.WaitCount)
+	metric("db_wait_duration_seconds_total", "counter", "Time waited for connections.", s.WaitDuration.Seconds())
+	metric("db_max_idle_closed_total", "counter", "Connections closed because of the idle limit.", s.MaxIdleClosed)
+	metric("db_max_lifetime_closed_total", "counter", "Connections closed because of their maximum lifetime.", s.MaxLifetimeClosed)
+}
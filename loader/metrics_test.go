@@ -0,0 +1,72 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	jobs := make(chan Job, 4)
+	jobs <- Job{Row: 1}
+	l := newTestLoader()
+	l.rowsInserted.Store(5)
+	m := NewMetrics(l, nil, jobs, 2)
+	m.Read()
+	m.Read()
+	m.Batch(1, 20*time.Millisecond, nil)
+	m.Batch(1, 3*time.Second, errors.New("deadlock"))
+	m.Batch(7, time.Second, nil)
+
+	var out bytes.Buffer
+	m.Write(&out)
+	text := out.String()
+	for _, line := range []string{
+		"# TYPE go_mysql_worker_rows_read_total counter\ngo_mysql_worker_rows_read_total 2\n",
+		"go_mysql_worker_rows_inserted_total 5\n",
+		"go_mysql_worker_batch_errors_total 1\n",
+		"go_mysql_worker_queue_depth 1\n",
+		"go_mysql_worker_queue_capacity 4\n",
+		"# TYPE go_mysql_worker_batch_duration_seconds histogram\n",
+		`go_mysql_worker_batch_duration_seconds_bucket{worker="0",le="+Inf"} 0` + "\n",
+		`go_mysql_worker_batch_duration_seconds_bucket{worker="1",le="0.01"} 0` + "\n",
+		`go_mysql_worker_batch_duration_seconds_bucket{worker="1",le="0.025"} 1` + "\n",
+		`go_mysql_worker_batch_duration_seconds_bucket{worker="1",le="5"} 2` + "\n",
+		`go_mysql_worker_batch_duration_seconds_sum{worker="1"} 3.02` + "\n",
+		`go_mysql_worker_batch_duration_seconds_count{worker="1"} 2` + "\n",
+	} {
+		assert.Assert(t, strings.Contains(text, line), "missing %q in\n%s", line, text)
+	}
+	assert.Assert(t, !strings.Contains(text, "db_open_connections"), "no pool stats without a db")
+
+	var nilMetrics *Metrics
+	nilMetrics.Read()
+	nilMetrics.Batch(0, time.Second, nil)
+	assert.NilError(t, nilMetrics.Close())
+}
+
+func TestMetricsServe(t *testing.T) {
+	db, _, err := sqlmock.New()
+	assert.NilError(t, err)
+	defer db.Close()
+	m := NewMetrics(nil, db, make(chan Job), 1)
+	assert.NilError(t, m.Serve("127.0.0.1:0"))
+	defer m.Close()
+
+	res, err := http.Get("http://" + m.addr + "/metrics")
+	assert.NilError(t, err)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NilError(t, err)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	assert.Assert(t, strings.Contains(string(body), "go_mysql_worker_db_open_connections "))
+
+	assert.ErrorContains(t, NewMetrics(nil, nil, nil, 1).Serve(m.addr), "error listening for metrics on "+m.addr)
+}
@@ -0,0 +1,76 @@
+package loader
+
+import "slices"
+
+// nullRule tells which values of a column are inserted as NULL
+type nullRule struct {
+	empty  bool
+	values []string
+}
+
+func (r nullRule) isNull(v string) bool {
+	return r.empty && v == "" || slices.Contains(r.values, v)
+}
+
+// globalNullRule is the rule of -empty-as-null and -null-values, it applies to the columns without one of their own
+func (c *Config) globalNullRule() nullRule {
+	return nullRule{empty: c.EmptyAsNull, values: c.NullValues}
+}
+
+// resolveNulls sets the null rules of the headers and the insert columns when a column of the -map-file has a rule
+// of its own, the others get the global rule then. Without such a column everything uses the global rule.
+func (c *Config) resolveNulls(headers []string, columns []string) {
+	c.headerNulls, c.insertNulls = nil, nil
+	if !slices.ContainsFunc(c.ColumnMap, func(m ColumnMapping) bool { return m.EmptyAsNull != nil || m.NullValues != nil }) {
+		return
+	}
+	c.headerNulls = make([]nullRule, len(headers))
+	for i := range headers {
+		c.headerNulls[i] = c.globalNullRule()
+	}
+	for _, m := range c.ColumnMap {
+		index, err := columnIndex(headers, m.Header)
+		if err != nil {
+			// ResolveColumns checked the headers of the mapping already
+			continue
+		}
+		rule := c.globalNullRule()
+		if m.EmptyAsNull != nil {
+			rule.empty = *m.EmptyAsNull
+		}
+		if m.NullValues != nil {
+			rule.values = m.NullValues
+		}
+		c.headerNulls[index] = rule
+	}
+	c.insertNulls = make([]nullRule, len(columns))
+	for i := range columns {
+		if i < len(c.mapIndexes) {
+			c.insertNulls[i] = c.headerNulls[c.mapIndexes[i]]
+		} else {
+			// the -constant columns
+			c.insertNulls[i] = c.globalNullRule()
+		}
+	}
+}
+
+// headerNull reports whether the value v of the CSV column index is NULL
+func (c *Config) headerNull(index int, v string) bool {
+	if index < len(c.headerNulls) {
+		return c.headerNulls[index].isNull(v)
+	}
+	return c.globalNullRule().isNull(v)
+}
+
+// insertNull reports whether the value v of the bound arguments at position i (of a batch of rows) is NULL
+func (c *Config) insertNull(i int, v string) bool {
+	if len(c.insertNulls) > 0 {
+		return c.insertNulls[i%len(c.insertNulls)].isNull(v)
+	}
+	return c.globalNullRule().isNull(v)
+}
+
+// hasNulls reports whether any value may be inserted as NULL
+func (c *Config) hasNulls() bool {
+	return c.EmptyAsNull || len(c.NullValues) > 0 || len(c.insertNulls) > 0
+}
@@ -0,0 +1,47 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestNullValues(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-null-values", `\N,NULL`})
+	assert.NilError(t, err)
+	assert.NilError(t, l.config.ResolveColumns([]string{"Domain", "TldRank"}))
+
+	args := l.config.bindArgs([]string{"google.com", `\N`, "NULL", ""}, 2)
+	assert.DeepEqual(t, args, []any{"google.com", nil, nil, ""})
+	// LOAD DATA only knows \N
+	assert.DeepEqual(t, l.config.loadDataBlockers(), []string{"-null-values"})
+}
+
+func TestNullValuesPerColumn(t *testing.T) {
+	l := newTestLoader()
+	filename := filepath.Join(t.TempDir(), "columns.json")
+	assert.NilError(t, os.WriteFile(filename, []byte(`{
+		"columns": [
+			{"header": "Domain", "column": "name", "empty_as_null": false},
+			{"header": "TldRank", "null_values": ["-"]},
+			{"header": "Note"}
+		]
+	}`), 0o644))
+	var err error
+	l.config, err = ParseFlags([]string{"-map-file", filename, "-empty-as-null", "-null-values", "NULL", "-constant", "source="})
+	assert.NilError(t, err)
+	headers := []string{"Note", "TldRank", "Domain"}
+	assert.NilError(t, l.config.ResolveColumns(headers))
+
+	// name keeps its empty value, TldRank only knows -, Note and the constant use the global rule
+	args := l.config.bindArgs([]string{"", "-", "", "NULL", "NULL", "NULL"}, 2)
+	assert.DeepEqual(t, args, []any{"", nil, nil, nil, nil, "NULL", nil, nil})
+	assert.Assert(t, l.config.headerNull(1, "-"))
+	assert.Assert(t, !l.config.headerNull(1, "NULL"))
+	assert.Assert(t, !l.config.headerNull(2, ""))
+	assert.Assert(t, l.config.headerNull(0, ""))
+}
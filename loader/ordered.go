@@ -0,0 +1,134 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errOrderAborted is the error of a batch of -ordered which can't get its turn, as a worker failed
+var errOrderAborted = errors.New("the import is aborted")
+
+// orderedCommits lets the batches of -ordered execute in the order of the input: the reader numbers the rows it
+// sends from 1 (Job.Seq), the rows are dealt out to the workers in blocks of a batch and a batch waits for its turn
+// until the rows before its first one are done. The workers still read, convert and bind their batches in parallel,
+// only the statements are executed one at a time. A nil *orderedCommits doesn't order anything.
+type orderedCommits struct {
+	// sent is the sequence number of the last row sent, only used by the reader
+	sent int
+	mu   sync.Mutex
+	// next is the sequence number of the first row which isn't done, changed is closed when it advances
+	next    int
+	changed chan struct{}
+	aborted bool
+	waited  time.Duration
+}
+
+func newOrderedCommits() *orderedCommits {
+	return &orderedCommits{next: 1, changed: make(chan struct{})}
+}
+
+// Number returns the sequence number of the next row sent to the workers, 0 if rows aren't ordered
+func (o *orderedCommits) Number() int {
+	if o == nil {
+		return 0
+	}
+	o.sent++
+	return o.sent
+}
+
+// Wait blocks until it's the turn of the batch whose first row has the sequence number first. It fails once the
+// import is aborted or ctx is canceled.
+func (o *orderedCommits) Wait(ctx context.Context, first int) error {
+	if o == nil {
+		return nil
+	}
+	start := time.Now()
+	defer func() {
+		o.mu.Lock()
+		o.waited += time.Since(start)
+		o.mu.Unlock()
+	}()
+	for {
+		o.mu.Lock()
+		next, changed, aborted := o.next, o.changed, o.aborted
+		o.mu.Unlock()
+		if aborted {
+			return errOrderAborted
+		}
+		if next == first {
+			return nil
+		}
+		if next > first {
+			return fmt.Errorf("the rows from %d are out of order, the rows up to %d are done already", first, next-1)
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Done passes the turn on to the batch after the one whose last row has the sequence number last
+func (o *orderedCommits) Done(last int) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.next = last + 1
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// Abort wakes the waiting batches after a worker failed, the turn of the batch of the failed worker never comes
+func (o *orderedCommits) Abort() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.aborted = true
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// Waited returns how long the batches waited for their turn in total
+func (o *orderedCommits) Waited() time.Duration {
+	if o == nil {
+		return 0
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.waited
+}
+
+// byBlock returns a pick function for newJobShards which deals the rows numbered by -ordered out to n shards in blocks
+// of rows, so every full batch of a worker has consecutive rows
+func byBlock(rows int, n int) func(job Job) int {
+	return func(job Job) int {
+		return (job.Seq - 1) / rows % n
+	}
+}
+
+// validateOrdered checks the options -ordered relies on: fixed batches of consecutive rows which are committed
+// when they are executed, dealt out to all workers
+func (c *Config) validateOrdered() error {
+	if !c.Ordered {
+		return nil
+	}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"adaptive-batch", c.AdaptiveBatch}, {"auto-tune", c.AutoTune}, {"commit-every", c.CommitEvery > 0},
+		{"route", len(c.Routes) > 0}, {"shard", len(c.Shards) > 0}, {"partition-by-worker", c.PartitionBy != ""},
+		{"shard-jobs", c.ShardJobs}, {"mode load-data", c.Mode == ModeLoadData}} {
+		if f.set {
+			return fmt.Errorf("-%s can't be combined with -ordered", f.name)
+		}
+	}
+	return nil
+}
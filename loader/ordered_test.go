@@ -0,0 +1,81 @@
+package loader
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestOrderedCommits(t *testing.T) {
+	o := newOrderedCommits()
+	assert.Equal(t, o.Number(), 1)
+	assert.Equal(t, o.Number(), 2)
+	assert.NilError(t, o.Wait(context.Background(), 1))
+
+	turn := make(chan error)
+	go func() { turn <- o.Wait(context.Background(), 3) }()
+	select {
+	case err := <-turn:
+		t.Fatalf("the batch from row 3 got its turn before rows 1 and 2 are done: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	o.Done(2)
+	assert.NilError(t, <-turn)
+
+	go func() { turn <- o.Wait(context.Background(), 5) }()
+	o.Abort()
+	assert.ErrorIs(t, <-turn, errOrderAborted)
+
+	var none *orderedCommits
+	assert.Equal(t, none.Number(), 0)
+	assert.NilError(t, none.Wait(context.Background(), 7))
+}
+
+func TestByBlock(t *testing.T) {
+	pick := byBlock(2, 3)
+	var shards []int
+	for seq := 1; seq <= 8; seq++ {
+		shards = append(shards, pick(Job{Seq: seq}))
+	}
+	assert.DeepEqual(t, shards, []int{0, 0, 1, 1, 2, 2, 0, 0})
+}
+
+func TestOrderedImport(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ranks.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("domain\na.com\nb.com\nc.com\nd.com\ne.com\nf.com\ng.com\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-table", "ranks", "-dialect", "sqlite", "-workers", "3", "-batch-size", "2", "-ordered"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	// the expectations are matched in order, whichever worker has the batch
+	for _, batch := range [][]string{{"a.com", "b.com"}, {"c.com", "d.com"}, {"e.com", "f.com"}, {"g.com"}} {
+		query := `INSERT INTO "ranks" ("domain") VALUES ` + strings.TrimSuffix(strings.Repeat("(?), ", len(batch)), ", ")
+		args := make([]driver.Value, len(batch))
+		for i, v := range batch {
+			args[i] = v
+		}
+		mock.ExpectExec(query).WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, int64(len(batch))))
+	}
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.RowsInserted, int64(7))
+
+	for want, args := range map[string][]string{
+		"-adaptive-batch can't be combined with -ordered": {"-ordered", "-adaptive-batch"},
+		"-commit-every can't be combined with -ordered":   {"-ordered", "-commit-every", "10"},
+		"-shard-jobs can't be combined with -ordered":     {"-ordered", "-shard-jobs"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want)
+	}
+}
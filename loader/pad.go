@@ -0,0 +1,116 @@
+package loader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// PadSpec describes how the values of a (fixed width CHAR) column get padded, given as col=len:char:side
+type PadSpec struct {
+	Column string
+	Length int
+	Char   string
+	Left   bool
+	// index of the column in the row, set by Config.ResolveColumns
+	index int
+}
+
+// ParsePadSpec parses a padding spec like "code=10: :left" or "code=10:0:right",
+// char and side are optional and default to space and right
+func ParsePadSpec(spec string) (PadSpec, error) {
+	p := PadSpec{Char: " "}
+	column, format, found := strings.Cut(spec, "=")
+	if !found || column == "" {
+		return p, fmt.Errorf("invalid pad spec '%s', expected col=len:char:side", spec)
+	}
+	p.Column = column
+
+	length, rest, _ := strings.Cut(format, ":")
+	n, err := strconv.Atoi(length)
+	if err != nil || n <= 0 {
+		return p, fmt.Errorf("invalid pad length '%s' in '%s'", length, spec)
+	}
+	p.Length = n
+
+	if rest != "" {
+		char, side := rest, ""
+		if i := strings.LastIndex(rest, ":"); i >= 0 {
+			char, side = rest[:i], rest[i+1:]
+		}
+		if char != "" {
+			if utf8.RuneCountInString(char) != 1 {
+				return p, fmt.Errorf("invalid pad char '%s' in '%s', must be a single character", char, spec)
+			}
+			p.Char = char
+		}
+		switch strings.ToLower(side) {
+		case "", "right":
+		case "left":
+			p.Left = true
+		default:
+			return p, fmt.Errorf("invalid pad side '%s' in '%s', must be left or right", side, spec)
+		}
+	}
+	return p, nil
+}
+
+// Pad pads value to the spec's length counted in characters (not bytes), values which are already
+// too long for the column are returned unchanged together with an error
+func (p PadSpec) Pad(value string) (string, error) {
+	n := utf8.RuneCountInString(value)
+	if n > p.Length {
+		return value, fmt.Errorf("value '%s' of column %s exceeds length %d", value, p.Column, p.Length)
+	}
+	padding := strings.Repeat(p.Char, p.Length-n)
+	if p.Left {
+		return padding + value, nil
+	}
+	return value + padding, nil
+}
+
+// padRow applies the -pad specs to the values of a row as they are inserted, NULLs are left alone. A value too long
+// for its column fails the row.
+func (c *Config) padRow(row []string) error {
+	for _, p := range c.Pads {
+		if p.index >= len(row) || c.headerNull(p.index, row[p.index]) {
+			continue
+		}
+		padded, err := p.Pad(row[p.index])
+		if err != nil {
+			return err
+		}
+		row[p.index] = padded
+	}
+	return nil
+}
+
+// padFlag collects repeated -pad flags
+type padFlag struct {
+	pads *[]PadSpec
+}
+
+func (f padFlag) String() string {
+	if f.pads == nil {
+		return ""
+	}
+	specs := make([]string, len(*f.pads))
+	for i, p := range *f.pads {
+		side := "right"
+		if p.Left {
+			side = "left"
+		}
+		specs[i] = fmt.Sprintf("%s=%d:%s:%s", p.Column, p.Length, p.Char, side)
+	}
+	return strings.Join(specs, ",")
+}
+
+func (f padFlag) Set(value string) error {
+	p, err := ParsePadSpec(value)
+	if err != nil {
+		return err
+	}
+	*f.pads = append(*f.pads, p)
+	return nil
+}
@@ -0,0 +1,128 @@
+package loader
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+)
+
+var cmpPadSpec = cmp.AllowUnexported(PadSpec{})
+
+func TestParsePadSpec(t *testing.T) {
+	p, err := ParsePadSpec("code=5")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p, PadSpec{Column: "code", Length: 5, Char: " "}, cmpPadSpec)
+
+	p, err = ParsePadSpec("code=5:0:left")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p, PadSpec{Column: "code", Length: 5, Char: "0", Left: true}, cmpPadSpec)
+
+	p, err = ParsePadSpec("code=5: :right")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p, PadSpec{Column: "code", Length: 5, Char: " "}, cmpPadSpec)
+
+	p, err = ParsePadSpec("code=5:::left")
+	assert.NilError(t, err)
+	assert.Equal(t, p.Char, ":")
+
+	for _, spec := range []string{"code", "=5", "code=x", "code=0", "code=5:ab:left", "code=5: :middle"} {
+		_, err = ParsePadSpec(spec)
+		assert.Assert(t, err != nil, "spec %s should be invalid", spec)
+	}
+}
+
+func TestPadRightAndLeft(t *testing.T) {
+	right := PadSpec{Column: "c", Length: 5, Char: " "}
+	v, err := right.Pad("ab")
+	assert.NilError(t, err)
+	assert.Equal(t, v, "ab   ")
+
+	left := PadSpec{Column: "c", Length: 5, Char: "0", Left: true}
+	v, err = left.Pad("42")
+	assert.NilError(t, err)
+	assert.Equal(t, v, "00042")
+}
+
+func TestPadMultibyte(t *testing.T) {
+	p := PadSpec{Column: "c", Length: 4, Char: "·"}
+	v, err := p.Pad("äö")
+	assert.NilError(t, err)
+	assert.Equal(t, v, "äö··")
+
+	// length is counted in characters, "ääää" is 8 bytes but fits
+	v, err = p.Pad("ääää")
+	assert.NilError(t, err)
+	assert.Equal(t, v, "ääää")
+
+	v, err = p.Pad("äääää")
+	assert.ErrorContains(t, err, "exceeds length 4")
+	assert.Equal(t, v, "äääää", "too long values are kept unchanged")
+}
+
+func TestProcessCSVFilePad(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-pad", "code=4:0:left", "-pad", "name=6"})
+	assert.NilError(t, err)
+	assert.NilError(t, l.config.ResolveColumns([]string{"name", "code"}))
+
+	reader := csv.NewReader(strings.NewReader("abc,7\nxy,123\n"))
+	jobs := make(chan Job, 10)
+	l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"abc   ", "0007"}, {"xy    ", "0123"}})
+}
+
+func TestProcessCSVFilePadAfterTransforms(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-pad", "code=4:0:left", "-pad", "name=6", "-transform", "name=trim|upper", "-empty-as-null",
+		"-max-errors", "1"})
+	assert.NilError(t, err)
+	assert.NilError(t, l.config.ResolveColumns([]string{"name", "code"}))
+	l.errorBudget = NewErrorBudget(l.config.MaxErrors, 0, 0)
+
+	// the trimmed value is padded, an empty one stays NULL and a value too long fails its row
+	reader := csv.NewReader(strings.NewReader(" abc ,7\nxy,\nlonger,12345\n"))
+	jobs := make(chan Job, 10)
+	rows, _, err := l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	assert.NilError(t, err)
+	close(jobs)
+	assert.Equal(t, rows, 3)
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"ABC   ", "0007"}, {"XY    ", ""}})
+	assert.Equal(t, l.errorBudget.Total(), 1)
+}
+
+func TestProcessCSVFilePadDeadLetter(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-pad", "code=2"})
+	assert.NilError(t, err)
+	assert.NilError(t, l.config.ResolveColumns([]string{"name", "code"}))
+	filename := filepath.Join(t.TempDir(), "failed.csv")
+	l.deadLetter, err = OpenDeadLetter(filename, []string{"name", "code"}, l.config.Delimiter)
+	assert.NilError(t, err)
+
+	reader := csv.NewReader(strings.NewReader("a,1\nb,123\n"))
+	jobs := make(chan Job, 10)
+	_, _, err = l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	assert.NilError(t, err)
+	close(jobs)
+	assert.NilError(t, l.deadLetter.Close())
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"a", "1 "}})
+	content, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(content), "value '123' of column code exceeds length 2"), string(content))
+}
+
+func TestResolvePadUnknownColumn(t *testing.T) {
+	c, err := ParseFlags([]string{"-pad", "missing=4"})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.ResolveColumns([]string{"name", "code"}), "unknown column 'missing'")
+}
@@ -0,0 +1,245 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"sync"
+)
+
+// parseChunkSize is the size of the chunks of input the parse workers get, a record which is longer makes a
+// longer chunk
+var parseChunkSize = 1 << 20
+
+// parallelReader parses a CSV input with several goroutines: the input is split into chunks at record boundaries
+// (newlines outside of quotes) by a goroutine of its own and the chunks are parsed by the parse workers, the rows
+// are returned in the order of the input nevertheless. It needs strict quoting, a quote in an unquoted field
+// (which is malformed anyway) can make it split a quoted field, so the rows around it may come out differently
+// than they would from a single csv.Reader.
+type parallelReader struct {
+	// ordered are the chunks in the order of the input, each is returned once its done channel is closed
+	ordered chan *parseChunk
+	chunk   *parseChunk
+	next    int
+	offset  int64
+	line    int
+	stop    chan struct{}
+	once    sync.Once
+	// parsing are the parse workers, the splitter may be blocked reading the input and isn't waited for
+	parsing sync.WaitGroup
+	// size and comment are the chunk size and the -comment when the reader was created
+	size    int
+	comment rune
+}
+
+// parseChunk is a piece of the input with whole records
+type parseChunk struct {
+	data []byte
+	// offset and line are where the chunk starts in the input
+	offset int64
+	line   int
+	// err is the error reading the input after the chunk, returned once its records are read
+	err     error
+	records []parsedRecord
+	done    chan struct{}
+}
+
+// parsedRecord is a record of a chunk, with the line it starts and the input offset after it
+type parsedRecord struct {
+	row    []string
+	err    error
+	line   int
+	offset int64
+}
+
+// newParallelReader starts parsing r with workers goroutines
+func (c *Config) newParallelReader(r io.Reader, workers int) *parallelReader {
+	p := &parallelReader{ordered: make(chan *parseChunk, 2*workers), stop: make(chan struct{}), size: parseChunkSize, comment: c.Comment}
+	work := make(chan *parseChunk, workers)
+	go p.split(r, work)
+	p.parsing.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.parsing.Done()
+			for {
+				select {
+				case chunk, ok := <-work:
+					if !ok {
+						return
+					}
+					chunk.parse(c.newCSVReader)
+					close(chunk.done)
+				case <-p.stop:
+					return
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// split reads r into chunks ending at a record boundary and hands them to the workers and the reader
+func (p *parallelReader) split(r io.Reader, work chan<- *parseChunk) {
+	defer close(p.ordered)
+	defer close(work)
+	var rest []byte
+	var offset int64
+	line := 1
+	inQuotes := false
+	// scanned is how far rest was scanned for the record boundaries already
+	scanned := 0
+	atLineStart := true
+	for {
+		buf := make([]byte, len(rest), len(rest)+p.size)
+		copy(buf, rest)
+		n, err := io.ReadFull(r, buf[len(rest):cap(buf)])
+		buf = buf[:len(rest)+n]
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		var end int
+		end, scanned, inQuotes, atLineStart = recordBoundary(buf, scanned, inQuotes, atLineStart, p.comment)
+		if err == nil && end < 0 {
+			// a record longer than the chunk, it is read on
+			rest = buf
+			continue
+		}
+		if err != nil {
+			end = len(buf)
+		}
+		chunk := &parseChunk{data: buf[:end], offset: offset, line: line, done: make(chan struct{})}
+		if err != nil && err != io.EOF {
+			chunk.err = err
+		}
+		offset += int64(end)
+		line += bytes.Count(chunk.data, []byte{'\n'})
+		rest = buf[end:]
+		scanned -= end
+		if !p.send(chunk, work) || err != nil {
+			return
+		}
+	}
+}
+
+// send hands chunk to a worker and queues it for the reader, false if the reader was closed
+func (p *parallelReader) send(chunk *parseChunk, work chan<- *parseChunk) bool {
+	select {
+	case p.ordered <- chunk:
+	case <-p.stop:
+		return false
+	}
+	select {
+	case work <- chunk:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// recordBoundary scans buf from start on and returns the end of the last complete record (after its newline) or
+// -1, how far it scanned and the quote and line state there. A line starting with comment doesn't change the quote
+// state.
+func recordBoundary(buf []byte, start int, inQuotes bool, atLineStart bool, comment rune) (int, int, bool, bool) {
+	end := -1
+	prefix := []byte(string(comment))
+	for i := start; i < len(buf); i++ {
+		if atLineStart && !inQuotes && comment != 0 && bytes.HasPrefix(buf[i:], prefix) {
+			j := bytes.IndexByte(buf[i:], '\n')
+			if j < 0 {
+				// the rest of the comment is scanned again with more input
+				return end, i, inQuotes, atLineStart
+			}
+			i += j
+			end = i + 1
+			continue
+		}
+		atLineStart = false
+		switch buf[i] {
+		case '"':
+			inQuotes = !inQuotes
+		case '\n':
+			if !inQuotes {
+				end = i + 1
+				atLineStart = true
+			}
+		}
+	}
+	return end, len(buf), inQuotes, atLineStart
+}
+
+// parse parses the records of the chunk with a reader of newReader, a malformed record is returned with its error
+func (c *parseChunk) parse(newReader func(io.Reader) *csv.Reader) {
+	reader := newReader(bytes.NewReader(c.data))
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return
+		}
+		var parseErr *csv.ParseError
+		line := 0
+		if errors.As(err, &parseErr) {
+			// the lines of the error are the ones of the input
+			shifted := *parseErr
+			shifted.StartLine += c.line - 1
+			shifted.Line += c.line - 1
+			err, line = &shifted, shifted.StartLine
+		} else if err != nil {
+			c.records = append(c.records, parsedRecord{err: err})
+			return
+		} else {
+			line, _ = reader.FieldPos(0)
+			line += c.line - 1
+		}
+		c.records = append(c.records, parsedRecord{row: row, err: err, line: line, offset: c.offset + reader.InputOffset()})
+	}
+}
+
+func (p *parallelReader) Read() ([]string, error) {
+	for p.chunk == nil || p.next >= len(p.chunk.records) {
+		if p.chunk != nil && p.chunk.err != nil {
+			err := p.chunk.err
+			p.chunk.err = nil
+			return nil, err
+		}
+		chunk, ok := <-p.ordered
+		if !ok {
+			return nil, io.EOF
+		}
+		<-chunk.done
+		p.chunk, p.next = chunk, 0
+		p.offset = chunk.offset
+	}
+	record := p.chunk.records[p.next]
+	p.next++
+	p.offset, p.line = record.offset, record.line
+	return record.row, record.err
+}
+
+func (p *parallelReader) InputOffset() int64 {
+	return p.offset
+}
+
+// FieldPos returns the line the last record read starts, the column isn't known
+func (p *parallelReader) FieldPos(int) (int, int) {
+	return p.line, 0
+}
+
+// Close stops the goroutines of a reader which isn't read to the end, it waits for the parse workers
+func (p *parallelReader) Close() error {
+	p.once.Do(func() { close(p.stop) })
+	p.parsing.Wait()
+	return nil
+}
+
+// closeRowReader stops the parsing of a parallel reader, the other readers are left alone
+func closeRowReader(reader RowReader) {
+	switch r := reader.(type) {
+	case *firstRowReader:
+		closeRowReader(r.RowReader)
+	case *parallelReader:
+		r.Close()
+	case *rangeReader:
+		r.Close()
+	}
+}
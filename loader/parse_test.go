@@ -0,0 +1,132 @@
+package loader
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// parallelInput has quoted fields with newlines and delimiters, escaped quotes and comments
+func parallelInput(rows int) string {
+	var b strings.Builder
+	b.WriteString("GlobalRank,Domain,Note\n")
+	for i := 1; i <= rows; i++ {
+		switch i % 4 {
+		case 0:
+			fmt.Fprintf(&b, "%d,domain%d.com,\"multi\nline, \"\"quoted\"\"\"\n", i, i)
+		case 1:
+			fmt.Fprintf(&b, "# comment with a \" quote\n%d,domain%d.com,plain\n", i, i)
+		default:
+			fmt.Fprintf(&b, "%d,\"domain%d.com\",\r\n", i, i)
+		}
+	}
+	return b.String()
+}
+
+func TestParallelReader(t *testing.T) {
+	l := withConnConfig(t, 5)
+	defer func(size int) { parseChunkSize = size }(parseChunkSize)
+	l.config.Comment = '#'
+	input := parallelInput(1000)
+	want, err := l.config.newCSVReader(strings.NewReader(input)).ReadAll()
+	assert.NilError(t, err)
+	for _, size := range []int{7, 64, 4096} {
+		parseChunkSize = size
+		reader := l.config.newParallelReader(strings.NewReader(input), 4)
+		var rows [][]string
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			assert.NilError(t, err)
+			rows = append(rows, row)
+		}
+		assert.DeepEqual(t, rows, want)
+		assert.Equal(t, reader.InputOffset(), int64(len(input)))
+	}
+}
+
+func TestParallelReaderMalformed(t *testing.T) {
+	l := withConnConfig(t, 5)
+	defer func(size int) { parseChunkSize = size }(parseChunkSize)
+	parseChunkSize = 16
+	reader := l.config.newParallelReader(strings.NewReader("a,b\n1,2\n3,\"x\"y\"\n5,6\n"), 2)
+	var lines []int
+	var parseErr *csv.ParseError
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		lines = append(lines, line)
+		if err != nil {
+			assert.Assert(t, errors.As(err, &parseErr))
+			assert.Equal(t, parseErr.Line, 3)
+			continue
+		}
+		assert.Equal(t, len(row), 2)
+	}
+	assert.DeepEqual(t, lines, []int{1, 2, 3, 4})
+}
+
+func TestParallelReaderClose(t *testing.T) {
+	l := withConnConfig(t, 5)
+	defer func(size int) { parseChunkSize = size }(parseChunkSize)
+	parseChunkSize = 8
+	reader := l.config.newParallelReader(strings.NewReader(parallelInput(1000)), 2)
+	_, err := reader.Read()
+	assert.NilError(t, err)
+	// the goroutines blocked on the full queue exit
+	closeRowReader(&firstRowReader{RowReader: reader})
+	assert.NilError(t, reader.Close())
+}
+
+func TestImportParseWorkers(t *testing.T) {
+	l := withConnConfig(t, 5)
+	var err error
+	l.config, err = ParseFlags([]string{"-dry-run", "-parse-workers", "4", "-workers", "2", "-comment", "#"})
+	assert.NilError(t, err)
+	stats, err := New(nil, l.config).RunReader(context.Background(), strings.NewReader(parallelInput(500)))
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsRead, int64(500))
+	assert.Equal(t, stats.RowsInserted, int64(500))
+
+	_, err = ParseFlags([]string{"-parse-workers", "4", "-lazy-quotes"})
+	assert.ErrorContains(t, err, "-parse-workers requires -input-format csv with strict quotes")
+}
+
+func BenchmarkParseSingle(b *testing.B) {
+	benchmarkParse(b, 0)
+}
+
+func BenchmarkParseParallel(b *testing.B) {
+	benchmarkParse(b, runtime.GOMAXPROCS(0))
+}
+
+func benchmarkParse(b *testing.B, workers int) {
+	var c Config
+	var input strings.Builder
+	for i := 0; i < b.N; i++ {
+		input.WriteString(`1,1,google.com,com,193,0,"a ""quoted"" value",1,google.com,com,42,23` + "\n")
+	}
+	var reader RowReader = c.newCSVReader(strings.NewReader(input.String()))
+	if workers > 0 {
+		reader = c.newParallelReader(strings.NewReader(input.String()), workers)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for {
+		if _, err := reader.Read(); err == io.EOF {
+			break
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package loader
+
+import (
+	"context"
+	"sync"
+)
+
+// PauseGate holds the reader and the workers while the import is paused, e.g. to take load off the server for
+// a while without losing the progress. It is safe for concurrent use.
+type PauseGate struct {
+	mu sync.Mutex
+	// resumed is closed when a pause ends, nil while running
+	resumed chan struct{}
+}
+
+// pauseGate is the gate of the running import, it outlives a single run like the signals controlling it
+var pauseGate = &PauseGate{}
+
+// Pause pauses the import: no more rows are read and no more batches are started, the batches running are finished.
+// It returns false when the import is paused already.
+func Pause() bool {
+	return pauseGate.Pause()
+}
+
+// Resume continues a paused import, it returns false when the import isn't paused
+func Resume() bool {
+	return pauseGate.Resume()
+}
+
+// Pause closes the gate, it returns false when it is closed already
+func (g *PauseGate) Pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		return false
+	}
+	g.resumed = make(chan struct{})
+	return true
+}
+
+// Resume opens the gate, it returns false when it is open already
+func (g *PauseGate) Resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed == nil {
+		return false
+	}
+	close(g.resumed)
+	g.resumed = nil
+	return true
+}
+
+// Wait waits while the gate is closed, it fails when ctx is done first
+func (g *PauseGate) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
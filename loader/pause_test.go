@@ -0,0 +1,44 @@
+package loader
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPauseGate(t *testing.T) {
+	g := &PauseGate{}
+	assert.NilError(t, g.Wait(context.Background()))
+	assert.Assert(t, !g.Resume(), "not paused")
+	assert.Assert(t, g.Pause())
+	assert.Assert(t, !g.Pause(), "paused already")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, g.Wait(ctx), context.DeadlineExceeded)
+
+	waited := make(chan error)
+	go func() { waited <- g.Wait(context.Background()) }()
+	assert.Assert(t, g.Resume())
+	assert.NilError(t, <-waited)
+}
+
+func TestProcessCSVFilePaused(t *testing.T) {
+	l := newTestLoader()
+	assert.Assert(t, Pause())
+	defer Resume()
+
+	jobs := make(chan Job, 10)
+	read := make(chan int)
+	go func() {
+		n, _, _ := l.ProcessCSVFile(context.Background(), l.config.newCSVReader(strings.NewReader("a.com\nb.com\n")), jobs, 0, 0, 100)
+		read <- n
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, len(jobs), 0, "no row is read while paused")
+	assert.Assert(t, Resume())
+	assert.Equal(t, <-read, 2)
+}
@@ -0,0 +1,366 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// IDMapping replaces the values of the CSV column Column, the keys of parent rows loaded before, by the ids the
+// database generated for them: the id column ID of the row of Table whose column Key has the value
+type IDMapping struct {
+	Column string
+	Table  string
+	Key    string
+	ID     string
+}
+
+// ParseIDMapping parses an id mapping given as column=table:key[:id], id defaults to id
+func ParseIDMapping(s string) (IDMapping, error) {
+	column, target, ok := strings.Cut(s, "=")
+	parts := strings.Split(target, ":")
+	if !ok || column == "" || len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return IDMapping{}, fmt.Errorf("invalid map-id '%s', must be column=table:key[:id]", s)
+	}
+	m := IDMapping{Column: column, Table: parts[0], Key: parts[1], ID: "id"}
+	if len(parts) == 3 && parts[2] != "" {
+		m.ID = parts[2]
+	}
+	return m, nil
+}
+
+func (m IDMapping) String() string {
+	return m.Column + "=" + m.Table + ":" + m.Key + ":" + m.ID
+}
+
+// lookup returns the -lookup query of the mapping
+func (m IDMapping) lookup(d Dialect) string {
+	var table []string
+	for _, part := range strings.Split(m.Table, ".") {
+		table = append(table, d.QuoteIdentifier(part))
+	}
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", d.QuoteIdentifier(m.ID), strings.Join(table, "."), d.QuoteIdentifier(m.Key))
+}
+
+type idMappingFlag struct {
+	mappings *[]IDMapping
+}
+
+func (f idMappingFlag) String() string {
+	if f.mappings == nil {
+		return ""
+	}
+	specs := make([]string, len(*f.mappings))
+	for i, m := range *f.mappings {
+		specs[i] = m.String()
+	}
+	return strings.Join(specs, " ")
+}
+
+func (f idMappingFlag) Set(value string) error {
+	m, err := ParseIDMapping(value)
+	if err != nil {
+		return err
+	}
+	*f.mappings = append(*f.mappings, m)
+	return nil
+}
+
+// resolveIDMappings turns the -map-id options into the lookups of their columns
+func (c *Config) resolveIDMappings() error {
+	for _, m := range c.IDMappings {
+		for _, name := range []string{m.Key, m.ID} {
+			if err := c.checkIdentifier("column", name); err != nil {
+				return fmt.Errorf("map-id %s: %w", m, err)
+			}
+		}
+		query := m.lookup(c.dialect())
+		if existing, ok := c.Lookups[m.Column]; ok && existing != query {
+			return fmt.Errorf("-map-id %s can't be combined with a -lookup of the same column", m)
+		}
+		if c.Lookups == nil {
+			c.Lookups = map[string]string{}
+		}
+		c.Lookups[m.Column] = query
+	}
+	return nil
+}
+
+// validatePlan checks the tables of the -config file
+func (c *Config) validatePlan() error {
+	if len(c.Tables) == 0 {
+		if len(c.DependsOn) > 0 {
+			return fmt.Errorf("-depends-on requires the tables of a -config file")
+		}
+		return nil
+	}
+	if c.WatchDir != "" {
+		return fmt.Errorf("-watch-dir can't be combined with the tables of a config file")
+	}
+	tables := make([]string, len(c.Tables))
+	for i, t := range c.Tables {
+		if slices.Contains(tables[:i], t.Table) {
+			return fmt.Errorf("table %s is loaded twice by the config file", t.Table)
+		}
+		// the tables share the connection of the top-level flags
+		if len(t.Shards) > 0 || len(c.Shards) > 0 {
+			return fmt.Errorf("-shard can't be combined with the tables of a config file")
+		}
+		tables[i] = t.Table
+	}
+	for _, t := range c.Tables {
+		for _, parent := range t.DependsOn {
+			if !slices.Contains(tables, parent) {
+				return fmt.Errorf("table %s depends on %s, which isn't a table of the config file", t.Table, parent)
+			}
+		}
+	}
+	return nil
+}
+
+// ForeignKey is a foreign key constraint of Table whose Columns reference RefColumns of RefTable
+type ForeignKey struct {
+	Name       string
+	Table      string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+}
+
+func (fk ForeignKey) String() string {
+	return fmt.Sprintf("%s (%s) referencing %s (%s)", fk.Name, strings.Join(fk.Columns, ", "), fk.RefTable, strings.Join(fk.RefColumns, ", "))
+}
+
+// ForeignKeys returns the foreign keys of the tables of the current database (MySQL only)
+func ForeignKeys(ctx context.Context, db *sql.DB, tables []string) ([]ForeignKey, error) {
+	if len(tables) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(tables))
+	for i, t := range tables {
+		args[i] = t
+	}
+	rows, err := db.QueryContext(ctx, "SELECT CONSTRAINT_NAME, TABLE_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME "+
+		"FROM information_schema.KEY_COLUMN_USAGE WHERE TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_NAME IS NOT NULL "+
+		"AND TABLE_NAME IN (?"+strings.Repeat(", ?", len(tables)-1)+") ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var fks []ForeignKey
+	for rows.Next() {
+		var name, table, column, refTable, refColumn string
+		if err = rows.Scan(&name, &table, &column, &refTable, &refColumn); err != nil {
+			return nil, err
+		}
+		if n := len(fks); n > 0 && fks[n-1].Name == name && fks[n-1].Table == table {
+			fks[n-1].Columns = append(fks[n-1].Columns, column)
+			fks[n-1].RefColumns = append(fks[n-1].RefColumns, refColumn)
+			continue
+		}
+		fks = append(fks, ForeignKey{Name: name, Table: table, Columns: []string{column}, RefTable: refTable, RefColumns: []string{refColumn}})
+	}
+	return fks, rows.Err()
+}
+
+// ValidateForeignKeys checks the rows of the tables against their foreign keys, e.g. after loading them with
+// -defer-fk-checks, and returns an error for the first key some rows violate
+func ValidateForeignKeys(ctx context.Context, db *sql.DB, d Dialect, tables []string) error {
+	fks, err := ForeignKeys(ctx, db, tables)
+	if err != nil {
+		return fmt.Errorf("could not read the foreign keys: %w", err)
+	}
+	for _, fk := range fks {
+		var notNull, matches []string
+		for i, column := range fk.Columns {
+			notNull = append(notNull, "c."+quoteIdentifier(d, column)+" IS NOT NULL")
+			matches = append(matches, "p."+quoteIdentifier(d, fk.RefColumns[i])+" = c."+quoteIdentifier(d, column))
+		}
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s c WHERE %s AND NOT EXISTS (SELECT 1 FROM %s p WHERE %s)",
+			quoteTable(d, fk.Table), strings.Join(notNull, " AND "), quoteTable(d, fk.RefTable), strings.Join(matches, " AND "))
+		var orphans int64
+		if err = db.QueryRowContext(ctx, query).Scan(&orphans); err != nil {
+			return fmt.Errorf("could not check foreign key %s of table %s: %w", fk.Name, fk.Table, err)
+		}
+		if orphans > 0 {
+			return fmt.Errorf("%d rows of table %s violate foreign key %s", orphans, fk.Table, fk)
+		}
+		log.Printf("Checked foreign key %s of table %s", fk.Name, fk.Table)
+	}
+	return nil
+}
+
+// TableStats are the Stats of a table loaded by a Plan
+type TableStats struct {
+	Table string
+	Stats
+}
+
+// Plan loads the tables of a -config file one after another, the parent tables before the child tables
+// referencing them: by -depends-on, -map-id and (with MySQL) the foreign keys of the tables. With -defer-fk-checks
+// the foreign keys may form a cycle, the rows are checked against them once all tables are loaded.
+type Plan struct {
+	db     *sql.DB
+	config Config
+}
+
+// NewPlan loads the Tables of c into db
+func NewPlan(db *sql.DB, c Config) *Plan {
+	return &Plan{db: db, config: c}
+}
+
+// Run loads the tables in the order of their dependencies and returns their stats in that order, it stops at the
+// first table failing
+func (p *Plan) Run(ctx context.Context) ([]TableStats, error) {
+	order, err := p.order(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for _, i := range order {
+		tables = append(tables, p.config.Tables[i].Table)
+	}
+	log.Printf("Loading the tables in the order %s", strings.Join(tables, ", "))
+	var results []TableStats
+	var deferred []string
+	for n, i := range order {
+		c := p.config.Tables[i]
+		log.Printf("Loading table %s (%d of %d)", c.Table, n+1, len(order))
+		l := New(p.db, c)
+		// the referenced tables of a cycle are loaded later, the keys are checked once all of them are
+		l.skipFKValidation = true
+		stats, err := l.Run(ctx)
+		results = append(results, TableStats{Table: c.Table, Stats: stats})
+		if err != nil {
+			return results, fmt.Errorf("loading table %s failed: %w", c.Table, err)
+		}
+		log.Printf("Loaded table %s: %d of %d rows inserted", c.Table, stats.RowsInserted, stats.RowsRead)
+		if c.DeferFKChecks && !c.DryRun {
+			deferred = append(deferred, c.Table)
+		}
+	}
+	if err = ValidateForeignKeys(ctx, p.db, p.config.dialect(), deferred); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// order returns the indexes of the tables sorted so that every table comes after the ones it depends on, keeping
+// the order of the config file otherwise. The foreign keys are left out when they form a cycle and every table
+// defers its checks.
+func (p *Plan) order(ctx context.Context) ([]int, error) {
+	tables := p.config.Tables
+	index := make(map[string]int, len(tables))
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		index[t.Table] = i
+		names[i] = t.Table
+	}
+	explicit := make([][]int, len(tables))
+	for i, t := range tables {
+		for _, parent := range t.DependsOn {
+			explicit[i] = append(explicit[i], index[parent])
+		}
+		for _, m := range t.IDMappings {
+			if parent, ok := index[m.Table]; ok && parent != i {
+				explicit[i] = append(explicit[i], parent)
+			}
+		}
+	}
+	byKeys := make([][]int, len(tables))
+	if p.db != nil && !p.config.DryRun && p.config.isMySQL() {
+		fks, err := ForeignKeys(ctx, p.db, names)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the foreign keys to order the tables: %w", err)
+		}
+		for _, fk := range fks {
+			child, ok := index[fk.Table]
+			if parent, found := index[fk.RefTable]; ok && found && parent != child {
+				byKeys[child] = append(byKeys[child], parent)
+			}
+		}
+	}
+	both := make([][]int, len(tables))
+	for i := range tables {
+		both[i] = slices.Concat(explicit[i], byKeys[i])
+	}
+	order, cycle := sortDependencies(both)
+	if cycle == nil {
+		return order, nil
+	}
+	if order, explicitCycle := sortDependencies(explicit); explicitCycle != nil {
+		return nil, fmt.Errorf("the -depends-on and -map-id of tables %s form a cycle", strings.Join(pick(names, explicitCycle), ", "))
+	} else if !slices.ContainsFunc(tables, func(t Config) bool { return !t.DeferFKChecks }) {
+		log.Warnf("The foreign keys of tables %s form a cycle, the tables are loaded in the order of the config file", strings.Join(pick(names, cycle), ", "))
+		return order, nil
+	}
+	return nil, fmt.Errorf("the foreign keys of tables %s form a cycle, load them with -defer-fk-checks", strings.Join(pick(names, cycle), ", "))
+}
+
+// sortDependencies sorts the nodes 0..len(parents)-1 topologically, the ready node first in the order of the
+// nodes, and otherwise returns the nodes left in a cycle (or depending on one)
+func sortDependencies(parents [][]int) (order []int, cycle []int) {
+	done := make([]bool, len(parents))
+	for len(order) < len(parents) {
+		next := -1
+		for i, ps := range parents {
+			if !done[i] && !slices.ContainsFunc(ps, func(p int) bool { return !done[p] }) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			for i := range parents {
+				if !done[i] {
+					cycle = append(cycle, i)
+				}
+			}
+			return order, cycle
+		}
+		done[next] = true
+		order = append(order, next)
+	}
+	return order, nil
+}
+
+// pick returns the values at the indexes
+func pick(values []string, indexes []int) []string {
+	picked := make([]string, len(indexes))
+	for i, n := range indexes {
+		picked[i] = values[n]
+	}
+	return picked
+}
+
+// Total returns the stats of several tables added up
+func Total(tables []TableStats) Stats {
+	var total Stats
+	for _, t := range tables {
+		total.RowsRead += t.RowsRead
+		total.RowsInserted += t.RowsInserted
+		total.BatchesExecuted += t.BatchesExecuted
+		total.RowsReplayed += t.RowsReplayed
+		total.RowsDeadLettered += t.RowsDeadLettered
+		total.RowsFailed += t.RowsFailed
+		total.RowsDeduped += t.RowsDeduped
+		total.RowsUnrouted += t.RowsUnrouted
+		total.RowsUnsampled += t.RowsUnsampled
+		total.RowsSkipped += t.RowsSkipped
+		total.RowsRejected += t.RowsRejected
+		total.BytesRead += t.BytesRead
+		total.Duration += t.Duration
+		total.AbandonedFiles = append(total.AbandonedFiles, t.AbandonedFiles...)
+		total.Inputs = append(total.Inputs, t.Inputs...)
+		for reason, n := range t.Errors {
+			if total.Errors == nil {
+				total.Errors = map[string]int64{}
+			}
+			total.Errors[reason] += n
+		}
+	}
+	return total
+}
@@ -0,0 +1,194 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+const foreignKeysQuery = "SELECT CONSTRAINT_NAME, TABLE_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME " +
+	"FROM information_schema.KEY_COLUMN_USAGE WHERE TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_NAME IS NOT NULL " +
+	"AND TABLE_NAME IN (?, ?, ?) ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION"
+
+func TestParseIDMapping(t *testing.T) {
+	m, err := ParseIDMapping("customer_id=customers:legacy_id")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, m, IDMapping{Column: "customer_id", Table: "customers", Key: "legacy_id", ID: "id"})
+	assert.Equal(t, m.lookup(mysqlDialect{}), "SELECT `id` FROM `customers` WHERE `legacy_id` = ?")
+	m, err = ParseIDMapping("shop=crm.shops:code:shop_id")
+	assert.NilError(t, err)
+	assert.Equal(t, m.lookup(sqliteDialect{}), `SELECT "shop_id" FROM "crm"."shops" WHERE "code" = ?`)
+	for _, s := range []string{"customers:legacy_id", "customer_id=customers", "=customers:legacy_id", "a=b:c:d:e"} {
+		_, err := ParseIDMapping(s)
+		assert.ErrorContains(t, err, "invalid map-id '"+s+"'")
+	}
+
+	c, err := ParseFlags([]string{"-map-id", "customer_id=customers:legacy_id", "-dead-letter-file", "dead.csv"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.Lookups["customer_id"], "SELECT `id` FROM `customers` WHERE `legacy_id` = ?")
+	_, err = ParseFlags([]string{"-map-id", "customer_id=customers:legacy_id", "-lookup", "customer_id=SELECT 1 FROM t WHERE a = ?"})
+	assert.ErrorContains(t, err, "can't be combined with a -lookup of the same column")
+}
+
+func TestSortDependencies(t *testing.T) {
+	order, cycle := sortDependencies([][]int{{2}, {}, {1}, {0, 1}})
+	assert.Assert(t, cycle == nil)
+	assert.DeepEqual(t, order, []int{1, 2, 0, 3})
+	_, cycle = sortDependencies([][]int{{}, {2}, {1}, {1}})
+	assert.DeepEqual(t, cycle, []int{1, 2, 3})
+}
+
+func writeTablesConfig(t *testing.T, content string) string {
+	filename := filepath.Join(t.TempDir(), "tables.yaml")
+	assert.NilError(t, os.WriteFile(filename, []byte(content), 0o644))
+	return filename
+}
+
+func TestParseFlagsTables(t *testing.T) {
+	filename := writeTablesConfig(t, `
+workers: 2
+tables:
+  - table: orders
+    csv: orders.csv
+    depends-on: customers
+  - table: customers
+    csv: customers.csv
+    workers: 4
+`)
+	c, err := ParseFlags([]string{"-config", filename, "-batch-size", "50"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(c.Tables), 2)
+	orders, customers := c.Tables[0], c.Tables[1]
+	assert.Equal(t, orders.Table, "orders")
+	assert.Equal(t, orders.CsvFile, "orders.csv")
+	assert.DeepEqual(t, orders.DependsOn, []string{"customers"})
+	assert.Equal(t, orders.Workers, 2)
+	// a table overrides the file, the command line wins
+	assert.Equal(t, customers.Workers, 4)
+	assert.Equal(t, customers.BatchSize, 50)
+
+	for want, content := range map[string]string{
+		"it sets no table":                      "tables:\n  - csv: a.csv\n",
+		"table a is loaded twice":               "tables:\n  - table: a\n  - table: a\n",
+		"table a depends on b, which isn't":     "tables:\n  - table: a\n    depends-on: b\n",
+		"-watch-dir can't be combined":          "watch-dir: /tmp\ntables:\n  - table: a\n",
+		"table 1 of config file":                "tables:\n  - table: a\n    workers: 0\n",
+		"-config can't be set in a config file": "tables:\n  - table: a\n    config: other.yaml\n",
+	} {
+		_, err := ParseFlags([]string{"-config", writeTablesConfig(t, content)})
+		assert.ErrorContains(t, err, want)
+	}
+	_, err = ParseFlags([]string{"-depends-on", "customers"})
+	assert.ErrorContains(t, err, "-depends-on requires the tables of a -config file")
+}
+
+func TestPlanOrder(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	keys := func(rows ...[]string) {
+		result := sqlmock.NewRows([]string{"CONSTRAINT_NAME", "TABLE_NAME", "COLUMN_NAME", "REFERENCED_TABLE_NAME", "REFERENCED_COLUMN_NAME"})
+		for _, r := range rows {
+			result.AddRow(r[0], r[1], r[2], r[3], r[4])
+		}
+		mock.ExpectQuery(foreignKeysQuery).WithArgs("items", "orders", "customers").WillReturnRows(result)
+	}
+	plan := func(deferChecks bool) *Plan {
+		var c Config
+		for _, table := range []string{"items", "orders", "customers"} {
+			c.Tables = append(c.Tables, Config{Table: table, DeferFKChecks: deferChecks})
+		}
+		return NewPlan(db, c)
+	}
+
+	keys([]string{"fk_items_order", "items", "order_id", "orders", "id"}, []string{"fk_orders_customer", "orders", "customer_id", "customers", "id"})
+	order, err := plan(false).order(context.Background())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, order, []int{2, 1, 0})
+
+	cycle := [][]string{{"fk_customers_order", "customers", "first_order_id", "orders", "id"},
+		{"fk_orders_customer", "orders", "customer_id", "customers", "id"}}
+	keys(cycle...)
+	_, err = plan(false).order(context.Background())
+	assert.ErrorContains(t, err, "the foreign keys of tables orders, customers form a cycle, load them with -defer-fk-checks")
+	keys(cycle...)
+	order, err = plan(true).order(context.Background())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, order, []int{0, 1, 2})
+	assert.NilError(t, mock.ExpectationsWereMet())
+
+	// the explicit dependencies can't be deferred
+	p := NewPlan(nil, Config{Tables: []Config{{Table: "a", DependsOn: []string{"b"}}, {Table: "b", IDMappings: []IDMapping{{Table: "a"}}}}})
+	_, err = p.order(context.Background())
+	assert.ErrorContains(t, err, "the -depends-on and -map-id of tables a, b form a cycle")
+}
+
+func TestValidateForeignKeys(t *testing.T) {
+	l := newTestLoader()
+	l.config = Config{}
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(foreignKeysQuery).WithArgs("items", "orders", "customers").WillReturnRows(
+		sqlmock.NewRows([]string{"CONSTRAINT_NAME", "TABLE_NAME", "COLUMN_NAME", "REFERENCED_TABLE_NAME", "REFERENCED_COLUMN_NAME"}).
+			AddRow("fk_items_order", "items", "order_id", "orders", "id").
+			AddRow("fk_items_order", "items", "line", "orders", "line").
+			AddRow("fk_orders_customer", "orders", "customer_id", "customers", "id"))
+	mock.ExpectQuery("SELECT COUNT(*) FROM `items` c WHERE c.`order_id` IS NOT NULL AND c.`line` IS NOT NULL AND NOT EXISTS " +
+		"(SELECT 1 FROM `orders` p WHERE p.`id` = c.`order_id` AND p.`line` = c.`line`)").
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT(*) FROM `orders` c WHERE c.`customer_id` IS NOT NULL AND NOT EXISTS " +
+		"(SELECT 1 FROM `customers` p WHERE p.`id` = c.`customer_id`)").
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(3))
+	err = ValidateForeignKeys(context.Background(), db, mysqlDialect{}, []string{"items", "orders", "customers"})
+	assert.Error(t, err, "3 rows of table orders violate foreign key fk_orders_customer (customer_id) referencing customers (id)")
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestPlanRun(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "customers.csv"), []byte("legacy_id,name\nC1,Ann\nC2,Bob\n"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "orders.csv"), []byte("customer_id,total\nC2,10\nC1,20\nC9,30\n"), 0o644))
+	filename := writeTablesConfig(t, `
+dialect: sqlite
+workers: 1
+tables:
+  - table: orders
+    csv: `+filepath.Join(dir, "orders.csv")+`
+    map-id: customer_id=customers:legacy_id
+    dead-letter-file: `+filepath.Join(dir, "orders.dead.csv")+`
+  - table: customers
+    csv: `+filepath.Join(dir, "customers.csv")+`
+`)
+	c, err := ParseFlags([]string{"-config", filename})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec(`INSERT INTO "customers" ("legacy_id","name") VALUES (?,?), (?,?)`).WithArgs("C1", "Ann", "C2", "Bob").
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	for code, id := range map[string]string{"C2": "2", "C1": "1"} {
+		mock.ExpectQuery(`SELECT "id" FROM "customers" WHERE "legacy_id" = ?`).WithArgs(code).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+	}
+	mock.ExpectQuery(`SELECT "id" FROM "customers" WHERE "legacy_id" = ?`).WithArgs("C9").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(`INSERT INTO "orders" ("customer_id","total") VALUES (?,?), (?,?)`).WithArgs("2", "10", "1", "20").
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.MatchExpectationsInOrder(false)
+
+	tables, err := NewPlan(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, len(tables), 2)
+	// the parent table is loaded first
+	assert.Equal(t, tables[0].Table, "customers")
+	assert.Equal(t, tables[1].Table, "orders")
+	assert.Equal(t, tables[1].RowsDeadLettered, int64(1))
+	total := Total(tables)
+	assert.Equal(t, total.RowsRead, int64(5))
+	assert.Equal(t, total.RowsInserted, int64(4))
+}
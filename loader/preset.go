@@ -0,0 +1,89 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Preset is a named import definition for a recurring kind of file
+type Preset struct {
+	Description string `json:"description"`
+	// Args are command line flags applied before the ones given on the command line, which win
+	Args []string `json:"args"`
+	// DDL is executed before the import, e.g. a CREATE TABLE IF NOT EXISTS for the target table
+	DDL string `json:"ddl"`
+}
+
+// builtinPresets are always available, a presets file may override them
+var builtinPresets = map[string]Preset{
+	"majestic-million": {
+		Description: "the Majestic Million list of the top 1 million domains (majestic_million.csv)",
+		Args:        []string{"-csv", "majestic_million.csv"},
+		DDL: `CREATE TABLE IF NOT EXISTS domain (
+  GlobalRank INT UNSIGNED NOT NULL PRIMARY KEY,
+  TldRank INT UNSIGNED NOT NULL,
+  Domain VARCHAR(253) NOT NULL,
+  TLD VARCHAR(63) NOT NULL,
+  RefSubNets INT UNSIGNED NOT NULL,
+  RefIPs INT UNSIGNED NOT NULL,
+  IDN_Domain VARCHAR(253) NOT NULL,
+  IDN_TLD VARCHAR(63) NOT NULL,
+  PrevGlobalRank INT NOT NULL,
+  PrevTldRank INT NOT NULL,
+  PrevRefSubNets INT NOT NULL,
+  PrevRefIPs INT NOT NULL
+)`,
+	},
+}
+
+// LoadPresets returns the built-in presets together with the ones defined in the JSON file filename
+// (an object of presets by name), empty filename only returns the built-in presets
+func LoadPresets(filename string) (map[string]Preset, error) {
+	presets := make(map[string]Preset, len(builtinPresets))
+	for name, p := range builtinPresets {
+		presets[name] = p
+	}
+	if filename == "" {
+		return presets, nil
+	}
+	data, err := os.ReadFile(expandHome(filename))
+	if err != nil {
+		return nil, err
+	}
+	var defined map[string]Preset
+	if err = json.Unmarshal(data, &defined); err != nil {
+		return nil, fmt.Errorf("error reading presets file %s: %w", filename, err)
+	}
+	for name, p := range defined {
+		presets[name] = p
+	}
+	return presets, nil
+}
+
+// presetNames returns the names of presets in order
+func presetNames(presets map[string]Preset) []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ListPresets writes the name, description and flags of all presets to w
+func ListPresets(w io.Writer, presets map[string]Preset) {
+	for _, name := range presetNames(presets) {
+		p := presets[name]
+		fmt.Fprintf(w, "%s: %s\n", name, p.Description)
+		if len(p.Args) > 0 {
+			fmt.Fprintf(w, "  flags: %s\n", strings.Join(p.Args, " "))
+		}
+		if p.DDL != "" {
+			fmt.Fprintln(w, "  creates the target table if it doesn't exist")
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const testPresets = `{
+  "daily-domains": {"description": "daily domain export", "args": ["-csv", "daily.csv", "-max-errors", "5"]},
+  "recursive": {"description": "broken", "args": ["-preset=daily-domains"]}
+}`
+
+func writePresets(t *testing.T) string {
+	filename := filepath.Join(t.TempDir(), "presets.json")
+	assert.NilError(t, os.WriteFile(filename, []byte(testPresets), 0o644))
+	return filename
+}
+
+func TestPresetFlags(t *testing.T) {
+	filename := writePresets(t)
+	c, err := ParseFlags([]string{"-presets-file", filename, "-preset", "daily-domains", "-max-errors", "10"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.CsvFile, "daily.csv")
+	// the command line wins over the preset
+	assert.Equal(t, c.MaxErrors, 10)
+	assert.Equal(t, c.presetDDL, "")
+}
+
+func TestBuiltinPreset(t *testing.T) {
+	c, err := ParseFlags([]string{"-preset=majestic-million"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.CsvFile, "majestic_million.csv")
+	assert.Assert(t, strings.HasPrefix(c.presetDDL, "CREATE TABLE IF NOT EXISTS domain ("))
+}
+
+func TestPresetErrors(t *testing.T) {
+	filename := writePresets(t)
+	_, err := ParseFlags([]string{"-presets-file", filename, "-preset", "weekly"})
+	assert.ErrorContains(t, err, "unknown preset 'weekly', available presets are: daily-domains, majestic-million, recursive")
+
+	_, err = ParseFlags([]string{"-presets-file", filename, "-preset", "recursive"})
+	assert.ErrorContains(t, err, "presets can't use -preset")
+}
+
+func TestListPresets(t *testing.T) {
+	presets, err := LoadPresets(writePresets(t))
+	assert.NilError(t, err)
+	var out strings.Builder
+	ListPresets(&out, presets)
+	assert.Assert(t, strings.HasPrefix(out.String(), "daily-domains: daily domain export\n  flags: -csv daily.csv -max-errors 5\n"), out.String())
+	assert.Assert(t, strings.Contains(out.String(), "majestic-million: the Majestic Million"))
+}
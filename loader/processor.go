@@ -0,0 +1,116 @@
+package loader
+
+import (
+	"fmt"
+	"plugin"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RowProcessor runs custom logic inside the pipeline, set as Config.RowProcessor by a library caller or loaded from
+// a Go plugin with -plugin. BeforeInsert is called by the reader for every row after the -transforms and the
+// RowTransform, OnBatchSuccess and OnBatchError by the workers concurrently.
+type RowProcessor interface {
+	// BeforeInsert returns the fields of row (in the order of the header) to insert, an error skips the row like a
+	// failing -transform. A string is inserted as is, nil as NULL and the other values are formatted as text.
+	BeforeInsert(row []string) ([]any, error)
+	// OnBatchSuccess is called with the data row numbers of a committed batch, the slice is the processor's
+	OnBatchSuccess(rows []int)
+	// OnBatchError is called with the data row numbers of a batch which failed for good (after the retries) and
+	// its error. With -split-failed-batches the rows are inserted one by one afterwards, each with a call of its own.
+	OnBatchError(rows []int, err error)
+}
+
+// pluginSymbol is the variable a -plugin exports, of a type implementing RowProcessor
+const pluginSymbol = "RowProcessor"
+
+// LoadPlugin returns the RowProcessor exported as variable RowProcessor by the Go plugin filename, built with
+// go build -buildmode=plugin against the same version of this package
+func LoadPlugin(filename string) (RowProcessor, error) {
+	p, err := plugin.Open(expandHome(filename))
+	if err != nil {
+		return nil, fmt.Errorf("could not load plugin %s: %w", filename, err)
+	}
+	sym, err := p.Lookup(pluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", filename, err)
+	}
+	switch v := sym.(type) {
+	case *RowProcessor:
+		if *v != nil {
+			return *v, nil
+		}
+	case RowProcessor:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%s of plugin %s is a %T, which doesn't implement loader.RowProcessor", pluginSymbol, filename, sym)
+}
+
+// processRow replaces the fields of row by the ones returned by the RowProcessor of the config
+func (c *Config) processRow(row []string) error {
+	if c.RowProcessor == nil {
+		return nil
+	}
+	values, err := c.RowProcessor.BeforeInsert(row)
+	if err != nil {
+		return err
+	}
+	if len(values) != len(row) {
+		return fmt.Errorf("the row processor returned %d fields instead of %d", len(values), len(row))
+	}
+	for i, v := range values {
+		s, err := c.processedValue(v)
+		if err != nil {
+			return fmt.Errorf("field %d: %w", i+1, err)
+		}
+		row[i] = s
+	}
+	return nil
+}
+
+// processedValue returns the field of a value of RowProcessor.BeforeInsert, a nil is the first -null-values value
+// (or the empty field with -empty-as-null)
+func (c *Config) processedValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		if len(c.NullValues) > 0 {
+			return c.NullValues[0], nil
+		}
+		if c.EmptyAsNull {
+			return "", nil
+		}
+		return "", fmt.Errorf("NULL requires -null-values or -empty-as-null")
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999"), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// batchSucceeded tells the RowProcessor of the config about a committed batch
+func (c *Config) batchSucceeded(rows []int) {
+	if c.RowProcessor != nil {
+		// the rows of the batch buffer are reused
+		c.RowProcessor.OnBatchSuccess(slices.Clone(rows))
+	}
+}
+
+// batchFailed tells the RowProcessor of the config about a batch which failed for good
+func (c *Config) batchFailed(rows []int, err error) {
+	if c.RowProcessor != nil {
+		c.RowProcessor.OnBatchError(slices.Clone(rows), err)
+	}
+}
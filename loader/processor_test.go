@@ -0,0 +1,86 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+// recordingProcessor upper cases the domains, drops the rows of example.com and records the batches
+type recordingProcessor struct {
+	mu        sync.Mutex
+	succeeded [][]int
+	failed    [][]int
+}
+
+func (p *recordingProcessor) BeforeInsert(row []string) ([]any, error) {
+	if row[1] == "example.com" {
+		return nil, errors.New("example domain")
+	}
+	return []any{len(row[1]), strings.ToUpper(row[1])}, nil
+}
+
+func (p *recordingProcessor) OnBatchSuccess(rows []int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.succeeded = append(p.succeeded, rows)
+}
+
+func (p *recordingProcessor) OnBatchError(rows []int, _ error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failed = append(p.failed, rows)
+}
+
+func TestImportRowProcessor(t *testing.T) {
+	l := withConnConfig(t, 5)
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain\n1,google.com\n2,example.com\n3,youtube.com\n4,x.com\n"), 0o644))
+	var err error
+	l.config, err = ParseFlags([]string{"-csv", filename, "-dialect", "sqlite", "-table", "domain", "-workers", "1", "-batch-size", "2",
+		"-max-retries", "0", "-max-errors", "1"})
+	assert.NilError(t, err)
+	p := &recordingProcessor{}
+	l.config.RowProcessor = p
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec(`INSERT INTO "domain" ("GlobalRank","Domain") VALUES (?,?), (?,?)`).WithArgs("10", "GOOGLE.COM", "11", "YOUTUBE.COM").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO "domain" ("GlobalRank","Domain") VALUES (?,?)`).WithArgs("5", "X.COM").
+		WillReturnError(errors.New("disk full"))
+
+	stats, err := New(db, l.config).Run(context.Background())
+	assert.ErrorContains(t, err, "disk full")
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	assert.DeepEqual(t, p.succeeded, [][]int{{1, 3}})
+	assert.DeepEqual(t, p.failed, [][]int{{4}})
+}
+
+func TestProcessedValue(t *testing.T) {
+	l := withConnConfig(t, 5)
+	for v, want := range map[any]string{"a": "a", 42: "42", 1.5: "1.5", true: "1", false: "0"} {
+		s, err := l.config.processedValue(v)
+		assert.NilError(t, err)
+		assert.Equal(t, s, want)
+	}
+	_, err := l.config.processedValue(nil)
+	assert.ErrorContains(t, err, "NULL requires -null-values or -empty-as-null")
+	l.config.NullValues = []string{`\N`}
+	s, err := l.config.processedValue(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, s, `\N`)
+}
+
+func TestLoadPlugin(t *testing.T) {
+	_, err := LoadPlugin(filepath.Join(t.TempDir(), "missing.so"))
+	assert.ErrorContains(t, err, "could not load plugin")
+}
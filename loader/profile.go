@@ -0,0 +1,96 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	httppprof "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// StartCPUProfile starts writing a CPU profile to filename, the returned function stops profiling and closes the file
+func StartCPUProfile(filename string) (func() error, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err = pprof.StartCPUProfile(f); err != nil {
+		return nil, errors.Join(err, f.Close())
+	}
+	return func() error {
+		pprof.StopCPUProfile()
+		return f.Close()
+	}, nil
+}
+
+// WriteHeapProfile writes a profile of the live heap to filename
+func WriteHeapProfile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	// the profile shows the objects still in use, not the garbage of the import
+	runtime.GC()
+	if err = pprof.WriteHeapProfile(f); err != nil {
+		return errors.Join(err, f.Close())
+	}
+	return f.Close()
+}
+
+// EnableContentionProfiling records every blocking event and mutex contention, for the block and mutex profiles.
+// Recording them slows the import down a little, so it is only enabled for -pprof-addr, -blockprofile and -mutexprofile.
+func EnableContentionProfiling() {
+	runtime.SetBlockProfileRate(1)
+	runtime.SetMutexProfileFraction(1)
+}
+
+// WriteProfile writes the profile name (e.g. block or mutex, see pprof.Lookup) to filename
+func WriteProfile(name string, filename string) error {
+	profile := pprof.Lookup(name)
+	if profile == nil {
+		return fmt.Errorf("unknown profile %s", name)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = profile.WriteTo(f, 0); err != nil {
+		return errors.Join(err, f.Close())
+	}
+	return f.Close()
+}
+
+// ServePprof serves the live profiles of net/http/pprof on http://addr/debug/pprof/, the returned function stops serving
+func ServePprof(addr string) (func() error, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening for pprof on %s: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Serving pprof failed: %s", err)
+		}
+	}()
+	log.Printf("Serving pprof on http://%s/debug/pprof/", ln.Addr())
+	return func() error {
+		err := server.Shutdown(context.Background())
+		<-done
+		return err
+	}, nil
+}
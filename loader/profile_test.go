@@ -0,0 +1,42 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestProfiles(t *testing.T) {
+	dir := t.TempDir()
+	stop, err := StartCPUProfile(filepath.Join(dir, "cpu.prof"))
+	assert.NilError(t, err)
+	assert.NilError(t, stop())
+	assert.NilError(t, WriteHeapProfile(filepath.Join(dir, "mem.prof")))
+	EnableContentionProfiling()
+	t.Cleanup(func() {
+		runtime.SetBlockProfileRate(0)
+		runtime.SetMutexProfileFraction(0)
+	})
+	assert.NilError(t, WriteProfile("block", filepath.Join(dir, "block.prof")))
+	assert.NilError(t, WriteProfile("mutex", filepath.Join(dir, "mutex.prof")))
+	for _, name := range []string{"cpu.prof", "mem.prof", "block.prof", "mutex.prof"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		assert.NilError(t, err)
+		assert.Assert(t, info.Size() > 0, name)
+	}
+
+	_, err = StartCPUProfile(filepath.Join(dir, "missing", "cpu.prof"))
+	assert.ErrorContains(t, err, "no such file or directory")
+	assert.ErrorContains(t, WriteProfile("locks", filepath.Join(dir, "locks.prof")), "unknown profile locks")
+}
+
+func TestServePprof(t *testing.T) {
+	stop, err := ServePprof("127.0.0.1:0")
+	assert.NilError(t, err)
+	assert.NilError(t, stop())
+	_, err = ServePprof("256.0.0.1:0")
+	assert.ErrorContains(t, err, "error listening for pprof on 256.0.0.1:0")
+}
@@ -0,0 +1,169 @@
+package loader
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateSmoothing is the weight of the latest sample in the rolling throughput
+const rateSmoothing = 0.3
+
+// Progress estimates the remaining time of an import from the bytes consumed so far and the size of all inputs.
+// A nil *Progress (or one with an unknown total) gives no estimate. It is safe for concurrent use, so a
+// ProgressReporter can sample it while the input is read.
+type Progress struct {
+	mu sync.Mutex
+	// total is the size of all inputs in bytes, 0 if unknown
+	total int64
+	// base is the size of the inputs already finished
+	base int64
+	// consumed are the bytes read of all inputs
+	consumed int64
+	// rows are the rows read so far
+	rows      int64
+	lastTime  time.Time
+	lastBytes int64
+	// rate is the rolling throughput in bytes per second
+	rate float64
+}
+
+// NewProgress starts tracking an import of total bytes
+func NewProgress(total int64, now time.Time) *Progress {
+	return &Progress{total: total, lastTime: now}
+}
+
+// Update records that offset bytes of the current input are read
+func (p *Progress) Update(offset int64, now time.Time) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.consumed = p.base + offset
+	p.sample(now)
+}
+
+// Read records that offset bytes of the current input and rows rows are read, without sampling the throughput
+func (p *Progress) Read(offset int64, rows int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.consumed = p.base + offset
+	p.rows = rows
+}
+
+// sample updates the rolling throughput with the bytes consumed since the last sample
+func (p *Progress) sample(now time.Time) {
+	elapsed := now.Sub(p.lastTime).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	sample := float64(p.consumed-p.lastBytes) / elapsed
+	if p.rate == 0 {
+		p.rate = sample
+	} else {
+		p.rate = rateSmoothing*sample + (1-rateSmoothing)*p.rate
+	}
+	p.lastTime = now
+	p.lastBytes = p.consumed
+}
+
+// NextInput records that an input of size bytes is finished
+func (p *Progress) NextInput(size int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.base += size
+	p.consumed = p.base
+}
+
+// Bytes returns the bytes read of all inputs
+func (p *Progress) Bytes() int64 {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.consumed
+}
+
+// Percent returns how much of the total was read
+func (p *Progress) Percent() (float64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.percent()
+}
+
+func (p *Progress) percent() (float64, bool) {
+	if p.total <= 0 {
+		return 0, false
+	}
+	return min(100, float64(p.consumed)*100/float64(p.total)), true
+}
+
+// ETA returns the estimated remaining time, false if there is no estimate (yet)
+func (p *Progress) ETA() (time.Duration, bool) {
+	if p == nil {
+		return 0, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.eta()
+}
+
+func (p *Progress) eta() (time.Duration, bool) {
+	if p.total <= 0 || p.rate <= 0 {
+		return 0, false
+	}
+	remaining := max(0, p.total-p.consumed)
+	return time.Duration(float64(remaining) / p.rate * float64(time.Second)).Round(time.Second), true
+}
+
+// String returns the progress for the log, empty if unknown
+func (p *Progress) String() string {
+	percent, ok := p.Percent()
+	if !ok {
+		return ""
+	}
+	if eta, ok := p.ETA(); ok {
+		return fmt.Sprintf("%.1f%%, ETA %s", percent, eta)
+	}
+	return fmt.Sprintf("%.1f%%", percent)
+}
+
+// ProgressSnapshot is the progress at a point in time
+type ProgressSnapshot struct {
+	// Rows and Bytes are read so far, Total is the size of all inputs (0 if unknown)
+	Rows  int64
+	Bytes int64
+	Total int64
+	// Rate is the rolling throughput in bytes per second
+	Rate float64
+	// Percent and ETA are only set with HasPercent and HasETA
+	Percent    float64
+	HasPercent bool
+	ETA        time.Duration
+	HasETA     bool
+}
+
+// Snapshot samples the throughput at now and returns the progress
+func (p *Progress) Snapshot(now time.Time) ProgressSnapshot {
+	if p == nil {
+		return ProgressSnapshot{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sample(now)
+	s := ProgressSnapshot{Rows: p.rows, Bytes: p.consumed, Total: p.total, Rate: p.rate}
+	s.Percent, s.HasPercent = p.percent()
+	s.ETA, s.HasETA = p.eta()
+	return s
+}
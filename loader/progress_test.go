@@ -0,0 +1,117 @@
+package loader
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestProgressETA(t *testing.T) {
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	p := NewProgress(1000, start)
+	_, ok := p.ETA()
+	assert.Assert(t, !ok, "no ETA without throughput")
+
+	// 100 bytes/s
+	p.Update(100, start.Add(time.Second))
+	eta, ok := p.ETA()
+	assert.Assert(t, ok)
+	assert.Equal(t, eta, 9*time.Second)
+	assert.Equal(t, p.String(), "10.0%, ETA 9s")
+
+	// the rate is smoothed: 0.3*300 + 0.7*100 = 160 bytes/s for the remaining 600 bytes
+	p.Update(400, start.Add(2*time.Second))
+	eta, _ = p.ETA()
+	assert.Equal(t, eta, 4*time.Second)
+}
+
+func TestProgressMultipleInputs(t *testing.T) {
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	p := NewProgress(1000, start)
+	p.Update(400, start.Add(time.Second))
+	p.NextInput(500)
+	p.Update(100, start.Add(2*time.Second))
+	percent, ok := p.Percent()
+	assert.Assert(t, ok)
+	assert.Equal(t, percent, 60.0)
+}
+
+func TestProgressUnknownTotal(t *testing.T) {
+	p := NewProgress(0, time.Now())
+	p.Update(100, time.Now().Add(time.Second))
+	_, ok := p.ETA()
+	assert.Assert(t, !ok)
+	assert.Equal(t, p.String(), "")
+
+	var nilProgress *Progress
+	nilProgress.Update(1, time.Now())
+	nilProgress.NextInput(1)
+	assert.Equal(t, nilProgress.String(), "")
+}
+
+func TestProgressSnapshot(t *testing.T) {
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	p := NewProgress(1000, start)
+	p.Read(250, 10)
+	s := p.Snapshot(start.Add(time.Second))
+	assert.DeepEqual(t, s, ProgressSnapshot{
+		Rows: 10, Bytes: 250, Total: 1000, Rate: 250, Percent: 25, HasPercent: true, ETA: 3 * time.Second, HasETA: true,
+	})
+
+	var nilProgress *Progress
+	nilProgress.Read(1, 1)
+	assert.DeepEqual(t, nilProgress.Snapshot(start), ProgressSnapshot{})
+}
+
+func TestFormatProgressBar(t *testing.T) {
+	s := ProgressSnapshot{Rows: 5000, Bytes: 500e6, Total: 1e9, Rate: 2.5e6, Percent: 50, HasPercent: true, ETA: 200 * time.Second, HasETA: true}
+	assert.Equal(t, formatProgressBar(s, 1250, []int64{3, 5}),
+		"[===============>              ]  50.0% 5000 rows, 1250 rows/s, 2.50 MB/s, ETA 3m20s, 8 batches (3-5 per worker)")
+
+	s.Percent = 100
+	assert.Assert(t, strings.HasPrefix(formatProgressBar(s, 0, nil), "[==============================] 100.0% "))
+	// without a known total there is no bar
+	assert.Equal(t, formatProgressBar(ProgressSnapshot{Rows: 7}, 7, []int64{1}), "7 rows, 7 rows/s, 0.00 MB/s, 1 batches")
+}
+
+func TestProgressReporterBar(t *testing.T) {
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	p := NewProgress(0, start)
+	var out bytes.Buffer
+	r := NewProgressReporter(ProgressBar, &out, 0, p, 2, start)
+	assert.Equal(t, r.interval, progressBarInterval)
+	r.Batch(1)
+	r.Batch(1)
+	r.Batch(5)
+	assert.DeepEqual(t, r.WorkerBatches(), []int64{0, 2})
+
+	p.Read(100, 200)
+	r.render(start.Add(2 * time.Second))
+	bar := "200 rows, 100 rows/s, 0.00 MB/s, 2 batches (0-2 per worker)"
+	assert.Equal(t, out.String(), "\r"+bar)
+	// a log line clears the bar
+	out.Reset()
+	assert.NilError(t, clearBarHook{r}.Fire(nil))
+	assert.Equal(t, out.String(), "\r"+strings.Repeat(" ", len(bar))+"\r")
+
+	assert.Assert(t, NewProgressReporter(ProgressRows, &out, 0, p, 2, start) == nil)
+	var nilReporter *ProgressReporter
+	nilReporter.Batch(0)
+	nilReporter.Stop()
+}
+
+func TestProgressFlags(t *testing.T) {
+	c, err := ParseFlags([]string{"-progress", "log", "-progress-interval", "30s"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.Progress, ProgressLog)
+	assert.Equal(t, c.ProgressInterval, 30*time.Second)
+	assert.Equal(t, resolveProgressMode(ProgressBar), ProgressBar)
+
+	_, err = ParseFlags([]string{"-progress", "fancy"})
+	assert.ErrorContains(t, err, "invalid progress 'fancy', allowed are: rows, bar, log, auto, off")
+	_, err = ParseFlags([]string{"-progress-interval", "-1s"})
+	assert.ErrorContains(t, err, "invalid progress-interval -1s")
+}
@@ -0,0 +1,262 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// progress output of -progress
+const (
+	// ProgressRows logs "Processed N rows" every 1000 rows
+	ProgressRows = "rows"
+	// ProgressBar redraws a progress bar on stderr
+	ProgressBar = "bar"
+	// ProgressLog logs the progress with its fields periodically
+	ProgressLog = "log"
+	// ProgressAuto is ProgressBar when stderr is a terminal, ProgressLog otherwise
+	ProgressAuto = "auto"
+	// ProgressOff logs no progress
+	ProgressOff = "off"
+)
+
+var progressModes = []string{ProgressRows, ProgressBar, ProgressLog, ProgressAuto, ProgressOff}
+
+// default -progress-interval of the bar and the log lines
+const (
+	progressBarInterval = 500 * time.Millisecond
+	progressLogInterval = 10 * time.Second
+)
+
+// progressBarWidth is the number of characters of the bar itself
+const progressBarWidth = 30
+
+// ProgressReporter periodically renders the Progress of the import together with the rows and MB per second and
+// the batches executed by every worker, as a bar redrawn on a terminal or as log lines. A nil *ProgressReporter
+// renders nothing and counts no batches.
+type ProgressReporter struct {
+	mode     string
+	out      io.Writer
+	interval time.Duration
+	progress *Progress
+	batches  []atomic.Int64
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+
+	// lastTime and lastRows are of the previous render, for the rows per second
+	lastTime time.Time
+	lastRows int64
+	rowRate  float64
+	// mu guards the bar on out and its width, the length of the bar drawn last, so a log line (or a shorter
+	// bar) overwrites it completely
+	mu    sync.Mutex
+	width int
+}
+
+// resolveProgressMode returns the mode of -progress, auto depending on whether stderr is a terminal
+func resolveProgressMode(mode string) string {
+	if mode != ProgressAuto {
+		return mode
+	}
+	if isTerminal(os.Stderr) {
+		return ProgressBar
+	}
+	return ProgressLog
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// NewProgressReporter renders p in mode (ProgressBar or ProgressLog) every interval (0 is the default of the
+// mode) and counts the batches of workers workers. The bar is drawn on out. Other modes return nil.
+func NewProgressReporter(mode string, out io.Writer, interval time.Duration, p *Progress, workers int, now time.Time) *ProgressReporter {
+	if mode != ProgressBar && mode != ProgressLog {
+		return nil
+	}
+	if interval <= 0 {
+		interval = progressLogInterval
+		if mode == ProgressBar {
+			interval = progressBarInterval
+		}
+	}
+	return &ProgressReporter{
+		mode: mode, out: out, interval: interval, progress: p, batches: make([]atomic.Int64, max(1, workers)),
+		stop: make(chan struct{}), done: make(chan struct{}), lastTime: now,
+	}
+}
+
+// Start renders the progress every interval until Stop is called
+func (r *ProgressReporter) Start() {
+	if r == nil {
+		return
+	}
+	if r.mode == ProgressBar {
+		// a log line would continue the bar, so the bar is cleared before and redrawn at the next tick
+		log.AddHook(clearBarHook{r})
+	}
+	go r.run()
+}
+
+func (r *ProgressReporter) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			r.render(now)
+		}
+	}
+}
+
+// Stop renders the final progress and stops, the bar is ended with a newline
+func (r *ProgressReporter) Stop() {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		close(r.stop)
+		<-r.done
+		r.render(time.Now())
+		if r.mode == ProgressBar {
+			fmt.Fprintln(r.out)
+			log.StandardLogger().ReplaceHooks(withoutClearBarHook(log.StandardLogger().Hooks))
+		}
+	})
+}
+
+// Batch counts a batch executed by worker workerIndex
+func (r *ProgressReporter) Batch(workerIndex int) {
+	if r == nil || workerIndex < 0 || workerIndex >= len(r.batches) {
+		return
+	}
+	r.batches[workerIndex].Add(1)
+}
+
+// WorkerBatches returns the batches executed by every worker so far
+func (r *ProgressReporter) WorkerBatches() []int64 {
+	if r == nil {
+		return nil
+	}
+	batches := make([]int64, len(r.batches))
+	for i := range r.batches {
+		batches[i] = r.batches[i].Load()
+	}
+	return batches
+}
+
+func (r *ProgressReporter) render(now time.Time) {
+	s := r.progress.Snapshot(now)
+	if elapsed := now.Sub(r.lastTime).Seconds(); elapsed > 0 {
+		sample := float64(s.Rows-r.lastRows) / elapsed
+		if r.rowRate == 0 {
+			r.rowRate = sample
+		} else {
+			r.rowRate = rateSmoothing*sample + (1-rateSmoothing)*r.rowRate
+		}
+		r.lastTime, r.lastRows = now, s.Rows
+	}
+	batches := r.WorkerBatches()
+	if r.mode == ProgressLog {
+		r.logLine(s, batches)
+		return
+	}
+	bar := formatProgressBar(s, r.rowRate, batches)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// padded to overwrite the rest of a longer bar drawn before
+	pad := max(0, r.width-len(bar))
+	r.width = len(bar)
+	fmt.Fprintf(r.out, "\r%s%s", bar, strings.Repeat(" ", pad))
+}
+
+func (r *ProgressReporter) logLine(s ProgressSnapshot, batches []int64) {
+	fields := log.Fields{
+		"rows":           s.Rows,
+		"rows_per_sec":   int64(r.rowRate),
+		"mb_per_sec":     fmt.Sprintf("%.2f", s.Rate/1e6),
+		"batches":        sum(batches),
+		"worker_batches": batches,
+	}
+	if s.HasPercent {
+		fields["percent"] = fmt.Sprintf("%.1f", s.Percent)
+	}
+	if s.HasETA {
+		fields["eta"] = s.ETA.String()
+	}
+	log.WithFields(fields).Info("Progress")
+}
+
+// formatProgressBar renders s with rowRate rows per second and the batches of the workers on one line, the bar
+// itself only with a known total
+func formatProgressBar(s ProgressSnapshot, rowRate float64, batches []int64) string {
+	var b strings.Builder
+	if s.HasPercent {
+		filled := int(s.Percent / 100 * progressBarWidth)
+		b.WriteString("[" + strings.Repeat("=", filled))
+		if filled < progressBarWidth {
+			b.WriteString(">" + strings.Repeat(" ", progressBarWidth-filled-1))
+		}
+		fmt.Fprintf(&b, "] %5.1f%% ", s.Percent)
+	}
+	fmt.Fprintf(&b, "%d rows, %.0f rows/s, %.2f MB/s", s.Rows, rowRate, s.Rate/1e6)
+	if s.HasETA {
+		fmt.Fprintf(&b, ", ETA %s", s.ETA)
+	}
+	if len(batches) > 0 {
+		fmt.Fprintf(&b, ", %d batches", sum(batches))
+		if len(batches) > 1 {
+			fmt.Fprintf(&b, " (%d-%d per worker)", slices.Min(batches), slices.Max(batches))
+		}
+	}
+	return b.String()
+}
+
+func sum(values []int64) int64 {
+	var total int64
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// clearBarHook clears the bar of its reporter before a log line is written
+type clearBarHook struct {
+	r *ProgressReporter
+}
+
+func (h clearBarHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h clearBarHook) Fire(*log.Entry) error {
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	_, err := fmt.Fprintf(h.r.out, "\r%s\r", strings.Repeat(" ", h.r.width))
+	h.r.width = 0
+	return err
+}
+
+func withoutClearBarHook(hooks log.LevelHooks) log.LevelHooks {
+	kept := make(log.LevelHooks)
+	for level, levelHooks := range hooks {
+		for _, hook := range levelHooks {
+			if _, ok := hook.(clearBarHook); !ok {
+				kept[level] = append(kept[level], hook)
+			}
+		}
+	}
+	return kept
+}
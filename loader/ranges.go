@@ -0,0 +1,306 @@
+package loader
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rangeSize is the size of the byte ranges of -read-ranges, the record at the end of a range makes it longer
+var rangeSize int64 = 8 << 20
+
+// rangeScanSize is how much is read at once past the end of a range to find the end of its last record
+const rangeScanSize = 64 << 10
+
+// rangeReader reads a CSV file with several goroutines, each reading byte ranges of the file (with ReadAt, so the
+// reads go to the disk in parallel) and parsing them. A range only knows where it starts once the range before it
+// is read, so it starts at its first line: a range starting within a quoted field spanning lines is found out when
+// it's its turn and read again from where the last record of the range before it ends. The rows are returned in the
+// order of the file, so row numbers, line numbers and resuming work as with a single reader.
+type rangeReader struct {
+	file    *os.File
+	size    int64
+	ordered chan *byteRange
+	current *byteRange
+	next    int
+	// end is where the last record of the ranges returned so far ends and line the line it starts, the next range
+	// has to start there
+	end  int64
+	line int
+	// offset and recordLine are the input offset after the record read last and the line it starts
+	offset     int64
+	recordLine int
+	comment    rune
+	// newReader creates the CSV reader of the records of a range
+	newReader func(io.Reader) *csv.Reader
+	stop      chan struct{}
+	once      sync.Once
+	reading   sync.WaitGroup
+}
+
+// byteRange is a range of a CSV file with whole records
+type byteRange struct {
+	// from and to are the bounds the range was cut at, start and end the ones of its records
+	from, to   int64
+	start, end int64
+	// exact is set if the range starts at a record, which the first one does
+	exact bool
+	// lines is the number of lines of the range, the records have the lines within the range
+	lines   int
+	records []parsedRecord
+	err     error
+	done    chan struct{}
+}
+
+// openRangeReader reads the only input of source, which has to be a CSV file, with -read-ranges goroutines. It
+// returns the reader of the rows after the header and the header.
+func (c *Config) openRangeReader(source CSVSource, name string, readers int) (RowReader, []string, error) {
+	fs, ok := source.(*fileSource)
+	if !ok || fs.compressed {
+		return nil, nil, fmt.Errorf("-read-ranges reads a single uncompressed CSV file, %s isn't one", name)
+	}
+	info, err := fs.file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, fmt.Errorf("-read-ranges reads a single uncompressed CSV file, %s isn't one", name)
+	}
+	size := info.Size()
+	sniff := make([]byte, encodingSniffSize)
+	n, err := fs.file.ReadAt(sniff, 0)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	sniff = sniff[:n]
+	if encoding := strings.ToLower(cmp.Or(c.InputEncoding, EncodingAuto)); encoding == EncodingAuto && detectEncoding(sniff) != "utf-8" {
+		return nil, nil, fmt.Errorf("-read-ranges reads UTF-8 only, %s is %s", name, detectEncoding(sniff))
+	}
+	var bom int64
+	if bytes.HasPrefix(sniff, utf8BOM) {
+		bom = int64(len(utf8BOM))
+	}
+	// comment lines are skipped by the reader, so the header is the first line which is no comment
+	headerReader := c.newCSVReader(io.NewSectionReader(fs.file, bom, size-bom))
+	header, err := headerReader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading header of %s: %w", name, err)
+	}
+	start := bom + headerReader.InputOffset()
+	// the lines of the header and the comments before it
+	head := make([]byte, start)
+	if _, err = fs.file.ReadAt(head, 0); err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Reading %s in ranges of %d bytes with %d goroutines", name, rangeSize, readers)
+
+	r := &rangeReader{file: fs.file, size: size, ordered: make(chan *byteRange, 2*readers), end: start,
+		line: bytes.Count(head, []byte{'\n'}) + 1, offset: start, comment: c.Comment, newReader: c.newCSVReader,
+		stop: make(chan struct{})}
+	work := make(chan *byteRange, readers)
+	go r.split(start, work)
+	r.reading.Add(readers)
+	for i := 0; i < readers; i++ {
+		go func() {
+			defer r.reading.Done()
+			for {
+				select {
+				case rg, ok := <-work:
+					if !ok {
+						return
+					}
+					if rg.exact {
+						rg.read(r.file, r.size, rg.from, r.comment, r.newReader)
+					} else {
+						rg.read(r.file, r.size, -1, r.comment, r.newReader)
+					}
+					close(rg.done)
+				case <-r.stop:
+					return
+				}
+			}
+		}()
+	}
+	return r, header, nil
+}
+
+// split cuts the file from start on into ranges and hands them to the goroutines and the reader
+func (r *rangeReader) split(start int64, work chan<- *byteRange) {
+	defer close(r.ordered)
+	defer close(work)
+	for from := start; from < r.size; from += rangeSize {
+		rg := &byteRange{from: from, to: min(from+rangeSize, r.size), exact: from == start, done: make(chan struct{})}
+		select {
+		case r.ordered <- rg:
+		case <-r.stop:
+			return
+		}
+		select {
+		case work <- rg:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// read reads and parses the records of the range starting at start, or at the first line starting in the range if
+// start is -1. The range ends with the first record ending at or after to. The records are parsed by a reader of
+// newReader.
+func (rg *byteRange) read(file *os.File, size int64, start int64, comment rune, newReader func(io.Reader) *csv.Reader) {
+	rg.records, rg.lines, rg.err = nil, 0, nil
+	if start < 0 {
+		if start, rg.err = nextLine(file, size, rg.from); rg.err != nil {
+			return
+		}
+	}
+	rg.start, rg.end = start, start
+	if start >= rg.to {
+		return
+	}
+	buf := make([]byte, rg.to-start, rg.to-start+rangeScanSize)
+	if _, err := file.ReadAt(buf, start); err != nil && err != io.EOF {
+		rg.err = err
+		return
+	}
+	_, scanned, inQuotes, atLineStart := recordBoundary(buf, 0, false, true, comment)
+	end := -1
+	if scanned == len(buf) && !inQuotes && atLineStart {
+		end = len(buf)
+	}
+	// the last record goes on after to until the first newline outside of quotes
+	for end < 0 && start+int64(len(buf)) < size {
+		n := int(min(rangeScanSize, size-start-int64(len(buf))))
+		buf = slices.Grow(buf, n)
+		n, err := file.ReadAt(buf[len(buf):len(buf)+n], start+int64(len(buf)))
+		if err != nil && err != io.EOF {
+			rg.err = err
+			return
+		}
+		if n == 0 {
+			break
+		}
+		buf = buf[:len(buf)+n]
+		for i := scanned; i < len(buf) && end < 0; i++ {
+			if buf[i] == '\n' {
+				end, scanned, inQuotes, atLineStart = recordBoundary(buf[:i+1], scanned, inQuotes, atLineStart, comment)
+			}
+		}
+	}
+	if end < 0 {
+		// the last record of the file may not end with a newline
+		end = len(buf)
+	}
+	chunk := &parseChunk{data: buf[:end], offset: start, line: 1}
+	chunk.parse(newReader)
+	rg.records, rg.lines, rg.end = chunk.records, bytes.Count(chunk.data, []byte{'\n'}), start+int64(end)
+}
+
+// nextLine returns the offset of the first line starting at or after from
+func nextLine(file *os.File, size int64, from int64) (int64, error) {
+	buf := make([]byte, rangeScanSize)
+	for at := from - 1; at < size; at += int64(len(buf)) {
+		n, err := file.ReadAt(buf, at)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return at + int64(i) + 1, nil
+		}
+	}
+	return size, nil
+}
+
+func (r *rangeReader) Read() ([]string, error) {
+	for r.current == nil || r.next >= len(r.current.records) {
+		if r.current != nil && r.current.err != nil {
+			err := r.current.err
+			r.current.err = nil
+			return nil, err
+		}
+		rg, ok := <-r.ordered
+		if !ok {
+			return nil, io.EOF
+		}
+		<-rg.done
+		if rg.err == nil && rg.start != r.end {
+			log.Debugf("The range from byte %d starts within a record, it's read again from byte %d", rg.from, r.end)
+			rg.read(r.file, r.size, r.end, r.comment, r.newReader)
+		}
+		// the records have the lines within the range
+		for i := range rg.records {
+			rg.records[i] = shiftLines(rg.records[i], r.line-1)
+		}
+		r.current, r.next = rg, 0
+		r.line += rg.lines
+		r.end = max(r.end, rg.end)
+	}
+	record := r.current.records[r.next]
+	r.next++
+	r.offset, r.recordLine = record.offset, record.line
+	return record.row, record.err
+}
+
+// shiftLines returns record with its lines and the ones of its error moved down by n lines
+func shiftLines(record parsedRecord, n int) parsedRecord {
+	record.line += n
+	var parseErr *csv.ParseError
+	if errors.As(record.err, &parseErr) {
+		shifted := *parseErr
+		shifted.StartLine += n
+		shifted.Line += n
+		record.err = &shifted
+	}
+	return record
+}
+
+func (r *rangeReader) InputOffset() int64 {
+	return r.offset
+}
+
+// FieldPos returns the line the last record read starts, the column isn't known
+func (r *rangeReader) FieldPos(int) (int, int) {
+	return r.recordLine, 0
+}
+
+// Close stops the goroutines of a reader which isn't read to the end, it waits for the reading goroutines
+func (r *rangeReader) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	r.reading.Wait()
+	return nil
+}
+
+// validateReadRanges checks -read-ranges, which reads a single CSV file with strict quotes
+func (c *Config) validateReadRanges() error {
+	if c.ReadRanges < 0 {
+		return fmt.Errorf("invalid read-ranges %d, must not be negative", c.ReadRanges)
+	}
+	if c.ReadRanges <= 1 {
+		return nil
+	}
+	if c.InputFormat != InputFormatCSV || c.Quote == QuoteNone || c.LazyQuotes {
+		return fmt.Errorf("-read-ranges requires -input-format csv with strict quotes, it can't be combined with -quote %s or -lazy-quotes", QuoteNone)
+	}
+	if c.ParseWorkers > 1 {
+		return fmt.Errorf("-read-ranges can't be combined with -parse-workers, the ranges are parsed by their goroutines")
+	}
+	if encoding := strings.ToLower(c.InputEncoding); encoding != "" && encoding != EncodingAuto && encoding != "utf-8" {
+		return fmt.Errorf("-read-ranges reads UTF-8 only, it can't be combined with -input-encoding %s", c.InputEncoding)
+	}
+	inputs := c.Inputs()
+	if len(inputs) != 1 || c.WatchDir != "" {
+		return fmt.Errorf("-read-ranges reads a single CSV file, not %d inputs", len(inputs))
+	}
+	if _, ok := urlScheme(inputs[0]); ok || inputs[0] == "-" {
+		return fmt.Errorf("-read-ranges reads a local CSV file, not %s", inputs[0])
+	}
+	return nil
+}
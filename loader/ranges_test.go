@@ -0,0 +1,127 @@
+package loader
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// readRanges reads input written to a file with c by a range reader of readers goroutines and ranges of size bytes
+func readRanges(t *testing.T, c Config, input string, size int64, readers int) ([]string, [][]string, []int, *rangeReader) {
+	t.Helper()
+	defer func(size int64) { rangeSize = size }(rangeSize)
+	rangeSize = size
+	filename := filepath.Join(t.TempDir(), "input.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte(input), 0o644))
+	source, err := OpenCSVFile(filename)
+	assert.NilError(t, err)
+	t.Cleanup(func() { source.Close() })
+	name, _, err := source.Next()
+	assert.NilError(t, err)
+	reader, header, err := c.openRangeReader(source, name, readers)
+	assert.NilError(t, err)
+	var rows [][]string
+	var lines []int
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		rows = append(rows, row)
+		line, _ := reader.(*rangeReader).FieldPos(0)
+		lines = append(lines, line)
+	}
+	return header, rows, lines, reader.(*rangeReader)
+}
+
+func TestRangeReader(t *testing.T) {
+	c := defaultConfig()
+	c.Comment = '#'
+	input := parallelInput(1000)
+	want, err := c.newCSVReader(strings.NewReader(input)).ReadAll()
+	assert.NilError(t, err)
+	// the lines of the records as the single reader sees them
+	var wantLines []int
+	single := c.newCSVReader(strings.NewReader(input))
+	for {
+		if _, err := single.Read(); err == io.EOF {
+			break
+		}
+		line, _ := single.FieldPos(0)
+		wantLines = append(wantLines, line)
+	}
+	// the small ranges start within the quoted fields spanning lines and within comments
+	for _, size := range []int64{5, 23, 64, 4096, 1 << 20} {
+		header, rows, lines, reader := readRanges(t, c, input, size, 4)
+		assert.DeepEqual(t, header, want[0])
+		assert.DeepEqual(t, rows, want[1:])
+		assert.DeepEqual(t, lines, wantLines[1:])
+		assert.Equal(t, reader.InputOffset(), int64(len(input)))
+		assert.NilError(t, reader.Close())
+	}
+}
+
+func TestRangeReaderBOMAndLastLine(t *testing.T) {
+	header, rows, _, _ := readRanges(t, defaultConfig(), "\xef\xbb\xbfa,b\n1,\"x\ny\"\n2,z", 3, 3)
+	assert.DeepEqual(t, header, []string{"a", "b"})
+	assert.DeepEqual(t, rows, [][]string{{"1", "x\ny"}, {"2", "z"}})
+}
+
+func TestRangeReaderMalformed(t *testing.T) {
+	c := defaultConfig()
+	defer func(size int64) { rangeSize = size }(rangeSize)
+	rangeSize = 6
+	filename := filepath.Join(t.TempDir(), "input.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("a,b\n1,2\n3,\"x\"y\"\n5,6\n"), 0o644))
+	source, err := OpenCSVFile(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+	name, _, err := source.Next()
+	assert.NilError(t, err)
+	reader, _, err := c.openRangeReader(source, name, 2)
+	assert.NilError(t, err)
+	defer closeRowReader(reader)
+	var parseErr *csv.ParseError
+	for {
+		_, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			assert.Assert(t, errors.As(err, &parseErr))
+			assert.Equal(t, parseErr.Line, 3)
+		}
+	}
+	assert.Assert(t, parseErr != nil)
+}
+
+func TestImportReadRanges(t *testing.T) {
+	defer func(size int64) { rangeSize = size }(rangeSize)
+	rangeSize = 100
+	filename := filepath.Join(t.TempDir(), "ranks.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte(parallelInput(500)), 0o644))
+	c, err := ParseFlags([]string{"-dry-run", "-csv", filename, "-read-ranges", "4", "-workers", "2", "-comment", "#"})
+	assert.NilError(t, err)
+	stats, err := New(nil, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsRead, int64(500))
+	assert.Equal(t, stats.RowsInserted, int64(500))
+
+	for want, args := range map[string][]string{
+		"-read-ranges requires -input-format csv with strict quotes": {"-read-ranges", "4", "-lazy-quotes"},
+		"-read-ranges can't be combined with -parse-workers":         {"-read-ranges", "4", "-parse-workers", "4"},
+		"-read-ranges reads a local CSV file, not -":                 {"-read-ranges", "4", "-csv", "-"},
+		"-read-ranges reads a single CSV file, not 2 inputs":         {"-read-ranges", "4", "a.csv", "b.csv"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want)
+	}
+}
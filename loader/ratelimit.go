@@ -0,0 +1,45 @@
+package loader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiting the rows sent to the workers (or the batches executed) per second, shared
+// by the whole import so the limit holds no matter how many workers there are. The bucket holds up to burst tokens
+// and refills at rate tokens per second. A full bucket lets burst rows through right away, the ones after wait for
+// their token. It is safe for concurrent use. A nil *RateLimiter doesn't limit anything.
+type RateLimiter struct {
+	mu    sync.Mutex
+	rate  float64
+	burst float64
+	// tokens are the tokens left at last, negative when tokens are promised to waiting callers
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows rate per second with bursts of burst (at least 1), the bucket starts full
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	b := float64(max(1, burst))
+	return &RateLimiter{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// Wait waits for a token, it fails when ctx is done first
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	now := time.Now()
+	// a limiter which was idle saves up its burst, not more
+	r.tokens = min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	r.last = now
+	r.tokens--
+	delay := time.Duration(-r.tokens / r.rate * float64(time.Second))
+	r.mu.Unlock()
+	if delay > 0 {
+		return sleep(ctx, delay)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestProcessCSVFileRate(t *testing.T) {
+	l := newTestLoader()
+	const rows, rate = 10, 50
+	l.rateLimiter = NewRateLimiter(rate, 1)
+
+	var input strings.Builder
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&input, "%d.com\n", i)
+	}
+	jobs := make(chan Job, rows)
+	start := time.Now()
+	read, _, _ := l.ProcessCSVFile(context.Background(), l.config.newCSVReader(strings.NewReader(input.String())), jobs, 0, 0, 100)
+	elapsed := time.Since(start)
+	assert.Equal(t, read, rows)
+	// the first row is sent right away, a little tolerance for the timers
+	minimum := time.Duration(float64(rows-1)/rate*float64(time.Second)) - 10*time.Millisecond
+	assert.Assert(t, elapsed >= minimum, "%d rows took %s, expected at least %s", rows, elapsed, minimum)
+}
+
+func TestRateLimiterShared(t *testing.T) {
+	const goroutines, rows, rate = 4, 5, 100
+	limiter := NewRateLimiter(rate, 1)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rows; i++ {
+				assert.Check(t, limiter.Wait(context.Background()))
+			}
+		}()
+	}
+	wg.Wait()
+	// the limit holds for all goroutines together
+	minimum := time.Duration(float64(goroutines*rows-1)/rate*float64(time.Second)) - 10*time.Millisecond
+	assert.Assert(t, time.Since(start) >= minimum)
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	limiter := NewRateLimiter(0.1, 1)
+	assert.NilError(t, limiter.Wait(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, limiter.Wait(ctx), context.DeadlineExceeded)
+
+	var unlimited *RateLimiter
+	assert.NilError(t, unlimited.Wait(context.Background()))
+
+	_, err := ParseFlags([]string{"-rate", "-1"})
+	assert.ErrorContains(t, err, "invalid rate -1, must not be negative")
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	limiter := NewRateLimiter(10, 5)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.NilError(t, limiter.Wait(context.Background()))
+	}
+	assert.Assert(t, time.Since(start) < 50*time.Millisecond, "a full bucket doesn't wait")
+	// the sixth token takes 1/10s to refill
+	assert.NilError(t, limiter.Wait(context.Background()))
+	assert.Assert(t, time.Since(start) >= 90*time.Millisecond)
+
+	_, err := ParseFlags([]string{"-rate-burst", "0"})
+	assert.ErrorContains(t, err, "invalid rate-burst 0, must be at least 1")
+	_, err = ParseFlags([]string{"-max-batches-per-sec", "-2"})
+	assert.ErrorContains(t, err, "invalid max-batches-per-sec -2, must not be negative")
+}
@@ -0,0 +1,96 @@
+package loader
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"strconv"
+)
+
+// rejectsHeader are the columns of the rejects file
+var rejectsHeader = []string{"input", "row", "line", "error"}
+
+// Rejects records the malformed rows and the rows breaking a validation rule (the skipped ones and the one exceeding
+// the error budget) in a CSV file with the input, the number of the data row, the line in the input and the error,
+// so the input can be fixed. The rows are read by a single goroutine, so it isn't safe for concurrent use. A nil *Rejects records nothing.
+type Rejects struct {
+	f *os.File
+	w *csv.Writer
+	// input is the name of the input read
+	input string
+	// header is written with the first row, so the file stays empty when no row is malformed
+	header bool
+	rows   int64
+}
+
+// OpenRejects creates (or truncates) the rejects file filename
+func OpenRejects(filename string) (*Rejects, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &Rejects{f: f, w: csv.NewWriter(f), header: true}, nil
+}
+
+// StartInput sets the input the following rows are read from
+func (r *Rejects) StartInput(name string) {
+	if r == nil {
+		return
+	}
+	r.input = name
+}
+
+// Write records the malformed row number at line of the input (0 if unknown) with its error
+func (r *Rejects) Write(row int, line int, rowErr error) error {
+	if r == nil {
+		return nil
+	}
+	if r.header {
+		if err := r.w.Write(rejectsHeader); err != nil {
+			return err
+		}
+		r.header = false
+	}
+	if err := r.w.Write([]string{r.input, strconv.Itoa(row), strconv.Itoa(line), rowErr.Error()}); err != nil {
+		return err
+	}
+	r.rows++
+	// flushed right away, so the cleanup sees the file isn't empty
+	r.w.Flush()
+	return r.w.Error()
+}
+
+// Rows returns the number of rows recorded
+func (r *Rejects) Rows() int64 {
+	if r == nil {
+		return 0
+	}
+	return r.rows
+}
+
+// Close flushes and closes the rejects file
+func (r *Rejects) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.w.Flush()
+	err := r.w.Error()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readerLine returns the line in the input of the malformed row read last by reader, 0 if it isn't known
+func readerLine(reader RowReader, rowErr error) int {
+	var parseErr *csv.ParseError
+	if errors.As(rowErr, &parseErr) {
+		return parseErr.Line
+	}
+	// a row with the wrong number of fields was read fine, so the reader knows where it started
+	if r, ok := reader.(interface{ FieldPos(int) (int, int) }); ok {
+		line, _ := r.FieldPos(0)
+		return line
+	}
+	return 0
+}
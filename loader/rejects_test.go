@@ -0,0 +1,37 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRejectsNil(t *testing.T) {
+	var r *Rejects
+	r.StartInput("a.csv")
+	assert.NilError(t, r.Write(1, 2, errFieldCount))
+	assert.Equal(t, r.Rows(), int64(0))
+	assert.NilError(t, r.Close())
+}
+
+func TestLoaderRunRejectsFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain\n1,google.com\n2,youtube.com,extra\n"+
+		"3,\"face\"book.com\"\n4,example.com\n"), 0o644))
+	rejectsFile := filepath.Join(dir, "rejects.csv")
+	c, err := ParseFlags([]string{"-dry-run", "-csv", filename, "-max-errors", "2", "-rejects-file", rejectsFile})
+	assert.NilError(t, err)
+
+	stats, err := New(nil, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	content, err := os.ReadFile(rejectsFile)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "input,row,line,error\n"+
+		filename+",2,3,\"wrong number of fields, 3 instead of 2\"\n"+
+		filename+",3,4,\"parse error on line 4, column 8: extraneous or missing \"\" in quoted-field\"\n")
+}
@@ -0,0 +1,292 @@
+package loader
+
+import (
+	"archive/tar"
+	"cmp"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SourceOpener opens the input at a URL as a CSV source
+type SourceOpener func(rawURL string) (CSVSource, error)
+
+// sourceOpeners are the openers of the URL schemes OpenCSVSource streams from
+var (
+	sourceOpenersMu sync.RWMutex
+	sourceOpeners   = map[string]SourceOpener{
+		"http":  OpenHTTPSource,
+		"https": OpenHTTPSource,
+		"s3":    OpenS3Source,
+		"kafka": OpenKafkaSource,
+	}
+)
+
+// RegisterSource makes OpenCSVSource open the inputs with a URL of scheme (e.g. "gs") with open, replacing the
+// opener of the scheme if there is one, a nil open removes it
+func RegisterSource(scheme string, open SourceOpener) {
+	sourceOpenersMu.Lock()
+	defer sourceOpenersMu.Unlock()
+	sourceOpeners[strings.ToLower(scheme)] = open
+}
+
+// urlScheme returns the scheme of name if it is a URL like https://host/path
+func urlScheme(name string) (string, bool) {
+	scheme, _, ok := strings.Cut(name, "://")
+	if !ok || scheme == "" {
+		return "", false
+	}
+	for _, r := range scheme {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '+' || r == '-' || r == '.') {
+			return "", false
+		}
+	}
+	return strings.ToLower(scheme), true
+}
+
+// openURL opens rawURL with the opener of its scheme
+func openURL(scheme string, rawURL string) (CSVSource, error) {
+	sourceOpenersMu.RLock()
+	open := sourceOpeners[scheme]
+	sourceOpenersMu.RUnlock()
+	if open == nil {
+		return nil, fmt.Errorf("unsupported input %s: no source for %s:// URLs", rawURL, scheme)
+	}
+	return open(rawURL)
+}
+
+// httpClient downloads the remote inputs, there is no overall timeout as the body is streamed as long as the
+// import runs
+var httpClient = &http.Client{Transport: &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	ResponseHeaderTimeout: 30 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+}}
+
+// OpenHTTPSource streams the CSV file (or tar.gz archive) at an http:// or https:// URL
+func OpenHTTPSource(rawURL string) (CSVSource, error) {
+	log.Printf("Open CSV URL '%s'\n", rawURL)
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return openStream(rawURL, req)
+}
+
+// openStream sends req and returns a source with the body of the response
+func openStream(name string, req *http.Request) (CSVSource, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error opening %s: %s", name, resp.Status)
+	}
+
+	lower := strings.ToLower(req.URL.Path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		resp.Body.Close()
+		return nil, fmt.Errorf("zip archive %s can't be streamed, download it first", name)
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("error opening tar.gz archive %s: %w", name, err)
+		}
+		return &tarGzSource{archive: resp.Body, gz: gz, tar: tar.NewReader(gz)}, nil
+	}
+	reader, compressed, err := decompress(name, resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	s := &streamSource{name: name, body: resp.Body, reader: reader}
+	// the progress counts decompressed bytes, ContentLength is -1 if the server doesn't send it
+	if !compressed {
+		s.size = max(resp.ContentLength, 0)
+	}
+	return s, nil
+}
+
+// streamSource is a source with a single CSV file read from the body of a response
+type streamSource struct {
+	name   string
+	body   io.ReadCloser
+	reader io.Reader
+	size   int64
+	read   bool
+}
+
+func (s *streamSource) Next() (string, io.Reader, error) {
+	if s.read {
+		return "", nil, io.EOF
+	}
+	s.read = true
+	return s.name, s.reader, nil
+}
+
+func (s *streamSource) Size() int64 {
+	return s.size
+}
+
+func (s *streamSource) Close() error {
+	return s.body.Close()
+}
+
+// awsCredentials are the AWS credentials from the environment, S3 requests without them are sent unsigned
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// awsEnvCredentials reads the credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+func awsEnvCredentials() (awsCredentials, error) {
+	creds := awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if (creds.accessKeyID == "") != (creds.secretAccessKey == "") {
+		return creds, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set together")
+	}
+	return creds, nil
+}
+
+// awsRegion is the region of the AWS environment variables
+func awsRegion() string {
+	return cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+}
+
+// s3Config reads the region, the endpoint and the credentials of S3 from the standard AWS environment variables.
+// AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL) points to an S3 compatible store like MinIO, which is addressed
+// path-style.
+func s3Config() (region string, endpoint string, creds awsCredentials, err error) {
+	region = awsRegion()
+	endpoint = cmp.Or(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"))
+	if creds, err = awsEnvCredentials(); err != nil {
+		return "", "", creds, err
+	}
+	return region, endpoint, creds, nil
+}
+
+// OpenS3Source streams the CSV file (or tar.gz archive) at an s3://bucket/key URL. The request is signed with the
+// credentials from the environment (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN), without them
+// only public objects can be read.
+func OpenS3Source(rawURL string) (CSVSource, error) {
+	log.Printf("Open S3 object '%s'\n", rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid S3 URL %s, must be s3://bucket/key", rawURL)
+	}
+	region, endpoint, creds, err := s3Config()
+	if err != nil {
+		return nil, err
+	}
+
+	var object *url.URL
+	if endpoint != "" {
+		if object, err = url.Parse(endpoint); err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint %s: %w", endpoint, err)
+		}
+		object.Path = strings.TrimSuffix(object.Path, "/") + "/" + bucket + "/" + key
+	} else {
+		object = &url.URL{Scheme: "https", Host: bucket + ".s3." + region + ".amazonaws.com", Path: "/" + key}
+	}
+	object.RawPath = s3EscapePath(object.Path)
+
+	req, err := http.NewRequest(http.MethodGet, object.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if creds.accessKeyID != "" {
+		signAWSRequest(req, creds, region, "s3", "UNSIGNED-PAYLOAD", time.Now())
+	}
+	return openStream(rawURL, req)
+}
+
+// s3EscapePath escapes every byte of p but the unreserved characters and /, as the signature requires
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// signAWSRequest signs req to service with AWS signature version 4, all headers of req and its host are signed.
+// payloadHash is the hex SHA-256 of the body or UNSIGNED-PAYLOAD.
+func signAWSRequest(req *http.Request, creds awsCredentials, region string, service string, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := awsScope(amzDate, region, service)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery,
+		canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKeyID, scope, signedHeaders, awsSignature(creds, region, service, amzDate, canonicalRequest)))
+}
+
+// awsScope is the credential scope of a signature made at amzDate for service in region
+func awsScope(amzDate string, region string, service string) string {
+	return amzDate[:8] + "/" + region + "/" + service + "/aws4_request"
+}
+
+// awsSignature returns the hex signature version 4 of canonicalRequest made at amzDate for service in region
+func awsSignature(creds awsCredentials, region string, service string, amzDate string, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + awsScope(amzDate, region, service) + "\n" + hex.EncodeToString(requestHash[:])
+	key := []byte("AWS4" + creds.secretAccessKey)
+	for _, part := range []string{amzDate[:8], region, service, "aws4_request", stringToSign} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(key)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
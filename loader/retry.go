@@ -0,0 +1,99 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// backoff strategies accepted by -backoff-strategy
+const (
+	BackoffFixed             = "fixed"
+	BackoffExponential       = "exponential"
+	BackoffExponentialJitter = "exponential-jitter"
+)
+
+var backoffStrategies = []string{BackoffFixed, BackoffExponential, BackoffExponentialJitter}
+
+// Backoff calculates the delay before retrying a failed batch
+type Backoff struct {
+	Strategy string
+	// Base is the delay of the first retry (fixed: of every retry)
+	Base time.Duration
+	// Max caps the delay
+	Max time.Duration
+}
+
+// Delay returns the delay before retry number attempt (0 for the first retry). The jitter strategy picks a
+// random delay between 0 and the exponential delay ("full jitter"), so workers failing at the same time
+// don't retry at the same time again.
+func (b Backoff) Delay(attempt int, rnd *rand.Rand) time.Duration {
+	if b.Strategy == BackoffFixed {
+		return min(b.Base, b.Max)
+	}
+	delay := b.Max
+	// stop doubling before the shift overflows
+	if attempt < 32 && b.Base<<attempt > 0 {
+		delay = min(b.Base<<attempt, b.Max)
+	}
+	if b.Strategy == BackoffExponentialJitter && delay > 0 {
+		delay = time.Duration(rnd.Int63n(int64(delay) + 1))
+	}
+	return delay
+}
+
+// Validate checks the strategy and the delays
+func (b Backoff) Validate() error {
+	valid := false
+	for _, s := range backoffStrategies {
+		valid = valid || b.Strategy == s
+	}
+	if !valid {
+		return fmt.Errorf("invalid backoff strategy '%s', allowed are: %s", b.Strategy, strings.Join(backoffStrategies, ", "))
+	}
+	if b.Base < 0 || b.Max < b.Base {
+		return fmt.Errorf("invalid backoff delays base %s max %s, base must not be negative and max at least base", b.Base, b.Max)
+	}
+	return nil
+}
+
+// retryableErrors are the MySQL error numbers a batch is retried for by default: lock wait timeout, deadlock and
+// too many connections
+var retryableErrors = []uint16{1205, 1213, 1040}
+
+// isRetryable reports whether a failed batch may succeed when executed again, that is whether it failed with one
+// of the -retry-errors
+func (c *Config) isRetryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	numbers := c.RetryErrors
+	if numbers == nil {
+		numbers = retryableErrors
+	}
+	for _, n := range numbers {
+		if mysqlErr.Number == n {
+			return true
+		}
+	}
+	return false
+}
+
+// parseErrorNumbers parses a comma separated list of MySQL error numbers
+func parseErrorNumbers(s string) ([]uint16, error) {
+	var numbers []uint16
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.ParseUint(strings.TrimSpace(f), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MySQL error number '%s'", f)
+		}
+		numbers = append(numbers, uint16(n))
+	}
+	return numbers, nil
+}
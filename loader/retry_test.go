@@ -0,0 +1,104 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"gotest.tools/v3/assert"
+)
+
+// delays returns the first n retry delays of a backoff
+func delays(b Backoff, n int, rnd *rand.Rand) []time.Duration {
+	d := make([]time.Duration, n)
+	for i := range d {
+		d[i] = b.Delay(i, rnd)
+	}
+	return d
+}
+
+func TestBackoffFixed(t *testing.T) {
+	b := Backoff{Strategy: BackoffFixed, Base: 100 * time.Millisecond, Max: time.Second}
+	assert.DeepEqual(t, delays(b, 4, nil), []time.Duration{
+		100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond,
+	})
+}
+
+func TestBackoffExponential(t *testing.T) {
+	b := Backoff{Strategy: BackoffExponential, Base: 100 * time.Millisecond, Max: time.Second}
+	assert.DeepEqual(t, delays(b, 6, nil), []time.Duration{
+		100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second,
+	})
+	assert.Equal(t, b.Delay(100, nil), time.Second, "large attempts must not overflow")
+}
+
+func TestBackoffExponentialJitter(t *testing.T) {
+	b := Backoff{Strategy: BackoffExponentialJitter, Base: 100 * time.Millisecond, Max: time.Second}
+	d := delays(b, 6, rand.New(rand.NewSource(42)))
+	// the same seed gives the same sequence
+	assert.DeepEqual(t, d, delays(b, 6, rand.New(rand.NewSource(42))))
+	for i, delay := range d {
+		upper := min(100*time.Millisecond<<i, time.Second)
+		assert.Assert(t, delay >= 0 && delay <= upper, "delay %d is %s, should be within [0, %s]", i, delay, upper)
+	}
+	// different seeds (workers) should not retry in lockstep
+	assert.Assert(t, fmt.Sprint(d) != fmt.Sprint(delays(b, 6, rand.New(rand.NewSource(43)))))
+}
+
+func TestBackoffValidate(t *testing.T) {
+	_, err := ParseFlags([]string{"-backoff-strategy", "linear"})
+	assert.ErrorContains(t, err, "invalid backoff strategy")
+	_, err = ParseFlags([]string{"-backoff-base", "2s", "-backoff-max", "1s"})
+	assert.ErrorContains(t, err, "invalid backoff delays")
+	c, err := ParseFlags([]string{})
+	assert.NilError(t, err)
+	assert.Equal(t, c.Backoff.Strategy, BackoffExponentialJitter, "jitter is the default")
+}
+
+func TestIsRetryable(t *testing.T) {
+	l := newTestLoader()
+	assert.Assert(t, l.config.isRetryable(&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}))
+	assert.Assert(t, l.config.isRetryable(fmt.Errorf("batch: %w", &mysql.MySQLError{Number: 1205})))
+	assert.Assert(t, !l.config.isRetryable(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}))
+	assert.Assert(t, !l.config.isRetryable(errors.New("something else")))
+}
+
+func TestRetryErrors(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-retry-errors", "1205, 1213,3572"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, l.config.RetryErrors, []uint16{1205, 1213, 3572})
+	assert.Assert(t, l.config.isRetryable(&mysql.MySQLError{Number: 3572, Message: "Statement aborted because lock(s) could not be acquired"}))
+
+	_, err = ParseFlags([]string{"-retry-errors", "1205,deadlock"})
+	assert.ErrorContains(t, err, "invalid MySQL error number 'deadlock'")
+}
+
+func TestWorkerRetriesDeadlock(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.MaxRetries = 3
+	defer l.batchRetries.Store(0)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	const query = "INSERT INTO `domain` (`Domain`) VALUES (?), (?)"
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	mock.ExpectExec(query).WithArgs("a", "b").WillReturnError(deadlock)
+	mock.ExpectExec(query).WithArgs("a", "b").WillReturnError(deadlock)
+	mock.ExpectExec(query).WithArgs("a", "b").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	jobs := make(chan Job, 2)
+	jobs <- Job{Row: 1, Values: []string{"a"}}
+	jobs <- Job{Row: 2, Values: []string{"b"}}
+	close(jobs)
+	assert.NilError(t, l.worker(context.Background(), 0, db, jobs, l.newBatchQueries("domain", []string{"Domain"}), nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, l.rowsInserted.Load(), int64(2))
+	assert.Equal(t, l.batchRetries.Load(), int64(2))
+}
@@ -0,0 +1,112 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RollbackResult is what the rollback command deleted from a table, or would delete with -dry-run
+type RollbackResult struct {
+	Table   string
+	Rows    int64
+	Batches int
+}
+
+// Rollback deletes the rows a run inserted with -lineage from its tables: the rows whose load_id is the -run-id of
+// the run. With MySQL the rows are deleted -batch-size at a time, so no statement holds the locks of all of them, the
+// other dialects delete them with a single statement. A dry run only counts them.
+type Rollback struct {
+	db     *sql.DB
+	config Config
+}
+
+// NewRollback deletes the rows of the run c.RunID from the tables of c in db
+func NewRollback(db *sql.DB, c Config) *Rollback {
+	return &Rollback{db: db, config: c}
+}
+
+// Run deletes the rows of the run from the -table, or from the tables of the -config file in reverse order, so the
+// rows of a child table go before the ones of their parent. An interrupted or failed rollback returns the rows
+// deleted so far, running it again deletes the rest.
+func (r *Rollback) Run(ctx context.Context) ([]RollbackResult, error) {
+	if err := r.config.validateRollback(); err != nil {
+		return nil, err
+	}
+	tables := []string{r.config.Table}
+	if len(r.config.Tables) > 0 {
+		tables = tables[:0]
+		for i := len(r.config.Tables) - 1; i >= 0; i-- {
+			tables = append(tables, r.config.Tables[i].Table)
+		}
+	}
+	var results []RollbackResult
+	for _, table := range tables {
+		result, err := r.rollback(ctx, table)
+		results = append(results, result)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// rollback deletes the rows of the run from table
+func (r *Rollback) rollback(ctx context.Context, table string) (RollbackResult, error) {
+	result := RollbackResult{Table: table}
+	if r.config.DryRun {
+		query, _ := bindPlaceholders(r.config.dialect(), fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ?", quoteTable(r.config.dialect(), table), quoteIdentifier(r.config.dialect(), LineageID)), 0)
+		if err := r.db.QueryRowContext(ctx, query, r.config.RunID).Scan(&result.Rows); err != nil {
+			return result, fmt.Errorf("counting the rows of run %s in table %s failed: %w", r.config.RunID, table, err)
+		}
+		log.Printf("Dry run, %d rows of run %s would be deleted from table %s", result.Rows, r.config.RunID, table)
+		return result, nil
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", quoteTable(r.config.dialect(), table), quoteIdentifier(r.config.dialect(), LineageID))
+	limit := 0
+	if r.config.isMySQL() {
+		limit = r.config.BatchSize
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	query, _ = bindPlaceholders(r.config.dialect(), query, 0)
+	for {
+		res, err := r.db.ExecContext(ctx, query, r.config.RunID)
+		if err != nil {
+			return result, fmt.Errorf("deleting the rows of run %s from table %s failed after %d rows: %w", r.config.RunID, table, result.Rows, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+		result.Rows += n
+		result.Batches++
+		if limit == 0 || n < int64(limit) {
+			break
+		}
+		log.Debugf("Deleted %d rows of run %s from table %s so far", result.Rows, r.config.RunID, table)
+	}
+	log.Printf("Deleted %d rows of run %s from table %s in %d batches", result.Rows, r.config.RunID, table, result.Batches)
+	return result, nil
+}
+
+// validateRollback checks the options of the rollback command, which deletes the rows of a single run by their
+// load_id
+func (c *Config) validateRollback() error {
+	if c.RunID == "" {
+		return fmt.Errorf("rollback requires -run-id, the run whose rows are deleted")
+	}
+	if c.Table == "" && len(c.Tables) == 0 {
+		return fmt.Errorf("rollback requires -table or a -config file with tables")
+	}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"route", len(c.Routes) > 0}, {"shard", len(c.Shards) > 0}, {"table-template", c.TableTemplate != ""}} {
+		if f.set {
+			return fmt.Errorf("-%s can't be combined with rollback, it deletes from the tables given by -table or the -config file", f.name)
+		}
+	}
+	return nil
+}
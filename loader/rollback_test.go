@@ -0,0 +1,55 @@
+package loader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestRollback(t *testing.T) {
+	c, err := ParseFlags([]string{"-table", "people", "-run-id", "3f2a", "-batch-size", "2"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	// the rows are deleted until a batch deletes less than -batch-size
+	for _, n := range []int64{2, 2, 1} {
+		mock.ExpectExec("DELETE FROM `people` WHERE `load_id` = ? LIMIT 2").WithArgs("3f2a").WillReturnResult(sqlmock.NewResult(0, n))
+	}
+
+	results, err := NewRollback(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.DeepEqual(t, results, []RollbackResult{{Table: "people", Rows: 5, Batches: 3}})
+}
+
+func TestRollbackDryRunTables(t *testing.T) {
+	c, err := ParseFlags([]string{"-run-id", "3f2a", "-dry-run", "-dialect", "postgres"})
+	assert.NilError(t, err)
+	c.Tables = []Config{{Table: "customers"}, {Table: "orders"}}
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	// the child tables go first
+	mock.ExpectQuery(`SELECT COUNT(*) FROM "orders" WHERE "load_id" = $1`).WithArgs("3f2a").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+	mock.ExpectQuery(`SELECT COUNT(*) FROM "customers" WHERE "load_id" = $1`).WithArgs("3f2a").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	results, err := NewRollback(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.DeepEqual(t, results, []RollbackResult{{Table: "orders", Rows: 7}, {Table: "customers", Rows: 3}})
+
+	for want, args := range map[string][]string{
+		"rollback requires -run-id":                       {},
+		"-table-template can't be combined with rollback": {"-run-id", "3f2a", "-table-template", "domain_{{date}}"},
+	} {
+		c, err := ParseFlags(args)
+		assert.NilError(t, err)
+		_, err = NewRollback(nil, c).Run(context.Background())
+		assert.ErrorContains(t, err, want)
+	}
+}
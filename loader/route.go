@@ -0,0 +1,288 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// handling of the rows matching no -route
+const (
+	// RouteUnmatchedTable inserts them into the target table with all columns
+	RouteUnmatchedTable = "table"
+	// RouteUnmatchedSkip leaves them out, they are counted as unrouted
+	RouteUnmatchedSkip = "skip"
+	// RouteUnmatchedFail stops the import
+	RouteUnmatchedFail = "fail"
+)
+
+var routeUnmatchedModes = []string{RouteUnmatchedTable, RouteUnmatchedSkip, RouteUnmatchedFail}
+
+// Route sends the rows whose CSV column Column has one of Values to Table, inserting Columns (table columns of the
+// mapping, all of them if empty)
+type Route struct {
+	Column  string
+	Values  []string
+	Table   string
+	Columns []string
+	// index of Column in the row, set by Config.ResolveColumns
+	index int
+	// indexes of Columns in the inserted columns, set by Config.ResolveColumns
+	columnIndexes []int
+}
+
+// ParseRoute parses a route given as column=value[|value...]:table[:column,column...]
+func ParseRoute(s string) (Route, error) {
+	parts := strings.Split(s, ":")
+	column, values, ok := strings.Cut(parts[0], "=")
+	if !ok || column == "" || len(parts) < 2 || len(parts) > 3 || parts[1] == "" {
+		return Route{}, fmt.Errorf("invalid route '%s', must be column=value[|value...]:table[:column,column...]", s)
+	}
+	r := Route{Column: column, Values: strings.Split(values, "|"), Table: parts[1]}
+	if len(parts) == 3 && parts[2] != "" {
+		r.Columns = strings.Split(parts[2], ",")
+	}
+	return r, nil
+}
+
+func (r Route) String() string {
+	s := r.Column + "=" + strings.Join(r.Values, "|") + ":" + r.Table
+	if len(r.Columns) > 0 {
+		s += ":" + strings.Join(r.Columns, ",")
+	}
+	return s
+}
+
+// resolveRoutes looks up the columns of the routes in the CSV headers and the inserted columns
+func (c *Config) resolveRoutes(headers []string, columns []string) error {
+	for i := range c.Routes {
+		r := &c.Routes[i]
+		if err := c.checkIdentifiers(r.Table, r.Columns); err != nil {
+			return fmt.Errorf("route %s: %w", r, err)
+		}
+		index, err := columnIndex(headers, r.Column)
+		if err != nil {
+			return fmt.Errorf("route %s: %w", r, err)
+		}
+		r.index = index
+		r.columnIndexes = nil
+		for _, column := range r.Columns {
+			index, err := columnIndex(columns, column)
+			if err != nil {
+				return fmt.Errorf("route %s: %w", r, err)
+			}
+			r.columnIndexes = append(r.columnIndexes, index)
+		}
+	}
+	return nil
+}
+
+// checkRouteColumns checks the inserted columns of the routes against the information schema like the ones of
+// the target table
+func (l *Loader) checkRouteColumns(ctx context.Context) error {
+	if l.config.DryRun || !l.config.isMySQL() {
+		return nil
+	}
+	for _, r := range l.config.Routes {
+		known, err := TableColumns(ctx, l.DB, r.Table)
+		if err != nil {
+			log.Warnf("Could not read the columns of table %s: %s", r.Table, err.Error())
+			continue
+		}
+		columns := r.Columns
+		if len(columns) == 0 {
+			columns = l.config.InsertColumns(l.headers)
+		}
+		if err = CheckTableColumns(r.Table, columns, known); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRoutes checks the -route options
+func (c *Config) validateRoutes() error {
+	if !slices.Contains(routeUnmatchedModes, c.RouteUnmatched) {
+		return fmt.Errorf("invalid route-unmatched '%s', allowed are: %s", c.RouteUnmatched, strings.Join(routeUnmatchedModes, ", "))
+	}
+	if len(c.Routes) == 0 {
+		return nil
+	}
+	tables := make(map[string]bool, len(c.Routes))
+	for _, r := range c.Routes {
+		if tables[r.Table] || r.Table == c.Table && c.RouteUnmatched == RouteUnmatchedTable {
+			return fmt.Errorf("table %s gets the rows of two routes (or of a route and -route-unmatched table), a table has a single column list", r.Table)
+		}
+		tables[r.Table] = true
+	}
+	// the other options name a single target table or shard the rows by themselves
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"table-template", c.TableTemplate != ""}, {"staging-table", c.StagingTable != ""}, {"create-table", c.CreateTable},
+		{"verify", c.Verify}, {"partition-by-worker", c.PartitionBy != ""},
+		{"mask-columns", len(c.MaskColumns) > 0}} {
+		if f.set {
+			return fmt.Errorf("-route can't be combined with -%s", f.name)
+		}
+	}
+	return nil
+}
+
+// Router picks the target table of every row by the -routes. The rows of a table are
+// inserted with the columns of its route by workers of their own (see byTable). A nil *Router routes nothing.
+type Router struct {
+	routes    []Route
+	unmatched string
+	// tables are the target tables, the default table ("") first when the unmatched rows are inserted into it
+	tables []string
+	// byTable are the routes by target table
+	byTable map[string]*Route
+	skipped atomic.Int64
+}
+
+// NewRouter routes the rows by routes, with the columns resolved by Config.ResolveColumns
+func NewRouter(routes []Route, unmatched string) *Router {
+	r := &Router{routes: routes, unmatched: unmatched, byTable: make(map[string]*Route, len(routes))}
+	if unmatched == RouteUnmatchedTable {
+		r.tables = append(r.tables, "")
+	}
+	for i := range routes {
+		r.tables = append(r.tables, routes[i].Table)
+		r.byTable[routes[i].Table] = &routes[i]
+	}
+	return r
+}
+
+// Route returns the table of row (empty for the target table), skip reports a row matching no route which is left
+// out. number is the row number for the error of an unmatched row.
+func (r *Router) Route(row []string, number int) (table string, skip bool, err error) {
+	if r == nil {
+		return "", false, nil
+	}
+	for _, route := range r.routes {
+		if route.index < len(row) && slices.Contains(route.Values, row[route.index]) {
+			return route.Table, false, nil
+		}
+	}
+	switch r.unmatched {
+	case RouteUnmatchedSkip:
+		r.skipped.Add(1)
+		log.Debugf("Row %d matches no route, it is skipped", number)
+		return "", true, nil
+	case RouteUnmatchedFail:
+		return "", false, fmt.Errorf("row %d matches no -route", number)
+	}
+	return "", false, nil
+}
+
+// Tables returns the tables the rows are routed to, "" is the target table
+func (r *Router) Tables() []string {
+	if r == nil {
+		return nil
+	}
+	return r.tables
+}
+
+// Columns returns the inserted columns of the route of table out of columns, the inserted columns of the mapping,
+// nil for a table without a route or a route inserting all columns
+func (r *Router) Columns(table string, columns []string) []string {
+	route := r.route(table)
+	if route == nil {
+		return nil
+	}
+	selected := make([]string, len(route.columnIndexes))
+	for i, index := range route.columnIndexes {
+		selected[i] = columns[index]
+	}
+	return selected
+}
+
+// Skipped returns the number of rows matching no route which were left out
+func (r *Router) Skipped() int64 {
+	if r == nil {
+		return 0
+	}
+	return r.skipped.Load()
+}
+
+// route returns the route of table if it selects columns
+func (r *Router) route(table string) *Route {
+	if r == nil || table == "" {
+		return nil
+	}
+	if route := r.byTable[table]; route != nil && len(route.columnIndexes) > 0 {
+		return route
+	}
+	return nil
+}
+
+// project returns the values of the columns of the route of table out of the values of rows rows with all
+// inserted columns
+func project[T any](router *Router, table string, values []T, rows int) []T {
+	route := router.route(table)
+	if route == nil || rows == 0 {
+		return values
+	}
+	width := len(values) / rows
+	projected := make([]T, 0, rows*len(route.columnIndexes))
+	for i := 0; i < rows; i++ {
+		row := values[i*width : (i+1)*width]
+		for _, index := range route.columnIndexes {
+			projected = append(projected, row[index])
+		}
+	}
+	return projected
+}
+
+// bindTableArgs are the bindArgs of a batch of table
+func (l *Loader) bindTableArgs(table string, values []string, rows int) []any {
+	return project(l.router, table, l.config.bindArgs(values, rows), rows)
+}
+
+// byTable returns a pick function for newJobShards which keeps the rows of every table on workers of their own, so
+// the batches aren't cut short by the rows of another table. The workers are dealt out to the tables in turn (the
+// workers t, t+len(tables), ... get the rows of table t round robin), with fewer workers than tables several tables
+// share a worker.
+func byTable(tables []string, n int) func(job Job) int {
+	slots := len(tables)
+	next := make([]int, slots)
+	return func(job Job) int {
+		t := max(0, slices.Index(tables, job.Table))
+		if n <= slots {
+			return t % n
+		}
+		workers := (n - t + slots - 1) / slots
+		w := t + next[t]*slots
+		next[t] = (next[t] + 1) % workers
+		return w
+	}
+}
+
+type routeFlag struct {
+	routes *[]Route
+}
+
+func (f routeFlag) String() string {
+	if f.routes == nil {
+		return ""
+	}
+	specs := make([]string, len(*f.routes))
+	for i, r := range *f.routes {
+		specs[i] = r.String()
+	}
+	return strings.Join(specs, " ")
+}
+
+func (f routeFlag) Set(value string) error {
+	r, err := ParseRoute(value)
+	if err != nil {
+		return err
+	}
+	*f.routes = append(*f.routes, r)
+	return nil
+}
@@ -0,0 +1,91 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseRoute(t *testing.T) {
+	r, err := ParseRoute("type=refund|chargeback:refunds:id,amount")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, r, Route{Column: "type", Values: []string{"refund", "chargeback"}, Table: "refunds", Columns: []string{"id", "amount"}},
+		cmp.AllowUnexported(Route{}))
+	assert.Equal(t, r.String(), "type=refund|chargeback:refunds:id,amount")
+	r, err = ParseRoute("type=order:orders")
+	assert.NilError(t, err)
+	assert.Equal(t, r.Table, "orders")
+	assert.Assert(t, r.Columns == nil)
+
+	for _, s := range []string{"type:orders", "=order:orders", "type=order", "type=order:", "type=order:orders:id:amount"} {
+		_, err = ParseRoute(s)
+		assert.ErrorContains(t, err, "invalid route '"+s+"'")
+	}
+}
+
+func TestByTable(t *testing.T) {
+	pick := byTable([]string{"", "orders", "refunds"}, 5)
+	var workers []int
+	for _, table := range []string{"", "", "", "orders", "orders", "orders", "refunds", "refunds"} {
+		workers = append(workers, pick(Job{Table: table}))
+	}
+	assert.DeepEqual(t, workers, []int{0, 3, 0, 1, 4, 1, 2, 2})
+	// fewer workers than tables share them
+	pick = byTable([]string{"", "orders", "refunds"}, 2)
+	assert.Equal(t, pick(Job{Table: "refunds"}), 0)
+	assert.Equal(t, pick(Job{Table: "orders"}), 1)
+}
+
+func TestImportRoutes(t *testing.T) {
+	l := withConnConfig(t, 5)
+	filename := filepath.Join(t.TempDir(), "payments.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("type,id,amount\norder,1,10\nrefund,2,5\ntransfer,3,7\norder,4,20\nchargeback,5,9\n"), 0o644))
+	var err error
+	l.config, err = ParseFlags([]string{"-csv", filename, "-dialect", "sqlite", "-table", "payments", "-workers", "2", "-batch-size", "10",
+		"-route", "type=order:orders:id,amount", "-route", "type=refund|chargeback:refunds:id", "-route-unmatched", "skip"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectExec(`INSERT INTO "orders" ("id","amount") VALUES (?,?), (?,?)`).WithArgs("1", "10", "4", "20").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO "refunds" ("id") VALUES (?), (?)`).WithArgs("2", "5").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	stats, err := New(db, l.config).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.RowsRead, int64(5))
+	assert.Equal(t, stats.RowsUnrouted, int64(1))
+	assert.Equal(t, stats.Unaccounted(), int64(0))
+}
+
+func TestImportRouteUnmatchedFail(t *testing.T) {
+	l := withConnConfig(t, 5)
+	filename := filepath.Join(t.TempDir(), "payments.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("type,id\norder,1\ntransfer,2\n"), 0o644))
+	var err error
+	l.config, err = ParseFlags([]string{"-csv", filename, "-dry-run", "-route", "type=order:orders", "-route-unmatched", "fail"})
+	assert.NilError(t, err)
+	_, err = New(nil, l.config).Run(context.Background())
+	assert.ErrorContains(t, err, "row 2 matches no -route")
+}
+
+func TestRouteFlags(t *testing.T) {
+	for want, args := range map[string][]string{
+		"invalid route 'type:orders'":                        {"-route", "type:orders"},
+		"invalid route-unmatched 'drop'":                     {"-route-unmatched", "drop"},
+		"-route can't be combined with -create-table":        {"-route", "type=order:orders", "-create-table"},
+		"-route can't be combined with -partition-by-worker": {"-route", "type=order:orders", "-partition-by-worker", "type"},
+		"table orders gets the rows of two routes":           {"-route", "type=order:orders", "-route", "type=sale:orders"},
+		"table domain gets the rows of two routes (or of a":  {"-table", "domain", "-route", "type=order:domain"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want, args)
+	}
+}
@@ -0,0 +1,82 @@
+package loader
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Sampler keeps a share of the rows for -sample. Whether a row is kept only depends on its number and the seed,
+// so a run with the same seed loads the same rows. A nil *Sampler keeps every row.
+type Sampler struct {
+	threshold uint64
+	seed      uint64
+	skipped   atomic.Int64
+}
+
+// NewSampler keeps the share rate (0 < rate <= 1) of the rows, picked by seed (0 picks a random seed)
+func NewSampler(rate float64, seed int64) *Sampler {
+	s := &Sampler{seed: uint64(seed)}
+	if seed == 0 {
+		s.seed = rand.Uint64()
+		log.Printf("Sampling %s of the rows with -sample-seed %d", formatSampleRate(rate), int64(s.seed))
+	}
+	// a row is kept if its hash is in the first rate of all values
+	if t := math.Ldexp(rate, 64); t >= math.Ldexp(1, 64) {
+		s.threshold = math.MaxUint64
+	} else {
+		s.threshold = uint64(t)
+	}
+	return s
+}
+
+// Keep reports whether the row number is in the sample, the others are counted as skipped
+func (s *Sampler) Keep(number int) bool {
+	if s == nil {
+		return true
+	}
+	if mix64(s.seed^uint64(number)) <= s.threshold {
+		return true
+	}
+	s.skipped.Add(1)
+	return false
+}
+
+// Skipped returns the rows left out of the sample
+func (s *Sampler) Skipped() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.skipped.Load()
+}
+
+// mix64 is the finalizer of SplitMix64, which spreads consecutive numbers evenly over all values
+func mix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// parseSampleRate parses a -sample given as percentage (1%) or fraction (0.01)
+func parseSampleRate(s string) (float64, error) {
+	value, percent := strings.CutSuffix(strings.TrimSpace(s), "%")
+	rate, err := strconv.ParseFloat(value, 64)
+	if percent {
+		rate /= 100
+	}
+	if err != nil || math.IsNaN(rate) || rate <= 0 || rate > 1 {
+		return 0, fmt.Errorf("invalid sample '%s', must be a percentage (1%%) or fraction (0.01) above 0 and up to 100%%", s)
+	}
+	return rate, nil
+}
+
+// formatSampleRate formats a -sample rate as percentage
+func formatSampleRate(rate float64) string {
+	return strconv.FormatFloat(rate*100, 'f', -1, 64) + "%"
+}
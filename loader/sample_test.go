@@ -0,0 +1,97 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseSampleRate(t *testing.T) {
+	for s, want := range map[string]float64{"1%": 0.01, "0.25": 0.25, " 50% ": 0.5, "100%": 1, "1": 1} {
+		rate, err := parseSampleRate(s)
+		assert.NilError(t, err)
+		assert.Equal(t, rate, want, s)
+	}
+	for _, s := range []string{"0", "0%", "101%", "1.5", "-1%", "abc", "NaN"} {
+		_, err := parseSampleRate(s)
+		assert.ErrorContains(t, err, "invalid sample '"+s+"'")
+	}
+}
+
+func TestSampler(t *testing.T) {
+	kept := func(s *Sampler) []int {
+		var rows []int
+		for row := 1; row <= 10000; row++ {
+			if s.Keep(row) {
+				rows = append(rows, row)
+			}
+		}
+		return rows
+	}
+	s := NewSampler(0.1, 42)
+	rows := kept(s)
+	assert.Assert(t, len(rows) > 900 && len(rows) < 1100, len(rows))
+	assert.Equal(t, s.Skipped(), int64(10000-len(rows)))
+	// the same seed picks the same rows, another seed other ones
+	assert.DeepEqual(t, kept(NewSampler(0.1, 42)), rows)
+	assert.Assert(t, fmt.Sprint(kept(NewSampler(0.1, 43))) != fmt.Sprint(rows))
+	assert.Equal(t, len(kept(NewSampler(1, 42))), 10000)
+	var nilSampler *Sampler
+	assert.Assert(t, nilSampler.Keep(1))
+	assert.Equal(t, nilSampler.Skipped(), int64(0))
+}
+
+func TestParseFlagsRowSelection(t *testing.T) {
+	c, err := ParseFlags([]string{"-skip-rows", "10", "-limit", "100", "-sample", "5%", "-sample-seed", "7"})
+	assert.NilError(t, err)
+	assert.Equal(t, c.SkipRows(), 10)
+	assert.Equal(t, c.MaxLines, 100)
+	assert.Equal(t, c.Sample, 0.05)
+	assert.Equal(t, c.SampleSeed, int64(7))
+
+	for want, args := range map[string][]string{
+		"invalid skip-rows -1, must not be negative":          {"-skip-rows", "-1"},
+		"-skip-rows can't be combined with -resume-from-line": {"-skip-rows", "1", "-resume-from-line", "5"},
+		"-sample-seed requires -sample":                       {"-sample-seed", "7"},
+		"invalid sample '200%'":                               {"-sample", "200%"},
+		"-watch-dir can't be combined with -skip-rows":        {"-watch-dir", t.TempDir(), "-skip-rows", "1"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestImportRowSelection(t *testing.T) {
+	l := withConnConfig(t, 5)
+	var csv strings.Builder
+	csv.WriteString("id\n")
+	for i := 1; i <= 1000; i++ {
+		fmt.Fprintf(&csv, "%d\n", i)
+	}
+	filename := filepath.Join(t.TempDir(), "ids.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte(csv.String()), 0o644))
+	run := func() Stats {
+		var err error
+		l.config, err = ParseFlags([]string{"-csv", filename, "-table", "ids", "-dry-run", "-workers", "1",
+			"-skip-rows", "100", "-limit", "500", "-sample", "10%", "-sample-seed", "3"})
+		assert.NilError(t, err)
+		l.rowsInserted.Store(0)
+		stats, err := New(nil, l.config).Run(context.Background())
+		assert.NilError(t, err)
+		return stats
+	}
+	stats := run()
+	// the sample is taken of the 500 rows after the skipped ones
+	assert.Equal(t, stats.RowsRead, int64(500))
+	assert.Equal(t, stats.RowsSkipped, int64(100))
+	assert.Assert(t, stats.RowsUnsampled > 400 && stats.RowsUnsampled < 480, stats.RowsUnsampled)
+	assert.Equal(t, stats.Committed(), 500-stats.RowsUnsampled)
+	assert.Equal(t, stats.Unaccounted(), int64(0))
+	assert.Equal(t, stats.SuccessRatio(), 1.0)
+	assert.Equal(t, run().RowsUnsampled, stats.RowsUnsampled)
+}
@@ -0,0 +1,350 @@
+package loader
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+)
+
+// SecretProvider returns the secret of a secret store named name, the reference without its scheme and field
+type SecretProvider func(ctx context.Context, name string) (string, error)
+
+// secretProviders are the stores of the -password-from schemes
+var (
+	secretProvidersMu sync.RWMutex
+	secretProviders   = map[string]SecretProvider{
+		"aws-sm": AWSSecret,
+		"vault":  VaultSecret,
+		"gcp-sm": GCPSecret,
+	}
+)
+
+// RegisterSecretProvider makes -password-from read the references of scheme (e.g. "azure-kv") with p, replacing
+// the provider of the scheme if there is one, a nil p removes it
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[strings.ToLower(scheme)] = p
+}
+
+// secretTimeout bounds the requests to the secret stores
+const secretTimeout = 30 * time.Second
+
+// FetchSecret returns the secret of a reference like aws-sm://prod/db or vault://secret/data/db#password, a
+// #field picks the field of a secret which is a JSON object
+func FetchSecret(ctx context.Context, ref string) (string, error) {
+	scheme, ok := urlScheme(ref)
+	if !ok {
+		return "", fmt.Errorf("invalid secret reference %s, must be scheme://name[#field]", ref)
+	}
+	name, field, _ := strings.Cut(ref[len(scheme)+len("://"):], "#")
+	secretProvidersMu.RLock()
+	provider := secretProviders[scheme]
+	secretProvidersMu.RUnlock()
+	if provider == nil {
+		return "", fmt.Errorf("unsupported secret reference %s: no provider for %s:// secrets", ref, scheme)
+	}
+	ctx, cancel := context.WithTimeout(ctx, secretTimeout)
+	defer cancel()
+	secret, err := provider(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("could not read the secret %s: %w", ref, err)
+	}
+	if field == "" {
+		return secret, nil
+	}
+	fields, err := secretFields(secret)
+	if err != nil {
+		return "", fmt.Errorf("secret %s has no field %s, it isn't a JSON object", ref, field)
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %s", ref, field)
+	}
+	return value, nil
+}
+
+// secretFields returns the fields of a secret which is a JSON object, numbers (e.g. a port) as written
+func secretFields(secret string) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(secret), &raw); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(raw))
+	for key, value := range raw {
+		var s string
+		if json.Unmarshal(value, &s) != nil {
+			s = string(value)
+		}
+		fields[key] = s
+	}
+	return fields, nil
+}
+
+// applySecret sets the credentials to the secret of ref: a field or a plain text secret is the password, a JSON
+// object sets the username, password, host, port and dbname of it (the layout of the secrets of RDS)
+func (s *DBSettings) applySecret(ctx context.Context, ref string) error {
+	secret, err := FetchSecret(ctx, ref)
+	if err != nil {
+		return err
+	}
+	fields, err := secretFields(secret)
+	if strings.Contains(ref, "#") || err != nil {
+		s.Password = secret
+		return nil
+	}
+	if _, ok := fields["password"]; !ok {
+		return fmt.Errorf("secret %s has no password field, pick the field of the password with %s#field", ref, ref)
+	}
+	setFromOption(&s.User, fields, "username")
+	setFromOption(&s.Password, fields, "password")
+	setFromOption(&s.Host, fields, "host")
+	setFromOption(&s.Port, fields, "port")
+	setFromOption(&s.Database, fields, "dbname")
+	return nil
+}
+
+// connectionSettings collects the settings of the connection: the environment and the option file, the secret of
+// -password-from and the flags of c, which win
+func connectionSettings(c Config) (DBSettings, error) {
+	settings, err := LoadDBSettings(c.DefaultsFile)
+	if err != nil {
+		return settings, err
+	}
+	if c.PasswordFrom != "" {
+		if err = settings.applySecret(context.Background(), c.PasswordFrom); err != nil {
+			return settings, err
+		}
+		log.Printf("Read the credentials from %s", c.PasswordFrom)
+	}
+	settings.override(c)
+	return settings, nil
+}
+
+// getSecretJSON sends req and decodes the JSON of a successful response into v
+func getSecretJSON(req *http.Request, v any) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
+
+// AWSSecret reads the secret name (or ARN) from AWS Secrets Manager with the credentials and the region of the
+// environment, AWS_ENDPOINT_URL_SECRETS_MANAGER (or AWS_ENDPOINT_URL) points to another endpoint
+func AWSSecret(ctx context.Context, name string) (string, error) {
+	creds, err := awsEnvCredentials()
+	if err != nil {
+		return "", err
+	}
+	if creds.accessKeyID == "" {
+		return "", fmt.Errorf("AWS Secrets Manager requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	region := awsRegion()
+	endpoint := cmp.Or(os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER"), os.Getenv("AWS_ENDPOINT_URL"),
+		"https://secretsmanager."+region+".amazonaws.com")
+	body, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	payloadHash := sha256.Sum256(body)
+	signAWSRequest(req, creds, region, "secretsmanager", hex.EncodeToString(payloadHash[:]), time.Now())
+	var value struct {
+		SecretString *string
+		SecretBinary []byte
+	}
+	if err = getSecretJSON(req, &value); err != nil {
+		return "", err
+	}
+	if value.SecretString != nil {
+		return *value.SecretString, nil
+	}
+	return string(value.SecretBinary), nil
+}
+
+// VaultSecret reads the secret at the path name (e.g. secret/data/db of a KV version 2 engine) from the Vault at
+// VAULT_ADDR with VAULT_TOKEN (or the token of ~/.vault-token) and returns its data as a JSON object
+func VaultSecret(ctx context.Context, name string) (string, error) {
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if b, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				token = strings.TrimSpace(string(b))
+			}
+		}
+	}
+	if token == "" {
+		return "", fmt.Errorf("Vault requires VAULT_TOKEN or a token in ~/.vault-token")
+	}
+	addr := cmp.Or(os.Getenv("VAULT_ADDR"), "https://127.0.0.1:8200")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(name, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err = getSecretJSON(req, &secret); err != nil {
+		return "", err
+	}
+	data := secret.Data
+	// KV version 2 nests the secret in data with its metadata
+	if inner, ok := data["data"]; ok {
+		if _, versioned := data["metadata"]; versioned {
+			return string(inner), nil
+		}
+	}
+	b, err := json.Marshal(data)
+	return string(b), err
+}
+
+// gcpMetadataURL is the token endpoint of the metadata server of Google Cloud, GCE_METADATA_HOST replaces its host
+const gcpMetadataURL = "http://%s/computeMetadata/v1/instance/service-accounts/default/token"
+
+// gcpSecretManagerURL is the endpoint of Google Secret Manager, replaced by the tests
+var gcpSecretManagerURL = "https://secretmanager.googleapis.com/v1/"
+
+// GCPSecret reads the secret name (projects/p/secrets/s, a version of it or the latest one) from Google Secret
+// Manager with the access token of GOOGLE_OAUTH_ACCESS_TOKEN or of the service account of the metadata server
+func GCPSecret(ctx context.Context, name string) (string, error) {
+	token, err := gcpAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpSecretManagerURL+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var version struct {
+		Payload struct {
+			Data []byte `json:"data"`
+		} `json:"payload"`
+	}
+	if err = getSecretJSON(req, &version); err != nil {
+		return "", err
+	}
+	return string(version.Payload.Data), nil
+}
+
+// gcpAccessToken returns GOOGLE_OAUTH_ACCESS_TOKEN or the token of the default service account from the metadata
+// server, service account key files aren't read
+func gcpAccessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(gcpMetadataURL, cmp.Or(os.Getenv("GCE_METADATA_HOST"), "metadata.google.internal")), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err = getSecretJSON(req, &token); err != nil {
+		return "", fmt.Errorf("no GOOGLE_OAUTH_ACCESS_TOKEN and no token of the metadata server: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// rdsTokenLifetime is how long an IAM authentication token of RDS is valid
+const rdsTokenLifetime = 15 * time.Minute
+
+// rdsAuthToken returns the IAM authentication token of user at the RDS instance at host:port, a URL presigned
+// with the AWS credentials for the connect action of rds-db
+func rdsAuthToken(creds awsCredentials, region string, host string, port string, user string, now time.Time) string {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	endpoint := net.JoinHostPort(host, port)
+	query := url.Values{
+		"Action":              {"connect"},
+		"DBUser":              {user},
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {creds.accessKeyID + "/" + awsScope(amzDate, region, "rds-db")},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {fmt.Sprint(int(rdsTokenLifetime.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if creds.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+	rawQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+	emptyHash := sha256.Sum256(nil)
+	canonicalRequest := strings.Join([]string{http.MethodGet, "/", rawQuery, "host:" + endpoint + "\n", "host",
+		hex.EncodeToString(emptyHash[:])}, "\n")
+	return endpoint + "/?" + rawQuery + "&X-Amz-Signature=" + awsSignature(creds, region, "rds-db", amzDate, canonicalRequest)
+}
+
+// openIAMAuthDB opens the pool of the MySQL connections to dsn authenticated with IAM tokens of RDS, every new
+// connection gets a fresh token as they expire after 15 minutes. The token is sent as a cleartext password, so
+// the connection has to be encrypted.
+func openIAMAuthDB(dsn string, settings DBSettings) (*sql.DB, error) {
+	if settings.TLS == "" || settings.TLS == "false" {
+		return nil, fmt.Errorf("-iam-auth requires TLS (DB_TLS or DB_TLS_CA), RDS only accepts the token over an encrypted connection")
+	}
+	if settings.Socket != "" {
+		return nil, fmt.Errorf("-iam-auth can't connect over the socket %s, it needs the host of the RDS instance", settings.Socket)
+	}
+	creds, err := awsEnvCredentials()
+	if err != nil {
+		return nil, err
+	}
+	if creds.accessKeyID == "" {
+		return nil, fmt.Errorf("-iam-auth requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.AllowCleartextPasswords = true
+	region := awsRegion()
+	err = cfg.Apply(mysql.BeforeConnect(func(_ context.Context, cfg *mysql.Config) error {
+		cfg.Passwd = rdsAuthToken(creds, region, settings.Host, settings.Port, settings.User, time.Now())
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
@@ -0,0 +1,127 @@
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestFetchSecretAWS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.Header.Get("X-Amz-Target"), "secretsmanager.GetSecretValue")
+		assert.Assert(t, strings.HasPrefix(r.Header.Get("Authorization"),
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), r.Header.Get("Authorization"))
+		assert.Assert(t, strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request"))
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, string(body), `{"SecretId":"arn:aws:secretsmanager:eu-west-1:1:secret:prod/db"}`)
+		_ = json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"username":"loader","password":"s3cret","host":"db.internal","port":3307}`})
+	}))
+	defer server.Close()
+	t.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", server.URL)
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	ref := "aws-sm://arn:aws:secretsmanager:eu-west-1:1:secret:prod/db"
+	settings := DBSettings{User: "root", Password: "env", Host: "localhost", Port: "3306", Database: "shop"}
+	assert.NilError(t, settings.applySecret(context.Background(), ref))
+	assert.DeepEqual(t, settings, DBSettings{User: "loader", Password: "s3cret", Host: "db.internal", Port: "3307", Database: "shop"})
+
+	password, err := FetchSecret(context.Background(), ref+"#password")
+	assert.NilError(t, err)
+	assert.Equal(t, password, "s3cret")
+	_, err = FetchSecret(context.Background(), ref+"#token")
+	assert.ErrorContains(t, err, "has no field token")
+}
+
+func TestFetchSecretVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/v1/secret/data/db")
+		assert.Equal(t, r.Header.Get("X-Vault-Token"), "hvs.token")
+		_, _ = io.WriteString(w, `{"data":{"data":{"password":"v4ult"},"metadata":{"version":3}}}`)
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "hvs.token")
+
+	password, err := FetchSecret(context.Background(), "vault://secret/data/db#password")
+	assert.NilError(t, err)
+	assert.Equal(t, password, "v4ult")
+	settings := DBSettings{User: "root"}
+	assert.NilError(t, settings.applySecret(context.Background(), "vault://secret/data/db"))
+	assert.DeepEqual(t, settings, DBSettings{User: "root", Password: "v4ult"})
+}
+
+func TestFetchSecretGCP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/v1/projects/shop/secrets/db/versions/latest:access")
+		assert.Equal(t, r.Header.Get("Authorization"), "Bearer ya29.token")
+		// the payload is base64
+		_, _ = io.WriteString(w, `{"payload":{"data":"Z2NwLXBhc3M="}}`)
+	}))
+	defer server.Close()
+	defer func(u string) { gcpSecretManagerURL = u }(gcpSecretManagerURL)
+	gcpSecretManagerURL = server.URL + "/v1/"
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "ya29.token")
+
+	settings := DBSettings{}
+	assert.NilError(t, settings.applySecret(context.Background(), "gcp-sm://projects/shop/secrets/db"))
+	assert.Equal(t, settings.Password, "gcp-pass")
+}
+
+func TestFetchSecretErrors(t *testing.T) {
+	for want, ref := range map[string]string{
+		"invalid secret reference prod/db, must be scheme://name[#field]": "prod/db",
+		"no provider for azure-kv:// secrets":                             "azure-kv://db",
+	} {
+		_, err := FetchSecret(context.Background(), ref)
+		assert.ErrorContains(t, err, want)
+	}
+
+	RegisterSecretProvider("static", func(_ context.Context, name string) (string, error) { return "pw-" + name, nil })
+	defer RegisterSecretProvider("static", nil)
+	password, err := FetchSecret(context.Background(), "static://db")
+	assert.NilError(t, err)
+	assert.Equal(t, password, "pw-db")
+}
+
+func TestRDSAuthToken(t *testing.T) {
+	creds := awsCredentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "secret", sessionToken: "session"}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	token := rdsAuthToken(creds, "eu-west-1", "db.abc.eu-west-1.rds.amazonaws.com", "3306", "loader", now)
+	endpoint, rawQuery, ok := strings.Cut(token, "/?")
+	assert.Assert(t, ok, token)
+	assert.Equal(t, endpoint, "db.abc.eu-west-1.rds.amazonaws.com:3306")
+	query, err := url.ParseQuery(rawQuery)
+	assert.NilError(t, err)
+	assert.Equal(t, query.Get("Action"), "connect")
+	assert.Equal(t, query.Get("DBUser"), "loader")
+	assert.Equal(t, query.Get("X-Amz-Credential"), "AKIDEXAMPLE/20240501/eu-west-1/rds-db/aws4_request")
+	assert.Equal(t, query.Get("X-Amz-Expires"), "900")
+	assert.Equal(t, query.Get("X-Amz-Security-Token"), "session")
+	assert.Equal(t, len(query.Get("X-Amz-Signature")), 64)
+	// the same inputs sign the same token
+	assert.Equal(t, rdsAuthToken(creds, "eu-west-1", "db.abc.eu-west-1.rds.amazonaws.com", "3306", "loader", now), token)
+}
+
+func TestIAMAuthRequiresTLS(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	_, err := openIAMAuthDB("loader@tcp(db:3306)/shop", DBSettings{User: "loader", Host: "db", Port: "3306"})
+	assert.ErrorContains(t, err, "-iam-auth requires TLS")
+
+	db, err := openIAMAuthDB("loader@tcp(db:3306)/shop?tls=true", DBSettings{User: "loader", Host: "db", Port: "3306", TLS: "true"})
+	assert.NilError(t, err)
+	assert.NilError(t, db.Close())
+
+	_, err = ParseFlags([]string{"-iam-auth", "-db-driver", "mysql"})
+	assert.ErrorContains(t, err, "-iam-auth can't be combined with -db-driver")
+}
@@ -0,0 +1,143 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// serveContentTypes are the input formats of the Content-Types accepted by the Server, a request without one is CSV
+var serveContentTypes = map[string]string{
+	"text/csv":             InputFormatCSV,
+	"application/csv":      InputFormatCSV,
+	"application/x-ndjson": InputFormatJSONLines,
+	"application/jsonl":    InputFormatJSONLines,
+}
+
+// Server imports the CSV or NDJSON bodies POSTed to /ingest/{table} with the pipeline of the import, each request
+// is an import of its own Loader, so the requests are imported at the same time, sharing the connection pool of db
+type Server struct {
+	db     *sql.DB
+	config Config
+	tables []string
+}
+
+// NewServer accepts the rows of the -serve-tables of c (the -table if none) and imports them into db
+func NewServer(db *sql.DB, c Config) *Server {
+	tables := c.ServeTables
+	if len(tables) == 0 {
+		tables = []string{c.Table}
+	}
+	return &Server{db: db, config: c, tables: tables}
+}
+
+// Serve listens on -serve-addr until ctx is done, the imports running then stop reading their body and flush the
+// rows read within -shutdown-grace
+func (s *Server) Serve(ctx context.Context) error {
+	if err := s.config.validateServe(); err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", s.config.ServeAddr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", s.config.ServeAddr, err)
+	}
+	server := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context { return ctx }}
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ln) }()
+	log.Printf("Accepting rows for %v on http://%s/ingest/{table}", s.tables, ln.Addr())
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownGrace+time.Second)
+	defer cancel()
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down the server: %w", err)
+	}
+	return nil
+}
+
+// validateServe checks that the options fit a server, every request is an import of its own like a file of
+// -watch-dir, but the requests run at the same time
+func (c *Config) validateServe() error {
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"watch-dir", c.WatchDir != ""}, {"resume", c.Resume}, {"resume-from-line", c.ResumeFromLine > 0}, {"checkpoint-file", c.CheckpointFile != ""}} {
+		if f.set {
+			return fmt.Errorf("serve can't be combined with -%s", f.name)
+		}
+	}
+	// every import creates these files and listens on the address, the imports running at the same time would
+	// overwrite each other's
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"dead-letter-file", c.DeadLetterFile != ""}, {"rejects-file", c.RejectsFile != ""}, {"audit-file", c.AuditFile != ""},
+		{"metrics-addr", c.MetricsAddr != ""}} {
+		if f.set {
+			return fmt.Errorf("serve can't be combined with -%s, the requests are imported at the same time", f.name)
+		}
+	}
+	if len(c.CsvFiles) > 0 {
+		return fmt.Errorf("serve can't be combined with inputs, the rows are POSTed")
+	}
+	return nil
+}
+
+// Handler returns the handler of POST /ingest/{table}, it responds with the Summary of the import as JSON
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /ingest/{table}", s.ingest)
+	return mux
+}
+
+func (s *Server) ingest(w http.ResponseWriter, r *http.Request) {
+	table := r.PathValue("table")
+	if !slices.Contains(s.tables, table) {
+		http.Error(w, fmt.Sprintf("table %s isn't accepted", table), http.StatusNotFound)
+		return
+	}
+	format := InputFormatCSV
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		var ok bool
+		if format, ok = serveContentTypes[mediaType]; err != nil || !ok {
+			http.Error(w, fmt.Sprintf("unsupported Content-Type %s, must be text/csv or application/x-ndjson", contentType),
+				http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	c := s.config
+	c.Table, c.InputFormat = table, format
+	log.Printf("Importing the rows POSTed by %s into %s", r.RemoteAddr, table)
+	stats, err := New(s.db, c).RunReader(r.Context(), r.Body)
+	status := http.StatusOK
+	if err != nil {
+		log.Errorf("Importing the rows POSTed by %s failed: %s", r.RemoteAddr, err.Error())
+		status = http.StatusInternalServerError
+		if errors.Is(err, context.Canceled) {
+			status = http.StatusServiceUnavailable
+		}
+	} else {
+		log.Printf("Imported the rows POSTed by %s: %d of %d rows inserted", r.RemoteAddr, stats.RowsInserted, stats.RowsRead)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err = json.NewEncoder(w).Encode(NewSummary(stats, err)); err != nil {
+		log.Warnf("Could not send the summary to %s: %s", r.RemoteAddr, err.Error())
+	}
+}
@@ -0,0 +1,102 @@
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestServerIngest(t *testing.T) {
+	c, err := ParseFlags([]string{"-dialect", "sqlite", "-table", "domain", "-serve-tables", "domain,ranking", "-workers", "1"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec(`INSERT INTO "domain" ("Domain") VALUES (?), (?)`).WithArgs("google.com", "youtube.com").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO "ranking" ("GlobalRank","Domain") VALUES (?,?)`).WithArgs("1", "google.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	server := httptest.NewServer(NewServer(db, c).Handler())
+	defer server.Close()
+
+	post := func(path string, contentType string, body string) (int, Summary) {
+		t.Helper()
+		resp, err := http.Post(server.URL+path, contentType, strings.NewReader(body))
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		var summary Summary
+		if resp.Header.Get("Content-Type") == "application/json" {
+			assert.NilError(t, json.NewDecoder(resp.Body).Decode(&summary))
+		}
+		return resp.StatusCode, summary
+	}
+	status, summary := post("/ingest/domain", "text/csv; charset=utf-8", "Domain\ngoogle.com\nyoutube.com\n")
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, summary.Outcome, OutcomeSuccess)
+	assert.Equal(t, summary.RowsInserted, int64(2))
+	status, summary = post("/ingest/ranking", "application/x-ndjson", `{"GlobalRank": 1, "Domain": "google.com"}`+"\n")
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, summary.RowsInserted, int64(1))
+	assert.NilError(t, mock.ExpectationsWereMet())
+
+	status, _ = post("/ingest/users", "text/csv", "Domain\ngoogle.com\n")
+	assert.Equal(t, status, http.StatusNotFound)
+	status, _ = post("/ingest/domain", "application/xml", "<Domain/>")
+	assert.Equal(t, status, http.StatusUnsupportedMediaType)
+	status, summary = post("/ingest/domain", "text/csv", "")
+	assert.Equal(t, status, http.StatusInternalServerError)
+	assert.Equal(t, summary.Outcome, OutcomeFailed)
+}
+
+func TestServerIngestConcurrently(t *testing.T) {
+	c, err := ParseFlags([]string{"-dialect", "sqlite", "-table", "domain", "-workers", "1"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec(`INSERT INTO "domain" ("Domain") VALUES (?)`).WithArgs("youtube.com").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "domain" ("Domain") VALUES (?)`).WithArgs("google.com").WillReturnResult(sqlmock.NewResult(0, 1))
+	server := httptest.NewServer(NewServer(db, c).Handler())
+	defer server.Close()
+
+	// the first request is still being read while the second one is imported
+	body, w := io.Pipe()
+	first := make(chan int)
+	go func() {
+		resp, err := http.Post(server.URL+"/ingest/domain", "text/csv", body)
+		assert.Check(t, err)
+		resp.Body.Close()
+		first <- resp.StatusCode
+	}()
+	_, err = io.WriteString(w, "Domain\n")
+	assert.NilError(t, err)
+	resp, err := http.Post(server.URL+"/ingest/domain", "text/csv", strings.NewReader("Domain\nyoutube.com\n"))
+	assert.NilError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+	_, err = io.WriteString(w, "google.com\n")
+	assert.NilError(t, err)
+	assert.NilError(t, w.Close())
+	assert.Equal(t, <-first, http.StatusOK)
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestServeOptions(t *testing.T) {
+	c, err := ParseFlags([]string{"-dry-run", "-resume-from-line", "3"})
+	assert.NilError(t, err)
+	err = NewServer(nil, c).Serve(context.Background())
+	assert.ErrorContains(t, err, "serve can't be combined with -resume-from-line")
+
+	c, err = ParseFlags([]string{"-dry-run", "-dead-letter-file", "failed.csv"})
+	assert.NilError(t, err)
+	err = NewServer(nil, c).Serve(context.Background())
+	assert.ErrorContains(t, err, "serve can't be combined with -dead-letter-file, the requests are imported at the same time")
+}
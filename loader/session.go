@@ -0,0 +1,201 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+)
+
+// goneAwayErrors are the MySQL client errors of a connection closed by the server:
+// 2006 server has gone away, 2013 lost connection during query
+var goneAwayErrors = []uint16{2006, 2013}
+
+// isGoneAway reports whether err means the connection is dead, the batch may succeed on a new connection
+func isGoneAway(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	for _, n := range goneAwayErrors {
+		if mysqlErr.Number == n {
+			return true
+		}
+	}
+	return false
+}
+
+// session is the connection of a worker, it gets replaced when the server closed it
+type session struct {
+	l           *Loader
+	db          *sql.DB
+	conn        *sql.Conn
+	workerIndex int
+	// rnd is the random source of the worker for the backoff jitter
+	rnd *rand.Rand
+	// preparedRows is the size of the batches executed as prepared statements, 0 prepares nothing
+	preparedRows int
+	// stmts are the statements prepared on conn by query
+	stmts map[string]*sql.Stmt
+	// raggedRows and raggedQuery are the size and the statement of the last batch smaller than preparedRows
+	raggedRows  int
+	raggedQuery string
+	// chunk is the open transaction with -commit-every, nil executes every batch on its own
+	chunk *chunk
+	// used is the time the connection was acquired or last executed a batch, see checkHealth
+	used time.Time
+	// batches is the number of batches the worker executed, the batch_seq logged with a batch
+	batches int
+	// lines are the first and the last input line of the batch executed, logged with it if known
+	lines [2]int
+}
+
+// openSession acquires a connection for a worker and sets it up: the isolation level, the time zone and the
+// sql_mode and the -init-sql statements
+func (l *Loader) openSession(ctx context.Context, db *sql.DB, workerIndex int, rnd *rand.Rand) (*session, error) {
+	s := &session{l: l, db: db, workerIndex: workerIndex, rnd: rnd}
+	if err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *session) connect(ctx context.Context) error {
+	conn, err := s.l.acquireConn(ctx, s.db, s.workerIndex, s.rnd)
+	if err != nil {
+		return err
+	}
+	if s.l.config.Isolation != "" {
+		// a session level setting applies to every statement (and so every batch) the worker executes on this connection
+		if _, err = conn.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL "+s.l.config.Isolation); err != nil {
+			conn.Close()
+			return err
+		}
+		log.Tracef("Worker %d uses isolation level %s", s.workerIndex, s.l.config.Isolation)
+	}
+	for _, setting := range s.l.config.sessionSettings() {
+		if _, err = conn.ExecContext(ctx, setting); err != nil {
+			conn.Close()
+			return fmt.Errorf("'%s' failed: %w", setting, err)
+		}
+		log.Tracef("Worker %d executed %s", s.workerIndex, setting)
+	}
+	for _, stmt := range s.l.config.InitSQL {
+		if _, err = conn.ExecContext(ctx, stmt); err != nil {
+			conn.Close()
+			return fmt.Errorf("init statement '%s' failed: %w", stmt, err)
+		}
+		log.Tracef("Worker %d executed init statement %s", s.workerIndex, stmt)
+	}
+	s.conn = conn
+	s.used = time.Now()
+	return nil
+}
+
+// checkHealth pings the connection when it was idle for longer than -health-check-idle, e.g. a trickle feed
+// outliving the wait_timeout of the server or a failover, and replaces it when it's dead. The next batch then
+// doesn't fail on it, which would cost one of its reconnects. The open transaction of a chunk isn't checked, it
+// would be lost with the connection anyway.
+func (s *session) checkHealth(ctx context.Context) error {
+	if s.l.config.HealthCheckIdle <= 0 || time.Since(s.used) < s.l.config.HealthCheckIdle || s.chunk != nil && s.chunk.tx != nil {
+		return nil
+	}
+	pingCtx, cancel := s.l.config.batchContext(ctx)
+	err := s.conn.PingContext(pingCtx)
+	cancel()
+	if err == nil {
+		s.used = time.Now()
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	s.l.reconnectCount.Add(1)
+	log.Warnf("Worker %d connection failed the health check: %s, reconnecting", s.workerIndex, err.Error())
+	return s.reconnect(ctx)
+}
+
+// sessionSettings returns the SET SESSION statements of the -time-zone, -sql-mode and -defer-fk-checks
+func (c *Config) sessionSettings() []string {
+	var settings []string
+	if c.TimeZone != "" {
+		settings = append(settings, "SET SESSION time_zone = "+quoteSQLString(c.TimeZone))
+	}
+	if c.SQLMode != "" {
+		settings = append(settings, "SET SESSION sql_mode = "+quoteSQLString(c.SQLMode))
+	}
+	if c.DeferFKChecks {
+		settings = append(settings, "SET SESSION foreign_key_checks = 0")
+	}
+	return settings
+}
+
+// reconnect discards the dead connection and acquires a new one
+func (s *session) reconnect(ctx context.Context) error {
+	// the statements were prepared on the dead connection, closing them (and it) fails, which doesn't matter
+	_ = s.closeStmts()
+	_ = s.conn.Close()
+	return s.connect(ctx)
+}
+
+// usePrepared reports whether the batch of rows rows executed with query is executed as prepared statement: every
+// full batch, a smaller one once the same size came again (like the batches flushed by -flush-interval for a slow
+// producer). The last batch of an input is a one off, preparing it would only cost another round trip. Only the
+// statement of the last smaller size is kept.
+func (s *session) usePrepared(query string, rows int) bool {
+	if s.preparedRows == 0 {
+		return false
+	}
+	if rows == s.preparedRows || rows == s.raggedRows && query == s.raggedQuery {
+		return true
+	}
+	if stmt, ok := s.stmts[s.raggedQuery]; ok {
+		if err := stmt.Close(); err != nil {
+			log.Warnf("Worker %d could not close a prepared statement: %s", s.workerIndex, err.Error())
+		}
+		delete(s.stmts, s.raggedQuery)
+	}
+	s.raggedRows, s.raggedQuery = rows, query
+	return false
+}
+
+// prepare returns query prepared on the connection, it is prepared once and reused for the following batches
+func (s *session) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if stmt, ok := s.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := s.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if s.stmts == nil {
+		s.stmts = map[string]*sql.Stmt{}
+	}
+	s.stmts[query] = stmt
+	log.Debugf("Worker %d prepared a statement, %d are prepared on its connection", s.workerIndex, len(s.stmts))
+	return stmt, nil
+}
+
+// closeStmts closes the prepared statements
+func (s *session) closeStmts() error {
+	var errs []error
+	for _, stmt := range s.stmts {
+		errs = append(errs, stmt.Close())
+	}
+	s.stmts = nil
+	return errors.Join(errs...)
+}
+
+// Close releases the prepared statements and the connection
+func (s *session) Close() error {
+	return errors.Join(s.closeStmts(), s.conn.Close())
+}
@@ -0,0 +1,112 @@
+package loader
+
+import "hash/fnv"
+
+// jobShards are the per-worker job channels of the options dealing the rows out to particular workers, so the
+// workers don't all compete for the single jobs channel. The reader sends every row straight into the channel pick
+// returns for it. A nil *jobShards is the jobs channel all workers share.
+type jobShards struct {
+	channels []chan Job
+	pick     func(job Job) int
+}
+
+// newJobShards returns n channels of bufferSize rows, pick returns the channel of a job
+func newJobShards(n int, bufferSize int, pick func(job Job) int) *jobShards {
+	s := &jobShards{channels: make([]chan Job, n), pick: pick}
+	for i := range s.channels {
+		s.channels[i] = make(chan Job, bufferSize)
+	}
+	return s
+}
+
+// channel returns the channel job is sent to, jobs without shards
+func (s *jobShards) channel(jobs chan<- Job, job Job) chan<- Job {
+	if s == nil {
+		return jobs
+	}
+	return s.channels[s.pick(job)]
+}
+
+// worker returns the channel worker i reads, jobs without shards
+func (s *jobShards) worker(jobs <-chan Job, i int) <-chan Job {
+	if s == nil {
+		return jobs
+	}
+	return s.channels[i]
+}
+
+// close closes the channels once the reader sent all rows, like the jobs channel
+func (s *jobShards) close() {
+	if s == nil {
+		return
+	}
+	for _, c := range s.channels {
+		close(c)
+	}
+}
+
+// jobQueue is the queue of the rows read waiting for the workers: the jobs channel, or with shards the channels of
+// the workers, which the reader sends the rows to instead
+type jobQueue struct {
+	jobs   chan Job
+	shards *jobShards
+}
+
+// length returns the rows waiting
+func (q jobQueue) length() int {
+	if q.shards == nil {
+		return len(q.jobs)
+	}
+	n := 0
+	for _, c := range q.shards.channels {
+		n += len(c)
+	}
+	return n
+}
+
+// capacity returns the rows the channels hold
+func (q jobQueue) capacity() int {
+	if q.shards == nil {
+		return cap(q.jobs)
+	}
+	n := 0
+	for _, c := range q.shards.channels {
+		n += cap(c)
+	}
+	return n
+}
+
+// full reports whether the reader waits for the workers, with shards one full channel makes it wait for its worker
+func (q jobQueue) full() bool {
+	if q.shards == nil {
+		return len(q.jobs) == cap(q.jobs)
+	}
+	for _, c := range q.shards.channels {
+		if len(c) == cap(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// roundRobin returns a pick function which cycles through n shards
+func roundRobin(n int) func(job Job) int {
+	next := 0
+	return func(job Job) int {
+		shard := next
+		next = (next + 1) % n
+		return shard
+	}
+}
+
+// byKey returns a pick function which hashes the value of column index, so all rows with the same key (and so
+// touching the same index pages) end up in the same shard
+func byKey(index int, n int) func(job Job) int {
+	return func(job Job) int {
+		h := fnv.New32a()
+		if index < len(job.Values) {
+			h.Write([]byte(job.Values[index]))
+		}
+		return int(h.Sum32() % uint32(n))
+	}
+}
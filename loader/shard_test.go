@@ -0,0 +1,130 @@
+package loader
+
+import (
+	"sync"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// sendJobs sends jobs to the channels of shards like the reader and closes them
+func sendJobs(shards *jobShards, jobs ...Job) {
+	for _, job := range jobs {
+		shards.channel(nil, job) <- job
+	}
+	shards.close()
+}
+
+func TestJobShardsRoundRobin(t *testing.T) {
+	shards := newJobShards(3, 10, roundRobin(3))
+	var jobs []Job
+	for i, v := range []string{"a", "b", "c", "d", "e"} {
+		jobs = append(jobs, Job{Row: i + 1, Values: []string{v}})
+	}
+	sendJobs(shards, jobs...)
+
+	assert.DeepEqual(t, readJobs(shards.channels[0]), [][]string{{"a"}, {"d"}})
+	assert.DeepEqual(t, readJobs(shards.channels[1]), [][]string{{"b"}, {"e"}})
+	assert.DeepEqual(t, readJobs(shards.worker(nil, 2)), [][]string{{"c"}})
+}
+
+func TestJobShardsByKey(t *testing.T) {
+	shards := newJobShards(4, 10, byKey(1, 4))
+	keys := []string{"a.com", "b.com", "a.com", "c.com", "b.com", "a.com"}
+	var jobs []Job
+	for i, key := range keys {
+		jobs = append(jobs, Job{Row: i + 1, Values: []string{"x", key}})
+	}
+	sendJobs(shards, jobs...)
+
+	// every key has to end up in exactly one shard
+	shardOfKey := make(map[string]int)
+	total := 0
+	for i, shard := range shards.channels {
+		for _, values := range readJobs(shard) {
+			total++
+			if s, ok := shardOfKey[values[1]]; ok {
+				assert.Equal(t, s, i, "key %s found in two shards", values[1])
+			}
+			shardOfKey[values[1]] = i
+		}
+	}
+	assert.Equal(t, total, len(keys))
+	assert.Equal(t, len(shardOfKey), 3)
+}
+
+func TestJobQueue(t *testing.T) {
+	jobs := make(chan Job, 4)
+	jobs <- Job{Row: 1}
+	q := jobQueue{jobs: jobs}
+	assert.Equal(t, q.length(), 1)
+	assert.Equal(t, q.capacity(), 4)
+	assert.Assert(t, !q.full())
+
+	// the reader waits as soon as the channel of one worker is full
+	shards := newJobShards(2, 2, func(job Job) int { return 0 })
+	q = jobQueue{jobs: jobs, shards: shards}
+	shards.channel(jobs, Job{Row: 1}) <- Job{Row: 1}
+	assert.Equal(t, q.length(), 1)
+	assert.Equal(t, q.capacity(), 4)
+	assert.Assert(t, !q.full())
+	shards.channel(jobs, Job{Row: 2}) <- Job{Row: 2}
+	assert.Assert(t, q.full())
+}
+
+const benchWorkers = 100
+
+// consume starts a consumer per channel and returns a wait group which is done, when all channels are closed
+func consume(channels []<-chan Job) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for _, c := range channels {
+		wg.Add(1)
+		go func(c <-chan Job) {
+			defer wg.Done()
+			for range c {
+			}
+		}(c)
+	}
+	return &wg
+}
+
+func BenchmarkJobsSingleChannel(b *testing.B) {
+	job := Job{Row: 1, Values: []string{"1", "1", "google.com", "com"}}
+	jobs := make(chan Job, channelBufferSize)
+	channels := make([]<-chan Job, benchWorkers)
+	for i := range channels {
+		channels[i] = jobs
+	}
+	wg := consume(channels)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// benchmarkShards sends b.N rows to benchWorkers consumers through the channels of the shards of pick
+func benchmarkShards(b *testing.B, pick func(job Job) int) {
+	job := Job{Row: 1, Values: []string{"1", "1", "google.com", "com"}}
+	shards := newJobShards(benchWorkers, sqlBatchSize, pick)
+	channels := make([]<-chan Job, benchWorkers)
+	for i := range channels {
+		channels[i] = shards.worker(nil, i)
+	}
+	wg := consume(channels)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		shards.channel(nil, job) <- job
+	}
+	shards.close()
+	wg.Wait()
+}
+
+func BenchmarkJobsShardedChannels(b *testing.B) {
+	benchmarkShards(b, roundRobin(benchWorkers))
+}
+
+func BenchmarkJobsPartitionedByKey(b *testing.B) {
+	benchmarkShards(b, byKey(2, benchWorkers))
+}
@@ -0,0 +1,228 @@
+package loader
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// how -shard-by picks the shard of a row
+const (
+	// ShardModeHash hashes the value of the column
+	ShardModeHash = "hash"
+	// ShardModeRange compares the integer value of the column with the upper bounds of -shard-ranges
+	ShardModeRange = "range"
+)
+
+var shardModes = []string{ShardModeHash, ShardModeRange}
+
+// validateShards checks the -shard options
+func (c *Config) validateShards() error {
+	if !slices.Contains(shardModes, c.ShardMode) {
+		return fmt.Errorf("invalid shard-mode '%s', allowed are: %s", c.ShardMode, strings.Join(shardModes, ", "))
+	}
+	if len(c.Shards) == 0 {
+		if c.ShardBy != "" || len(c.ShardRanges) > 0 {
+			return fmt.Errorf("-shard-by and -shard-ranges require -shard")
+		}
+		return nil
+	}
+	if len(c.Shards) < 2 {
+		return fmt.Errorf("-shard needs to be given for at least two databases")
+	}
+	if c.ShardBy == "" {
+		return fmt.Errorf("-shard requires -shard-by")
+	}
+	if c.ShardMode == ShardModeRange && len(c.ShardRanges) != len(c.Shards)-1 {
+		return fmt.Errorf("-shard-mode range requires %d -shard-ranges (one fewer than the shards), got %d", len(c.Shards)-1, len(c.ShardRanges))
+	}
+	if c.ShardMode == ShardModeHash && len(c.ShardRanges) > 0 {
+		return fmt.Errorf("-shard-ranges requires -shard-mode range")
+	}
+	for i := 1; i < len(c.ShardRanges); i++ {
+		if c.ShardRanges[i] <= c.ShardRanges[i-1] {
+			return fmt.Errorf("invalid shard-ranges, the bounds must be ascending")
+		}
+	}
+	if c.Workers < len(c.Shards) {
+		return fmt.Errorf("-workers %d is less than the %d shards, every shard needs a worker", c.Workers, len(c.Shards))
+	}
+	// the other options run statements on a single database or deal the rows to the workers by themselves
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"route", len(c.Routes) > 0}, {"partition-by-worker", c.PartitionBy != ""}, {"staging-table", c.StagingTable != ""},
+		{"swap", c.Swap}, {"table-template", c.TableTemplate != ""}, {"create-table", c.CreateTable}, {"truncate", c.Truncate},
+		{"verify", c.Verify}, {"idempotency-table", c.IdempotencyTable != ""}, {"lookup", len(c.Lookups) > 0},
+		{"pre-sql", len(c.PreSQL) > 0}, {"post-sql", len(c.PostSQL) > 0}, {"on-failure-sql", len(c.OnFailureSQL) > 0},
+		{"post-import-sql", c.PostImportSQL != ""}, {"watch-dir", c.WatchDir != ""}} {
+		if f.set {
+			return fmt.Errorf("-shard can't be combined with -%s", f.name)
+		}
+	}
+	return nil
+}
+
+// shardSettings returns the connection settings of shard, a go-sql-driver DSN (e.g.
+// user:password@tcp(db1:3306)/ranks) replaces the settings, a host[:port] only the host and port of them
+func shardSettings(base DBSettings, shard string) (DBSettings, error) {
+	s := base
+	if strings.ContainsAny(shard, "@/(") {
+		if err := s.setDSN(shard); err != nil {
+			return s, fmt.Errorf("invalid shard '%s': %w", shard, err)
+		}
+		return s, nil
+	}
+	host, port, found := strings.Cut(shard, ":")
+	if host == "" || found && port == "" {
+		return s, fmt.Errorf("invalid shard '%s', must be host[:port] or a DSN", shard)
+	}
+	s.Host, s.Port, s.Socket = host, cmp.Or(port, base.Port), ""
+	return s, nil
+}
+
+// OpenShardConnections opens a connection pool for every -shard, sized for the workers of the shard. The settings
+// of the environment, the option file and the flags of c are the ones of every shard, but their host and port (or
+// all of them for a shard given as DSN).
+func OpenShardConnections(c Config) ([]*sql.DB, error) {
+	base, err := connectionSettings(c)
+	if err != nil {
+		return nil, err
+	}
+	dialect := c.dialect()
+	// the pool of a shard serves its workers only
+	pool := c
+	pool.Workers = (c.Workers + len(c.Shards) - 1) / len(c.Shards)
+	var dbs []*sql.DB
+	for i, shard := range c.Shards {
+		settings, err := shardSettings(base, shard)
+		if err == nil && c.isMySQL() {
+			err = settings.registerTLS()
+		}
+		var db *sql.DB
+		if err == nil {
+			dbConnString, dbConnStringPrintable := dialect.DSN(settings)
+			log.Printf("Open DB connection of shard %d using %s", i, dbConnStringPrintable)
+			if c.IAMAuth {
+				db, err = openIAMAuthDB(dbConnString, settings)
+			} else {
+				db, err = sql.Open(cmp.Or(c.DBDriver, dialect.Driver()), dbConnString)
+			}
+		}
+		if err != nil {
+			for _, db := range dbs {
+				db.Close()
+			}
+			return nil, err
+		}
+		applyPoolSettings(db, pool)
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+// ShardRouter picks the shard of every row by the value of the -shard-by column and counts the rows of every
+// shard. A nil *ShardRouter puts every row into shard 0.
+type ShardRouter struct {
+	index  int
+	mode   string
+	bounds []int64
+	rows   []atomic.Int64
+}
+
+// NewShardRouter routes the rows to shards shards by the value at index, with mode ShardModeRange shard i gets the
+// values below bounds[i] (and not below the bound before), the last one the rest
+func NewShardRouter(shards int, index int, mode string, bounds []int64) *ShardRouter {
+	return &ShardRouter{index: index, mode: mode, bounds: bounds, rows: make([]atomic.Int64, shards)}
+}
+
+// Shard returns the shard of row
+func (r *ShardRouter) Shard(row []string) (int, error) {
+	if r == nil {
+		return 0, nil
+	}
+	var key string
+	if r.index < len(row) {
+		key = row[r.index]
+	}
+	shard := 0
+	if r.mode == ShardModeRange {
+		value, err := strconv.ParseInt(strings.TrimSpace(key), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid shard key '%s', -shard-mode range needs an integer", key)
+		}
+		shard = sort.Search(len(r.bounds), func(i int) bool { return r.bounds[i] > value })
+	} else {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		shard = int(h.Sum32() % uint32(len(r.rows)))
+	}
+	r.rows[shard].Add(1)
+	return shard, nil
+}
+
+// Rows returns the rows routed to every shard, nil without shards
+func (r *ShardRouter) Rows() []int64 {
+	if r == nil {
+		return nil
+	}
+	rows := make([]int64, len(r.rows))
+	for i := range r.rows {
+		rows[i] = r.rows[i].Load()
+	}
+	return rows
+}
+
+// byShard returns a pick function for newJobShards which keeps the rows of every shard on the workers connected to it:
+// worker w serves shard w % shards (see Loader.workerDB), the rows of a shard go to its workers round robin
+func byShard(shards int, n int) func(job Job) int {
+	next := make([]int, shards)
+	return func(job Job) int {
+		workers := (n - job.Shard + shards - 1) / shards
+		w := job.Shard + next[job.Shard]*shards
+		next[job.Shard] = (next[job.Shard] + 1) % workers
+		return w
+	}
+}
+
+// workerDB returns the database worker i inserts into, the shard it serves with -shard
+func (l *Loader) workerDB(i int) *sql.DB {
+	if len(l.Shards) == 0 {
+		return l.DB
+	}
+	return l.Shards[i%len(l.Shards)]
+}
+
+type shardRangesFlag struct {
+	bounds *[]int64
+}
+
+func (f shardRangesFlag) String() string {
+	if f.bounds == nil {
+		return ""
+	}
+	bounds := make([]string, len(*f.bounds))
+	for i, b := range *f.bounds {
+		bounds[i] = strconv.FormatInt(b, 10)
+	}
+	return strings.Join(bounds, ",")
+}
+
+func (f shardRangesFlag) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		b, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid shard-ranges bound '%s', must be an integer", s)
+		}
+		*f.bounds = append(*f.bounds, b)
+	}
+	return nil
+}
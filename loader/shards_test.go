@@ -0,0 +1,125 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestShardRouter(t *testing.T) {
+	r := NewShardRouter(3, 1, ShardModeRange, []int64{100, 200})
+	for key, want := range map[string]int{"-5": 0, "99": 0, "100": 1, "199": 1, "200": 2, " 12345 ": 2} {
+		shard, err := r.Shard([]string{"x", key})
+		assert.NilError(t, err)
+		assert.Equal(t, shard, want, key)
+	}
+	_, err := r.Shard([]string{"x", "abc"})
+	assert.ErrorContains(t, err, "invalid shard key 'abc', -shard-mode range needs an integer")
+	assert.DeepEqual(t, r.Rows(), []int64{2, 2, 2})
+
+	// a key always goes to the same shard
+	r = NewShardRouter(8, 0, ShardModeHash, nil)
+	first, err := r.Shard([]string{"example.com"})
+	assert.NilError(t, err)
+	for i := 0; i < 3; i++ {
+		shard, err := r.Shard([]string{"example.com"})
+		assert.NilError(t, err)
+		assert.Equal(t, shard, first)
+	}
+	var nilRouter *ShardRouter
+	shard, err := nilRouter.Shard([]string{"example.com"})
+	assert.NilError(t, err)
+	assert.Equal(t, shard, 0)
+	assert.Assert(t, nilRouter.Rows() == nil)
+}
+
+func TestByShard(t *testing.T) {
+	pick := byShard(3, 7)
+	var picked []int
+	for _, shard := range []int{0, 0, 0, 0, 1, 1, 1, 2, 2} {
+		w := pick(Job{Shard: shard})
+		// the worker is connected to the shard of the row
+		assert.Equal(t, w%3, shard)
+		picked = append(picked, w)
+	}
+	assert.DeepEqual(t, picked, []int{0, 3, 6, 0, 1, 4, 1, 2, 5})
+}
+
+func TestParseFlagsShards(t *testing.T) {
+	c, err := ParseFlags([]string{"-shard", "db1", "-shard", "db2:3307", "-shard", "db3", "-shard-by", "id",
+		"-shard-mode", "range", "-shard-ranges", "1000, 2000", "-workers", "6"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c.Shards, []string{"db1", "db2:3307", "db3"})
+	assert.DeepEqual(t, c.ShardRanges, []int64{1000, 2000})
+	assert.NilError(t, c.ResolveColumns([]string{"name", "id"}))
+	assert.Equal(t, c.shardIndex, 1)
+	assert.Assert(t, !c.useLoadData(), "LOAD DATA loads a single database")
+
+	for want, args := range map[string][]string{
+		"invalid shard-mode 'modulo'":                        {"-shard-mode", "modulo"},
+		"-shard-by and -shard-ranges require -shard":         {"-shard-by", "id"},
+		"at least two databases":                             {"-shard", "db1", "-shard-by", "id"},
+		"-shard requires -shard-by":                          {"-shard", "db1", "-shard", "db2"},
+		"requires 1 -shard-ranges":                           {"-shard", "db1", "-shard", "db2", "-shard-by", "id", "-shard-mode", "range"},
+		"-shard-ranges requires -shard-mode range":           {"-shard", "db1", "-shard", "db2", "-shard-by", "id", "-shard-ranges", "5"},
+		"the bounds must be ascending":                       {"-shard", "db1", "-shard", "db2", "-shard", "db3", "-shard-by", "id", "-shard-mode", "range", "-shard-ranges", "5,5"},
+		"invalid shard-ranges bound 'x'":                     {"-shard-ranges", "x"},
+		"-workers 2 is less than the 3 shards":               {"-shard", "db1", "-shard", "db2", "-shard", "db3", "-shard-by", "id", "-workers", "2"},
+		"-shard can't be combined with -swap":                {"-shard", "db1", "-shard", "db2", "-shard-by", "id", "-swap"},
+		"-shard can't be combined with -post-import-sql":     {"-shard", "db1", "-shard", "db2", "-shard-by", "id", "-post-import-sql", "SELECT 1"},
+		"-shard can't be combined with -partition-by-worker": {"-shard", "db1", "-shard", "db2", "-shard-by", "id", "-partition-by-worker", "id"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestShardSettings(t *testing.T) {
+	base := DBSettings{User: "import", Password: "s3cret", Host: "db", Port: "3306", Database: "ranks", Socket: "/tmp/mysql.sock"}
+	s, err := shardSettings(base, "db2")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s, DBSettings{User: "import", Password: "s3cret", Host: "db2", Port: "3306", Database: "ranks"})
+	s, err = shardSettings(base, "db3:3307")
+	assert.NilError(t, err)
+	assert.Equal(t, s.Host+":"+s.Port, "db3:3307")
+	s, err = shardSettings(base, "other:pw@tcp(db4:3308)/ranks4")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s, DBSettings{User: "other", Password: "pw", Host: "db4", Port: "3308", Database: "ranks4"})
+	_, err = shardSettings(base, "db5:")
+	assert.ErrorContains(t, err, "invalid shard 'db5:', must be host[:port] or a DSN")
+}
+
+func TestImportShards(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("id,domain\n1,a.com\n150,b.com\n2,c.com\n300,d.com\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-dialect", "sqlite", "-table", "domain", "-workers", "2",
+		"-shard", "db1", "-shard", "db2", "-shard-by", "id", "-shard-mode", "range", "-shard-ranges", "100"})
+	assert.NilError(t, err)
+	var shards []*sql.DB
+	var mocks []sqlmock.Sqlmock
+	for _, rows := range [][]driver.Value{{"1", "a.com", "2", "c.com"}, {"150", "b.com", "300", "d.com"}} {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		assert.NilError(t, err)
+		defer db.Close()
+		mock.ExpectExec(`INSERT INTO "domain" ("id","domain") VALUES (?,?), (?,?)`).WithArgs(rows...).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		shards = append(shards, db)
+		mocks = append(mocks, mock)
+	}
+
+	l := New(shards[0], c)
+	l.Shards = shards
+	stats, err := l.Run(context.Background())
+	assert.NilError(t, err)
+	for _, mock := range mocks {
+		assert.NilError(t, mock.ExpectationsWereMet())
+	}
+	assert.Equal(t, stats.RowsInserted, int64(4))
+	assert.DeepEqual(t, stats.RowsByShard, []int64{2, 2})
+}
@@ -0,0 +1,608 @@
+package loader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/klauspost/compress/zstd"
+	log "github.com/sirupsen/logrus"
+)
+
+// CSVSource provides one or more CSV inputs which are imported one after another, e.g. a single file
+// or all CSV entries of an archive
+type CSVSource interface {
+	// Next returns the name and content of the next input or io.EOF if there is none left,
+	// the content stays valid until the next call of Next or Close
+	Next() (string, io.Reader, error)
+	// Size returns the size of all inputs in bytes, 0 if unknown
+	Size() int64
+	// Close releases everything opened by the source
+	Close() error
+}
+
+// OpenCSVSources opens filenames as a single CSV source of the inputs of all of them in order, see OpenCSVSource
+func OpenCSVSources(filenames []string) (CSVSource, error) {
+	if len(filenames) == 1 {
+		return OpenCSVSource(filenames[0])
+	}
+	s := &multiSource{}
+	for _, filename := range filenames {
+		source, err := OpenCSVSource(filename)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		if _, ok := source.(*StreamSource); ok {
+			source.Close()
+			s.Close()
+			return nil, fmt.Errorf("the stream %s can't be combined with other inputs, it has no end", filename)
+		}
+		s.sources = append(s.sources, source)
+	}
+	return s, nil
+}
+
+// OpenCSVSource opens filename as a CSV source, archives are detected by their extension (.zip, .tar.gz or .tgz),
+// a directory is a source of the CSV files in it, - is a source of stdin and a URL (https://, s3://, kafka:// or a
+// scheme added with RegisterSource) is streamed
+func OpenCSVSource(filename string) (CSVSource, error) {
+	if scheme, ok := urlScheme(filename); ok {
+		return openURL(scheme, filename)
+	}
+	if filename == "-" {
+		log.Println("Reading CSV from stdin")
+		return newFileSource(os.Stdin)
+	}
+	if info, err := os.Stat(filename); err == nil && info.IsDir() {
+		return OpenCSVDirectory(filename)
+	}
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return OpenZipArchive(filename)
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		return OpenTarGzArchive(filename)
+	}
+	return OpenCSVFile(filename)
+}
+
+// fileSource is a source with a single CSV file, which may be compressed
+type fileSource struct {
+	file *os.File
+	// reader reads the content of file, decompressing it if needed
+	reader     io.Reader
+	compressed bool
+	read       bool
+}
+
+// magic bytes at the start of the compressed files
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	// parquetMagic starts (and ends) a Parquet file, which can't be read
+	parquetMagic = []byte("PAR1")
+)
+
+// newFileSource returns a source with the content of file, gzip, bzip2 and zstd compression is detected by the magic
+// bytes, so it doesn't depend on the extension and works for stdin as well
+func newFileSource(file *os.File) (*fileSource, error) {
+	reader, compressed, err := decompress(file.Name(), file)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSource{file: file, reader: reader, compressed: compressed}, nil
+}
+
+// decompress returns the decompressed content of r if it starts with the magic bytes of gzip, bzip2 or zstd and r
+// otherwise, compressed tells which one it is. Formats which can't be read (Parquet) are an error.
+func decompress(name string, r io.Reader) (content io.Reader, compressed bool, err error) {
+	buffered := bufio.NewReader(r)
+	// a short input can't be compressed, Peek returns what there is
+	magic, _ := buffered.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, false, fmt.Errorf("could not read gzip input %s: %w", name, err)
+		}
+		log.Printf("Decompressing gzip input '%s'", name)
+		return gz, true, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		log.Printf("Decompressing bzip2 input '%s'", name)
+		return bzip2.NewReader(buffered), true, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		// a single goroutine decodes the stream in Read, so the decoder starts none which would have to be closed
+		zr, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, false, fmt.Errorf("could not read zstd input %s: %w", name, err)
+		}
+		log.Printf("Decompressing zstd input '%s'", name)
+		return zr, true, nil
+	case bytes.HasPrefix(magic, parquetMagic):
+		return nil, false, fmt.Errorf("%s is a Parquet file, which isn't supported: convert it to CSV first, e.g. "+
+			"duckdb -c \"COPY '%s' TO '/dev/stdout' (FORMAT csv)\" | go-mysql-worker -csv -", name, name)
+	}
+	return buffered, false, nil
+}
+
+// readerSource is a source with the single input read from a reader
+type readerSource struct {
+	name   string
+	reader io.Reader
+	read   bool
+}
+
+// NewReaderSource returns a source with the CSV content of reader as its only input named name, closing the
+// source doesn't close reader. Like a file, gzip, bzip2 or zstd compressed content is decompressed.
+func NewReaderSource(name string, reader io.Reader) CSVSource {
+	return &readerSource{name: name, reader: reader}
+}
+
+func (s *readerSource) Next() (string, io.Reader, error) {
+	if s.read {
+		return "", nil, io.EOF
+	}
+	s.read = true
+	content, _, err := decompress(s.name, s.reader)
+	if err != nil {
+		return "", nil, err
+	}
+	return s.name, content, nil
+}
+
+func (s *readerSource) Size() int64 {
+	return 0
+}
+
+func (s *readerSource) Close() error {
+	return nil
+}
+
+// OpenCSVFile opens a CSV file as a source, a gzip, bzip2 or zstd compressed file is decompressed while reading
+func OpenCSVFile(filename string) (CSVSource, error) {
+	log.Printf("Open CSV file '%s'\n", filename)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Println("error opening csv file ", filename, err.Error())
+		return nil, err
+	}
+	s, err := newFileSource(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSource) Next() (string, io.Reader, error) {
+	if s.read {
+		return "", nil, io.EOF
+	}
+	s.read = true
+	return s.file.Name(), s.reader, nil
+}
+
+// Size is the size of the file, which is unknown for a compressed file as the progress counts decompressed bytes
+func (s *fileSource) Size() int64 {
+	if s.compressed {
+		return 0
+	}
+	info, err := s.file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
+
+func (s *fileSource) Close() error {
+	return s.file.Close()
+}
+
+// multiSource is a source with the inputs of several sources, one source after another
+type multiSource struct {
+	// sources are the sources not exhausted yet, the first one is read
+	sources []CSVSource
+}
+
+func (s *multiSource) Next() (string, io.Reader, error) {
+	for len(s.sources) > 0 {
+		name, r, err := s.sources[0].Next()
+		if err != io.EOF {
+			return name, r, err
+		}
+		if err = s.sources[0].Close(); err != nil {
+			return "", nil, err
+		}
+		s.sources = s.sources[1:]
+	}
+	return "", nil, io.EOF
+}
+
+// Size is unknown (0) when the size of one of the sources is
+func (s *multiSource) Size() int64 {
+	var size int64
+	for _, source := range s.sources {
+		n := source.Size()
+		if n == 0 {
+			return 0
+		}
+		size += n
+	}
+	return size
+}
+
+func (s *multiSource) Close() error {
+	var errs []error
+	for _, source := range s.sources {
+		errs = append(errs, source.Close())
+	}
+	s.sources = nil
+	return errors.Join(errs...)
+}
+
+// dirSource is a source with all CSV files of a directory in name order
+type dirSource struct {
+	files   []string
+	current *os.File
+	size    int64
+}
+
+// OpenCSVDirectory opens a directory as a source of all its .csv files, subdirectories are not read
+func OpenCSVDirectory(dirname string) (CSVSource, error) {
+	log.Printf("Open CSV directory '%s'\n", dirname)
+
+	entries, err := os.ReadDir(dirname)
+	if err != nil {
+		log.Println("error opening csv directory ", dirname, err.Error())
+		return nil, err
+	}
+	s := &dirSource{}
+	// ReadDir returns the entries sorted by name
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.EqualFold(path.Ext(e.Name()), ".csv") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		s.files = append(s.files, filepath.Join(dirname, e.Name()))
+		s.size += info.Size()
+	}
+	log.Printf("Found %d csv files in '%s'", len(s.files), dirname)
+	return s, nil
+}
+
+func (s *dirSource) Next() (string, io.Reader, error) {
+	if err := s.Close(); err != nil {
+		return "", nil, err
+	}
+	if len(s.files) == 0 {
+		return "", nil, io.EOF
+	}
+	name := s.files[0]
+	s.files = s.files[1:]
+	file, err := os.Open(name)
+	if err != nil {
+		return "", nil, err
+	}
+	s.current = file
+	return name, file, nil
+}
+
+func (s *dirSource) Size() int64 {
+	return s.size
+}
+
+func (s *dirSource) Close() error {
+	if s.current == nil {
+		return nil
+	}
+	err := s.current.Close()
+	s.current = nil
+	return err
+}
+
+// zipSource is a source with all CSV entries of a zip archive in name order
+type zipSource struct {
+	archive *zip.ReadCloser
+	entries []*zip.File
+	current io.ReadCloser
+	size    int64
+}
+
+// OpenZipArchive opens a zip archive as a source of all its .csv entries
+func OpenZipArchive(filename string) (CSVSource, error) {
+	log.Printf("Open zip archive '%s'\n", filename)
+
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		log.Println("error opening zip archive ", filename, err.Error())
+		return nil, err
+	}
+	entries := make([]*zip.File, 0, len(archive.File))
+	for _, f := range archive.File {
+		if !f.FileInfo().IsDir() && strings.EqualFold(path.Ext(f.Name), ".csv") {
+			entries = append(entries, f)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	log.Printf("Found %d csv entries in '%s'", len(entries), filename)
+	var size int64
+	for _, e := range entries {
+		size += int64(e.UncompressedSize64)
+	}
+	return &zipSource{archive: archive, entries: entries, size: size}, nil
+}
+
+func (s *zipSource) Next() (string, io.Reader, error) {
+	if err := s.closeCurrent(); err != nil {
+		return "", nil, err
+	}
+	if len(s.entries) == 0 {
+		return "", nil, io.EOF
+	}
+	entry := s.entries[0]
+	s.entries = s.entries[1:]
+	r, err := entry.Open()
+	if err != nil {
+		return "", nil, fmt.Errorf("error opening zip entry %s: %w", entry.Name, err)
+	}
+	s.current = r
+	return entry.Name, r, nil
+}
+
+func (s *zipSource) Size() int64 {
+	return s.size
+}
+
+func (s *zipSource) closeCurrent() error {
+	if s.current == nil {
+		return nil
+	}
+	err := s.current.Close()
+	s.current = nil
+	return err
+}
+
+func (s *zipSource) Close() error {
+	err := s.closeCurrent()
+	if cerr := s.archive.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// tarGzSource is a source with all CSV members of a gzip compressed tar archive in archive order,
+// the archive is streamed, nothing gets extracted to disk
+type tarGzSource struct {
+	// archive is the file or the stream the archive is read from
+	archive io.Closer
+	gz      *gzip.Reader
+	tar     *tar.Reader
+}
+
+// OpenTarGzArchive opens a gzip compressed tar archive as a source of all its .csv members
+func OpenTarGzArchive(filename string) (CSVSource, error) {
+	log.Printf("Open tar.gz archive '%s'\n", filename)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Println("error opening tar.gz archive ", filename, err.Error())
+		return nil, err
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error opening tar.gz archive %s: %w", filename, err)
+	}
+	return &tarGzSource{archive: file, gz: gz, tar: tar.NewReader(gz)}, nil
+}
+
+func (s *tarGzSource) Next() (string, io.Reader, error) {
+	for {
+		header, err := s.tar.Next()
+		if err != nil {
+			return "", nil, err
+		}
+		if header.Typeflag == tar.TypeReg && strings.EqualFold(path.Ext(header.Name), ".csv") {
+			return header.Name, s.tar, nil
+		}
+		log.Debugf("Skipping tar member %s", header.Name)
+	}
+}
+
+// Size is unknown, the uncompressed size is only known member by member while streaming
+func (s *tarGzSource) Size() int64 {
+	return 0
+}
+
+func (s *tarGzSource) Close() error {
+	err := s.gz.Close()
+	if cerr := s.archive.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// NextCSVReader opens the next input of source and reads its header with the input options of c, a JSON Lines input
+// (-input-format jsonl) is read by a reader returning its rows like CSV
+func NextCSVReader(source CSVSource, c Config) (string, RowReader, []string, error) {
+	name, r, err := source.Next()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if c.ReadRanges > 1 {
+		reader, header, err := c.openRangeReader(source, name, c.ReadRanges)
+		return name, reader, header, err
+	}
+	if c.InputFormat == InputFormatXLSX {
+		reader, err := c.openXLSXReader(name, r)
+		if err != nil {
+			return name, nil, nil, err
+		}
+		header, err := reader.Read()
+		if err != nil {
+			return name, nil, nil, fmt.Errorf("error reading header of %s: %w", name, err)
+		}
+		return name, reader, header, nil
+	}
+	r = decodeInput(name, r, c.InputEncoding)
+	var reader RowReader = c.newCSVReader(r)
+	if c.ParseWorkers > 1 && c.InputFormat == InputFormatCSV && c.Quote != QuoteNone {
+		reader = c.newParallelReader(r, c.ParseWorkers)
+	} else if c.InputFormat == InputFormatJSONLines {
+		reader = newJSONLinesReader(r)
+	} else if c.Quote == QuoteNone {
+		reader = newUnquotedReader(r, c.Delimiter, c.Comment, c.TrimLeadingSpace)
+	}
+	// comment lines are skipped by the reader, so the header is the first line which is no comment
+	header, err := reader.Read()
+	if err != nil {
+		closeRowReader(reader)
+		return name, nil, nil, fmt.Errorf("error reading header of %s: %w", name, err)
+	}
+	return name, reader, header, nil
+}
+
+// newCSVReader creates a CSV reader configured by the command line options
+func (c *Config) newCSVReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comment = c.Comment
+	if c.Delimiter != 0 {
+		reader.Comma = c.Delimiter
+	}
+	reader.LazyQuotes = c.LazyQuotes
+	reader.TrimLeadingSpace = c.TrimLeadingSpace
+	// the number of fields is checked against the header by ProcessCSVFile, which reports the row number
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+// QuoteNone is the -quote of inputs without quoting, a " is an ordinary character then
+const QuoteNone = "none"
+
+// unquotedReader splits every line at the delimiter, for exports which don't quote (-quote none), e.g. tab
+// separated ones with " in the values. Like csv.Reader it skips empty lines and comments.
+type unquotedReader struct {
+	reader *bufio.Reader
+	offset int64
+	line   int
+	// delimiter, comment and trimLeadingSpace are the -delimiter, -comment and -trim-leading-space of the input
+	delimiter        string
+	comment          rune
+	trimLeadingSpace bool
+}
+
+func newUnquotedReader(r io.Reader, delimiter, comment rune, trimLeadingSpace bool) *unquotedReader {
+	return &unquotedReader{reader: bufio.NewReader(r), delimiter: string(cmp.Or(delimiter, ',')), comment: comment,
+		trimLeadingSpace: trimLeadingSpace}
+}
+
+func (r *unquotedReader) Read() ([]string, error) {
+	for {
+		line, err := r.reader.ReadString('\n')
+		r.offset += int64(len(line))
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, err
+		}
+		r.line++
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" || r.comment != 0 && strings.HasPrefix(line, string(r.comment)) {
+			continue
+		}
+		fields := strings.Split(line, r.delimiter)
+		if r.trimLeadingSpace {
+			for i, field := range fields {
+				fields[i] = strings.TrimLeftFunc(field, unicode.IsSpace)
+			}
+		}
+		return fields, nil
+	}
+}
+
+func (r *unquotedReader) InputOffset() int64 {
+	return r.offset
+}
+
+// FieldPos returns the line of the row read last, the column isn't tracked
+func (r *unquotedReader) FieldPos(field int) (int, int) {
+	return r.line, 0
+}
+
+// ProcessCSVSource imports reader (the already opened first input of source named name) and all remaining
+// inputs of source into the jobs channel, which gets closed at the end. Every input needs the same header
+// as the first one, skip and maxLines apply to all inputs together. Returns the number of rows read, malformed
+// rows skipped within the errorBudget are counted as read but not sent to jobs. When ctx is canceled reading
+// stops and the error of ctx is returned.
+func (l *Loader) ProcessCSVSource(ctx context.Context, source CSVSource, name string, reader RowReader, jobs chan<- Job, skip int, maxLines int) (int, error) {
+	defer close(jobs)
+	defer l.shards.close()
+	// the inputs read to the end are done parsing anyway
+	defer func() { closeRowReader(reader) }()
+	total := 0
+	offset := 0
+	for {
+		if err := l.tableRotation.StartInput(ctx, name); err != nil {
+			return total, err
+		}
+		l.inputCounter.Start(name, offset+1)
+		l.rejects.StartInput(name)
+		rows, skipped, readErr := l.ProcessCSVFile(ctx, reader, jobs, offset, skip, maxLines-total)
+		l.inputCounter.End(rows)
+		log.Printf("Processed %d rows from %s", rows, name)
+		if ctx.Err() != nil {
+			return total + rows, fmt.Errorf("import interrupted after %d rows: %w", total+rows, context.Cause(ctx))
+		}
+		if readErr != nil {
+			return total + rows, fmt.Errorf("error reading %s after %d rows: %w", name, rows, readErr)
+		}
+		if err := l.errorBudget.EndInput(name, offset+skipped+rows); err != nil {
+			return total + rows, err
+		}
+		l.rowsSkipped.Add(int64(skipped))
+		skip -= skipped
+		offset += skipped + rows
+		total += rows
+		if total >= maxLines {
+			return total, nil
+		}
+
+		l.progress.NextInput(reader.InputOffset())
+		var next RowReader
+		var header []string
+		var err error
+		name, next, header, err = NextCSVReader(source, l.config)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+		if header, reader, err = l.config.resolveHeader(name, next, header, l.headers); err != nil {
+			return total, err
+		}
+		if !slices.Equal(header, l.headers) {
+			return total, fmt.Errorf("header of %s %v does not match %v", name, header, l.headers)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package loader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"gotest.tools/v3/assert"
+)
+
+// writeZip creates a zip archive in a temp dir with the given entries
+func writeZip(t *testing.T, entries map[string]string) string {
+	filename := filepath.Join(t.TempDir(), "data.zip")
+	f, err := os.Create(filename)
+	assert.NilError(t, err)
+	w := zip.NewWriter(f)
+	for name, content := range entries {
+		e, err := w.Create(name)
+		assert.NilError(t, err)
+		_, err = io.WriteString(e, content)
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, w.Close())
+	assert.NilError(t, f.Close())
+	return filename
+}
+
+// processSource imports all inputs of the source with the default config like main does and returns the rows sent
+func processSource(t *testing.T, source CSVSource, skip int, maxLines int) ([][]string, error) {
+	return processSourceConfig(t, defaultConfig(), source, skip, maxLines)
+}
+
+// processSourceConfig imports all inputs of the source with c and returns the rows sent
+func processSourceConfig(t *testing.T, c Config, source CSVSource, skip int, maxLines int) ([][]string, error) {
+	l := &Loader{config: c}
+	name, reader, header, err := NextCSVReader(source, l.config)
+	assert.NilError(t, err)
+
+	jobs := make(chan Job, 100)
+	l.headers = header
+	rows, err := l.ProcessCSVSource(context.Background(), source, name, reader, jobs, skip, maxLines)
+	result := readJobs(jobs)
+	assert.Equal(t, rows, len(result))
+	return result, err
+}
+
+func TestZipArchiveSource(t *testing.T) {
+	filename := writeZip(t, map[string]string{
+		"b.csv":        "name,rank\nc,3\n",
+		"a.csv":        "name,rank\na,1\nb,2\n",
+		"readme.txt":   "not a csv",
+		"sub/c.CSV":    "name,rank\nd,4\n",
+		"sub/":         "",
+		"sub/notes.md": "# notes",
+	})
+	source, err := OpenCSVSource(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+
+	rows, err := processSource(t, source, 0, 100)
+	assert.NilError(t, err)
+	// entries are read in name order: a.csv, b.csv, sub/c.CSV
+	assert.DeepEqual(t, rows, [][]string{{"a", "1"}, {"b", "2"}, {"c", "3"}, {"d", "4"}})
+}
+
+func TestZipArchiveSourceSkipAndMaxLines(t *testing.T) {
+	filename := writeZip(t, map[string]string{
+		"1.csv": "name,rank\na,1\nb,2\n",
+		"2.csv": "name,rank\nc,3\nd,4\n",
+		"3.csv": "name,rank\ne,5\n",
+	})
+	source, err := OpenCSVSource(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+
+	rows, err := processSource(t, source, 3, 2)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, rows, [][]string{{"d", "4"}, {"e", "5"}})
+}
+
+func TestZipArchiveSourceHeaderMismatch(t *testing.T) {
+	filename := writeZip(t, map[string]string{
+		"1.csv": "name,rank\na,1\n",
+		"2.csv": "rank,name\n2,b\n",
+	})
+	source, err := OpenCSVSource(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+
+	rows, err := processSource(t, source, 0, 100)
+	assert.ErrorContains(t, err, "header of 2.csv")
+	assert.DeepEqual(t, rows, [][]string{{"a", "1"}})
+}
+
+func TestFileSource(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("name,rank\na,1\n"), 0o644))
+	source, err := OpenCSVSource(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+
+	rows, err := processSource(t, source, 0, 100)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, rows, [][]string{{"a", "1"}})
+}
+
+func TestCompressedFileSource(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.csv.gz")
+	f, err := os.Create(filename)
+	assert.NilError(t, err)
+	gz := gzip.NewWriter(f)
+	_, err = io.WriteString(gz, "name,rank\na,1\nb,2\n")
+	assert.NilError(t, err)
+	assert.NilError(t, gz.Close())
+	assert.NilError(t, f.Close())
+
+	// compression is detected by the content, the extension doesn't matter
+	for _, name := range []string{filename, "testdata/ranks.csv.bz2"} {
+		source, err := OpenCSVSource(name)
+		assert.NilError(t, err)
+		assert.Equal(t, source.Size(), int64(0))
+		rows, err := processSource(t, source, 0, 100)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, rows, [][]string{{"a", "1"}, {"b", "2"}})
+		assert.NilError(t, source.Close())
+	}
+}
+
+func TestCompressedFileSourceZstd(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.csv.zst")
+	f, err := os.Create(filename)
+	assert.NilError(t, err)
+	zw, err := zstd.NewWriter(f)
+	assert.NilError(t, err)
+	_, err = io.WriteString(zw, "name,rank\na,1\nb,2\n")
+	assert.NilError(t, err)
+	assert.NilError(t, zw.Close())
+	assert.NilError(t, f.Close())
+
+	source, err := OpenCSVSource(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+	rows, err := processSource(t, source, 0, 100)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, rows, [][]string{{"a", "1"}, {"b", "2"}})
+}
+
+func TestParquetFileSource(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "export.parquet")
+	assert.NilError(t, os.WriteFile(filename, []byte("PAR1\x15\x04PAR1"), 0o644))
+	_, err := OpenCSVSource(filename)
+	assert.ErrorContains(t, err, "is a Parquet file, which isn't supported")
+}
+
+func TestProcessCSVSourceRowNumbers(t *testing.T) {
+	l := newTestLoader()
+	filename := writeZip(t, map[string]string{
+		"1.csv": "name,rank\na,1\nb,2\n",
+		"2.csv": "name,rank\nc,3\nd,4\n",
+	})
+	source, err := OpenCSVSource(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+	name, reader, header, err := NextCSVReader(source, Config{})
+	assert.NilError(t, err)
+
+	jobs := make(chan Job, 10)
+	l.headers = header
+	_, err = l.ProcessCSVSource(context.Background(), source, name, reader, jobs, 1, 100)
+	assert.NilError(t, err)
+	numbers := make([]int, 0)
+	for job := range jobs {
+		numbers = append(numbers, job.Row)
+	}
+	// rows are numbered over all entries, skipped rows count as well
+	assert.DeepEqual(t, numbers, []int{2, 3, 4})
+}
+
+func TestCommentsBeforeAndAfterHeader(t *testing.T) {
+	l := newTestLoader()
+	l.config.Comment = '#'
+
+	source, err := OpenCSVSource("testdata/commented.csv")
+	assert.NilError(t, err)
+	defer source.Close()
+
+	name, reader, header, err := NextCSVReader(source, l.config)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, header, []string{"GlobalRank", "Domain"})
+
+	jobs := make(chan Job, 10)
+	// the skipped row is the first data row, comment lines are not counted
+	l.headers = header
+	_, err = l.ProcessCSVSource(context.Background(), source, name, reader, jobs, 1, 100)
+	assert.NilError(t, err)
+	jobList := make([]Job, 0)
+	for job := range jobs {
+		jobList = append(jobList, job)
+	}
+	assert.DeepEqual(t, jobList, []Job{
+		{Row: 2, Values: []string{"2", "facebook.com"}, Line: 6},
+		{Row: 3, Values: []string{"3", "youtube.com"}, Line: 8},
+	})
+}
+
+type tarMember struct {
+	name    string
+	content string
+}
+
+// writeTarGz creates a gzip compressed tar archive in a temp dir with the given members
+func writeTarGz(t *testing.T, members []tarMember) string {
+	filename := filepath.Join(t.TempDir(), "data.tar.gz")
+	f, err := os.Create(filename)
+	assert.NilError(t, err)
+	gz := gzip.NewWriter(f)
+	w := tar.NewWriter(gz)
+	for _, m := range members {
+		header := &tar.Header{Name: m.name, Mode: 0o644, Size: int64(len(m.content)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(m.name, "/") {
+			header.Typeflag = tar.TypeDir
+			header.Size = 0
+		}
+		assert.NilError(t, w.WriteHeader(header))
+		_, err = io.WriteString(w, m.content)
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, w.Close())
+	assert.NilError(t, gz.Close())
+	assert.NilError(t, f.Close())
+	return filename
+}
+
+func TestTarGzArchiveSource(t *testing.T) {
+	filename := writeTarGz(t, []tarMember{
+		{"data/", ""},
+		{"data/README", "not a csv"},
+		{"data/b.csv", "name,rank\nb,2\nc,3\n"},
+		{"data/a.csv", "name,rank\na,1\n"},
+	})
+	source, err := OpenCSVSource(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+
+	rows, err := processSource(t, source, 0, 100)
+	assert.NilError(t, err)
+	// members are read in archive order
+	assert.DeepEqual(t, rows, [][]string{{"b", "2"}, {"c", "3"}, {"a", "1"}})
+}
+
+func TestTarGzArchiveSourceNotGzip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "broken.tgz")
+	assert.NilError(t, os.WriteFile(filename, []byte("plain text"), 0o644))
+	_, err := OpenCSVSource(filename)
+	assert.ErrorContains(t, err, "error opening tar.gz archive")
+}
+
+func TestCSVDirectorySource(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"b.csv":     "name,rank\nc,3\n",
+		"a.csv":     "name,rank\na,1\nb,2\n",
+		"notes.txt": "not a csv",
+	}
+	for name, content := range files {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, "sub.csv"), 0o755))
+	source, err := OpenCSVSource(dir)
+	assert.NilError(t, err)
+	defer source.Close()
+	assert.Equal(t, source.Size(), int64(len(files["a.csv"])+len(files["b.csv"])))
+
+	rows, err := processSource(t, source, 0, 100)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, rows, [][]string{{"a", "1"}, {"b", "2"}, {"c", "3"}})
+}
+
+func TestCSVDirectorySourceStopAfterErrorsPerFile(t *testing.T) {
+	l := newTestLoader()
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.csv": "name,rank\na,1\nbroken\nb,2\n",
+		"b.csv": "name,rank\nx\ny\nz,26\n",
+		"c.csv": "name,rank\nc,3\n",
+	}
+	for name, content := range files {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	source, err := OpenCSVSource(dir)
+	assert.NilError(t, err)
+	defer source.Close()
+	l.errorBudget = NewErrorBudget(10, 1, 0)
+
+	name, reader, header, err := NextCSVReader(source, l.config)
+	assert.NilError(t, err)
+	jobs := make(chan Job, 100)
+	l.headers = header
+	rows, err := l.ProcessCSVSource(context.Background(), source, name, reader, jobs, 0, 100)
+	assert.NilError(t, err)
+	// the malformed row of a.csv is skipped, b.csv is abandoned at its second malformed row, which is read as well
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"a", "1"}, {"b", "2"}, {"c", "3"}})
+	assert.Equal(t, rows, 6)
+	assert.DeepEqual(t, l.errorBudget.Abandoned(), []string{filepath.Join(dir, "b.csv")})
+}
+
+func TestMaxErrorsAbortsImport(t *testing.T) {
+	l := newTestLoader()
+	filename := filepath.Join(t.TempDir(), "broken.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("name,rank\na,1\nx\nb,2\ny\nc,3\n"), 0o644))
+	source, err := OpenCSVSource(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+	l.errorBudget = NewErrorBudget(1, 0, 0)
+
+	name, reader, header, err := NextCSVReader(source, l.config)
+	assert.NilError(t, err)
+	jobs := make(chan Job, 100)
+	l.headers = header
+	_, err = l.ProcessCSVSource(context.Background(), source, name, reader, jobs, 0, 100)
+	assert.ErrorContains(t, err, "too many malformed rows")
+	// reading stops at the malformed row exceeding the budget
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"a", "1"}, {"b", "2"}})
+}
+
+func TestCSVDelimiters(t *testing.T) {
+	l := newTestLoader()
+	inputs := map[string]string{
+		",":  "GlobalRank,Domain\n1,google.com\n2,\"a,b;c\"\n",
+		";":  "GlobalRank;Domain\n1;google.com\n2;\"a,b;c\"\n",
+		`\t`: "GlobalRank\tDomain\n1\tgoogle.com\n2\t\"a,b;c\"\n",
+	}
+	for delimiter, input := range inputs {
+		var err error
+		l.config, err = ParseFlags([]string{"-delimiter", delimiter})
+		assert.NilError(t, err)
+		filename := filepath.Join(t.TempDir(), "domains.csv")
+		assert.NilError(t, os.WriteFile(filename, []byte(input), 0o644))
+		source, err := OpenCSVSource(filename)
+		assert.NilError(t, err)
+		_, reader, header, err := NextCSVReader(source, l.config)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, header, []string{"GlobalRank", "Domain"})
+		rows, err := reader.(*csv.Reader).ReadAll()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, rows, [][]string{{"1", "google.com"}, {"2", "a,b;c"}})
+		source.Close()
+	}
+}
+
+func TestCSVLazyQuotes(t *testing.T) {
+	l := newTestLoader()
+	input := "Domain,Note\ngoogle.com,say \"hi\"\n"
+	_, err := l.config.newCSVReader(strings.NewReader(input)).ReadAll()
+	assert.ErrorContains(t, err, "bare \" in non-quoted-field")
+
+	l.config.LazyQuotes = true
+	rows, err := l.config.newCSVReader(strings.NewReader(input)).ReadAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, rows[1], []string{"google.com", `say "hi"`})
+}
+
+func TestCSVQuoteNoneAndTrimLeadingSpace(t *testing.T) {
+	c, err := ParseFlags([]string{"-quote", "none", "-delimiter", `\t`, "-trim-leading-space", "-comment", "#"})
+	assert.NilError(t, err)
+	filename := filepath.Join(t.TempDir(), "notes.tsv")
+	assert.NilError(t, os.WriteFile(filename, []byte("Domain\tNote\n# comment\n\n\"google.com\t  say \"hi\r\n"), 0o644))
+	source, err := OpenCSVSource(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+
+	rows, err := processSourceConfig(t, c, source, 0, 100)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, rows, [][]string{{`"google.com`, `say "hi`}})
+
+	_, err = ParseFlags([]string{"-quote", "'"})
+	assert.ErrorContains(t, err, "invalid quote")
+	_, err = ParseFlags([]string{"-quote", "none", "-lazy-quotes"})
+	assert.ErrorContains(t, err, "-lazy-quotes has no effect")
+}
+
+func TestParseFlagsDelimiter(t *testing.T) {
+	c, err := ParseFlags(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, c.Delimiter, ',')
+	for _, invalid := range []string{"", ";;", "\n", `"`} {
+		_, err = ParseFlags([]string{"-delimiter", invalid})
+		assert.ErrorContains(t, err, "-delimiter")
+	}
+	_, err = ParseFlags([]string{"-delimiter", ";", "-comment", ";"})
+	assert.ErrorContains(t, err, "-comment and -delimiter must differ")
+}
+
+func TestProcessCSVSourceStopsOnCancel(t *testing.T) {
+	l := newTestLoader()
+	var input strings.Builder
+	input.WriteString("name,rank\n")
+	for i := 0; i < 10000; i++ {
+		input.WriteString("google.com,1\n")
+	}
+	filename := filepath.Join(t.TempDir(), "big.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte(input.String()), 0o644))
+	source, err := OpenCSVSource(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+	name, reader, _, err := NextCSVReader(source, Config{})
+	assert.NilError(t, err)
+	_, err = reader.Read()
+	assert.NilError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := make(chan Job)
+	// nobody receives after the cancel, so the reader is blocked sending the next row
+	go func() {
+		for i := 0; i < 10; i++ {
+			<-jobs
+		}
+		cancel()
+	}()
+	done := make(chan error)
+	go func() {
+		l.headers = []string{"name", "rank"}
+		_, err := l.ProcessCSVSource(ctx, source, name, reader, jobs, 0, 100000)
+		done <- err
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProcessCSVSource didn't stop on cancel")
+	}
+	assert.Assert(t, errors.Is(err, context.Canceled), err)
+	// jobs is closed, so the workers flush and exit
+	assert.Assert(t, len(readJobs(jobs)) <= 1)
+}
+
+func TestStdinSource(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NilError(t, err)
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = r
+	go func() {
+		io.WriteString(w, "name,rank\na,1\nb,2\n")
+		w.Close()
+	}()
+
+	source, err := OpenCSVSources([]string{"-"})
+	assert.NilError(t, err)
+	defer source.Close()
+	assert.Equal(t, source.Size(), int64(0), "the size of a pipe is unknown")
+	rows, err := processSource(t, source, 0, 100)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, rows, [][]string{{"a", "1"}, {"b", "2"}})
+}
+
+func TestMultipleFilesSource(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"day2.csv": "name,rank\nc,3\n",
+		"day1.csv": "name,rank\na,1\nb,2\n",
+	}
+	for name, content := range files {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	// the files are read in the given order, not in name order
+	source, err := OpenCSVSources([]string{filepath.Join(dir, "day2.csv"), filepath.Join(dir, "day1.csv")})
+	assert.NilError(t, err)
+	defer source.Close()
+	assert.Equal(t, source.Size(), int64(len(files["day1.csv"])+len(files["day2.csv"])))
+
+	rows, err := processSource(t, source, 1, 100)
+	assert.NilError(t, err)
+	// skipping applies to all files together
+	assert.DeepEqual(t, rows, [][]string{{"a", "1"}, {"b", "2"}})
+}
+
+func TestMultipleFilesHeaderMismatch(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")
+	assert.NilError(t, os.WriteFile(a, []byte("name,rank\na,1\n"), 0o644))
+	assert.NilError(t, os.WriteFile(b, []byte("rank,name\n2,b\n"), 0o644))
+	source, err := OpenCSVSources([]string{a, b})
+	assert.NilError(t, err)
+	defer source.Close()
+	_, err = processSource(t, source, 0, 100)
+	assert.ErrorContains(t, err, "header of "+b+" [rank name] does not match [name rank]")
+
+	_, err = OpenCSVSources([]string{a, filepath.Join(dir, "missing.csv")})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestInputsAfterFlags(t *testing.T) {
+	c, err := ParseFlags([]string{"-table", "ranks", "a.csv", "b.csv"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c.Inputs(), []string{"a.csv", "b.csv"})
+	c, err = ParseFlags([]string{"-csv", "-"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c.Inputs(), []string{"-"})
+	_, err = ParseFlags([]string{"a.csv", "-", "-"})
+	assert.ErrorContains(t, err, "stdin (-) can only be read once")
+}
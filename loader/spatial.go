@@ -0,0 +1,252 @@
+package loader
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// geometryTransformer is the transformer marking a column as geometry, its WKT is converted by the function of
+// the dialect in the statement
+const geometryTransformer = "wkt"
+
+// geometryFunctions convert the WKT bound for a geometry column by dialect, a dialect not listed uses the
+// ST_GeomFromText of the OGC standard. ClickHouse has a function per geometry type, so it isn't supported.
+var geometryFunctions = map[string]string{
+	DialectMySQL:    "ST_GeomFromText",
+	DialectMariaDB:  "ST_GeomFromText",
+	DialectPostgres: "ST_GeomFromText",
+	// SpatiaLite
+	DialectSQLite: "GeomFromText",
+}
+
+// geometryColumn reports whether the values of the CSV column are the WKT of a geometry
+func (c *Config) geometryColumn(column string) bool {
+	spec, ok := c.Transforms[column]
+	return ok && lastTransformer(spec) == geometryTransformer
+}
+
+// geometryExpr returns the value expression of a geometry column, with the -geometry-srid if given
+func (c *Config) geometryExpr() string {
+	fn := cmp.Or(geometryFunctions[cmp.Or(c.Dialect, DialectMySQL)], "ST_GeomFromText")
+	if c.GeometrySRID > 0 {
+		return fmt.Sprintf("%s(?, %d)", fn, c.GeometrySRID)
+	}
+	return fn + "(?)"
+}
+
+// validateGeometry checks the options of the geometry columns
+func (c *Config) validateGeometry() error {
+	if c.GeometrySRID < 0 {
+		return fmt.Errorf("invalid geometry-srid %d, must not be negative", c.GeometrySRID)
+	}
+	for column := range c.Transforms {
+		if !c.geometryColumn(column) {
+			continue
+		}
+		if c.Dialect == DialectClickHouse {
+			return fmt.Errorf("-transform %s=%s isn't supported by the clickhouse dialect, use a -value-expr with the readWKT function of the type", column, geometryTransformer)
+		}
+	}
+	return nil
+}
+
+// wktDimensions are the numbers of a coordinate by the dimension tag following the geometry type
+var wktDimensions = map[string]int{"Z": 3, "M": 3, "ZM": 4}
+
+// wktValue checks the well-known text of a geometry (e.g. POINT(13.4 52.5)) and returns it trimmed, so a row with
+// an invalid geometry fails on its own instead of the batch failing in the database
+func wktValue(value string) (any, error) {
+	p := &wktParser{tokens: wktTokens(value)}
+	if err := p.geometry(); err != nil {
+		return nil, fmt.Errorf("invalid WKT: %w", err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("invalid WKT: unexpected '%s' after the geometry", p.tokens[p.pos])
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// wktTokens splits WKT into words, numbers, parentheses and commas
+func wktTokens(s string) []string {
+	var tokens []string
+	start := -1
+	for i, r := range s {
+		separator := r == '(' || r == ')' || r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+		if separator && start >= 0 {
+			tokens = append(tokens, s[start:i])
+			start = -1
+		}
+		if r == '(' || r == ')' || r == ',' {
+			tokens = append(tokens, string(r))
+		} else if !separator && start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+// wktParser checks the tokens of a WKT geometry
+type wktParser struct {
+	tokens []string
+	pos    int
+	// dimensions are the numbers of a coordinate, 0 until the first one without a dimension tag
+	dimensions int
+}
+
+func (p *wktParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *wktParser) expect(token string) error {
+	if got := p.peek(); got != token {
+		return fmt.Errorf("expected '%s' but got %s", token, p.describe(got))
+	}
+	p.pos++
+	return nil
+}
+
+func (p *wktParser) describe(token string) string {
+	if token == "" {
+		return "the end"
+	}
+	return "'" + token + "'"
+}
+
+// geometry checks a tagged geometry like POINT Z (1 2 3) or LINESTRING EMPTY
+func (p *wktParser) geometry() error {
+	kind := strings.ToUpper(p.peek())
+	body, ok := map[string]func() error{
+		"POINT": func() error { return p.list(1, p.coordinate) },
+		"LINESTRING": func() error {
+			_, err := p.coordinates(2)
+			return err
+		},
+		"POLYGON": p.polygon,
+		"MULTIPOINT": func() error {
+			// the points may be in parentheses of their own or not
+			return p.list(0, func() error {
+				if p.peek() == "(" {
+					return p.list(1, p.coordinate)
+				}
+				return p.coordinate()
+			})
+		},
+		"MULTILINESTRING": func() error {
+			return p.list(0, func() error {
+				_, err := p.coordinates(2)
+				return err
+			})
+		},
+		"MULTIPOLYGON":       func() error { return p.list(0, p.polygon) },
+		"GEOMETRYCOLLECTION": func() error { return p.list(0, p.geometry) },
+	}[kind]
+	if !ok {
+		return fmt.Errorf("expected a geometry type but got %s", p.describe(p.peek()))
+	}
+	p.pos++
+	if n, tagged := wktDimensions[strings.ToUpper(p.peek())]; tagged {
+		if p.dimensions > 0 && p.dimensions != n {
+			return fmt.Errorf("%s %s mixes the dimensions of the coordinates", kind, p.peek())
+		}
+		p.dimensions = n
+		p.pos++
+	}
+	if strings.EqualFold(p.peek(), "EMPTY") {
+		p.pos++
+		return nil
+	}
+	if err := body(); err != nil {
+		return fmt.Errorf("%s: %w", kind, err)
+	}
+	return nil
+}
+
+// list checks a parenthesized list of items separated by commas, of at most most items (0 is unlimited)
+func (p *wktParser) list(most int, item func() error) error {
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for n := 1; ; n++ {
+		if err := item(); err != nil {
+			return err
+		}
+		if p.peek() != "," {
+			return p.expect(")")
+		}
+		if most > 0 && n >= most {
+			return fmt.Errorf("expected ')' but got ','")
+		}
+		p.pos++
+	}
+}
+
+// coordinates checks a parenthesized list of at least least coordinates and returns them
+func (p *wktParser) coordinates(least int) ([][]float64, error) {
+	var coords [][]float64
+	err := p.list(0, func() error {
+		c, err := p.numbers()
+		coords = append(coords, c)
+		return err
+	})
+	if err == nil && len(coords) < least {
+		err = fmt.Errorf("needs at least %d points but has %d", least, len(coords))
+	}
+	return coords, err
+}
+
+// polygon checks the rings of a polygon, each closed and of at least 4 points
+func (p *wktParser) polygon() error {
+	return p.list(0, func() error {
+		ring, err := p.coordinates(4)
+		if err != nil {
+			return err
+		}
+		first, last := ring[0], ring[len(ring)-1]
+		for i := range first {
+			if first[i] != last[i] {
+				return fmt.Errorf("the ring isn't closed, it has to end with its first point")
+			}
+		}
+		return nil
+	})
+}
+
+func (p *wktParser) coordinate() error {
+	_, err := p.numbers()
+	return err
+}
+
+// numbers checks a coordinate of 2 to 4 numbers, all coordinates of the geometry have the same number
+func (p *wktParser) numbers() ([]float64, error) {
+	var coord []float64
+	for {
+		token := p.peek()
+		if token == "" || token == "," || token == ")" || token == "(" {
+			break
+		}
+		f, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is no number", token)
+		}
+		coord = append(coord, f)
+		p.pos++
+	}
+	if len(coord) == 0 {
+		return nil, fmt.Errorf("expected a coordinate but got %s", p.describe(p.peek()))
+	}
+	if p.dimensions == 0 && len(coord) >= 2 && len(coord) <= 4 {
+		p.dimensions = len(coord)
+	}
+	if len(coord) != p.dimensions {
+		return nil, fmt.Errorf("a coordinate has %d numbers instead of %d", len(coord), max(p.dimensions, 2))
+	}
+	return coord, nil
+}
@@ -0,0 +1,108 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestWKTValue(t *testing.T) {
+	for _, wkt := range []string{
+		"POINT(13.4 52.5)",
+		" point ( 13.4 52.5 ) ",
+		"POINT Z (1 2 3)",
+		"POINT EMPTY",
+		"LINESTRING(0 0, 1 1, 2 1)",
+		"POLYGON((0 0, 4 0, 4 4, 0 4, 0 0), (1 1, 2 1, 2 2, 1 1))",
+		"MULTIPOINT((0 0), (1 1))",
+		"MULTIPOINT(0 0, 1 1)",
+		"MULTILINESTRING((0 0, 1 1), (2 2, 3 3))",
+		"MULTIPOLYGON(((0 0, 1 0, 1 1, 0 0)), ((5 5, 6 5, 6 6, 5 5)))",
+		"GEOMETRYCOLLECTION(POINT(1 2), LINESTRING(0 0, 1 1))",
+		"POINT ZM (1 2 3 4)",
+	} {
+		_, err := wktValue(wkt)
+		assert.NilError(t, err, wkt)
+	}
+	v, err := wktValue(" POINT(1 2)\n")
+	assert.NilError(t, err)
+	assert.Equal(t, v, "POINT(1 2)")
+
+	for wkt, want := range map[string]string{
+		"":                                  "expected a geometry type but got the end",
+		"CIRCLE(0 0, 5)":                    "expected a geometry type but got 'CIRCLE'",
+		"POINT(13.4)":                       "POINT: a coordinate has 1 numbers instead of 2",
+		"POINT(1 2, 3 4)":                   "POINT: expected ')' but got ','",
+		"POINT(1 2":                         "POINT: expected ')' but got the end",
+		"POINT(1 x)":                        "POINT: 'x' is no number",
+		"POINT()":                           "POINT: expected a coordinate but got ')'",
+		"POINT Z (1 2)":                     "POINT: a coordinate has 2 numbers instead of 3",
+		"LINESTRING(0 0)":                   "LINESTRING: needs at least 2 points but has 1",
+		"LINESTRING(0 0, 1 1 1)":            "LINESTRING: a coordinate has 3 numbers instead of 2",
+		"POLYGON((0 0, 4 0, 4 4, 0 4))":     "POLYGON: the ring isn't closed",
+		"POLYGON((0 0, 1 1, 0 0))":          "POLYGON: needs at least 4 points but has 3",
+		"POINT(1 2) POINT(3 4)":             "unexpected 'POINT' after the geometry",
+		"GEOMETRYCOLLECTION(POINT(1 2), 3)": "GEOMETRYCOLLECTION: expected a geometry type but got '3'",
+		"GEOMETRYCOLLECTION(POINT Z (1 2 3), POINT(1 2))": "GEOMETRYCOLLECTION: POINT: a coordinate has 2 numbers instead of 3",
+	} {
+		_, err := wktValue(wkt)
+		assert.ErrorContains(t, err, "invalid WKT: "+want, wkt)
+	}
+}
+
+func TestGeometryExpr(t *testing.T) {
+	l := newTestLoader()
+	c := Config{Transforms: map[string]string{"location": "trim|wkt", "name": "wkt|lower"}}
+	assert.Assert(t, c.geometryColumn("location"))
+	assert.Assert(t, !c.geometryColumn("name"))
+	assert.Equal(t, c.geometryExpr(), "ST_GeomFromText(?)")
+	c.Dialect, c.GeometrySRID = DialectSQLite, 4326
+	assert.Equal(t, c.geometryExpr(), "GeomFromText(?, 4326)")
+
+	var err error
+	l.config, err = ParseFlags([]string{"-map", "Location=location,Name=name", "-transform", "Location=wkt", "-value-expr", "name=UPPER(?)",
+		"-dialect", "postgres", "-geometry-srid", "4326"})
+	assert.NilError(t, err)
+	query, _ := l.config.buildInsertQuery("places", []string{"location", "name"})
+	assert.Equal(t, query, `INSERT INTO "places" ("location","name") VALUES (ST_GeomFromText(?, 4326),UPPER(?))`)
+
+	for want, args := range map[string][]string{
+		"invalid geometry-srid -1, must not be negative":                    {"-geometry-srid", "-1"},
+		"-transform location=wkt isn't supported by the clickhouse dialect": {"-transform", "location=wkt", "-dialect", "clickhouse"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestImportGeometryAndJSON(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "places.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("name,location,meta\nBerlin,POINT(13.4 52.5),\"{\"\"pop\"\": 3.7}\"\n"+
+		"Nowhere,POINT(13.4),{}\nBroken,POINT(1 2),{pop: 1}\nParis,POINT(2.35 48.86),[]\n"), 0o644))
+	deadLetterFile := filepath.Join(dir, "dead.csv")
+	c, err := ParseFlags([]string{"-csv", filename, "-table", "places", "-dialect", "sqlite", "-workers", "1",
+		"-transform", "location=wkt", "-transform", "meta=json", "-dead-letter-file", deadLetterFile})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec(`INSERT INTO "places" ("name","location","meta") VALUES (?,GeomFromText(?),?), (?,GeomFromText(?),?)`).
+		WithArgs("Berlin", "POINT(13.4 52.5)", `{"pop": 3.7}`, "Paris", "POINT(2.35 48.86)", "[]").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	// the invalid geometry and JSON fail their rows only, with the column and the error
+	assert.Equal(t, stats.RowsDeadLettered, int64(2))
+	content, err := os.ReadFile(deadLetterFile)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(content), "column location: invalid WKT: POINT: a coordinate has 1 numbers instead of 2"), string(content))
+	assert.Assert(t, strings.Contains(string(content), "column meta: invalid JSON at offset 2"), string(content))
+}
@@ -0,0 +1,33 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RunTransform executes the transform statement which moves the rows loaded into the staging table into the
+// final table (e.g. INSERT INTO domain SELECT ... FROM domain_staging) and drops the staging table afterwards
+// if requested. The staging table is kept when the transform fails. Returns the rows affected by the transform.
+func RunTransform(ctx context.Context, db *sql.DB, d Dialect, transformSQL string, stagingTable string, dropStaging bool) (int64, error) {
+	log.Printf("Running transform from staging table %s", stagingTable)
+	result, err := db.ExecContext(ctx, transformSQL)
+	if err != nil {
+		return 0, fmt.Errorf("transform from staging table %s failed: %w", stagingTable, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Transform affected %d rows", affected)
+
+	if dropStaging {
+		if _, err = db.ExecContext(ctx, "DROP TABLE "+quoteTable(d, stagingTable)); err != nil {
+			return affected, fmt.Errorf("dropping staging table %s failed: %w", stagingTable, err)
+		}
+		log.Printf("Dropped staging table %s", stagingTable)
+	}
+	return affected, nil
+}
@@ -0,0 +1,39 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+const testTransform = "INSERT INTO domain SELECT CAST(GlobalRank AS UNSIGNED), Domain FROM domain_staging"
+
+func TestRunTransform(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(testTransform).WillReturnResult(sqlmock.NewResult(0, 42))
+	mock.ExpectExec("DROP TABLE `domain_staging`").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	affected, err := RunTransform(context.Background(), db, mysqlDialect{}, testTransform, "domain_staging", true)
+	assert.NilError(t, err)
+	assert.Equal(t, affected, int64(42))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunTransformKeepsStagingOnError(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(testTransform).WillReturnError(errors.New("Error 1292: Truncated incorrect INTEGER value"))
+
+	_, err = RunTransform(context.Background(), db, mysqlDialect{}, testTransform, "domain_staging", true)
+	assert.ErrorContains(t, err, "transform from staging table domain_staging failed")
+	// no DROP TABLE expected
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
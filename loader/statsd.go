@@ -0,0 +1,89 @@
+package loader
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// statsdPrefix is put in front of every metric name
+const statsdPrefix = "go_mysql_worker."
+
+// statsdQueueSize is the number of metrics which may wait for the sender before new ones get dropped
+const statsdQueueSize = 1000
+
+// StatsD sends metrics to a StatsD (or DogStatsD) server over UDP. Sending is best-effort: metrics are queued
+// without blocking and dropped when the queue is full, so they never slow down the import. A nil *StatsD
+// sends nothing.
+type StatsD struct {
+	conn    net.Conn
+	metrics chan string
+	done    chan struct{}
+}
+
+// NewStatsD sends metrics to addr (host:port)
+func NewStatsD(addr string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error opening statsd connection to %s: %w", addr, err)
+	}
+	s := &StatsD{conn: conn, metrics: make(chan string, statsdQueueSize), done: make(chan struct{})}
+	go s.send()
+	return s, nil
+}
+
+func (s *StatsD) send() {
+	defer close(s.done)
+	for m := range s.metrics {
+		// nobody listening is no reason to stop the import
+		_, _ = s.conn.Write([]byte(m))
+	}
+}
+
+func (s *StatsD) queue(metric string) {
+	select {
+	case s.metrics <- metric:
+	default:
+	}
+}
+
+// Count adds n to the counter name
+func (s *StatsD) Count(name string, n int64) {
+	if s == nil {
+		return
+	}
+	s.queue(statsdPrefix + name + ":" + strconv.FormatInt(n, 10) + "|c")
+}
+
+// Timing records a duration of the timer name in milliseconds
+func (s *StatsD) Timing(name string, d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.queue(statsdPrefix + name + ":" + strconv.FormatFloat(float64(d.Microseconds())/1000, 'f', -1, 64) + "|ms")
+}
+
+// Batch records the metrics of an executed batch of rows
+func (s *StatsD) Batch(rows int, duration time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.Timing("batch_duration", duration)
+	if err != nil {
+		s.Count("errors", 1)
+		return
+	}
+	s.Count("batches", 1)
+	s.Count("rows", int64(rows))
+}
+
+// Close sends the queued metrics and closes the connection
+func (s *StatsD) Close() error {
+	if s == nil {
+		return nil
+	}
+	close(s.metrics)
+	<-s.done
+	return s.conn.Close()
+}
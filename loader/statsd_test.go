@@ -0,0 +1,52 @@
+package loader
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestStatsDNil(t *testing.T) {
+	var s *StatsD
+	s.Batch(8, time.Second, nil)
+	assert.NilError(t, s.Close())
+}
+
+func TestStatsDBatch(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer server.Close()
+	s, err := NewStatsD(server.LocalAddr().String())
+	assert.NilError(t, err)
+
+	s.Batch(8, 1500*time.Microsecond, nil)
+	s.Batch(8, 2*time.Millisecond, errors.New("Error 1062: Duplicate entry"))
+	assert.NilError(t, s.Close())
+
+	var received []string
+	buf := make([]byte, 512)
+	assert.NilError(t, server.SetReadDeadline(time.Now().Add(time.Second)))
+	for len(received) < 5 {
+		n, _, err := server.ReadFrom(buf)
+		assert.NilError(t, err)
+		received = append(received, string(buf[:n]))
+	}
+	assert.DeepEqual(t, received, []string{
+		"go_mysql_worker.batch_duration:1.5|ms",
+		"go_mysql_worker.batches:1|c",
+		"go_mysql_worker.rows:8|c",
+		"go_mysql_worker.batch_duration:2|ms",
+		"go_mysql_worker.errors:1|c",
+	})
+}
+
+func TestStatsDDropsWhenQueueIsFull(t *testing.T) {
+	// the sender is not running, so the queue fills up
+	s := &StatsD{metrics: make(chan string, 1)}
+	s.Count("rows", 1)
+	s.Count("rows", 2)
+	assert.Equal(t, len(s.metrics), 1)
+}
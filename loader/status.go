@@ -0,0 +1,182 @@
+package loader
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the states of a worker in the Status
+const (
+	WorkerIdle      = "idle"
+	WorkerExecuting = "executing"
+	// WorkerParked is a worker -auto-tune doesn't use right now
+	WorkerParked = "parked"
+)
+
+// Status is a snapshot of a running import: the state of every worker, the rows waiting for them and the
+// connection pools. It's served as JSON on /status of -metrics-addr and logged on SIGQUIT.
+type Status struct {
+	RunID          string  `json:"run_id,omitempty"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	RowsInserted   int64   `json:"rows_inserted"`
+	RowsFailed     int64   `json:"rows_failed"`
+	Batches        int64   `json:"batches"`
+	BatchRetries   int64   `json:"batch_retries"`
+	Reconnects     int64   `json:"reconnects"`
+	// QueueDepth are the rows read waiting in the jobs channel for the workers, a full queue means the workers are
+	// the bottleneck and an empty one the reader
+	QueueDepth    int            `json:"queue_depth"`
+	QueueCapacity int            `json:"queue_capacity"`
+	Workers       []WorkerStatus `json:"workers"`
+	// Pools are the stats of the connection pool, one per -shard
+	Pools []PoolStatus `json:"pools,omitempty"`
+}
+
+// WorkerStatus is the state of a worker in the Status, ExecutingSeconds how long its running batch takes so far
+type WorkerStatus struct {
+	Worker           int     `json:"worker"`
+	State            string  `json:"state"`
+	ExecutingSeconds float64 `json:"executing_seconds,omitempty"`
+	Batches          int64   `json:"batches"`
+	Rows             int64   `json:"rows"`
+	AvgBatchMillis   float64 `json:"avg_batch_ms"`
+	LastError        string  `json:"last_error,omitempty"`
+}
+
+// PoolStatus are the stats of a connection pool in the Status
+type PoolStatus struct {
+	MaxOpen     int     `json:"max_open"`
+	Open        int     `json:"open"`
+	InUse       int     `json:"in_use"`
+	Idle        int     `json:"idle"`
+	WaitCount   int64   `json:"wait_count"`
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+// statusSource is what the Status of a running import is taken from
+type statusSource struct {
+	dbs      []*sql.DB
+	queue    jobQueue
+	start    time.Time
+	runID    string
+	counters *counters
+	workers  *workerCounter
+	tuner    *Tuner
+}
+
+// running are the imports running in the process, LogStatus reports on all of them
+var running struct {
+	sync.Mutex
+	imports []*statusSource
+}
+
+// trackStatus makes the import of l inserting the rows of jobs into dbs one Status and RunningStatus report on, the
+// returned function ends that
+func (l *Loader) trackStatus(dbs []*sql.DB, jobs chan Job) func() {
+	s := &statusSource{queue: jobQueue{jobs: jobs, shards: l.shards}, start: time.Now(), runID: l.config.RunID, counters: &l.counters, workers: l.workerStats,
+		tuner: l.tuner}
+	for _, db := range dbs {
+		if db != nil {
+			s.dbs = append(s.dbs, db)
+		}
+	}
+	l.status.Store(s)
+	running.Lock()
+	running.imports = append(running.imports, s)
+	running.Unlock()
+	return func() {
+		l.status.CompareAndSwap(s, nil)
+		running.Lock()
+		defer running.Unlock()
+		running.imports = slices.DeleteFunc(running.imports, func(r *statusSource) bool { return r == s })
+	}
+}
+
+// Status returns the Status of the import l is running, false if there is none
+func (l *Loader) Status() (Status, bool) {
+	src := l.status.Load()
+	if src == nil {
+		return Status{}, false
+	}
+	return src.status(), true
+}
+
+// RunningStatus returns the Status of every import running in the process, in the order they started
+func RunningStatus() []Status {
+	running.Lock()
+	imports := slices.Clone(running.imports)
+	running.Unlock()
+	var statuses []Status
+	for _, src := range imports {
+		statuses = append(statuses, src.status())
+	}
+	return statuses
+}
+
+func (src *statusSource) status() Status {
+	s := Status{
+		RunID:          src.runID,
+		ElapsedSeconds: time.Since(src.start).Seconds(),
+		RowsInserted:   src.counters.rowsInserted.Load(),
+		RowsFailed:     src.counters.rowsFailed.Load(),
+		Batches:        src.counters.batchesExecuted.Load(),
+		BatchRetries:   src.counters.batchRetries.Load(),
+		Reconnects:     src.counters.reconnectCount.Load(),
+		QueueDepth:     src.queue.length(),
+		QueueCapacity:  src.queue.capacity(),
+		Workers:        src.workers.Status(time.Now()),
+	}
+	if active := src.tuner.Active(); src.tuner != nil {
+		for i := range s.Workers {
+			if i >= active && s.Workers[i].State == WorkerIdle {
+				s.Workers[i].State = WorkerParked
+			}
+		}
+	}
+	for _, db := range src.dbs {
+		p := db.Stats()
+		s.Pools = append(s.Pools, PoolStatus{MaxOpen: p.MaxOpenConnections, Open: p.OpenConnections, InUse: p.InUse,
+			Idle: p.Idle, WaitCount: p.WaitCount, WaitSeconds: p.WaitDuration.Seconds()})
+	}
+	return s
+}
+
+// LogStatus logs the Status of every running import as JSON
+func LogStatus() {
+	statuses := RunningStatus()
+	if len(statuses) == 0 {
+		log.Printf("No import is running")
+		return
+	}
+	for _, s := range statuses {
+		b, err := json.Marshal(s)
+		if err != nil {
+			log.Errorf("Could not encode the status: %s", err.Error())
+			return
+		}
+		log.Printf("Status: %s", b)
+	}
+}
+
+// serveStatus serves the Status of the import of l, 503 when there is none
+func serveStatus(l *Loader, w http.ResponseWriter) {
+	var s Status
+	ok := false
+	if l != nil {
+		s, ok = l.Status()
+	}
+	if !ok {
+		http.Error(w, "no import is running", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		log.Warnf("Could not write the status: %s", err.Error())
+	}
+}
@@ -0,0 +1,96 @@
+package loader
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestWorkerCounterStatus(t *testing.T) {
+	c := newWorkerCounter(3)
+	c.Batch(0, 100, 20*time.Millisecond)
+	c.Batch(0, 100, 40*time.Millisecond)
+	c.Begin(1)
+	c.Failed(1, errors.New("deadlock"))
+	c.Begin(2)
+	c.End(2, errors.New("duplicate key"))
+	c.Begin(0)
+	c.End(0, nil)
+
+	status := c.Status(time.Now().Add(time.Second))
+	assert.DeepEqual(t, status[0], WorkerStatus{Worker: 0, State: WorkerIdle, Batches: 2, Rows: 200, AvgBatchMillis: 30})
+	assert.Equal(t, status[1].State, WorkerExecuting)
+	assert.Assert(t, status[1].ExecutingSeconds >= 1, status[1].ExecutingSeconds)
+	assert.Equal(t, status[1].LastError, "deadlock")
+	assert.DeepEqual(t, status[2], WorkerStatus{Worker: 2, State: WorkerIdle, LastError: "duplicate key"})
+
+	var nilCounter *workerCounter
+	nilCounter.Begin(0)
+	nilCounter.End(0, nil)
+	assert.Assert(t, nilCounter.Status(time.Now()) == nil)
+}
+
+func TestLoaderStatus(t *testing.T) {
+	l := newTestLoader()
+	_, ok := l.Status()
+	assert.Assert(t, !ok)
+	assert.Equal(t, len(RunningStatus()), 0)
+
+	db, _, err := sqlmock.New()
+	assert.NilError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(7)
+	jobs := make(chan Job, 10)
+	jobs <- Job{Row: 1}
+	l.workerStats = newWorkerCounter(2)
+	l.workerStats.Begin(1)
+	l.config.RunID = "run-1"
+	l.rowsInserted.Store(3)
+	m := NewMetrics(l, db, jobs, 2)
+	assert.NilError(t, m.Serve("127.0.0.1:0"))
+	defer m.Close()
+
+	res, err := http.Get("http://" + m.addr + "/status")
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusServiceUnavailable)
+
+	done := l.trackStatus([]*sql.DB{db, nil}, jobs)
+	// another Loader running at the same time has a status of its own
+	other := &Loader{}
+	other.config.RunID = "run-2"
+	doneOther := other.trackStatus(nil, make(chan Job))
+	res, err = http.Get("http://" + m.addr + "/status")
+	assert.NilError(t, err)
+	var s Status
+	assert.NilError(t, json.NewDecoder(res.Body).Decode(&s))
+	res.Body.Close()
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	assert.Equal(t, s.RunID, "run-1")
+	assert.Equal(t, s.RowsInserted, int64(3))
+	assert.Equal(t, s.QueueDepth, 1)
+	assert.Equal(t, s.QueueCapacity, 10)
+	assert.Equal(t, len(s.Workers), 2)
+	assert.Equal(t, s.Workers[0].State, WorkerIdle)
+	assert.Equal(t, s.Workers[1].State, WorkerExecuting)
+	assert.Equal(t, len(s.Pools), 1)
+	assert.Equal(t, s.Pools[0].MaxOpen, 7)
+
+	statuses := RunningStatus()
+	assert.Equal(t, len(statuses), 2)
+	assert.Equal(t, statuses[0].RunID, "run-1")
+	assert.Equal(t, statuses[1].RunID, "run-2")
+	assert.Equal(t, statuses[1].RowsInserted, int64(0))
+
+	done()
+	doneOther()
+	_, ok = l.Status()
+	assert.Assert(t, !ok)
+	assert.Equal(t, len(RunningStatus()), 0)
+}
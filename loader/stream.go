@@ -0,0 +1,212 @@
+package loader
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// streamCommitTimeout bounds the commit of the offsets when the stream is closed, the import may be interrupted then
+const streamCommitTimeout = 30 * time.Second
+
+// Message is a message of a MessageStream holding a single row: a CSV line or a JSON object
+type Message struct {
+	Value []byte
+	// Offset identifies the message for MessageStream.Commit, e.g. the partition and offset of a Kafka message or a
+	// JetStream message to acknowledge
+	Offset any
+}
+
+// MessageStream consumes a message log like a Kafka topic of a consumer group or a NATS JetStream subject, it is
+// implemented by the embedding program with the client of its choice. The messages are fetched by a single
+// goroutine.
+type MessageStream interface {
+	// Fetch returns the next message, blocking until there is one or ctx is done. io.EOF ends the import.
+	Fetch(ctx context.Context) (Message, error)
+	// Commit marks msg and all messages fetched before it as consumed, e.g. commits the consumer group offsets. It
+	// is called once their rows are done (committed, dead-lettered or skipped as malformed), from another goroutine
+	// than Fetch.
+	Commit(ctx context.Context, msg Message) error
+	// Close releases the consumer
+	Close() error
+}
+
+// StreamSource is a CSVSource with the rows of the messages of a MessageStream as its only input. The rows are
+// counted like the rows of a file, the messages of the rows done are committed in order while the import runs, so
+// after a crash the stream resumes after the last row committed to the table. The rows of a batch which was
+// inserted but not committed yet are delivered again, a unique key with -on-duplicate ignore or update keeps them
+// from being inserted twice.
+type StreamSource struct {
+	name   string
+	header []string
+	stream MessageStream
+	ctx    context.Context
+	// fetchCtx is ctx for the fetches, stopFetch cancels it once the import doesn't take rows anymore
+	fetchCtx  context.Context
+	stopFetch context.CancelCauseFunc
+
+	mu sync.Mutex
+	// pending are the messages fetched since the last commit, pending[0] is the message of row base+1
+	pending []Message
+	base    int
+	// done is the row up to which all rows are done
+	done int
+
+	// delimiter is the -delimiter the header is written with, set by start
+	delimiter rune
+	read      bool
+	started   bool
+	wake      chan struct{}
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// NewStreamSource returns a source named name with the rows of the messages of stream. header is the header of CSV
+// messages, nil for JSON lines messages (-input-format jsonl) whose keys are the columns.
+func NewStreamSource(name string, header []string, stream MessageStream) *StreamSource {
+	return &StreamSource{name: name, header: header, stream: stream, ctx: context.Background(),
+		fetchCtx: context.Background(), wake: make(chan struct{}, 1), stop: make(chan struct{}), stopped: make(chan struct{})}
+}
+
+// start binds the fetches to the context of the import reading with delimiter and commits the messages of the rows
+// done from then on
+func (s *StreamSource) start(ctx context.Context, delimiter rune) {
+	s.ctx, s.delimiter, s.started = ctx, delimiter, true
+	s.fetchCtx, s.stopFetch = context.WithCancelCause(ctx)
+	go s.commitDone()
+}
+
+// errStreamStopped ends the rows of a stream stopped by stopFetching
+var errStreamStopped = errors.New("stream stopped")
+
+// stopFetching ends the rows of the stream after the ones fetched, e.g. once a worker failed, as the stream has no
+// end the reader would wait for
+func (s *StreamSource) stopFetching() {
+	if s.stopFetch != nil {
+		s.stopFetch(errStreamStopped)
+	}
+}
+
+// Done records that all rows up to row are done, the commit of their messages is left to the committing goroutine
+func (s *StreamSource) Done(row int) {
+	s.mu.Lock()
+	s.done = max(s.done, row)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *StreamSource) commitDone() {
+	defer close(s.stopped)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+			if err := s.commit(s.ctx); err != nil {
+				// the next commit covers these messages as well
+				log.Warnf("Could not commit the messages of %s: %s", s.name, err.Error())
+			}
+		}
+	}
+}
+
+// commit commits the message of the last row done
+func (s *StreamSource) commit(ctx context.Context) error {
+	s.mu.Lock()
+	n := min(s.done-s.base, len(s.pending))
+	if n <= 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	msg := s.pending[n-1]
+	s.pending = s.pending[n:]
+	s.base += n
+	s.mu.Unlock()
+	return s.stream.Commit(ctx, msg)
+}
+
+func (s *StreamSource) Next() (string, io.Reader, error) {
+	if s.read {
+		return "", nil, io.EOF
+	}
+	s.read = true
+	r := &streamReader{s: s}
+	if s.header != nil {
+		var b bytes.Buffer
+		w := csv.NewWriter(&b)
+		w.Comma = cmp.Or(s.delimiter, ',')
+		if err := w.Write(s.header); err != nil {
+			return "", nil, err
+		}
+		w.Flush()
+		r.buf = b.Bytes()
+	}
+	return s.name, r, nil
+}
+
+// Size is unknown, a stream has no end
+func (s *StreamSource) Size() int64 {
+	return 0
+}
+
+// Close commits the messages of the rows done and closes the stream
+func (s *StreamSource) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+		if s.started {
+			<-s.stopped
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(s.ctx), streamCommitTimeout)
+	defer cancel()
+	err := s.commit(ctx)
+	if err != nil {
+		err = fmt.Errorf("could not commit the messages of %s: %w", s.name, err)
+	}
+	return errors.Join(err, s.stream.Close())
+}
+
+// streamReader reads the rows of the messages of a stream, a message without a trailing newline gets one. Blank
+// messages are left out like blank lines, they are committed with the next message.
+type streamReader struct {
+	s   *StreamSource
+	buf []byte
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg, err := r.s.stream.Fetch(r.s.fetchCtx)
+		if err != nil && errors.Is(context.Cause(r.s.fetchCtx), errStreamStopped) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if len(bytes.TrimSpace(msg.Value)) == 0 {
+			continue
+		}
+		r.s.mu.Lock()
+		r.s.pending = append(r.s.pending, msg)
+		r.s.mu.Unlock()
+		r.buf = append(r.buf, msg.Value...)
+		if msg.Value[len(msg.Value)-1] != '\n' {
+			r.buf = append(r.buf, '\n')
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,99 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+// testStream delivers its messages with their index as offset and records the offsets committed
+type testStream struct {
+	messages []string
+	next     int
+	mu       sync.Mutex
+	commits  []any
+	closed   bool
+}
+
+func (s *testStream) Fetch(ctx context.Context) (Message, error) {
+	if s.next == len(s.messages) {
+		return Message{}, io.EOF
+	}
+	s.next++
+	return Message{Value: []byte(s.messages[s.next-1]), Offset: s.next}, nil
+}
+
+func (s *testStream) Commit(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commits = append(s.commits, msg.Offset)
+	return nil
+}
+
+func (s *testStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *testStream) committed() any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.commits) == 0 {
+		return nil
+	}
+	return s.commits[len(s.commits)-1]
+}
+
+func TestStreamSourceCommitsDoneRows(t *testing.T) {
+	c, err := ParseFlags([]string{"-dialect", "sqlite", "-table", "domain", "-workers", "1", "-batch-size", "2", "-max-retries", "0"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	const insert = `INSERT INTO "domain" ("GlobalRank","Domain") VALUES (?,?), (?,?)`
+	mock.ExpectExec(insert).WithArgs("1", "google.com", "2", "youtube.com").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(insert).WithArgs("3", "facebook.com", "4", "baidu.com").WillReturnError(errors.New("disk full"))
+
+	// a blank message is left out
+	stream := &testStream{messages: []string{"1,google.com", "2,youtube.com\n", " ", "3,facebook.com", "4,baidu.com"}}
+	stats, err := New(db, c).RunSource(context.Background(), NewStreamSource("domains", []string{"GlobalRank", "Domain"}, stream))
+	assert.ErrorContains(t, err, "disk full")
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	assert.NilError(t, mock.ExpectationsWereMet())
+	// the messages of the failed batch are delivered again
+	assert.Equal(t, stream.committed(), 2)
+	assert.Assert(t, stream.closed)
+}
+
+func TestStreamSourceJSONLines(t *testing.T) {
+	c, err := ParseFlags([]string{"-dialect", "sqlite", "-table", "domain", "-workers", "1", "-input-format", "jsonl"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec(`INSERT INTO "domain" ("Domain") VALUES (?), (?)`).WithArgs("google.com", "youtube.com").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	stream := &testStream{messages: []string{`{"Domain": "google.com"}`, `{"Domain": "youtube.com"}`}}
+	stats, err := New(db, c).RunSource(context.Background(), NewStreamSource("domains", nil, stream))
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	assert.Equal(t, stream.committed(), 2)
+}
+
+func TestStreamSourceOptions(t *testing.T) {
+	c, err := ParseFlags([]string{"-dry-run"})
+	assert.NilError(t, err)
+	_, err = New(nil, c).RunSource(context.Background(), NewStreamSource("domains", nil, &testStream{}))
+	assert.ErrorContains(t, err, "the CSV stream domains needs a header")
+
+	c, err = ParseFlags([]string{"-dry-run", "-resume-from-line", "3"})
+	assert.NilError(t, err)
+	_, err = New(nil, c).RunSource(context.Background(), NewStreamSource("domains", []string{"Domain"}, &testStream{messages: []string{"google.com"}}))
+	assert.ErrorContains(t, err, "the stream domains resumes after its committed messages")
+}
@@ -0,0 +1,259 @@
+package loader
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// outcome of an import in the Summary, the command exits with a code of its own for each of them
+const (
+	// OutcomeSuccess is an import of all rows read
+	OutcomeSuccess = "success"
+	// OutcomePartial is a finished import which left rows out: malformed, rejected, failed or dead-lettered ones
+	OutcomePartial = "partial"
+	// OutcomeFailed is an import which stopped with an error
+	OutcomeFailed = "failed"
+)
+
+// Summary is the machine-readable report of an import written by -summary-file
+type Summary struct {
+	Outcome string `json:"outcome"`
+	// RunID is the run_id of the log entries of the import
+	RunID string `json:"run_id,omitempty"`
+	// Error is the error the import failed with
+	Error            string  `json:"error,omitempty"`
+	RowsRead         int64   `json:"rows_read"`
+	RowsInserted     int64   `json:"rows_inserted"`
+	RowsSkipped      int64   `json:"rows_skipped"`
+	RowsRejected     int64   `json:"rows_rejected"`
+	RowsDuplicate    int64   `json:"rows_duplicate"`
+	RowsUnrouted     int64   `json:"rows_unrouted"`
+	RowsUnsampled    int64   `json:"rows_unsampled"`
+	RowsReplayed     int64   `json:"rows_replayed"`
+	RowsFailed       int64   `json:"rows_failed"`
+	RowsDeadLettered int64   `json:"rows_dead_lettered"`
+	RowsUpdated      int64   `json:"rows_updated,omitempty"`
+	RowsUnchanged    int64   `json:"rows_unchanged,omitempty"`
+	RowsDeleted      int64   `json:"rows_deleted,omitempty"`
+	BytesRead        int64   `json:"bytes_read"`
+	Batches          int64   `json:"batches"`
+	WallTimeSeconds  float64 `json:"wall_time_seconds"`
+	RowsPerSecond    float64 `json:"rows_per_second"`
+	// Errors are the errors which didn't stop the import by reason, like Stats.Errors
+	Errors  map[string]int64 `json:"errors,omitempty"`
+	Workers []WorkerSummary  `json:"workers"`
+	// BatchLatency is the histogram of the execution times of the batches
+	BatchLatency *LatencySummary `json:"batch_latency,omitempty"`
+}
+
+// LatencySummary is the batch latency histogram in the Summary, the quantiles are the upper bounds of their buckets
+type LatencySummary struct {
+	MeanMillis  float64 `json:"mean_ms"`
+	P50Millis   float64 `json:"p50_ms"`
+	P95Millis   float64 `json:"p95_ms"`
+	P99Millis   float64 `json:"p99_ms"`
+	MaxMillis   float64 `json:"max_ms"`
+	SlowBatches int64   `json:"slow_batches"`
+	// Buckets are the buckets with batches, the last one has no le_ms if it counts the batches slower than all
+	Buckets []LatencyBucketSummary `json:"buckets"`
+}
+
+// LatencyBucketSummary is a bucket of the LatencySummary
+type LatencyBucketSummary struct {
+	LeMillis float64 `json:"le_ms,omitempty"`
+	Batches  int64   `json:"batches"`
+}
+
+// WorkerSummary are the batches executed by a worker in the Summary
+type WorkerSummary struct {
+	Worker       int     `json:"worker"`
+	Batches      int64   `json:"batches"`
+	Rows         int64   `json:"rows"`
+	BatchSeconds float64 `json:"batch_seconds"`
+}
+
+// NewSummary returns the summary of an import with stats which returned err
+func NewSummary(s Stats, err error) Summary {
+	summary := Summary{
+		Outcome:          s.Outcome(err),
+		RowsRead:         s.RowsRead,
+		RowsInserted:     s.RowsInserted,
+		RowsSkipped:      s.RowsSkipped,
+		RowsRejected:     s.RowsRejected,
+		RowsDuplicate:    s.RowsDeduped,
+		RowsUnrouted:     s.RowsUnrouted,
+		RowsUnsampled:    s.RowsUnsampled,
+		RowsReplayed:     s.RowsReplayed,
+		RowsFailed:       s.RowsFailed,
+		RowsDeadLettered: s.RowsDeadLettered,
+		RowsUpdated:      s.RowsUpdated,
+		RowsUnchanged:    s.RowsUnchanged,
+		RowsDeleted:      s.RowsDeleted,
+		BytesRead:        s.BytesRead,
+		Batches:          s.BatchesExecuted,
+		WallTimeSeconds:  s.Duration.Seconds(),
+		RowsPerSecond:    s.Throughput(),
+		Errors:           s.Errors,
+		Workers:          make([]WorkerSummary, len(s.Workers)),
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	for i, w := range s.Workers {
+		summary.Workers[i] = WorkerSummary{Worker: i, Batches: w.Batches, Rows: w.Rows, BatchSeconds: w.BatchTime.Seconds()}
+	}
+	if l := s.BatchLatency; l.Batches > 0 {
+		summary.BatchLatency = &LatencySummary{MeanMillis: millis(l.Mean), P50Millis: millis(l.Quantile(0.5)),
+			P95Millis: millis(l.Quantile(0.95)), P99Millis: millis(l.Quantile(0.99)), MaxMillis: millis(l.Max), SlowBatches: s.SlowBatches}
+		for _, b := range l.Buckets {
+			summary.BatchLatency.Buckets = append(summary.BatchLatency.Buckets, LatencyBucketSummary{LeMillis: millis(b.Le), Batches: b.Batches})
+		}
+	}
+	return summary
+}
+
+// millis returns d in milliseconds
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Outcome returns OutcomeFailed for an import which returned err, OutcomePartial when rows were left out and
+// OutcomeSuccess otherwise
+func (s Stats) Outcome(err error) string {
+	switch {
+	case err != nil:
+		return OutcomeFailed
+	case s.RowsFailed > 0 || s.RowsDeadLettered > 0 || s.RowsRejected > 0:
+		return OutcomePartial
+	}
+	return OutcomeSuccess
+}
+
+// WriteSummary writes s as indented JSON to filename, - is stdout
+func WriteSummary(filename string, s Summary) error {
+	if filename == "-" {
+		return writeSummary(os.Stdout, s)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = writeSummary(f, s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeSummary(w io.Writer, s Summary) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// WorkerStats are the batches a worker executed successfully, their rows and the time it took to execute them
+type WorkerStats struct {
+	Batches   int64
+	Rows      int64
+	BatchTime time.Duration
+}
+
+// workerCounter counts the batches of every worker, it is safe for concurrent use. A nil *workerCounter counts
+// nothing.
+type workerCounter struct {
+	mu      sync.Mutex
+	workers []WorkerStats
+	// states are what the workers do right now, for the Status
+	states []workerState
+}
+
+// workerState is the running batch of a worker (since is zero when it's idle) and the error of its last failed one
+type workerState struct {
+	since     time.Time
+	lastError string
+}
+
+func newWorkerCounter(workers int) *workerCounter {
+	n := max(1, workers)
+	return &workerCounter{workers: make([]WorkerStats, n), states: make([]workerState, n)}
+}
+
+// Batch counts a batch of rows executed by worker workerIndex in duration
+func (c *workerCounter) Batch(workerIndex int, rows int64, duration time.Duration) {
+	if c == nil || workerIndex < 0 || workerIndex >= len(c.workers) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &c.workers[workerIndex]
+	w.Batches++
+	w.Rows += rows
+	w.BatchTime += duration
+}
+
+// Begin records that worker workerIndex started executing a batch
+func (c *workerCounter) Begin(workerIndex int) {
+	if c == nil || workerIndex < 0 || workerIndex >= len(c.states) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states[workerIndex].since = time.Now()
+}
+
+// End records that worker workerIndex is done with its batch, err is the error of its last attempt
+func (c *workerCounter) End(workerIndex int, err error) {
+	if c == nil || workerIndex < 0 || workerIndex >= len(c.states) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states[workerIndex].since = time.Time{}
+	if err != nil {
+		c.states[workerIndex].lastError = err.Error()
+	}
+}
+
+// Failed records the error of a failed attempt of worker workerIndex, which may still be retried
+func (c *workerCounter) Failed(workerIndex int, err error) {
+	if c == nil || workerIndex < 0 || workerIndex >= len(c.states) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states[workerIndex].lastError = err.Error()
+}
+
+// Status returns the state of every worker at now
+func (c *workerCounter) Status(now time.Time) []WorkerStatus {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := make([]WorkerStatus, len(c.workers))
+	for i, w := range c.workers {
+		s := WorkerStatus{Worker: i, State: WorkerIdle, Batches: w.Batches, Rows: w.Rows, LastError: c.states[i].lastError}
+		if since := c.states[i].since; !since.IsZero() {
+			s.State, s.ExecutingSeconds = WorkerExecuting, now.Sub(since).Seconds()
+		}
+		if w.Batches > 0 {
+			s.AvgBatchMillis = float64(w.BatchTime.Microseconds()) / 1000 / float64(w.Batches)
+		}
+		status[i] = s
+	}
+	return status
+}
+
+// Stats returns the counts of every worker so far
+func (c *workerCounter) Stats() []WorkerStats {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]WorkerStats(nil), c.workers...)
+}
@@ -0,0 +1,64 @@
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestStatsOutcome(t *testing.T) {
+	assert.Equal(t, Stats{RowsRead: 2, RowsInserted: 2}.Outcome(nil), OutcomeSuccess)
+	assert.Equal(t, Stats{RowsRead: 2, RowsInserted: 1, RowsFailed: 1}.Outcome(nil), OutcomePartial)
+	assert.Equal(t, Stats{RowsRead: 2, RowsInserted: 1, RowsDeadLettered: 1}.Outcome(nil), OutcomePartial)
+	assert.Equal(t, Stats{RowsRead: 2, RowsInserted: 2}.Outcome(errors.New("lost connection")), OutcomeFailed)
+}
+
+func TestWriteSummary(t *testing.T) {
+	stats := Stats{
+		RowsRead: 4, RowsInserted: 3, RowsFailed: 1, RowsRejected: 1, RowsSkipped: 2, BytesRead: 80, BatchesExecuted: 2,
+		Duration: 2 * time.Second, Workers: []WorkerStats{{Batches: 2, Rows: 3, BatchTime: 500 * time.Millisecond}},
+	}
+	filename := filepath.Join(t.TempDir(), "summary.json")
+	assert.NilError(t, WriteSummary(filename, NewSummary(stats, nil)))
+
+	content, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	var summary map[string]any
+	assert.NilError(t, json.Unmarshal(content, &summary))
+	assert.Equal(t, summary["outcome"], OutcomePartial)
+	assert.Equal(t, summary["rows_inserted"], 3.0)
+	assert.Equal(t, summary["rows_rejected"], 1.0)
+	assert.Equal(t, summary["rows_skipped"], 2.0)
+	assert.Equal(t, summary["bytes_read"], 80.0)
+	assert.Equal(t, summary["wall_time_seconds"], 2.0)
+	assert.Equal(t, summary["rows_per_second"], 1.5)
+	assert.DeepEqual(t, summary["workers"], []any{map[string]any{"worker": 0.0, "batches": 2.0, "rows": 3.0, "batch_seconds": 0.5}})
+	_, hasError := summary["error"]
+	assert.Assert(t, !hasError)
+}
+
+func TestLoaderRunWorkerStats(t *testing.T) {
+	c, err := ParseFlags([]string{"-dry-run", "-workers", "2", "-batch-size", "2", "-resume-from-line", "2"})
+	assert.NilError(t, err)
+
+	input := "GlobalRank,Domain\n1,google.com\n2,youtube.com\n3,facebook.com\n4,baidu.com\n5,wikipedia.org\n"
+	stats, err := New(nil, c).RunReader(context.Background(), strings.NewReader(input))
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsSkipped, int64(1))
+	assert.Equal(t, stats.RowsRead, int64(4))
+	assert.Equal(t, stats.BytesRead, int64(len(input)))
+	assert.Equal(t, len(stats.Workers), 2)
+	var rows int64
+	for _, w := range stats.Workers {
+		rows += w.Rows
+	}
+	assert.Equal(t, rows, int64(4))
+	assert.Equal(t, stats.Outcome(nil), OutcomeSuccess)
+}
@@ -0,0 +1,78 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// suffixes of the tables of -swap: the rows are loaded into the staging copy of the target table, which then
+// replaces it, the replaced table is renamed to the old one and dropped
+const (
+	swapStagingSuffix = "_staging"
+	swapOldSuffix     = "_old"
+)
+
+// PrepareSwap (re)creates the staging copy of table as an empty table of the same definition
+func PrepareSwap(ctx context.Context, db *sql.DB, d Dialect, table string) error {
+	staging := table + swapStagingSuffix
+	log.Printf("Loading the staging table %s, it replaces %s after the import", staging, table)
+	// a table left by a failed run which couldn't clean up
+	for _, stmt := range []string{"DROP TABLE IF EXISTS " + quoteTable(d, staging), "CREATE TABLE " + quoteTable(d, staging) + " LIKE " + quoteTable(d, table)} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("preparing the staging table %s failed: %w", staging, err)
+		}
+	}
+	return nil
+}
+
+// SwapTables replaces table by its staging copy with a single RENAME TABLE, so readers see either the old or the
+// new rows, and drops the old table
+func SwapTables(ctx context.Context, db *sql.DB, d Dialect, table string) error {
+	staging, old := table+swapStagingSuffix, table+swapOldSuffix
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+quoteTable(d, old)); err != nil {
+		return fmt.Errorf("dropping the old table %s failed: %w", old, err)
+	}
+	rename := fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", quoteTable(d, table), quoteTable(d, old), quoteTable(d, staging), quoteTable(d, table))
+	if _, err := db.ExecContext(ctx, rename); err != nil {
+		return fmt.Errorf("swapping the staging table %s with %s failed: %w", staging, table, err)
+	}
+	log.Printf("Swapped the staging table %s with %s", staging, table)
+	if _, err := db.ExecContext(ctx, "DROP TABLE "+quoteTable(d, old)); err != nil {
+		return fmt.Errorf("dropping the old table %s failed: %w", old, err)
+	}
+	return nil
+}
+
+// dropSwapStaging drops the staging table of a failed -swap import, the target table stays as it was. It runs
+// even when the import was interrupted, so it gets a context of its own.
+func dropSwapStaging(ctx context.Context, db *sql.DB, d Dialect, table string) {
+	staging := table + swapStagingSuffix
+	if _, err := db.ExecContext(context.WithoutCancel(ctx), "DROP TABLE IF EXISTS "+quoteTable(d, staging)); err != nil {
+		log.Errorf("Could not drop the staging table %s: %s", staging, err.Error())
+		return
+	}
+	log.Warnf("Dropped the staging table %s, table %s is unchanged", staging, table)
+}
+
+// validateSwap checks -swap, the staging table is the only target table and is loaded from scratch
+func (c *Config) validateSwap() error {
+	if !c.Swap {
+		return nil
+	}
+	if !c.isMySQL() {
+		return fmt.Errorf("-swap requires the mysql dialect, it swaps the tables with RENAME TABLE")
+	}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"staging-table", c.StagingTable != ""}, {"table-template", c.TableTemplate != ""}, {"route", len(c.Routes) > 0},
+		{"create-table", c.CreateTable}, {"truncate", c.Truncate}, {"checkpoint-file", c.CheckpointFile != ""}, {"resume", c.Resume}} {
+		if f.set {
+			return fmt.Errorf("-swap can't be combined with -%s", f.name)
+		}
+	}
+	return nil
+}
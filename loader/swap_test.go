@@ -0,0 +1,76 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+const swapColumnsQuery = "SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION"
+
+func swapTestConfig(t *testing.T) Config {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain\n1,google.com\n2,youtube.com\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-workers", "1", "-swap"})
+	assert.NilError(t, err)
+	return c
+}
+
+func TestImportSwap(t *testing.T) {
+	c := swapTestConfig(t)
+	assert.Equal(t, c.InsertTable(), "domain_staging")
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec("DROP TABLE IF EXISTS `domain_staging`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE `domain_staging` LIKE `domain`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(swapColumnsQuery).WithArgs("domain_staging").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("GlobalRank").AddRow("Domain"))
+	mock.ExpectExec("INSERT INTO `domain_staging` (`GlobalRank`,`Domain`) VALUES (?,?), (?,?)").
+		WithArgs("1", "google.com", "2", "youtube.com").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DROP TABLE IF EXISTS `domain_old`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RENAME TABLE `domain` TO `domain_old`, `domain_staging` TO `domain`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DROP TABLE `domain_old`").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.RowsInserted, int64(2))
+}
+
+func TestImportSwapFailure(t *testing.T) {
+	c := swapTestConfig(t)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	// the target table isn't touched, the staging table is dropped
+	mock.ExpectExec("DROP TABLE IF EXISTS `domain_staging`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE `domain_staging` LIKE `domain`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(swapColumnsQuery).WithArgs("domain_staging").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("GlobalRank").AddRow("Domain"))
+	mock.ExpectExec("INSERT INTO `domain_staging` (`GlobalRank`,`Domain`) VALUES (?,?), (?,?)").
+		WithArgs("1", "google.com", "2", "youtube.com").WillReturnError(errors.New("disk full"))
+	mock.ExpectExec("DROP TABLE IF EXISTS `domain_staging`").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err = New(db, c).Run(context.Background())
+	assert.ErrorContains(t, err, "disk full")
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestSwapFlags(t *testing.T) {
+	for want, args := range map[string][]string{
+		"-swap requires the mysql dialect":              {"-swap", "-dialect", "sqlite"},
+		"-swap can't be combined with -staging-table":   {"-swap", "-staging-table", "s", "-transform-sql", "INSERT INTO domain SELECT * FROM s"},
+		"-swap can't be combined with -truncate":        {"-swap", "-truncate"},
+		"-swap can't be combined with -checkpoint-file": {"-swap", "-checkpoint-file", "c"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want, args)
+	}
+}
@@ -0,0 +1,441 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Sync makes a table match its input: it's keyed on the -sync-key columns, the rows with a new key are inserted,
+// the ones whose other columns changed are updated and with -sync-delete the rows whose key isn't in the input are
+// deleted. The rows of the table are read first, the key and a hash of the other columns of every row are kept in
+// memory to tell the changed rows from the unchanged ones, which are skipped.
+type Sync struct {
+	db     *sql.DB
+	config Config
+}
+
+// NewSync syncs the -table of c in db with the inputs of c
+func NewSync(db *sql.DB, c Config) *Sync {
+	return &Sync{db: db, config: c}
+}
+
+// Run syncs the table, the returned Stats count the changed rows in RowsUpdated (part of RowsInserted), the
+// skipped ones in RowsUnchanged and the deleted ones in RowsDeleted
+func (s *Sync) Run(ctx context.Context) (Stats, error) {
+	c := s.config
+	if err := c.validateSync(); err != nil {
+		return Stats{}, err
+	}
+	// the changed rows are written by the upsert of the batches
+	c.OnDuplicate = OnDuplicateUpdate
+	if len(c.ConflictColumns) == 0 {
+		c.ConflictColumns = c.SyncKey
+	}
+	l := New(s.db, c)
+	l.sync = true
+	return l.Run(ctx)
+}
+
+// validateSync checks the options of the sync command, which reads the table and compares every row read with it
+func (c *Config) validateSync() error {
+	if len(c.SyncKey) == 0 {
+		return fmt.Errorf("sync requires -sync-key, the columns identifying a row")
+	}
+	if !slices.Contains(c.dialect().OnDuplicateModes(), OnDuplicateUpdate) {
+		return fmt.Errorf("sync isn't supported by the %s dialect, it updates the changed rows", c.Dialect)
+	}
+	if len(c.Tables) > 0 {
+		return fmt.Errorf("sync loads a single table, not the tables of a -config file")
+	}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"dry-run", c.DryRun}, {"on-duplicate", c.OnDuplicate != OnDuplicateError && c.OnDuplicate != OnDuplicateUpdate},
+		{"swap", c.Swap}, {"truncate", c.Truncate}, {"create-table", c.CreateTable}, {"staging-table", c.StagingTable != ""},
+		{"table-template", c.TableTemplate != ""}, {"route", len(c.Routes) > 0}, {"shard", len(c.Shards) > 0},
+		{"watch-dir", c.WatchDir != ""}, {"mode load-data", c.Mode == ModeLoadData}, {"value-expr", len(c.ValueExprs) > 0}} {
+		if f.set {
+			return fmt.Errorf("-%s can't be combined with sync", f.name)
+		}
+	}
+	for column := range c.Transforms {
+		if c.geometryColumn(column) {
+			return fmt.Errorf("-transform %s=%s can't be combined with sync, the stored geometries can't be compared with the WKT", column, geometryTransformer)
+		}
+	}
+	if !c.SyncDelete {
+		return nil
+	}
+	// the rows not read would be deleted
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"sample", c.Sample > 0 && c.Sample < 1}, {"max-lines", c.MaxLines > 0}, {"skip-rows", c.SkipRows() > 0},
+		{"resume", c.Resume}, {"checkpoint-file", c.CheckpointFile != ""}} {
+		if f.set {
+			return fmt.Errorf("-sync-delete can't be combined with -%s, the rows not read would be deleted", f.name)
+		}
+	}
+	return nil
+}
+
+// syncRow is a row of the table being synced: the hash of its compared columns and whether its key was read
+type syncRow struct {
+	hash uint64
+	seen bool
+}
+
+// syncState are the rows of the table being synced by key. It is used by the reader, which skips the unchanged
+// rows, and by the workers counting the committed changed rows. A nil *syncState syncs nothing.
+type syncState struct {
+	// config is the config of the run, the values are bound and the missing rows deleted with its options
+	config *Config
+	table  string
+	// keys are the names of the -sync-key columns and keyIndexes their indexes in the insert columns, compared the
+	// indexes of the other columns but the -generate ones, which are set anew for every changed row
+	keys       []string
+	keyIndexes []int
+	compared   []int
+	// normalize converts the values of the insert columns to the text the table returns for them, nil for the
+	// columns compared as they are
+	normalize []func(string) string
+	seed      maphash.Seed
+	rows      map[string]syncRow
+	unchanged int64
+	mu        sync.Mutex
+	// changed are the numbers of the changed rows read until their batch commits
+	changed map[int]struct{}
+	updated atomic.Int64
+}
+
+// loadSyncState reads the rows of table, whose rows are inserted into columns. With MySQL the -sync-key has to be
+// the primary key or a unique index of table, the other dialects fail the upsert of the first batch otherwise.
+func (c *Config) loadSyncState(ctx context.Context, db *sql.DB, table string, columns []string) (*syncState, error) {
+	s := &syncState{config: c, table: table, keys: c.SyncKey, seed: maphash.MakeSeed(), rows: map[string]syncRow{}, changed: map[int]struct{}{}}
+	for _, key := range s.keys {
+		i := slices.Index(columns, key)
+		if i < 0 {
+			return nil, fmt.Errorf("-sync-key %s isn't a column inserted into table %s, the columns are: %s", key, table, strings.Join(columns, ", "))
+		}
+		s.keyIndexes = append(s.keyIndexes, i)
+	}
+	if c.isMySQL() {
+		if err := checkSyncKey(ctx, db, table, s.keys); err != nil {
+			return nil, err
+		}
+		types, err := TableColumnTypes(ctx, db, table)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the columns of table %s to sync: %w", table, err)
+		}
+		s.normalize = make([]func(string) string, len(columns))
+		for i, column := range columns {
+			if j := slices.IndexFunc(types, func(t ColumnType) bool { return strings.EqualFold(t.Name, column) }); j >= 0 {
+				s.normalize[i] = syncNormalizer(types[j])
+			}
+		}
+	}
+	generated := c.generatedColumns()
+	selected := slices.Clone(s.keys)
+	indexes := slices.Clone(s.keyIndexes)
+	for i, column := range columns {
+		if !slices.Contains(s.keys, column) && !slices.Contains(generated, column) {
+			s.compared = append(s.compared, i)
+			selected = append(selected, column)
+			indexes = append(indexes, i)
+		}
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoteIdentifiers(c.dialect(), selected), ", "), quoteTable(c.dialect(), table))
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the rows of table %s to sync: %w", table, err)
+	}
+	defer rows.Close()
+	values := make([]sql.NullString, len(selected))
+	dest := make([]any, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not read the rows of table %s to sync: %w", table, err)
+		}
+		for i, index := range indexes {
+			values[i] = s.normalized(index, values[i])
+		}
+		key, ok := syncKey(values[:len(s.keys)])
+		// a row without a key can't be matched by the input, it's left alone
+		if !ok {
+			continue
+		}
+		s.rows[key] = syncRow{hash: s.hash(values[len(s.keys):])}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read the rows of table %s to sync: %w", table, err)
+	}
+	log.Printf("Read the keys of %d rows of table %s to sync", len(s.rows), table)
+	return s, nil
+}
+
+// syncKeyIndexesQuery returns the columns of the primary key and the unique indexes of a table
+const syncKeyIndexesQuery = `SELECT INDEX_NAME, COLUMN_NAME FROM information_schema.STATISTICS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND NON_UNIQUE = 0
+ORDER BY INDEX_NAME, SEQ_IN_INDEX`
+
+// checkSyncKey fails unless keys are the columns of the primary key or of a unique index of table: the upsert
+// updates the row of any unique index the row collides with, which is only the row of the same key if the key is
+// such an index
+func checkSyncKey(ctx context.Context, db *sql.DB, table string, keys []string) error {
+	rows, err := db.QueryContext(ctx, syncKeyIndexesQuery, table)
+	if err != nil {
+		return fmt.Errorf("could not read the indexes of table %s to sync: %w", table, err)
+	}
+	defer rows.Close()
+	var names []string
+	indexes := map[string][]string{}
+	for rows.Next() {
+		var name, column string
+		if err = rows.Scan(&name, &column); err != nil {
+			return fmt.Errorf("could not read the indexes of table %s to sync: %w", table, err)
+		}
+		if _, ok := indexes[name]; !ok {
+			names = append(names, name)
+		}
+		indexes[name] = append(indexes[name], column)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("could not read the indexes of table %s to sync: %w", table, err)
+	}
+	var unique []string
+	for _, name := range names {
+		columns := indexes[name]
+		if len(columns) == len(keys) && !slices.ContainsFunc(keys, func(key string) bool {
+			return !slices.ContainsFunc(columns, func(column string) bool { return strings.EqualFold(column, key) })
+		}) {
+			return nil
+		}
+		unique = append(unique, fmt.Sprintf("%s (%s)", name, strings.Join(columns, ", ")))
+	}
+	if len(unique) == 0 {
+		return fmt.Errorf("-sync-key %s must be the primary key or a unique index of table %s, which has none", strings.Join(keys, ","), table)
+	}
+	return fmt.Errorf("-sync-key %s must be the primary key or a unique index of table %s, which has: %s", strings.Join(keys, ","), table,
+		strings.Join(unique, ", "))
+}
+
+// syncNormalizer returns the conversion of the values of a column of type t to the text MySQL returns for them, so
+// e.g. 1.5 and 1.50 of a DECIMAL(5,2) or 2024-01-05 and 2024-01-05 00:00:00 of a DATETIME compare equal. nil
+// compares the values as they are, like the ones failing the conversion.
+func syncNormalizer(t ColumnType) func(string) string {
+	var fn func(string) (string, error)
+	switch t.DataType {
+	case "tinyint", "smallint", "mediumint", "int", "bigint":
+		fn = intCoercion(t)
+	case "decimal":
+		// the stored values fit, the precision only rejects the input values which don't
+		fn = decimalCoercion(ColumnType{ColumnType: t.ColumnType, Precision: math.MaxInt32, Scale: t.Scale})
+	case "float", "double":
+		// a FLOAT is returned with the digits telling its float32 apart
+		bits := 64
+		if t.DataType == "float" {
+			bits = 32
+		}
+		fn = func(v string) (string, error) {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), bits)
+			return strconv.FormatFloat(f, 'g', -1, bits), err
+		}
+	case "date":
+		fn = timeCoercion(time.DateOnly)
+	case "datetime", "timestamp":
+		fn = timeCoercion("2006-01-02 15:04:05.999999")
+	default:
+		return nil
+	}
+	return func(v string) string {
+		if n, err := fn(v); err == nil {
+			return n
+		}
+		return v
+	}
+}
+
+// normalized returns v of the insert column index as the table returns it
+func (s *syncState) normalized(index int, v sql.NullString) sql.NullString {
+	if !v.Valid || index >= len(s.normalize) || s.normalize[index] == nil {
+		return v
+	}
+	return sql.NullString{String: s.normalize[index](v.String), Valid: true}
+}
+
+// syncKey joins the values of the key columns, false if one of them is NULL
+func syncKey(values []sql.NullString) (string, bool) {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		if !v.Valid {
+			return "", false
+		}
+		parts[i] = v.String
+	}
+	return strings.Join(parts, dedupeKeySeparator), true
+}
+
+// hash returns the hash of the values of the compared columns, telling NULL from an empty value
+func (s *syncState) hash(values []sql.NullString) uint64 {
+	var h maphash.Hash
+	h.SetSeed(s.seed)
+	for _, v := range values {
+		if !v.Valid {
+			h.WriteByte('-')
+			continue
+		}
+		h.WriteString(strconv.Itoa(len(v.String)))
+		h.WriteByte(':')
+		h.WriteString(v.String)
+	}
+	return h.Sum64()
+}
+
+// Unchanged reports whether the row read with values (the fields and the -generate values) is in the table as it
+// is, so it's skipped. A changed row is remembered to be counted as updated once it's committed, row number is
+// only used for that and for logging.
+func (s *syncState) Unchanged(values []string, number int) bool {
+	if s == nil {
+		return false
+	}
+	// the values as they are bound, with the NULLs and the converted values
+	args := s.config.bindArgs(values, 1)
+	stored := make([]sql.NullString, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+		case string:
+			stored[i] = sql.NullString{String: v, Valid: true}
+		case []byte:
+			stored[i] = sql.NullString{String: string(v), Valid: true}
+		default:
+			stored[i] = sql.NullString{String: fmt.Sprint(v), Valid: true}
+		}
+		stored[i] = s.normalized(i, stored[i])
+	}
+	keyValues := make([]sql.NullString, len(s.keyIndexes))
+	for i, index := range s.keyIndexes {
+		keyValues[i] = stored[index]
+	}
+	key, ok := syncKey(keyValues)
+	if !ok {
+		return false
+	}
+	row, ok := s.rows[key]
+	if !ok {
+		return false
+	}
+	row.seen = true
+	s.rows[key] = row
+	compared := make([]sql.NullString, len(s.compared))
+	for i, index := range s.compared {
+		compared[i] = stored[index]
+	}
+	if s.hash(compared) == row.hash {
+		s.unchanged++
+		log.Debugf("Row %d skipped, it's unchanged in table %s", number, s.table)
+		return true
+	}
+	s.mu.Lock()
+	s.changed[number] = struct{}{}
+	s.mu.Unlock()
+	return false
+}
+
+// committed counts the changed rows of a committed batch of rows rows as updated
+func (s *syncState) committed(rows []int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, row := range rows {
+		if _, ok := s.changed[row]; ok {
+			delete(s.changed, row)
+			s.updated.Add(1)
+		}
+	}
+}
+
+// Skipped returns the number of unchanged rows skipped
+func (s *syncState) Skipped() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.unchanged
+}
+
+// Updated returns the number of changed rows committed
+func (s *syncState) Updated() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.updated.Load()
+}
+
+// DeleteMissing deletes the rows of the table whose key wasn't read, in statements of -batch-size keys, and
+// returns the number of rows deleted
+func (s *syncState) DeleteMissing(ctx context.Context, db *sql.DB) (int64, error) {
+	var missing []string
+	for key, row := range s.rows {
+		if !row.seen {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	var deleted int64
+	for start := 0; start < len(missing); start += s.config.BatchSize {
+		keys := missing[start:min(start+s.config.BatchSize, len(missing))]
+		args := make([]any, 0, len(keys)*len(s.keys))
+		for _, key := range keys {
+			for _, v := range strings.Split(key, dedupeKeySeparator) {
+				args = append(args, v)
+			}
+		}
+		query, _ := bindPlaceholders(s.config.dialect(), buildSyncDelete(s.config.dialect(), s.table, s.keys, len(keys)), 0)
+		result, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return deleted, fmt.Errorf("deleting the rows of table %s missing from the input failed: %w", s.table, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+	}
+	log.Printf("Deleted %d rows of table %s missing from the input", deleted, s.table)
+	return deleted, nil
+}
+
+// buildSyncDelete returns the DELETE of the rows of table with any of n keys of the columns keys
+func buildSyncDelete(d Dialect, table string, keys []string, n int) string {
+	if len(keys) == 1 {
+		return fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)", quoteTable(d, table), quoteIdentifier(d, keys[0]), strings.Join(generateQuestionsMark(n), ", "))
+	}
+	conditions := make([]string, len(keys))
+	for i, key := range keys {
+		conditions[i] = quoteIdentifier(d, key) + " = ?"
+	}
+	match := "(" + strings.Join(conditions, " AND ") + ")"
+	matches := make([]string, n)
+	for i := range matches {
+		matches[i] = match
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", quoteTable(d, table), strings.Join(matches, " OR "))
+}
@@ -0,0 +1,152 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestValidateSync(t *testing.T) {
+	for want, args := range map[string][]string{
+		"sync requires -sync-key":                           {},
+		"-dry-run can't be combined with sync":              {"-sync-key", "code", "-dry-run"},
+		"-on-duplicate can't be combined with sync":         {"-sync-key", "code", "-on-duplicate", "ignore"},
+		"-swap can't be combined with sync":                 {"-sync-key", "code", "-swap"},
+		"sync isn't supported by the clickhouse dialect":    {"-sync-key", "code", "-dialect", "clickhouse"},
+		"-transform location=wkt can't be combined":         {"-sync-key", "code", "-transform", "location=wkt"},
+		"-sync-delete can't be combined with -max-lines":    {"-sync-key", "code", "-sync-delete", "-max-lines", "10"},
+		"-sync-delete can't be combined with -skip-rows":    {"-sync-key", "code", "-sync-delete", "-skip-rows", "1"},
+		"-sync-delete can't be combined with -sample, the ": {"-sync-key", "code", "-sync-delete", "-sample", "0.5"},
+	} {
+		c, err := ParseFlags(args)
+		assert.NilError(t, err)
+		_, err = NewSync(nil, c).Run(context.Background())
+		assert.ErrorContains(t, err, want)
+	}
+	_, err := ParseFlags([]string{"-sync-delete"})
+	assert.ErrorContains(t, err, "-sync-delete requires -sync-key")
+}
+
+func TestBuildSyncDelete(t *testing.T) {
+	assert.Equal(t, buildSyncDelete(mysqlDialect{}, "tld", []string{"code"}, 3), "DELETE FROM `tld` WHERE `code` IN (?, ?, ?)")
+	assert.Equal(t, buildSyncDelete(mysqlDialect{}, "prices", []string{"shop", "sku"}, 2),
+		"DELETE FROM `prices` WHERE (`shop` = ? AND `sku` = ?) OR (`shop` = ? AND `sku` = ?)")
+}
+
+func TestSync(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "tld.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("code,name,note\nde,Germany,\nfr,France,\nes,Spain,new\nat,Austria,\n"), 0o644))
+	c, err := ParseFlags([]string{"-csv", filename, "-table", "tld", "-dialect", "sqlite", "-workers", "1", "-sync-key", "code",
+		"-sync-delete", "-empty-as-null", "-generate", "loaded_at={{row}}"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	// the generated column isn't compared, a NULL differs from an empty value
+	mock.ExpectQuery(`SELECT "code", "name", "note" FROM "tld"`).WillReturnRows(sqlmock.NewRows([]string{"code", "name", "note"}).
+		AddRow("de", "Germany", nil).AddRow("fr", "Frankreich", nil).AddRow("it", "Italy", nil).AddRow("at", "Austria", "").
+		AddRow("ch", "Switzerland", nil).AddRow(nil, "Nowhere", nil))
+	mock.ExpectExec(`INSERT INTO "tld" ("code","name","note","loaded_at") VALUES (?,?,?,?), (?,?,?,?), (?,?,?,?) `+
+		`ON CONFLICT ("code") DO UPDATE SET "code"=excluded."code","name"=excluded."name","note"=excluded."note","loaded_at"=excluded."loaded_at"`).
+		WithArgs("fr", "France", nil, "2", "es", "Spain", "new", "3", "at", "Austria", nil, "4").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`DELETE FROM "tld" WHERE "code" IN (?, ?)`).WithArgs("ch", "it").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	stats, err := NewSync(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.RowsRead, int64(4))
+	assert.Equal(t, stats.RowsInserted, int64(3))
+	assert.Equal(t, stats.RowsUpdated, int64(2))
+	assert.Equal(t, stats.RowsUnchanged, int64(1))
+	assert.Equal(t, stats.RowsDeleted, int64(2))
+}
+
+func TestCheckSyncKey(t *testing.T) {
+	for _, tc := range []struct {
+		keys []string
+		err  string
+	}{
+		{[]string{"id"}, ""},
+		{[]string{"SKU", "shop"}, ""},
+		{[]string{"shop"}, "-sync-key shop must be the primary key or a unique index of table prices, which has: PRIMARY (id), shop_sku (shop, sku)"},
+		{[]string{"id", "shop"}, "-sync-key id,shop must be the primary key or a unique index"},
+	} {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		assert.NilError(t, err)
+		mock.ExpectQuery(syncKeyIndexesQuery).WithArgs("prices").WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAME"}).
+			AddRow("PRIMARY", "id").AddRow("shop_sku", "shop").AddRow("shop_sku", "sku"))
+		err = checkSyncKey(context.Background(), db, "prices", tc.keys)
+		if tc.err == "" {
+			assert.NilError(t, err, tc.keys)
+		} else {
+			assert.ErrorContains(t, err, tc.err)
+		}
+		assert.NilError(t, mock.ExpectationsWereMet())
+		db.Close()
+	}
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(syncKeyIndexesQuery).WithArgs("log").WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAME"}))
+	err = checkSyncKey(context.Background(), db, "log", []string{"id"})
+	assert.ErrorContains(t, err, "-sync-key id must be the primary key or a unique index of table log, which has none")
+}
+
+func TestSyncNormalizer(t *testing.T) {
+	for _, tc := range []struct {
+		t            ColumnType
+		input, table string
+	}{
+		{ColumnType{DataType: "decimal", ColumnType: "decimal(5,2)", Precision: 5, Scale: 2}, "1.5", "1.50"},
+		{ColumnType{DataType: "decimal", ColumnType: "decimal(5,2)", Precision: 5, Scale: 2}, "-0.125", "-0.13"},
+		{ColumnType{DataType: "datetime", ColumnType: "datetime"}, "2024-01-05", "2024-01-05 00:00:00"},
+		{ColumnType{DataType: "datetime", ColumnType: "datetime(3)"}, "2024-01-05T10:00:00.5", "2024-01-05 10:00:00.500"},
+		// the driver returns the times parsed with parseTime=true as RFC 3339
+		{ColumnType{DataType: "date", ColumnType: "date"}, "2024/01/05", "2024-01-05T00:00:00Z"},
+		{ColumnType{DataType: "float", ColumnType: "float"}, "0.10", "0.1"},
+		{ColumnType{DataType: "double", ColumnType: "double"}, "1E3", "1000"},
+		{ColumnType{DataType: "int", ColumnType: "int"}, "007", "7"},
+		{ColumnType{DataType: "tinyint", ColumnType: "tinyint(1)"}, "true", "1"},
+	} {
+		normalize := syncNormalizer(tc.t)
+		assert.Equal(t, normalize(tc.input), normalize(tc.table), tc.t.ColumnType+" "+tc.input)
+	}
+	normalize := syncNormalizer(ColumnType{DataType: "decimal", ColumnType: "decimal(5,2)", Precision: 5, Scale: 2})
+	assert.Assert(t, normalize("1.5") != normalize("1.51"))
+	assert.Equal(t, normalize("n/a"), "n/a")
+	assert.Assert(t, syncNormalizer(ColumnType{DataType: "varchar"}) == nil)
+}
+
+func TestSyncMySQLComparesByType(t *testing.T) {
+	c, err := ParseFlags([]string{"-table", "prices", "-sync-key", "sku"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(syncKeyIndexesQuery).WithArgs("prices").WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAME"}).
+		AddRow("PRIMARY", "sku"))
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, CHARACTER_MAXIMUM_LENGTH, CHARACTER_OCTET_LENGTH, NUMERIC_PRECISION, " +
+		"NUMERIC_SCALE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION").
+		WithArgs("prices").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE", "CHARACTER_MAXIMUM_LENGTH",
+		"CHARACTER_OCTET_LENGTH", "NUMERIC_PRECISION", "NUMERIC_SCALE"}).
+		AddRow("sku", "int", "int", nil, nil, 10, 0).
+		AddRow("price", "decimal", "decimal(8,2)", nil, nil, 8, 2).
+		AddRow("weight", "float", "float", nil, nil, 12, nil).
+		AddRow("valid_from", "datetime", "datetime", nil, nil, nil, nil))
+	mock.ExpectQuery("SELECT `sku`, `price`, `weight`, `valid_from` FROM `prices`").WillReturnRows(
+		sqlmock.NewRows([]string{"sku", "price", "weight", "valid_from"}).
+			AddRow("1", "1.50", "0.1", "2024-01-05 00:00:00").AddRow("2", "2.00", "0.25", "2024-01-05 00:00:00"))
+
+	s, err := c.loadSyncState(context.Background(), db, "prices", []string{"sku", "price", "weight", "valid_from"})
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Assert(t, s.Unchanged([]string{"01", "1.5", "0.10", "2024-01-05"}, 1))
+	assert.Assert(t, !s.Unchanged([]string{"2", "2.01", "0.25", "2024-01-05"}, 2))
+	assert.Equal(t, s.Skipped(), int64(1))
+}
@@ -0,0 +1,132 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// identifierPattern are the unquoted MySQL identifiers a resolved table name may be
+var identifierPattern = regexp.MustCompile(`^[A-Za-z0-9_$]{1,64}$`)
+
+// TableRotation resolves the target table of every input from a template like domain_{{date}} and creates
+// missing tables with the structure of the base table. A nil *TableRotation keeps the default table.
+type TableRotation struct {
+	db       *sql.DB
+	template string
+	base     string
+	date     string
+	created  map[string]bool
+	current  string
+}
+
+// NewTableRotation resolves template for every input, {{date}} is the date of now
+func NewTableRotation(db *sql.DB, template string, base string, now time.Time) *TableRotation {
+	return &TableRotation{db: db, template: template, base: base, date: now.Format("20060102"), created: map[string]bool{}}
+}
+
+// ResolveTableName fills in the {{date}} and {{filebasename}} (the name of the input without directory and
+// extension) placeholders of template and checks that the result is a legal identifier
+func ResolveTableName(template string, filename string, date string) (string, error) {
+	base := filepath.Base(filename)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	table := strings.NewReplacer("{{date}}", date, "{{filebasename}}", base).Replace(template)
+	if !identifierPattern.MatchString(table) || strings.Trim(table, "0123456789") == "" {
+		return "", fmt.Errorf("table name '%s' resolved from '%s' for %s is no legal identifier", table, template, filename)
+	}
+	return table, nil
+}
+
+// StartInput resolves the table for input name and creates it (like the base table) when it is used for the
+// first time
+func (r *TableRotation) StartInput(ctx context.Context, name string) error {
+	if r == nil {
+		return nil
+	}
+	table, err := ResolveTableName(r.template, name, r.date)
+	if err != nil {
+		return err
+	}
+	if !r.created[table] {
+		if _, err = r.db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE %s", table, r.base)); err != nil {
+			return fmt.Errorf("creating table %s failed: %w", table, err)
+		}
+		r.created[table] = true
+	}
+	log.Printf("Importing %s into table %s", name, table)
+	r.current = table
+	return nil
+}
+
+// Current returns the table of the current input, empty for the default table
+func (r *TableRotation) Current() string {
+	if r == nil {
+		return ""
+	}
+	return r.current
+}
+
+// batchQueries provides the statements for all batch sizes per target table, it is shared by all workers
+type batchQueries struct {
+	mu      sync.Mutex
+	headers []string
+	// rows is the size of a full batch
+	rows int
+	// suffix is appended to every statement (ON DUPLICATE KEY UPDATE)
+	suffix string
+	tables map[string][]string
+	// config and router are the settings and the routes of the run the statements are built for
+	config *Config
+	router *Router
+}
+
+// newBatchQueries prepares the statements of the default table, which is used for jobs without a table
+func (l *Loader) newBatchQueries(table string, headers []string) *batchQueries {
+	c := &l.config
+	query, placeholders := c.buildInsertQuery(table, headers)
+	rows := c.maxBatchRows(len(headers))
+	suffix := c.onDuplicateClause(c.OnDuplicate, headers, c.UpdateColumns)
+	return &batchQueries{
+		config:  c,
+		router:  l.router,
+		headers: headers,
+		rows:    rows,
+		suffix:  suffix,
+		tables:  map[string][]string{"": buildBatchQueries(c.dialect(), query, placeholders, suffix, rows)},
+	}
+}
+
+// For returns the statements of table, indexed by batch size - 1
+func (q *batchQueries) For(table string) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queries, ok := q.tables[table]
+	if !ok {
+		headers, suffix := q.headers, q.suffix
+		// a route inserts some of the columns only
+		if columns := q.router.Columns(table, q.headers); columns != nil {
+			update := slices.DeleteFunc(slices.Clone(q.config.UpdateColumns), func(c string) bool { return !slices.Contains(columns, c) })
+			headers, suffix = columns, q.config.onDuplicateClause(q.config.OnDuplicate, columns, update)
+		}
+		query, placeholders := q.config.buildInsertQuery(table, headers)
+		queries = buildBatchQueries(q.config.dialect(), query, placeholders, suffix, q.rows)
+		q.tables[table] = queries
+	}
+	return queries
+}
+
+// Columns returns the inserted columns of table
+func (q *batchQueries) Columns(table string) []string {
+	if columns := q.router.Columns(table, q.headers); columns != nil {
+		return columns
+	}
+	return q.headers
+}
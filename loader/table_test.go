@@ -0,0 +1,67 @@
+package loader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestResolveTableName(t *testing.T) {
+	table, err := ResolveTableName("domain_{{date}}", "data/majestic.csv", "20240115")
+	assert.NilError(t, err)
+	assert.Equal(t, table, "domain_20240115")
+
+	table, err = ResolveTableName("{{filebasename}}", "/data/domain_20240115.csv", "20240116")
+	assert.NilError(t, err)
+	assert.Equal(t, table, "domain_20240115")
+}
+
+func TestResolveTableNameIllegal(t *testing.T) {
+	_, err := ResolveTableName("{{filebasename}}", "domain-2024-01-15.csv", "20240115")
+	assert.ErrorContains(t, err, "table name 'domain-2024-01-15' resolved from '{{filebasename}}' for domain-2024-01-15.csv is no legal identifier")
+
+	_, err = ResolveTableName("{{date}}", "a.csv", "20240115")
+	assert.ErrorContains(t, err, "no legal identifier")
+
+	_, err = ResolveTableName("domain; DROP TABLE domain", "a.csv", "20240115")
+	assert.ErrorContains(t, err, "no legal identifier")
+}
+
+func TestTableRotationCreatesTablesOnce(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS domain_a LIKE domain").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS domain_b LIKE domain").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	r := NewTableRotation(db, "domain_{{filebasename}}", "domain", time.Now())
+	for _, name := range []string{"a.csv", "b.csv", "sub/a.csv"} {
+		assert.NilError(t, r.StartInput(context.Background(), name))
+	}
+	assert.Equal(t, r.Current(), "domain_a")
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkerSplitsBatchesByTable(t *testing.T) {
+	l := newTestLoader()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO `domain_a` (`Domain`) VALUES (?), (?)").WithArgs("a", "b").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO `domain_b` (`Domain`) VALUES (?)").WithArgs("c").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	jobs := make(chan Job, 10)
+	jobs <- Job{Row: 1, Values: []string{"a"}, Table: "domain_a"}
+	jobs <- Job{Row: 2, Values: []string{"b"}, Table: "domain_a"}
+	jobs <- Job{Row: 3, Values: []string{"c"}, Table: "domain_b"}
+	close(jobs)
+
+	// the worker only exits once the job for domain_b is executed as well
+	assert.NilError(t, l.worker(context.Background(), 0, db, jobs, l.newBatchQueries("domain", []string{"Domain"}), nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
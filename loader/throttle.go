@@ -0,0 +1,73 @@
+package loader
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Throttle limits the number of batches executed at the same time with additive-increase/multiplicative-decrease:
+// every failed batch multiplies the limit by decrease, every successful one raises it by increase / limit, so
+// it grows by about increase per round of batches. A server under stress gets less load instead of more retries.
+// A nil *Throttle doesn't limit anything.
+type Throttle struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    float64
+	max      float64
+	increase float64
+	decrease float64
+	active   int
+}
+
+// NewThrottle starts with the limit max (no throttling)
+func NewThrottle(max int, increase float64, decrease float64) *Throttle {
+	t := &Throttle{limit: float64(max), max: float64(max), increase: increase, decrease: decrease}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// Acquire waits until a batch may be executed
+func (t *Throttle) Acquire() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.active >= int(t.limit) {
+		t.cond.Wait()
+	}
+	t.active++
+}
+
+// Release records the outcome of a batch started with Acquire and adapts the limit
+func (t *Throttle) Release(err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	before := int(t.limit)
+	if err != nil {
+		t.limit = max(1, t.limit*t.decrease)
+	} else {
+		t.limit = min(t.max, t.limit+t.increase/t.limit)
+	}
+	if after := int(t.limit); after < before {
+		log.Warnf("Batch failed, throttling to %d concurrent batches", after)
+	} else if after > before {
+		log.Debugf("Throttle raised to %d concurrent batches", after)
+	}
+	t.cond.Broadcast()
+}
+
+// Limit returns the number of batches which may be executed at the same time
+func (t *Throttle) Limit() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return int(t.limit)
+}
@@ -0,0 +1,68 @@
+package loader
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+var errBatch = errors.New("Error 1205: Lock wait timeout exceeded")
+
+func TestThrottleAIMD(t *testing.T) {
+	th := NewThrottle(100, 1, 0.5)
+	assert.Equal(t, th.Limit(), 100)
+
+	for _, want := range []int{50, 25, 12} {
+		th.Acquire()
+		th.Release(errBatch)
+		assert.Equal(t, th.Limit(), want)
+	}
+	// a round of 12 successful batches raises the limit by one
+	for i := 0; i < 13; i++ {
+		th.Acquire()
+		th.Release(nil)
+	}
+	assert.Equal(t, th.Limit(), 13)
+}
+
+func TestThrottleBounds(t *testing.T) {
+	th := NewThrottle(4, 1, 0.1)
+	th.Acquire()
+	th.Release(errBatch)
+	assert.Equal(t, th.Limit(), 1, "at least one batch")
+	for i := 0; i < 100; i++ {
+		th.Acquire()
+		th.Release(nil)
+	}
+	assert.Equal(t, th.Limit(), 4, "never more than the workers")
+}
+
+func TestThrottleBlocks(t *testing.T) {
+	th := NewThrottle(2, 1, 0.5)
+	th.Acquire()
+	th.Acquire()
+	th.Release(errBatch)
+	// the limit is down to 1 with one batch still running
+
+	acquired := make(chan bool)
+	go func() {
+		th.Acquire()
+		acquired <- true
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired above the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	th.Release(nil)
+	<-acquired
+}
+
+func TestThrottleNil(t *testing.T) {
+	var th *Throttle
+	th.Acquire()
+	th.Release(errBatch)
+	assert.Equal(t, th.Limit(), 0)
+}
@@ -0,0 +1,63 @@
+package loader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// tlsConfigName is the name the TLS config built from the certificate settings is registered with at the driver
+const tlsConfigName = "go-mysql-worker"
+
+// tlsModes are the tls DSN parameters of the driver accepted by DB_TLS without certificates
+var tlsModes = []string{"true", "false", "skip-verify", "preferred"}
+
+// registerTLS checks the TLS settings. With a CA or a client certificate a TLS config verifying the server
+// against the CA (and presenting the client certificate) is registered at the driver and selected by TLS. With
+// DB_TLS=skip-verify the client certificate is presented without verifying the server.
+func (s *DBSettings) registerTLS() error {
+	if s.TLSCA == "" && s.TLSCert == "" && s.TLSKey == "" {
+		if s.TLS != "" && !slices.Contains(tlsModes, s.TLS) {
+			return fmt.Errorf("invalid DB_TLS '%s', allowed are: %s", s.TLS, strings.Join(tlsModes, ", "))
+		}
+		return nil
+	}
+	if s.TLS != "" && s.TLS != "true" && s.TLS != "skip-verify" {
+		return fmt.Errorf("DB_TLS=%s can't be combined with the TLS certificates", s.TLS)
+	}
+	if s.TLS == "skip-verify" && s.TLSCA != "" {
+		return fmt.Errorf("DB_TLS=skip-verify can't be combined with DB_TLS_CA, the server is verified against the CA")
+	}
+	if (s.TLSCert == "") != (s.TLSKey == "") {
+		return fmt.Errorf("DB_TLS_CERT and DB_TLS_KEY have to be given together")
+	}
+	// skip-verify only presents the client certificate, e.g. to a server with a certificate of its own CA
+	c := &tls.Config{ServerName: s.Host, MinVersion: tls.VersionTLS12, InsecureSkipVerify: s.TLS == "skip-verify"}
+	if s.TLSCA != "" {
+		pem, err := os.ReadFile(expandHome(s.TLSCA))
+		if err != nil {
+			return fmt.Errorf("error reading TLS CA: %w", err)
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in TLS CA %s", s.TLSCA)
+		}
+	}
+	if s.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(expandHome(s.TLSCert), expandHome(s.TLSKey))
+		if err != nil {
+			return fmt.Errorf("error reading TLS client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	if err := mysql.RegisterTLSConfig(tlsConfigName, c); err != nil {
+		return err
+	}
+	s.TLS = tlsConfigName
+	return nil
+}
@@ -0,0 +1,94 @@
+package loader
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// writeTestCert writes a self-signed certificate and its key as PEM files and returns their names
+func writeTestCert(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NilError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NilError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NilError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestRegisterTLSWithCA(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	s := DBSettings{User: "import", Password: "s3cret", Host: "db.example.com", Port: "3306", Database: "ranks",
+		Params: "charset=utf8mb4", TLSCA: certFile}
+	assert.NilError(t, s.registerTLS())
+	dsn, printable := s.DSN()
+	assert.Equal(t, dsn, "import:s3cret@tcp(db.example.com:3306)/ranks?tls=go-mysql-worker&charset=utf8mb4")
+	assert.Equal(t, printable, "import:***@tcp(db.example.com:3306)/ranks?tls=go-mysql-worker&charset=utf8mb4")
+
+	// the self-signed certificate doubles as client certificate
+	s = DBSettings{Host: "db.example.com", TLSCA: certFile, TLSCert: certFile, TLSKey: keyFile}
+	assert.NilError(t, s.registerTLS())
+	assert.Equal(t, s.TLS, tlsConfigName)
+}
+
+func TestRegisterTLSModes(t *testing.T) {
+	s := DBSettings{Host: "localhost", Port: "3306", TLS: "skip-verify"}
+	assert.NilError(t, s.registerTLS())
+	_, printable := s.DSN()
+	assert.Equal(t, printable, ":***@tcp(localhost:3306)/?tls=skip-verify")
+
+	s = DBSettings{TLS: "always"}
+	assert.ErrorContains(t, s.registerTLS(), "invalid DB_TLS 'always', allowed are: true, false, skip-verify, preferred")
+
+	certFile, _ := writeTestCert(t)
+	s = DBSettings{TLS: "skip-verify", TLSCA: certFile}
+	assert.ErrorContains(t, s.registerTLS(), "DB_TLS=skip-verify can't be combined with DB_TLS_CA")
+	s = DBSettings{TLS: "preferred", TLSCA: certFile}
+	assert.ErrorContains(t, s.registerTLS(), "DB_TLS=preferred can't be combined with the TLS certificates")
+	s = DBSettings{TLSCert: certFile}
+	assert.ErrorContains(t, s.registerTLS(), "DB_TLS_CERT and DB_TLS_KEY have to be given together")
+	s = DBSettings{TLSCA: filepath.Join(t.TempDir(), "missing.pem")}
+	assert.ErrorIs(t, s.registerTLS(), os.ErrNotExist)
+}
+
+func TestRegisterTLSSkipVerifyClientCert(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	s := DBSettings{Host: "db.example.com", TLS: "skip-verify", TLSCert: certFile, TLSKey: keyFile}
+	assert.NilError(t, s.registerTLS())
+	assert.Equal(t, s.TLS, tlsConfigName)
+}
+
+func TestLoadDBSettingsTLS(t *testing.T) {
+	t.Setenv("DB_TLS", "true")
+	t.Setenv("DB_TLS_CA", "/etc/ssl/ca.pem")
+	t.Setenv("DB_TLS_CERT", "")
+	t.Setenv("DB_TLS_KEY", "")
+	s, err := LoadDBSettings("")
+	assert.NilError(t, err)
+	assert.Equal(t, s.TLS, "true")
+	assert.Equal(t, s.TLSCA, "/etc/ssl/ca.pem")
+}
@@ -0,0 +1,256 @@
+package loader
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Transformer converts the CSV value of a column into the value bound to the statement, a row with a value which
+// can't be converted isn't inserted
+type Transformer func(value string) (any, error)
+
+// transformers are the transformers -transform selects by name
+var transformers = map[string]Transformer{
+	"trim":     trimValue,
+	"int":      intValue,
+	"float":    floatValue,
+	"lower":    lowerValue,
+	"upper":    upperValue,
+	"date_mdy": dateValue("1/2/2006"),
+	"date_dmy": dateValue("2/1/2006"),
+	"currency": currencyValue,
+	// the binary decoders bind the bytes of a BLOB or VARBINARY column
+	"base64":    base64Value,
+	"base64url": base64URLValue,
+	"hex":       hexValue,
+	// json checks the values of a JSON column, wkt the geometries of a spatial column (see geometryExpr)
+	"json": jsonValue,
+	"wkt":  wktValue,
+}
+
+// binaryDecoders are the transformers returning the bytes of a binary column, -coerce checks their decoded size
+var binaryDecoders = []string{"base64", "base64url", "hex"}
+
+// transformerSeparator separates the transformers of a pipeline, e.g. trim|lower
+const transformerSeparator = "|"
+
+// lastTransformer returns the name of the last transformer of the pipeline spec
+func lastTransformer(spec string) string {
+	names := strings.Split(spec, transformerSeparator)
+	return strings.TrimSpace(names[len(names)-1])
+}
+
+// pipeline returns the transformer running the transformers named by spec (e.g. trim|lower) one after another,
+// a value converted from a string is passed on as text
+func pipeline(spec string) (Transformer, error) {
+	var fns []Transformer
+	for _, name := range strings.Split(spec, transformerSeparator) {
+		fn, ok := transformers[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown transformer '%s', must be one of %s", strings.TrimSpace(name), strings.Join(transformerNames(), ", "))
+		}
+		fns = append(fns, fn)
+	}
+	if len(fns) == 1 {
+		return fns[0], nil
+	}
+	return func(value string) (any, error) {
+		var v any = value
+		for _, fn := range fns {
+			s, ok := v.(string)
+			if !ok {
+				s = fmt.Sprint(v)
+			}
+			var err error
+			if v, err = fn(s); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	}, nil
+}
+
+// RegisterTransformer makes fn available to -transform as name, it has to be called before the flags are parsed
+func RegisterTransformer(name string, fn Transformer) {
+	transformers[name] = fn
+}
+
+// transformerNames returns the names of all transformers, sorted
+func transformerNames() []string {
+	names := make([]string, 0, len(transformers))
+	for name := range transformers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// trimValue removes leading and trailing white space
+func trimValue(value string) (any, error) {
+	return strings.TrimSpace(value), nil
+}
+
+// intValue parses an integer, surrounding white space is ignored
+func intValue(value string) (any, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is no integer", value)
+	}
+	return n, nil
+}
+
+// lowerValue converts to lower case, e.g. for domains
+func lowerValue(value string) (any, error) {
+	return strings.ToLower(value), nil
+}
+
+// upperValue converts to upper case
+func upperValue(value string) (any, error) {
+	return strings.ToUpper(value), nil
+}
+
+// dateValue returns a transformer parsing a date of layout (with / or . or - separating the parts) into the
+// YYYY-MM-DD of a DATE column
+func dateValue(layout string) Transformer {
+	separators := strings.NewReplacer(".", "/", "-", "/")
+	return func(value string) (any, error) {
+		d, err := time.Parse(layout, separators.Replace(strings.TrimSpace(value)))
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is no date like %s", value, strings.NewReplacer("2006", "yyyy", "1", "m", "2", "d").Replace(layout))
+		}
+		return d.Format(time.DateOnly), nil
+	}
+}
+
+// currencyValue removes currency symbols, white space and the thousands separators (,) of an amount like
+// $1,234.50 and returns the number as text, so it fits a DECIMAL column
+func currencyValue(value string) (any, error) {
+	amount := strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Sc, r) || unicode.IsSpace(r) || r == ',' {
+			return -1
+		}
+		return r
+	}, value)
+	if _, err := strconv.ParseFloat(amount, 64); err != nil || strings.Trim(amount, "0123456789+-.") != "" {
+		return nil, fmt.Errorf("'%s' is no amount", value)
+	}
+	return amount, nil
+}
+
+// floatValue parses a floating point number, surrounding white space is ignored
+func floatValue(value string) (any, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is no number", value)
+	}
+	return f, nil
+}
+
+// base64Value decodes standard base64 with or without padding, the line breaks of MIME base64 are ignored
+func base64Value(value string) (any, error) {
+	return decodeBase64(base64.StdEncoding, value)
+}
+
+// base64URLValue decodes the URL and file name safe base64 with - and _, with or without padding
+func base64URLValue(value string) (any, error) {
+	return decodeBase64(base64.URLEncoding, value)
+}
+
+func decodeBase64(enc *base64.Encoding, value string) (any, error) {
+	value = strings.Join(strings.Fields(value), "")
+	if len(value)%4 != 0 {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+	b, err := enc.DecodeString(value)
+	if err != nil {
+		// the value may be large, the error has the offset
+		return nil, fmt.Errorf("no base64: %w", err)
+	}
+	return b, nil
+}
+
+// hexValue decodes hex digits, optionally prefixed with 0x or \x like the literals of MySQL and PostgreSQL
+func hexValue(value string) (any, error) {
+	value = strings.TrimSpace(value)
+	for _, prefix := range []string{"0x", "0X", `\x`} {
+		value = strings.TrimPrefix(value, prefix)
+	}
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("no hex: %w", err)
+	}
+	return b, nil
+}
+
+// jsonValue checks that the value is a JSON document, the database would fail the whole batch otherwise
+func jsonValue(value string) (any, error) {
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return nil, fmt.Errorf("invalid JSON at offset %d: %w", syntax.Offset, err)
+		}
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return value, nil
+}
+
+// columnTransform is a -transform resolved against the CSV headers
+type columnTransform struct {
+	index  int
+	column string
+	fn     Transformer
+	// binary is set when the pipeline ends with one of the binaryDecoders
+	binary bool
+}
+
+// binaryDecoder returns the transformer of the CSV column index when it decodes binary values, nil otherwise
+func (c *Config) binaryDecoder(index int) Transformer {
+	for _, t := range c.transforms {
+		if t.index == index && t.binary {
+			return t.fn
+		}
+	}
+	return nil
+}
+
+// applyTransforms converts the values of a row read with the transformers of their columns and returns the first
+// error, so a row which can't be inserted never reaches a batch. A value converted to a string replaces the CSV
+// value, the other values are converted again by bindArgs. The RowTransform and the RowProcessor of the config run
+// last, followed by the -coerce conversions.
+func (c *Config) applyTransforms(row []string) error {
+	for _, t := range c.transforms {
+		if t.index >= len(row) || c.headerNull(t.index, row[t.index]) {
+			continue
+		}
+		v, err := t.fn(row[t.index])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", t.column, err)
+		}
+		if s, ok := v.(string); ok {
+			row[t.index] = s
+		}
+	}
+	if c.RowTransform != nil {
+		transformed, err := c.RowTransform(row)
+		if err != nil {
+			return err
+		}
+		if len(transformed) != len(row) {
+			return fmt.Errorf("the row transform returned %d fields instead of %d", len(transformed), len(row))
+		}
+		copy(row, transformed)
+	}
+	if err := c.processRow(row); err != nil {
+		return err
+	}
+	return c.applyCoercions(row)
+}
@@ -0,0 +1,259 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestTransformers(t *testing.T) {
+	v, err := trimValue("  google.com ")
+	assert.NilError(t, err)
+	assert.Equal(t, v, "google.com")
+
+	v, err = intValue(" 42")
+	assert.NilError(t, err)
+	assert.Equal(t, v, int64(42))
+	v, err = floatValue("1.5")
+	assert.NilError(t, err)
+	assert.Equal(t, v, 1.5)
+
+	_, err = intValue("abc")
+	assert.ErrorContains(t, err, "'abc' is no integer")
+	_, err = intValue("1.5")
+	assert.ErrorContains(t, err, "'1.5' is no integer")
+	_, err = floatValue("n/a")
+	assert.ErrorContains(t, err, "'n/a' is no number")
+
+	_, err = ParseFlags([]string{"-transform", "GlobalRank=date"})
+	assert.ErrorContains(t, err, "invalid -transform of column GlobalRank: unknown transformer 'date', must be one of base64, base64url, currency, date_dmy, date_mdy, float, hex, int, json, lower, trim, upper, wkt")
+	_, err = ParseFlags([]string{"-transform", "Domain=trim|title"})
+	assert.ErrorContains(t, err, "unknown transformer 'title'")
+}
+
+func TestTextTransformers(t *testing.T) {
+	for _, tc := range []struct {
+		name, value, want string
+	}{
+		{"lower", "WWW.Google.COM", "www.google.com"},
+		{"upper", "de", "DE"},
+		{"date_mdy", "1/2/2023", "2023-01-02"},
+		{"date_mdy", "12/31/1999", "1999-12-31"},
+		{"date_dmy", "2/1/2023", "2023-01-02"},
+		{"date_dmy", "31.12.1999", "1999-12-31"},
+		{"currency", "$1,234.50", "1234.50"},
+		{"currency", "€ 12", "12"},
+		{"currency", "-£3.5", "-3.5"},
+		{"json", `{"tags": ["a", "b"]}`, `{"tags": ["a", "b"]}`},
+		{"json", "42", "42"},
+	} {
+		v, err := transformers[tc.name](tc.value)
+		assert.NilError(t, err, tc.name)
+		assert.Equal(t, v, tc.want, tc.name)
+	}
+
+	_, err := transformers["date_mdy"]("31/12/1999")
+	assert.ErrorContains(t, err, "'31/12/1999' is no date like m/d/yyyy")
+	_, err = transformers["date_dmy"]("2023-01-02x")
+	assert.ErrorContains(t, err, "is no date like d/m/yyyy")
+	_, err = transformers["currency"]("12 USD")
+	assert.ErrorContains(t, err, "'12 USD' is no amount")
+	_, err = transformers["json"](`{"a": }`)
+	assert.ErrorContains(t, err, "invalid JSON at offset 7: invalid character '}' looking for beginning of value")
+	_, err = transformers["json"]("")
+	assert.ErrorContains(t, err, "invalid JSON")
+	_, err = transformers["currency"]("0x1p3")
+	assert.ErrorContains(t, err, "is no amount")
+}
+
+func TestBinaryDecoders(t *testing.T) {
+	for _, tc := range []struct {
+		name, value string
+		want        []byte
+	}{
+		{"base64", "AAEC/w==", []byte{0, 1, 2, 255}},
+		{"base64", "AAEC/w", []byte{0, 1, 2, 255}},
+		{"base64", "AAEC\r\n/w==", []byte{0, 1, 2, 255}},
+		{"base64url", "AAEC_w", []byte{0, 1, 2, 255}},
+		{"hex", "000102ff", []byte{0, 1, 2, 255}},
+		{"hex", "0x000102FF", []byte{0, 1, 2, 255}},
+		{"hex", `\x000102ff`, []byte{0, 1, 2, 255}},
+		{"hex", "", []byte{}},
+	} {
+		v, err := transformers[tc.name](tc.value)
+		assert.NilError(t, err, tc.name)
+		assert.DeepEqual(t, v, tc.want)
+	}
+	_, err := transformers["base64"]("AAE*")
+	assert.ErrorContains(t, err, "no base64: illegal base64 data at input byte 3")
+	_, err = transformers["base64"]("AAEC_w")
+	assert.ErrorContains(t, err, "no base64")
+	_, err = transformers["hex"]("0x0g")
+	assert.ErrorContains(t, err, "no hex: encoding/hex: invalid byte")
+}
+
+func TestTransformPipeline(t *testing.T) {
+	fn, err := pipeline("trim|lower")
+	assert.NilError(t, err)
+	v, err := fn("  Google.COM ")
+	assert.NilError(t, err)
+	assert.Equal(t, v, "google.com")
+
+	// a number converted in between is passed on as text
+	fn, err = pipeline("currency|float")
+	assert.NilError(t, err)
+	v, err = fn("$1,000.5")
+	assert.NilError(t, err)
+	assert.Equal(t, v, 1000.5)
+
+	fn, err = pipeline("trim|int")
+	assert.NilError(t, err)
+	_, err = fn(" n/a ")
+	assert.ErrorContains(t, err, "'n/a' is no integer")
+}
+
+func TestRegisterTransformer(t *testing.T) {
+	defer delete(transformers, "reverse")
+	RegisterTransformer("reverse", func(value string) (any, error) {
+		r := []rune(value)
+		slices.Reverse(r)
+		return string(r), nil
+	})
+	c, err := ParseFlags([]string{"-transform", "TLD=trim|reverse"})
+	assert.NilError(t, err)
+	assert.NilError(t, c.ResolveColumns([]string{"Domain", "TLD"}))
+	assert.Equal(t, len(c.transforms), 1)
+}
+
+func TestProcessCSVFileTransformError(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	filename := filepath.Join(t.TempDir(), "dead.csv")
+	l.config, err = ParseFlags([]string{"-transform", "Domain=trim", "-transform", "GlobalRank=int", "-dead-letter-file", filename})
+	assert.NilError(t, err)
+	headers := []string{"Domain", "GlobalRank"}
+	assert.NilError(t, l.config.ResolveColumns(headers))
+	l.deadLetter, err = OpenDeadLetter(filename, headers, l.config.Delimiter)
+	assert.NilError(t, err)
+
+	reader := l.config.newCSVReader(strings.NewReader(" a.com ,1\nb.com,n/a\nc.com, 3\n"))
+	jobs := make(chan Job, 10)
+	l.headers = headers
+	rows, _, _ := l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	// the trimmed value replaces the CSV value, the row which isn't numeric goes to the dead letters
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"a.com", "1"}, {"c.com", " 3"}})
+	assert.Equal(t, rows, 3)
+	assert.NilError(t, l.deadLetter.Close())
+	content, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "Domain,GlobalRank,row,error\nb.com,n/a,2,column GlobalRank: 'n/a' is no integer\n")
+}
+
+func TestProcessCSVFileDeadLetterWriteError(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	filename := filepath.Join(t.TempDir(), "dead.csv")
+	l.config, err = ParseFlags([]string{"-transform", "GlobalRank=int", "-dead-letter-file", filename})
+	assert.NilError(t, err)
+	headers := []string{"Domain", "GlobalRank"}
+	assert.NilError(t, l.config.ResolveColumns(headers))
+	l.deadLetter, err = OpenDeadLetter(filename, headers, l.config.Delimiter)
+	assert.NilError(t, err)
+	assert.NilError(t, l.deadLetter.Close())
+
+	reader := l.config.newCSVReader(strings.NewReader("a.com,1\nb.com,n/a\nc.com,3\n"))
+	jobs := make(chan Job, 10)
+	l.headers = headers
+	rows, _, err := l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	// the reader stops at the row it can't write to the dead letters, the import fails instead of the process
+	assert.ErrorContains(t, err, "closed")
+	assert.Equal(t, rows, 1)
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"a.com", "1"}})
+}
+
+func TestProcessCSVFileTransformErrorBudget(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-transform", "GlobalRank=int"})
+	assert.NilError(t, err)
+	headers := []string{"Domain", "GlobalRank"}
+	assert.NilError(t, l.config.ResolveColumns(headers))
+	l.errorBudget = NewErrorBudget(0, 0, 0)
+
+	// without a dead-letter file and budget the row ends the input
+	reader := l.config.newCSVReader(strings.NewReader("a.com,1\nb.com,n/a\nc.com,3\n"))
+	jobs := make(chan Job, 10)
+	l.headers = headers
+	rows, _, _ := l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"a.com", "1"}})
+	assert.Equal(t, rows, 2)
+}
+
+func TestWorkerTransformArgs(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-map", "Domain=name,GlobalRank=rank", "-transform", "GlobalRank=int", "-transform",
+		"Domain=date_mdy"})
+	assert.NilError(t, err)
+	headers := []string{"GlobalRank", "Domain"}
+	assert.NilError(t, l.config.ResolveColumns(headers))
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	// the converted values are bound, at the position of their insert column, the strings the reader converted
+	// already are bound as they are
+	mock.ExpectExec("INSERT INTO `domain` (`name`,`rank`) VALUES (?,?), (?,?)").
+		WithArgs("2023-01-02", int64(1), "2023-01-03", int64(2)).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	jobs := make(chan Job, 10)
+	jobs <- Job{Row: 1, Values: []string{"1", "2023-01-02"}}
+	jobs <- Job{Row: 2, Values: []string{" 2", "2023-01-03"}}
+	close(jobs)
+	assert.NilError(t, l.worker(context.Background(), 0, db, jobs, l.newBatchQueries("domain", l.config.InsertColumns(headers)), nil))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessCSVFileRowTransform(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	filename := filepath.Join(t.TempDir(), "dead.csv")
+	l.config, err = ParseFlags([]string{"-transform", "Domain=trim|lower", "-dead-letter-file", filename})
+	assert.NilError(t, err)
+	l.config.RowTransform = func(row []string) ([]string, error) {
+		if row[1] == "" {
+			return nil, errors.New("no rank")
+		}
+		// the column transforms ran before
+		return []string{strings.TrimPrefix(row[0], "www."), row[1]}, nil
+	}
+	headers := []string{"Domain", "GlobalRank"}
+	assert.NilError(t, l.config.ResolveColumns(headers))
+	l.deadLetter, err = OpenDeadLetter(filename, headers, l.config.Delimiter)
+	assert.NilError(t, err)
+
+	reader := l.config.newCSVReader(strings.NewReader(" WWW.A.com ,1\nb.com,\nc.com,3\n"))
+	jobs := make(chan Job, 10)
+	l.headers = headers
+	rows, _, _ := l.ProcessCSVFile(context.Background(), reader, jobs, 0, 0, 100)
+	close(jobs)
+	assert.DeepEqual(t, readJobs(jobs), [][]string{{"a.com", "1"}, {"c.com", "3"}})
+	assert.Equal(t, rows, 3)
+	assert.NilError(t, l.deadLetter.Close())
+	content, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "Domain,GlobalRank,row,error\nb.com,,2,no rank\n")
+
+	l.config.RowTransform = func(row []string) ([]string, error) { return row[:1], nil }
+	assert.ErrorContains(t, l.config.applyTransforms([]string{"a.com", "1"}), "the row transform returned 1 fields instead of 2")
+}
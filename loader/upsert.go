@@ -0,0 +1,30 @@
+package loader
+
+// handling of rows with an existing key accepted by -on-duplicate
+const (
+	// OnDuplicateError fails the batch
+	OnDuplicateError = "error"
+	// OnDuplicateIgnore keeps the existing row (INSERT IGNORE)
+	OnDuplicateIgnore = "ignore"
+	// OnDuplicateUpdate updates the existing row (ON DUPLICATE KEY UPDATE)
+	OnDuplicateUpdate = "update"
+	// OnDuplicateReplace deletes the existing row and inserts the new one (REPLACE INTO)
+	OnDuplicateReplace = "replace"
+)
+
+var onDuplicateModes = []string{OnDuplicateError, OnDuplicateIgnore, OnDuplicateUpdate, OnDuplicateReplace}
+
+// insertVerb returns the start of the INSERT statement for mode
+func insertVerb(d Dialect, mode string) string {
+	return d.InsertVerb(mode)
+}
+
+// onDuplicateClause returns the clause appended to every batch for mode update (ON DUPLICATE KEY UPDATE with
+// MySQL), which sets the columns to the inserted values (all headers if columns is empty), and for the modes of
+// the dialect without a verb of their own (ON CONFLICT DO NOTHING), empty for the other modes
+func (c *Config) onDuplicateClause(mode string, headers []string, columns []string) string {
+	if len(columns) == 0 {
+		columns = headers
+	}
+	return c.dialect().UpsertClause(mode, c.ConflictColumns, columns)
+}
@@ -0,0 +1,48 @@
+package loader
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestBatchQueriesOnDuplicate(t *testing.T) {
+	l := newTestLoader()
+	headers := []string{"GlobalRank", "Domain", "TLD"}
+
+	l.config.OnDuplicate = OnDuplicateError
+	queries := l.newBatchQueries("domain", headers)
+	assert.Equal(t, queries.For("")[1], "INSERT INTO `domain` (`GlobalRank`,`Domain`,`TLD`) VALUES (?,?,?), (?,?,?)")
+
+	l.config.OnDuplicate = OnDuplicateIgnore
+	queries = l.newBatchQueries("domain", headers)
+	assert.Equal(t, queries.For("")[1], "INSERT IGNORE INTO `domain` (`GlobalRank`,`Domain`,`TLD`) VALUES (?,?,?), (?,?,?)")
+
+	l.config.OnDuplicate = OnDuplicateReplace
+	queries = l.newBatchQueries("domain", headers)
+	assert.Equal(t, queries.For("domain_b")[1], "REPLACE INTO `domain_b` (`GlobalRank`,`Domain`,`TLD`) VALUES (?,?,?), (?,?,?)")
+
+	l.config.OnDuplicate = OnDuplicateUpdate
+	queries = l.newBatchQueries("domain", headers)
+	assert.Equal(t, queries.For("")[0],
+		"INSERT INTO `domain` (`GlobalRank`,`Domain`,`TLD`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `GlobalRank`=VALUES(`GlobalRank`),`Domain`=VALUES(`Domain`),`TLD`=VALUES(`TLD`)")
+	assert.Equal(t, queries.For("domain_b")[1],
+		"INSERT INTO `domain_b` (`GlobalRank`,`Domain`,`TLD`) VALUES (?,?,?), (?,?,?) ON DUPLICATE KEY UPDATE `GlobalRank`=VALUES(`GlobalRank`),`Domain`=VALUES(`Domain`),`TLD`=VALUES(`TLD`)")
+
+	l.config.UpdateColumns = []string{"GlobalRank"}
+	queries = l.newBatchQueries("domain", []string{"Domain", "GlobalRank"})
+	assert.Equal(t, queries.For("")[2],
+		"INSERT INTO `domain` (`Domain`,`GlobalRank`) VALUES (?,?), (?,?), (?,?) ON DUPLICATE KEY UPDATE `GlobalRank`=VALUES(`GlobalRank`)")
+}
+
+func TestParseFlagsOnDuplicate(t *testing.T) {
+	c, err := ParseFlags([]string{"-on-duplicate", "update", "-update-columns", "GlobalRank,TldRank"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c.UpdateColumns, []string{"GlobalRank", "TldRank"})
+	assert.ErrorContains(t, c.ResolveColumns([]string{"GlobalRank", "Domain"}), "unknown column 'TldRank'")
+
+	_, err = ParseFlags([]string{"-on-duplicate", "overwrite"})
+	assert.ErrorContains(t, err, "invalid on-duplicate 'overwrite', allowed are: error, ignore, update, replace")
+	_, err = ParseFlags([]string{"-on-duplicate", "ignore", "-update-columns", "GlobalRank"})
+	assert.ErrorContains(t, err, "-update-columns requires -on-duplicate=update")
+}
@@ -0,0 +1,136 @@
+package loader
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ColumnRules are the constraints a value of a CSV column has to meet before its row is inserted, set with
+// "validate" by a column of the -map-file. A row breaking a rule is written to the -rejects-file (and the
+// -dead-letter-file) instead of failing its batch. The rules but Required don't apply to NULL values.
+type ColumnRules struct {
+	// Required rejects empty and NULL values
+	Required bool `json:"required,omitempty"`
+	// MaxLength is the maximum number of characters, e.g. of a VARCHAR column
+	MaxLength int `json:"max_length,omitempty"`
+	// Pattern is a regular expression the whole value has to match
+	Pattern string `json:"pattern,omitempty"`
+	// Min and Max are the range of a numeric value
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// Enum are the values allowed
+	Enum []string `json:"enum,omitempty"`
+}
+
+// columnValidation are the rules of the CSV column index
+type columnValidation struct {
+	index   int
+	column  string
+	rules   *ColumnRules
+	pattern *regexp.Regexp
+}
+
+// compile checks the rules and returns the compiled Pattern, nil without one
+func (r *ColumnRules) compile() (*regexp.Regexp, error) {
+	if r.MaxLength < 0 {
+		return nil, fmt.Errorf("invalid max_length %d, must not be negative", r.MaxLength)
+	}
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return nil, fmt.Errorf("min %g is greater than max %g", *r.Min, *r.Max)
+	}
+	if r.Pattern == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile("^(?:" + r.Pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	return pattern, nil
+}
+
+// checkRules checks the validation rules of the -map-file columns
+func (c *Config) checkRules() error {
+	for _, m := range c.ColumnMap {
+		if m.Validate == nil {
+			continue
+		}
+		if _, err := m.Validate.compile(); err != nil {
+			return fmt.Errorf("invalid validation of column %s: %w", m.Header, err)
+		}
+	}
+	return nil
+}
+
+// resolveValidations sets the validations of the CSV columns in the order of the row
+func (c *Config) resolveValidations(headers []string) error {
+	c.validations = nil
+	for _, m := range c.ColumnMap {
+		if m.Validate == nil {
+			continue
+		}
+		index, err := columnIndex(headers, m.Header)
+		if err != nil {
+			return err
+		}
+		pattern, err := m.Validate.compile()
+		if err != nil {
+			return fmt.Errorf("invalid validation of column %s: %w", m.Header, err)
+		}
+		c.validations = append(c.validations, columnValidation{index: index, column: m.Header, rules: m.Validate, pattern: pattern})
+	}
+	slices.SortStableFunc(c.validations, func(a, b columnValidation) int { return a.index - b.index })
+	return nil
+}
+
+// validateRow returns the error of the first value of row breaking a rule of its column
+func (c *Config) validateRow(row []string) error {
+	for _, v := range c.validations {
+		if v.index >= len(row) {
+			continue
+		}
+		if err := v.check(row[v.index], c.headerNull(v.index, row[v.index])); err != nil {
+			return fmt.Errorf("column %s: %w", v.column, err)
+		}
+	}
+	return nil
+}
+
+// check checks value against the rules of the column, null is whether it's a NULL of the column
+func (v columnValidation) check(value string, null bool) error {
+	r := v.rules
+	if null {
+		if r.Required {
+			return fmt.Errorf("value required")
+		}
+		return nil
+	}
+	if r.Required && value == "" {
+		return fmt.Errorf("value required")
+	}
+	if r.MaxLength > 0 && utf8.RuneCountInString(value) > r.MaxLength {
+		return fmt.Errorf("'%s' is longer than %d characters", value, r.MaxLength)
+	}
+	if v.pattern != nil && !v.pattern.MatchString(value) {
+		return fmt.Errorf("'%s' doesn't match %s", value, r.Pattern)
+	}
+	if r.Min != nil || r.Max != nil {
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("'%s' is no number", value)
+		}
+		if r.Min != nil && n < *r.Min {
+			return fmt.Errorf("%s is less than %g", value, *r.Min)
+		}
+		if r.Max != nil && n > *r.Max {
+			return fmt.Errorf("%s is greater than %g", value, *r.Max)
+		}
+	}
+	if r.Enum != nil && !slices.Contains(r.Enum, value) {
+		return fmt.Errorf("'%s' is not one of %s", value, strings.Join(r.Enum, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const validationMapFile = `{
+	"columns": [
+		{"header": "GlobalRank", "column": "rank", "validate": {"required": true, "min": 1, "max": 1000000}},
+		{"header": "Domain", "column": "name", "validate": {"required": true, "max_length": 12, "pattern": "[a-z0-9.-]+"}},
+		{"header": "TLD", "validate": {"enum": ["com", "org"]}}
+	]
+}`
+
+func TestValidateRow(t *testing.T) {
+	l := newTestLoader()
+	filename := filepath.Join(t.TempDir(), "columns.json")
+	assert.NilError(t, os.WriteFile(filename, []byte(validationMapFile), 0o644))
+	var err error
+	l.config, err = ParseFlags([]string{"-map-file", filename, "-empty-as-null"})
+	assert.NilError(t, err)
+	assert.NilError(t, l.config.ResolveColumns([]string{"Domain", "GlobalRank", "TLD"}))
+
+	assert.NilError(t, l.config.validateRow([]string{"google.com", "1", "com"}))
+	// the rules but required skip NULL values
+	assert.NilError(t, l.config.validateRow([]string{"google.com", "1", ""}))
+	for row, want := range map[[3]string]string{
+		{"", "1", "com"}:                 "column Domain: value required",
+		{"Google.com", "1", "com"}:       "column Domain: 'Google.com' doesn't match [a-z0-9.-]+",
+		{"wikipedia.org", "1", "org"}:    "column Domain: 'wikipedia.org' is longer than 12 characters",
+		{"google.com", "0", "com"}:       "column GlobalRank: 0 is less than 1",
+		{"google.com", "2000000", "com"}: "column GlobalRank: 2000000 is greater than 1e+06",
+		{"google.com", "n/a", "com"}:     "column GlobalRank: 'n/a' is no number",
+		{"google.de", "1", "de"}:         "column TLD: 'de' is not one of com, org",
+	} {
+		assert.Error(t, l.config.validateRow(row[:]), want)
+	}
+}
+
+func TestValidateRulesInvalid(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "columns.json")
+	assert.NilError(t, os.WriteFile(filename, []byte(`{"columns": [{"header": "Domain", "validate": {"pattern": "[a-z"}}]}`), 0o644))
+	_, err := ParseFlags([]string{"-map-file", filename})
+	assert.ErrorContains(t, err, "invalid validation of column Domain: invalid pattern")
+
+	assert.NilError(t, os.WriteFile(filename, []byte(`{"columns": [{"header": "Rank", "validate": {"min": 10, "max": 1}}]}`), 0o644))
+	_, err = ParseFlags([]string{"-map-file", filename})
+	assert.ErrorContains(t, err, "invalid validation of column Rank: min 10 is greater than max 1")
+}
+
+func TestLoaderRunValidationRejects(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "domains.csv")
+	assert.NilError(t, os.WriteFile(filename, []byte("GlobalRank,Domain,TLD\n1,google.com,com\n0,youtube.com,com\n"+
+		"3,facebook.com,com\n4,Example.com,com\n"), 0o644))
+	mapFile := filepath.Join(dir, "columns.json")
+	assert.NilError(t, os.WriteFile(mapFile, []byte(validationMapFile), 0o644))
+	rejectsFile := filepath.Join(dir, "rejects.csv")
+	c, err := ParseFlags([]string{"-dry-run", "-csv", filename, "-map-file", mapFile, "-max-errors", "2", "-rejects-file", rejectsFile})
+	assert.NilError(t, err)
+
+	stats, err := New(nil, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, stats.RowsInserted, int64(2))
+	content, err := os.ReadFile(rejectsFile)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "input,row,line,error\n"+
+		filename+",2,3,column GlobalRank: 0 is less than 1\n"+
+		filename+",4,5,column Domain: 'Example.com' doesn't match [a-z0-9.-]+\n")
+}
@@ -0,0 +1,72 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TableCount are the rows of a table counted by -verify and the sum of the -verify-sum column
+type TableCount struct {
+	Rows int64
+	Sum  float64
+}
+
+// CountTableRows counts the rows of table matching where (all rows if empty) and sums up sumColumn (if not empty)
+func CountTableRows(ctx context.Context, db *sql.DB, d Dialect, table string, where string, sumColumn string) (TableCount, error) {
+	var b strings.Builder
+	b.WriteString("SELECT COUNT(*)")
+	if sumColumn != "" {
+		fmt.Fprintf(&b, ", COALESCE(SUM(%s), 0)", quoteIdentifier(d, sumColumn))
+	}
+	b.WriteString(" FROM " + quoteTable(d, table))
+	if where != "" {
+		b.WriteString(" WHERE " + where)
+	}
+	var count TableCount
+	dest := []any{&count.Rows}
+	if sumColumn != "" {
+		dest = append(dest, &count.Sum)
+	}
+	if err := db.QueryRowContext(ctx, b.String()).Scan(dest...); err != nil {
+		return count, fmt.Errorf("could not count the rows of table %s: %w", table, err)
+	}
+	return count, nil
+}
+
+// verifyCounts compares the rows of the table counted before and after an import with the rows inserted and, with a
+// -verify-sum column, the sum of the column with the sum of the inserted values
+func (c *Config) verifyCounts(table string, before TableCount, after TableCount, inserted int64, sum float64) error {
+	var diffs []string
+	if grown := after.Rows - before.Rows; grown != inserted {
+		diffs = append(diffs, fmt.Sprintf("%d rows were inserted but the table has %d rows more (%d before, %d after), %+d",
+			inserted, grown, before.Rows, after.Rows, grown-inserted))
+	}
+	if c.VerifySum != "" {
+		// the sums of integers are exact up to 2^53, the tolerance is for the rounding of decimals
+		grown := after.Sum - before.Sum
+		if math.Abs(grown-sum) > 1e-9*max(1, math.Abs(sum)) {
+			diffs = append(diffs, fmt.Sprintf("the inserted %s values sum up to %g but the sum of the table grew by %g (%g before, %g after)",
+				c.VerifySum, sum, grown, before.Sum, after.Sum))
+		}
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("verification of table %s failed: %s", table, strings.Join(diffs, "; "))
+	}
+	log.Printf("Verified table %s: %d rows more (%d before, %d after)", table, after.Rows-before.Rows, before.Rows, after.Rows)
+	return nil
+}
+
+// verifySumColumn returns the table column VerifySum is inserted into
+func (c *Config) verifySumColumn() string {
+	for _, m := range c.ColumnMap {
+		if m.Header == c.VerifySum {
+			return m.Column
+		}
+	}
+	return c.VerifySum
+}
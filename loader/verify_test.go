@@ -0,0 +1,63 @@
+package loader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestCountTableRows(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT COUNT(*) FROM `shop`.`domain`").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT COUNT(*), COALESCE(SUM(`GlobalRank`), 0) FROM `domain` WHERE batch_id = 42").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "sum"}).AddRow(2, 7.0))
+
+	count, err := CountTableRows(context.Background(), db, mysqlDialect{}, "shop.domain", "", "")
+	assert.NilError(t, err)
+	assert.Equal(t, count, TableCount{Rows: 3})
+	count, err = CountTableRows(context.Background(), db, mysqlDialect{}, "domain", "batch_id = 42", "GlobalRank")
+	assert.NilError(t, err)
+	assert.Equal(t, count, TableCount{Rows: 2, Sum: 7})
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyCounts(t *testing.T) {
+	l := newTestLoader()
+	var err error
+	l.config, err = ParseFlags([]string{"-verify", "-verify-sum", "GlobalRank"})
+	assert.NilError(t, err)
+
+	assert.NilError(t, l.config.verifyCounts("domain", TableCount{Rows: 10, Sum: 55}, TableCount{Rows: 13, Sum: 61}, 3, 6))
+	// an ignored duplicate was counted as inserted
+	err = l.config.verifyCounts("domain", TableCount{Rows: 10, Sum: 55}, TableCount{Rows: 12, Sum: 58}, 3, 6)
+	assert.Error(t, err, "verification of table domain failed: 3 rows were inserted but the table has 2 rows more "+
+		"(10 before, 12 after), -1; the inserted GlobalRank values sum up to 6 but the sum of the table grew by 3 (55 before, 58 after)")
+}
+
+func TestVerifyFlags(t *testing.T) {
+	c, err := ParseFlags([]string{"-verify", "-verify-sum", "Rank", "-map", "GlobalRank=Rank,Domain"})
+	assert.NilError(t, err)
+	// the column is named by its header
+	assert.ErrorContains(t, c.ResolveColumns([]string{"Domain", "GlobalRank"}), "unknown column 'Rank'")
+	c, err = ParseFlags([]string{"-verify", "-verify-sum", "GlobalRank", "-map", "GlobalRank=Rank,Domain"})
+	assert.NilError(t, err)
+	assert.NilError(t, c.ResolveColumns([]string{"Domain", "GlobalRank"}))
+	assert.Equal(t, c.verifySumColumn(), "Rank")
+	assert.DeepEqual(t, c.sumIndexes(), []int{1})
+	c, err = ParseFlags([]string{"-verify", "-verify-sum", "GlobalRank", "-map", "Domain"})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.ResolveColumns([]string{"Domain", "GlobalRank"}), "-verify-sum column GlobalRank isn't inserted")
+
+	for want, args := range map[string][]string{
+		"-verify-where and -verify-sum require -verify":  {"-verify-where", "batch_id = 42"},
+		"-verify can't be combined with -table-template": {"-verify", "-table-template", "domain_{{date}}"},
+		"-dry-run can't be combined with -verify":        {"-verify", "-dry-run"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want)
+	}
+}
@@ -0,0 +1,181 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// watchLockTimeout is how long Watch waits for the lock of the table held by another process before it tries again
+// with the next poll
+const watchLockTimeout = time.Second
+
+// Watcher loads the files dropped into a directory one after another: a file is loaded once it stopped changing
+// for a poll interval and is moved to the processed or the failed directory afterwards, with the error of a failed
+// load next to it. With MySQL a named lock (GET_LOCK) of the table makes sure several watchers of the same table
+// load a single file at a time.
+type Watcher struct {
+	db     *sql.DB
+	config Config
+	// seen are the size and modification time of the files at the previous poll, a file is loaded once they stayed
+	// the same
+	seen map[string]fileState
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewWatcher watches the -watch-dir of c and loads the files into db
+func NewWatcher(db *sql.DB, c Config) *Watcher {
+	return &Watcher{db: db, config: c, seen: make(map[string]fileState)}
+}
+
+// Watch polls the directory every -watch-interval and loads the files which stopped changing until ctx is done.
+// An interrupted load leaves its file in the directory, so it is loaded again by the next run.
+func (w *Watcher) Watch(ctx context.Context) error {
+	for _, dir := range []string{w.config.ProcessedDir, w.config.FailedDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	log.Printf("Watching %s for files to load into %s", w.config.WatchDir, w.config.Table)
+	ticker := time.NewTicker(w.config.WatchInterval)
+	defer ticker.Stop()
+	for {
+		ready, err := w.poll()
+		if err != nil {
+			return err
+		}
+		for _, path := range ready {
+			if err = w.loadFile(ctx, path); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll returns the files in name order which didn't change since the previous poll
+func (w *Watcher) poll() ([]string, error) {
+	entries, err := os.ReadDir(w.config.WatchDir)
+	if err != nil {
+		return nil, err
+	}
+	var ready []string
+	seen := make(map[string]fileState, len(entries))
+	for _, entry := range entries {
+		// hidden files are still being written by a tool moving them into place when they are done
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(w.config.WatchDir, entry.Name())
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		seen[path] = state
+		if previous, ok := w.seen[path]; ok && previous == state {
+			ready = append(ready, path)
+		}
+	}
+	sort.Strings(ready)
+	w.seen = seen
+	return ready, nil
+}
+
+// loadFile loads the file path with the lock of the table and moves it away, unless ctx is done or another
+// process holds the lock
+func (w *Watcher) loadFile(ctx context.Context, path string) error {
+	unlock, locked, err := w.lock(ctx)
+	if err != nil || !locked {
+		return err
+	}
+	defer unlock()
+	// another watcher may have loaded the file while this one was waiting for the lock
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	c := w.config
+	c.CsvFile, c.CsvFiles = path, nil
+	log.Printf("Loading %s", path)
+	stats, err := New(w.db, c).Run(ctx)
+	if ctx.Err() != nil {
+		log.Warnf("Loading %s interrupted, it stays in %s: %v", path, w.config.WatchDir, err)
+		return nil
+	}
+	delete(w.seen, path)
+	if err != nil {
+		log.Errorf("Loading %s failed: %s", path, err.Error())
+		target, moveErr := moveFile(path, w.config.FailedDir)
+		if moveErr != nil {
+			return moveErr
+		}
+		return os.WriteFile(target+".error", []byte(err.Error()+"\n"), 0o644)
+	}
+	if _, err = moveFile(path, w.config.ProcessedDir); err != nil {
+		return err
+	}
+	log.Printf("Loaded %s: %d of %d rows inserted", path, stats.RowsInserted, stats.RowsRead)
+	return nil
+}
+
+// lock takes the named lock of the table with MySQL, locked is false when another process holds it
+func (w *Watcher) lock(ctx context.Context) (unlock func(), locked bool, err error) {
+	if w.db == nil || !w.config.isMySQL() {
+		return func() {}, true, nil
+	}
+	conn, err := w.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	name := "go-mysql-worker:" + w.config.Table
+	var got sql.NullInt64
+	if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, watchLockTimeout.Seconds()).Scan(&got); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("could not lock table %s: %w", w.config.Table, err)
+	}
+	if got.Int64 != 1 {
+		conn.Close()
+		log.Debugf("Table %s is locked by another process", w.config.Table)
+		return nil, false, nil
+	}
+	return func() {
+		// closing the connection releases the lock anyway
+		if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name); err != nil {
+			log.Warnf("Could not release the lock of table %s: %s", w.config.Table, err.Error())
+		}
+		conn.Close()
+	}, true, nil
+}
+
+// moveFile moves path into dir and returns its new path, a file of the same name in dir gets a timestamp prefix
+func moveFile(path string, dir string) (string, error) {
+	target := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Stat(target); err == nil {
+		target = filepath.Join(dir, time.Now().Format("20060102T150405.000")+"-"+filepath.Base(path))
+	}
+	if err := os.Rename(path, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
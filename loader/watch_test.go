@@ -0,0 +1,99 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+func TestWatcherPoll(t *testing.T) {
+	dir := t.TempDir()
+	c, err := ParseFlags([]string{"-watch-dir", dir})
+	assert.NilError(t, err)
+	assert.Equal(t, c.ProcessedDir, filepath.Join(dir, "processed"))
+	w := NewWatcher(nil, c)
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "b.csv"), []byte("Domain\n"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "a.csv"), []byte("Domain\n"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, ".c.csv.part"), []byte("Domain\n"), 0o644))
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, "processed"), 0o755))
+
+	ready, err := w.poll()
+	assert.NilError(t, err)
+	assert.Equal(t, len(ready), 0, "a file is ready once it didn't change for a poll")
+	// b.csv is still being written
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "b.csv"), []byte("Domain\ngoogle.com\n"), 0o644))
+	ready, err = w.poll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ready, []string{filepath.Join(dir, "a.csv")})
+	ready, err = w.poll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ready, []string{filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")})
+}
+
+func TestWatcherLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	c, err := ParseFlags([]string{"-watch-dir", dir, "-dialect", "sqlite", "-table", "domain", "-workers", "1", "-max-retries", "0"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec(`INSERT INTO "domain" ("Domain") VALUES (?)`).WithArgs("google.com").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "domain" ("Domain") VALUES (?)`).WithArgs("youtube.com").WillReturnError(errors.New("disk full"))
+
+	w := NewWatcher(db, c)
+	assert.NilError(t, os.MkdirAll(c.ProcessedDir, 0o755))
+	assert.NilError(t, os.MkdirAll(c.FailedDir, 0o755))
+	for name, domain := range map[string]string{"a.csv": "google.com", "b.csv": "youtube.com"} {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), []byte("Domain\n"+domain+"\n"), 0o644))
+	}
+	assert.NilError(t, w.loadFile(context.Background(), filepath.Join(dir, "a.csv")))
+	assert.NilError(t, w.loadFile(context.Background(), filepath.Join(dir, "b.csv")))
+	assert.NilError(t, mock.ExpectationsWereMet())
+
+	_, err = os.Stat(filepath.Join(c.ProcessedDir, "a.csv"))
+	assert.NilError(t, err)
+	_, err = os.Stat(filepath.Join(c.FailedDir, "b.csv"))
+	assert.NilError(t, err)
+	content, err := os.ReadFile(filepath.Join(c.FailedDir, "b.csv.error"))
+	assert.NilError(t, err)
+	assert.Assert(t, len(content) > 0)
+	entries, err := os.ReadDir(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 2, "only the processed and failed directories are left")
+}
+
+func TestWatchFlags(t *testing.T) {
+	for want, args := range map[string][]string{
+		"-processed-dir and -failed-dir require -watch-dir":  {"-processed-dir", "done"},
+		"invalid watch-interval 0s, must be positive":        {"-watch-dir", "incoming", "-watch-interval", "0s"},
+		"-watch-dir can't be combined with -checkpoint-file": {"-watch-dir", "incoming", "-checkpoint-file", "import.checkpoint"},
+		"-watch-dir can't be combined with inputs":           {"-watch-dir", "incoming", "a.csv"},
+		"-watch-dir can't be combined with -dry-run":         {"-watch-dir", "incoming", "-dry-run"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.csv")
+	assert.NilError(t, os.WriteFile(source, []byte("1"), 0o644))
+	target, err := moveFile(source, t.TempDir())
+	assert.NilError(t, err)
+	assert.Equal(t, filepath.Base(target), "a.csv")
+
+	// a file of the same name isn't overwritten
+	assert.NilError(t, os.WriteFile(source, []byte("2"), 0o644))
+	second, err := moveFile(source, filepath.Dir(target))
+	assert.NilError(t, err)
+	assert.Assert(t, second != target)
+	content, err := os.ReadFile(target)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "1")
+}
@@ -0,0 +1,140 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BatchError is the error of a batch which failed for good (after all retries and reconnects)
+type BatchError struct {
+	Worker int
+	// Rows are the numbers of the rows of the batch
+	Rows []int
+	Err  error
+	// retryErrors are the -retry-errors of the run, nil the default ones
+	retryErrors []uint16
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("worker %d failed to insert rows %v: %s", e.Worker, rowRanges(e.Rows), e.Err.Error())
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// Transient reports whether the batch failed because of the state of the database (lock wait timeout, deadlock,
+// lost connection) rather than its rows, so importing the rows again may succeed
+func (e *BatchError) Transient() bool {
+	c := Config{RetryErrors: e.retryErrors}
+	return c.isTransient(e.Err)
+}
+
+// isTransient reports whether err is caused by the state of the database rather than the rows of a batch
+func (c *Config) isTransient(err error) bool {
+	return c.isRetryable(err) || isGoneAway(err)
+}
+
+// Workers are the running workers of an import. The first worker failing aborts the import: from then on the
+// workers only drain their jobs and count the rows as failed, so the reader never blocks on a full channel.
+// A nil *Workers never fails.
+type Workers struct {
+	wg     sync.WaitGroup
+	failed atomic.Bool
+	mu     sync.Mutex
+	err    error
+	// cancel releases the context of the statements once every worker exited
+	cancel context.CancelFunc
+	// failHooks are called when the first worker failed
+	failHooks []func()
+}
+
+// fail records the error of a worker, only the first one is kept
+func (w *Workers) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+		for _, f := range w.failHooks {
+			f()
+		}
+	}
+	w.failed.Store(true)
+}
+
+// afterFail calls f once the first worker failed, at once if one did already
+func (w *Workers) afterFail(f func()) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		f()
+		return
+	}
+	w.failHooks = append(w.failHooks, f)
+}
+
+// Failed reports whether a worker failed
+func (w *Workers) Failed() bool {
+	return w != nil && w.failed.Load()
+}
+
+// Wait waits until every worker exited and returns the error of the first failed worker
+func (w *Workers) Wait() error {
+	w.wg.Wait()
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// discard drains jobs counting the rows as failed
+func (l *Loader) discard(jobs <-chan Job) {
+	for range jobs {
+		l.rowsFailed.Add(1)
+	}
+}
+
+// graceContext returns the context for the statements of the workers: it is canceled grace after ctx is, so the
+// batches flushed when the import is interrupted still get the chance to finish
+func graceContext(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		log.Warnf("Interrupted, giving the workers %s to flush their batches", grace)
+		time.AfterFunc(grace, cancel)
+	})
+	return graceCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// errBatchTimeout is wrapped by the error of a statement aborted by -batch-timeout
+var errBatchTimeout = errors.New("batch timed out")
+
+// batchContext returns the context of a batch statement, canceled after -batch-timeout
+func (c *Config) batchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.BatchTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.BatchTimeout)
+}
+
+// batchTimedOut wraps err of a statement executed with stmtCtx of batchContext(ctx) in errBatchTimeout when the
+// statement was aborted by -batch-timeout rather than by ctx
+func (c *Config) batchTimedOut(stmtCtx context.Context, ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != nil || !errors.Is(stmtCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w after %s: %w", errBatchTimeout, c.BatchTimeout, err)
+}
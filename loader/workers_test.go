@@ -0,0 +1,120 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"gotest.tools/v3/assert"
+)
+
+// newDomainLoader makes l import into db inputs with the columns GlobalRank and Domain
+func newDomainLoader(l *Loader, db *sql.DB) *Loader {
+	l.DB, l.headers = db, []string{"GlobalRank", "Domain"}
+	return l
+}
+
+func TestWorkerReportsBatchError(t *testing.T) {
+	l := withConnConfig(t, 5)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec("INSERT INTO `domain` (`Domain`) VALUES (?), (?)").
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'PRIMARY'"})
+
+	jobs := make(chan Job, 10)
+	jobs <- Job{Row: 1, Values: []string{"a"}}
+	jobs <- Job{Row: 2, Values: []string{"a"}}
+	close(jobs)
+	err = l.worker(context.Background(), 0, db, jobs, l.newBatchQueries("domain", []string{"Domain"}), nil)
+	var batchErr *BatchError
+	assert.Assert(t, errors.As(err, &batchErr))
+	assert.DeepEqual(t, batchErr.Rows, []int{1, 2})
+	assert.Assert(t, !batchErr.Transient(), "a duplicate key fails again")
+	assert.ErrorContains(t, err, "worker 0 failed to insert rows [[1 2]]: Error 1062")
+	assert.Equal(t, l.rowsFailed.Load(), int64(2))
+	assert.NilError(t, mock.ExpectationsWereMet())
+}
+
+func TestBatchErrorTransient(t *testing.T) {
+	assert.Assert(t, (&BatchError{Err: &mysql.MySQLError{Number: 1213}}).Transient())
+	assert.Assert(t, (&BatchError{Err: mysql.ErrInvalidConn}).Transient())
+	assert.Assert(t, !(&BatchError{Err: &mysql.MySQLError{Number: 1366}}).Transient())
+}
+
+func TestWorkersAbortOnFailure(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.MaxReconnects = 0
+	// every connection is dead, so the first batch fails and aborts the import
+	connector := &goneAwayConnector{dead: 1 << 30}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	const n = 500
+	jobs := make(chan Job, channelBufferSize)
+	workers := newDomainLoader(l, db).StartWorkers(context.Background(), jobs)
+	for i := 1; i <= n; i++ {
+		jobs <- Job{Row: i, Values: []string{strconv.Itoa(i), "google.com"}}
+	}
+	close(jobs)
+	err := workers.Wait()
+	var batchErr *BatchError
+	assert.Assert(t, errors.As(err, &batchErr))
+	assert.Assert(t, batchErr.Transient())
+	assert.Assert(t, workers.Failed())
+	// the reader wasn't blocked and every row is accounted for
+	assert.Equal(t, l.rowsFailed.Load(), int64(n))
+	assert.Equal(t, l.rowsInserted.Load(), int64(0))
+}
+
+func TestWorkersFlushOnCancel(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.Workers = 2
+	connector := &goneAwayConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	// the rows read before the interrupt are flushed within the grace period
+	const n = 5
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := make(chan Job, n)
+	workers := newDomainLoader(l, db).StartWorkers(ctx, jobs)
+	for i := 1; i <= n; i++ {
+		jobs <- Job{Row: i, Values: []string{strconv.Itoa(i), "google.com"}}
+	}
+	cancel()
+	close(jobs)
+	assert.NilError(t, workers.Wait())
+	assert.Equal(t, l.rowsInserted.Load(), int64(n))
+	assert.Equal(t, l.rowsFailed.Load(), int64(0))
+}
+
+func TestWorkersCancelAfterGrace(t *testing.T) {
+	l := withConnConfig(t, 5)
+	l.config.Workers = 2
+	l.config.ShutdownGrace = 0
+	connector := &goneAwayConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := make(chan Job, 10)
+	workers := newDomainLoader(l, db).StartWorkers(ctx, jobs)
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	const n = 10
+	for i := 1; i <= n; i++ {
+		jobs <- Job{Row: i, Values: []string{strconv.Itoa(i), "google.com"}}
+	}
+	close(jobs)
+	err := workers.Wait()
+	assert.Assert(t, errors.Is(err, context.Canceled), err)
+	// the rows not flushed in time are still accounted for
+	assert.Equal(t, l.rowsFailed.Load(), int64(n))
+	assert.Equal(t, l.rowsInserted.Load(), int64(0))
+}
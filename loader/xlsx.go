@@ -0,0 +1,463 @@
+package loader
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// xlsxHeaderScan is the number of rows the header of a sheet is detected in without -sheet-header-row
+const xlsxHeaderScan = 10
+
+// xlsxReader reads the rows of a worksheet of an Excel workbook like a CSV input: the first Read returns the header,
+// by default the first row with as many cells as the widest of the first rows, so the title rows above a table are
+// skipped. The cells are converted by their type: shared and inline strings as they are, numbers in the shortest
+// decimal form and the numbers with a date format as dates (2006-01-02), times (15:04:05) or both. The workbook is
+// read into memory, a zip archive can't be read as a stream.
+type xlsxReader struct {
+	decoder *xml.Decoder
+	// size is the size of the workbook and sheetSize the one of the sheet XML, to estimate the InputOffset
+	size, sheetSize int64
+	strings         []string
+	// dates are the cell styles with a date format
+	dates    []bool
+	date1904 bool
+	// line is the number of the row read last, the numbers of Excel, and parsed the one of the row parsed last
+	line   int
+	parsed int
+	header bool
+	// headerRow is the -sheet-header-row, 0 detects the header
+	headerRow int
+	// ahead are the rows read to find the header, width is the number of its columns
+	ahead []xlsxRow
+	width int
+	done  bool
+}
+
+// xlsxRow is a row of a sheet with its number and the values of its cells
+type xlsxRow struct {
+	line   int
+	values []string
+	err    error
+}
+
+// the XML of the parts of a workbook read by xlsxReader
+type (
+	xlsxWorkbook struct {
+		Properties struct {
+			Date1904 bool `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			// ID is the relationship of the sheet, its namespace differs between the transitional and strict formats
+			ID string `xml:"id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	xlsxRelationships struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Type   string `xml:"Type,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	// xlsxText is a string of the shared strings or of an inline string cell, a plain or a rich text of runs
+	xlsxText struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	}
+	xlsxStyles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	xlsxSheetRow struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Style  int      `xml:"s,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	}
+)
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.Text)
+	}
+	return b.String()
+}
+
+// openXLSXReader reads the -sheet of the workbook name read from r
+func (c *Config) openXLSXReader(name string, r io.Reader) (*xlsxReader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s is no xlsx workbook: %w", name, err)
+	}
+	var workbook xlsxWorkbook
+	if err = decodeXLSXPart(archive, "xl/workbook.xml", &workbook); err != nil {
+		return nil, fmt.Errorf("%s is no xlsx workbook: %w", name, err)
+	}
+	var rels xlsxRelationships
+	if err = decodeXLSXPart(archive, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, fmt.Errorf("%s is no xlsx workbook: %w", name, err)
+	}
+	// the targets are relative to the workbook
+	parts := map[string]string{}
+	for _, rel := range rels.Relationships {
+		target := path.Join("xl", rel.Target)
+		if strings.HasPrefix(rel.Target, "/") {
+			target = strings.TrimPrefix(rel.Target, "/")
+		}
+		parts[rel.ID] = target
+		parts[path.Base(rel.Type)] = target
+	}
+
+	sheet := -1
+	names := make([]string, len(workbook.Sheets))
+	for i, s := range workbook.Sheets {
+		names[i] = s.Name
+		if s.Name == c.Sheet {
+			sheet = i
+		}
+	}
+	if n, err := strconv.Atoi(c.Sheet); sheet < 0 && err == nil && n >= 1 && n <= len(names) {
+		sheet = n - 1
+	} else if sheet < 0 && c.Sheet == "" && len(names) > 0 {
+		sheet = 0
+	}
+	if sheet < 0 {
+		return nil, fmt.Errorf("-sheet %s isn't a sheet of %s, it has: %s", c.Sheet, name, strings.Join(names, ", "))
+	}
+
+	x := &xlsxReader{size: int64(len(data)), date1904: workbook.Properties.Date1904, headerRow: c.SheetHeaderRow}
+	if target, ok := parts["sharedStrings"]; ok {
+		var shared struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if err = decodeXLSXPart(archive, target, &shared); err != nil {
+			return nil, fmt.Errorf("error reading the strings of %s: %w", name, err)
+		}
+		x.strings = make([]string, len(shared.Items))
+		for i, item := range shared.Items {
+			x.strings[i] = item.String()
+		}
+	}
+	if target, ok := parts["styles"]; ok {
+		var styles xlsxStyles
+		if err = decodeXLSXPart(archive, target, &styles); err != nil {
+			return nil, fmt.Errorf("error reading the styles of %s: %w", name, err)
+		}
+		codes := map[int]string{}
+		for _, f := range styles.NumFmts {
+			codes[f.ID] = f.Code
+		}
+		x.dates = make([]bool, len(styles.CellXfs))
+		for i, xf := range styles.CellXfs {
+			code, custom := codes[xf.NumFmtID]
+			x.dates[i] = custom && isDateFormat(code) || !custom && isDateNumFmt(xf.NumFmtID)
+		}
+	}
+
+	target := parts[workbook.Sheets[sheet].ID]
+	file, err := archive.Open(target)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sheet %s of %s: %w", names[sheet], name, err)
+	}
+	if info, err := file.Stat(); err == nil {
+		x.sheetSize = info.Size()
+	}
+	x.decoder = xml.NewDecoder(file)
+	log.Printf("Reading sheet %s of %s", names[sheet], name)
+	return x, nil
+}
+
+// decodeXLSXPart decodes the XML of the part name of archive into v
+func decodeXLSXPart(archive *zip.Reader, name string, v any) error {
+	file, err := archive.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return xml.NewDecoder(file).Decode(v)
+}
+
+// isDateNumFmt reports whether the built-in number format id formats a date or a time
+func isDateNumFmt(id int) bool {
+	return id >= 14 && id <= 22 || id >= 27 && id <= 36 || id >= 45 && id <= 47 || id >= 50 && id <= 58
+}
+
+// isDateFormat reports whether the custom number format code formats a date or a time: it has a date or time
+// part outside of quoted texts, escaped characters and the sections in brackets like the colors
+func isDateFormat(code string) bool {
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; c {
+		case '"':
+			if end := strings.IndexByte(code[i+1:], '"'); end >= 0 {
+				i += end + 1
+			}
+		case '\\', '_', '*':
+			i++
+		case '[':
+			// [h], [m] and [s] are elapsed times
+			end := strings.IndexByte(code[i:], ']')
+			if end < 0 {
+				return false
+			}
+			if section := strings.ToLower(code[i+1 : i+end]); section != "" && strings.Trim(section, "hms") == "" {
+				return true
+			}
+			i += end
+		case 'y', 'Y', 'm', 'M', 'd', 'D', 'h', 'H', 's', 'S':
+			return true
+		}
+	}
+	return false
+}
+
+func (r *xlsxReader) Read() ([]string, error) {
+	if !r.header {
+		r.header = true
+		return r.readHeader()
+	}
+	var row xlsxRow
+	if len(r.ahead) > 0 {
+		row, r.ahead = r.ahead[0], r.ahead[1:]
+	} else {
+		var err error
+		if row, err = r.next(); err != nil {
+			return nil, err
+		}
+	}
+	r.line = row.line
+	// the empty cells at the end of a row are left out of the sheet
+	if len(row.values) < r.width && row.err == nil {
+		row.values = append(row.values, make([]string, r.width-len(row.values))...)
+	}
+	return row.values, row.err
+}
+
+// readHeader returns the -sheet-header-row, or the first row as wide as the widest of the first rows, the rows
+// after it are read again by Read
+func (r *xlsxReader) readHeader() ([]string, error) {
+	for len(r.ahead) < xlsxHeaderScan {
+		row, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.headerRow > 0 && row.line < r.headerRow {
+			continue
+		}
+		r.ahead = append(r.ahead, row)
+		if r.headerRow > 0 {
+			break
+		}
+	}
+	if len(r.ahead) == 0 {
+		return nil, io.EOF
+	}
+	header := 0
+	for i, row := range r.ahead {
+		if row.err == nil && len(row.values) > len(r.ahead[header].values) {
+			header = i
+		}
+	}
+	row := r.ahead[header]
+	if row.err != nil {
+		return nil, row.err
+	}
+	if header > 0 {
+		log.Printf("Skipping %d rows above the header in row %d", header, row.line)
+	}
+	r.ahead, r.line, r.width = r.ahead[header+1:], row.line, len(row.values)
+	return row.values, nil
+}
+
+// next returns the next row of the sheet which has a value, its values without the empty cells at the end
+func (r *xlsxReader) next() (xlsxRow, error) {
+	for !r.done {
+		token, err := r.decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return xlsxRow{}, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var sheetRow xlsxSheetRow
+		if err = r.decoder.DecodeElement(&sheetRow, &start); err != nil {
+			return xlsxRow{}, err
+		}
+		// the row number may be left out for the row after the one before
+		row := xlsxRow{line: cmp.Or(sheetRow.Number, r.parsed+1)}
+		r.parsed = row.line
+		column := -1
+		for _, c := range sheetRow.Cells {
+			column++
+			if c.Ref != "" {
+				if column, err = xlsxColumn(c.Ref); err != nil {
+					row.err = r.parseError(row.line, err)
+					break
+				}
+			}
+			value, err := r.value(c.Type, c.Style, c.Value, c.Inline)
+			if err != nil {
+				row.err = r.parseError(row.line, fmt.Errorf("cell %s: %w", cmp.Or(c.Ref, strconv.Itoa(column+1)), err))
+				break
+			}
+			if value == "" {
+				continue
+			}
+			if column >= len(row.values) {
+				row.values = append(row.values, make([]string, column+1-len(row.values))...)
+			}
+			row.values[column] = value
+		}
+		if len(row.values) > 0 || row.err != nil {
+			return row, nil
+		}
+	}
+	r.done = true
+	return xlsxRow{}, io.EOF
+}
+
+// value returns the text of a cell of type t with the cell style style and the value v or the inline string
+func (r *xlsxReader) value(t string, style int, v string, inline xlsxText) (string, error) {
+	switch t {
+	case "s":
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 || i >= len(r.strings) {
+			return "", fmt.Errorf("invalid shared string %s", v)
+		}
+		return r.strings[i], nil
+	case "inlineStr":
+		return inline.String(), nil
+	case "str", "b":
+		return v, nil
+	case "e":
+		return "", fmt.Errorf("the formula failed with %s", v)
+	case "d":
+		at, err := time.Parse("2006-01-02T15:04:05.999999999", strings.TrimSuffix(v, "Z"))
+		if err != nil {
+			return "", fmt.Errorf("invalid date %s", v)
+		}
+		return formatXLSXTime(at, at.Hour() == 0 && at.Minute() == 0 && at.Second() == 0, false), nil
+	}
+	if v == "" {
+		return "", nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid number %s", v)
+	}
+	if style >= 0 && style < len(r.dates) && r.dates[style] {
+		return r.serialTime(n), nil
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64), nil
+}
+
+// serialTime returns the time of the serial date n, the days since the epoch of the workbook with the time of day
+// as fraction
+func (r *xlsxReader) serialTime(n float64) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if r.date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	days := math.Floor(n)
+	seconds := math.Round((n - days) * 86400)
+	at := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+	return formatXLSXTime(at, seconds == 0, n < 1)
+}
+
+// formatXLSXTime formats a date without a time as 2006-01-02, a time without a date as 15:04:05 and both as
+// 2006-01-02 15:04:05
+func formatXLSXTime(at time.Time, dateOnly bool, timeOnly bool) string {
+	switch {
+	case timeOnly:
+		return at.Format(time.TimeOnly)
+	case dateOnly:
+		return at.Format(time.DateOnly)
+	}
+	return at.Format(time.DateTime)
+}
+
+// xlsxColumn returns the index of the column of the cell reference ref, e.g. 1 for B7
+func xlsxColumn(ref string) (int, error) {
+	column := 0
+	letters := strings.IndexFunc(ref, func(c rune) bool { return c < 'A' || c > 'Z' })
+	if letters <= 0 {
+		return 0, fmt.Errorf("invalid cell reference %s", ref)
+	}
+	for _, c := range ref[:letters] {
+		column = column*26 + int(c-'A') + 1
+	}
+	return column - 1, nil
+}
+
+// parseError returns the error of a cell as *csv.ParseError, which is skipped within -max-errors like a malformed
+// CSV row
+func (r *xlsxReader) parseError(line int, err error) error {
+	return &csv.ParseError{StartLine: line, Line: line, Err: err}
+}
+
+// InputOffset returns the share of the workbook size which the part of the sheet read so far has
+func (r *xlsxReader) InputOffset() int64 {
+	if r.done || r.sheetSize == 0 {
+		return r.size
+	}
+	return r.size * min(r.decoder.InputOffset(), r.sheetSize) / r.sheetSize
+}
+
+// FieldPos returns the number of the row read last, the column isn't known
+func (r *xlsxReader) FieldPos(int) (int, int) {
+	return r.line, 0
+}
+
+// validateXLSX checks the options of -input-format xlsx
+func (c *Config) validateXLSX() error {
+	if c.InputFormat != InputFormatXLSX {
+		if c.Sheet != "" || c.SheetHeaderRow != 0 {
+			return fmt.Errorf("-sheet and -sheet-header-row require -input-format %s", InputFormatXLSX)
+		}
+		return nil
+	}
+	if c.SheetHeaderRow < 0 {
+		return fmt.Errorf("invalid sheet-header-row %d, must not be negative", c.SheetHeaderRow)
+	}
+	if encoding := strings.ToLower(c.InputEncoding); encoding != "" && encoding != EncodingAuto {
+		return fmt.Errorf("-input-encoding can't be combined with -input-format %s, the workbooks are UTF-8", InputFormatXLSX)
+	}
+	return nil
+}
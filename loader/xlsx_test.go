@@ -0,0 +1,164 @@
+package loader
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gotest.tools/v3/assert"
+)
+
+// writeXLSX writes a workbook with the sheets of the given rows XML, which use the strings ss and the cell styles
+// 1 (date), 2 (custom time format) and 3 (number)
+func writeXLSX(t *testing.T, ss []string, sheets ...string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "book.xlsx")
+	f, err := os.Create(filename)
+	assert.NilError(t, err)
+	w := zip.NewWriter(f)
+	var entries, rels strings.Builder
+	for i := range sheets {
+		fmt.Fprintf(&entries, `<sheet name="Sheet %d" sheetId="%d" r:id="rId%d"/>`, i+1, i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	var strs strings.Builder
+	for _, s := range ss {
+		fmt.Fprintf(&strs, "<si><t>%s</t></si>", s)
+	}
+	parts := map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?><workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` + entries.String() + `</sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels.String() +
+			`<Relationship Id="rIdS" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>` +
+			`<Relationship Id="rIdT" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="/xl/styles.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + strs.String() +
+			`<si><r><t>rich </t></r><r><t>text</t></r><rPh><t>ignored</t></rPh></si></sst>`,
+		"xl/styles.xml": `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><numFmts count="2">` +
+			`<numFmt numFmtId="164" formatCode="hh:mm"/><numFmt numFmtId="165" formatCode="#,##0.00 &quot;days&quot;"/></numFmts>` +
+			`<cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="165"/></cellXfs></styleSheet>`,
+	}
+	for i, rows := range sheets {
+		parts[fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)] = `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			rows + `</sheetData></worksheet>`
+	}
+	for name, content := range parts {
+		pw, err := w.Create(name)
+		assert.NilError(t, err)
+		_, err = pw.Write([]byte(content))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, w.Close())
+	assert.NilError(t, f.Close())
+	return filename
+}
+
+// readXLSX returns the header, the rows and their row numbers of the sheet of filename read with c
+func readXLSX(t *testing.T, c Config, filename string) ([]string, [][]string, []int, error) {
+	t.Helper()
+	source, err := OpenCSVFile(filename)
+	assert.NilError(t, err)
+	defer source.Close()
+	_, reader, header, err := NextCSVReader(source, c)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var rows [][]string
+	var lines []int
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return header, rows, lines, nil
+		}
+		if err != nil {
+			return header, rows, lines, err
+		}
+		rows = append(rows, row)
+		lines = append(lines, readerLine(reader, nil))
+	}
+}
+
+// xlsxTable is a sheet with a title above the table, a sparse row, the cell types and a failed formula
+const xlsxTable = `<row r="1"><c r="A1" t="s"><v>0</v></c></row>` +
+	`<row r="3"><c r="A3" t="s"><v>1</v></c><c r="B3" t="s"><v>2</v></c><c r="C3" t="s"><v>3</v></c><c r="D3" t="s"><v>4</v></c></row>` +
+	`<row r="4"><c r="A4" t="s"><v>5</v></c><c r="B4"><v>0.10000000000000001</v></c><c r="C4" s="1"><v>45292</v></c><c r="D4" s="2"><v>0.5</v></c></row>` +
+	`<row r="5"><c r="A5" t="inlineStr"><is><t>inline</t></is></c><c r="C5" s="1"><v>45292.75</v></c></row>` +
+	`<row><c t="s"><v>6</v></c><c t="b"><v>1</v></c><c s="3"><v>1.5E3</v></c></row>` +
+	`<row r="8"><c r="A8" t="str"><v>formula</v></c><c r="B8" t="e"><v>#DIV/0!</v></c></row>`
+
+func TestXLSXReader(t *testing.T) {
+	c := Config{InputFormat: InputFormatXLSX}
+	filename := writeXLSX(t, []string{"Domains of 2024", "Domain", "Score", "Added", "At", "a.com"}, xlsxTable,
+		`<row r="2"><c r="A2" t="s"><v>1</v></c></row><row r="3"><c r="A3" t="s"><v>5</v></c></row>`)
+
+	header, rows, lines, err := readXLSX(t, c, filename)
+	assert.DeepEqual(t, header, []string{"Domain", "Score", "Added", "At"})
+	assert.DeepEqual(t, rows, [][]string{
+		{"a.com", "0.1", "2024-01-01", "12:00:00"},
+		{"inline", "", "2024-01-01 18:00:00", ""},
+		{"rich text", "1", "1500", ""},
+	})
+	assert.DeepEqual(t, lines, []int{4, 5, 6})
+	// a failed formula makes the row malformed
+	var parseErr *csv.ParseError
+	assert.Assert(t, errors.As(err, &parseErr), err)
+	assert.Equal(t, parseErr.Line, 8)
+	assert.ErrorContains(t, err, "cell B8: the formula failed with #DIV/0!")
+
+	c.Sheet = "Sheet 2"
+	header, rows, _, err = readXLSX(t, c, filename)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, header, []string{"Domain"})
+	assert.DeepEqual(t, rows, [][]string{{"a.com"}})
+
+	c.Sheet, c.SheetHeaderRow = "1", 4
+	header, _, _, _ = readXLSX(t, c, filename)
+	assert.DeepEqual(t, header, []string{"a.com", "0.1", "2024-01-01", "12:00:00"})
+
+	c.Sheet = "Totals"
+	_, _, _, err = readXLSX(t, c, filename)
+	assert.ErrorContains(t, err, "-sheet Totals isn't a sheet of "+filename+", it has: Sheet 1, Sheet 2")
+}
+
+func TestIsDateFormat(t *testing.T) {
+	for code, want := range map[string]bool{
+		"yyyy-mm-dd": true, "hh:mm:ss": true, "[h]:mm": true, "[Red]0.00": false, `0.00 "days"`: false,
+		`#,##0\d`: false, "General": false, "0.00E+00": false, "[$-409]mmm d": true,
+	} {
+		assert.Equal(t, isDateFormat(code), want, code)
+	}
+}
+
+func TestImportXLSX(t *testing.T) {
+	filename := writeXLSX(t, []string{"domain", "a.com", "b.com"},
+		`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><t>rank</t></is></c></row>`+
+			`<row r="2"><c r="A2" t="s"><v>1</v></c><c r="B2"><v>1</v></c></row><row r="3"><c r="A3" t="s"><v>2</v></c><c r="B3"><v>2</v></c></row>`)
+	c, err := ParseFlags([]string{"-csv", filename, "-input-format", "xlsx", "-table", "ranks", "-dialect", "sqlite", "-workers", "1"})
+	assert.NilError(t, err)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NilError(t, err)
+	defer db.Close()
+	mock.ExpectExec(`INSERT INTO "ranks" ("domain","rank") VALUES (?,?), (?,?)`).WithArgs("a.com", "1", "b.com", "2").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	stats, err := New(db, c).Run(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, stats.RowsInserted, int64(2))
+
+	for want, args := range map[string][]string{
+		"-sheet and -sheet-header-row require -input-format xlsx":   {"-sheet", "Totals"},
+		"-input-encoding can't be combined with -input-format xlsx": {"-input-format", "xlsx", "-input-encoding", "latin1"},
+		"only apply to -input-format csv":                           {"-input-format", "xlsx", "-delimiter", ";"},
+	} {
+		_, err := ParseFlags(args)
+		assert.ErrorContains(t, err, want)
+	}
+}
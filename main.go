@@ -3,239 +3,390 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/csv"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
+	"io/fs"
 	"math"
 	"os"
-	"runtime/pprof"
-	"strings"
-	"sync"
 	"time"
 
+	// the drivers of the postgres, sqlite and clickhouse dialects, the loader package brings the MySQL one
+	_ "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
 
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/joho/godotenv"
+	"go-mysql-worker/loader"
 )
 
+// exit codes of the process, an interrupted import exits with signalExitCode
 const (
-	dbMaxIdleConns    = 4
-	dbMaxConns        = 100
-	totalWorkers      = 100
-	channelBufferSize = 100
-	sqlBatchSize      = 8
-	CsvFile           = "majestic_million.csv"
+	exitOK = 0
+	// exitFailed is an invalid command line or environment, nothing was imported
+	exitFailed = 1
+	// exitPartial is a finished import which left rows out: malformed, rejected, failed or dead-lettered ones
+	exitPartial = 2
+	// exitFatal is an import which stopped with an error
+	exitFatal = 3
 )
 
-var (
-	dataHeaders []string
-)
+// outcomeExitCodes are the exit codes of the outcomes of an import
+var outcomeExitCodes = map[string]int{
+	loader.OutcomeSuccess: exitOK,
+	loader.OutcomePartial: exitPartial,
+	loader.OutcomeFailed:  exitFatal,
+}
 
 func main() {
+	os.Exit(run())
+}
+
+// run runs the command line and returns the exit code, so the deferred cleanup (profiles, connections) runs before
+// the process exits
+func run() int {
+	// .env is optional, the connection settings may as well come from the environment or a MySQL option file
 	err := godotenv.Load()
-	if err != nil {
-		log.Fatal(err.Error())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Error(err.Error())
+		return exitFailed
 	}
 
-	log.SetFormatter(&log.TextFormatter{
-		DisableColors: false,
-		FullTimestamp: true,
-	})
+	args := os.Args[1:]
+	command := ""
+	if len(args) > 0 && (args[0] == "healthcheck" || args[0] == "serve" || args[0] == "export" || args[0] == "sync" || args[0] == "bench" || args[0] == "rollback") {
+		command, args = args[0], args[1:]
+	} else if len(args) > 1 && args[0] == "config" && args[1] == "validate" {
+		command, args = "config validate", args[2:]
+	}
 
-	f, err := os.Create("myprogram.prof")
+	config, err := loader.ParseFlags(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
 	if err != nil {
-		fmt.Println(err)
-		return
+		log.Error(err.Error())
+		return exitFailed
 	}
-	pprof.StartCPUProfile(f)
-	start := time.Now()
 
-	db, err := OpenDBConnection()
-	if err != nil {
-		log.Fatal(err.Error())
+	if config.ListPresets {
+		presets, err := loader.LoadPresets(config.PresetsFile)
+		if err != nil {
+			log.Error(err.Error())
+			return exitFailed
+		}
+		loader.ListPresets(os.Stdout, presets)
+		return exitOK
 	}
-	defer db.Close()
 
-	csvReader, csvFile, err := OpenCSVFile(CsvFile)
-	if err != nil {
-		log.Fatal(err.Error())
+	loader.SetupLogging(log.StandardLogger(), config.LogFormat, config.LogLevel)
+	if command == "rollback" && config.RunID == "" {
+		log.Error("rollback requires -run-id, the run whose rows are deleted")
+		return exitFailed
+	}
+	if config.RunID == "" {
+		config.RunID = loader.NewRunID()
+	}
+	loader.SetRunID(log.StandardLogger(), config.RunID)
+	if config.LogFile != "" {
+		logFile, err := loader.SetupLogFile(log.StandardLogger(), config.LogFile, config.LogMaxSize, config.LogMaxFiles)
+		if err != nil {
+			log.Error(err.Error())
+			return exitFailed
+		}
+		defer logFile.Close()
 	}
-	defer csvFile.Close()
 
-	row, err := csvReader.Read()
-	if err == nil {
-		dataHeaders = row
-		log.Println("Fields found:", dataHeaders)
+	if command == "healthcheck" {
+		return runHealthCheck(config)
+	}
+	if command == "config validate" {
+		// the flags in the order they were applied, a later one wins
+		for _, arg := range config.Args() {
+			fmt.Println(arg)
+		}
+		log.Println("The configuration is valid")
+		return exitOK
 	}
 
-	jobs := make(chan []string, channelBufferSize)
-	quit := make(chan bool, totalWorkers)
+	stopCPUProfile := func() error { return nil }
+	if config.CPUProfile != "" {
+		if stopCPUProfile, err = loader.StartCPUProfile(config.CPUProfile); err != nil {
+			log.Error(err.Error())
+			return exitFailed
+		}
+	}
+	if config.PprofAddr != "" || config.BlockProfile != "" || config.MutexProfile != "" {
+		loader.EnableContentionProfiling()
+	}
+	if config.PprofAddr != "" {
+		stopPprof, err := loader.ServePprof(config.PprofAddr)
+		if err != nil {
+			log.Error(err.Error())
+			return exitFailed
+		}
+		defer func() {
+			if err := stopPprof(); err != nil {
+				log.Errorf("Could not stop serving pprof: %s", err.Error())
+			}
+		}()
+	}
+	start := time.Now()
 
-	var wg sync.WaitGroup
+	// a dry run never touches the database, so it doesn't need a connection, but the one of rollback counts the rows
+	var db *sql.DB
+	var shards []*sql.DB
+	if !config.DryRun || command == "rollback" {
+		if len(config.Shards) > 0 {
+			// the schema is read from the first shard
+			shards, err = loader.OpenShardConnections(config)
+			if err == nil {
+				db = shards[0]
+			}
+		} else {
+			db, err = loader.OpenDBConnection(config)
+			shards = []*sql.DB{db}
+		}
+		if err != nil {
+			log.Error(err.Error())
+			writeSummary(config, loader.Stats{}, err)
+			return exitFatal
+		}
+		defer func() {
+			for _, db := range shards {
+				if err := db.Close(); err != nil {
+					log.Errorf("Could not close the database connections: %s", err.Error())
+				}
+			}
+		}()
+	}
 
-	go StartWorkers(db, jobs, &wg, quit)
-	ProcessCSVFile(csvReader, jobs, 2000000)
-	StopWorkers(quit)
-	wg.Wait()
-	pprof.StopCPUProfile()
+	// an interrupt stops reading the input, the workers still flush the rows read so far within -shutdown-grace
+	ctx, interrupted, stop := shutdownContext()
+	defer stop()
+	defer pauseSignals()()
+	if command == "export" {
+		return runExport(ctx, interrupted, db, config)
+	}
+	if command == "serve" {
+		return runServe(ctx, interrupted, db, config)
+	}
+	if command == "sync" {
+		return runSync(ctx, interrupted, db, config)
+	}
+	if command == "bench" {
+		return runBench(ctx, interrupted, db, config)
+	}
+	if command == "rollback" {
+		return runRollback(ctx, interrupted, db, config)
+	}
+	if config.WatchDir != "" {
+		return runWatch(ctx, interrupted, db, config)
+	}
+	if len(config.Tables) > 0 {
+		return runPlan(ctx, interrupted, db, config)
+	}
+	l := loader.New(db, config)
+	if len(config.Shards) > 0 {
+		l.Shards = shards
+	}
+	stats, err := l.Run(ctx)
+	for _, db := range shards {
+		loader.LogPoolStats(db.Stats())
+	}
+	if err := stopCPUProfile(); err != nil {
+		log.Errorf("Could not write the CPU profile: %s", err.Error())
+	}
+	if config.MemProfile != "" {
+		if err := loader.WriteHeapProfile(config.MemProfile); err != nil {
+			log.Errorf("Could not write the heap profile: %s", err.Error())
+		}
+	}
+	for name, filename := range map[string]string{"block": config.BlockProfile, "mutex": config.MutexProfile} {
+		if filename == "" {
+			continue
+		}
+		if err := loader.WriteProfile(name, filename); err != nil {
+			log.Errorf("Could not write the %s profile: %s", name, err.Error())
+		}
+	}
+	writeSummary(config, stats, err)
+	if err != nil {
+		log.Error(err.Error())
+		if sig := interrupted(); sig != nil {
+			return signalExitCode(sig)
+		}
+		return exitFatal
+	}
+
+	// every failure ends the run early, so getting here means the import was successful
+	if config.CleanupOnSuccess {
+		loader.CleanupArtifacts()
+	}
 
 	duration := time.Since(start)
-	log.Printf("Done in %d seconds", int(math.Ceil(duration.Seconds())))
+	log.Printf("Done in %d seconds: %d of %d rows inserted in %d batches, %d failed", int(math.Ceil(duration.Seconds())),
+		stats.RowsInserted, stats.RowsRead, stats.BatchesExecuted, stats.RowsFailed)
+	return outcomeExitCodes[stats.Outcome(nil)]
 }
 
-func OpenDBConnection() (*sql.DB, error) {
-
-	dbUsername := os.Getenv("DB_USERNAME")
-	dbName := os.Getenv("DB_NAME")
-	dbPass := os.Getenv("DB_PASSWORD")
-	dbConnString := fmt.Sprintf("%s:%s@tcp(localhost:3306)/%s", dbUsername, dbPass, dbName)
-	dbConnStringPrintable := fmt.Sprintf("%s:***@tcp(localhost:3306)/%s", dbUsername, dbName)
-
-	log.Printf("Open DB connection using %s", dbConnStringPrintable)
-
-	db, err := sql.Open("mysql", dbConnString)
-	if err != nil {
-		return nil, err
+// writeSummary writes the summary of an import with stats which returned err to -summary-file, if given
+func writeSummary(config loader.Config, stats loader.Stats, err error) {
+	if config.SummaryFile == "" {
+		return
+	}
+	summary := loader.NewSummary(stats, err)
+	summary.RunID = config.RunID
+	if err := loader.WriteSummary(config.SummaryFile, summary); err != nil {
+		log.Errorf("Could not write the summary: %s", err.Error())
 	}
-
-	db.SetMaxOpenConns(dbMaxConns)
-	db.SetMaxIdleConns(dbMaxIdleConns)
-
-	return db, nil
 }
 
-// OpenCSVFile opens a CSV file and returns a reader and a file handle
-func OpenCSVFile(filename string) (*csv.Reader, *os.File, error) {
-	log.Printf("Open CSV file '%s'\n", filename)
+// runWatch loads the files dropped into -watch-dir until interrupted and returns the process exit code
+func runWatch(ctx context.Context, interrupted func() os.Signal, db *sql.DB, config loader.Config) int {
+	if err := loader.NewWatcher(db, config).Watch(ctx); err != nil {
+		log.Error(err.Error())
+		return exitFatal
+	}
+	if sig := interrupted(); sig != nil {
+		return signalExitCode(sig)
+	}
+	return exitOK
+}
 
-	file, err := os.Open(filename)
+// runPlan loads the tables of the -config file in the order of their dependencies and returns the process exit code
+func runPlan(ctx context.Context, interrupted func() os.Signal, db *sql.DB, config loader.Config) int {
+	start := time.Now()
+	tables, err := loader.NewPlan(db, config).Run(ctx)
+	total := loader.Total(tables)
+	writeSummary(config, total, err)
 	if err != nil {
-		log.Println("error opening csv file ", file, err.Error())
-		return nil, nil, err
+		log.Error(err.Error())
+		if sig := interrupted(); sig != nil {
+			return signalExitCode(sig)
+		}
+		return exitFatal
 	}
-
-	reader := csv.NewReader(file)
-	return reader, file, nil
+	for _, t := range tables {
+		log.Printf("%s: %d of %d rows inserted in %d batches, %d failed", t.Table, t.RowsInserted, t.RowsRead, t.BatchesExecuted, t.RowsFailed)
+	}
+	log.Printf("Done in %d seconds: %d of %d rows of %d tables inserted", int(math.Ceil(time.Since(start).Seconds())),
+		total.RowsInserted, total.RowsRead, len(tables))
+	return outcomeExitCodes[total.Outcome(nil)]
 }
 
-// toAnyList converts a slice of T to a slice of any
-func toAnyList[T any](input []T) []any {
-	list := make([]any, len(input))
-	for i, v := range input {
-		list[i] = v
+// runExport exports the table to -export-file and returns the process exit code
+func runExport(ctx context.Context, interrupted func() os.Signal, db *sql.DB, config loader.Config) int {
+	if db == nil {
+		log.Error("-dry-run can't be combined with export")
+		return exitFailed
 	}
-	return list
+	if len(config.Shards) > 0 {
+		log.Error("-shard can't be combined with export")
+		return exitFailed
+	}
+	stats, err := loader.NewExporter(db, config).Run(ctx)
+	if err != nil {
+		log.Error(err.Error())
+		if sig := interrupted(); sig != nil {
+			return signalExitCode(sig)
+		}
+		return exitFatal
+	}
+	log.Printf("Done in %d seconds: %d rows of %s exported in %d chunks to %v", int(math.Ceil(stats.Duration.Seconds())),
+		stats.Rows, config.Table, stats.Chunks, stats.Files)
+	return exitOK
 }
 
-func worker(workerIndex int, db *sql.DB, jobs <-chan []string, query string, placeholders string, wg *sync.WaitGroup, quit <-chan bool) {
-	defer wg.Add(-1)
-	conn, err := db.Conn(context.Background())
+// runSync makes the table match the inputs and returns the process exit code
+func runSync(ctx context.Context, interrupted func() os.Signal, db *sql.DB, config loader.Config) int {
+	stats, err := loader.NewSync(db, config).Run(ctx)
+	writeSummary(config, stats, err)
 	if err != nil {
-		log.Fatal(err.Error())
-		return
-	}
-	defer conn.Close()
-
-	for {
-		counter := 0
-		q := strings.Clone(query)
-		values := make([]string, 0)
-		timeout := false
-		exit := false
-		timer := time.After(1 * time.Second)
-		for {
-			select {
-			case <-timer:
-				timeout = true
-			case job := <-jobs:
-				if len(job) > 0 {
-					values = append(values, job...)
-					if counter > 0 {
-						q = q + ", (" + placeholders + ")"
-					}
-					log.Trace("Got values ", workerIndex, counter, len(job))
-					counter++
-				}
-			}
-			if counter >= sqlBatchSize || timeout {
-				break
-			}
-		}
-		if timeout {
-			log.Printf("Worker %d timeout\n", workerIndex)
+		log.Error(err.Error())
+		if sig := interrupted(); sig != nil {
+			return signalExitCode(sig)
 		}
-		if len(values) > 0 {
-			_, err = conn.ExecContext(context.Background(), q, toAnyList(values)...)
-			log.Trace("Worker data:", counter, query, values)
-			if err != nil {
-				log.Fatal(err.Error())
-			}
-		}
-		select {
-		case <-quit: // check for quit w/o blocking
-			log.Printf("Worker %d is exiting because of quit signal\n", workerIndex)
-			exit = true
-		default:
+		return exitFatal
+	}
+	log.Printf("Done in %d seconds: %d rows inserted, %d updated, %d deleted and %d unchanged of %d rows read",
+		int(math.Ceil(stats.Duration.Seconds())), stats.RowsInserted-stats.RowsUpdated, stats.RowsUpdated, stats.RowsDeleted,
+		stats.RowsUnchanged, stats.RowsRead)
+	return outcomeExitCodes[stats.Outcome(nil)]
+}
+
+// runBench imports synthetic rows with the combinations of workers and batch sizes, prints their throughput and
+// returns the process exit code
+func runBench(ctx context.Context, interrupted func() os.Signal, db *sql.DB, config loader.Config) int {
+	results, err := loader.NewBench(db, config).Run(ctx)
+	// the runs done so far are printed even if one failed
+	if len(results) > 0 {
+		if err := loader.WriteBenchMatrix(os.Stdout, results); err != nil {
+			log.Errorf("Could not write the throughput: %s", err.Error())
 		}
-		if exit {
-			log.Printf("Worker %d exits\n", workerIndex)
-			break
+	}
+	if err != nil {
+		log.Error(err.Error())
+		if sig := interrupted(); sig != nil {
+			return signalExitCode(sig)
 		}
+		return exitFatal
 	}
+	return exitOK
 }
 
-// StartWorkers starts all workers providing them a job queue and a wait group, database connection and a query to execute
-func StartWorkers(db *sql.DB, jobs <-chan []string, wg *sync.WaitGroup, quit <-chan bool) {
-	var placeholders = strings.Join(generateQuestionsMark(len(dataHeaders)), ",")
-	var query = fmt.Sprintf("INSERT INTO domain (%s) VALUES (%s)",
-		strings.Join(dataHeaders, ","),
-		placeholders,
-	)
-	for i := 0; i < totalWorkers; i++ {
-		log.Printf("Starting Worker %d\n", i)
-		wg.Add(1)
-		go worker(i, db, jobs, query, placeholders, wg, quit)
+// runRollback deletes the rows of the run -run-id from its tables and returns the process exit code
+func runRollback(ctx context.Context, interrupted func() os.Signal, db *sql.DB, config loader.Config) int {
+	results, err := loader.NewRollback(db, config).Run(ctx)
+	var rows int64
+	for _, r := range results {
+		rows += r.Rows
 	}
+	if err != nil {
+		log.Error(err.Error())
+		if sig := interrupted(); sig != nil {
+			return signalExitCode(sig)
+		}
+		return exitFatal
+	}
+	if config.DryRun {
+		log.Printf("Dry run, %d rows of run %s would be deleted from %d tables", rows, config.RunID, len(results))
+		return exitOK
+	}
+	log.Printf("Done: %d rows of run %s deleted from %d tables", rows, config.RunID, len(results))
+	return exitOK
 }
 
-// StopWorkers stops all workers by sending them a quit signal
-func StopWorkers(quit chan bool) {
-	log.Println("Quitting workers")
-	for i := 0; i < totalWorkers; i++ {
-		quit <- true
+// runServe imports the rows POSTed to -serve-addr until interrupted and returns the process exit code
+func runServe(ctx context.Context, interrupted func() os.Signal, db *sql.DB, config loader.Config) int {
+	if len(config.Shards) > 0 {
+		log.Error("-shard can't be combined with serve")
+		return exitFailed
+	}
+	if err := loader.NewServer(db, config).Serve(ctx); err != nil {
+		log.Error(err.Error())
+		return exitFatal
 	}
+	if sig := interrupted(); sig != nil {
+		return signalExitCode(sig)
+	}
+	return exitOK
 }
 
-// ProcessCSVFile processes a CSV file and sends the rows to the jobs channel
-// processing ends either when eof or maxLines is reached
-func ProcessCSVFile(reader *csv.Reader, jobs chan<- []string, maxLines int) {
-	rowcount := 0
-	for ; rowcount < maxLines; rowcount++ {
-		row, err := reader.Read()
-		if err != nil {
-			if err == io.EOF {
-				err = nil
-			}
-			break
-		}
-
-		log.Traceln("read line with values:", row)
-		jobs <- row
-		if rowcount%1000 == 0 {
-			log.Printf("Processed %d rows", rowcount)
-		}
-		// for testing only time.Sleep(2 * time.Second)
+// runHealthCheck runs the healthcheck subcommand and returns the process exit code
+func runHealthCheck(config loader.Config) int {
+	db, err := loader.OpenDBConnection(config)
+	if err != nil {
+		log.Error(err.Error())
+		return exitFailed
 	}
-	log.Printf("Processed %d rows", rowcount)
-	close(jobs)
-}
+	defer db.Close()
 
-// generateQuestionsMark generates a slice of question marks of length n (used for building SQL statements)
-func generateQuestionsMark(n int) []string {
-	var r = make([]string, n)
-	for i := range r {
-		r[i] = "?"
+	if err = loader.HealthCheck(context.Background(), db, config); err != nil {
+		log.Error(err.Error())
+		return exitFailed
 	}
-	return r
+	log.Println("Healthy")
+	return exitOK
 }
@@ -0,0 +1,41 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+
+	"go-mysql-worker/loader"
+)
+
+// pauseSignals pauses the import on SIGUSR1 and resumes it on SIGUSR2, SIGQUIT logs its status (instead of exiting
+// with a goroutine dump). The returned function releases the signals.
+func pauseSignals() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGQUIT)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGUSR1 && loader.Pause() {
+					log.Warnf("Received %s, pausing the import after the running batches (SIGUSR2 resumes it)", sig)
+				} else if sig == syscall.SIGUSR2 && loader.Resume() {
+					log.Warnf("Received %s, resuming the import", sig)
+				} else if sig == syscall.SIGQUIT {
+					loader.LogStatus()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,7 @@
+package main
+
+// pauseSignals does nothing, Windows has no SIGUSR1 and SIGUSR2 to pause and resume the import with (nor SIGQUIT
+// to log its status)
+func pauseSignals() (stop func()) {
+	return func() {}
+}
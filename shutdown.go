@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+
+	"go-mysql-worker/loader"
+)
+
+// shutdownContext returns a context canceled by the first SIGINT or SIGTERM, the import then stops reading and the
+// workers flush the rows read so far. received returns that signal, nil as long as there was none. A second signal
+// exits at once without waiting for the workers. stop releases the signals.
+func shutdownContext() (ctx context.Context, received func() os.Signal, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	var mu sync.Mutex
+	var first os.Signal
+	go func() {
+		select {
+		case sig := <-signals:
+			mu.Lock()
+			first = sig
+			mu.Unlock()
+			log.Warnf("Received %s, stopping the import after the workers flushed their batches (again to exit immediately)", sig)
+			// a paused import would wait for the grace period to end instead of flushing
+			loader.Resume()
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-signals:
+			log.Errorf("Received %s again, exiting without waiting for the workers", sig)
+			os.Exit(signalExitCode(sig))
+		case <-done:
+		}
+	}()
+	received = func() os.Signal {
+		mu.Lock()
+		defer mu.Unlock()
+		return first
+	}
+	stop = func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+	return ctx, received, stop
+}
+
+// signalExitCode is the exit code of a process ended by sig: 128 plus the number of the signal like a shell reports
+// it, e.g. 130 for SIGINT and 143 for SIGTERM
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return exitFailed
+}